@@ -5,11 +5,15 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
 	"github.com/jackiabishop/mileminder/internal/readings"
 )
 
@@ -38,6 +42,13 @@ var addCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("invalid odometer value: %v", err)
 		}
+		// Read and validate photos up front so a bad file rejects the whole
+		// command before the reading is written.
+		photoPaths, _ := cmd.Flags().GetStringArray("photo")
+		photos, err := readPhotos(photoPaths)
+		if err != nil {
+			return err
+		}
 
 		st, err := openStore()
 		if err != nil {
@@ -45,26 +56,71 @@ var addCmd = &cobra.Command{
 		}
 		ctx := cmd.Context()
 
-		// Load existing data to validate against the current max reading.
-		data, err := st.GetVehicle(ctx, carID)
+		// Validate against the current max reading under the same lock as
+		// the write, so a reading added meanwhile is counted.
+		err = st.UpdateVehicle(ctx, carID, func(data *model.VehicleData) error {
+			if max, below := readings.BelowMax(data.Readings, data.OdometerChanges, dateStr, miles); below && !force {
+				return fmt.Errorf("new reading %d is less than existing max %d; if the odometer was replaced or rolled over, record it with 'mileminder odometer record', or use --force to override", miles, max)
+			}
+			if data.Readings == nil {
+				data.Readings = map[string]int{}
+			}
+			data.Readings[dateStr] = miles
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		if max, below := readings.BelowMax(data.Readings, miles); below && !force {
-			return fmt.Errorf("new reading %d is less than existing max %d; use --force to override", miles, max)
-		}
+		fmt.Printf("Recorded odometer reading %d for %s on %s\n", miles, carID, dateStr)
 
-		if err := st.PutReading(ctx, carID, dateStr, miles); err != nil {
+		if len(photos) == 0 {
+			return nil
+		}
+		files, err := openAttachments()
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Recorded odometer reading %d for %s on %s\n", miles, carID, dateStr)
+		for _, p := range photos {
+			p.att.VehicleID, p.att.Date = carID, dateStr
+			if _, err := files.Put(ctx, p.att, p.content); err != nil {
+				return fmt.Errorf("reading recorded, but attaching %s failed: %w", p.att.Filename, err)
+			}
+			fmt.Printf("Attached %s\n", p.att.Filename)
+		}
 		return nil
 	},
 }
 
+// photo is one validated --photo file, ready to attach.
+type photo struct {
+	att     attachments.Attachment
+	content []byte
+}
+
+// readPhotos loads each path and applies the shared attachment size/type rule.
+func readPhotos(paths []string) ([]photo, error) {
+	photos := make([]photo, 0, len(paths))
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read photo: %w", err)
+		}
+		contentType, err := attachments.Sniff(content)
+		if err != nil {
+			return nil, fmt.Errorf("photo %s: %w", p, err)
+		}
+		photos = append(photos, photo{
+			att:     attachments.Attachment{ContentType: contentType, Filename: filepath.Base(p)},
+			content: content,
+		})
+	}
+	return photos, nil
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringP("car", "c", "", "Vehicle ID")
 	addCmd.Flags().String("date", "", "Date for reading (YYYY-MM-DD), default today")
 	addCmd.Flags().Bool("force", false, "Allow lower-than-previous readings")
+	addCmd.Flags().StringArray("photo", nil, "Attach a dashboard photo (JPEG, PNG or WebP) as evidence; repeatable")
 }
@@ -13,6 +13,8 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
 	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
 )
 
@@ -123,6 +125,26 @@ func backupFiles(srcDir string) ([]string, error) {
 	var files []string
 	for _, entry := range entries {
 		if entry.IsDir() {
+			// Reading attachments, trips and the trash are the data
+			// subtrees; any other directory is not ours.
+			switch entry.Name() {
+			case "attachments":
+				nested, err := attachmentFiles(srcDir)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, nested...)
+			case "trips":
+				if info, err := os.Stat(filepath.Join(srcDir, tripsFile)); err == nil && info.Mode().IsRegular() {
+					files = append(files, tripsFile)
+				}
+			case trashDir:
+				nested, err := trashFiles(srcDir)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, nested...)
+			}
 			continue
 		}
 
@@ -134,17 +156,80 @@ func backupFiles(srcDir string) ([]string, error) {
 			continue
 		}
 
-		name := entry.Name()
-		// "current" and "settings" are the two extensionless store documents
-		// (default-vehicle pointer, user preferences); everything else is a
-		// per-vehicle <id>.yml.
-		if name == "current" || name == "settings" || filepath.Ext(name) == ".yml" {
-			files = append(files, name)
+		if backupName(entry.Name()) {
+			files = append(files, entry.Name())
 		}
 	}
 	return files, nil
 }
 
+// backupName reports whether a file at the top of the data directory is
+// archived. "current" and "settings" are the two extensionless store
+// documents (default-vehicle pointer, user preferences); everything else is a
+// per-vehicle <id>.yml. An encrypted directory's files are archived as they
+// are, sealed, with the config that says how to unlock them. The events
+// store's log is its data; its snapshot is rebuilt from it.
+func backupName(name string) bool {
+	return name == "current" || name == "settings" || name == crypt.ConfigFile || name == eventstore.LogFile || filepath.Ext(name) == ".yml"
+}
+
+// tripsFile is the trip log's path relative to the data directory (see
+// trips.NewFileStore).
+const tripsFile = "trips/trips.yml"
+
+// trashDir holds the YAML store's trash, one <item-id>.yml per soft-deleted
+// vehicle or reading.
+const trashDir = "trash"
+
+// trashName reports whether a file in the trash directory is a trash item:
+// item ids are generated lowercase hex.
+func trashName(name string) bool {
+	id, ok := strings.CutSuffix(name, ".yml")
+	return ok && id != "" && strings.Trim(id, "0123456789abcdef") == ""
+}
+
+// trashFiles lists the trash items under srcDir/trash as srcDir-relative
+// paths.
+func trashFiles(srcDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(srcDir, trashDir))
+	if err != nil {
+		return nil, fmt.Errorf("read trash directory: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && trashName(e.Name()) {
+			files = append(files, path.Join(trashDir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// attachmentFiles lists the attachment index and content objects under
+// srcDir/attachments as srcDir-relative paths, skipping dot-prefixed names
+// (atomicfile temp files left by an interrupted write).
+func attachmentFiles(srcDir string) ([]string, error) {
+	var files []string
+	root := filepath.Join(srcDir, "attachments")
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read attachments directory: %w", err)
+	}
+	return files, nil
+}
+
 func addBackupFile(tw *tar.Writer, srcDir, name string) error {
 	srcPath := filepath.Join(srcDir, name)
 	info, err := os.Stat(srcPath)
@@ -156,7 +241,7 @@ func addBackupFile(tw *tar.Writer, srcDir, name string) error {
 	if err != nil {
 		return fmt.Errorf("create tar header for %q: %w", srcPath, err)
 	}
-	header.Name = path.Join("mileminder", name)
+	header.Name = path.Join("mileminder", filepath.ToSlash(name))
 
 	if err := tw.WriteHeader(header); err != nil {
 		return fmt.Errorf("write tar header for %q: %w", srcPath, err)
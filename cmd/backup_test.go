@@ -18,6 +18,8 @@ func TestWriteBackupArchivesDataFiles(t *testing.T) {
 	writeFile(t, filepath.Join(srcDir, "mini.yml"), "vehicle: Mini\n")
 	writeFile(t, filepath.Join(srcDir, "current"), "golf")
 	writeFile(t, filepath.Join(srcDir, "settings"), "currency: EUR\ndistance_unit: mi\n")
+	writeFile(t, filepath.Join(srcDir, "events.jsonl"), "{}\n")
+	writeFile(t, filepath.Join(srcDir, "events.snapshot"), "{}")
 	writeFile(t, filepath.Join(srcDir, "notes.txt"), "ignore me")
 	if err := os.Mkdir(filepath.Join(srcDir, "nested"), 0755); err != nil {
 		t.Fatal(err)
@@ -28,16 +30,17 @@ func TestWriteBackupArchivesDataFiles(t *testing.T) {
 	if err != nil {
 		t.Fatalf("writeBackup: %v", err)
 	}
-	if count != 4 {
-		t.Fatalf("file count: want 4, got %d", count)
+	if count != 5 {
+		t.Fatalf("file count: want 5, got %d", count)
 	}
 
 	got := readArchive(t, outPath)
 	want := map[string]string{
-		"mileminder/current":  "golf",
-		"mileminder/settings": "currency: EUR\ndistance_unit: mi\n",
-		"mileminder/golf.yml": "vehicle: Golf\n",
-		"mileminder/mini.yml": "vehicle: Mini\n",
+		"mileminder/current":      "golf",
+		"mileminder/settings":     "currency: EUR\ndistance_unit: mi\n",
+		"mileminder/golf.yml":     "vehicle: Golf\n",
+		"mileminder/mini.yml":     "vehicle: Mini\n",
+		"mileminder/events.jsonl": "{}\n",
 	}
 	if len(got) != len(want) {
 		t.Fatalf("archive entries: want %d, got %d: %#v", len(want), len(got), got)
@@ -113,3 +116,58 @@ func readArchive(t *testing.T, path string) map[string]string {
 	}
 	return entries
 }
+
+func TestWriteBackupIncludesAttachments(t *testing.T) {
+	srcDir := t.TempDir()
+	outPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	writeFile(t, filepath.Join(srcDir, "golf.yml"), "vehicle: Golf\n")
+	if err := os.MkdirAll(filepath.Join(srcDir, "attachments", "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(srcDir, "attachments", "index.yml"), "attachments: []\n")
+	writeFile(t, filepath.Join(srcDir, "attachments", "objects", "abc123"), "photo bytes")
+	writeFile(t, filepath.Join(srcDir, "attachments", ".index.yml.tmp-1"), "torn write")
+
+	count, err := writeBackup(srcDir, outPath)
+	if err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("file count: want 3, got %d", count)
+	}
+	got := readArchive(t, outPath)
+	if got["mileminder/attachments/objects/abc123"] != "photo bytes" {
+		t.Fatalf("attachment object missing from archive: %#v", got)
+	}
+	if _, ok := got["mileminder/attachments/index.yml"]; !ok {
+		t.Fatalf("attachment index missing from archive: %#v", got)
+	}
+}
+
+func TestWriteBackupIncludesTrash(t *testing.T) {
+	srcDir := t.TempDir()
+	outPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	writeFile(t, filepath.Join(srcDir, "golf.yml"), "vehicle: Golf\n")
+	if err := os.MkdirAll(filepath.Join(srcDir, "trash"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(srcDir, "trash", "0123abcd.yml"), "kind: vehicle\nvehicle_id: polo\n")
+	writeFile(t, filepath.Join(srcDir, "trash", ".0123abcd.yml.tmp-1"), "torn write")
+
+	count, err := writeBackup(srcDir, outPath)
+	if err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("file count: want 2, got %d", count)
+	}
+	got := readArchive(t, outPath)
+	if _, ok := got["mileminder/trash/0123abcd.yml"]; !ok {
+		t.Fatalf("trash item missing from archive: %#v", got)
+	}
+	if _, err := unpackBackup(outPath, t.TempDir()); err != nil {
+		t.Fatalf("restore refuses the archive: %v", err)
+	}
+}
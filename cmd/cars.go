@@ -4,8 +4,15 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
 	"github.com/spf13/cobra"
 )
 
@@ -19,11 +26,11 @@ var carsCmd = &cobra.Command{
 		}
 		ctx := cmd.Context()
 
-		records, err := st.ListVehicles(ctx)
+		summaries, err := st.ListVehicleSummaries(ctx)
 		if err != nil {
 			return err
 		}
-		if len(records) == 0 {
+		if len(summaries) == 0 {
 			fmt.Println("No vehicles found. Have you run `mileminder init`?")
 			return nil
 		}
@@ -33,7 +40,7 @@ var carsCmd = &cobra.Command{
 			return err
 		}
 
-		for _, r := range records {
+		for _, r := range summaries {
 			if r.ID == defaultID {
 				fmt.Printf("* %s (default)\n", r.ID)
 			} else {
@@ -44,6 +51,141 @@ var carsCmd = &cobra.Command{
 	},
 }
 
+var carsRenameCmd = &cobra.Command{
+	Use:   "rename <id> <new-id>",
+	Short: "Give a vehicle a new id, keeping its readings and photos",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		files, err := openAttachments()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		if err := runRename(cmd.Context(), st, files, tripLog, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Renamed %s to %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var carsMergeCmd = &cobra.Command{
+	Use:   "merge <from> <into>",
+	Short: "Fold one vehicle's readings into another and remove it",
+	Long: `Merge combines two records of the same car, e.g. one created on your phone
+and one on the CLI. <into> keeps its name, registration and plan (taking
+<from>'s only where it has none) and gains <from>'s readings; on a date both
+have, <into>'s reading is kept unless --overwrite is given. <from> is then
+removed, and the default vehicle follows if it was <from>.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		force, _ := cmd.Flags().GetBool("force")
+
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		files, err := openAttachments()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		report, err := runMerge(cmd.Context(), st, files, tripLog, args[0], args[1], overwrite, force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Merged %s into %s (added %d, skipped %d, overwrote %d)\n",
+			args[0], args[1], report.Added, report.Skipped, report.Overwritten)
+		return nil
+	},
+}
+
+// runRename renames a vehicle and re-files its attachments and trips under the
+// new id. If they cannot be moved, what was moved goes back and so does the
+// vehicle.
+func runRename(ctx context.Context, st storage.Store, files attachments.Store, tripLog trips.Store, from, to string) error {
+	if !storage.ValidID(to) {
+		return fmt.Errorf("invalid vehicle id %q", to)
+	}
+	if err := st.RenameVehicle(ctx, from, to); err != nil {
+		if errors.Is(err, storage.ErrExists) {
+			return fmt.Errorf("vehicle %q already exists; use `mileminder cars merge %s %s` to combine them", to, from, to)
+		}
+		return err
+	}
+	if err := carryVehicle(ctx, files, tripLog, from, to); err != nil {
+		if undoErr := carryVehicle(ctx, files, tripLog, to, from); undoErr != nil {
+			return fmt.Errorf("%w; moving them back also failed, so %s is left renamed to %s: %v", err, from, to, undoErr)
+		}
+		if undoErr := st.RenameVehicle(ctx, to, from); undoErr != nil {
+			return fmt.Errorf("%w; renaming %s back also failed: %v", err, to, undoErr)
+		}
+		return fmt.Errorf("rename undone: %w", err)
+	}
+	return nil
+}
+
+// carryVehicle re-files a vehicle's attachments and trips from one id to
+// another.
+func carryVehicle(ctx context.Context, files attachments.Store, tripLog trips.Store, from, to string) error {
+	if err := attachments.MoveVehicle(ctx, files, from, to); err != nil {
+		return fmt.Errorf("moving photos: %w", err)
+	}
+	if err := tripLog.MoveVehicle(ctx, from, to); err != nil {
+		return fmt.Errorf("moving trips: %w", err)
+	}
+	return nil
+}
+
+// runMerge merges from into into, enforcing the monotonic rule on the combined
+// readings unless forced, and re-files from's attachments and trips under into.
+// If they cannot be moved the two vehicles are put back as they were; what was
+// already moved stays on into, where merging again would put it anyway.
+func runMerge(ctx context.Context, st storage.Store, files attachments.Store, tripLog trips.Store, from, into string, overwrite, force bool) (readings.Report, error) {
+	if from == into {
+		return readings.Report{}, fmt.Errorf("cannot merge %q into itself", from)
+	}
+	snap, err := storage.SnapshotMerge(ctx, st, from, into, overwrite)
+	if err != nil {
+		return readings.Report{}, err
+	}
+	var validate func(*model.VehicleData) error
+	if !force {
+		validate = func(merged *model.VehicleData) error {
+			if err := readings.CheckMonotonic(merged.Readings, merged.OdometerChanges); err != nil {
+				return fmt.Errorf("%w; use --force to override", err)
+			}
+			return nil
+		}
+	}
+	report, err := st.MergeVehicle(ctx, from, into, overwrite, snap.Check(validate))
+	if err != nil {
+		return readings.Report{}, err
+	}
+	if err := carryVehicle(ctx, files, tripLog, from, into); err != nil {
+		if undoErr := snap.Undo(ctx, st); undoErr != nil {
+			return report, fmt.Errorf("vehicles merged, but %w; undoing the merge also failed: %v", err, undoErr)
+		}
+		return readings.Report{}, fmt.Errorf("merge undone: %w", err)
+	}
+	return report, nil
+}
+
 func init() {
 	rootCmd.AddCommand(carsCmd)
+	carsCmd.AddCommand(carsRenameCmd)
+	carsCmd.AddCommand(carsMergeCmd)
+	carsMergeCmd.Flags().Bool("overwrite", false, "On dates both vehicles have, keep <from>'s reading")
+	carsMergeCmd.Flags().Bool("force", false, "Allow the combined readings to decrease over time")
 }
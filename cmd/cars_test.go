@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+func TestRunRenameMovesVehicleAndPhotos(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+	files := attachments.NewMemory()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16)...)
+	if _, err := files.Put(ctx, attachments.Attachment{VehicleID: "golf", Date: "2025-01-01", ContentType: "image/png"}, png); err != nil {
+		t.Fatal(err)
+	}
+	tripLog := trips.NewMemory()
+	if _, err := tripLog.Save(ctx, trips.Trip{VehicleID: "golf", StartDate: "2025-01-01", Distance: 12}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runRename(ctx, st, files, tripLog, "golf", "../golf"); err == nil {
+		t.Fatal("want error for invalid id")
+	}
+	if err := runRename(ctx, st, files, tripLog, "golf", "gti"); err != nil {
+		t.Fatalf("runRename: %v", err)
+	}
+	if _, err := st.GetVehicle(ctx, "gti"); err != nil {
+		t.Fatalf("renamed vehicle: %v", err)
+	}
+	if list, _ := files.List(ctx, "gti", ""); len(list) != 1 {
+		t.Fatalf("photos did not follow the rename: %+v", list)
+	}
+	if list, _ := tripLog.List(ctx, "gti"); len(list) != 1 {
+		t.Fatalf("trips did not follow the rename: %+v", list)
+	}
+}
+
+func TestRunRenameOntoExistingSuggestsMerge(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+	if err := st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+	err := runRename(ctx, st, attachments.NewMemory(), trips.NewMemory(), "golf", "polo")
+	if err == nil || !strings.Contains(err.Error(), "cars merge") {
+		t.Fatalf("want a merge hint, got %v", err)
+	}
+}
+
+func TestRunMergeEnforcesMonotonicUnlessForced(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000, "2025-03-01": 6000})
+	if err := st.SaveVehicle(ctx, "phone", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-02-01": 6500}}); err != nil {
+		t.Fatal(err)
+	}
+	files := attachments.NewMemory()
+
+	if _, err := runMerge(ctx, st, files, trips.NewMemory(), "phone", "golf", false, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("want monotonic error, got %v", err)
+	}
+	if _, err := st.GetVehicle(ctx, "phone"); err != nil {
+		t.Fatalf("rejected merge must leave the source: %v", err)
+	}
+
+	report, err := runMerge(ctx, st, files, trips.NewMemory(), "phone", "golf", false, true)
+	if err != nil {
+		t.Fatalf("forced merge: %v", err)
+	}
+	if report.Added != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, err := st.GetVehicle(ctx, "phone"); err == nil {
+		t.Fatal("source survived the merge")
+	}
+}
+
+// stuckTrips is a trip store whose trips cannot be moved off vehicle stuck.
+type stuckTrips struct {
+	trips.Store
+	stuck string
+}
+
+func (s stuckTrips) MoveVehicle(ctx context.Context, fromID, toID string) error {
+	if fromID == s.stuck {
+		return errors.New("disk full")
+	}
+	return s.Store.MoveVehicle(ctx, fromID, toID)
+}
+
+func TestRunRenameUndoneWhenTripsCannotMove(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+	files := attachments.NewMemory()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16)...)
+	if _, err := files.Put(ctx, attachments.Attachment{VehicleID: "golf", Date: "2025-01-01", ContentType: "image/png"}, png); err != nil {
+		t.Fatal(err)
+	}
+
+	err := runRename(ctx, st, files, stuckTrips{trips.NewMemory(), "golf"}, "golf", "gti")
+	if err == nil || !strings.Contains(err.Error(), "rename undone") {
+		t.Fatalf("want the rename undone, got %v", err)
+	}
+	if _, err := st.GetVehicle(ctx, "golf"); err != nil {
+		t.Fatalf("vehicle not renamed back: %v", err)
+	}
+	if list, _ := files.List(ctx, "golf", ""); len(list) != 1 {
+		t.Fatalf("photos not moved back: %+v", list)
+	}
+}
+
+func TestRunMergeUndoneWhenTripsCannotMove(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+	if err := st.SaveVehicle(ctx, "phone", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-02-01": 5500}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrent(ctx, "phone"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runMerge(ctx, st, attachments.NewMemory(), stuckTrips{trips.NewMemory(), "phone"}, "phone", "golf", false, false)
+	if err == nil || !strings.Contains(err.Error(), "merge undone") {
+		t.Fatalf("want the merge undone, got %v", err)
+	}
+	if phone, err := st.GetVehicle(ctx, "phone"); err != nil || phone.Readings["2025-02-01"] != 5500 {
+		t.Fatalf("source not put back: %+v, %v", phone, err)
+	}
+	if golf, _ := st.GetVehicle(ctx, "golf"); len(golf.Readings) != 1 {
+		t.Fatalf("target not put back: %v", golf.Readings)
+	}
+	if current, _ := st.GetCurrent(ctx); current != "phone" {
+		t.Fatalf("current = %q", current)
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+var changesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "Print the events store's change feed as JSON lines",
+	Long: `With MILEMINDER_STORE=events (or serve --store events), every change is
+appended to an event log. changes prints the events logged after offset
+--after, one JSON object per line and oldest first, for a downstream consumer
+to follow: pass the offset of the last event it handled to pick up from
+there. --follow keeps printing new events as they are logged.
+
+--hosted reads the log of the account --user in a hosted data root.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var st *eventstore.Store
+		if hostedMode(cmd) {
+			dataDir, err := hostedDataDir(cmd)
+			if err != nil {
+				return err
+			}
+			user, _ := cmd.Flags().GetString("user")
+			if user == "" {
+				return fmt.Errorf("--hosted needs --user")
+			}
+			key, err := dirKey(dataDir)
+			if err != nil {
+				return err
+			}
+			st = eventstore.NewEncryptedTenants(dataDir, key).User(user)
+		} else {
+			dir, err := yamlstore.DefaultDir()
+			if err != nil {
+				return err
+			}
+			key, err := dirKey(dir)
+			if err != nil {
+				return err
+			}
+			st = eventstore.NewEncrypted(dir, key)
+		}
+		after, _ := cmd.Flags().GetInt64("after")
+		limit, _ := cmd.Flags().GetInt("limit")
+		follow, _ := cmd.Flags().GetBool("follow")
+		return runChanges(cmd.Context(), st, after, limit, follow, os.Stdout)
+	},
+}
+
+// changesPoll is how often --follow looks for new events.
+const changesPoll = time.Second
+
+// runChanges prints up to limit events after offset after (all when limit is
+// 0); with follow it then polls for more until ctx is done.
+func runChanges(ctx context.Context, st *eventstore.Store, after int64, limit int, follow bool, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for {
+		events, err := st.Changes(ctx, after, limit)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			after = e.Offset
+		}
+		if !follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(changesPoll):
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(changesCmd)
+	changesCmd.Flags().Int64("after", 0, "Print events after this offset (0 for all)")
+	changesCmd.Flags().IntP("limit", "n", 0, "Print at most this many events (0 for all)")
+	changesCmd.Flags().BoolP("follow", "f", false, "Keep printing events as they are logged")
+	changesCmd.Flags().Bool("hosted", false, "Read a hosted account's log (env: MILEMINDER_HOSTED)")
+	changesCmd.Flags().String("data-dir", "", "Hosted data root (default ~/.mileminder-hosted; env: MILEMINDER_DATA_DIR)")
+	changesCmd.Flags().String("user", "", "Hosted account id whose log to read")
+}
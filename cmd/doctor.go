@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/doctor"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the data directory for problems and repair them",
+	Long: `doctor looks for what the stores tolerate or hide: vehicle, settings and
+trash files that no longer parse (a vehicle whose file is corrupt simply
+disappears from the fleet), temp files left by an interrupted write, a
+default vehicle that does not exist, readings not dated YYYY-MM-DD, an
+odometer that goes backwards, and plans that end before they start.
+
+Each problem is listed with the repair doctor would make, if any. --fix makes
+the safe ones, which only move data aside: an unreadable file into
+quarantine/, a misdated reading into the trash, and an orphaned temp file is
+removed. --interactive asks about every repair, including those that pick
+between your readings or change the default vehicle. Repairs to readings and
+the default vehicle are journalled as "doctor", so 'mileminder undo' reverses
+them.
+
+--hosted checks every account in a hosted data root (--data-dir), or just
+--user. doctor exits non-zero while problems remain.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := journal.WithActor(cmd.Context(), "doctor")
+		backend, err := storeBackend()
+		if err != nil {
+			return err
+		}
+		var root string
+		var targets []doctorTarget
+		if hostedMode(cmd) {
+			if root, err = hostedDataDir(cmd); err != nil {
+				return err
+			}
+			user, _ := cmd.Flags().GetString("user")
+			if targets, err = hostedDoctorTargets(ctx, backend, root, user); err != nil {
+				return err
+			}
+		} else {
+			var files *yamlstore.Store
+			st, err := openObservedJournal(backend, "doctor", nil, func(st storage.Store) storage.Store {
+				files, _ = st.(*yamlstore.Store)
+				return st
+			})
+			if err != nil {
+				return err
+			}
+			if root, err = yamlstore.DefaultDir(); err != nil {
+				return err
+			}
+			targets = []doctorTarget{{st: st, files: files}}
+		}
+
+		fix, _ := cmd.Flags().GetBool("fix")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		remaining, err := runDoctor(ctx, root, targets, fix, interactive, time.Now(), os.Stdin, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return fmt.Errorf("%d problem(s) remain", remaining)
+		}
+		return nil
+	},
+}
+
+// doctorTarget is one store to examine: files is its YAML store, when it has
+// one, for the checks on the files themselves.
+type doctorTarget struct {
+	user  string // "" outside hosted mode
+	st    storage.Store
+	files *yamlstore.Store
+}
+
+// hostedDoctorTargets returns every account's store under a hosted data root,
+// or only user's when it is set.
+func hostedDoctorTargets(ctx context.Context, backend, root, user string) ([]doctorTarget, error) {
+	vehicles, err := openTenants(backend, root)
+	if err != nil {
+		return nil, err
+	}
+	key, err := dirKey(root)
+	if err != nil {
+		return nil, err
+	}
+	tenants := journal.NewTenants(vehicles, root)
+	tenants.Key = key
+
+	ids := []string{user}
+	if user == "" {
+		users, err := filestore.NewEncryptedUserStore(root, key).ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ids = ids[:0]
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+	}
+	targets := make([]doctorTarget, 0, len(ids))
+	for _, id := range ids {
+		files, _ := vehicles.ForUser(id).(*yamlstore.Store)
+		targets = append(targets, doctorTarget{user: id, st: tenants.ForUser(id), files: files})
+	}
+	return targets, nil
+}
+
+// runDoctor reports the problems under root and in each target, making the
+// safe repairs if fix is set and asking on in about every repair if
+// interactive is. It returns how many problems remain.
+func runDoctor(ctx context.Context, root string, targets []doctorTarget, fix, interactive bool, now time.Time, in io.Reader, w io.Writer) (int, error) {
+	type found struct {
+		user string
+		doctor.Problem
+	}
+	var problems []found
+	temps, err := doctor.TempFiles(root, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range temps {
+		problems = append(problems, found{Problem: p})
+	}
+	for _, t := range targets {
+		more, err := doctor.Examine(ctx, t.st, t.files)
+		if err != nil {
+			if t.user != "" {
+				return 0, fmt.Errorf("user %s: %w", t.user, err)
+			}
+			return 0, err
+		}
+		for _, p := range more {
+			problems = append(problems, found{user: t.user, Problem: p})
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "No problems found.")
+		return 0, nil
+	}
+
+	reader := bufio.NewReader(in)
+	fixed := 0
+	for _, p := range problems {
+		if p.user != "" {
+			fmt.Fprintf(w, "user %s: ", p.user)
+		}
+		fmt.Fprintf(w, "%s [%s]\n", p.Problem, p.Kind)
+		if p.Fix == "" {
+			continue
+		}
+		apply := fix && p.Safe
+		switch {
+		case interactive:
+			fmt.Fprintf(w, "  %s? (y/N): ", capitalize(p.Fix))
+			resp, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			apply = strings.ToLower(strings.TrimSpace(resp)) == "y"
+		case !apply && p.Safe:
+			fmt.Fprintf(w, "  --fix would %s\n", p.Fix)
+		case !apply:
+			fmt.Fprintf(w, "  --interactive offers to %s\n", p.Fix)
+		}
+		if !apply {
+			continue
+		}
+		if err := p.Repair(ctx); err != nil {
+			fmt.Fprintf(w, "  repair failed: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "  fixed: %s\n", p.Fix)
+		fixed++
+	}
+
+	remaining := len(problems) - fixed
+	fmt.Fprintf(w, "%d problem(s) found, %d fixed.\n", len(problems), fixed)
+	return remaining, nil
+}
+
+// capitalize upper-cases s's first letter, to ask a fix as a question.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().Bool("fix", false, "Make the safe repairs")
+	doctorCmd.Flags().BoolP("interactive", "i", false, "Ask about every repair")
+	doctorCmd.Flags().Bool("hosted", false, "Check a hosted data root instead of ~/.mileminder (env: MILEMINDER_HOSTED)")
+	doctorCmd.Flags().String("data-dir", "", "Hosted data root (default ~/.mileminder-hosted; env: MILEMINDER_DATA_DIR)")
+	doctorCmd.Flags().String("user", "", "With --hosted, check only this account")
+}
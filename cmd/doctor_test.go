@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --fix makes only the safe repairs; --interactive asks about the rest.
+func TestRunDoctor(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000, "2025-02-01": 9100, "2025-03-01": 5600, "2025-04-01": 5900, "2025-13-01": 6000})
+	targets := []doctorTarget{{st: st}}
+	root := t.TempDir()
+
+	var out bytes.Buffer
+	remaining, err := runDoctor(ctx, root, targets, false, false, time.Now(), strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 2 || !strings.Contains(out.String(), "--fix would move the reading to the trash") {
+		t.Fatalf("check only: %d remain\n%s", remaining, out.String())
+	}
+
+	out.Reset()
+	remaining, err = runDoctor(ctx, root, targets, true, false, time.Now(), strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 || !strings.Contains(out.String(), "--interactive offers to move the 2025-02-01 reading") {
+		t.Fatalf("--fix: %d remain\n%s", remaining, out.String())
+	}
+
+	out.Reset()
+	remaining, err = runDoctor(ctx, root, targets, false, true, time.Now(), strings.NewReader("y\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Fatalf("--interactive: %d remain\n%s", remaining, out.String())
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if _, ok := data.Readings["2025-02-01"]; ok || len(data.Readings) != 3 {
+		t.Fatalf("readings after repair = %v", data.Readings)
+	}
+
+	out.Reset()
+	if remaining, err := runDoctor(ctx, root, targets, false, false, time.Now(), strings.NewReader(""), &out); err != nil || remaining != 0 {
+		t.Fatalf("after repair: %d remain, %v", remaining, err)
+	}
+	if !strings.Contains(out.String(), "No problems found.") {
+		t.Fatalf("output: %s", out.String())
+	}
+}
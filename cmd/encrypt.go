@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/calendar"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// Where the encryption key comes from, besides a terminal prompt.
+const (
+	envPassphrase    = "MILEMINDER_PASSPHRASE"
+	envNewPassphrase = "MILEMINDER_NEW_PASSPHRASE" // the key encrypt --rotate moves to
+	envKeyFile       = "MILEMINDER_KEY_FILE"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the data directory at rest",
+	Long: `Encrypt the data in ~/.mileminder with AES-256-GCM, in place: every vehicle
+file, the settings, the current vehicle, the trash, the journal, the trips, the
+photos and their index, the calendar and ingest tokens and the connected-car
+links. With the sqlite store, its vehicle, reading, settings and trash values
+are sealed in mileminder.db; the ids and dates that key its rows stay plain,
+as a vehicle file's name does. With the events store, every logged event is
+sealed and the snapshot is rebuilt. Each file is replaced atomically; if the
+command stops part-way, rerun it to finish.
+
+The key is derived from a passphrase, read from MILEMINDER_PASSPHRASE or asked
+for. Every later command asks for it too, unless the variable is set. With
+--key-file the key is instead a random one kept in that file, created if it
+does not exist; commands then read it from MILEMINDER_KEY_FILE. A hosted
+server has no one to type a passphrase, so a key file suits --hosted, which
+encrypts the hosted data root (--data-dir): the accounts, sessions, password
+resets and alert state, and every user's directory, as above.
+
+--rotate re-encrypts already encrypted data with a new key: a new passphrase
+(MILEMINDER_NEW_PASSPHRASE or asked for) or, with --key-file, a new key file.
+
+Without the passphrase or key file the data cannot be read, by anyone. Keep a
+copy somewhere safe. Stop the server first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, dirs, err := encryptionDirs(cmd)
+		if err != nil {
+			return err
+		}
+		keyFile, _ := cmd.Flags().GetString("key-file")
+		if rotate, _ := cmd.Flags().GetBool("rotate"); rotate {
+			return rotateKey(root, dirs, keyFile)
+		}
+		cfg, err := crypt.ReadConfig(root)
+		if err != nil {
+			return err
+		}
+		var key *crypt.Key
+		switch {
+		case cfg == nil:
+			if cfg, key, err = newKeyConfig(keyFile, envPassphrase, "Passphrase"); err != nil {
+				return err
+			}
+		case cfg.Pending == "":
+			return fmt.Errorf("%s is already encrypted; use --rotate to change the key", root)
+		case cfg.Pending == crypt.PendingRotate:
+			return errPending(root, cfg)
+		default:
+			// Finishing an interrupted encrypt, or reversing an interrupted
+			// decrypt: either way the directory's key is the one to use.
+			if key, err = unlockKey(cfg, envPassphrase, keyFileOrEnv(keyFile)); err != nil {
+				return err
+			}
+		}
+		cfg.Pending = crypt.PendingEncrypt
+		if err := crypt.WriteConfig(root, cfg); err != nil {
+			return err
+		}
+		n, err := convertDirs(root, dirs, key, key)
+		if err != nil {
+			return fmt.Errorf("%w (rerun to finish)", err)
+		}
+		cfg.Pending = ""
+		if err := crypt.WriteConfig(root, cfg); err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted %d file(s) in %s\n", n, root)
+		return nil
+	},
+}
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt an encrypted data directory",
+	Long: `Decrypt what 'mileminder encrypt' encrypted, in place, back to plain files.
+It needs the passphrase (MILEMINDER_PASSPHRASE or asked for) or the key file
+(--key-file or MILEMINDER_KEY_FILE). If it stops part-way, rerun it to finish.
+--hosted decrypts a hosted data root (--data-dir). Stop the server first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, dirs, err := encryptionDirs(cmd)
+		if err != nil {
+			return err
+		}
+		cfg, err := crypt.ReadConfig(root)
+		if err != nil {
+			return err
+		}
+		if cfg == nil {
+			return fmt.Errorf("%s is not encrypted", root)
+		}
+		if cfg.Pending == crypt.PendingRotate {
+			return errPending(root, cfg)
+		}
+		keyFile, _ := cmd.Flags().GetString("key-file")
+		key, err := unlockKey(cfg, envPassphrase, keyFileOrEnv(keyFile))
+		if err != nil {
+			return err
+		}
+		cfg.Pending = crypt.PendingDecrypt
+		if err := crypt.WriteConfig(root, cfg); err != nil {
+			return err
+		}
+		n, err := convertDirs(root, dirs, key, nil)
+		if err != nil {
+			return fmt.Errorf("%w (rerun to finish)", err)
+		}
+		if err := crypt.RemoveConfig(root); err != nil {
+			return err
+		}
+		fmt.Printf("Decrypted %d file(s) in %s\n", n, root)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(encryptCmd, decryptCmd)
+	for _, c := range []*cobra.Command{encryptCmd, decryptCmd} {
+		c.Flags().String("key-file", "", "Key file to use instead of a passphrase (env: "+envKeyFile+")")
+		c.Flags().Bool("hosted", false, "Convert a hosted data root instead of ~/.mileminder (env: MILEMINDER_HOSTED)")
+		c.Flags().String("data-dir", "", "Hosted data root (default ~/.mileminder-hosted; env: MILEMINDER_DATA_DIR)")
+	}
+	encryptCmd.Flags().Bool("rotate", false, "Re-encrypt encrypted data with a new passphrase or --key-file")
+}
+
+// rotateKey re-encrypts root's directories from its current key to a new
+// one. The new key's config is recorded as Next before any file changes, so
+// an interrupted rotation resumes with the same new key.
+func rotateKey(root string, dirs []string, keyFile string) error {
+	cfg, err := crypt.ReadConfig(root)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("%s is not encrypted; run 'mileminder encrypt' first", root)
+	}
+	if cfg.Pending != "" && cfg.Pending != crypt.PendingRotate {
+		return errPending(root, cfg)
+	}
+	// With a key file, the old one comes from the environment and the new
+	// one from --key-file.
+	old, err := unlockKey(cfg, envPassphrase, os.Getenv(envKeyFile))
+	if err != nil {
+		return err
+	}
+	var next *crypt.Config
+	var key *crypt.Key
+	if cfg.Pending == crypt.PendingRotate {
+		next = cfg.Next
+		if key, err = unlockKey(next, envNewPassphrase, keyFile); err != nil {
+			return err
+		}
+	} else {
+		if next, key, err = newKeyConfig(keyFile, envNewPassphrase, "New passphrase"); err != nil {
+			return err
+		}
+		if key.ID() == old.ID() {
+			return errors.New("the new key is the current one")
+		}
+		cfg.Pending, cfg.Next = crypt.PendingRotate, next
+		if err := crypt.WriteConfig(root, cfg); err != nil {
+			return err
+		}
+	}
+	n, err := convertDirs(root, dirs, old, key)
+	if err != nil {
+		return fmt.Errorf("%w (rerun to finish)", err)
+	}
+	if err := crypt.WriteConfig(root, next); err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d file(s) in %s with the new key\n", n, root)
+	return nil
+}
+
+// encryptionDirs returns the directory holding the encryption config — the
+// CLI's, or with --hosted the hosted data root — and the store directories
+// under it to convert.
+func encryptionDirs(cmd *cobra.Command) (string, []string, error) {
+	if !hostedMode(cmd) {
+		dir, err := yamlstore.DefaultDir()
+		if err != nil {
+			return "", nil, err
+		}
+		return dir, []string{dir}, nil
+	}
+	root, err := hostedDataDir(cmd)
+	if err != nil {
+		return "", nil, err
+	}
+	users, err := os.ReadDir(filepath.Join(root, "users"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, fmt.Errorf("read users dir: %w", err)
+	}
+	var dirs []string
+	for _, u := range users {
+		if u.IsDir() {
+			dirs = append(dirs, filepath.Join(root, "users", u.Name()))
+		}
+	}
+	return root, dirs, nil
+}
+
+// converter is a store kept in one file that can re-seal it.
+type converter interface {
+	Convert(from, to *crypt.Key) (bool, error)
+}
+
+// convertDirs re-seals everything under root from one key to another — the
+// token, link, account and alert files and the SQLite database at its top,
+// then each store directory's vehicle files, journal, event log, trips and
+// photos — returning how many files changed. Files that do not exist, as the
+// accounts do not in a single-user directory, are skipped.
+func convertDirs(root string, dirs []string, from, to *crypt.Key) (int, error) {
+	total := 0
+	count := func(changed bool, err error) error {
+		if changed {
+			total++
+		}
+		return err
+	}
+	files := []converter{
+		calendar.NewFileTokenStore(root),
+		ingest.NewFileTokenStore(root),
+		connected.NewFileLinkStore(root),
+		filestore.NewUserStore(root),
+		filestore.NewSessionStore(root),
+		filestore.NewPasswordResetStore(root),
+		alerts.NewFilePrefsStore(root),
+		alerts.NewFileStateStore(root),
+		alerts.NewFileReminderSettingsStore(root),
+		alerts.NewFileReminderStateStore(root),
+	}
+	for _, f := range files {
+		if err := count(f.Convert(from, to)); err != nil {
+			return total, err
+		}
+	}
+	if err := count(sqlstore.Convert(filepath.Join(root, sqlstore.FileName), from, to)); err != nil {
+		return total, err
+	}
+	for _, dir := range dirs {
+		n, err := yamlstore.Convert(dir, from, to)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if err := count(journal.ConvertFileLog(dir, from, to)); err != nil {
+			return total, err
+		}
+		if err := count(eventstore.Convert(dir, from, to)); err != nil {
+			return total, err
+		}
+		if err := count(trips.Convert(dir, from, to)); err != nil {
+			return total, err
+		}
+		n, err = attachments.Convert(dir, from, to)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// dirKeys caches each directory's key for the life of the process, so a
+// command opening the store and the journal asks for the passphrase once.
+var dirKeys = map[string]*crypt.Key{}
+
+// dirKey returns the key dir is encrypted with, or nil if it is not
+// encrypted. A directory part-way through a conversion is refused: it holds
+// a mix of files no single key reads.
+func dirKey(dir string) (*crypt.Key, error) {
+	if key, ok := dirKeys[dir]; ok {
+		return key, nil
+	}
+	cfg, err := crypt.ReadConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	var key *crypt.Key
+	if cfg != nil {
+		if cfg.Pending != "" {
+			return nil, errPending(dir, cfg)
+		}
+		if key, err = unlockKey(cfg, envPassphrase, os.Getenv(envKeyFile)); err != nil {
+			return nil, err
+		}
+	}
+	dirKeys[dir] = key
+	return key, nil
+}
+
+// errPending is the error for a directory left part-way through a
+// conversion, naming the command that finishes it.
+func errPending(dir string, cfg *crypt.Config) error {
+	command := "mileminder " + cfg.Pending
+	if cfg.Pending == crypt.PendingRotate {
+		command = "mileminder encrypt --rotate"
+	}
+	return fmt.Errorf("%s was left part-way through '%s'; rerun it to finish", dir, command)
+}
+
+// unlockKey obtains cfg's key: from the key file at keyFile, or from the
+// passphrase in passEnv or typed at the terminal.
+func unlockKey(cfg *crypt.Config, passEnv, keyFile string) (*crypt.Key, error) {
+	if cfg.Source == crypt.SourceKeyFile {
+		if keyFile == "" {
+			return nil, fmt.Errorf("the data is encrypted with a key file: set %s", envKeyFile)
+		}
+		return cfg.FileKey(keyFile)
+	}
+	passphrase, err := readPassphrase(passEnv, "Passphrase", false)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.PassphraseKey(passphrase)
+}
+
+// newKeyConfig makes a new key: the one in keyFile, generating the file if
+// it does not exist, or else one derived from a new passphrase.
+func newKeyConfig(keyFile, passEnv, prompt string) (*crypt.Config, *crypt.Key, error) {
+	if keyFile == "" {
+		passphrase, err := readPassphrase(passEnv, prompt, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		return crypt.NewPassphraseConfig(passphrase)
+	}
+	key, err := crypt.ReadKeyFile(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if key, err = crypt.GenerateKeyFile(keyFile); err == nil {
+			fmt.Printf("Wrote a new key to %s. Keep a copy: without it the data cannot be read.\n", keyFile)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return crypt.NewKeyFileConfig(key), key, nil
+}
+
+// keyFileOrEnv is the --key-file flag, else MILEMINDER_KEY_FILE.
+func keyFileOrEnv(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	return os.Getenv(envKeyFile)
+}
+
+// readPassphrase returns the passphrase in env, or asks for it on the
+// terminal without echoing it — twice when confirm is set, for a new one.
+func readPassphrase(env, prompt string, confirm bool) ([]byte, error) {
+	if p := os.Getenv(env); p != "" {
+		return []byte(p), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("a passphrase is needed: set %s", env)
+	}
+	ask := func(prompt string) ([]byte, error) {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+		p, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase: %w", err)
+		}
+		return p, nil
+	}
+	p, err := ask(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	if confirm {
+		again, err := ask("Repeat " + strings.ToLower(prompt))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(p, again) {
+			return nil, errors.New("the passphrases do not match")
+		}
+	}
+	return p, nil
+}
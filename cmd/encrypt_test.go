@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/calendar"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+func TestEncryptedDirOpens(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := journal.Wrap(yamlstore.New(dir), journal.NewFileLog(dir), "cli")
+	if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, key, err := crypt.NewPassphraseConfig([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crypt.WriteConfig(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := convertDirs(dir, []string{dir}, nil, key); err != nil || n != 2 {
+		t.Fatalf("convertDirs = %d, %v; want golf.yml and the journal", n, err)
+	}
+
+	t.Setenv(envPassphrase, "wrong")
+	if _, err := openVehicles(storeYAML, dir); !errors.Is(err, crypt.ErrWrongKey) {
+		t.Fatalf("wrong passphrase: err = %v", err)
+	}
+	t.Setenv(envPassphrase, "secret")
+	opened, err := openVehicles(storeYAML, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := opened.GetVehicle(ctx, "golf"); err != nil || data.Vehicle != "Golf" {
+		t.Fatalf("GetVehicle = %+v, %v", data, err)
+	}
+
+	// A conversion left part-way is refused until it is finished.
+	pendingDir := t.TempDir()
+	cfg.Pending = crypt.PendingDecrypt
+	if err := crypt.WriteConfig(pendingDir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openVehicles(storeYAML, pendingDir); err == nil || !strings.Contains(err.Error(), "'mileminder decrypt'") {
+		t.Fatalf("pending decrypt: err = %v", err)
+	}
+}
+
+// TestConvertDirsSealsEverything fills a data directory with every kind of
+// file it can hold and checks that encrypting it leaves none in the clear,
+// that each store reads its data back with the key, and that decrypting
+// restores the plain files.
+func TestConvertDirsSealsEverything(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	const secret = "Golf"
+	data := &model.VehicleData{Vehicle: secret}
+	if err := journal.Wrap(yamlstore.New(dir), journal.NewFileLog(dir), "cli").SaveVehicle(ctx, "golf", data); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlstore.Open(filepath.Join(dir, sqlstore.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Local().SaveVehicle(ctx, "golf", data); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := eventstore.New(dir).SaveVehicle(ctx, "golf", data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trips.NewFileStore(dir).Save(ctx, trips.Trip{VehicleID: "golf", StartDate: "2026-01-02", EndDate: "2026-01-02", Distance: 12, Purpose: trips.Personal, Notes: secret}); err != nil {
+		t.Fatal(err)
+	}
+	photo := []byte("\x89PNG\r\n\x1a\n" + secret)
+	if _, err := attachments.NewFileStore(dir).Put(ctx, attachments.Attachment{VehicleID: "golf", Date: "2026-01-02", ContentType: "image/png", Filename: secret + ".png"}, photo); err != nil {
+		t.Fatal(err)
+	}
+	if err := calendar.NewFileTokenStore(dir).Put(ctx, tokenstore.Token{Owner: storage.LocalOwner, TokenHash: secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ingest.NewFileTokenStore(dir).Put(ctx, tokenstore.Token{Owner: storage.LocalOwner, VehicleID: "golf", TokenHash: secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := connected.NewFileLinkStore(dir).Put(ctx, connected.Link{Owner: storage.LocalOwner, VehicleID: "golf", Provider: "fake", Token: secret}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, key, err := crypt.NewPassphraseConfig([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crypt.WriteConfig(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// The vehicle file, journal, database, event log, trips, photo index and
+	// photo, two token files and the links.
+	if n, err := convertDirs(dir, []string{dir}, nil, key); err != nil || n != 10 {
+		t.Fatalf("convertDirs = %d, %v; want 10", n, err)
+	}
+	if n, err := convertDirs(dir, []string{dir}, key, key); err != nil || n != 0 {
+		t.Fatalf("rerun = %d, %v; want nothing left to convert", n, err)
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Errorf("%s is still in the clear", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envPassphrase, "secret")
+	for _, backend := range []string{storeYAML, storeSQLite, storeEvents} {
+		st, err := openVehicles(backend, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := st.GetVehicle(ctx, "golf"); err != nil || got.Vehicle != secret {
+			t.Errorf("%s: GetVehicle = %+v, %v", backend, got, err)
+		}
+	}
+	if list, err := trips.NewEncryptedFileStore(dir, key).List(ctx, "golf"); err != nil || len(list) != 1 || list[0].Notes != secret {
+		t.Errorf("trips = %+v, %v", list, err)
+	}
+	list, err := attachments.NewEncryptedFileStore(dir, key).List(ctx, "golf", "2026-01-02")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("attachments = %+v, %v", list, err)
+	}
+	if _, content, err := attachments.NewEncryptedFileStore(dir, key).Get(ctx, "golf", "2026-01-02", list[0].Hash); err != nil || !bytes.Equal(content, photo) {
+		t.Errorf("photo = %q, %v", content, err)
+	}
+	if l, err := connected.NewEncryptedFileLinkStore(dir, key).Get(ctx, storage.LocalOwner, "golf"); err != nil || l.Token != secret {
+		t.Errorf("link = %+v, %v", l, err)
+	}
+	if _, err := calendar.NewFileTokenStore(dir).Resolve(ctx, secret); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain calendar tokens: err = %v", err)
+	}
+
+	if n, err := convertDirs(dir, []string{dir}, key, nil); err != nil || n != 10 {
+		t.Fatalf("decrypt = %d, %v; want 10", n, err)
+	}
+	if tok, err := calendar.NewFileTokenStore(dir).Resolve(ctx, secret); err != nil || tok.Owner != storage.LocalOwner {
+		t.Errorf("decrypted calendar token = %+v, %v", tok, err)
+	}
+	if tok, err := ingest.NewFileTokenStore(dir).Resolve(ctx, secret); err != nil || tok.VehicleID != "golf" {
+		t.Errorf("decrypted ingest token = %+v, %v", tok, err)
+	}
+	db, err = sqlstore.Open(filepath.Join(dir, sqlstore.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := db.Local().GetVehicle(ctx, "golf"); err != nil || got.Vehicle != secret {
+		t.Errorf("decrypted sqlite: GetVehicle = %+v, %v", got, err)
+	}
+	if got, err := eventstore.New(dir).GetVehicle(ctx, "golf"); err != nil || got.Vehicle != secret {
+		t.Errorf("decrypted events: GetVehicle = %+v, %v", got, err)
+	}
+}
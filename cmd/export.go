@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/archive"
+	"github.com/jackiabishop/mileminder/internal/report"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a vehicle as a full archive or a spreadsheet",
+	Long: `Export one vehicle — name, registration, plan and every reading — as a
+versioned JSON archive. Load it into another install or a hosted account with
+"mileminder import --archive" or the web import.
+
+With --format xlsx, write an Excel workbook instead: a readings sheet, a monthly
+summary and a status sheet, for one vehicle or, with --fleet, every vehicle.
+
+Writes to stdout unless --output is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		fleet, _ := cmd.Flags().GetBool("fleet")
+		switch format {
+		case "json":
+			if fleet {
+				return fmt.Errorf("--fleet needs --format xlsx; archives hold one vehicle each")
+			}
+		case "xlsx":
+		default:
+			return fmt.Errorf("unknown format %q (want json or xlsx)", format)
+		}
+
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		var (
+			what  string
+			write func(io.Writer) error
+		)
+		if fleet {
+			what = "fleet"
+			write = func(w io.Writer) error { return writeFleetWorkbook(ctx, st, w) }
+		} else {
+			carFlag, _ := cmd.Flags().GetString("car")
+			carID, err := defaultVehicleID(ctx, st, carFlag)
+			if err != nil {
+				return err
+			}
+			what = carID
+			write = func(w io.Writer) error {
+				if format == "xlsx" {
+					return writeVehicleWorkbook(ctx, st, carID, w)
+				}
+				return writeArchive(ctx, st, carID, w)
+			}
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			return write(os.Stdout)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("create export: %w", err)
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("write export: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %s to %s\n", what, output)
+		return nil
+	},
+}
+
+// writeArchive encodes the archive for carID to w.
+func writeArchive(ctx context.Context, st storage.Store, carID string, w io.Writer) error {
+	data, err := st.GetVehicle(ctx, carID)
+	if err != nil {
+		return err
+	}
+	if err := archive.Encode(w, archive.New(carID, data, time.Now())); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	return nil
+}
+
+// writeVehicleWorkbook writes the spreadsheet export for carID to w.
+func writeVehicleWorkbook(ctx context.Context, st storage.Store, carID string, w io.Writer) error {
+	data, err := st.GetVehicle(ctx, carID)
+	if err != nil {
+		return err
+	}
+	if err := report.Workbook([]report.Vehicle{{ID: carID, Data: data}}, time.Now()).Write(w); err != nil {
+		return fmt.Errorf("write workbook: %w", err)
+	}
+	return nil
+}
+
+// writeFleetWorkbook writes the spreadsheet export for every vehicle to w.
+func writeFleetWorkbook(ctx context.Context, st storage.Store, w io.Writer) error {
+	records, err := st.ListVehicles(ctx)
+	if err != nil {
+		return err
+	}
+	vehicles := make([]report.Vehicle, 0, len(records))
+	for _, rec := range records {
+		vehicles = append(vehicles, report.Vehicle{ID: rec.ID, Data: rec.Data})
+	}
+	if err := report.Workbook(vehicles, time.Now()).Write(w); err != nil {
+		return fmt.Errorf("write workbook: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringP("car", "c", "", "Vehicle ID (defaults to the current vehicle)")
+	exportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+	exportCmd.Flags().String("format", "json", "Export format: json (vehicle archive) or xlsx (spreadsheet)")
+	exportCmd.Flags().Bool("fleet", false, "With --format xlsx, export every vehicle")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/readings"
 )
 
 var graphCmd = &cobra.Command{
@@ -33,9 +34,11 @@ var graphCmd = &cobra.Command{
 			return err
 		}
 
-		// Sort dates and build series
-		dates := make([]string, 0, len(v.Readings))
-		for d := range v.Readings {
+		// Sort dates and build series, on one scale across any odometer
+		// change
+		odometer := readings.Continuous(v.Readings, v.OdometerChanges)
+		dates := make([]string, 0, len(odometer))
+		for d := range odometer {
 			dates = append(dates, d)
 		}
 		sort.Strings(dates)
@@ -45,14 +48,14 @@ var graphCmd = &cobra.Command{
 		// Use relative usage (miles driven since plan start)
 		baseMiles := 0.0
 		if v.Plan != nil {
-			baseMiles = float64(v.Plan.StartMiles)
+			baseMiles = float64(calc.StartMiles(v))
 		} else if len(dates) > 0 {
-			baseMiles = float64(v.Readings[dates[0]])
+			baseMiles = float64(odometer[dates[0]])
 		}
 
 		for _, ds := range dates {
 			t, _ := time.Parse("2006-01-02", ds)
-			miles := float64(v.Readings[ds]) - baseMiles
+			miles := float64(odometer[ds]) - baseMiles
 			actuals = append(actuals, miles)
 			if v.Plan != nil {
 				ideals = append(ideals, calc.AllowanceMiles(v.Plan.AnnualAllowance, v.Plan.Start, t))
@@ -2,20 +2,27 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/jackiabishop/mileminder/internal/archive"
+	"github.com/jackiabishop/mileminder/internal/gpx"
+	"github.com/jackiabishop/mileminder/internal/model"
 	"github.com/jackiabishop/mileminder/internal/readings"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
 var importCmd = &cobra.Command{
-	Use:   "import <file.csv>",
-	Short: "Bulk-import odometer readings from a CSV file",
+	Use:   "import <file>",
+	Short: "Bulk-import odometer readings from a CSV file, a vehicle archive or a GPX track log",
 	Long: `Bulk-import historical odometer readings from a CSV file in the export
 format (header "date,miles", then YYYY-MM-DD,<miles> rows), so export -> import
 round-trips cleanly.
@@ -23,15 +30,64 @@ round-trips cleanly.
 The import is all-or-nothing: any invalid row rejects the whole file with every
 error reported. Dates that already have a reading are skipped unless
 --overwrite is set. The combined readings must never decrease in date order
-unless --force is set.`,
+unless --force is set.
+
+Exports from other mileage and fuel-log apps are read through a column mapping:
+either a built-in --preset, or --date-column and --distance-column naming the
+header cells, with --date-format (iso, dmy or mdy) and --unit (mi or km). A
+comma in a distance only groups thousands ("12,345.6") unless --decimal-comma
+says it is the decimal point ("12.345,6"). Flags given alongside --preset
+override its fields. Readings keep only a date and an odometer value, so other
+columns, such as notes or fuel volume, are not imported and are listed as such;
+several rows on one day keep the highest odometer.
+
+  mileminder import --car golf --preset drivvo drivvo.csv
+  mileminder import --car golf --date-column "Date" --distance-column "Km" \
+      --date-format dmy --unit km log.csv
+
+With --archive the file is a vehicle archive from "mileminder export" and the
+whole vehicle is created under its own id (or --car). If that id is taken,
+--on-conflict decides: fail (default), rename to the first free "<id>-N", or
+merge the readings into the existing vehicle under the rules above.
+
+With --obd the file is an OBD-II (ELM327) logger's CSV, such as Torque Pro,
+OBD Fusion or Car Scanner write. Its odometer values — or, for the many cars
+that do not report one, its distance since trouble codes were cleared, counted
+on from the last reading before the log — become one reading per day, under
+the same rules as a CSV.
+
+With --gpx the file is a GPS track log. Its tracks are measured and grouped by
+day (in --tz, default local time); each day becomes a trip and a proposed
+reading: the last known odometer plus the distance tracked since. Days that
+already have a reading keep it. --dry-run shows the proposal without saving.
+
+  mileminder import --car golf --gpx --dry-run drives.gpx`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if isArchive, _ := cmd.Flags().GetBool("archive"); isArchive {
+			return runArchiveImportCmd(cmd, args[0])
+		}
+		if isGPX, _ := cmd.Flags().GetBool("gpx"); isGPX {
+			return runGPXImportCmd(cmd, args[0])
+		}
+		isOBD, _ := cmd.Flags().GetBool("obd")
 		carID, _ := cmd.Flags().GetString("car")
 		if carID == "" {
 			return fmt.Errorf("please provide a vehicle ID with --car")
 		}
 		overwrite, _ := cmd.Flags().GetBool("overwrite")
 		force, _ := cmd.Flags().GetBool("force")
+		preset, _ := cmd.Flags().GetString("preset")
+		var override readings.Mapping
+		override.DateColumn, _ = cmd.Flags().GetString("date-column")
+		override.DistanceColumn, _ = cmd.Flags().GetString("distance-column")
+		override.DateFormat, _ = cmd.Flags().GetString("date-format")
+		override.Unit, _ = cmd.Flags().GetString("unit")
+		override.DecimalComma, _ = cmd.Flags().GetBool("decimal-comma")
+		mapping, err := readings.ResolveMapping(preset, override)
+		if err != nil {
+			return err
+		}
 
 		f, err := os.Open(args[0])
 		if err != nil {
@@ -44,7 +100,12 @@ unless --force is set.`,
 			return err
 		}
 
-		report, err := runImport(cmd.Context(), st, carID, f, overwrite, force)
+		var report readings.Report
+		if isOBD {
+			report, err = runOBDImport(cmd.Context(), st, carID, f, overwrite, force)
+		} else {
+			report, err = runMappedImport(cmd.Context(), st, carID, f, mapping, overwrite, force, os.Stdout)
+		}
 		if err != nil {
 			return err
 		}
@@ -59,38 +120,221 @@ unless --force is set.`,
 // persist with a single SaveVehicle so the import is all-or-nothing. Shared
 // by "import" and "init --import".
 func runImport(ctx context.Context, st storage.Store, carID string, r io.Reader, overwrite, force bool) (readings.Report, error) {
-	data, err := st.GetVehicle(ctx, carID)
-	if err != nil {
-		return readings.Report{}, err
+	return runMappedImport(ctx, st, carID, r, nil, overwrite, force, io.Discard)
+}
+
+// runMappedImport is runImport reading the CSV through mapping, or in the
+// export format when mapping is nil. After a mapped import it lists on w the
+// columns that were not imported.
+func runMappedImport(ctx context.Context, st storage.Store, carID string, r io.Reader, mapping *readings.Mapping, overwrite, force bool, w io.Writer) (readings.Report, error) {
+	var rows []readings.Reading
+	var unused []string
+	var rowErrs []readings.RowError
+	if mapping != nil {
+		rows, unused, rowErrs = mapping.ParseUnused(r)
+	} else {
+		rows, rowErrs = readings.ParseCSV(r)
+	}
+	if len(rowErrs) > 0 {
+		return readings.Report{}, fmt.Errorf("csv has %d invalid row(s); nothing imported:%s", len(rowErrs), rowErrorList(rowErrs))
 	}
+	report, err := mergeReadings(ctx, st, carID, func(*model.VehicleData) ([]readings.Reading, error) {
+		return rows, nil
+	}, overwrite, force)
+	if err == nil && len(unused) > 0 {
+		fmt.Fprintf(w, "Not imported (readings keep only a date and an odometer value): %s\n", strings.Join(unused, ", "))
+	}
+	return report, err
+}
 
-	rows, rowErrs := readings.ParseCSV(r)
+// runOBDImport imports an OBD-II logger's CSV: parse, turn the daily values
+// into readings against the vehicle's existing ones, then the same merge as a
+// CSV.
+func runOBDImport(ctx context.Context, st storage.Store, carID string, r io.Reader, overwrite, force bool) (readings.Report, error) {
+	log, rowErrs := readings.ParseOBD(r)
 	if len(rowErrs) > 0 {
-		msgs := make([]string, len(rowErrs))
-		for i, e := range rowErrs {
-			msgs[i] = e.Error()
+		return readings.Report{}, fmt.Errorf("obd log has %d invalid row(s); nothing imported:%s", len(rowErrs), rowErrorList(rowErrs))
+	}
+	return mergeReadings(ctx, st, carID, func(data *model.VehicleData) ([]readings.Reading, error) {
+		return log.Readings(data.Readings, data.OdometerChanges)
+	}, overwrite, force)
+}
+
+// mergeReadings merges the rows made for the vehicle into it (skip-by-default),
+// enforces the monotonic rule unless forced, and persists with a single
+// UpdateVehicle, so the rule sees the readings the import is saved over.
+func mergeReadings(ctx context.Context, st storage.Store, carID string, rowsFor func(*model.VehicleData) ([]readings.Reading, error), overwrite, force bool) (readings.Report, error) {
+	var report readings.Report
+	err := st.UpdateVehicle(ctx, carID, func(data *model.VehicleData) error {
+		rows, err := rowsFor(data)
+		if err != nil {
+			return err
 		}
-		return readings.Report{}, fmt.Errorf("csv has %d invalid row(s); nothing imported:\n  %s",
-			len(rowErrs), strings.Join(msgs, "\n  "))
+		var merged map[string]int
+		merged, report = readings.Merge(data.Readings, rows, overwrite)
+		if !force {
+			if err := readings.CheckMonotonic(merged, data.OdometerChanges); err != nil {
+				return fmt.Errorf("%w; use --force to override", err)
+			}
+		}
+		data.Readings = merged
+		return nil
+	})
+	if err != nil {
+		return readings.Report{}, err
+	}
+	return report, nil
+}
+
+// rowErrorList formats parse errors one per indented line.
+func rowErrorList(errs []readings.RowError) string {
+	var b strings.Builder
+	for _, e := range errs {
+		b.WriteString("\n  " + e.Error())
+	}
+	return b.String()
+}
+
+// runArchiveImportCmd is "import --archive": decode, then land the vehicle
+// under the collision policy.
+func runArchiveImportCmd(cmd *cobra.Command, path string) error {
+	opts := archive.Options{}
+	opts.ID, _ = cmd.Flags().GetString("car")
+	opts.OnConflict, _ = cmd.Flags().GetString("on-conflict")
+	opts.Overwrite, _ = cmd.Flags().GetBool("overwrite")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	if err := opts.Validate(); err != nil {
+		return err
 	}
 
-	merged, report := readings.Merge(data.Readings, rows, overwrite)
-	if !force {
-		if err := readings.CheckMonotonic(merged); err != nil {
-			return readings.Report{}, fmt.Errorf("%w; use --force to override", err)
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+	doc, err := archive.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+	result, err := archive.Import(cmd.Context(), st, doc, opts)
+	if errors.Is(err, archive.ErrConflict) {
+		return fmt.Errorf("%w; use --on-conflict rename or --on-conflict merge", err)
+	}
+	if errors.Is(err, archive.ErrNotMonotonic) {
+		return fmt.Errorf("%w; use --force to override", err)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Merged {
+		fmt.Printf("Merged %d reading(s) into %s (skipped %d, overwrote %d)\n",
+			result.Report.Added, result.ID, result.Report.Skipped, result.Report.Overwritten)
+	} else {
+		fmt.Printf("Created %s with %d reading(s)\n", result.ID, result.Report.Added)
+	}
+	return nil
+}
+
+// runGPXImportCmd is "import --gpx".
+func runGPXImportCmd(cmd *cobra.Command, path string) error {
+	carID, _ := cmd.Flags().GetString("car")
+	if carID == "" {
+		return fmt.Errorf("please provide a vehicle ID with --car")
+	}
+	var opts gpx.Options
+	opts.Purpose, _ = cmd.Flags().GetString("purpose")
+	opts.Driver, _ = cmd.Flags().GetString("driver")
+	opts.NoTrips, _ = cmd.Flags().GetBool("no-trips")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	loc := time.Local
+	if tz, _ := cmd.Flags().GetString("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("--tz: %w", err)
 		}
 	}
 
-	data.Readings = merged
-	if err := st.SaveVehicle(ctx, carID, data); err != nil {
-		return readings.Report{}, fmt.Errorf("save vehicle: %w", err)
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open gpx: %w", err)
 	}
-	return report, nil
+	defer f.Close()
+
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+	tripLog, err := openTrips()
+	if err != nil {
+		return err
+	}
+	return runGPXImport(cmd.Context(), st, tripLog, carID, f, loc, opts, os.Stdout)
+}
+
+// runGPXImport parses a GPX file, rejecting it whole on any bad track point,
+// then proposes (and unless a dry run, saves) readings and trips, printing a
+// day-by-day summary.
+func runGPXImport(ctx context.Context, st storage.Store, tripLog trips.Store, carID string, r io.Reader, loc *time.Location, opts gpx.Options, w io.Writer) error {
+	days, rowErrs := gpx.Parse(r, loc)
+	if len(rowErrs) > 0 {
+		return fmt.Errorf("gpx has %d problem(s); nothing imported:%s", len(rowErrs), rowErrorList(rowErrs))
+	}
+
+	p, err := gpx.Import(ctx, st, tripLog, carID, days, opts)
+	if errors.Is(err, gpx.ErrNotMonotonic) {
+		return fmt.Errorf("%w; use --force to override", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%-10s %8s  %s\n", "Date", "Miles", "Reading")
+	for _, d := range p.Days {
+		reading := "-"
+		switch {
+		case d.Existing:
+			reading = fmt.Sprintf("%d (existing, kept)", *d.Reading)
+		case d.Reading != nil:
+			reading = strconv.Itoa(*d.Reading)
+		}
+		fmt.Fprintf(w, "%-10s %8.1f  %s\n", d.Date, d.Distance, reading)
+	}
+	if opts.DryRun {
+		fmt.Fprintf(w, "Dry run: would add %d reading(s) and %d trip(s) to %s\n", p.Readings.Added, len(p.Trips), carID)
+		if p.Conflict != "" {
+			fmt.Fprintf(w, "Warning: %s; the import would need --force\n", p.Conflict)
+		}
+		return nil
+	}
+	fmt.Fprintf(w, "Imported %d reading(s) and %d trip(s) into %s (skipped %d)\n",
+		p.Readings.Added, len(p.Trips), carID, p.Readings.Skipped)
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(importCmd)
-	importCmd.Flags().StringP("car", "c", "", "Vehicle ID")
+	importCmd.Flags().StringP("car", "c", "", "Vehicle ID (with --archive: import under this id instead)")
+	importCmd.Flags().Bool("archive", false, "The file is a vehicle archive from \"mileminder export\"")
+	importCmd.Flags().String("on-conflict", "", "With --archive, when the id is taken: fail, rename or merge")
 	importCmd.Flags().Bool("overwrite", false, "Replace existing readings on dates the CSV also contains")
 	importCmd.Flags().Bool("force", false, "Allow the combined readings to decrease over time")
+	importCmd.Flags().String("preset", "", "Read another app's export ("+strings.Join(readings.PresetNames(), ", ")+")")
+	importCmd.Flags().String("date-column", "", "Header of the date column in a mapped import")
+	importCmd.Flags().String("distance-column", "", "Header of the odometer column in a mapped import")
+	importCmd.Flags().String("date-format", "", "Date format of a mapped import: iso, dmy or mdy")
+	importCmd.Flags().String("unit", "", "Odometer unit of a mapped import: mi or km")
+	importCmd.Flags().Bool("decimal-comma", false, "Read a mapped import's distances with a decimal comma (12.345,6)")
+	importCmd.Flags().Bool("obd", false, "The file is an OBD-II logger's CSV (Torque Pro, Car Scanner, OBD Fusion)")
+	importCmd.Flags().Bool("gpx", false, "The file is a GPX track log")
+	importCmd.Flags().Bool("dry-run", false, "With --gpx, show the proposed readings and trips without saving")
+	importCmd.Flags().String("tz", "", "With --gpx, time zone that decides each point's day (default local)")
+	importCmd.Flags().String("purpose", trips.Personal, "With --gpx, purpose of the logged trips: business or personal")
+	importCmd.Flags().String("driver", "", "With --gpx, who drove")
+	importCmd.Flags().Bool("no-trips", false, "With --gpx, propose readings only")
 }
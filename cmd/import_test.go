@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackiabishop/mileminder/internal/gpx"
 	"github.com/jackiabishop/mileminder/internal/model"
 	"github.com/jackiabishop/mileminder/internal/readings"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
 func seedStore(t *testing.T, existing map[string]int) storage.Store {
@@ -114,3 +119,94 @@ func TestRunImportMissingVehicle(t *testing.T) {
 		t.Fatal("want error for missing vehicle")
 	}
 }
+
+func TestRunMappedImport(t *testing.T) {
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+
+	mapping, err := readings.ResolveMapping("fuelly", readings.Mapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := "fuelup_date,odometer,notes\n2025-02-01,5400,\n2025-02-01 18:00,5450,top-up\n"
+	var out strings.Builder
+	report, err := runMappedImport(context.Background(), st, "golf", strings.NewReader(csv), mapping, false, false, &out)
+	if err != nil {
+		t.Fatalf("runMappedImport: %v", err)
+	}
+	if !strings.Contains(out.String(), "Not imported") || !strings.Contains(out.String(), "notes") {
+		t.Fatalf("the notes column was dropped without a word: %q", out.String())
+	}
+	if report != (readings.Report{Added: 1}) {
+		t.Fatalf("report = %+v", report)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-02-01"] != 5450 {
+		t.Fatalf("readings = %v", data.Readings)
+	}
+
+	// Mapped rows still go through the monotonic check.
+	csv = "fuelup_date,odometer\n2025-03-01,4000\n"
+	if _, err := runMappedImport(context.Background(), st, "golf", strings.NewReader(csv), mapping, false, false, io.Discard); err == nil {
+		t.Fatal("want monotonic error")
+	}
+}
+
+func TestRunGPXImport(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-06-01": 5000})
+	tripLog := trips.NewMemory()
+	doc := `<gpx><trk><name>Commute</name><trkseg>
+<trkpt lat="51.0" lon="0"><time>2025-06-02T07:00:00Z</time></trkpt>
+<trkpt lat="51.2" lon="0"><time>2025-06-02T07:20:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+	var out bytes.Buffer
+	if err := runGPXImport(ctx, st, tripLog, "golf", strings.NewReader(doc), time.UTC, gpx.Options{DryRun: true}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "5014") || !strings.Contains(out.String(), "Dry run: would add 1 reading(s) and 1 trip(s)") {
+		t.Fatalf("preview:\n%s", out.String())
+	}
+	if data, _ := st.GetVehicle(ctx, "golf"); len(data.Readings) != 1 {
+		t.Fatalf("dry run saved: %v", data.Readings)
+	}
+
+	out.Reset()
+	if err := runGPXImport(ctx, st, tripLog, "golf", strings.NewReader(doc), time.UTC, gpx.Options{}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := st.GetVehicle(ctx, "golf"); data.Readings["2025-06-02"] != 5014 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+	if list, _ := tripLog.List(ctx, "golf"); len(list) != 1 || list[0].Distance != 14 {
+		t.Fatalf("trips: %+v", list)
+	}
+
+	bad := `<gpx><trk><trkseg><trkpt lat="x" lon="0"/></trkseg></trk></gpx>`
+	if err := runGPXImport(ctx, st, tripLog, "golf", strings.NewReader(bad), time.UTC, gpx.Options{}, &out); err == nil || !strings.Contains(err.Error(), "nothing imported") {
+		t.Fatalf("want parse error, got %v", err)
+	}
+}
+
+func TestRunOBDImport(t *testing.T) {
+	st := seedStore(t, map[string]int{"2025-01-01": 5000})
+
+	log := "Timestamp,Odometer (mi)\n2025-02-01 08:00:00,5400\n2025-02-01 17:00:00,5420\n2025-03-01 08:00:00,5900\n"
+	report, err := runOBDImport(context.Background(), st, "golf", strings.NewReader(log), false, false)
+	if err != nil {
+		t.Fatalf("runOBDImport: %v", err)
+	}
+	if report != (readings.Report{Added: 2}) {
+		t.Fatalf("report = %+v", report)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-02-01"] != 5420 || data.Readings["2025-03-01"] != 5900 {
+		t.Fatalf("readings = %v", data.Readings)
+	}
+
+	// A distance log needs a reading before it to count from.
+	log = "Timestamp,Distance since DTC cleared (mi)\n2024-12-01 08:00:00,10\n"
+	if _, err := runOBDImport(context.Background(), st, "golf", strings.NewReader(log), false, false); err == nil {
+		t.Fatal("want an error for a distance log with no earlier reading")
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the change history of a vehicle",
+	Long: `Every change to your data — from the CLI or the web app — is recorded in
+a journal with who made it and when. log shows the changes to the --car
+vehicle (or the default), newest first; --all shows every change, including
+settings and the default vehicle. Undo an entry with 'mileminder undo <id>'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openJournal("cli")
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carID := ""
+		if all, _ := cmd.Flags().GetBool("all"); !all {
+			carFlag, _ := cmd.Flags().GetString("car")
+			if carID, err = defaultVehicleID(ctx, st, carFlag); err != nil {
+				return err
+			}
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		return runLog(ctx, st, carID, limit, os.Stdout)
+	},
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [entry-id]",
+	Short: "Undo a change from the journal",
+	Long: `Reverse the change recorded by a journal entry (see 'mileminder log'), or
+the most recent change when no id is given. The undo is itself journalled, so
+undoing it redoes the change. A change whose data has been edited again since
+cannot be undone.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openJournal("cli")
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		var id string
+		if len(args) == 1 {
+			id = args[0]
+		} else {
+			latest, err := st.History(ctx, "", 1)
+			if err != nil {
+				return err
+			}
+			if len(latest) == 0 {
+				return fmt.Errorf("nothing to undo")
+			}
+			id = latest[0].ID
+		}
+		entry, err := st.Undo(ctx, id)
+		if errors.Is(err, journal.ErrConflict) {
+			return fmt.Errorf("%w; undo the later changes first (see 'mileminder log')", err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Undid %s: %s\n", id, describeEntry(*entry))
+		return nil
+	},
+}
+
+// runLog prints up to limit journal entries for carID ("" for all), newest
+// first. A limit of 0 prints everything.
+func runLog(ctx context.Context, st *journal.Store, carID string, limit int, w io.Writer) error {
+	entries, err := st.History(ctx, carID, limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No changes recorded.")
+		return nil
+	}
+	fmt.Fprintf(w, "%-16s %-17s %-12s %s\n", "ID", "When", "Actor", "Change")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%-16s %-17s %-12s %s\n", e.ID, e.At.Local().Format("2006-01-02 15:04"), e.Actor, describeEntry(e))
+	}
+	return nil
+}
+
+// describeEntry summarises a journal entry in one line.
+func describeEntry(e journal.Entry) string {
+	var s string
+	switch e.Op {
+	case journal.OpPutReading:
+		s = fmt.Sprintf("reading %s on %s: %d mi", e.Date, e.VehicleID, e.After.Readings[e.Date])
+		if e.Before != nil {
+			if old, ok := e.Before.Readings[e.Date]; ok {
+				s += fmt.Sprintf(" (was %d)", old)
+			}
+		}
+	case journal.OpDeleteReading:
+		s = fmt.Sprintf("deleted reading %s on %s", e.Date, e.VehicleID)
+	case journal.OpSaveVehicle:
+		if e.Before == nil {
+			s = fmt.Sprintf("created %s", e.VehicleID)
+		} else {
+			s = fmt.Sprintf("updated %s", e.VehicleID)
+		}
+	case journal.OpDeleteVehicle:
+		s = fmt.Sprintf("deleted %s", e.VehicleID)
+	case journal.OpRename:
+		s = fmt.Sprintf("renamed %s to %s", e.From, e.VehicleID)
+	case journal.OpMerge:
+		s = fmt.Sprintf("merged %s into %s", e.From, e.VehicleID)
+	case journal.OpRestore:
+		if e.Date != "" {
+			s = fmt.Sprintf("restored reading %s on %s", e.Date, e.VehicleID)
+		} else {
+			s = fmt.Sprintf("restored %s", e.VehicleID)
+		}
+	case journal.OpSetCurrent:
+		s = fmt.Sprintf("default vehicle set to %s", e.VehicleID)
+	case journal.OpSaveSettings:
+		s = "settings updated"
+	case journal.OpRevert:
+		s = fmt.Sprintf("reverted %s", e.VehicleID)
+		if e.From != "" {
+			s += " and " + e.From
+		}
+	default:
+		s = e.Op
+	}
+	if e.Undoes != "" {
+		s += fmt.Sprintf(" (undo of %s)", e.Undoes)
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd, undoCmd)
+	logCmd.Flags().Bool("all", false, "Show changes to every vehicle, settings and the default")
+	logCmd.Flags().IntP("limit", "n", 20, "Show at most this many entries (0 for all)")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+)
+
+func TestRunLog(t *testing.T) {
+	ctx := context.Background()
+	st := journal.Wrap(seedStore(t, map[string]int{"2025-01-01": 5000}), journal.NewMemoryLog(), "cli")
+
+	var out bytes.Buffer
+	if err := runLog(ctx, st, "golf", 0, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No changes recorded") {
+		t.Fatalf("empty log output: %q", out.String())
+	}
+
+	if err := st.PutReading(ctx, "golf", "2025-01-01", 5100); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.PutReading(ctx, "golf", "2025-02-01", 5400); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+	if _, err := st.Undo(ctx, history[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := runLog(ctx, st, "golf", 0, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"reading 2025-01-01 on golf: 5100 mi (was 5000)",
+		"reading 2025-02-01 on golf: 5400 mi",
+		"reverted golf (undo of " + history[0].ID + ")",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("log missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := runLog(ctx, st, "golf", 1, &out); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Fatalf("limit 1: want header + 1 line, got %d lines:\n%s", n, out.String())
+	}
+}
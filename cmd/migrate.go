@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/schema"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/transfer"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade data files to the current schema version",
+	Long: `Data files carry a schema version. Older files are upgraded in memory when
+read and rewritten at the current version the next time they are saved, so
+running this is never required. migrate rewrites every outdated file now,
+keeping the old version under schema-backup/ beside it.
+
+--check lists what would change without writing anything, and exits non-zero
+if any file is outdated. --hosted migrates a hosted data root (--data-dir)
+instead of ~/.mileminder.
+
+With --from and --to, migrate instead copies vehicles between storage
+backends, each given as <backend>[:<dir>] with backend yaml, sqlite or events:
+
+  mileminder migrate --from yaml --to sqlite
+  mileminder migrate --hosted --from yaml:/var/lib/mileminder --to sqlite
+
+Every vehicle with its readings, the settings and the current vehicle are
+copied (every user's, in hosted mode), then compared: vehicle and reading
+counts, and each vehicle's status, must match. A hosted copy to another data
+root also copies the accounts, with their passwords; users sign in again, and
+their photos, trips and history stay in the source root. The source is left
+as it was. Nothing is copied while the source has files it cannot read (see
+'mileminder doctor') or items in its trash, which cannot be recreated in the
+destination: restore or purge them first. A copy that fails part-way resumes
+where it stopped when rerun; with --check, an existing copy is only compared.
+Stop the server first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hosted := hostedMode(cmd)
+		if cmd.Flags().Changed("from") || cmd.Flags().Changed("to") {
+			return runBackendMigrate(cmd, hosted)
+		}
+		var dir string
+		var err error
+		if hosted {
+			dir, err = hostedDataDir(cmd)
+		} else {
+			dir, err = yamlstore.DefaultDir()
+		}
+		if err != nil {
+			return err
+		}
+		if cfg, err := crypt.ReadConfig(dir); err != nil {
+			return err
+		} else if cfg != nil {
+			return fmt.Errorf("%s is encrypted, so its files are upgraded only as they are next saved; 'mileminder decrypt' first to migrate them all now", dir)
+		}
+		files, err := schemaFiles(dir, hosted)
+		if err != nil {
+			return err
+		}
+		check, _ := cmd.Flags().GetBool("check")
+		outdated, err := runMigrate(files, check, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if check && outdated > 0 {
+			return fmt.Errorf("%d file(s) need migrating; run 'mileminder migrate'", outdated)
+		}
+		return nil
+	},
+}
+
+// schemaFile is one versioned document on disk.
+type schemaFile struct {
+	path string
+	kind schema.Kind
+}
+
+// schemaFiles lists the versioned documents under dir: a vehicle directory's
+// <id>.yml files and settings, or for a hosted root its auth files plus every
+// user's vehicle directory.
+func schemaFiles(dir string, hosted bool) ([]schemaFile, error) {
+	if !hosted {
+		return vehicleDirFiles(dir)
+	}
+	files := []schemaFile{
+		{filepath.Join(dir, "users.yml"), schema.Users},
+		{filepath.Join(dir, "sessions.yml"), schema.Sessions},
+		{filepath.Join(dir, "resets.yml"), schema.PasswordResets},
+	}
+	users, err := os.ReadDir(filepath.Join(dir, "users"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read users dir: %w", err)
+	}
+	for _, u := range users {
+		if !u.IsDir() {
+			continue
+		}
+		more, err := vehicleDirFiles(filepath.Join(dir, "users", u.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, more...)
+	}
+	return files, nil
+}
+
+// vehicleDirFiles lists a yamlstore directory's documents, by the same rule
+// the store uses: every *.yml file is a vehicle, subdirectories are not.
+func vehicleDirFiles(dir string) ([]schemaFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read store dir: %w", err)
+	}
+	files := []schemaFile{{filepath.Join(dir, "settings"), schema.Settings}}
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".yml" {
+			files = append(files, schemaFile{filepath.Join(dir, e.Name()), schema.Vehicle})
+		}
+	}
+	return files, nil
+}
+
+// runMigrate reports, and unless check is set rewrites, every outdated file,
+// returning how many were outdated. Missing files are skipped; a file newer
+// than this build is an error.
+func runMigrate(files []schemaFile, check bool, w io.Writer) (int, error) {
+	outdated := 0
+	for _, f := range files {
+		raw, err := os.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return outdated, err
+		}
+		from, err := schema.Version(raw)
+		if err != nil {
+			fmt.Fprintf(w, "%s: unreadable, skipped (%v)\n", f.path, err)
+			continue
+		}
+		current := schema.Current(f.kind)
+		if from > current {
+			return outdated, fmt.Errorf("%s is %s schema v%d, newer than this build (v%d): %w", f.path, f.kind, from, current, schema.ErrTooNew)
+		}
+		if from == current {
+			continue
+		}
+		outdated++
+		var steps []string
+		for _, m := range schema.Pending(f.kind, from) {
+			steps = append(steps, m.Summary)
+		}
+		fmt.Fprintf(w, "%s: %s v%d → v%d (%s)\n", f.path, f.kind, from, current, strings.Join(steps, "; "))
+		if check {
+			continue
+		}
+		if _, err := schema.Rewrite(f.kind, f.path); err != nil {
+			return outdated, err
+		}
+	}
+	switch {
+	case outdated == 0:
+		fmt.Fprintln(w, "All files are at the current schema version.")
+	case check:
+		fmt.Fprintf(w, "%d file(s) would be migrated.\n", outdated)
+	default:
+		fmt.Fprintf(w, "Migrated %d file(s); originals are in %s/ beside each.\n", outdated, schema.BackupDir)
+	}
+	return outdated, nil
+}
+
+// backendSpec is a --from or --to value: a store backend and the directory
+// it lives in.
+type backendSpec struct {
+	backend string
+	dir     string
+}
+
+func (b backendSpec) String() string { return b.backend + ":" + b.dir }
+
+// parseBackendSpec parses "<backend>[:<dir>]", taking defaultDir when no
+// directory is given.
+func parseBackendSpec(flag, value, defaultDir string) (backendSpec, error) {
+	name, dir, _ := strings.Cut(value, ":")
+	if name == "" {
+		return backendSpec{}, fmt.Errorf("--%s needs a backend: yaml, sqlite or events", flag)
+	}
+	backend, err := parseStoreBackend("--"+flag, name)
+	if err != nil {
+		return backendSpec{}, err
+	}
+	if dir == "" {
+		dir = defaultDir
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return backendSpec{}, err
+	}
+	return backendSpec{backend: backend, dir: abs}, nil
+}
+
+// runBackendMigrate resolves --from and --to and copies between them.
+func runBackendMigrate(cmd *cobra.Command, hosted bool) error {
+	var dir string
+	var err error
+	if hosted {
+		dir, err = hostedDataDir(cmd)
+	} else {
+		dir, err = yamlstore.DefaultDir()
+	}
+	if err != nil {
+		return err
+	}
+	fromFlag, _ := cmd.Flags().GetString("from")
+	toFlag, _ := cmd.Flags().GetString("to")
+	from, err := parseBackendSpec("from", fromFlag, dir)
+	if err != nil {
+		return err
+	}
+	to, err := parseBackendSpec("to", toFlag, from.dir)
+	if err != nil {
+		return err
+	}
+	check, _ := cmd.Flags().GetBool("check")
+	return migrateBackend(cmd.Context(), from, to, hosted, check, time.Now(), os.Stdout)
+}
+
+// migrateBackend copies from one backend to another and verifies the copy,
+// or with check only verifies. A single-user copy is one store; a hosted one
+// is every account's, enumerated from the source root's users.yml and copied
+// to the destination root's, which is the same file when the roots are.
+func migrateBackend(ctx context.Context, from, to backendSpec, hosted, check bool, now time.Time, w io.Writer) error {
+	if from == to {
+		return fmt.Errorf("--from and --to are both %s", from)
+	}
+	var pairs []transfer.Pair
+	if hosted {
+		src, err := openTenants(from.backend, from.dir)
+		if err != nil {
+			return err
+		}
+		dst, err := openTenants(to.backend, to.dir)
+		if err != nil {
+			return err
+		}
+		fromKey, err := dirKey(from.dir)
+		if err != nil {
+			return err
+		}
+		toKey, err := dirKey(to.dir)
+		if err != nil {
+			return err
+		}
+		accounts, created, err := transfer.Accounts(ctx, filestore.NewEncryptedUserStore(from.dir, fromKey), filestore.NewEncryptedUserStore(to.dir, toKey), check)
+		if err != nil {
+			return err
+		}
+		if created > 0 {
+			fmt.Fprintf(w, "Copied %d account(s) to %s.\n", created, to.dir)
+		}
+		for _, a := range accounts {
+			pairs = append(pairs, transfer.Pair{Tenant: a.From, From: src.ForUser(a.From), To: dst.ForUser(a.To)})
+		}
+	} else {
+		src, err := openVehicles(from.backend, from.dir)
+		if err != nil {
+			return err
+		}
+		dst, err := openVehicles(to.backend, to.dir)
+		if err != nil {
+			return err
+		}
+		pairs = []transfer.Pair{{From: src, To: dst}}
+	}
+
+	progress, err := transfer.OpenProgress(filepath.Join(to.dir, transfer.ProgressFile), from.String(), to.String())
+	if err != nil {
+		return err
+	}
+	if !check {
+		fmt.Fprintf(w, "Copying %s → %s\n", from, to)
+		if progress.Resuming() {
+			fmt.Fprintln(w, "Resuming an interrupted migration.")
+		}
+		copied, err := transfer.Copy(ctx, pairs, progress)
+		if err != nil {
+			return fmt.Errorf("%w (rerun to resume)", err)
+		}
+		fmt.Fprintf(w, "Copied %d vehicle(s) with %d reading(s) for %d store(s)", copied.Vehicles, copied.Readings, copied.Tenants)
+		if copied.Skipped > 0 {
+			fmt.Fprintf(w, "; %d vehicle(s) were already copied", copied.Skipped)
+		}
+		fmt.Fprintln(w, ".")
+	}
+
+	verified, err := transfer.Verify(ctx, pairs, now)
+	if err != nil {
+		return fmt.Errorf("verification failed:\n%w", err)
+	}
+	fmt.Fprintf(w, "Verified %d vehicle(s), %d reading(s), %d settings document(s) and %d current vehicle(s) against the source.\n",
+		verified.Vehicles, verified.Readings, verified.Settings, verified.Current)
+	if check {
+		return nil
+	}
+	if err := progress.Remove(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Switch over with MILEMINDER_STORE=%s (or serve --store %s); the %s data is left in place.\n", to.backend, to.backend, from.backend)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().Bool("check", false, "List outdated files without changing anything")
+	migrateCmd.Flags().Bool("hosted", false, "Migrate a hosted data root instead of ~/.mileminder (env: MILEMINDER_HOSTED)")
+	migrateCmd.Flags().String("data-dir", "", "Hosted data root (default ~/.mileminder-hosted; env: MILEMINDER_DATA_DIR)")
+	migrateCmd.Flags().String("from", "", "Copy vehicles from this backend, <yaml|sqlite|events>[:<dir>] (dir defaults to the data directory)")
+	migrateCmd.Flags().String("to", "", "Copy vehicles to this backend, <yaml|sqlite|events>[:<dir>] (dir defaults to --from's)")
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/transfer"
+)
+
+func TestMigrateBackendSingleUser(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := yamlstore.New(dir)
+	src.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5600}})
+	src.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo", Readings: map[string]int{"2025-01-01": 10}})
+	src.SetCurrent(ctx, "polo")
+	src.DeleteReading(ctx, "golf", "2025-02-01")
+
+	from := backendSpec{storeYAML, dir}
+	to := backendSpec{storeSQLite, dir}
+	var out bytes.Buffer
+	if err := migrateBackend(ctx, from, to, false, false, time.Now(), &out); !errors.Is(err, transfer.ErrTrashNotEmpty) {
+		t.Fatalf("copy with a full trash: %v", err)
+	}
+	if _, err := src.PurgeTrashBefore(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateBackend(ctx, from, to, false, false, time.Now(), &out); err != nil {
+		t.Fatalf("migrate: %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"Copied 2 vehicle(s) with 2 reading(s)", "Verified 2 vehicle(s)", "MILEMINDER_STORE=sqlite"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, transfer.ProgressFile)); !os.IsNotExist(err) {
+		t.Fatal("progress file left after a finished migration")
+	}
+	st, err := openVehicles(storeSQLite, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := st.GetCurrent(ctx); current != "polo" {
+		t.Fatalf("current = %q", current)
+	}
+
+	// --check compares an existing copy; a second copy is refused rather
+	// than merged.
+	out.Reset()
+	if err := migrateBackend(ctx, from, to, false, true, time.Now(), &out); err != nil || strings.Contains(out.String(), "Copying") {
+		t.Fatalf("check: %v\n%s", err, out.String())
+	}
+	if err := migrateBackend(ctx, from, to, false, false, time.Now(), &out); err == nil || !strings.Contains(err.Error(), "already has vehicles") {
+		t.Fatalf("second copy: %v", err)
+	}
+	if err := migrateBackend(ctx, from, from, false, false, time.Now(), &out); err == nil {
+		t.Fatal("copy onto itself accepted")
+	}
+}
+
+func TestMigrateBackendHosted(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	users := filestore.NewUserStore(root)
+	alice, _ := users.CreateUser(ctx, "alice@example.com", "hash")
+	bob, _ := users.CreateUser(ctx, "bob@example.com", "hash")
+	tenants := yamlstore.NewTenants(root)
+	tenants.ForUser(alice.ID).SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 1}})
+	tenants.ForUser(bob.ID).SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Bob's Golf", Readings: map[string]int{"2025-01-01": 2}})
+	tenants.ForUser(bob.ID).SaveSettings(ctx, &model.Settings{Currency: "EUR", DistanceUnit: "km"})
+
+	var out bytes.Buffer
+	if err := migrateBackend(ctx, backendSpec{storeYAML, root}, backendSpec{storeSQLite, root}, true, false, time.Now(), &out); err != nil {
+		t.Fatalf("migrate: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "for 2 store(s)") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	db, err := sqlstore.Open(filepath.Join(root, sqlstore.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data, err := db.ForUser(bob.ID).GetVehicle(ctx, "golf")
+	if err != nil || data.Vehicle != "Bob's Golf" {
+		t.Fatalf("bob's golf: %+v, %v", data, err)
+	}
+	if settings, _ := db.ForUser(bob.ID).GetSettings(ctx); settings.Currency != "EUR" {
+		t.Fatalf("bob's settings: %+v", settings)
+	}
+
+	// To another data root the accounts are copied too, under new ids.
+	other := t.TempDir()
+	out.Reset()
+	if err := migrateBackend(ctx, backendSpec{storeYAML, root}, backendSpec{storeEvents, other}, true, false, time.Now(), &out); err != nil {
+		t.Fatalf("migrate to another root: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Copied 2 account(s)") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	copied, err := filestore.NewUserStore(other).GetUserByEmail(ctx, "bob@example.com")
+	if err != nil || copied.PasswordHash != "hash" {
+		t.Fatalf("bob's account: %+v, %v", copied, err)
+	}
+	moved, err := openTenants(storeEvents, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := moved.ForUser(copied.ID).GetVehicle(ctx, "golf"); err != nil || data.Vehicle != "Bob's Golf" {
+		t.Fatalf("bob's golf in the other root: %+v, %v", data, err)
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/schema"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+func TestRunMigrate(t *testing.T) {
+	dir := t.TempDir()
+	legacy := "vehicle: Golf\nreadings:\n    \"2025-01-01\": 5000\n"
+	if err := os.WriteFile(filepath.Join(dir, "golf.yml"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := yamlstore.New(dir).SaveVehicle(context.Background(), "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := schemaFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	n, err := runMigrate(files, true, &out)
+	if err != nil || n != 1 {
+		t.Fatalf("check = %d, %v\n%s", n, err, out.String())
+	}
+	if !strings.Contains(out.String(), fmt.Sprintf("golf.yml: vehicle v0 → v%d", schema.Current(schema.Vehicle))) || strings.Contains(out.String(), "polo.yml") {
+		t.Fatalf("check output:\n%s", out.String())
+	}
+	if raw, _ := os.ReadFile(filepath.Join(dir, "golf.yml")); string(raw) != legacy {
+		t.Fatal("--check wrote the file")
+	}
+
+	out.Reset()
+	if n, err := runMigrate(files, false, &out); err != nil || n != 1 {
+		t.Fatalf("migrate = %d, %v", n, err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "golf.yml"))
+	if v, _ := schema.Version(raw); v != schema.Current(schema.Vehicle) {
+		t.Fatalf("migrated file:\n%s", raw)
+	}
+	if backup, _ := os.ReadFile(filepath.Join(dir, schema.BackupDir, "golf.yml.v0")); string(backup) != legacy {
+		t.Fatalf("backup = %q", backup)
+	}
+	data, err := yamlstore.New(dir).GetVehicle(context.Background(), "golf")
+	if err != nil || data.Readings["2025-01-01"] != 5000 {
+		t.Fatalf("migrated vehicle = %+v, %v", data, err)
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+var odometerCmd = &cobra.Command{
+	Use:   "odometer",
+	Short: "Record odometer replacements and rollovers",
+	Long: `When an instrument cluster is replaced or an odometer rolls over, readings
+drop. Recording the change — the old odometer's final reading and the new one's
+starting reading — lets status, graphs and the allowance maths measure distance
+across it, and lets later readings be added without --force.`,
+}
+
+var odometerRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record an odometer change",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		date, _ := cmd.Flags().GetString("date")
+		if date == "" {
+			date = time.Now().Format("2006-01-02")
+		}
+		oldFinal, _ := cmd.Flags().GetInt("old-final")
+		newStart, _ := cmd.Flags().GetInt("new-start")
+		force, _ := cmd.Flags().GetBool("force")
+		change := model.OdometerChange{Date: date, OldFinal: oldFinal, NewStart: newStart}
+		if err := runOdometerRecord(ctx, st, carID, change, force); err != nil {
+			return err
+		}
+		fmt.Printf("Recorded odometer change for %s on %s: %d → %d\n", carID, date, oldFinal, newStart)
+		return nil
+	},
+}
+
+var odometerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a vehicle's odometer changes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		return runOdometerList(ctx, st, carID, os.Stdout)
+	},
+}
+
+var odometerRemoveCmd = &cobra.Command{
+	Use:   "remove <date>",
+	Short: "Remove a recorded odometer change",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		if err := runOdometerRemove(ctx, st, carID, args[0], force); err != nil {
+			return err
+		}
+		fmt.Printf("Removed odometer change for %s on %s\n", carID, args[0])
+		return nil
+	},
+}
+
+// runOdometerRecord adds change to the vehicle, refusing (unless forced) one
+// that does not fit the readings either side of it.
+func runOdometerRecord(ctx context.Context, st storage.Store, carID string, change model.OdometerChange, force bool) error {
+	return st.UpdateVehicle(ctx, carID, func(data *model.VehicleData) error {
+		changes, err := readings.AddChange(data.OdometerChanges, change)
+		if err != nil {
+			return err
+		}
+		if !force {
+			if err := readings.CheckMonotonic(data.Readings, changes); err != nil {
+				return fmt.Errorf("%w; use --force to override", err)
+			}
+		}
+		data.OdometerChanges = changes
+		return nil
+	})
+}
+
+// runOdometerRemove deletes the change on date. Without the change the
+// readings it explained may decrease again, so that needs force too.
+func runOdometerRemove(ctx context.Context, st storage.Store, carID, date string, force bool) error {
+	return st.UpdateVehicle(ctx, carID, func(data *model.VehicleData) error {
+		changes := slices.DeleteFunc(slices.Clone(data.OdometerChanges), func(c model.OdometerChange) bool { return c.Date == date })
+		if len(changes) == len(data.OdometerChanges) {
+			return fmt.Errorf("no odometer change on %s for %s", date, carID)
+		}
+		if !force {
+			if err := readings.CheckMonotonic(data.Readings, changes); err != nil {
+				return fmt.Errorf("%w; use --force to remove it anyway", err)
+			}
+		}
+		data.OdometerChanges = changes
+		return nil
+	})
+}
+
+// runOdometerList prints carID's odometer changes in date order.
+func runOdometerList(ctx context.Context, st storage.Store, carID string, w io.Writer) error {
+	data, err := st.GetVehicle(ctx, carID)
+	if err != nil {
+		return err
+	}
+	if len(data.OdometerChanges) == 0 {
+		fmt.Fprintf(w, "No odometer changes recorded for %s.\n", carID)
+		return nil
+	}
+	fmt.Fprintf(w, "%-10s  %10s  %10s\n", "Date", "Old final", "New start")
+	for _, c := range data.OdometerChanges {
+		fmt.Fprintf(w, "%-10s  %10d  %10d\n", c.Date, c.OldFinal, c.NewStart)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(odometerCmd)
+	odometerCmd.AddCommand(odometerRecordCmd, odometerListCmd, odometerRemoveCmd)
+	odometerRecordCmd.Flags().String("date", "", "Date of the change, YYYY-MM-DD (default today)")
+	odometerRecordCmd.Flags().Int("old-final", 0, "Final reading of the old odometer")
+	odometerRecordCmd.Flags().Int("new-start", 0, "Starting reading of the new odometer")
+	odometerRecordCmd.Flags().Bool("force", false, "Record the change even if the readings do not fit it")
+	odometerRecordCmd.MarkFlagRequired("old-final")
+	odometerRemoveCmd.Flags().Bool("force", false, "Remove the change even if readings then decrease")
+}
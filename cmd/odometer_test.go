@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func TestRunOdometerRecordAndRemove(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 99000, "2025-03-01": 400})
+	change := model.OdometerChange{Date: "2025-02-01", OldFinal: 99500, NewStart: 0}
+
+	if err := runOdometerRecord(ctx, st, "golf", model.OdometerChange{Date: "2025-02-01", OldFinal: 98000}, false); err == nil {
+		t.Fatal("change below an earlier reading accepted")
+	}
+	if err := runOdometerRecord(ctx, st, "golf", change, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := runOdometerRecord(ctx, st, "golf", change, true); err == nil {
+		t.Fatal("second change on the same date accepted")
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if s := calc.ComputeStatus("golf", data); s.LatestReading != 400 {
+		t.Fatalf("latest reading = %d", s.LatestReading)
+	}
+
+	var out bytes.Buffer
+	if err := runOdometerList(ctx, st, "golf", &out); err != nil || !strings.Contains(out.String(), "99500") {
+		t.Fatalf("list = %q, %v", out.String(), err)
+	}
+
+	if err := runOdometerRemove(ctx, st, "golf", "2025-02-01", false); err == nil {
+		t.Fatal("removing the change that explains the drop should need force")
+	}
+	if err := runOdometerRemove(ctx, st, "golf", "2025-02-01", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := runOdometerRemove(ctx, st, "golf", "2025-02-01", true); err == nil {
+		t.Fatal("removing a missing change succeeded")
+	}
+}
@@ -53,7 +53,7 @@ var resetCmd = &cobra.Command{
 		if err := st.DeleteVehicle(ctx, carID); err != nil {
 			return err
 		}
-		fmt.Printf("Deleted data for %s\n", carID)
+		fmt.Printf("Deleted data for %s (restorable with `mileminder trash`)\n", carID)
 		return nil
 	},
 }
@@ -0,0 +1,634 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <archive> [vehicle-id...]",
+	Short: "Restore the data directory from a backup archive",
+	Long: `restore reads an archive written by 'mileminder backup' and lists what it
+would change: vehicles added, replaced or removed, with their readings, and
+the settings and default vehicle. --dry-run stops there.
+
+Every entry is checked before anything is written: its path must stay inside
+the archive's mileminder/ directory, each vehicle and settings file must
+parse at a schema version this build reads, and each photo must match its
+hash. The archive is unpacked to a temporary directory, never over the live
+data.
+
+With no vehicle ids the data is replaced by the archive's: vehicles not in
+it are moved to the trash, and its settings and default vehicle are
+restored. With ids, only those vehicles are restored and nothing else is
+touched. Photos attached to restored readings, and the trips of restored
+vehicles, are added back either way.
+
+Before changing anything restore archives the current data, as backup does,
+to --safety-backup. Changes are journalled as "restore", so 'mileminder undo'
+reverses them one at a time.
+
+The restore is not atomic: vehicles are written one at a time, then removed
+ones are moved to the trash, then the settings and default vehicle are set.
+If it fails part-way the data is left partly restored; run it again, or
+restore the safety backup to get back to where you started. Only vehicles,
+readings, trips, settings, the default vehicle and photos are restored: the
+trash (which backup archives too), the change journal and calendar and
+connected-car tokens are left as they are.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		dir, err := yamlstore.DefaultDir()
+		if err != nil {
+			return fmt.Errorf("locate data directory: %w", err)
+		}
+		backend, err := storeBackend()
+		if err != nil {
+			return err
+		}
+
+		staged, err := os.MkdirTemp("", "mileminder-restore-")
+		if err != nil {
+			return fmt.Errorf("create staging directory: %w", err)
+		}
+		defer os.RemoveAll(staged)
+		src, key, err := stageBackup(ctx, args[0], staged, dir, backend)
+		if err != nil {
+			return err
+		}
+
+		st, err := openJournal("restore")
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		plan, err := planRestore(ctx, src, st, trips.NewEncryptedFileStore(staged, key), tripLog, args[1:])
+		if err != nil {
+			return err
+		}
+		printRestorePlan(plan, os.Stdout)
+		if plan.empty() {
+			fmt.Println("Nothing to restore: the data already matches the archive.")
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return nil
+		}
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			reader := bufio.NewReader(os.Stdin)
+			fmt.Print("Restore these changes? (y/N): ")
+			resp, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if strings.ToLower(strings.TrimSpace(resp)) != "y" {
+				fmt.Println("Aborted.")
+				return nil
+			}
+		}
+
+		safety, _ := cmd.Flags().GetString("safety-backup")
+		if safety == "" {
+			safety = "./mileminder-pre-restore-" + time.Now().Format("20060102-150405") + ".tar.gz"
+		}
+		// Only an empty or missing data directory goes without a safety
+		// backup; one that cannot be listed stops the restore.
+		saved := ""
+		var live []string
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			if live, err = backupFiles(dir); err != nil {
+				return fmt.Errorf("safety backup: %w", err)
+			}
+		}
+		if len(live) > 0 {
+			count, err := writeBackup(dir, safety)
+			if err != nil {
+				return fmt.Errorf("safety backup: %w", err)
+			}
+			fmt.Printf("Saved the current data to %s (%d files)\n", safety, count)
+			saved = safety
+		}
+
+		att, err := openAttachments()
+		if err != nil {
+			return err
+		}
+		if err := applyRestore(ctx, plan, src, st, attachments.NewEncryptedFileStore(staged, key), att, tripLog); err != nil {
+			if saved == "" {
+				return err
+			}
+			return fmt.Errorf("%w; the data from before the restore is in %s", err, saved)
+		}
+		fmt.Println("Restored.")
+		return nil
+	},
+}
+
+// maxRestoreEntry bounds one archive entry, so a crafted archive cannot fill
+// the disk: far above any real events log or photo.
+const maxRestoreEntry = 256 << 20
+
+// stageBackup unpacks the backup archive at archivePath into staged, checking
+// every entry, and returns the store it holds — the events log when the live
+// data directory dir uses the events backend (or the archive has nothing
+// else), its YAML files otherwise — with the key the archive is encrypted
+// with, nil if it is not.
+func stageBackup(ctx context.Context, archivePath, staged, dir, backend string) (storage.Store, *crypt.Key, error) {
+	names, err := unpackBackup(archivePath, staged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", archivePath, err)
+	}
+	var key *crypt.Key
+	if names[crypt.ConfigFile] {
+		cfg, err := crypt.ReadConfig(staged)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+		// The same key as the live data's needs no second passphrase.
+		unlock := staged
+		if live, err := crypt.ReadConfig(dir); err == nil && live != nil && live.KeyID == cfg.KeyID {
+			unlock = dir
+		}
+		if key, err = dirKey(unlock); err != nil {
+			return nil, nil, fmt.Errorf("%s is encrypted: %w", archivePath, err)
+		}
+	}
+	hasYAML := false
+	for name := range names {
+		if name == "current" || name == "settings" || filepath.Ext(name) == ".yml" && !strings.Contains(name, "/") {
+			hasYAML = true
+		}
+	}
+	if names[eventstore.LogFile] && (backend == storeEvents || !hasYAML) {
+		src := eventstore.NewEncrypted(staged, key)
+		if _, err := src.ListVehicles(ctx); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+		return src, key, nil
+	}
+
+	src := yamlstore.NewEncrypted(staged, key)
+	bad, err := src.Unreadable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bad) > 0 {
+		var msgs []string
+		for _, f := range bad {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", f.Name, f.Err))
+		}
+		return nil, nil, fmt.Errorf("%s has unreadable files:\n  %s", archivePath, strings.Join(msgs, "\n  "))
+	}
+	if err := checkAttachments(ctx, src, attachments.NewEncryptedFileStore(staged, key)); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", archivePath, err)
+	}
+	return src, key, nil
+}
+
+// unpackBackup writes the archive's entries into dir and returns the set of
+// their names relative to the archive's mileminder/ directory. It refuses the whole
+// archive if any entry is not a regular file backup would have written, or
+// names a path outside mileminder/.
+func unpackBackup(archivePath, dir string) (map[string]bool, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	names := map[string]bool{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		name, err := backupEntryName(header)
+		if err != nil {
+			return nil, err
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%s appears twice", header.Name)
+		}
+		names[name] = true
+		if err := unpackEntry(tr, header, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("the archive holds no MileMinder data files")
+	}
+	return names, nil
+}
+
+// backupEntryName checks one entry and returns its path relative to
+// mileminder/.
+func backupEntryName(header *tar.Header) (string, error) {
+	if header.Typeflag != tar.TypeReg {
+		return "", fmt.Errorf("%s: not a regular file", header.Name)
+	}
+	name, ok := strings.CutPrefix(header.Name, "mileminder/")
+	if !ok || strings.Contains(name, `\`) || path.Clean(name) != name || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("%s: unsafe path", header.Name)
+	}
+	if header.Size > maxRestoreEntry {
+		return "", fmt.Errorf("%s: too large (%d bytes)", header.Name, header.Size)
+	}
+	dir, base := path.Split(name)
+	switch {
+	case dir == "" && backupName(base):
+	case name == "attachments/index.yml", name == tripsFile:
+	case dir == trashDir+"/" && trashName(base):
+	case dir == "attachments/objects/" && len(base) == sha256.Size*2:
+	default:
+		return "", fmt.Errorf("%s: not a MileMinder data file", header.Name)
+	}
+	return name, nil
+}
+
+func unpackEntry(r io.Reader, header *tar.Header, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return fmt.Errorf("create staging directory: %w", err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unpack %s: %w", header.Name, err)
+	}
+	if _, err := io.CopyN(out, r, header.Size); err != nil {
+		out.Close()
+		return fmt.Errorf("unpack %s: %w", header.Name, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unpack %s: %w", header.Name, err)
+	}
+	return nil
+}
+
+// checkAttachments reads every archived photo of src's vehicles and checks it
+// against its hash.
+func checkAttachments(ctx context.Context, src storage.Store, att attachments.Store) error {
+	records, err := src.ListVehicles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		list, err := att.List(ctx, r.ID, "")
+		if err != nil {
+			return err
+		}
+		for _, a := range list {
+			_, content, err := att.Get(ctx, r.ID, a.Date, a.Hash)
+			if err != nil {
+				return err
+			}
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != a.Hash {
+				return fmt.Errorf("attachment %s on %s %s does not match its hash", a.Hash, r.ID, a.Date)
+			}
+		}
+	}
+	return nil
+}
+
+// restorePlan is what a restore changes.
+type restorePlan struct {
+	vehicles []vehicleRestore
+	// The settings and the default vehicle change in a full restore only.
+	settingsChanged bool
+	currentFrom     string
+	currentTo       string
+	unknownCurrent  bool // the archive's default vehicle is not in it
+}
+
+// Vehicle restore actions.
+const (
+	restoreAdd       = "add"
+	restoreReplace   = "replace"
+	restoreUnchanged = "unchanged"
+	restoreRemove    = "remove"
+)
+
+// vehicleRestore is one vehicle's part of a restore, with the reading counts
+// for the listing.
+type vehicleRestore struct {
+	id                      string
+	action                  string
+	data                    *storage.Record
+	added, changed, removed int
+	details                 bool // name, registration, plan or odometer changes differ
+	// trips are the archive's trips for the vehicle, put back in place of
+	// the live ones when tripsChanged.
+	trips        []trips.Trip
+	tripsChanged bool
+}
+
+func (p *restorePlan) empty() bool {
+	for _, v := range p.vehicles {
+		if v.action != restoreUnchanged {
+			return false
+		}
+	}
+	return !p.settingsChanged && p.currentTo == ""
+}
+
+// planRestore compares the archive's store src and trips srcTrips with the
+// live dst and dstTrips: the vehicles in only, or with none everything,
+// settings and default vehicle included.
+func planRestore(ctx context.Context, src, dst storage.Store, srcTrips, dstTrips trips.Store, only []string) (*restorePlan, error) {
+	srcRecords, err := src.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstRecords, err := dst.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	archived := map[string]*storage.Record{}
+	for i := range srcRecords {
+		archived[srcRecords[i].ID] = &srcRecords[i]
+	}
+	live := map[string]*storage.Record{}
+	for i := range dstRecords {
+		live[dstRecords[i].ID] = &dstRecords[i]
+	}
+
+	ids := only
+	if len(only) == 0 {
+		for id := range archived {
+			ids = append(ids, id)
+		}
+		for id := range live {
+			if archived[id] == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+
+	plan := &restorePlan{}
+	for _, id := range ids {
+		from, to := archived[id], live[id]
+		switch {
+		case from == nil && len(only) > 0:
+			return nil, fmt.Errorf("vehicle %q is not in the archive", id)
+		case from == nil:
+			plan.vehicles = append(plan.vehicles, vehicleRestore{id: id, action: restoreRemove, removed: len(to.Data.Readings)})
+		case to == nil:
+			plan.vehicles = append(plan.vehicles, vehicleRestore{id: id, action: restoreAdd, data: from, added: len(from.Data.Readings)})
+		default:
+			plan.vehicles = append(plan.vehicles, compareVehicle(from, to))
+		}
+	}
+	for i := range plan.vehicles {
+		if err := compareTrips(ctx, &plan.vehicles[i], srcTrips, dstTrips); err != nil {
+			return nil, err
+		}
+	}
+	if len(only) > 0 {
+		return plan, nil
+	}
+
+	srcSettings, err := src.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstSettings, err := dst.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan.settingsChanged = !reflect.DeepEqual(srcSettings, dstSettings)
+
+	srcCurrent, err := src.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstCurrent, err := dst.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if srcCurrent != "" && srcCurrent != dstCurrent {
+		if archived[srcCurrent] == nil {
+			plan.unknownCurrent = true
+		} else {
+			plan.currentFrom, plan.currentTo = dstCurrent, srcCurrent
+		}
+	}
+	return plan, nil
+}
+
+// compareVehicle counts the reading differences between the archived and
+// live copies of a vehicle.
+func compareVehicle(from, to *storage.Record) vehicleRestore {
+	v := vehicleRestore{id: from.ID, data: from}
+	for date, miles := range from.Data.Readings {
+		live, ok := to.Data.Readings[date]
+		switch {
+		case !ok:
+			v.added++
+		case live != miles:
+			v.changed++
+		}
+	}
+	for date := range to.Data.Readings {
+		if _, ok := from.Data.Readings[date]; !ok {
+			v.removed++
+		}
+	}
+	a, b := *from.Data, *to.Data
+	a.Readings, b.Readings = nil, nil
+	v.details = !reflect.DeepEqual(a, b)
+	v.action = restoreReplace
+	if v.added == 0 && v.changed == 0 && v.removed == 0 && !v.details {
+		v.action = restoreUnchanged
+	}
+	return v
+}
+
+// compareTrips records in v the archive's trips for a vehicle the restore
+// keeps, when they differ from the live ones. A vehicle that is otherwise
+// unchanged is then restored for its trips alone.
+func compareTrips(ctx context.Context, v *vehicleRestore, srcTrips, dstTrips trips.Store) error {
+	if v.action == restoreRemove {
+		return nil
+	}
+	archived, err := srcTrips.List(ctx, v.id)
+	if err != nil {
+		return fmt.Errorf("archived trips: %w", err)
+	}
+	live, err := dstTrips.List(ctx, v.id)
+	if err != nil {
+		return err
+	}
+	same, err := sameJSON(archived, live)
+	if err != nil || same {
+		return err
+	}
+	v.trips, v.tripsChanged = archived, true
+	if v.action == restoreUnchanged {
+		v.action = restoreReplace
+	}
+	return nil
+}
+
+// sameJSON reports whether a and b encode alike, which compares trips by
+// their stored form rather than by how their times were read back.
+func sameJSON(a, b []trips.Trip) (bool, error) {
+	if len(a) == 0 && len(b) == 0 {
+		return true, nil
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ja, jb), nil
+}
+
+func printRestorePlan(plan *restorePlan, w io.Writer) {
+	for _, v := range plan.vehicles {
+		switch v.action {
+		case restoreAdd:
+			fmt.Fprintf(w, "  + %s: added, %d reading(s)", v.id, v.added)
+			if len(v.trips) > 0 {
+				fmt.Fprintf(w, ", %d trip(s)", len(v.trips))
+			}
+			fmt.Fprintln(w)
+		case restoreRemove:
+			fmt.Fprintf(w, "  - %s: not in the archive, moved to the trash (%d reading(s))\n", v.id, v.removed)
+		case restoreUnchanged:
+			fmt.Fprintf(w, "  = %s: unchanged\n", v.id)
+		default:
+			var parts []string
+			for _, c := range []struct {
+				n    int
+				what string
+			}{{v.added, "added"}, {v.changed, "changed"}, {v.removed, "removed"}} {
+				if c.n > 0 {
+					parts = append(parts, fmt.Sprintf("%d reading(s) %s", c.n, c.what))
+				}
+			}
+			if v.details {
+				parts = append(parts, "details changed")
+			}
+			if v.tripsChanged {
+				parts = append(parts, "trips changed")
+			}
+			fmt.Fprintf(w, "  ~ %s: %s\n", v.id, strings.Join(parts, ", "))
+		}
+	}
+	if plan.settingsChanged {
+		fmt.Fprintln(w, "  ~ settings")
+	}
+	if plan.currentTo != "" {
+		from := plan.currentFrom
+		if from == "" {
+			from = "none"
+		}
+		fmt.Fprintf(w, "  ~ default vehicle: %s → %s\n", from, plan.currentTo)
+	}
+	if plan.unknownCurrent {
+		fmt.Fprintln(w, "  ! the archive's default vehicle is not in it; the default is left as it is")
+	}
+}
+
+// applyRestore makes plan's changes to dst from src, restoring the archived
+// photos of every vehicle it writes from srcAtt into dstAtt and its archived
+// trips, when they differ, into dstTrips. Each change is
+// its own write, so a failure part-way leaves some vehicles restored and
+// others not; the caller points at the safety backup. Removals come after
+// the writes, so at least no vehicle is trashed for a restore that failed.
+func applyRestore(ctx context.Context, plan *restorePlan, src, dst storage.Store, srcAtt, dstAtt attachments.Store, dstTrips trips.Store) error {
+	for _, v := range plan.vehicles {
+		if v.action != restoreAdd && v.action != restoreReplace {
+			continue
+		}
+		if err := dst.SaveVehicle(ctx, v.id, v.data.Data); err != nil {
+			return err
+		}
+		list, err := srcAtt.List(ctx, v.id, "")
+		if err != nil {
+			return err
+		}
+		for _, a := range list {
+			_, content, err := srcAtt.Get(ctx, v.id, a.Date, a.Hash)
+			if err != nil {
+				return err
+			}
+			if _, err := dstAtt.Put(ctx, a, content); err != nil {
+				return err
+			}
+		}
+		if v.tripsChanged {
+			if err := dstTrips.ReplaceVehicle(ctx, v.id, v.trips); err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range plan.vehicles {
+		if v.action == restoreRemove {
+			if err := dst.DeleteVehicle(ctx, v.id); err != nil {
+				return err
+			}
+		}
+	}
+	if plan.settingsChanged {
+		settings, err := src.GetSettings(ctx)
+		if err != nil {
+			return err
+		}
+		if err := dst.SaveSettings(ctx, settings); err != nil {
+			return err
+		}
+	}
+	if plan.currentTo != "" {
+		if err := dst.SetCurrent(ctx, plan.currentTo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().Bool("dry-run", false, "List what would change without changing anything")
+	restoreCmd.Flags().BoolP("yes", "y", false, "Restore without asking")
+	restoreCmd.Flags().String("safety-backup", "", "Where to archive the current data first (default ./mileminder-pre-restore-<time>.tar.gz)")
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// writeTarGz writes an archive of headers, each followed by the body at the
+// same index; entries that are not regular files get no body.
+func writeTarGz(t *testing.T, path string, headers []*tar.Header, bodies []string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for i, h := range headers {
+		h.Size = int64(len(bodies[i]))
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		if h.Typeflag != tar.TypeReg {
+			h.Size = 0
+		}
+		h.Mode = 0644
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			if _, err := tw.Write([]byte(bodies[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackBackupRejectsUnsafeEntries(t *testing.T) {
+	for name, h := range map[string]*tar.Header{
+		"traversal":    {Name: "mileminder/../evil.yml"},
+		"absolute":     {Name: "/etc/evil.yml"},
+		"outside":      {Name: "other/golf.yml"},
+		"nested":       {Name: "mileminder/nested/golf.yml"},
+		"unknown file": {Name: "mileminder/notes.txt"},
+		"symlink":      {Name: "mileminder/golf.yml", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		"bad object":   {Name: "mileminder/attachments/objects/../../golf.yml"},
+		"bad trash":    {Name: "mileminder/trash/notes.yml"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+			writeTarGz(t, archive, []*tar.Header{{Name: "mileminder/current"}, h}, []string{"golf", "vehicle: Evil\n"})
+			staged := t.TempDir()
+			if _, err := unpackBackup(archive, staged); err == nil {
+				t.Fatalf("%s accepted", h.Name)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(staged), "evil.yml")); !os.IsNotExist(err) {
+				t.Fatal("an entry escaped the staging directory")
+			}
+		})
+	}
+}
+
+func TestStageBackupRejectsUnparseableFiles(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	writeTarGz(t, archive,
+		[]*tar.Header{{Name: "mileminder/golf.yml"}, {Name: "mileminder/mini.yml"}},
+		[]string{"vehicle: Golf\nreadings:\n  \"2025-01-01\": 5000\n", "readings: [not: a map"})
+	_, _, err := stageBackup(context.Background(), archive, t.TempDir(), t.TempDir(), storeYAML)
+	if err == nil || !strings.Contains(err.Error(), "mini.yml") {
+		t.Fatalf("want an error naming mini.yml, got %v", err)
+	}
+}
+
+func TestStageBackupRejectsNewerSchema(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	writeTarGz(t, archive, []*tar.Header{{Name: "mileminder/golf.yml"}}, []string{"schema_version: 999\nvehicle: Golf\n"})
+	if _, _, err := stageBackup(context.Background(), archive, t.TempDir(), t.TempDir(), storeYAML); err == nil {
+		t.Fatal("a file from a newer schema was accepted")
+	}
+}
+
+// backupOf archives a YAML data directory holding golf (with an extra
+// reading, a photo and a trip), mini and the given default vehicle.
+func backupOf(t *testing.T, current string) string {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := yamlstore.New(dir)
+	golf := &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5400, "2025-03-01": 5800}}
+	mini := &model.VehicleData{Vehicle: "Mini", Readings: map[string]int{"2025-01-01": 100}}
+	for id, data := range map[string]*model.VehicleData{"golf": golf, "mini": mini} {
+		if err := st.SaveVehicle(ctx, id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SetCurrent(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveSettings(ctx, &model.Settings{Currency: "EUR", DistanceUnit: "km"}); err != nil {
+		t.Fatal(err)
+	}
+	photo := attachments.Attachment{VehicleID: "golf", Date: "2025-03-01", ContentType: "image/png", CreatedAt: time.Now()}
+	if _, err := attachments.NewFileStore(dir).Put(ctx, photo, []byte("\x89PNG\r\n\x1a\nphoto")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trips.NewFileStore(dir).Save(ctx, trips.Trip{VehicleID: "golf", StartDate: "2025-03-01", Distance: 42, Purpose: trips.Business}); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if _, err := writeBackup(dir, archive); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// liveStore is the data the archive is restored over: golf with one reading
+// changed and one missing, and van, which the archive does not have.
+func liveStore(t *testing.T) storage.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5500}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveVehicle(ctx, "van", &model.VehicleData{Vehicle: "Van", Readings: map[string]int{"2025-01-01": 20000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrent(ctx, "van"); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestRestoreFull(t *testing.T) {
+	ctx := context.Background()
+	archive := backupOf(t, "mini")
+	staged := t.TempDir()
+	src, _, err := stageBackup(ctx, archive, staged, t.TempDir(), storeYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, dstTrips := liveStore(t), trips.NewMemory()
+
+	plan, err := planRestore(ctx, src, dst, trips.NewFileStore(staged), dstTrips, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listing strings.Builder
+	printRestorePlan(plan, &listing)
+	for _, want := range []string{
+		"~ golf: 1 reading(s) added, 1 reading(s) changed, trips changed",
+		"+ mini: added, 1 reading(s)",
+		"- van: not in the archive, moved to the trash",
+		"~ settings",
+		"~ default vehicle: van → mini",
+	} {
+		if !strings.Contains(listing.String(), want) {
+			t.Fatalf("listing missing %q:\n%s", want, listing.String())
+		}
+	}
+
+	dstAtt := attachments.NewMemory()
+	if err := applyRestore(ctx, plan, src, dst, attachments.NewFileStore(staged), dstAtt, dstTrips); err != nil {
+		t.Fatal(err)
+	}
+	golf, err := dst.GetVehicle(ctx, "golf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(golf.Readings) != 3 || golf.Readings["2025-02-01"] != 5400 {
+		t.Fatalf("golf readings = %v", golf.Readings)
+	}
+	if _, err := dst.GetVehicle(ctx, "van"); err == nil {
+		t.Fatal("van should have been moved to the trash")
+	}
+	if trash, _ := dst.ListTrash(ctx); len(trash) != 1 || trash[0].VehicleID != "van" {
+		t.Fatalf("trash = %+v", trash)
+	}
+	if current, _ := dst.GetCurrent(ctx); current != "mini" {
+		t.Fatalf("current = %q", current)
+	}
+	if settings, _ := dst.GetSettings(ctx); settings.Currency != "EUR" {
+		t.Fatalf("settings = %+v", settings)
+	}
+	if photos, _ := dstAtt.List(ctx, "golf", "2025-03-01"); len(photos) != 1 {
+		t.Fatalf("photos = %+v", photos)
+	}
+	if restored, _ := dstTrips.List(ctx, "golf"); len(restored) != 1 || restored[0].Distance != 42 || restored[0].ID == "" {
+		t.Fatalf("trips = %+v", restored)
+	}
+
+	plan, err = planRestore(ctx, src, dst, trips.NewFileStore(staged), dstTrips, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.empty() {
+		t.Fatalf("restoring again should change nothing: %+v", plan)
+	}
+}
+
+func TestRestoreSelective(t *testing.T) {
+	ctx := context.Background()
+	archive := backupOf(t, "mini")
+	staged := t.TempDir()
+	src, _, err := stageBackup(ctx, archive, staged, t.TempDir(), storeYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, dstTrips := liveStore(t), trips.NewMemory()
+
+	if _, err := planRestore(ctx, src, dst, trips.NewFileStore(staged), dstTrips, []string{"van"}); err == nil {
+		t.Fatal("restoring a vehicle the archive lacks should fail")
+	}
+	plan, err := planRestore(ctx, src, dst, trips.NewFileStore(staged), dstTrips, []string{"mini"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRestore(ctx, plan, src, dst, attachments.NewFileStore(staged), attachments.NewMemory(), dstTrips); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.GetVehicle(ctx, "mini"); err != nil {
+		t.Fatalf("mini not restored: %v", err)
+	}
+	golf, _ := dst.GetVehicle(ctx, "golf")
+	if golf.Readings["2025-02-01"] != 5500 {
+		t.Fatal("a vehicle not asked for was restored")
+	}
+	if _, err := dst.GetVehicle(ctx, "van"); err != nil {
+		t.Fatal("a selective restore removed a vehicle")
+	}
+	if current, _ := dst.GetCurrent(ctx); current != "van" {
+		t.Fatalf("a selective restore changed the default to %q", current)
+	}
+}
@@ -1,21 +1,38 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/alerts"
 	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/attachments"
 	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/calendar"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/events"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/mqtt"
 	"github.com/jackiabishop/mileminder/internal/notify"
 	"github.com/jackiabishop/mileminder/internal/notify/smtpchannel"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/cachestore"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
 	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/trash"
+	"github.com/jackiabishop/mileminder/internal/trips"
 	"github.com/jackiabishop/mileminder/internal/web"
 	"github.com/spf13/cobra"
 )
@@ -34,12 +51,24 @@ and viewing graphs of your usage against your allowance.`,
 		addr := fmt.Sprintf(":%d", port)
 		url := fmt.Sprintf("http://localhost:%d", port)
 
+		retention, _ := cmd.Flags().GetDuration("trash-retention")
+		if retention <= 0 {
+			return fmt.Errorf("--trash-retention must be greater than 0")
+		}
+
+		// Ctrl-C or SIGTERM cancels cmd.Context(), which every background job
+		// below runs on, and shuts the server down.
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		cmd.SetContext(ctx)
+
+		bus := events.NewBus()
 		var handler http.Handler
 		var err error
 		if hostedMode(cmd) {
-			handler, err = hostedHandler(cmd, devMode, url)
+			handler, err = hostedHandler(cmd, devMode, url, retention, bus)
 		} else {
-			handler, err = singleUserHandler(devMode, url)
+			handler, err = singleUserHandler(cmd, devMode, url, retention, bus)
 		}
 		if err != nil {
 			return err
@@ -52,63 +81,210 @@ and viewing graphs of your usage against your allowance.`,
 			go openBrowser(url)
 		}
 
-		return http.ListenAndServe(addr, handler)
+		srv := &http.Server{Addr: addr, Handler: handler}
+		// Event streams never go idle, so Shutdown would wait out its whole
+		// timeout on them; closing the bus ends them first.
+		srv.RegisterOnShutdown(bus.Close)
+		shutdown := make(chan error, 1)
+		go func() {
+			<-ctx.Done()
+			timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			shutdown <- srv.Shutdown(timeout)
+		}()
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return <-shutdown
 	},
 }
 
 // singleUserHandler builds the default, no-auth handler over the local
 // ~/.mileminder store — behaviour unchanged from before Phase 2.
-func singleUserHandler(devMode bool, url string) (http.Handler, error) {
-	store, err := openStore()
+func singleUserHandler(cmd *cobra.Command, devMode bool, url string, retention time.Duration, bus *events.Bus) (http.Handler, error) {
+	publisher, err := mqttPublisher(cmd)
+	if err != nil {
+		return nil, err
+	}
+	observe := func(e journal.Entry) {
+		bus.PublishEntry("", e)
+		if publisher != nil {
+			publisher.Changed()
+		}
+	}
+	backend, err := serveStoreBackend(cmd)
+	if err != nil {
+		return nil, err
+	}
+	// Only the YAML store is watched for the CLI's changes, so only it can
+	// be cached: the watcher invalidates the cache when it sees one.
+	var cache *cachestore.Store
+	var wrap func(storage.Store) storage.Store
+	if backend == storeYAML {
+		wrap = func(st storage.Store) storage.Store {
+			cache = cachestore.Wrap(st, 0)
+			return cache
+		}
+	}
+	store, err := openObservedJournal(backend, "web", observe, wrap)
+	if err != nil {
+		return nil, err
+	}
+	if publisher != nil {
+		publisher.Store = store
+		go publisher.Run(cmd.Context())
+		fmt.Printf("   MQTT status publisher: %s (topics %s/<vehicle>/…, every %s)\n",
+			publisher.Broker, publisher.Prefix, publisher.Interval)
+	}
+	if backend == storeYAML {
+		if err := startWatcher(cmd, func(changes []yamlstore.Change) {
+			cache.Invalidate()
+			publishChanges(cmd.Context(), bus, store, changes)
+			if publisher != nil {
+				publisher.Changed()
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	files, err := openAttachments()
 	if err != nil {
 		return nil, err
 	}
+	dir, err := yamlstore.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	key, err := dirKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg := api.SingleUserConfig{
+		Store:       store,
+		Attachments: files,
+		Calendar:    calendar.NewEncryptedFileTokenStore(dir, key),
+		Trips:       trips.NewEncryptedFileStore(dir, key),
+		Ingest:      ingest.NewEncryptedFileTokenStore(dir, key),
+		Events:      bus,
+	}
+	purger := &trash.Purger{
+		Scopes: func(context.Context) ([]trash.Scope, error) {
+			return []trash.Scope{{Store: store, Trips: cfg.Trips}}, nil
+		},
+		Retention: retention,
+		Logger:    log.Default(),
+	}
+	go purger.Run(cmd.Context())
+	providers, err := connectedProviders(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) > 0 {
+		cfg.Links, cfg.Providers = connected.NewEncryptedFileLinkStore(dir, key), providers
+		if err := startPoller(cmd, cfg.Links, providers, func(string) storage.Store { return store }); err != nil {
+			return nil, err
+		}
+	}
 	if devMode {
 		fmt.Println("🔧 Development mode: API only")
 		fmt.Printf("   API server: %s/api/v1\n", url)
 		fmt.Println("   Run 'npm run dev' in the web/ directory for the frontend")
-		return api.NewRouter(store, ""), nil
+		return api.NewSingleUserRouterDir(cfg, ""), nil
 	}
 	staticFS := web.GetFS()
 	if staticFS == nil {
 		return nil, fmt.Errorf("web UI not built; run 'cd web && npm run build' first, or use --dev mode")
 	}
-	return api.NewRouterWithFS(store, staticFS), nil
+	return api.NewSingleUserRouter(cfg, staticFS), nil
 }
 
 // hostedHandler builds the multi-tenant handler: per-user YAML directories plus
 // file-backed user/session stores under the hosted data root. Auth gates every
 // data endpoint.
-func hostedHandler(cmd *cobra.Command, devMode bool, url string) (http.Handler, error) {
+func hostedHandler(cmd *cobra.Command, devMode bool, url string, retention time.Duration, bus *events.Bus) (http.Handler, error) {
 	dataDir, err := hostedDataDir(cmd)
 	if err != nil {
 		return nil, err
 	}
+	if broker, _ := cmd.Flags().GetString("mqtt-broker"); broker != "" {
+		return nil, fmt.Errorf("--mqtt-broker is single-user only: hosted mode would publish every user's vehicles to one broker")
+	}
 	baseURL := hostedBaseURL(cmd, url)
 	secure, _ := cmd.Flags().GetBool("secure-cookies")
 	channel, err := notificationChannel()
 	if err != nil {
 		return nil, err
 	}
-	alertPrefs := alerts.NewFilePrefsStore(dataDir)
-	alertState := alerts.NewFileStateStore(dataDir)
-	reminderSettings := alerts.NewFileReminderSettingsStore(dataDir)
-	reminderState := alerts.NewFileReminderStateStore(dataDir)
-	users := filestore.NewUserStore(dataDir)
-	tenants := yamlstore.NewTenants(dataDir)
+	key, err := dirKey(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	alertPrefs := alerts.NewEncryptedFilePrefsStore(dataDir, key)
+	alertState := alerts.NewEncryptedFileStateStore(dataDir, key)
+	reminderSettings := alerts.NewEncryptedFileReminderSettingsStore(dataDir, key)
+	reminderState := alerts.NewEncryptedFileReminderStateStore(dataDir, key)
+	backend, err := serveStoreBackend(cmd)
+	if err != nil {
+		return nil, err
+	}
+	vehicles, err := openTenants(backend, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	users := filestore.NewEncryptedUserStore(dataDir, key)
+	tenants := journal.NewTenants(cachestore.WrapTenants(vehicles, 0), dataDir)
+	tenants.Observer = bus.PublishEntry
+	tenants.Key = key
 	cfg := api.HostedConfig{
 		Users:         users,
-		Sessions:      filestore.NewSessionStore(dataDir),
-		Resets:        filestore.NewPasswordResetStore(dataDir),
+		Sessions:      filestore.NewEncryptedSessionStore(dataDir, key),
+		Resets:        filestore.NewEncryptedPasswordResetStore(dataDir, key),
 		Tenants:       tenants,
 		Notifier:      channel,
 		BaseURL:       baseURL,
 		AlertPrefs:    alertPrefs,
 		Reminders:     reminderSettings,
+		VehicleState:  []alerts.VehicleMover{alertState, reminderSettings, reminderState},
+		Attachments:   attachments.NewEncryptedFileTenants(dataDir, key),
+		Trips:         trips.NewEncryptedFileTenants(dataDir, key),
+		Calendar:      calendar.NewEncryptedFileTokenStore(dataDir, key),
+		Ingest:        ingest.NewEncryptedFileTokenStore(dataDir, key),
+		Events:        bus,
 		SecureCookies: secure,
 	}
 
+	providers, err := connectedProviders(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) > 0 {
+		cfg.Links, cfg.Providers = connected.NewEncryptedFileLinkStore(dataDir, key), providers
+		if err := startPoller(cmd, cfg.Links, providers, tenants.ForUser); err != nil {
+			return nil, err
+		}
+	}
+
+	purger := &trash.Purger{
+		Scopes: func(ctx context.Context) ([]trash.Scope, error) {
+			list, err := users.ListUsers(ctx)
+			if err != nil {
+				return nil, err
+			}
+			scopes := make([]trash.Scope, 0, len(list))
+			for _, u := range list {
+				scopes = append(scopes, trash.Scope{Store: tenants.ForUser(u.ID), Trips: cfg.Trips.ForUser(u.ID)})
+			}
+			return scopes, nil
+		},
+		Retention: retention,
+		Logger:    log.Default(),
+	}
+	go purger.Run(cmd.Context())
+
 	fmt.Printf("🔐 Hosted (multi-user) mode — data root: %s\n", dataDir)
+	if backend == storeSQLite {
+		fmt.Printf("   vehicle store: %s\n", filepath.Join(dataDir, sqlstore.FileName))
+	}
 	if !secure {
 		fmt.Println("   ⚠  secure cookies disabled (--secure-cookies=false); use only over plain-HTTP localhost")
 	}
@@ -131,6 +307,7 @@ func hostedHandler(cmd *cobra.Command, devMode bool, url string) (http.Handler,
 			Logger:        log.Default(),
 			Reminders:     reminderSettings,
 			ReminderState: reminderState,
+			Events:        bus,
 		}
 		go scheduler.Run(cmd.Context())
 		fmt.Printf("   alerts scheduler interval: %s\n", interval)
@@ -148,6 +325,15 @@ func hostedHandler(cmd *cobra.Command, devMode bool, url string) (http.Handler,
 	return api.NewHostedRouter(cfg, staticFS), nil
 }
 
+// serveStoreBackend is --store when set, else MILEMINDER_STORE, else YAML.
+func serveStoreBackend(cmd *cobra.Command) (string, error) {
+	if cmd.Flags().Changed("store") {
+		name, _ := cmd.Flags().GetString("store")
+		return parseStoreBackend("--store", name)
+	}
+	return storeBackend()
+}
+
 // hostedMode is true when --hosted is set or MILEMINDER_HOSTED is truthy.
 func hostedMode(cmd *cobra.Command) bool {
 	if v, _ := cmd.Flags().GetBool("hosted"); v {
@@ -208,6 +394,110 @@ func alertsInterval(cmd *cobra.Command) (time.Duration, error) {
 	return d, nil
 }
 
+// connectedProviders builds the connected-car providers the flags enable. Only
+// the file-backed fake exists so far, registered as "fake".
+func connectedProviders(cmd *cobra.Command) (connected.Registry, error) {
+	providers := connected.Registry{}
+	if path, _ := cmd.Flags().GetString("connected-fake"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("--connected-fake: %w", err)
+		}
+		providers["fake"] = connected.NewFileProvider(path)
+	}
+	return providers, nil
+}
+
+// startPoller runs the connected-car poller in the background.
+func startPoller(cmd *cobra.Command, links connected.LinkStore, providers connected.Registry, storeFor func(owner string) storage.Store) error {
+	interval, _ := cmd.Flags().GetDuration("connected-interval")
+	if interval <= 0 {
+		return fmt.Errorf("--connected-interval must be greater than 0")
+	}
+	poller := &connected.Poller{
+		Links:     links,
+		Providers: providers,
+		StoreFor:  storeFor,
+		Interval:  interval,
+		Logger:    log.Default(),
+	}
+	go poller.Run(cmd.Context())
+	fmt.Printf("   connected-car poller interval: %s (providers: %s)\n", interval, strings.Join(providers.Names(), ", "))
+	return nil
+}
+
+// startWatcher watches the single-user YAML store in the background so that
+// a vehicle changed by a CLI command in another process reaches fn — and from
+// there the server's clients — as the server's own writes do.
+func startWatcher(cmd *cobra.Command, fn func([]yamlstore.Change)) error {
+	dir, err := yamlstore.DefaultDir()
+	if err != nil {
+		return err
+	}
+	watcher := yamlstore.NewWatcher(dir)
+	watcher.Logger = log.Default()
+	go watcher.Run(cmd.Context(), func(changes []yamlstore.Change) {
+		for _, c := range changes {
+			log.Printf("store: %s changed outside the server", c.File)
+		}
+		fn(changes)
+	})
+	return nil
+}
+
+// publishChanges turns what the store watcher saw into events: each changed
+// vehicle, and the new default when the current pointer moved. A settings
+// change has no event.
+func publishChanges(ctx context.Context, bus *events.Bus, store storage.Store, changes []yamlstore.Change) {
+	for _, c := range changes {
+		id := c.VehicleID
+		if c.File == "current" && !c.Removed {
+			current, err := store.GetCurrent(ctx)
+			if err != nil {
+				log.Printf("events: read current vehicle: %v", err)
+				continue
+			}
+			id = current
+		}
+		if id == "" {
+			continue
+		}
+		if err := bus.PublishVehicle(ctx, "", store, id); err != nil {
+			log.Printf("events: vehicle %s: %v", id, err)
+		}
+	}
+}
+
+// mqttPublisher builds the MQTT status publisher the flags configure, or nil
+// when --mqtt-broker is unset. The password comes from MILEMINDER_MQTT_PASSWORD
+// rather than a flag, like the SMTP settings, so it stays out of the process
+// list.
+func mqttPublisher(cmd *cobra.Command) (*mqtt.Publisher, error) {
+	broker, _ := cmd.Flags().GetString("mqtt-broker")
+	if broker == "" {
+		return nil, nil
+	}
+	interval, _ := cmd.Flags().GetDuration("mqtt-interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("--mqtt-interval must be greater than 0")
+	}
+	username, _ := cmd.Flags().GetString("mqtt-username")
+	prefix, _ := cmd.Flags().GetString("mqtt-prefix")
+	if prefix == "" || strings.ContainsAny(prefix, "+#") {
+		return nil, fmt.Errorf("--mqtt-prefix must be a non-empty topic without wildcards")
+	}
+	return &mqtt.Publisher{
+		Broker: broker,
+		Options: mqtt.Options{
+			ClientID: "mileminder-" + strings.ReplaceAll(prefix, "/", "-"),
+			Username: username,
+			Password: os.Getenv("MILEMINDER_MQTT_PASSWORD"),
+		},
+		Prefix:   prefix,
+		Interval: interval,
+		Logger:   log.Default(),
+	}, nil
+}
+
 func notificationChannel() (notify.Channel, error) {
 	cfg, ok, err := smtpchannel.ConfigFromEnv()
 	if err != nil {
@@ -245,9 +535,17 @@ func init() {
 	serveCmd.Flags().Bool("no-browser", false, "Don't open browser automatically")
 	serveCmd.Flags().Bool("dev", false, "Development mode (API only, no static files)")
 	serveCmd.Flags().Bool("hosted", false, "Hosted multi-user mode: require login, isolate data per user (env: MILEMINDER_HOSTED)")
+	serveCmd.Flags().String("store", storeYAML, "Vehicle store backend: yaml, sqlite or events (env: MILEMINDER_STORE)")
 	serveCmd.Flags().String("data-dir", "", "Hosted-mode data root (default ~/.mileminder-hosted; env: MILEMINDER_DATA_DIR)")
 	serveCmd.Flags().String("base-url", "", "Public hosted base URL for links in emails (env: MILEMINDER_BASE_URL)")
 	serveCmd.Flags().Bool("secure-cookies", true, "Set the Secure flag on session cookies (disable only for plain-HTTP localhost testing)")
 	serveCmd.Flags().Duration("alerts-interval", time.Hour, "Hosted alert scheduler interval (env: MILEMINDER_ALERTS_INTERVAL)")
+	serveCmd.Flags().Duration("trash-retention", trash.DefaultRetention, "How long deleted vehicles and readings stay restorable before the background purge")
+	serveCmd.Flags().String("connected-fake", "", "Enable the file-backed fake connected-car provider reading this YAML file")
+	serveCmd.Flags().Duration("connected-interval", time.Hour, "How often linked vehicles' odometers are polled")
+	serveCmd.Flags().String("mqtt-broker", "", "Publish vehicle status to this MQTT broker (host:port, mqtt:// or mqtts://; single-user mode)")
+	serveCmd.Flags().String("mqtt-username", "", "MQTT user name (password from MILEMINDER_MQTT_PASSWORD)")
+	serveCmd.Flags().String("mqtt-prefix", mqtt.DefaultPrefix, "MQTT topic prefix; status goes to <prefix>/<vehicle>/<field>")
+	serveCmd.Flags().Duration("mqtt-interval", 5*time.Minute, "How often vehicle status is republished to MQTT, besides on every change")
 	serveCmd.Flags().Bool("no-alerts", false, "Disable the hosted background scheduler (allowance alerts and reading reminders)")
 }
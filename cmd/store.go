@@ -3,19 +3,148 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/journal"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
 	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
-// openStore returns the storage.Store the CLI operates against: the historical
-// YAML backend rooted at ~/.mileminder.
+// Vehicle-store backends. The CLI uses the one named by MILEMINDER_STORE;
+// serve also takes --store.
+const (
+	storeYAML   = "yaml"   // one <id>.yml file per vehicle (the default)
+	storeSQLite = "sqlite" // mileminder.db in the same directory
+	storeEvents = "events" // an append-only events.jsonl in the same directory
+)
+
+// storeBackend returns the backend named by MILEMINDER_STORE, defaulting to
+// YAML.
+func storeBackend() (string, error) {
+	return parseStoreBackend("MILEMINDER_STORE", os.Getenv("MILEMINDER_STORE"))
+}
+
+// parseStoreBackend validates a backend name, where from names its source for
+// the error.
+func parseStoreBackend(from, name string) (string, error) {
+	switch name {
+	case "", storeYAML:
+		return storeYAML, nil
+	case storeSQLite, storeEvents:
+		return name, nil
+	}
+	return "", fmt.Errorf("invalid %s %q: want %s, %s or %s", from, name, storeYAML, storeSQLite, storeEvents)
+}
+
+// openVehicles opens the backend's single-user vehicle store in dir,
+// encrypted if dir is (see 'mileminder encrypt').
+func openVehicles(backend, dir string) (storage.Store, error) {
+	key, err := dirKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case storeSQLite:
+		db, err := sqlstore.OpenEncrypted(filepath.Join(dir, sqlstore.FileName), key)
+		if err != nil {
+			return nil, err
+		}
+		return db.Local(), nil
+	case storeEvents:
+		return eventstore.NewEncrypted(dir, key), nil
+	}
+	return yamlstore.NewEncrypted(dir, key), nil
+}
+
+// openTenants opens the backend's per-user vehicle stores under a hosted data
+// root, encrypted if the root is.
+func openTenants(backend, dataDir string) (storage.Tenants, error) {
+	key, err := dirKey(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case storeSQLite:
+		return sqlstore.OpenEncrypted(filepath.Join(dataDir, sqlstore.FileName), key)
+	case storeEvents:
+		return eventstore.NewEncryptedTenants(dataDir, key), nil
+	}
+	return yamlstore.NewEncryptedTenants(dataDir, key), nil
+}
+
+// openStore returns the storage.Store the CLI operates against: the
+// MILEMINDER_STORE backend rooted at ~/.mileminder, journalled as "cli".
 func openStore() (storage.Store, error) {
+	return openJournal("cli")
+}
+
+// openJournal returns the ~/.mileminder store journalled to
+// ~/.mileminder/journal.jsonl, attributing changes to actor.
+func openJournal(actor string) (*journal.Store, error) {
+	backend, err := storeBackend()
+	if err != nil {
+		return nil, err
+	}
+	return openObservedJournal(backend, actor, nil, nil)
+}
+
+// openObservedJournal is openJournal over an explicit backend, with observe,
+// when non-nil, called for every change this process journals, and wrap, when
+// non-nil, put between the journal and the backend.
+func openObservedJournal(backend, actor string, observe func(journal.Entry), wrap func(storage.Store) storage.Store) (*journal.Store, error) {
 	dir, err := yamlstore.DefaultDir()
 	if err != nil {
 		return nil, fmt.Errorf("open store: %w", err)
 	}
-	return yamlstore.New(dir), nil
+	st, err := openVehicles(backend, dir)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	key, err := dirKey(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	if wrap != nil {
+		st = wrap(st)
+	}
+	var log journal.Log = journal.NewEncryptedFileLog(dir, key)
+	if observe != nil {
+		log = journal.Observe(log, observe)
+	}
+	return journal.Wrap(st, log, actor), nil
+}
+
+// openAttachments returns the attachment store beside the CLI's vehicle store,
+// under ~/.mileminder/attachments, encrypted if the directory is.
+func openAttachments() (attachments.Store, error) {
+	dir, err := yamlstore.DefaultDir()
+	if err != nil {
+		return nil, fmt.Errorf("open attachments: %w", err)
+	}
+	key, err := dirKey(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open attachments: %w", err)
+	}
+	return attachments.NewEncryptedFileStore(dir, key), nil
+}
+
+// openTrips returns the trip store beside the CLI's vehicle store, under
+// ~/.mileminder/trips, encrypted if the directory is.
+func openTrips() (trips.Store, error) {
+	dir, err := yamlstore.DefaultDir()
+	if err != nil {
+		return nil, fmt.Errorf("open trips: %w", err)
+	}
+	key, err := dirKey(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open trips: %w", err)
+	}
+	return trips.NewEncryptedFileStore(dir, key), nil
 }
 
 // defaultVehicleID resolves the vehicle id for commands that accept an optional
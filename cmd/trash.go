@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trash"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or purge deleted vehicles and readings",
+	Long: `Deleting a vehicle (reset) or a reading moves it to the trash instead of
+destroying it. Items stay restorable until purged, either here or by the
+retention sweep a running server performs (serve --trash-retention).`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deleted vehicles and readings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		return runTrashList(cmd.Context(), st, os.Stdout)
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <item-id>",
+	Short: "Put a deleted vehicle or reading back",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		item, err := st.RestoreTrash(cmd.Context(), args[0])
+		if errors.Is(err, storage.ErrExists) {
+			return fmt.Errorf("%w; rename or delete the current one first", err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s\n", describeTrashItem(*item))
+		return nil
+	},
+}
+
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge [item-id]",
+	Short: "Permanently delete trashed items",
+	Long: `With an item id, permanently delete that item. Without one, delete every
+item older than --retention, or everything with --all. The trips of a purged
+vehicle go with it.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if err := st.PurgeTrash(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Purged %s\n", args[0])
+			return dropOrphanTrips(cmd.Context(), st)
+		}
+
+		cutoff := time.Now()
+		if all, _ := cmd.Flags().GetBool("all"); !all {
+			retention, _ := cmd.Flags().GetDuration("retention")
+			cutoff = cutoff.Add(-retention)
+		}
+		n, err := st.PurgeTrashBefore(cmd.Context(), cutoff)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d item(s)\n", n)
+		return dropOrphanTrips(cmd.Context(), st)
+	},
+}
+
+// dropOrphanTrips deletes the trips of vehicles that are gone for good, once a
+// purge has taken them out of the trash.
+func dropOrphanTrips(ctx context.Context, st storage.Store) error {
+	tripLog, err := openTrips()
+	if err != nil {
+		return err
+	}
+	_, err = trips.DropOrphans(ctx, tripLog, st)
+	return err
+}
+
+// runTrashList prints the trash, newest first.
+func runTrashList(ctx context.Context, st storage.Store, w io.Writer) error {
+	items, err := st.ListTrash(ctx)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Fprintln(w, "Trash is empty.")
+		return nil
+	}
+	fmt.Fprintf(w, "%-16s %-17s %s\n", "ID", "Deleted", "Item")
+	for _, item := range items {
+		fmt.Fprintf(w, "%-16s %-17s %s\n", item.ID, item.DeletedAt.Local().Format("2006-01-02 15:04"), describeTrashItem(item))
+	}
+	return nil
+}
+
+func describeTrashItem(item storage.TrashItem) string {
+	if item.Kind == storage.TrashReading {
+		return fmt.Sprintf("reading %s: %d mi on %s", item.Date, item.Miles, item.VehicleID)
+	}
+	return fmt.Sprintf("vehicle %s", item.VehicleID)
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashPurgeCmd)
+	trashPurgeCmd.Flags().Duration("retention", trash.DefaultRetention, "Without an item id, purge items deleted longer ago than this")
+	trashPurgeCmd.Flags().Bool("all", false, "Without an item id, purge everything in the trash")
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunTrashList(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-01-01": 5000, "2025-02-01": 5400})
+
+	var out bytes.Buffer
+	if err := runTrashList(ctx, st, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Trash is empty") {
+		t.Fatalf("empty trash output: %q", out.String())
+	}
+
+	if err := st.DeleteReading(ctx, "golf", "2025-02-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runTrashList(ctx, st, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"reading 2025-02-01: 5400 mi on golf", "vehicle golf"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("trash list missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+var tripCmd = &cobra.Command{
+	Use:   "trip",
+	Short: "Log trips with their purpose and driver",
+	Long: `A trip records a journey: its dates, the start and end odometer (or just the
+distance), whether it was business or personal, and who drove. 'trip summary'
+totals the distance for a period with the business/personal split, e.g. for a
+mileage claim.`,
+}
+
+var tripAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Record a trip",
+	Long: `Record a trip on the --car vehicle (or the default). Give --start and --end
+odometer readings, or --distance. With --record-reading the end odometer is
+also saved as the reading for the trip's end date.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+
+		t := trips.Trip{VehicleID: carID}
+		t.StartDate, _ = cmd.Flags().GetString("date")
+		if t.StartDate == "" {
+			t.StartDate = time.Now().Format("2006-01-02")
+		}
+		t.EndDate, _ = cmd.Flags().GetString("end-date")
+		t.Distance, _ = cmd.Flags().GetInt("distance")
+		t.Purpose, _ = cmd.Flags().GetString("purpose")
+		t.Driver, _ = cmd.Flags().GetString("driver")
+		t.Notes, _ = cmd.Flags().GetString("notes")
+		if cmd.Flags().Changed("start") {
+			start, _ := cmd.Flags().GetInt("start")
+			t.StartOdometer = &start
+		}
+		if cmd.Flags().Changed("end") {
+			end, _ := cmd.Flags().GetInt("end")
+			t.EndOdometer = &end
+		}
+		record, _ := cmd.Flags().GetBool("record-reading")
+		force, _ := cmd.Flags().GetBool("force")
+
+		saved, err := runTripAdd(ctx, st, tripLog, t, record, force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Recorded %s trip %s on %s: %d mi\n", saved.Purpose, saved.ID, carID, saved.Distance)
+		return nil
+	},
+}
+
+var tripListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a vehicle's trips",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		return runTripList(ctx, tripLog, carID, os.Stdout)
+	},
+}
+
+var tripDeleteCmd = &cobra.Command{
+	Use:   "delete <trip-id>",
+	Short: "Delete a trip",
+	Long:  `Delete a trip. A reading it recorded is kept.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		if err := tripLog.Delete(ctx, carID, args[0]); err != nil {
+			if errors.Is(err, trips.ErrNotFound) {
+				return fmt.Errorf("no trip %s on %s", args[0], carID)
+			}
+			return err
+		}
+		fmt.Printf("Deleted trip %s\n", args[0])
+		return nil
+	},
+}
+
+var tripSummaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Total a vehicle's trips for a period",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		tripLog, err := openTrips()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		carFlag, _ := cmd.Flags().GetString("car")
+		carID, err := defaultVehicleID(ctx, st, carFlag)
+		if err != nil {
+			return err
+		}
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		list, err := tripLog.List(ctx, carID)
+		if err != nil {
+			return err
+		}
+		printTripSummary(os.Stdout, trips.Summarize(list, from, to))
+		return nil
+	},
+}
+
+// runTripAdd validates and saves a trip on an existing vehicle, first
+// recording its end odometer as a reading when asked.
+func runTripAdd(ctx context.Context, st storage.Store, tripLog trips.Store, t trips.Trip, record, force bool) (*trips.Trip, error) {
+	if _, err := st.GetVehicle(ctx, t.VehicleID); err != nil {
+		return nil, err
+	}
+	if err := trips.Normalize(&t); err != nil {
+		return nil, err
+	}
+	if record {
+		if t.EndOdometer == nil {
+			return nil, fmt.Errorf("--record-reading needs an end odometer (--end, or --start with --distance)")
+		}
+		if err := trips.RecordReading(ctx, st, t, force); err != nil {
+			if errors.Is(err, trips.ErrBelowMax) {
+				return nil, fmt.Errorf("%w; use --force to override", err)
+			}
+			return nil, err
+		}
+	}
+	return tripLog.Save(ctx, t)
+}
+
+// runTripList prints carID's trips by start date.
+func runTripList(ctx context.Context, tripLog trips.Store, carID string, w io.Writer) error {
+	list, err := tripLog.List(ctx, carID)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintf(w, "No trips recorded for %s.\n", carID)
+		return nil
+	}
+	fmt.Fprintf(w, "%-16s %-10s %-10s %8s  %-8s %s\n", "ID", "Start", "End", "Miles", "Purpose", "Driver")
+	for _, t := range list {
+		fmt.Fprintf(w, "%-16s %-10s %-10s %8d  %-8s %s\n", t.ID, t.StartDate, t.EndDate, t.Distance, t.Purpose, t.Driver)
+	}
+	return nil
+}
+
+func printTripSummary(w io.Writer, s trips.Summary) {
+	period := "all time"
+	if s.From != "" || s.To != "" {
+		period = fmt.Sprintf("%s to %s", openEnd(s.From), openEnd(s.To))
+	}
+	fmt.Fprintf(w, "Trips (%s): %d, %d mi\n", period, s.Trips, s.Distance)
+	fmt.Fprintf(w, "  Business: %d mi (%.0f%%)\n", s.ByPurpose[trips.Business], s.BusinessShare*100)
+	fmt.Fprintf(w, "  Personal: %d mi\n", s.ByPurpose[trips.Personal])
+	for _, driver := range slices.Sorted(maps.Keys(s.ByDriver)) {
+		if driver != "" {
+			fmt.Fprintf(w, "  Driven by %s: %d mi\n", driver, s.ByDriver[driver])
+		}
+	}
+}
+
+func openEnd(s string) string {
+	if s == "" {
+		return "…"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(tripCmd)
+	tripCmd.AddCommand(tripAddCmd, tripListCmd, tripDeleteCmd, tripSummaryCmd)
+	tripAddCmd.Flags().String("date", "", "Start date, YYYY-MM-DD (default today)")
+	tripAddCmd.Flags().String("end-date", "", "End date, YYYY-MM-DD (default the start date)")
+	tripAddCmd.Flags().Int("start", 0, "Odometer at the start")
+	tripAddCmd.Flags().Int("end", 0, "Odometer at the end")
+	tripAddCmd.Flags().Int("distance", 0, "Distance, when the odometer readings are not known")
+	tripAddCmd.Flags().String("purpose", trips.Personal, "business or personal")
+	tripAddCmd.Flags().String("driver", "", "Who drove")
+	tripAddCmd.Flags().String("notes", "", "Free-text notes")
+	tripAddCmd.Flags().Bool("record-reading", false, "Also record the end odometer as a reading")
+	tripAddCmd.Flags().Bool("force", false, "With --record-reading, allow a reading below the current max")
+	tripSummaryCmd.Flags().String("from", "", "First start date to include, YYYY-MM-DD")
+	tripSummaryCmd.Flags().String("to", "", "Last start date to include, YYYY-MM-DD")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+func TestRunTripAdd(t *testing.T) {
+	ctx := context.Background()
+	st := seedStore(t, map[string]int{"2025-06-01": 5000})
+	tripLog := trips.NewMemory()
+	start, end := 5000, 5080
+
+	if _, err := runTripAdd(ctx, st, tripLog, trips.Trip{VehicleID: "nope", StartDate: "2025-06-02", Distance: 5}, false, false); err == nil {
+		t.Fatal("trip on an unknown vehicle accepted")
+	}
+	saved, err := runTripAdd(ctx, st, tripLog, trips.Trip{VehicleID: "golf", StartDate: "2025-06-02", StartOdometer: &start, EndOdometer: &end, Purpose: trips.Business}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Distance != 80 {
+		t.Fatalf("saved: %+v", saved)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-06-02"] != 5080 {
+		t.Fatalf("end odometer not recorded: %v", data.Readings)
+	}
+
+	low := 4000
+	if _, err := runTripAdd(ctx, st, tripLog, trips.Trip{VehicleID: "golf", StartDate: "2025-06-03", EndOdometer: &low, Distance: 10}, true, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("want below-max error, got %v", err)
+	}
+	if list, _ := tripLog.List(ctx, "golf"); len(list) != 1 {
+		t.Fatalf("refused trip was saved: %+v", list)
+	}
+
+	var out bytes.Buffer
+	if err := runTripList(ctx, tripLog, "golf", &out); err != nil || !strings.Contains(out.String(), saved.ID) {
+		t.Fatalf("list = %q, %v", out.String(), err)
+	}
+}
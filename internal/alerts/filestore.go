@@ -8,13 +8,15 @@ import (
 	"sort"
 	"sync"
 
-	"github.com/jackiabishop/mileminder/internal/atomicfile"
 	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
 )
 
 // FileStateStore persists alert state in <root>/alerts_state.yml.
 type FileStateStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -22,12 +24,26 @@ func NewFileStateStore(root string) *FileStateStore {
 	return &FileStateStore{path: filepath.Join(root, "alerts_state.yml")}
 }
 
+// NewEncryptedFileStateStore is NewFileStateStore sealed with key, the data
+// root's encryption key, or plain for a nil key.
+func NewEncryptedFileStateStore(root string, key *crypt.Key) *FileStateStore {
+	return &FileStateStore{path: filepath.Join(root, "alerts_state.yml"), key: key}
+}
+
+// Convert re-seals the file from one key to another, reporting whether it
+// needed it (see crypt.ConvertFile).
+func (s *FileStateStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
 type stateDoc struct {
 	States []VehicleAlertState `yaml:"states"`
 }
 
 func (s *FileStateStore) load() ([]VehicleAlertState, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -51,14 +67,11 @@ func (s *FileStateStore) save(states []VehicleAlertState) error {
 		}
 		return states[i].UserID < states[j].UserID
 	})
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(stateDoc{States: states}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	raw, err := yaml.Marshal(stateDoc{States: states})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func (s *FileStateStore) GetState(ctx context.Context, userID, vehicleID string) (*VehicleAlertState, error) {
@@ -122,9 +135,24 @@ func (s *FileStateStore) PruneUserStates(ctx context.Context, userID string, kee
 	return s.save(out)
 }
 
+func (s *FileStateStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return err
+	}
+	states, changed := moveEntry(states, func(e *VehicleAlertState) (string, *string) { return e.UserID, &e.VehicleID }, userID, fromID, toID)
+	if !changed {
+		return nil
+	}
+	return s.save(states)
+}
+
 // FilePrefsStore persists alert preferences in <root>/alert_prefs.yml.
 type FilePrefsStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -132,12 +160,26 @@ func NewFilePrefsStore(root string) *FilePrefsStore {
 	return &FilePrefsStore{path: filepath.Join(root, "alert_prefs.yml")}
 }
 
+// NewEncryptedFilePrefsStore is NewFilePrefsStore sealed with key, the data
+// root's encryption key, or plain for a nil key.
+func NewEncryptedFilePrefsStore(root string, key *crypt.Key) *FilePrefsStore {
+	return &FilePrefsStore{path: filepath.Join(root, "alert_prefs.yml"), key: key}
+}
+
+// Convert re-seals the file from one key to another, reporting whether it
+// needed it (see crypt.ConvertFile).
+func (s *FilePrefsStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
 type prefsDoc struct {
 	Prefs []Prefs `yaml:"prefs"`
 }
 
 func (s *FilePrefsStore) load() ([]Prefs, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -156,14 +198,11 @@ func (s *FilePrefsStore) save(prefs []Prefs) error {
 		return fmt.Errorf("create data dir: %w", err)
 	}
 	sort.Slice(prefs, func(i, j int) bool { return prefs[i].UserID < prefs[j].UserID })
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(prefsDoc{Prefs: prefs}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	raw, err := yaml.Marshal(prefsDoc{Prefs: prefs})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func (s *FilePrefsStore) GetPrefs(ctx context.Context, userID string) (*Prefs, error) {
@@ -213,4 +252,5 @@ var (
 	_ StateStore        = (*FileStateStore)(nil)
 	_ PruningStateStore = (*FileStateStore)(nil)
 	_ PrefsStore        = (*FilePrefsStore)(nil)
+	_ VehicleMover      = (*FileStateStore)(nil)
 )
@@ -37,6 +37,34 @@ func TestFileStateStoreRoundTripAndPrune(t *testing.T) {
 	}
 }
 
+func TestStateStoreMoveUserVehicle(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]interface {
+		StateStore
+		VehicleMover
+	}{
+		"memory": NewMemoryStateStore(),
+		"file":   NewFileStateStore(t.TempDir()),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := store.PutState(ctx, VehicleAlertState{UserID: "u1", VehicleID: "tesla", Breached: true}); err != nil {
+				t.Fatalf("PutState: %v", err)
+			}
+			if err := store.MoveUserVehicle(ctx, "u1", "tesla", "model3"); err != nil {
+				t.Fatalf("MoveUserVehicle: %v", err)
+			}
+			if _, err := store.GetState(ctx, "u1", "tesla"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("old id after move: want ErrNotFound, got %v", err)
+			}
+			got, err := store.GetState(ctx, "u1", "model3")
+			if err != nil || !got.Breached || got.VehicleID != "model3" {
+				t.Fatalf("moved state: got %+v err %v", got, err)
+			}
+		})
+	}
+}
+
 func TestFilePrefsStoreRoundTrip(t *testing.T) {
 	ctx := context.Background()
 	st := NewFilePrefsStore(t.TempDir())
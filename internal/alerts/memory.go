@@ -57,6 +57,21 @@ func (m *MemoryStateStore) PruneUserStates(ctx context.Context, userID string, k
 	return nil
 }
 
+func (m *MemoryStateStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.states[stateKey(userID, fromID)]
+	if !ok {
+		return nil
+	}
+	delete(m.states, stateKey(userID, fromID))
+	if _, taken := m.states[stateKey(userID, toID)]; !taken {
+		e.VehicleID = toID
+		m.states[stateKey(userID, toID)] = e
+	}
+	return nil
+}
+
 // Snapshot returns states sorted by user then vehicle for tests.
 func (m *MemoryStateStore) Snapshot() []VehicleAlertState {
 	m.mu.Lock()
@@ -112,4 +127,5 @@ var (
 	_ StateStore        = (*MemoryStateStore)(nil)
 	_ PruningStateStore = (*MemoryStateStore)(nil)
 	_ PrefsStore        = (*MemoryPrefsStore)(nil)
+	_ VehicleMover      = (*MemoryStateStore)(nil)
 )
@@ -8,14 +8,16 @@ import (
 	"sort"
 	"sync"
 
-	"github.com/jackiabishop/mileminder/internal/atomicfile"
 	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
 )
 
 // FileReminderSettingsStore persists reminder settings in
 // <root>/reminder_settings.yml.
 type FileReminderSettingsStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -23,12 +25,26 @@ func NewFileReminderSettingsStore(root string) *FileReminderSettingsStore {
 	return &FileReminderSettingsStore{path: filepath.Join(root, "reminder_settings.yml")}
 }
 
+// NewEncryptedFileReminderSettingsStore is NewFileReminderSettingsStore
+// sealed with key, the data root's encryption key, or plain for a nil key.
+func NewEncryptedFileReminderSettingsStore(root string, key *crypt.Key) *FileReminderSettingsStore {
+	return &FileReminderSettingsStore{path: filepath.Join(root, "reminder_settings.yml"), key: key}
+}
+
+// Convert re-seals the file from one key to another, reporting whether it
+// needed it (see crypt.ConvertFile).
+func (s *FileReminderSettingsStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
 type reminderSettingsDoc struct {
 	Reminders []ReminderSettings `yaml:"reminders"`
 }
 
 func (s *FileReminderSettingsStore) load() ([]ReminderSettings, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -52,14 +68,11 @@ func (s *FileReminderSettingsStore) save(reminders []ReminderSettings) error {
 		}
 		return reminders[i].UserID < reminders[j].UserID
 	})
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(reminderSettingsDoc{Reminders: reminders}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	raw, err := yaml.Marshal(reminderSettingsDoc{Reminders: reminders})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func (s *FileReminderSettingsStore) GetReminder(ctx context.Context, userID, vehicleID string) (*ReminderSettings, error) {
@@ -126,10 +139,25 @@ func (s *FileReminderSettingsStore) PruneUserReminders(ctx context.Context, user
 	return s.save(out)
 }
 
+func (s *FileReminderSettingsStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminders, err := s.load()
+	if err != nil {
+		return err
+	}
+	reminders, changed := moveEntry(reminders, func(e *ReminderSettings) (string, *string) { return e.UserID, &e.VehicleID }, userID, fromID, toID)
+	if !changed {
+		return nil
+	}
+	return s.save(reminders)
+}
+
 // FileReminderStateStore persists reminder send state in
 // <root>/reminder_state.yml.
 type FileReminderStateStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -137,12 +165,26 @@ func NewFileReminderStateStore(root string) *FileReminderStateStore {
 	return &FileReminderStateStore{path: filepath.Join(root, "reminder_state.yml")}
 }
 
+// NewEncryptedFileReminderStateStore is NewFileReminderStateStore sealed with
+// key, the data root's encryption key, or plain for a nil key.
+func NewEncryptedFileReminderStateStore(root string, key *crypt.Key) *FileReminderStateStore {
+	return &FileReminderStateStore{path: filepath.Join(root, "reminder_state.yml"), key: key}
+}
+
+// Convert re-seals the file from one key to another, reporting whether it
+// needed it (see crypt.ConvertFile).
+func (s *FileReminderStateStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
 type reminderStateDoc struct {
 	States []VehicleReminderState `yaml:"states"`
 }
 
 func (s *FileReminderStateStore) load() ([]VehicleReminderState, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -166,14 +208,11 @@ func (s *FileReminderStateStore) save(states []VehicleReminderState) error {
 		}
 		return states[i].UserID < states[j].UserID
 	})
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(reminderStateDoc{States: states}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	raw, err := yaml.Marshal(reminderStateDoc{States: states})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func (s *FileReminderStateStore) GetReminderState(ctx context.Context, userID, vehicleID string) (*VehicleReminderState, error) {
@@ -237,7 +276,23 @@ func (s *FileReminderStateStore) PruneUserReminderStates(ctx context.Context, us
 	return s.save(out)
 }
 
+func (s *FileReminderStateStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return err
+	}
+	states, changed := moveEntry(states, func(e *VehicleReminderState) (string, *string) { return e.UserID, &e.VehicleID }, userID, fromID, toID)
+	if !changed {
+		return nil
+	}
+	return s.save(states)
+}
+
 var (
 	_ ReminderSettingsStore = (*FileReminderSettingsStore)(nil)
 	_ ReminderStateStore    = (*FileReminderStateStore)(nil)
+	_ VehicleMover          = (*FileReminderSettingsStore)(nil)
+	_ VehicleMover          = (*FileReminderStateStore)(nil)
 )
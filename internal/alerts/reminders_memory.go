@@ -56,6 +56,21 @@ func (m *MemoryReminderSettingsStore) PruneUserReminders(ctx context.Context, us
 	return nil
 }
 
+func (m *MemoryReminderSettingsStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.reminders[stateKey(userID, fromID)]
+	if !ok {
+		return nil
+	}
+	delete(m.reminders, stateKey(userID, fromID))
+	if _, taken := m.reminders[stateKey(userID, toID)]; !taken {
+		e.VehicleID = toID
+		m.reminders[stateKey(userID, toID)] = e
+	}
+	return nil
+}
+
 // MemoryReminderStateStore is an in-memory ReminderStateStore for tests.
 type MemoryReminderStateStore struct {
 	mu     sync.Mutex
@@ -102,6 +117,21 @@ func (m *MemoryReminderStateStore) PruneUserReminderStates(ctx context.Context,
 	return nil
 }
 
+func (m *MemoryReminderStateStore) MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.states[stateKey(userID, fromID)]
+	if !ok {
+		return nil
+	}
+	delete(m.states, stateKey(userID, fromID))
+	if _, taken := m.states[stateKey(userID, toID)]; !taken {
+		e.VehicleID = toID
+		m.states[stateKey(userID, toID)] = e
+	}
+	return nil
+}
+
 // Snapshot returns states sorted by user then vehicle for tests.
 func (m *MemoryReminderStateStore) Snapshot() []VehicleReminderState {
 	m.mu.Lock()
@@ -122,4 +152,6 @@ func (m *MemoryReminderStateStore) Snapshot() []VehicleReminderState {
 var (
 	_ ReminderSettingsStore = (*MemoryReminderSettingsStore)(nil)
 	_ ReminderStateStore    = (*MemoryReminderStateStore)(nil)
+	_ VehicleMover          = (*MemoryReminderSettingsStore)(nil)
+	_ VehicleMover          = (*MemoryReminderStateStore)(nil)
 )
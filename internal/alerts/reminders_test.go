@@ -153,6 +153,54 @@ func TestReminderSettingsStorePrune(t *testing.T) {
 	}
 }
 
+func TestReminderSettingsStoreMove(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range reminderSettingsStores(t) {
+		t.Run(name, func(t *testing.T) {
+			put := func(user, id, freq string) {
+				t.Helper()
+				if err := store.PutReminder(ctx, ReminderSettings{UserID: user, VehicleID: id, Enabled: true, Frequency: freq}); err != nil {
+					t.Fatalf("PutReminder %s/%s: %v", user, id, err)
+				}
+			}
+			put("u1", "tesla", FrequencyDaily)
+			put("u1", "golf", FrequencyWeekly)
+			put("u1", "polo", FrequencyQuarterly)
+			put("u2", "tesla", FrequencyWeekly)
+			mover := store.(VehicleMover)
+
+			// Rename: the settings follow the vehicle.
+			if err := mover.MoveUserVehicle(ctx, "u1", "tesla", "model3"); err != nil {
+				t.Fatalf("MoveUserVehicle: %v", err)
+			}
+			if _, err := store.GetReminder(ctx, "u1", "tesla"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("old id after move: want ErrNotFound, got %v", err)
+			}
+			if got, err := store.GetReminder(ctx, "u1", "model3"); err != nil || got.Frequency != FrequencyDaily {
+				t.Fatalf("moved settings: got %+v err %v", got, err)
+			}
+			if got, err := store.GetReminder(ctx, "u2", "tesla"); err != nil || got.Frequency != FrequencyWeekly {
+				t.Fatalf("other user's settings moved: got %+v err %v", got, err)
+			}
+
+			// Merge: the target's own settings win and the source's are dropped.
+			if err := mover.MoveUserVehicle(ctx, "u1", "golf", "polo"); err != nil {
+				t.Fatalf("MoveUserVehicle onto existing: %v", err)
+			}
+			if _, err := store.GetReminder(ctx, "u1", "golf"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("source after merge move: want ErrNotFound, got %v", err)
+			}
+			if got, err := store.GetReminder(ctx, "u1", "polo"); err != nil || got.Frequency != FrequencyQuarterly {
+				t.Fatalf("target settings replaced: got %+v err %v", got, err)
+			}
+
+			if err := mover.MoveUserVehicle(ctx, "u1", "ghost", "spirit"); err != nil {
+				t.Fatalf("moving absent settings: want nil, got %v", err)
+			}
+		})
+	}
+}
+
 func TestFileReminderStorePersistsAcrossReopen(t *testing.T) {
 	ctx := context.Background()
 	dir := t.TempDir()
@@ -8,6 +8,7 @@ import (
 
 	"github.com/jackiabishop/mileminder/internal/auth"
 	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/events"
 	"github.com/jackiabishop/mileminder/internal/notify"
 	"github.com/jackiabishop/mileminder/internal/storage"
 )
@@ -29,6 +30,10 @@ type Scheduler struct {
 	// default) disables reminders entirely, leaving breach alerting unchanged.
 	Reminders     ReminderSettingsStore
 	ReminderState ReminderStateStore
+
+	// Events, when set, is sent each vehicle's status as the sweep computes
+	// it, so open dashboards follow a status that changes with the date alone.
+	Events *events.Bus
 }
 
 // Run executes RunOnce immediately, then on Interval until ctx is cancelled.
@@ -92,6 +97,7 @@ func (s *Scheduler) runUser(ctx context.Context, u *auth.User) {
 		}
 		// Status is the single source of truth for both passes; compute it once.
 		status := calc.ComputeStatusAt(rec.ID, rec.Data, now)
+		s.Events.Publish(u.ID, events.StatusEvent(status))
 		if prefs.Enabled {
 			s.runVehicle(ctx, u, prefs, rec, status, now)
 		}
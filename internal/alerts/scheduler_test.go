@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/events"
 	"github.com/jackiabishop/mileminder/internal/model"
 	"github.com/jackiabishop/mileminder/internal/notify"
 	"github.com/jackiabishop/mileminder/internal/storage"
@@ -96,6 +97,28 @@ func TestRunOnceSilentFirstRunBaseline(t *testing.T) {
 	}
 }
 
+func TestRunOncePublishesStatuses(t *testing.T) {
+	ctx := context.Background()
+	f := newSchedulerFixture(t)
+	if err := f.tenants.ForUser(f.user.ID).SaveVehicle(ctx, "golf", policyVehicle(5000)); err != nil {
+		t.Fatalf("SaveVehicle: %v", err)
+	}
+	f.sched.Events = events.NewBus()
+	sub, _ := f.sched.Events.Subscribe(f.user.ID, "")
+	defer sub.Close()
+
+	f.sched.RunOnce(ctx)
+
+	select {
+	case e := <-sub.C:
+		if e.Type != events.StatusRecomputed || e.Status == nil || e.Status.LatestReading != 5000 {
+			t.Fatalf("event = %+v", e)
+		}
+	default:
+		t.Fatal("no status published")
+	}
+}
+
 func TestRunOnceCrossingSendsOnce(t *testing.T) {
 	ctx := context.Background()
 	f := newSchedulerFixture(t)
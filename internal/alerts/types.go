@@ -30,6 +30,44 @@ type PruningStateStore interface {
 	PruneUserStates(ctx context.Context, userID string, keepVehicleIDs []string) error
 }
 
+// VehicleMover is implemented by every store holding per-vehicle state, so the
+// state can follow a vehicle when it is renamed or merged into another.
+type VehicleMover interface {
+	// MoveUserVehicle re-keys userID's entry for fromID to toID. When toID
+	// already has an entry it is kept and fromID's is dropped: after a merge the
+	// surviving vehicle's own configuration wins. No entry for fromID is not an
+	// error.
+	MoveUserVehicle(ctx context.Context, userID, fromID, toID string) error
+}
+
+// moveEntry applies the MoveUserVehicle rule to a file store's entries. ids
+// exposes an entry's user id and a pointer to its vehicle id. It reports
+// whether anything changed, so an untouched file is not rewritten.
+func moveEntry[T any](entries []T, ids func(*T) (string, *string), userID, fromID, toID string) ([]T, bool) {
+	from, taken := -1, false
+	for i := range entries {
+		user, vehicle := ids(&entries[i])
+		if user != userID {
+			continue
+		}
+		switch *vehicle {
+		case fromID:
+			from = i
+		case toID:
+			taken = true
+		}
+	}
+	if from < 0 {
+		return entries, false
+	}
+	if taken {
+		return append(entries[:from], entries[from+1:]...), true
+	}
+	_, vehicle := ids(&entries[from])
+	*vehicle = toID
+	return entries, true
+}
+
 // Prefs stores a user's alert settings.
 type Prefs struct {
 	UserID    string  `yaml:"user_id" json:"user_id"`
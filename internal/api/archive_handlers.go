@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/archive"
+)
+
+// maxArchiveBytes caps an archive upload. A vehicle with a reading every day
+// for decades is well under a megabyte of JSON.
+const maxArchiveBytes = 4 << 20
+
+// HandleExportArchive downloads the vehicle's full archive: profile, plan and
+// every reading in one versioned JSON document that HandleImportArchive (or
+// `mileminder import --archive`) can load into another install or account.
+func (s *Server) HandleExportArchive(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "vehicle ID required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s_archive.json", id))
+	archive.Encode(w, archive.New(id, data, time.Now()))
+}
+
+// HandleImportArchive loads a vehicle archive. The vehicle keeps the archive's
+// id unless ?id= names another. When the id is taken, ?on_conflict= decides:
+// fail (the default, 409), rename to the first free "<id>-N", or merge the
+// readings into the existing vehicle, where ?overwrite=true and ?force=true
+// behave as they do for CSV import.
+func (s *Server) HandleImportArchive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := archive.Options{
+		ID:         q.Get("id"),
+		OnConflict: q.Get("on_conflict"),
+		Overwrite:  q.Get("overwrite") == "true",
+		Force:      q.Get("force") == "true",
+	}
+	if err := opts.Validate(); err != nil {
+		writeValidationError(w, "invalid_import_options", err.Error())
+		return
+	}
+	doc, err := archive.Decode(http.MaxBytesReader(w, r.Body, maxArchiveBytes))
+	if err != nil {
+		writeValidationError(w, "invalid_archive", err.Error())
+		return
+	}
+
+	result, err := archive.Import(r.Context(), storeFrom(r.Context()), doc, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, archive.ErrConflict):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(apiErrorResponse{
+			Error: apiError{
+				Code:    "vehicle_already_exists",
+				Message: "vehicle already exists; set on_conflict=rename or on_conflict=merge",
+			},
+		})
+		return
+	case errors.Is(err, archive.ErrNotMonotonic):
+		writeValidationError(w, "not_monotonic", err.Error()+"; set force=true to override")
+		return
+	default:
+		writeStoreError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if result.Merged {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
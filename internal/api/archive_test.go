@@ -0,0 +1,101 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+// An archive exported from one install imports into another as the same
+// vehicle: profile, plan and readings.
+func TestArchiveExportImportRoundTrip(t *testing.T) {
+	source := sampleVehicle()
+	source.Registration = "AB12 CDE"
+	source.Readings["2025-02-01"] = 5400
+	srcSrv, _ := newTestServer(t, map[string]*model.VehicleData{"golf": source})
+
+	resp, err := http.Get(srcSrv.URL + "/api/v1/vehicles/golf/archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export: want 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	dstSrv, dst := newTestServer(t, nil)
+	resp, err = http.Post(dstSrv.URL+"/api/v1/archive", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("import: want 201, got %d: %s", resp.StatusCode, b)
+	}
+	got, err := dst.GetVehicle(context.Background(), "golf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, source) {
+		t.Fatalf("imported = %+v, want %+v", got, source)
+	}
+
+	// A second import collides: 409 by default, renamed on request.
+	resp2, err := http.Post(dstSrv.URL+"/api/v1/archive", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusConflict {
+		t.Fatalf("collision: want 409, got %d", resp2.StatusCode)
+	}
+	resp3, err := http.Post(dstSrv.URL+"/api/v1/archive?on_conflict=rename", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp3.Body.Close()
+	var result struct {
+		ID      string `json:"id"`
+		Created bool   `json:"created"`
+	}
+	json.NewDecoder(resp3.Body).Decode(&result)
+	if resp3.StatusCode != http.StatusCreated || result.ID != "golf-2" {
+		t.Fatalf("rename: got %d %+v", resp3.StatusCode, result)
+	}
+}
+
+func TestArchiveImportRejectsBadInput(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+
+	tests := []struct {
+		query, body, wantCode string
+	}{
+		{"", `{"format":"nope"}`, "invalid_archive"},
+		{"?on_conflict=replace", `{}`, "invalid_import_options"},
+		{"?id=../etc", `{}`, "invalid_import_options"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(srv.URL+"/api/v1/archive"+tt.query, "application/json", bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || body.Error.Code != tt.wantCode {
+			t.Fatalf("%s: want 400 %s, got %d %+v", tt.query, tt.wantCode, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/attachments"
+)
+
+// attachmentAPI serves evidence attachments on readings. Attachments live
+// outside the vehicle document, so the handlers resolve their own store per
+// request: the process-wide one in single-user mode, the session user's in
+// hosted mode. storeFor is chosen by the router, keeping the handlers mode-blind.
+type attachmentAPI struct {
+	storeFor func(ctx context.Context) attachments.Store
+}
+
+// registerAttachmentRoutes wires the attachment endpoints behind the same mode
+// middleware as the data routes.
+func registerAttachmentRoutes(mux *http.ServeMux, a *attachmentAPI, data middleware) {
+	d := func(h http.HandlerFunc) http.Handler { return data(h) }
+	mux.Handle("POST /api/v1/vehicles/{id}/readings/{date}/attachments", d(a.HandlePostAttachment))
+	mux.Handle("GET /api/v1/vehicles/{id}/readings/{date}/attachments", d(a.HandleListAttachments))
+	mux.Handle("GET /api/v1/vehicles/{id}/readings/{date}/attachments/{hash}", d(a.HandleGetAttachment))
+	mux.Handle("DELETE /api/v1/vehicles/{id}/readings/{date}/attachments/{hash}", d(a.HandleDeleteAttachment))
+}
+
+// requireVehicleDate validates the path and confirms the vehicle exists in the
+// caller's scoped store, so attachments cannot be parked against ids the user
+// does not own. needReading additionally requires a reading on that date
+// (uploads); listing and deleting only need the vehicle, so evidence left
+// behind by a since-deleted reading can still be cleaned up.
+func (a *attachmentAPI) requireVehicleDate(w http.ResponseWriter, r *http.Request, needReading bool) (id, date string, ok bool) {
+	id, date = r.PathValue("id"), r.PathValue("date")
+	if id == "" || date == "" {
+		http.Error(w, "vehicle ID and date required", http.StatusBadRequest)
+		return "", "", false
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeValidationError(w, "invalid_date", "date must be a YYYY-MM-DD date")
+		return "", "", false
+	}
+	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return "", "", false
+	}
+	if needReading {
+		if _, exists := data.Readings[date]; !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return "", "", false
+		}
+	}
+	return id, date, true
+}
+
+// writeAttachmentError maps an attachment-store error onto a response, as
+// writeStoreError does for the vehicle store.
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, attachments.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// HandlePostAttachment attaches the raw request body (a JPEG, PNG or WebP
+// photo, sniffed server-side) to a reading. An optional ?filename= is kept as
+// display metadata only.
+func (a *attachmentAPI) HandlePostAttachment(w http.ResponseWriter, r *http.Request) {
+	id, date, ok := a.requireVehicleDate(w, r, true)
+	if !ok {
+		return
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, attachments.MaxSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(apiErrorResponse{
+				Error: apiError{Code: "attachment_too_large", Message: attachments.ErrTooLarge.Error()},
+			})
+			return
+		}
+		writeValidationError(w, "invalid_body", err.Error())
+		return
+	}
+	contentType, err := attachments.Sniff(content)
+	if err != nil {
+		writeValidationError(w, "unsupported_attachment", err.Error())
+		return
+	}
+
+	att, err := a.storeFor(r.Context()).Put(r.Context(), attachments.Attachment{
+		VehicleID:   id,
+		Date:        date,
+		ContentType: contentType,
+		Filename:    cleanFilename(r.URL.Query().Get("filename")),
+	}, content)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(att)
+}
+
+// HandleListAttachments returns the attachment metadata on one reading.
+func (a *attachmentAPI) HandleListAttachments(w http.ResponseWriter, r *http.Request) {
+	id, date, ok := a.requireVehicleDate(w, r, false)
+	if !ok {
+		return
+	}
+	list, err := a.storeFor(r.Context()).List(r.Context(), id, date)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetAttachment streams one attachment's content. The stored, sniffed
+// content type is served with nosniff so the browser cannot reinterpret it.
+func (a *attachmentAPI) HandleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	id, date, ok := a.requireVehicleDate(w, r, false)
+	if !ok {
+		return
+	}
+	att, content, err := a.storeFor(r.Context()).Get(r.Context(), id, date, r.PathValue("hash"))
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if att.Filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", att.Filename))
+	}
+	w.Write(content)
+}
+
+// HandleDeleteAttachment detaches one attachment from a reading.
+func (a *attachmentAPI) HandleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id, date, ok := a.requireVehicleDate(w, r, false)
+	if !ok {
+		return
+	}
+	if err := a.storeFor(r.Context()).Delete(r.Context(), id, date, r.PathValue("hash")); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// cleanFilename reduces a client-supplied name to a bare, quote-free base name
+// so it is safe to echo back in Content-Disposition.
+func cleanFilename(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" {
+		return ""
+	}
+	name = path.Base(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// pngPhoto is the smallest body the server sniffs as image/png.
+var pngPhoto = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 16)...)
+
+func newAttachmentServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(t.Context(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{
+		Store:       st,
+		Attachments: attachments.NewMemory(),
+	}, ""))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, method, url string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAttachmentLifecycle(t *testing.T) {
+	srv := newAttachmentServer(t)
+	base := srv.URL + "/api/v1/vehicles/golf/readings/2025-01-01/attachments"
+
+	resp := do(t, http.MethodPost, base+"?filename=../dash.png", pngPhoto)
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("upload: want 201, got %d (%s)", resp.StatusCode, b)
+	}
+	var att attachments.Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&att); err != nil {
+		t.Fatal(err)
+	}
+	if att.ContentType != "image/png" || att.Filename != "dash.png" || att.Hash == "" {
+		t.Fatalf("unexpected attachment: %+v", att)
+	}
+
+	resp = do(t, http.MethodGet, base, nil)
+	var list []attachments.Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Hash != att.Hash {
+		t.Fatalf("list: %+v", list)
+	}
+
+	resp = do(t, http.MethodGet, base+"/"+att.Hash, nil)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, pngPhoto) {
+		t.Fatalf("download: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "image/png" {
+		t.Fatalf("download content type: %q", got)
+	}
+
+	if resp := do(t, http.MethodDelete, base+"/"+att.Hash, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: want 200, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodGet, base+"/"+att.Hash, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("get after delete: want 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAttachmentValidation(t *testing.T) {
+	srv := newAttachmentServer(t)
+	vehicle := srv.URL + "/api/v1/vehicles/golf/readings/"
+
+	tests := []struct {
+		name string
+		url  string
+		body []byte
+		want int
+	}{
+		{"no reading on date", vehicle + "2025-02-01/attachments", pngPhoto, http.StatusNotFound},
+		{"bad date", vehicle + "yesterday/attachments", pngPhoto, http.StatusBadRequest},
+		{"missing vehicle", srv.URL + "/api/v1/vehicles/ghost/readings/2025-01-01/attachments", pngPhoto, http.StatusNotFound},
+		{"not an image", vehicle + "2025-01-01/attachments", []byte("hello, world"), http.StatusBadRequest},
+		{"too large", vehicle + "2025-01-01/attachments", append(pngPhoto, make([]byte, attachments.MaxSize)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := do(t, http.MethodPost, tt.url, tt.body); resp.StatusCode != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// Attachment routes are opt-in: the plain single-user router does not serve them.
+func TestAttachmentRoutesOptional(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+	resp := do(t, http.MethodGet, srv.URL+"/api/v1/vehicles/golf/readings/2025-01-01/attachments", nil)
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("attachment routes registered without an attachment store")
+	}
+}
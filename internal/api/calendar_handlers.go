@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/calendar"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+// calendarAPI serves the iCalendar subscription feed and its token. Calendar
+// apps cannot log in, so the feed route is open and the secret token in its
+// path is the credential; issuing and revoking the token sit behind the mode
+// middleware like any data route. Each token belongs to an owner — the session
+// user in hosted mode, storage.LocalOwner in single-user mode — and storeFor
+// resolves an owner to the vehicles the feed renders.
+type calendarAPI struct {
+	tokens    tokenstore.Store
+	storeFor  func(owner string) storage.Store
+	reminders alerts.ReminderSettingsStore // nil: no reminder events
+	baseURL   string                       // "" derives the feed URL from the request
+}
+
+// registerCalendarRoutes wires the feed (open) and token management (data).
+func registerCalendarRoutes(mux *http.ServeMux, a *calendarAPI, data middleware) {
+	mux.HandleFunc("GET /api/v1/calendar/{token}/feed.ics", a.HandleFeed)
+	mux.Handle("GET /api/v1/calendar", data(http.HandlerFunc(a.HandleGetCalendar)))
+	mux.Handle("POST /api/v1/calendar/token", data(http.HandlerFunc(a.HandleIssueToken)))
+	mux.Handle("DELETE /api/v1/calendar/token", data(http.HandlerFunc(a.HandleRevokeToken)))
+}
+
+// HandleGetCalendar reports whether a feed token exists. The token itself is
+// only ever returned when issued.
+func (a *calendarAPI) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	tok, err := a.tokens.Get(r.Context(), ownerFrom(r.Context()), "")
+	resp := struct {
+		Subscribed bool       `json:"subscribed"`
+		CreatedAt  *time.Time `json:"created_at,omitempty"`
+	}{}
+	switch {
+	case err == nil:
+		resp.Subscribed, resp.CreatedAt = true, &tok.CreatedAt
+	case errors.Is(err, tokenstore.ErrNotFound):
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleIssueToken creates the feed token, or rotates it — invalidating the old
+// feed URL — when one exists, and returns the subscription URL.
+func (a *calendarAPI) HandleIssueToken(w http.ResponseWriter, r *http.Request) {
+	token, tokenHash, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tok := tokenstore.Token{Owner: ownerFrom(r.Context()), TokenHash: tokenHash, CreatedAt: time.Now().UTC()}
+	if err := a.tokens.Put(r.Context(), tok); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":      token,
+		"url":        a.feedURL(r, token),
+		"created_at": tok.CreatedAt,
+	})
+}
+
+// HandleRevokeToken deletes the feed token; subscribed calendars stop updating.
+func (a *calendarAPI) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := a.tokens.Delete(r.Context(), ownerFrom(r.Context()), "")
+	if errors.Is(err, tokenstore.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+}
+
+// HandleFeed renders the owner's calendar fresh on every fetch. Unknown and
+// revoked tokens are indistinguishable 404s.
+func (a *calendarAPI) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	tok, err := a.tokens.Resolve(r.Context(), auth.HashToken(r.PathValue("token")))
+	if errors.Is(err, tokenstore.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	owner := tok.Owner
+
+	records, err := a.storeFor(owner).ListVehicles(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	vehicles := make([]calendar.Vehicle, 0, len(records))
+	for _, rec := range records {
+		v := calendar.Vehicle{ID: rec.ID, Data: rec.Data}
+		if a.reminders != nil {
+			settings, err := a.reminders.GetReminder(r.Context(), owner, rec.ID)
+			if err != nil && !errors.Is(err, alerts.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			v.Reminder = settings
+		}
+		vehicles = append(vehicles, v)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Disposition", "inline; filename=mileminder.ics")
+	w.Write(calendar.Feed(vehicles, time.Now()))
+}
+
+// feedURL is the absolute subscription URL for token: under the configured
+// public base URL when there is one, otherwise the host the request came in on.
+func (a *calendarAPI) feedURL(r *http.Request, token string) string {
+	base := strings.TrimSuffix(a.baseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/api/v1/calendar/" + token + "/feed.ics"
+}
@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/calendar"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// issueFeed issues (or rotates) the calendar token through client and returns
+// the subscription URL.
+func issueFeed(t *testing.T, client *http.Client, base string) string {
+	t.Helper()
+	resp, err := client.Post(base+"/api/v1/calendar/token", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issue token: want 201, got %d", resp.StatusCode)
+	}
+	var out struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.URL
+}
+
+func fetchFeed(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestCalendarFeedSingleUser(t *testing.T) {
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Calendar: calendar.NewMemoryTokenStore()}, ""))
+	t.Cleanup(srv.Close)
+
+	url := issueFeed(t, http.DefaultClient, srv.URL)
+	if !strings.HasPrefix(url, srv.URL+"/api/v1/calendar/") {
+		t.Fatalf("feed url %q not on the request host", url)
+	}
+	code, body := fetchFeed(t, url)
+	if code != http.StatusOK || !strings.Contains(body, "UID:plan-end-golf-20280101@mileminder") {
+		t.Fatalf("feed: %d\n%s", code, body)
+	}
+
+	// Rotating invalidates the old URL; revoking invalidates the new one.
+	rotated := issueFeed(t, http.DefaultClient, srv.URL)
+	if code, _ := fetchFeed(t, url); code != http.StatusNotFound {
+		t.Fatalf("old url after rotation: want 404, got %d", code)
+	}
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/v1/calendar/token", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: want 200, got %d", resp.StatusCode)
+	}
+	if code, _ := fetchFeed(t, rotated); code != http.StatusNotFound {
+		t.Fatalf("revoked url: want 404, got %d", code)
+	}
+}
+
+func TestCalendarFeedHosted(t *testing.T) {
+	tokens := calendar.NewMemoryTokenStore()
+	f := newHostedServer(t, func(cfg *api.HostedConfig) { cfg.Calendar = tokens })
+
+	alice := newClient(t)
+	signup(t, f.srv, alice, "alice@example.com", "correct horse battery")
+	createVehicle(t, f.srv, alice, "golf")
+	bob := newClient(t)
+	signup(t, f.srv, bob, "bob@example.com", "correct horse battery")
+	createVehicle(t, f.srv, bob, "polo")
+
+	// Token management needs a session.
+	resp, err := http.Post(f.srv.URL+"/api/v1/calendar/token", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous issue: want 401, got %d", resp.StatusCode)
+	}
+
+	aliceID := ""
+	users, _ := f.users.ListUsers(context.Background())
+	for _, u := range users {
+		if u.Email == "alice@example.com" {
+			aliceID = u.ID
+		}
+	}
+	if err := f.reminders.PutReminder(context.Background(), alerts.ReminderSettings{
+		UserID: aliceID, VehicleID: "golf", Enabled: true, Frequency: alerts.FrequencyWeekly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	url := issueFeed(t, alice, f.srv.URL)
+	if !strings.HasPrefix(url, "https://mileminder.example/api/v1/calendar/") {
+		t.Fatalf("feed url %q should use the public base URL", url)
+	}
+	path := strings.TrimPrefix(url, "https://mileminder.example")
+	code, body := fetchFeed(t, f.srv.URL+path)
+	if code != http.StatusOK {
+		t.Fatalf("feed: want 200, got %d", code)
+	}
+	if !strings.Contains(body, "-golf") || !strings.Contains(body, "reading-reminder-golf") {
+		t.Fatalf("alice's feed missing her events:\n%s", body)
+	}
+	if strings.Contains(body, "polo") {
+		t.Fatalf("alice's feed leaks bob's vehicle:\n%s", body)
+	}
+}
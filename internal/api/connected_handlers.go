@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/connected"
+)
+
+// connectedAPI links vehicles to connected-car providers. Links belong to an
+// owner — the session user in hosted mode, storage.LocalOwner in single-user
+// mode — and the poller reads them from the same LinkStore.
+type connectedAPI struct {
+	links     connected.LinkStore
+	providers connected.Registry
+}
+
+// registerConnectedRoutes wires provider discovery and vehicle links behind
+// the mode middleware.
+func registerConnectedRoutes(mux *http.ServeMux, a *connectedAPI, data middleware) {
+	d := func(h http.HandlerFunc) http.Handler { return data(h) }
+	mux.Handle("GET /api/v1/connected/providers", d(a.HandleListProviders))
+	mux.Handle("POST /api/v1/connected/providers/{provider}/vehicles", d(a.HandleListRemoteVehicles))
+	mux.Handle("GET /api/v1/vehicles/{id}/connection", d(a.HandleGetConnection))
+	mux.Handle("PUT /api/v1/vehicles/{id}/connection", d(a.HandlePutConnection))
+	mux.Handle("DELETE /api/v1/vehicles/{id}/connection", d(a.HandleDeleteConnection))
+	mux.Handle("POST /api/v1/vehicles/{id}/connection/poll", d(a.HandlePollConnection))
+}
+
+// writeConnectedError maps link and provider errors onto responses.
+func writeConnectedError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, connected.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, connected.ErrUnauthorised):
+		writeValidationError(w, "unauthorised", err.Error())
+	default:
+		writeStoreError(w, err)
+	}
+}
+
+// provider resolves the named provider, writing a 400 for an unknown one.
+func (a *connectedAPI) provider(w http.ResponseWriter, name string) (connected.Provider, bool) {
+	p, ok := a.providers[name]
+	if !ok {
+		writeValidationError(w, "unknown_provider", "no provider called "+name+" is configured")
+	}
+	return p, ok
+}
+
+// HandleListProviders lists the configured provider names.
+func (a *connectedAPI) HandleListProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.providers.Names())
+}
+
+// HandleListRemoteVehicles lists the vehicles on a provider account, given the
+// credential as {"credential": "..."}, so a client can offer the one to link.
+func (a *connectedAPI) HandleListRemoteVehicles(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.provider(w, r.PathValue("provider"))
+	if !ok {
+		return
+	}
+	var req struct {
+		Credential string `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+	token, err := p.Authorise(r.Context(), req.Credential)
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	vehicles, err := p.Vehicles(r.Context(), token)
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicles)
+}
+
+// HandleGetConnection returns a vehicle's link and the outcome of its last
+// poll, or 404 when it is not linked.
+func (a *connectedAPI) HandleGetConnection(w http.ResponseWriter, r *http.Request) {
+	l, err := a.links.Get(r.Context(), ownerFrom(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// HandlePutConnection links a vehicle, replacing any existing link, from
+// {"provider", "credential", "remote_id"}. The credential is authorised and
+// remote_id checked against the account before anything is saved.
+func (a *connectedAPI) HandlePutConnection(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := storeFrom(r.Context()).GetVehicle(r.Context(), id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	var req struct {
+		Provider   string `json:"provider"`
+		Credential string `json:"credential"`
+		RemoteID   string `json:"remote_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+	p, ok := a.provider(w, req.Provider)
+	if !ok {
+		return
+	}
+	token, err := p.Authorise(r.Context(), req.Credential)
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	vehicles, err := p.Vehicles(r.Context(), token)
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	found := false
+	for _, v := range vehicles {
+		found = found || v.ID == req.RemoteID
+	}
+	if !found {
+		writeValidationError(w, "unknown_remote_vehicle", "the account has no vehicle "+req.RemoteID)
+		return
+	}
+
+	l := connected.Link{
+		Owner:     ownerFrom(r.Context()),
+		VehicleID: id,
+		Provider:  req.Provider,
+		RemoteID:  req.RemoteID,
+		Token:     token,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.links.Put(r.Context(), l); err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// HandleDeleteConnection unlinks a vehicle. Readings already captured stay.
+func (a *connectedAPI) HandleDeleteConnection(w http.ResponseWriter, r *http.Request) {
+	if err := a.links.Delete(r.Context(), ownerFrom(r.Context()), r.PathValue("id")); err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePollConnection polls a linked vehicle now rather than waiting for the
+// poller. A failed poll is not an HTTP error: the link comes back with
+// last_error set, exactly as the poller would have left it.
+func (a *connectedAPI) HandlePollConnection(w http.ResponseWriter, r *http.Request) {
+	l, err := a.links.Get(r.Context(), ownerFrom(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	p, ok := a.provider(w, l.Provider)
+	if !ok {
+		return
+	}
+	connected.Poll(r.Context(), storeFrom(r.Context()), p, l, time.Now())
+	if err := a.links.RecordPoll(r.Context(), *l); err != nil {
+		writeConnectedError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func TestConnectedLinkAndPoll(t *testing.T) {
+	fake := filepath.Join(t.TempDir(), "fake.yml")
+	os.WriteFile(fake, []byte("credential: letmein\nvehicles:\n  - id: VIN1\n    name: Golf\n    odometer: 5200\n"), 0600)
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	links := connected.NewMemoryLinkStore()
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{
+		Store:     st,
+		Links:     links,
+		Providers: connected.Registry{"fake": connected.NewFileProvider(fake)},
+	}, ""))
+	t.Cleanup(srv.Close)
+	conn := srv.URL + "/api/v1/vehicles/golf/connection"
+
+	raw := expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/connected/providers/fake/vehicles", `{"credential":"letmein"}`, http.StatusOK)
+	var remote []connected.RemoteVehicle
+	if err := json.Unmarshal([]byte(raw), &remote); err != nil || len(remote) != 1 || remote[0].ID != "VIN1" {
+		t.Fatalf("remote vehicles: %s", raw)
+	}
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/connected/providers/fake/vehicles", `{"credential":"nope"}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/connected/providers/tesla/vehicles", `{"credential":"letmein"}`, http.StatusBadRequest)
+
+	if resp := do(t, http.MethodGet, conn, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unlinked: want 404, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, conn, []byte(`{"provider":"fake","credential":"letmein","remote_id":"VIN2"}`)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown remote id: want 400, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, srv.URL+"/api/v1/vehicles/nope/connection", []byte(`{"provider":"fake","credential":"letmein","remote_id":"VIN1"}`)); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown vehicle: want 404, got %d", resp.StatusCode)
+	}
+	resp := do(t, http.MethodPut, conn, []byte(`{"provider":"fake","credential":"letmein","remote_id":"VIN1"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("link: want 200, got %d", resp.StatusCode)
+	}
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	if _, leaked := body["token"]; leaked || body["remote_id"] != "VIN1" {
+		t.Fatalf("link body: %v", body)
+	}
+
+	raw = expectStatus(t, http.DefaultClient, conn+"/poll", "", http.StatusOK)
+	var l connected.Link
+	json.Unmarshal([]byte(raw), &l)
+	if l.LastMiles != 5200 || l.LastError != "" {
+		t.Fatalf("poll: %s", raw)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings[l.LastDate] != 5200 {
+		t.Fatalf("reading not captured: %v", data.Readings)
+	}
+
+	// The link follows a rename.
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/golf/rename", `{"id":"gti"}`, http.StatusOK)
+	if _, err := links.Get(context.Background(), storage.LocalOwner, "gti"); err != nil {
+		t.Fatalf("link not carried by rename: %v", err)
+	}
+
+	if resp := do(t, http.MethodDelete, srv.URL+"/api/v1/vehicles/gti/connection", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unlink: want 204, got %d", resp.StatusCode)
+	}
+}
@@ -47,6 +47,15 @@ func userIDFrom(ctx context.Context) string {
 	return id
 }
 
+// ownerFrom is the owner key for the request's tokens and connected-car
+// links: the session user, or storage.LocalOwner in single-user mode.
+func ownerFrom(ctx context.Context) string {
+	if id := userIDFrom(ctx); id != "" {
+		return id
+	}
+	return storage.LocalOwner
+}
+
 // tokenHashFrom returns the current session's token hash (for logout).
 func tokenHashFrom(ctx context.Context) string {
 	h, _ := ctx.Value(tokenHashKey).(string)
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/events"
+)
+
+const (
+	// eventsHeartbeat is how often an idle stream sends a comment line, so
+	// proxies do not time it out and a dead client is noticed.
+	eventsHeartbeat = 25 * time.Second
+	// eventsMaxAge bounds one stream. The client reconnects, resuming from
+	// its last event, and in hosted mode passes the session check again — so
+	// a stream does not outlive a logout or an expired session by long.
+	eventsMaxAge = 15 * time.Minute
+	// eventsRetry is the reconnect delay the stream asks clients to use.
+	eventsRetry = 3 * time.Second
+)
+
+// eventsAPI serves the live-update stream: a Server-Sent Events feed of the
+// request's user's changes from the bus. The user is "" in single-user mode.
+type eventsAPI struct {
+	bus *events.Bus
+}
+
+// registerEventRoutes wires the event stream behind the same mode middleware
+// as the data routes.
+func registerEventRoutes(mux *http.ServeMux, a *eventsAPI, data middleware) {
+	mux.Handle("GET /api/v1/events", data(http.HandlerFunc(a.HandleEvents)))
+}
+
+// HandleEvents streams events until the client goes away, the stream reaches
+// its maximum age, the client falls too far behind, or the server shuts down
+// (which closes the bus). A client reconnecting with Last-Event-ID is first
+// sent what it missed.
+func (a *eventsAPI) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// A server-wide write timeout would cut every stream short.
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	sub, missed := a.bus.Subscribe(userIDFrom(r.Context()), r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	expire := time.NewTimer(eventsMaxAge)
+	defer expire.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expire.C:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes one event in the text/event-stream format.
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
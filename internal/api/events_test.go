@@ -0,0 +1,174 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/events"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// sseEvent is one parsed text/event-stream event.
+type sseEvent struct {
+	id, event string
+	data      map[string]any
+}
+
+// openStream GETs the event stream through client, resuming from lastID when
+// it is set, and returns a func reading the next event.
+func openStream(t *testing.T, client *http.Client, url, lastID string) func() sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/v1/events", nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	return func() sseEvent {
+		t.Helper()
+		var e sseEvent
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatal("stream ended")
+				}
+				field, value, _ := strings.Cut(line, ": ")
+				switch field {
+				case "id":
+					e.id = value
+				case "event":
+					e.event = value
+				case "data":
+					if err := json.Unmarshal([]byte(value), &e.data); err != nil {
+						t.Fatal(err)
+					}
+				case "":
+					if e.event != "" {
+						return e
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no event")
+			}
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	bus := events.NewBus()
+	st := journal.Wrap(storage.NewMemory(), journal.Observe(journal.NewMemoryLog(), func(e journal.Entry) {
+		bus.PublishEntry("", e)
+	}), "web")
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Events: bus}, ""))
+	t.Cleanup(srv.Close)
+
+	next := openStream(t, http.DefaultClient, srv.URL, "")
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/golf/readings", `{"date":"2025-06-01","miles":9000}`, http.StatusOK)
+	added := next()
+	if added.event != events.ReadingAdded || added.data["vehicle_id"] != "golf" || added.data["miles"] != 9000.0 {
+		t.Fatalf("first event: %+v", added)
+	}
+	status := next()
+	if status.event != events.StatusRecomputed || status.data["status"].(map[string]any)["latest_reading"] != 9000.0 {
+		t.Fatalf("second event: %+v", status)
+	}
+
+	// Changes made while disconnected are replayed on reconnect.
+	if resp := do(t, http.MethodDelete, srv.URL+"/api/v1/vehicles/golf/readings/2025-06-01", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete reading: %d", resp.StatusCode)
+	}
+	resumed := openStream(t, http.DefaultClient, srv.URL, added.id)
+	if e := resumed(); e.event != events.StatusRecomputed || e.id != status.id {
+		t.Fatalf("resumed first: %+v", e)
+	}
+	if e := resumed(); e.event != events.ReadingDeleted || e.data["date"] != "2025-06-01" {
+		t.Fatalf("resumed second: %+v", e)
+	}
+	if e := openStream(t, http.DefaultClient, srv.URL, "12")(); e.event != events.Resync {
+		t.Fatalf("stale Last-Event-ID: %+v", e)
+	}
+}
+
+func TestEventStreamEndsOnShutdown(t *testing.T) {
+	bus := events.NewBus()
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: storage.NewMemory(), Events: bus}, ""))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+		}
+	}()
+	bus.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after the bus closed")
+	}
+}
+
+func TestHostedEventStreamIsPerUser(t *testing.T) {
+	bus := events.NewBus()
+	f := newHostedServer(t, func(cfg *api.HostedConfig) { cfg.Events = bus })
+	if resp := do(t, http.MethodGet, f.srv.URL+"/api/v1/events", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous stream: want 401, got %d", resp.StatusCode)
+	}
+
+	alice := newClient(t)
+	signup(t, f.srv, alice, "alice@example.com", "password123")
+	bob := newClient(t)
+	signup(t, f.srv, bob, "bob@example.com", "password123")
+	ids := map[string]string{}
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		u, err := f.users.GetUserByEmail(context.Background(), email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[email] = u.ID
+	}
+
+	next := openStream(t, alice, f.srv.URL, "")
+	openStream(t, bob, f.srv.URL, "")
+	bus.Publish(ids["bob@example.com"], events.Event{Type: events.VehicleChanged, VehicleID: "bobs"})
+	bus.Publish(ids["alice@example.com"], events.Event{Type: events.VehicleChanged, VehicleID: "alices"})
+	if e := next(); e.data["vehicle_id"] != "alices" {
+		t.Fatalf("alice got %+v", e)
+	}
+}
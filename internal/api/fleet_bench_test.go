@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/cachestore"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+// benchFleetSize is the fleet the benchmarks load: a large hosted account.
+const benchFleetSize = 500
+
+// seedFleet saves benchFleetSize vehicles, each with two years of weekly
+// readings, into st.
+func seedFleet(b *testing.B, st storage.Store) {
+	b.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range benchFleetSize {
+		data := &model.VehicleData{
+			Vehicle: fmt.Sprintf("Car %d", i),
+			Plan: &model.Plan{
+				Start:           start,
+				End:             start.AddDate(3, 0, 0),
+				AnnualAllowance: 10000,
+				StartMiles:      1000,
+				ExcessRate:      8,
+			},
+			Readings: map[string]int{},
+		}
+		for week := range 104 {
+			data.Readings[start.AddDate(0, 0, 7*week).Format("2006-01-02")] = 1000 + week*(150+i%50)
+		}
+		if err := st.SaveVehicle(context.Background(), fmt.Sprintf("car-%03d", i), data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEndpoint(b *testing.B, st storage.Store, path string) {
+	seedFleet(b, st)
+	h := api.NewRouter(st, "")
+	get := func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("GET %s: %d %s", path, rec.Code, rec.Body)
+		}
+	}
+	get() // warm whatever the store caches, as a running server would be
+	for b.Loop() {
+		get()
+	}
+}
+
+// The fleet endpoint re-reads and re-parses every file and recomputes every
+// status on each request; behind the cache it does neither.
+func BenchmarkFleetYAML(b *testing.B) {
+	benchmarkEndpoint(b, yamlstore.New(b.TempDir()), "/api/v1/fleet")
+}
+
+func BenchmarkFleetYAMLCached(b *testing.B) {
+	benchmarkEndpoint(b, cachestore.Wrap(yamlstore.New(b.TempDir()), 0), "/api/v1/fleet")
+}
+
+func BenchmarkVehicleListYAML(b *testing.B) {
+	benchmarkEndpoint(b, yamlstore.New(b.TempDir()), "/api/v1/vehicles")
+}
+
+func BenchmarkVehicleListYAMLCached(b *testing.B) {
+	benchmarkEndpoint(b, cachestore.Wrap(yamlstore.New(b.TempDir()), 0), "/api/v1/vehicles")
+}
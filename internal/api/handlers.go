@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,9 +14,12 @@ import (
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/journal"
 	"github.com/jackiabishop/mileminder/internal/model"
 	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/report"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
 // Server holds the HTTP layer's handler methods. The storage.Store is no longer
@@ -22,7 +27,11 @@ import (
 // request context (see middleware.go, storeFrom), so the same handlers serve
 // both the single-user store and a hosted user's scoped store without knowing
 // which. Handlers read it with storeFrom(r.Context()).
-type Server struct{}
+type Server struct {
+	// tripsFor, when set, returns the trips kept beside the request's store,
+	// so purging a vehicle from the trash drops its trips too.
+	tripsFor func(ctx context.Context) trips.Store
+}
 
 // NewServer returns a Server.
 func NewServer() *Server {
@@ -134,7 +143,7 @@ type VehicleProfilePlan struct {
 
 // HandleListVehicles returns all vehicles
 func (s *Server) HandleListVehicles(w http.ResponseWriter, r *http.Request) {
-	records, err := storeFrom(r.Context()).ListVehicles(r.Context())
+	summaries, err := storeFrom(r.Context()).ListVehicleSummaries(r.Context())
 	if err != nil {
 		writeStoreError(w, err)
 		return
@@ -147,12 +156,12 @@ func (s *Server) HandleListVehicles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vehicles := []VehicleListItem{}
-	for _, rec := range records {
+	for _, sum := range summaries {
 		vehicles = append(vehicles, VehicleListItem{
-			ID:           rec.ID,
-			Vehicle:      rec.Data.Vehicle,
-			Registration: rec.Data.Registration,
-			IsDefault:    rec.ID == defaultID,
+			ID:           sum.ID,
+			Vehicle:      sum.Vehicle,
+			Registration: sum.Registration,
+			IsDefault:    sum.ID == defaultID,
 		})
 	}
 
@@ -188,8 +197,8 @@ func (s *Server) HandleGetVehicle(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleExportProfile exports vehicle identity and allowance-plan metadata for
-// account migration. It intentionally excludes readings/history; that data
-// round-trips through the CSV import/export endpoints.
+// account migration. It intentionally excludes readings/history; the full
+// vehicle round-trips through HandleExportArchive and HandleImportArchive.
 func (s *Server) HandleExportProfile(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
@@ -438,19 +447,25 @@ func (s *Server) HandleAddReading(w http.ResponseWriter, r *http.Request) {
 		req.Date = time.Now().Format("2006-01-02")
 	}
 
-	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), id)
-	if err != nil {
-		writeStoreError(w, err)
-		return
-	}
-
-	// Validate against max existing reading (shared rule, per-surface message).
-	if max, below := readings.BelowMax(data.Readings, req.Miles); below && !req.Force {
-		http.Error(w, fmt.Sprintf("new reading %d is less than existing max %d; set force=true to override", req.Miles, max), http.StatusBadRequest)
+	// Validate against max existing reading (shared rule, per-surface
+	// message), under the same lock as the write.
+	var refused string
+	err := storeFrom(r.Context()).UpdateVehicle(r.Context(), id, func(data *model.VehicleData) error {
+		if max, below := readings.BelowMax(data.Readings, data.OdometerChanges, req.Date, req.Miles); below && !req.Force {
+			refused = fmt.Sprintf("new reading %d is less than existing max %d; record an odometer change if the odometer was replaced or rolled over, or set force=true to override", req.Miles, max)
+			return errors.New(refused)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[req.Date] = req.Miles
+		return nil
+	})
+	if refused != "" {
+		http.Error(w, refused, http.StatusBadRequest)
 		return
 	}
-
-	if err := storeFrom(r.Context()).PutReading(r.Context(), id, req.Date, req.Miles); err != nil {
+	if err != nil {
 		writeStoreError(w, err)
 		return
 	}
@@ -489,7 +504,7 @@ func (s *Server) HandleGetReadings(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(readings)
 }
 
-// HandleDeleteReading deletes a reading for a specific date
+// HandleDeleteReading moves the reading for a specific date to the trash
 func (s *Server) HandleDeleteReading(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	date := r.PathValue("date")
@@ -521,8 +536,10 @@ func (s *Server) HandleGetGraphData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dates := make([]string, 0, len(data.Readings))
-	for d := range data.Readings {
+	// Measured on one scale across any odometer change.
+	odometer := readings.Continuous(data.Readings, data.OdometerChanges)
+	dates := make([]string, 0, len(odometer))
+	for d := range odometer {
 		dates = append(dates, d)
 	}
 	sort.Strings(dates)
@@ -531,14 +548,14 @@ func (s *Server) HandleGetGraphData(w http.ResponseWriter, r *http.Request) {
 	ideals := []float64{}
 	baseMiles := 0.0
 	if data.Plan != nil {
-		baseMiles = float64(data.Plan.StartMiles)
+		baseMiles = float64(calc.StartMiles(data))
 	} else if len(dates) > 0 {
-		baseMiles = float64(data.Readings[dates[0]])
+		baseMiles = float64(odometer[dates[0]])
 	}
 
 	for _, ds := range dates {
 		t, _ := time.Parse("2006-01-02", ds)
-		miles := float64(data.Readings[ds]) - baseMiles
+		miles := float64(odometer[ds]) - baseMiles
 		actuals = append(actuals, miles)
 		if data.Plan != nil {
 			ideals = append(ideals, calc.AllowanceMiles(data.Plan.AnnualAllowance, data.Plan.Start, t))
@@ -646,7 +663,7 @@ func (s *Server) HandleSetCurrent(w http.ResponseWriter, r *http.Request) {
 
 // HandleFleet returns status for all vehicles
 func (s *Server) HandleFleet(w http.ResponseWriter, r *http.Request) {
-	records, err := storeFrom(r.Context()).ListVehicles(r.Context())
+	statuses, err := fleetStatuses(r.Context(), storeFrom(r.Context()), time.Now())
 	if err != nil {
 		writeStoreError(w, err)
 		return
@@ -661,9 +678,8 @@ func (s *Server) HandleFleet(w http.ResponseWriter, r *http.Request) {
 	// Always serialise an empty array (not null) for Vehicles so the shape is
 	// stable for clients.
 	fleet := []VehicleStatus{}
-	for _, rec := range records {
-		status := calc.ComputeStatus(rec.ID, rec.Data)
-		status.IsDefault = rec.ID == defaultID
+	for _, status := range statuses {
+		status.IsDefault = status.ID == defaultID
 		fleet = append(fleet, status)
 	}
 
@@ -676,6 +692,33 @@ func (s *Server) HandleFleet(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// statusCache is a Store that keeps computed statuses (cachestore.Store).
+type statusCache interface {
+	Statuses(ctx context.Context, now time.Time) ([]calc.Status, error)
+}
+
+// fleetStatuses returns every vehicle's status as of now, from the store's
+// status cache when it has one — looking through the journal, which wraps
+// it — and otherwise computed afresh.
+func fleetStatuses(ctx context.Context, st storage.Store, now time.Time) ([]calc.Status, error) {
+	inner := st
+	if j, ok := inner.(*journal.Store); ok {
+		inner = j.Store
+	}
+	if c, ok := inner.(statusCache); ok {
+		return c.Statuses(ctx, now)
+	}
+	records, err := st.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]calc.Status, 0, len(records))
+	for _, rec := range records {
+		statuses = append(statuses, calc.ComputeStatusAt(rec.ID, rec.Data, now))
+	}
+	return statuses, nil
+}
+
 // maxImportBytes caps the import request body. Years of daily readings is
 // ~20 KB, so 1 MB is generous while still bounding hosted-mode uploads.
 const maxImportBytes = 1 << 20
@@ -684,50 +727,106 @@ const maxImportBytes = 1 << 20
 // HandleExportCSV writes (round-trip guarantee). All-or-nothing: any invalid
 // row rejects the whole file with every error line-numbered. Existing dates
 // are skipped unless ?overwrite=true; the merged set must be monotonic by
-// date unless ?force=true. One SaveVehicle write keeps the import atomic.
+// date unless ?force=true. One UpdateVehicle write keeps the import atomic.
+//
+// Other apps' exports are read through a readings.Mapping chosen with
+// ?preset= and/or ?date_column=, ?distance_column=, ?date_format=, ?unit= and
+// ?decimal_comma=true; they go through the same merge and monotonic rules, and
+// the response's not_imported lists their other columns. ?format=obd reads an
+// OBD-II logger's CSV instead (readings.ParseOBD), a distance-since-cleared
+// log counting on from the last reading before it.
 func (s *Server) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "vehicle ID required", http.StatusBadRequest)
 		return
 	}
-	overwrite := r.URL.Query().Get("overwrite") == "true"
-	force := r.URL.Query().Get("force") == "true"
-
-	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), id)
+	q := r.URL.Query()
+	overwrite := q.Get("overwrite") == "true"
+	force := q.Get("force") == "true"
+	mapping, err := readings.ResolveMapping(q.Get("preset"), readings.Mapping{
+		DateColumn:     q.Get("date_column"),
+		DistanceColumn: q.Get("distance_column"),
+		DateFormat:     q.Get("date_format"),
+		Unit:           q.Get("unit"),
+		DecimalComma:   q.Get("decimal_comma") == "true",
+	})
 	if err != nil {
-		writeStoreError(w, err)
+		writeValidationError(w, "invalid_mapping", err.Error())
+		return
+	}
+	var obd bool
+	switch q.Get("format") {
+	case "", "csv":
+	case "obd":
+		obd = true
+	default:
+		writeValidationError(w, "invalid_format", `format must be "csv" or "obd"`)
 		return
 	}
 
-	rows, rowErrs := readings.ParseCSV(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	var rows []readings.Reading
+	var unused []string
+	var log *readings.OBDLog
+	var rowErrs []readings.RowError
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	switch {
+	case obd:
+		log, rowErrs = readings.ParseOBD(body)
+	case mapping != nil:
+		rows, unused, rowErrs = mapping.ParseUnused(body)
+	default:
+		rows, rowErrs = readings.ParseCSV(body)
+	}
 	if len(rowErrs) > 0 {
 		writeValidationErrorDetails(w, "invalid_csv",
 			fmt.Sprintf("CSV has %d invalid row(s); nothing was imported", len(rowErrs)), rowErrs)
 		return
 	}
 
-	merged, report := readings.Merge(data.Readings, rows, overwrite)
-	if !force {
-		if err := readings.CheckMonotonic(merged); err != nil {
-			writeValidationError(w, "not_monotonic", err.Error()+"; set force=true to override")
-			return
+	// The merge and its checks run under the store's write lock, against the
+	// readings the import is saved over.
+	var report readings.Report
+	var code, message string
+	err = storeFrom(r.Context()).UpdateVehicle(r.Context(), id, func(data *model.VehicleData) error {
+		if log != nil {
+			var err error
+			if rows, err = log.Readings(data.Readings, data.OdometerChanges); err != nil {
+				code, message = "no_base_reading", err.Error()
+				return err
+			}
+		}
+		var merged map[string]int
+		merged, report = readings.Merge(data.Readings, rows, overwrite)
+		if !force {
+			if err := readings.CheckMonotonic(merged, data.OdometerChanges); err != nil {
+				code, message = "not_monotonic", err.Error()+"; set force=true to override"
+				return err
+			}
 		}
+		data.Readings = merged
+		return nil
+	})
+	if code != "" {
+		writeValidationError(w, code, message)
+		return
 	}
-
-	data.Readings = merged
-	if err := storeFrom(r.Context()).SaveVehicle(r.Context(), id, data); err != nil {
+	if err != nil {
 		writeStoreError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"status":      "imported",
 		"added":       report.Added,
 		"skipped":     report.Skipped,
 		"overwritten": report.Overwritten,
-	})
+	}
+	if len(unused) > 0 {
+		resp["not_imported"] = unused
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 // HandleExportCSV exports readings as CSV
@@ -760,3 +859,53 @@ func (s *Server) HandleExportCSV(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "%s,%d\n", r.Date, r.Miles)
 	}
 }
+
+// xlsxContentType is the registered media type for .xlsx workbooks.
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// HandleExportXLSX exports one vehicle as a workbook: its readings, a monthly
+// summary and its status (see report.Workbook).
+func (s *Server) HandleExportXLSX(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "vehicle ID required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeWorkbook(w, fmt.Sprintf("%s_mileage.xlsx", id), []report.Vehicle{{ID: id, Data: data}})
+}
+
+// HandleExportFleetXLSX exports every vehicle in one workbook, same layout as
+// HandleExportXLSX.
+func (s *Server) HandleExportFleetXLSX(w http.ResponseWriter, r *http.Request) {
+	records, err := storeFrom(r.Context()).ListVehicles(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	vehicles := make([]report.Vehicle, 0, len(records))
+	for _, rec := range records {
+		vehicles = append(vehicles, report.Vehicle{ID: rec.ID, Data: rec.Data})
+	}
+	writeWorkbook(w, "fleet_mileage.xlsx", vehicles)
+}
+
+// writeWorkbook renders to a buffer first so a failure can still become a 500
+// rather than a truncated download.
+func writeWorkbook(w http.ResponseWriter, filename string, vehicles []report.Vehicle) {
+	var buf bytes.Buffer
+	if err := report.Workbook(vehicles, time.Now()).Write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
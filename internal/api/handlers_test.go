@@ -781,6 +781,129 @@ func TestImportCSVMonotonicViolationNeedsForce(t *testing.T) {
 	}
 }
 
+func TestImportCSVWithPreset(t *testing.T) {
+	srv, st := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+
+	body := "Date,Odometer,Notes\n01/02/2025,8690.46,first fill\n01/03/2025,9495.13,\n"
+	resp := importCSV(t, srv, "golf", "?preset=drivvo", body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("want 200, got %d: %s", resp.StatusCode, b)
+	}
+	var out struct {
+		NotImported []string `json:"not_imported"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || len(out.NotImported) != 1 || out.NotImported[0] != "Notes" {
+		t.Fatalf("want the notes column reported as not imported, got %+v (%v)", out, err)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-02-01"] != 5400 || data.Readings["2025-03-01"] != 5900 {
+		t.Fatalf("mapped readings not persisted: %+v", data.Readings)
+	}
+
+	// With decimal_comma "9.978,8" is 9978.8 km; without it a comma that
+	// does not group thousands is refused rather than dropped.
+	body = "Date,Odometer\n01/04/2025,\"9.978,8\"\n"
+	resp2 := importCSV(t, srv, "golf", "?preset=drivvo&decimal_comma=true", body)
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("decimal comma import: want 200, got %d", resp2.StatusCode)
+	}
+	if data, _ := st.GetVehicle(context.Background(), "golf"); data.Readings["2025-04-01"] != 6201 {
+		t.Fatalf("decimal comma reading: %+v", data.Readings)
+	}
+	resp3 := importCSV(t, srv, "golf", "?preset=drivvo", "Date,Odometer\n01/05/2025,\"10000,5\"\n")
+	resp3.Body.Close()
+	if resp3.StatusCode != http.StatusBadRequest {
+		t.Fatalf("ambiguous comma: want 400, got %d", resp3.StatusCode)
+	}
+}
+
+func TestImportCSVInvalidMapping(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+
+	for _, query := range []string{"?preset=nope", "?date_column=Date", "?date_column=Date&distance_column=Odo&unit=furlongs"} {
+		resp := importCSV(t, srv, "golf", query, "Date,Odo\n")
+		var body struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || body.Error.Code != "invalid_mapping" {
+			t.Fatalf("%s: want 400 invalid_mapping, got %d %+v", query, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestImportOBDLog(t *testing.T) {
+	srv, st := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+
+	// Distance since codes cleared counts on from the 2025-01-01 reading.
+	body := "Device Time,Distance travelled since codes cleared(km)\n" +
+		"02-Feb-2025 08:00:00.000,1000\n02-Feb-2025 09:00:00.000,1080.5\n03-Feb-2025 08:00:00.000,1161\n"
+	resp := importCSV(t, srv, "golf", "?format=obd", body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("want 200, got %d: %s", resp.StatusCode, b)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-02-02"] != 5050 || data.Readings["2025-02-03"] != 5100 {
+		t.Fatalf("obd readings not persisted: %+v", data.Readings)
+	}
+
+	for query, want := range map[string]string{
+		"?format=obd":   "invalid_csv",
+		"?format=excel": "invalid_format",
+	} {
+		resp := importCSV(t, srv, "golf", query, "Time,Speed\n2025-02-04,40\n")
+		var body struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || body.Error.Code != want {
+			t.Fatalf("%s: want 400 %s, got %d %+v", query, want, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle(), "polo": sampleVehicle()})
+
+	for _, path := range []string{"/api/v1/vehicles/golf/export.xlsx", "/api/v1/fleet/export.xlsx"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: want 200, got %d", path, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+			t.Fatalf("%s: content type %q", path, ct)
+		}
+		if !bytes.HasPrefix(body, []byte("PK")) {
+			t.Fatalf("%s: body is not a zip container", path)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/vehicles/ghost/export.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing vehicle: want 404, got %d", resp.StatusCode)
+	}
+}
+
 // Round-trip guarantee: the export endpoint's body imported into a fresh
 // vehicle reproduces identical readings.
 func TestExportImportRoundTrip(t *testing.T) {
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"context"
 	"io/fs"
 	"net/http"
 
 	"golang.org/x/time/rate"
 
 	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/attachments"
 	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/events"
 	"github.com/jackiabishop/mileminder/internal/notify"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
 // HostedConfig configures a multi-tenant (hosted) server: the auth stores, the
@@ -31,6 +37,35 @@ type HostedConfig struct {
 	// endpoints. Nil leaves them unregistered.
 	Reminders alerts.ReminderSettingsStore
 
+	// Attachments, when set, enables the per-user reading-attachment endpoints.
+	Attachments attachments.Tenants
+
+	// Trips, when set, enables the per-user trip endpoints.
+	Trips trips.Tenants
+
+	// Links and Providers, when both set, enable linking each user's vehicles
+	// to connected-car providers.
+	Links     connected.LinkStore
+	Providers connected.Registry
+
+	// Ingest, when set, enables odometer pushes from each user's home
+	// automation and the per-vehicle token endpoints.
+	Ingest tokenstore.Store
+
+	// VehicleState lists the stores holding per-user state keyed by vehicle id
+	// (alert state, reminder settings, reminder send state). Renaming or
+	// merging a vehicle moves its entries in each, so they follow the vehicle.
+	VehicleState []alerts.VehicleMover
+
+	// Calendar, when set, enables each user's iCalendar feed and its token
+	// endpoints. Reminder events are included when Reminders is also set.
+	Calendar tokenstore.Store
+
+	// Events, when set, enables each user's live-update stream at
+	// /api/v1/events. Tenants must publish to it for the stream to carry
+	// anything (see journal.Tenants.Observer).
+	Events *events.Bus
+
 	// SecureCookies sets the Secure flag on session cookies. True in real hosted
 	// deployments (TLS terminated at the edge); left false for plain-HTTP tests.
 	SecureCookies bool
@@ -118,7 +153,45 @@ func hostedMux(cfg HostedConfig) *http.ServeMux {
 		mux.Handle("GET /api/v1/vehicles/{id}/reminders", sess(http.HandlerFunc(reminders.HandleGetReminder)))
 		mux.Handle("PUT /api/v1/vehicles/{id}/reminders", sess(http.HandlerFunc(reminders.HandlePutReminder)))
 	}
-	registerDataRoutes(mux, NewServer(), sess)
+	srv := NewServer()
+	registerDataRoutes(mux, srv, sess)
+	moves := &vehicleMoveAPI{state: cfg.VehicleState}
+	if cfg.Attachments != nil {
+		tenants := cfg.Attachments
+		storeFor := func(ctx context.Context) attachments.Store { return tenants.ForUser(userIDFrom(ctx)) }
+		registerAttachmentRoutes(mux, &attachmentAPI{storeFor: storeFor}, sess)
+		moves.attachmentsFor = storeFor
+	}
+	if cfg.Trips != nil {
+		tenants := cfg.Trips
+		storeFor := func(ctx context.Context) trips.Store { return tenants.ForUser(userIDFrom(ctx)) }
+		registerTripRoutes(mux, &tripAPI{storeFor: storeFor}, sess)
+		moves.tripsFor, srv.tripsFor = storeFor, storeFor
+	}
+	if cfg.Links != nil && len(cfg.Providers) > 0 {
+		registerConnectedRoutes(mux, &connectedAPI{links: cfg.Links, providers: cfg.Providers}, sess)
+		moves.links = cfg.Links
+	}
+	if cfg.Ingest != nil {
+		registerIngestRoutes(mux, &ingestAPI{
+			tokens:   cfg.Ingest,
+			storeFor: cfg.Tenants.ForUser,
+			baseURL:  cfg.BaseURL,
+		}, sess)
+		moves.ingestTokens = cfg.Ingest
+	}
+	registerVehicleMoveRoutes(mux, moves, sess)
+	if cfg.Events != nil {
+		registerEventRoutes(mux, &eventsAPI{bus: cfg.Events}, sess)
+	}
+	if cfg.Calendar != nil {
+		registerCalendarRoutes(mux, &calendarAPI{
+			tokens:    cfg.Calendar,
+			storeFor:  cfg.Tenants.ForUser,
+			reminders: cfg.Reminders,
+			baseURL:   cfg.BaseURL,
+		}, sess)
+	}
 
 	return mux
 }
@@ -15,6 +15,7 @@ import (
 
 	"github.com/jackiabishop/mileminder/internal/alerts"
 	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/attachments"
 	"github.com/jackiabishop/mileminder/internal/auth"
 	"github.com/jackiabishop/mileminder/internal/notify"
 	"github.com/jackiabishop/mileminder/internal/storage"
@@ -31,6 +32,7 @@ type hostedFixture struct {
 	tenants   *storage.MemoryTenants
 	prefs     *alerts.MemoryPrefsStore
 	reminders *alerts.MemoryReminderSettingsStore
+	files     *attachments.MemoryTenants
 }
 
 // newHostedServer builds a hosted server on in-memory stores. mutate can adjust
@@ -46,6 +48,7 @@ func newHostedServer(t *testing.T, mutate func(*api.HostedConfig)) hostedFixture
 		tenants:   storage.NewMemoryTenants(),
 		prefs:     alerts.NewMemoryPrefsStore(),
 		reminders: alerts.NewMemoryReminderSettingsStore(),
+		files:     attachments.NewMemoryTenants(),
 	}
 	cfg := api.HostedConfig{
 		Users:          f.users,
@@ -56,6 +59,8 @@ func newHostedServer(t *testing.T, mutate func(*api.HostedConfig)) hostedFixture
 		BaseURL:        "https://mileminder.example",
 		AlertPrefs:     f.prefs,
 		Reminders:      f.reminders,
+		Attachments:    f.files,
+		VehicleState:   []alerts.VehicleMover{f.reminders},
 		SecureCookies:  false, // plain-HTTP httptest
 		AuthRatePerSec: 1000,
 		AuthRateBurst:  1000,
@@ -900,3 +905,39 @@ func getCurrent(t *testing.T, srv *httptest.Server, client *http.Client) string
 	}
 	return out.Current
 }
+
+// Attachments resolve against the session user's store: another user cannot
+// list or fetch them, even with the same vehicle id.
+func TestHostedAttachmentIsolation(t *testing.T) {
+	f := newHostedServer(t, nil)
+	alice := newClient(t)
+	bob := newClient(t)
+	signup(t, f.srv, alice, "alice@example.com", "correct horse battery")
+	signup(t, f.srv, bob, "bob@example.com", "correct horse battery")
+	createVehicle(t, f.srv, alice, "golf")
+	createVehicle(t, f.srv, bob, "golf")
+
+	url := f.srv.URL + "/api/v1/vehicles/golf/readings/2025-01-01/attachments"
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(pngPhoto))
+	resp, err := alice.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("alice upload: want 201, got %d", resp.StatusCode)
+	}
+
+	resp, err = bob.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list []attachments.Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("bob sees alice's attachments: %+v", list)
+	}
+}
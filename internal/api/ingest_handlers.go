@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+// maxIngestBytes caps a push body. A push is one value; anything larger is
+// not one.
+const maxIngestBytes = 16 << 10
+
+// ingestAPI accepts odometer pushes from home automation and manages the
+// per-vehicle tokens they carry. Like the calendar feed, the push route is
+// open and the token is the credential; issuing and revoking tokens sit behind
+// the mode middleware. storeFor resolves a token's owner to its vehicles.
+type ingestAPI struct {
+	tokens   tokenstore.Store
+	storeFor func(owner string) storage.Store
+	baseURL  string // "" derives the push URL from the request
+}
+
+// registerIngestRoutes wires the push route (open) and token management (data).
+func registerIngestRoutes(mux *http.ServeMux, a *ingestAPI, data middleware) {
+	mux.HandleFunc("POST /api/v1/ingest", a.HandleIngest)
+	mux.Handle("GET /api/v1/vehicles/{id}/ingest-token", data(http.HandlerFunc(a.HandleGetToken)))
+	mux.Handle("POST /api/v1/vehicles/{id}/ingest-token", data(http.HandlerFunc(a.HandleIssueToken)))
+	mux.Handle("DELETE /api/v1/vehicles/{id}/ingest-token", data(http.HandlerFunc(a.HandleRevokeToken)))
+}
+
+// HandleGetToken reports whether the vehicle has an ingestion token. The token
+// itself is only ever returned when issued.
+func (a *ingestAPI) HandleGetToken(w http.ResponseWriter, r *http.Request) {
+	tok, err := a.tokens.Get(r.Context(), ownerFrom(r.Context()), r.PathValue("id"))
+	resp := struct {
+		Enabled   bool       `json:"enabled"`
+		CreatedAt *time.Time `json:"created_at,omitempty"`
+	}{}
+	switch {
+	case err == nil:
+		resp.Enabled, resp.CreatedAt = true, &tok.CreatedAt
+	case errors.Is(err, tokenstore.ErrNotFound):
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleIssueToken creates the vehicle's token, or rotates it — so pushes
+// with the old one are refused — and returns it with the push URL.
+func (a *ingestAPI) HandleIssueToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := storeFrom(r.Context()).GetVehicle(r.Context(), id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	token, tokenHash, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tok := tokenstore.Token{Owner: ownerFrom(r.Context()), VehicleID: id, TokenHash: tokenHash, CreatedAt: time.Now().UTC()}
+	if err := a.tokens.Put(r.Context(), tok); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":      token,
+		"url":        a.pushURL(r),
+		"created_at": tok.CreatedAt,
+	})
+}
+
+// HandleRevokeToken deletes the vehicle's token; pushes with it are refused.
+func (a *ingestAPI) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := a.tokens.Delete(r.Context(), ownerFrom(r.Context()), r.PathValue("id"))
+	if errors.Is(err, tokenstore.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+}
+
+// HandleIngest records a pushed odometer value for the token's vehicle. The
+// token comes from "Authorization: Bearer <token>" or, for senders that cannot
+// set headers, ?token=. Missing, unknown and revoked tokens are
+// indistinguishable 401s.
+func (a *ingestAPI) HandleIngest(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		raw = strings.TrimPrefix(h, "Bearer ")
+	}
+	var tok *tokenstore.Token
+	var err error
+	if raw != "" {
+		tok, err = a.tokens.Resolve(r.Context(), auth.HashToken(raw))
+	}
+	if raw == "" || errors.Is(err, tokenstore.ErrNotFound) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mileminder"`)
+		http.Error(w, "invalid ingestion token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		writeValidationError(w, "invalid_payload", err.Error())
+		return
+	}
+	now := time.Now()
+	push, err := ingest.ParsePush(body, now)
+	if err != nil {
+		writeValidationError(w, "invalid_payload", err.Error())
+		return
+	}
+	res, err := ingest.Record(r.Context(), a.storeFor(tok.Owner), tok.VehicleID, *push, now)
+	switch {
+	case errors.Is(err, ingest.ErrImplausible):
+		writeValidationError(w, "implausible", err.Error())
+		return
+	case errors.Is(err, ingest.ErrNotMonotonic):
+		writeValidationError(w, "not_monotonic", err.Error())
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Vehicle string `json:"vehicle"`
+		*ingest.Result
+	}{tok.VehicleID, res})
+}
+
+// pushURL is the absolute push URL: under the configured public base URL when
+// there is one, otherwise the host the request came in on.
+func (a *ingestAPI) pushURL(r *http.Request) string {
+	base := strings.TrimSuffix(a.baseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/api/v1/ingest"
+}
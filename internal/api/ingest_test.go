@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// push posts body to the ingest endpoint with token as a bearer credential.
+func push(t *testing.T, srv *httptest.Server, token, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/ingest", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+func issueIngestToken(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	raw := expectStatus(t, client, url, "", http.StatusCreated)
+	var issued struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(raw), &issued); err != nil || issued.Token == "" || !strings.HasSuffix(issued.URL, "/api/v1/ingest") {
+		t.Fatalf("issue: %s", raw)
+	}
+	return issued.Token
+}
+
+func TestIngestSingleUser(t *testing.T) {
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	tokens := ingest.NewMemoryTokenStore()
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Ingest: tokens}, ""))
+	t.Cleanup(srv.Close)
+	tokenURL := srv.URL + "/api/v1/vehicles/golf/ingest-token"
+
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/nope/ingest-token", "", http.StatusNotFound)
+	token := issueIngestToken(t, http.DefaultClient, tokenURL)
+	resp := do(t, http.MethodGet, tokenURL, nil)
+	var state map[string]any
+	json.NewDecoder(resp.Body).Decode(&state)
+	if state["enabled"] != true {
+		t.Fatalf("token state: %v", state)
+	}
+
+	if code, _ := push(t, srv, "", `{"odometer": 5100}`); code != http.StatusUnauthorized {
+		t.Fatalf("no token: want 401, got %d", code)
+	}
+	if code, _ := push(t, srv, "wrong", `{"odometer": 5100}`); code != http.StatusUnauthorized {
+		t.Fatalf("bad token: want 401, got %d", code)
+	}
+	code, raw := push(t, srv, token, `{"odometer": 5100, "date": "2025-01-05"}`)
+	if code != http.StatusOK || !strings.Contains(raw, `"status":"recorded"`) || !strings.Contains(raw, `"vehicle":"golf"`) {
+		t.Fatalf("native push: %d %s", code, raw)
+	}
+	// Home Assistant's RESTful notify shape, token in the query string.
+	code, raw = postJSON(t, http.DefaultClient, srv.URL+"/api/v1/ingest?token="+token,
+		`{"message": "8368.6 km", "title": "Golf odometer", "data": {"date": "2025-01-05"}}`)
+	if code != http.StatusOK || !strings.Contains(raw, `"miles":5200`) {
+		t.Fatalf("HA push: %d %s", code, raw)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if len(data.Readings) != 2 || data.Readings["2025-01-05"] != 5200 {
+		t.Fatalf("one reading per day: %v", data.Readings)
+	}
+
+	for body, want := range map[string]string{
+		`{"message": "unavailable"}`:                 "invalid_payload",
+		`{"odometer": 4000, "date": "2025-01-06"}`:   "not_monotonic",
+		`{"odometer": 900000, "date": "2025-01-06"}`: "implausible",
+		`{"odometer": 5300, "date": "2999-01-01"}`:   "implausible",
+	} {
+		if code, raw := push(t, srv, token, body); code != http.StatusBadRequest || !strings.Contains(raw, want) {
+			t.Errorf("%s: want 400 %s, got %d %s", body, want, code, raw)
+		}
+	}
+
+	// The token follows a rename, then stops working once revoked.
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/golf/rename", `{"id":"gti"}`, http.StatusOK)
+	if code, raw := push(t, srv, token, `{"odometer": 5300, "date": "2025-01-06"}`); code != http.StatusOK || !strings.Contains(raw, `"vehicle":"gti"`) {
+		t.Fatalf("push after rename: %d %s", code, raw)
+	}
+	if resp := do(t, http.MethodDelete, srv.URL+"/api/v1/vehicles/gti/ingest-token", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: want 200, got %d", resp.StatusCode)
+	}
+	if code, _ := push(t, srv, token, `{"odometer": 5400}`); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: want 401, got %d", code)
+	}
+}
+
+// In hosted mode a token records into its issuer's vehicles only.
+func TestIngestHostedTenants(t *testing.T) {
+	f := newHostedServer(t, func(cfg *api.HostedConfig) { cfg.Ingest = ingest.NewMemoryTokenStore() })
+	alice, bob := newClient(t), newClient(t)
+	signup(t, f.srv, alice, "alice@example.com", "password123")
+	signup(t, f.srv, bob, "bob@example.com", "password123")
+	createVehicle(t, f.srv, alice, "golf")
+	createVehicle(t, f.srv, bob, "golf")
+
+	token := issueIngestToken(t, alice, f.srv.URL+"/api/v1/vehicles/golf/ingest-token")
+	if code, raw := push(t, f.srv, token, `{"odometer": 5100, "date": "2025-01-05"}`); code != http.StatusOK {
+		t.Fatalf("push: %d %s", code, raw)
+	}
+	users, _ := f.users.ListUsers(context.Background())
+	for _, u := range users {
+		data, err := f.tenants.ForUser(u.ID).GetVehicle(context.Background(), "golf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, got := data.Readings["2025-01-05"]
+		if got != (u.Email == "alice@example.com") {
+			t.Fatalf("%s: readings %v", u.Email, data.Readings)
+		}
+	}
+}
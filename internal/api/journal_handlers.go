@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+)
+
+// journalFrom returns the request's Store as a journal.Store, writing a 501
+// when the server was built over a Store without a journal (as in most
+// tests).
+func journalFrom(w http.ResponseWriter, r *http.Request) (*journal.Store, bool) {
+	j, ok := storeFrom(r.Context()).(*journal.Store)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(apiErrorResponse{
+			Error: apiError{
+				Code:    "journal_disabled",
+				Message: "this server does not keep a change journal",
+			},
+		})
+		return nil, false
+	}
+	return j, true
+}
+
+// HandleGetHistory lists the journal entries that changed a vehicle, newest
+// first. A deleted vehicle's history stays readable, so an unknown id is an
+// empty list rather than a 404.
+func (s *Server) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "vehicle ID required", http.StatusBadRequest)
+		return
+	}
+	j, ok := journalFrom(w, r)
+	if !ok {
+		return
+	}
+	entries, err := j.History(r.Context(), id, 0)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []journal.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// HandleUndo replays the inverse of a journal entry and returns the entry
+// recording the undo. If the data has changed since the entry, it is a 409 and
+// nothing is touched.
+func (s *Server) HandleUndo(w http.ResponseWriter, r *http.Request) {
+	j, ok := journalFrom(w, r)
+	if !ok {
+		return
+	}
+	entry, err := j.Undo(r.Context(), r.PathValue("entry"))
+	if errors.Is(err, journal.ErrConflict) || errors.Is(err, journal.ErrNotUndoable) {
+		code := "undo_conflict"
+		if errors.Is(err, journal.ErrNotUndoable) {
+			code = "not_undoable"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(apiErrorResponse{
+			Error: apiError{
+				Code:    code,
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
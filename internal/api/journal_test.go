@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func getHistory(t *testing.T, url string) []journal.Entry {
+	t.Helper()
+	resp := do(t, http.MethodGet, url, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("history: want 200, got %d", resp.StatusCode)
+	}
+	var entries []journal.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestHistoryAndUndo(t *testing.T) {
+	st := journal.Wrap(storage.NewMemory(), journal.NewMemoryLog(), "web")
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(api.NewRouter(st, ""))
+	t.Cleanup(srv.Close)
+
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/golf/readings", `{"date":"2025-06-01","miles":9000}`, http.StatusOK)
+	entries := getHistory(t, srv.URL+"/api/v1/vehicles/golf/history")
+	if len(entries) != 2 || entries[0].Op != journal.OpPutReading || entries[0].Actor != "web" {
+		t.Fatalf("history: %+v", entries)
+	}
+	if got := getHistory(t, srv.URL+"/api/v1/vehicles/nope/history"); len(got) != 0 {
+		t.Fatalf("unknown vehicle history: %+v", got)
+	}
+
+	// A later edit makes the reading entry stale: undo refuses.
+	if err := st.PutReading(context.Background(), "golf", "2025-07-01", 9500); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/history/"+entries[0].ID+"/undo", "", http.StatusConflict)
+
+	latest := getHistory(t, srv.URL+"/api/v1/vehicles/golf/history")[0]
+	raw := expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/history/"+latest.ID+"/undo", "", http.StatusOK)
+	var undo journal.Entry
+	if err := json.Unmarshal([]byte(raw), &undo); err != nil {
+		t.Fatal(err)
+	}
+	if undo.Undoes != latest.ID || undo.Op != journal.OpRevert {
+		t.Fatalf("undo entry: %+v", undo)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if _, ok := data.Readings["2025-07-01"]; ok {
+		t.Fatalf("reading not undone: %v", data.Readings)
+	}
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/history/nope/undo", "", http.StatusNotFound)
+}
+
+func TestHistoryWithoutJournal(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	if resp := do(t, http.MethodGet, srv.URL+"/api/v1/vehicles/golf/history", nil); resp.StatusCode != http.StatusNotImplemented {
+		t.Fatalf("history without journal: want 501, got %d", resp.StatusCode)
+	}
+}
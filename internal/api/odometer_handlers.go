@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+)
+
+// HandleGetOdometerChanges lists a vehicle's recorded odometer replacements
+// and rollovers in date order.
+func (s *Server) HandleGetOdometerChanges(w http.ResponseWriter, r *http.Request) {
+	data, err := storeFrom(r.Context()).GetVehicle(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	changes := data.OdometerChanges
+	if changes == nil {
+		changes = []model.OdometerChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// HandleAddOdometerChange records an odometer change. One that does not fit
+// the readings either side of it is a 400 not_monotonic unless force is set,
+// mirroring the CSV import rule.
+func (s *Server) HandleAddOdometerChange(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req struct {
+		model.OdometerChange
+		Force bool `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+
+	var code, message string
+	err := storeFrom(r.Context()).UpdateVehicle(r.Context(), id, func(data *model.VehicleData) error {
+		changes, err := readings.AddChange(data.OdometerChanges, req.OdometerChange)
+		if err != nil {
+			code, message = "invalid_odometer_change", err.Error()
+			return err
+		}
+		if !req.Force {
+			if err := readings.CheckMonotonic(data.Readings, changes); err != nil {
+				code, message = "not_monotonic", err.Error()+"; set force=true to override"
+				return err
+			}
+		}
+		data.OdometerChanges = changes
+		return nil
+	})
+	if code != "" {
+		writeValidationError(w, code, message)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(req.OdometerChange)
+}
+
+// HandleDeleteOdometerChange removes the change on {date}. The readings it
+// explained may then decrease, which needs ?force=true.
+func (s *Server) HandleDeleteOdometerChange(w http.ResponseWriter, r *http.Request) {
+	id, date := r.PathValue("id"), r.PathValue("date")
+	var noChange bool
+	var message string
+	err := storeFrom(r.Context()).UpdateVehicle(r.Context(), id, func(data *model.VehicleData) error {
+		changes := slices.DeleteFunc(slices.Clone(data.OdometerChanges), func(c model.OdometerChange) bool { return c.Date == date })
+		if len(changes) == len(data.OdometerChanges) {
+			noChange = true
+			return errors.New("no odometer change on " + date)
+		}
+		if r.URL.Query().Get("force") != "true" {
+			if err := readings.CheckMonotonic(data.Readings, changes); err != nil {
+				message = err.Error() + "; set force=true to override"
+				return err
+			}
+		}
+		data.OdometerChanges = changes
+		return nil
+	})
+	switch {
+	case noChange:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case message != "":
+		writeValidationError(w, "not_monotonic", message)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
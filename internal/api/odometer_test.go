@@ -0,0 +1,37 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func TestOdometerChanges(t *testing.T) {
+	srv, st := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+	base := srv.URL + "/api/v1/vehicles/golf/odometer-changes"
+
+	expectStatus(t, http.DefaultClient, base, `{"date":"2025-03-01","old_final":4000,"new_start":0}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base, `{"date":"2025-3-1","old_final":8000}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base, `{"date":"2025-03-01","old_final":8000,"new_start":0}`, http.StatusCreated)
+	expectStatus(t, http.DefaultClient, base, `{"date":"2025-03-01","old_final":8000,"new_start":0}`, http.StatusBadRequest)
+
+	// A reading on the new odometer no longer needs force.
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/golf/readings", `{"date":"2025-04-01","miles":500}`, http.StatusOK)
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if s := calc.ComputeStatus("golf", data); s.StartMiles != 5000 || s.StartMilesCurrent != 5000-8000 || s.LatestReading != 500 {
+		t.Fatalf("status across change: start %d (current %d) latest %d", s.StartMiles, s.StartMilesCurrent, s.LatestReading)
+	}
+
+	if resp := do(t, http.MethodDelete, base+"/2025-03-01", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("delete without force: want 400, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, base+"/2025-03-01?force=true", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete with force: want 204, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, base+"/2025-03-01", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("delete missing: want 404, got %d", resp.StatusCode)
+	}
+}
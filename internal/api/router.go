@@ -1,13 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"io/fs"
 	"mime"
 	"net/http"
 	"path/filepath"
 
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/events"
 	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
 )
 
 func init() {
@@ -38,27 +44,110 @@ func handleMeta(mode string) http.HandlerFunc {
 	}
 }
 
+// SingleUserConfig configures a single-user (self-hosted) server: the one
+// process-wide store plus optional features. Nil optional fields leave their
+// routes unregistered, as in HostedConfig.
+type SingleUserConfig struct {
+	Store storage.Store
+
+	// Attachments, when set, enables the reading-attachment endpoints.
+	Attachments attachments.Store
+
+	// Calendar, when set, enables the install's iCalendar feed and its token
+	// endpoints.
+	Calendar tokenstore.Store
+
+	// Trips, when set, enables the trip endpoints.
+	Trips trips.Store
+
+	// Links and Providers, when both set, enable linking vehicles to
+	// connected-car providers.
+	Links     connected.LinkStore
+	Providers connected.Registry
+
+	// Ingest, when set, enables odometer pushes from home automation and the
+	// per-vehicle token endpoints.
+	Ingest tokenstore.Store
+
+	// Events, when set, enables the live-update stream at /api/v1/events.
+	Events *events.Bus
+}
+
 // NewRouter creates the single-user API router serving static files from disk,
 // or API-only when staticDir is "" (the serve --dev path). This is the only
-// constructor that opens CORS: dev runs the Vite frontend on a separate origin.
+// constructor family that opens CORS: dev runs the Vite frontend on a separate
+// origin.
 func NewRouter(store storage.Store, staticDir string) http.Handler {
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /api/v1/meta", handleMeta(modeSingleUser))
-	registerDataRoutes(mux, NewServer(), singleUser(store))
+	return NewSingleUserRouterDir(SingleUserConfig{Store: store}, staticDir)
+}
+
+// NewRouterWithFS creates the single-user API router serving the embedded SPA
+// (production self-hosted binary). No CORS: the SPA is same-origin.
+func NewRouterWithFS(store storage.Store, staticFS fs.FS) http.Handler {
+	return NewSingleUserRouter(SingleUserConfig{Store: store}, staticFS)
+}
+
+// NewSingleUserRouter is NewRouterWithFS with optional features configured.
+func NewSingleUserRouter(cfg SingleUserConfig, staticFS fs.FS) http.Handler {
+	mux := singleUserMux(cfg)
+	mountStaticFS(mux, staticFS)
+	return securityHeaders(mux)
+}
+
+// NewSingleUserRouterDir is NewRouter with optional features configured.
+func NewSingleUserRouterDir(cfg SingleUserConfig, staticDir string) http.Handler {
+	mux := singleUserMux(cfg)
 	if staticDir != "" {
 		mountStaticDir(mux, staticDir)
 	}
 	return corsMiddleware(securityHeaders(mux))
 }
 
-// NewRouterWithFS creates the single-user API router serving the embedded SPA
-// (production self-hosted binary). No CORS: the SPA is same-origin.
-func NewRouterWithFS(store storage.Store, staticFS fs.FS) http.Handler {
+// singleUserMux wires the single-user API surface: meta plus every data route
+// against the one process-wide store.
+func singleUserMux(cfg SingleUserConfig) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /api/v1/meta", handleMeta(modeSingleUser))
-	registerDataRoutes(mux, NewServer(), singleUser(store))
-	mountStaticFS(mux, staticFS)
-	return securityHeaders(mux)
+	data := singleUser(cfg.Store)
+	srv := NewServer()
+	registerDataRoutes(mux, srv, data)
+	moves := &vehicleMoveAPI{}
+	if cfg.Attachments != nil {
+		st := cfg.Attachments
+		storeFor := func(context.Context) attachments.Store { return st }
+		registerAttachmentRoutes(mux, &attachmentAPI{storeFor: storeFor}, data)
+		moves.attachmentsFor = storeFor
+	}
+	if cfg.Trips != nil {
+		st := cfg.Trips
+		storeFor := func(context.Context) trips.Store { return st }
+		registerTripRoutes(mux, &tripAPI{storeFor: storeFor}, data)
+		moves.tripsFor, srv.tripsFor = storeFor, storeFor
+	}
+	if cfg.Links != nil && len(cfg.Providers) > 0 {
+		registerConnectedRoutes(mux, &connectedAPI{links: cfg.Links, providers: cfg.Providers}, data)
+		moves.links = cfg.Links
+	}
+	if cfg.Ingest != nil {
+		st := cfg.Store
+		registerIngestRoutes(mux, &ingestAPI{
+			tokens:   cfg.Ingest,
+			storeFor: func(string) storage.Store { return st },
+		}, data)
+		moves.ingestTokens = cfg.Ingest
+	}
+	registerVehicleMoveRoutes(mux, moves, data)
+	if cfg.Events != nil {
+		registerEventRoutes(mux, &eventsAPI{bus: cfg.Events}, data)
+	}
+	if cfg.Calendar != nil {
+		st := cfg.Store
+		registerCalendarRoutes(mux, &calendarAPI{
+			tokens:   cfg.Calendar,
+			storeFor: func(string) storage.Store { return st },
+		}, data)
+	}
+	return mux
 }
 
 // mountStaticDir serves the SPA from disk with client-side-routing fallback.
@@ -90,11 +179,23 @@ func registerDataRoutes(mux *http.ServeMux, s *Server, data middleware) {
 	mux.Handle("GET /api/v1/vehicles/{id}/graph", d(s.HandleGetGraphData))
 	mux.Handle("POST /api/v1/vehicles/{id}/scenario", d(s.HandleVehicleScenario))
 	mux.Handle("GET /api/v1/vehicles/{id}/export", d(s.HandleExportCSV))
+	mux.Handle("GET /api/v1/vehicles/{id}/export.xlsx", d(s.HandleExportXLSX))
 	mux.Handle("GET /api/v1/vehicles/{id}/profile", d(s.HandleExportProfile))
 	mux.Handle("POST /api/v1/vehicles/{id}/import", d(s.HandleImportCSV))
+	mux.Handle("GET /api/v1/vehicles/{id}/archive", d(s.HandleExportArchive))
+	mux.Handle("POST /api/v1/archive", d(s.HandleImportArchive))
 	mux.Handle("GET /api/v1/current", d(s.HandleGetCurrent))
 	mux.Handle("PUT /api/v1/current", d(s.HandleSetCurrent))
 	mux.Handle("GET /api/v1/fleet", d(s.HandleFleet))
+	mux.Handle("GET /api/v1/fleet/export.xlsx", d(s.HandleExportFleetXLSX))
+	mux.Handle("GET /api/v1/vehicles/{id}/odometer-changes", d(s.HandleGetOdometerChanges))
+	mux.Handle("POST /api/v1/vehicles/{id}/odometer-changes", d(s.HandleAddOdometerChange))
+	mux.Handle("DELETE /api/v1/vehicles/{id}/odometer-changes/{date}", d(s.HandleDeleteOdometerChange))
+	mux.Handle("GET /api/v1/trash", d(s.HandleListTrash))
+	mux.Handle("POST /api/v1/trash/{item}/restore", d(s.HandleRestoreTrash))
+	mux.Handle("DELETE /api/v1/trash/{item}", d(s.HandlePurgeTrash))
+	mux.Handle("GET /api/v1/vehicles/{id}/history", d(s.HandleGetHistory))
+	mux.Handle("POST /api/v1/history/{entry}/undo", d(s.HandleUndo))
 	mux.Handle("GET /api/v1/settings", d(s.HandleGetSettings))
 	mux.Handle("PUT /api/v1/settings", d(s.HandlePutSettings))
 }
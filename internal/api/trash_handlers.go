@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// HandleListTrash lists soft-deleted vehicles and readings, most recently
+// deleted first.
+func (s *Server) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	items, err := storeFrom(r.Context()).ListTrash(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if items == nil {
+		items = []storage.TrashItem{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// HandleRestoreTrash puts a trashed item back. Restoring never overwrites: if
+// the vehicle id or reading date has been reused since the deletion, it is a
+// 409 and the item stays in the trash.
+func (s *Server) HandleRestoreTrash(w http.ResponseWriter, r *http.Request) {
+	item, err := storeFrom(r.Context()).RestoreTrash(r.Context(), r.PathValue("item"))
+	if errors.Is(err, storage.ErrExists) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(apiErrorResponse{
+			Error: apiError{
+				Code:    "restore_conflict",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// HandlePurgeTrash permanently deletes one trashed item, and the trips of a
+// vehicle purged with it.
+func (s *Server) HandlePurgeTrash(w http.ResponseWriter, r *http.Request) {
+	st := storeFrom(r.Context())
+	if err := st.PurgeTrash(r.Context(), r.PathValue("item")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if s.tripsFor != nil {
+		if _, err := trips.DropOrphans(r.Context(), s.tripsFor(r.Context()), st); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "purged"})
+}
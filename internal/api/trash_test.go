@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func listTrash(t *testing.T, client *http.Client, base string) []storage.TrashItem {
+	t.Helper()
+	resp, err := client.Get(base + "/api/v1/trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list trash: want 200, got %d", resp.StatusCode)
+	}
+	var items []storage.TrashItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	srv, st := newTestServer(t, map[string]*model.VehicleData{"golf": sampleVehicle()})
+	if items := listTrash(t, http.DefaultClient, srv.URL); len(items) != 0 {
+		t.Fatalf("empty trash: got %+v", items)
+	}
+
+	if resp := do(t, http.MethodDelete, srv.URL+"/api/v1/vehicles/golf/readings/2025-01-01", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete reading: want 200, got %d", resp.StatusCode)
+	}
+	items := listTrash(t, http.DefaultClient, srv.URL)
+	if len(items) != 1 || items[0].Kind != storage.TrashReading || items[0].Date != "2025-01-01" {
+		t.Fatalf("trash after delete: %+v", items)
+	}
+
+	// The date was re-entered: restore refuses rather than overwrite it.
+	if err := st.PutReading(t.Context(), "golf", "2025-01-01", 5001); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/trash/"+items[0].ID+"/restore", "", http.StatusConflict)
+	if err := st.DeleteReading(t.Context(), "golf", "2025-01-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/trash/"+items[0].ID+"/restore", "", http.StatusOK)
+	data, _ := st.GetVehicle(t.Context(), "golf")
+	if data.Readings["2025-01-01"] != 5000 {
+		t.Fatalf("restored reading: %v", data.Readings)
+	}
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/trash/"+items[0].ID+"/restore", "", http.StatusNotFound)
+
+	// The 5001 deletion is still in the trash; purge it for good.
+	left := listTrash(t, http.DefaultClient, srv.URL)
+	if len(left) != 1 || left[0].Miles != 5001 {
+		t.Fatalf("trash before purge: %+v", left)
+	}
+	if resp := do(t, http.MethodDelete, srv.URL+"/api/v1/trash/"+left[0].ID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("purge: want 200, got %d", resp.StatusCode)
+	}
+	if items := listTrash(t, http.DefaultClient, srv.URL); len(items) != 0 {
+		t.Fatalf("trash after purge: %+v", items)
+	}
+}
+
+// One user's trash is invisible to, and cannot be restored by, another.
+func TestHostedTrashIsolation(t *testing.T) {
+	f := newHostedServer(t, nil)
+	alice, bob := newClient(t), newClient(t)
+	signup(t, f.srv, alice, "alice@example.com", "correct horse battery")
+	signup(t, f.srv, bob, "bob@example.com", "correct horse battery")
+	createVehicle(t, f.srv, alice, "golf")
+
+	req, _ := http.NewRequest(http.MethodDelete, f.srv.URL+"/api/v1/vehicles/golf/readings/2025-01-01", nil)
+	resp, err := alice.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	items := listTrash(t, alice, f.srv.URL)
+	if len(items) != 1 {
+		t.Fatalf("alice's trash: %+v", items)
+	}
+
+	if got := listTrash(t, bob, f.srv.URL); len(got) != 0 {
+		t.Fatalf("bob sees alice's trash: %+v", got)
+	}
+	expectStatus(t, bob, f.srv.URL+"/api/v1/trash/"+items[0].ID+"/restore", "", http.StatusNotFound)
+	expectStatus(t, alice, f.srv.URL+"/api/v1/trash/"+items[0].ID+"/restore", "", http.StatusOK)
+}
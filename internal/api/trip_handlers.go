@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/gpx"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// maxGPXBytes caps a GPX upload. Track logs carry a point every few seconds,
+// so a day's driving can be a few hundred KB; 10 MB covers weeks of it.
+const maxGPXBytes = 10 << 20
+
+// tripAPI serves trips. Like attachments, trips live outside the vehicle
+// document, so storeFor resolves the trip store per request: the process-wide
+// one in single-user mode, the session user's in hosted mode.
+type tripAPI struct {
+	storeFor func(ctx context.Context) trips.Store
+}
+
+// registerTripRoutes wires the trip endpoints behind the same mode middleware
+// as the data routes.
+func registerTripRoutes(mux *http.ServeMux, a *tripAPI, data middleware) {
+	d := func(h http.HandlerFunc) http.Handler { return data(h) }
+	mux.Handle("GET /api/v1/vehicles/{id}/trips", d(a.HandleListTrips))
+	mux.Handle("POST /api/v1/vehicles/{id}/trips", d(a.HandleCreateTrip))
+	mux.Handle("GET /api/v1/vehicles/{id}/trips/summary", d(a.HandleTripSummary))
+	mux.Handle("GET /api/v1/vehicles/{id}/trips/{trip}", d(a.HandleGetTrip))
+	mux.Handle("PUT /api/v1/vehicles/{id}/trips/{trip}", d(a.HandleUpdateTrip))
+	mux.Handle("DELETE /api/v1/vehicles/{id}/trips/{trip}", d(a.HandleDeleteTrip))
+	mux.Handle("POST /api/v1/vehicles/{id}/import/gpx", d(a.HandleImportGPX))
+}
+
+// tripRequest is the create/update body: a trip plus whether to record its
+// end odometer as a reading.
+type tripRequest struct {
+	trips.Trip
+	RecordReading bool `json:"record_reading"`
+	Force         bool `json:"force"`
+}
+
+// requireVehicle confirms the vehicle exists in the caller's scoped store, so
+// trips cannot be parked against ids the user does not own.
+func (a *tripAPI) requireVehicle(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if _, err := storeFrom(r.Context()).GetVehicle(r.Context(), id); err != nil {
+		writeStoreError(w, err)
+		return "", false
+	}
+	return id, true
+}
+
+// writeTripError maps trip store errors onto responses.
+func writeTripError(w http.ResponseWriter, err error) {
+	if errors.Is(err, trips.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeStoreError(w, err)
+}
+
+// HandleListTrips lists a vehicle's trips by start date.
+func (a *tripAPI) HandleListTrips(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	list, err := a.storeFor(r.Context()).List(r.Context(), id)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetTrip returns one trip.
+func (a *tripAPI) HandleGetTrip(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	t, err := a.storeFor(r.Context()).Get(r.Context(), id, r.PathValue("trip"))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// HandleCreateTrip records a trip. With record_reading set, the end odometer
+// is first upserted as a reading, subject to the usual below-max rule unless
+// force is set; if that is refused, no trip is saved either.
+func (a *tripAPI) HandleCreateTrip(w http.ResponseWriter, r *http.Request) {
+	a.saveTrip(w, r, "")
+}
+
+// HandleUpdateTrip replaces a trip, with the same reading option as create.
+func (a *tripAPI) HandleUpdateTrip(w http.ResponseWriter, r *http.Request) {
+	a.saveTrip(w, r, r.PathValue("trip"))
+}
+
+func (a *tripAPI) saveTrip(w http.ResponseWriter, r *http.Request, tripID string) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	var req tripRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+	t := req.Trip
+	t.ID, t.VehicleID = tripID, id
+	if err := trips.Normalize(&t); err != nil {
+		writeValidationError(w, "invalid_trip", err.Error())
+		return
+	}
+	st := a.storeFor(r.Context())
+	if tripID != "" {
+		// Check before touching readings, so a bad id changes nothing.
+		if _, err := st.Get(r.Context(), id, tripID); err != nil {
+			writeTripError(w, err)
+			return
+		}
+	}
+	if req.RecordReading {
+		err := trips.RecordReading(r.Context(), storeFrom(r.Context()), t, req.Force)
+		if errors.Is(err, trips.ErrBelowMax) {
+			writeValidationError(w, "below_max", err.Error()+"; set force=true to override")
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	saved, err := st.Save(r.Context(), t)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if tripID == "" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// HandleDeleteTrip removes a trip. A reading it recorded stays: it is an
+// ordinary reading once written.
+func (a *tripAPI) HandleDeleteTrip(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	if err := a.storeFor(r.Context()).Delete(r.Context(), id, r.PathValue("trip")); err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTripSummary totals a vehicle's trips, optionally within ?from= and
+// ?to= (YYYY-MM-DD, inclusive), with the business/personal split.
+func (a *tripAPI) HandleTripSummary(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			writeValidationError(w, "invalid_date", "from and to must be YYYY-MM-DD dates")
+			return
+		}
+	}
+	list, err := a.storeFor(r.Context()).List(r.Context(), id)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trips.Summarize(list, from, to))
+}
+
+// HandleImportGPX imports a GPX track log: each day's tracks become a trip and
+// a proposed reading (the last known odometer plus the distance tracked since).
+// Like the CSV import it is all-or-nothing, with every bad track point
+// line-numbered. ?dry_run=true returns the proposal without saving; ?force,
+// ?trips=false, ?purpose=, ?driver= and ?tz= (IANA zone deciding each point's
+// day, default the server's) match the CLI flags.
+func (a *tripAPI) HandleImportGPX(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.requireVehicle(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	opts := gpx.Options{
+		Purpose: q.Get("purpose"),
+		Driver:  q.Get("driver"),
+		NoTrips: q.Get("trips") == "false",
+		Force:   q.Get("force") == "true",
+		DryRun:  q.Get("dry_run") == "true",
+	}
+	if p := opts.Purpose; p != "" && p != trips.Business && p != trips.Personal {
+		writeValidationError(w, "invalid_trip", fmt.Sprintf("purpose must be %q or %q", trips.Business, trips.Personal))
+		return
+	}
+	loc := time.Local
+	if tz := q.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			writeValidationError(w, "invalid_tz", err.Error())
+			return
+		}
+	}
+
+	days, rowErrs := gpx.Parse(http.MaxBytesReader(w, r.Body, maxGPXBytes), loc)
+	if len(rowErrs) > 0 {
+		writeValidationErrorDetails(w, "invalid_gpx",
+			fmt.Sprintf("GPX has %d problem(s); nothing was imported", len(rowErrs)), rowErrs)
+		return
+	}
+	var tripLog trips.Store
+	if !opts.NoTrips {
+		tripLog = a.storeFor(r.Context())
+	}
+	p, err := gpx.Import(r.Context(), storeFrom(r.Context()), tripLog, id, days, opts)
+	if errors.Is(err, gpx.ErrNotMonotonic) {
+		writeValidationError(w, "not_monotonic", err.Error()+"; set force=true to override")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	status := "imported"
+	if opts.DryRun {
+		status = "preview"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		*gpx.Proposal
+	}{status, p})
+}
@@ -0,0 +1,126 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+func TestTrips(t *testing.T) {
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Trips: trips.NewMemory()}, ""))
+	t.Cleanup(srv.Close)
+	base := srv.URL + "/api/v1/vehicles/golf/trips"
+
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/nope/trips", `{"start_date":"2025-06-01","distance":5}`, http.StatusNotFound)
+	expectStatus(t, http.DefaultClient, base, `{"start_date":"2025-06-01"}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base, `{"start_date":"2025-06-01","start_odometer":5000,"end_odometer":4000,"distance":0}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base, `{"start_date":"2025-06-01","end_odometer":4990,"distance":10,"record_reading":true}`, http.StatusBadRequest)
+
+	raw := expectStatus(t, http.DefaultClient, base, `{"start_date":"2025-06-01","start_odometer":5000,"end_odometer":5060,"purpose":"business","record_reading":true}`, http.StatusCreated)
+	var created trips.Trip
+	if err := json.Unmarshal([]byte(raw), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Distance != 60 || created.VehicleID != "golf" {
+		t.Fatalf("created: %+v", created)
+	}
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-06-01"] != 5060 {
+		t.Fatalf("reading not recorded: %v", data.Readings)
+	}
+	expectStatus(t, http.DefaultClient, base, `{"start_date":"2025-06-20","distance":140}`, http.StatusCreated)
+
+	resp := do(t, http.MethodGet, base+"/summary?from=2025-06-01&to=2025-06-30", nil)
+	var sum trips.Summary
+	if err := json.NewDecoder(resp.Body).Decode(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Trips != 2 || sum.Distance != 200 || sum.BusinessShare != 0.3 {
+		t.Fatalf("summary: %+v", sum)
+	}
+	if resp := do(t, http.MethodGet, base+"/summary?from=June", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad summary date: want 400, got %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodPut, base+"/"+created.ID, []byte(`{"start_date":"2025-06-01","distance":65,"purpose":"business","driver":"sam"}`)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("update: want 200, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, base+"/nope", []byte(`{"start_date":"2025-06-01","distance":65}`)); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("update missing: want 404, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, base+"/"+created.ID, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: want 204, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodGet, base+"/"+created.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("get deleted: want 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestImportGPX(t *testing.T) {
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", sampleVehicle()); err != nil {
+		t.Fatal(err)
+	}
+	tripLog := trips.NewMemory()
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Trips: tripLog}, ""))
+	t.Cleanup(srv.Close)
+	base := srv.URL + "/api/v1/vehicles/golf/import/gpx"
+	doc := `<gpx><trk><name>Commute</name><trkseg>
+<trkpt lat="51.0" lon="0"><time>2025-06-02T07:00:00Z</time></trkpt>
+<trkpt lat="51.2" lon="0"><time>2025-06-02T07:20:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+	raw := expectStatus(t, http.DefaultClient, base+"?dry_run=true&tz=UTC", doc, http.StatusOK)
+	var preview struct {
+		Status string `json:"status"`
+		Days   []struct {
+			Date    string `json:"date"`
+			Reading int    `json:"reading"`
+		} `json:"days"`
+		Trips []trips.Trip `json:"trips"`
+	}
+	if err := json.Unmarshal([]byte(raw), &preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.Status != "preview" || len(preview.Days) != 1 || preview.Days[0].Reading != 5014 || len(preview.Trips) != 1 {
+		t.Fatalf("preview: %s", raw)
+	}
+	if list, _ := tripLog.List(context.Background(), "golf"); len(list) != 0 {
+		t.Fatalf("dry run saved trips: %+v", list)
+	}
+
+	expectStatus(t, http.DefaultClient, base+"?tz=UTC&purpose=business", doc, http.StatusOK)
+	data, _ := st.GetVehicle(context.Background(), "golf")
+	if data.Readings["2025-06-02"] != 5014 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+	if list, _ := tripLog.List(context.Background(), "golf"); len(list) != 1 || list[0].Purpose != trips.Business {
+		t.Fatalf("trips: %+v", list)
+	}
+
+	body := expectStatus(t, http.DefaultClient, base, `<gpx><trk><trkseg><trkpt lat="x" lon="0"/></trkseg></trk></gpx>`, http.StatusBadRequest)
+	var apiErr struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details []struct {
+				Line int `json:"line"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil || apiErr.Error.Code != "invalid_gpx" || len(apiErr.Error.Details) != 1 {
+		t.Fatalf("bad gpx: %s", body)
+	}
+	expectStatus(t, http.DefaultClient, base+"?tz=Mars/Olympus", doc, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base+"?purpose=leisure", doc, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, srv.URL+"/api/v1/vehicles/nope/import/gpx", doc, http.StatusNotFound)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/connected"
+	"github.com/jackiabishop/mileminder/internal/ingest"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// vehicleMoveAPI renames a vehicle or merges one into another. The vehicle
+// document and the current pointer move inside the Store; state kept beside
+// the document under the vehicle id — attachments, trips, connected-car links,
+// ingestion tokens and, in hosted mode, the user's alert and reminder state — is carried here,
+// so the router supplies whichever of those stores the mode has.
+type vehicleMoveAPI struct {
+	attachmentsFor func(ctx context.Context) attachments.Store // nil: no attachments
+	tripsFor       func(ctx context.Context) trips.Store       // nil: no trips
+	links          connected.LinkStore                         // nil: no connected cars
+	ingestTokens   tokenstore.Store                            // nil: no ingestion
+	state          []alerts.VehicleMover                       // hosted only
+}
+
+// registerVehicleMoveRoutes wires rename and merge behind the mode middleware.
+func registerVehicleMoveRoutes(mux *http.ServeMux, a *vehicleMoveAPI, data middleware) {
+	mux.Handle("POST /api/v1/vehicles/{id}/rename", data(http.HandlerFunc(a.HandleRename)))
+	mux.Handle("POST /api/v1/vehicles/{id}/merge", data(http.HandlerFunc(a.HandleMerge)))
+}
+
+// carry moves the dependent state from one vehicle id to another after the
+// Store has moved the vehicle itself.
+func (a *vehicleMoveAPI) carry(ctx context.Context, from, to string) error {
+	if a.attachmentsFor != nil {
+		if err := attachments.MoveVehicle(ctx, a.attachmentsFor(ctx), from, to); err != nil {
+			return err
+		}
+	}
+	if a.tripsFor != nil {
+		if err := a.tripsFor(ctx).MoveVehicle(ctx, from, to); err != nil {
+			return err
+		}
+	}
+	if a.links != nil {
+		if err := connected.MoveVehicle(ctx, a.links, ownerFrom(ctx), from, to); err != nil {
+			return err
+		}
+	}
+	if a.ingestTokens != nil {
+		if err := ingest.MoveVehicle(ctx, a.ingestTokens, ownerFrom(ctx), from, to); err != nil {
+			return err
+		}
+	}
+	if userID := userIDFrom(ctx); userID != "" {
+		for _, st := range a.state {
+			if err := st.MoveUserVehicle(ctx, userID, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleRename gives a vehicle a new id. The new id must be free: renaming
+// onto an existing vehicle is a 409, and combining the two is HandleMerge's job.
+func (a *vehicleMoveAPI) HandleRename(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "vehicle ID required", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+	if !storage.ValidID(req.ID) {
+		writeValidationError(w, "invalid_vehicle_id", "id must be 1-128 characters, without path separators or a leading dot")
+		return
+	}
+
+	err := storeFrom(r.Context()).RenameVehicle(r.Context(), id, req.ID)
+	if errors.Is(err, storage.ErrExists) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(apiErrorResponse{
+			Error: apiError{
+				Code:    "vehicle_already_exists",
+				Message: "a vehicle with that id already exists; merge into it instead",
+			},
+		})
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := a.carry(r.Context(), id, req.ID); err != nil {
+		// Put back what moved, then the vehicle, so a failed rename leaves
+		// everything under the old id.
+		if undoErr := a.carry(r.Context(), req.ID, id); undoErr != nil {
+			err = fmt.Errorf("%w; moving it back also failed: %v", err, undoErr)
+		} else if undoErr := storeFrom(r.Context()).RenameVehicle(r.Context(), req.ID, id); undoErr != nil {
+			err = fmt.Errorf("%w; renaming the vehicle back also failed: %v", err, undoErr)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "renamed", "id": req.ID})
+}
+
+// HandleMerge folds the path vehicle into the one named by "into" and deletes
+// it. The target keeps its name, registration and plan (adopting the source's
+// only where it has none); readings combine as in a CSV import, with
+// "overwrite" letting the source win on shared dates and "force" allowing the
+// combined odometer to decrease.
+func (a *vehicleMoveAPI) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "vehicle ID required", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Into      string `json:"into"`
+		Overwrite bool   `json:"overwrite"`
+		Force     bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "invalid_json", err.Error())
+		return
+	}
+	if req.Into == "" || req.Into == id {
+		writeValidationError(w, "invalid_merge", "into must name a different vehicle")
+		return
+	}
+
+	st := storeFrom(r.Context())
+	snap, err := storage.SnapshotMerge(r.Context(), st, id, req.Into, req.Overwrite)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	var validate func(*model.VehicleData) error
+	if !req.Force {
+		validate = func(merged *model.VehicleData) error {
+			if err := readings.CheckMonotonic(merged.Readings, merged.OdometerChanges); err != nil {
+				return &notMonotonicError{err}
+			}
+			return nil
+		}
+	}
+
+	report, err := st.MergeVehicle(r.Context(), id, req.Into, req.Overwrite, snap.Check(validate))
+	var nm *notMonotonicError
+	if errors.As(err, &nm) {
+		writeValidationError(w, "not_monotonic", nm.err.Error()+"; set force=true to override")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := a.carry(r.Context(), id, req.Into); err != nil {
+		// Put the two vehicles back; whatever state already moved stays on
+		// the target, where merging again would put it anyway.
+		if undoErr := snap.Undo(r.Context(), st); undoErr != nil {
+			err = fmt.Errorf("%w; undoing the merge also failed: %v", err, undoErr)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "merged",
+		"id":          req.Into,
+		"added":       report.Added,
+		"skipped":     report.Skipped,
+		"overwritten": report.Overwritten,
+	})
+}
+
+// notMonotonicError carries a merge's monotonic failure out of the Store's
+// check, so HandleMerge can answer it as a validation error.
+type notMonotonicError struct {
+	err error
+}
+
+func (e *notMonotonicError) Error() string { return e.err.Error() }
@@ -0,0 +1,199 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/api"
+	"github.com/jackiabishop/mileminder/internal/attachments"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// expectStatus runs one JSON POST and fails unless it answers want,
+// returning the body for further checks.
+func expectStatus(t *testing.T, client *http.Client, url, body string, want int) string {
+	t.Helper()
+	code, raw := postJSON(t, client, url, body)
+	if code != want {
+		t.Fatalf("POST %s: want %d, got %d (%s)", url, want, code, raw)
+	}
+	return raw
+}
+
+func TestRenameVehicle(t *testing.T) {
+	srv, st := newTestServer(t, map[string]*model.VehicleData{
+		"tesla": sampleVehicle(),
+		"golf":  sampleVehicle(),
+	})
+	if err := st.SetCurrent(t.Context(), "tesla"); err != nil {
+		t.Fatal(err)
+	}
+	base := srv.URL + "/api/v1/vehicles/"
+
+	expectStatus(t, http.DefaultClient, base+"tesla/rename", `{"id":"../etc"}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base+"ghost/rename", `{"id":"spirit"}`, http.StatusNotFound)
+	expectStatus(t, http.DefaultClient, base+"tesla/rename", `{"id":"golf"}`, http.StatusConflict)
+
+	expectStatus(t, http.DefaultClient, base+"tesla/rename", `{"id":"model3"}`, http.StatusOK)
+	if _, err := st.GetVehicle(t.Context(), "model3"); err != nil {
+		t.Fatalf("renamed vehicle: %v", err)
+	}
+	if cur, _ := st.GetCurrent(t.Context()); cur != "model3" {
+		t.Fatalf("current after rename: want model3, got %q", cur)
+	}
+}
+
+func TestMergeVehicle(t *testing.T) {
+	phone := &model.VehicleData{Vehicle: "Tesla", Readings: map[string]int{"2025-03-01": 6200, "2025-04-01": 4000}}
+	srv, st := newTestServer(t, map[string]*model.VehicleData{
+		"tesla":  phone,
+		"model3": sampleVehicle(),
+	})
+	base := srv.URL + "/api/v1/vehicles/"
+
+	expectStatus(t, http.DefaultClient, base+"tesla/merge", `{"into":"tesla"}`, http.StatusBadRequest)
+	expectStatus(t, http.DefaultClient, base+"tesla/merge", `{"into":"ghost"}`, http.StatusNotFound)
+
+	// 4000 on 2025-04-01 is below the earlier 6200, so the merge needs force.
+	raw := expectStatus(t, http.DefaultClient, base+"tesla/merge", `{"into":"model3"}`, http.StatusBadRequest)
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(raw), &apiErr); err != nil || apiErr.Error.Code != "not_monotonic" {
+		t.Fatalf("want not_monotonic, got %+v (%v)", apiErr, err)
+	}
+	if _, err := st.GetVehicle(t.Context(), "tesla"); err != nil {
+		t.Fatalf("rejected merge must leave the source: %v", err)
+	}
+
+	raw = expectStatus(t, http.DefaultClient, base+"tesla/merge", `{"into":"model3","force":true}`, http.StatusOK)
+	var out struct {
+		ID    string `json:"id"`
+		Added int    `json:"added"`
+	}
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != "model3" || out.Added != 2 {
+		t.Fatalf("merge response: %+v", out)
+	}
+	got, err := st.GetVehicle(t.Context(), "model3")
+	if err != nil || got.Readings["2025-03-01"] != 6200 {
+		t.Fatalf("merged readings: %+v (%v)", got, err)
+	}
+	if _, err := st.GetVehicle(t.Context(), "tesla"); err == nil {
+		t.Fatal("source survived the merge")
+	}
+}
+
+// stuckTrips is a trip store whose trips cannot be moved off vehicle stuck.
+type stuckTrips struct {
+	trips.Store
+	stuck string
+}
+
+func (s stuckTrips) MoveVehicle(ctx context.Context, fromID, toID string) error {
+	if fromID == s.stuck {
+		return errors.New("disk full")
+	}
+	return s.Store.MoveVehicle(ctx, fromID, toID)
+}
+
+// A rename or merge whose trips cannot follow is undone, leaving the vehicles
+// as they were.
+func TestVehicleMoveUndoneWhenTripsCannotMove(t *testing.T) {
+	st := storage.NewMemory()
+	for id, data := range map[string]*model.VehicleData{
+		"tesla":  {Vehicle: "Tesla", Readings: map[string]int{"2025-03-01": 6200}},
+		"model3": sampleVehicle(),
+	} {
+		if err := st.SaveVehicle(t.Context(), id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tripLog := stuckTrips{trips.NewMemory(), "tesla"}
+	srv := httptest.NewServer(api.NewSingleUserRouterDir(api.SingleUserConfig{Store: st, Trips: tripLog}, ""))
+	t.Cleanup(srv.Close)
+	base := srv.URL + "/api/v1/vehicles/"
+
+	expectStatus(t, http.DefaultClient, base+"tesla/rename", `{"id":"roadster"}`, http.StatusInternalServerError)
+	if _, err := st.GetVehicle(t.Context(), "tesla"); err != nil {
+		t.Fatalf("rename not undone: %v", err)
+	}
+
+	expectStatus(t, http.DefaultClient, base+"tesla/merge", `{"into":"model3"}`, http.StatusInternalServerError)
+	if tesla, err := st.GetVehicle(t.Context(), "tesla"); err != nil || tesla.Readings["2025-03-01"] != 6200 {
+		t.Fatalf("merge source not put back: %+v, %v", tesla, err)
+	}
+	if model3, _ := st.GetVehicle(t.Context(), "model3"); len(model3.Readings) != len(sampleVehicle().Readings) {
+		t.Fatalf("merge target not put back: %v", model3.Readings)
+	}
+}
+
+// In hosted mode a rename carries the user's reminder settings and the
+// reading attachments to the new id.
+func TestHostedRenameCarriesDependentState(t *testing.T) {
+	f := newHostedServer(t, nil)
+	client := newClient(t)
+	signup(t, f.srv, client, "alice@example.com", "correct horse battery")
+	createVehicle(t, f.srv, client, "tesla")
+
+	req, _ := http.NewRequest(http.MethodPut, f.srv.URL+"/api/v1/vehicles/tesla/reminders",
+		strings.NewReader(`{"enabled":true,"frequency":"daily"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("put reminders: want 200, got %d", resp.StatusCode)
+	}
+	resp, err = client.Post(f.srv.URL+"/api/v1/vehicles/tesla/readings/2025-01-01/attachments", "image/png", bytes.NewReader(pngPhoto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: want 201, got %d", resp.StatusCode)
+	}
+
+	expectStatus(t, client, f.srv.URL+"/api/v1/vehicles/tesla/rename", `{"id":"model3"}`, http.StatusOK)
+
+	resp, err = client.Get(f.srv.URL + "/api/v1/vehicles/model3/reminders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var settings alerts.ReminderSettings
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Enabled || settings.Frequency != alerts.FrequencyDaily {
+		t.Fatalf("reminder settings did not follow the rename: %+v", settings)
+	}
+
+	resp, err = client.Get(f.srv.URL + "/api/v1/vehicles/model3/readings/2025-01-01/attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list []attachments.Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].VehicleID != "model3" {
+		t.Fatalf("attachments did not follow the rename: %+v", list)
+	}
+}
@@ -0,0 +1,305 @@
+// Package archive defines the full-fidelity, versioned JSON document for one
+// vehicle — identity, plan and readings in a single file — and the import
+// rules that land it in a storage.Store. It is the supported way to move a car
+// between a local install and a hosted account; the CSV and profile exports
+// each carry only part of a vehicle.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Format identifies a vehicle archive, so an unrelated JSON file is rejected
+// up front rather than imported as an empty vehicle.
+const Format = "mileminder.vehicle"
+
+// Version is the document version this build writes. Decode accepts any
+// version up to it; a newer document is refused instead of silently dropping
+// fields this build does not understand.
+const Version = 1
+
+// ErrConflict reports that the archive's vehicle id is already taken and the
+// import was asked to fail rather than rename or merge.
+var ErrConflict = errors.New("vehicle already exists")
+
+// ErrNotMonotonic reports that merging the archive's readings would make the
+// odometer decrease over time and the import was not forced.
+var ErrNotMonotonic = errors.New("merged readings decrease over time")
+
+// Document is one vehicle archive.
+//
+// Metadata is the extension point for data added after version 1 (attachment
+// manifests, service history): each section lives under its own key, and a
+// reader ignores keys it does not know, so optional additions do not need a
+// Version bump. Version changes only when existing fields change meaning.
+type Document struct {
+	Format          string                     `json:"format"`
+	Version         int                        `json:"version"`
+	ExportedAt      time.Time                  `json:"exported_at"`
+	ID              string                     `json:"id"`
+	Vehicle         string                     `json:"vehicle"`
+	Registration    string                     `json:"registration,omitempty"`
+	Plan            *Plan                      `json:"plan,omitempty"`
+	Readings        []Reading                  `json:"readings"`
+	OdometerChanges []model.OdometerChange     `json:"odometer_changes,omitempty"`
+	Metadata        map[string]json.RawMessage `json:"metadata,omitempty"`
+}
+
+// Plan is the allowance plan with calendar dates, matching the profile export.
+type Plan struct {
+	Start           string `json:"start"`
+	End             string `json:"end"`
+	AnnualAllowance int    `json:"annual_allowance"`
+	StartMiles      int    `json:"start_miles"`
+	ExcessRate      int    `json:"excess_rate,omitempty"`
+}
+
+// Reading is one dated odometer value. Readings are a sorted list rather than
+// the stored date → miles map so the file diffs and reads chronologically.
+type Reading struct {
+	Date  string `json:"date"`
+	Miles int    `json:"miles"`
+}
+
+// New builds the archive for vehicle id.
+func New(id string, data *model.VehicleData, now time.Time) *Document {
+	doc := &Document{
+		Format:       Format,
+		Version:      Version,
+		ExportedAt:   now.UTC().Truncate(time.Second),
+		ID:           id,
+		Vehicle:      data.Vehicle,
+		Registration: data.Registration,
+		Readings:     []Reading{},
+
+		OdometerChanges: data.OdometerChanges,
+	}
+	if data.Plan != nil {
+		doc.Plan = &Plan{
+			Start:           data.Plan.Start.Format("2006-01-02"),
+			End:             data.Plan.End.Format("2006-01-02"),
+			AnnualAllowance: data.Plan.AnnualAllowance,
+			StartMiles:      data.Plan.StartMiles,
+			ExcessRate:      data.Plan.ExcessRate,
+		}
+	}
+	for date, miles := range data.Readings {
+		doc.Readings = append(doc.Readings, Reading{Date: date, Miles: miles})
+	}
+	sort.Slice(doc.Readings, func(i, j int) bool { return doc.Readings[i].Date < doc.Readings[j].Date })
+	return doc
+}
+
+// Encode writes doc as indented JSON.
+func Encode(w io.Writer, doc *Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Decode reads and validates an archive. Every problem with the document is
+// reported before anything is written, keeping import all-or-nothing.
+func Decode(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse archive: %w", err)
+	}
+	if doc.Format != Format {
+		return nil, fmt.Errorf("not a vehicle archive (format %q, want %q)", doc.Format, Format)
+	}
+	if doc.Version < 1 || doc.Version > Version {
+		return nil, fmt.Errorf("unsupported archive version %d (this build reads up to %d)", doc.Version, Version)
+	}
+	if !storage.ValidID(doc.ID) {
+		return nil, fmt.Errorf("invalid vehicle id %q in archive", doc.ID)
+	}
+	if _, err := doc.VehicleData(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// VehicleData converts the archive to the stored model, validating the plan
+// dates and readings on the way.
+func (d *Document) VehicleData() (*model.VehicleData, error) {
+	data := &model.VehicleData{
+		Vehicle:      d.Vehicle,
+		Registration: d.Registration,
+		Readings:     make(map[string]int, len(d.Readings)),
+	}
+	if data.Vehicle == "" {
+		data.Vehicle = d.ID
+	}
+	if d.Plan != nil {
+		start, err := time.Parse("2006-01-02", d.Plan.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan start %q", d.Plan.Start)
+		}
+		end, err := time.Parse("2006-01-02", d.Plan.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan end %q", d.Plan.End)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("plan end %s must be after start %s", d.Plan.End, d.Plan.Start)
+		}
+		if d.Plan.AnnualAllowance <= 0 || d.Plan.StartMiles < 0 || d.Plan.ExcessRate < 0 {
+			return nil, fmt.Errorf("plan allowance must be positive and start miles and excess rate not negative")
+		}
+		data.Plan = &model.Plan{
+			Start:           start,
+			End:             end,
+			AnnualAllowance: d.Plan.AnnualAllowance,
+			StartMiles:      d.Plan.StartMiles,
+			ExcessRate:      d.Plan.ExcessRate,
+		}
+	}
+	for _, rd := range d.Readings {
+		if _, err := time.Parse("2006-01-02", rd.Date); err != nil {
+			return nil, fmt.Errorf("invalid reading date %q", rd.Date)
+		}
+		if rd.Miles < 0 {
+			return nil, fmt.Errorf("reading on %s must not be negative", rd.Date)
+		}
+		if _, dup := data.Readings[rd.Date]; dup {
+			return nil, fmt.Errorf("duplicate reading date %s", rd.Date)
+		}
+		data.Readings[rd.Date] = rd.Miles
+	}
+	if err := readings.ValidateChanges(d.OdometerChanges); err != nil {
+		return nil, err
+	}
+	data.OdometerChanges = d.OdometerChanges
+	return data, nil
+}
+
+// Collision policies for an archive whose id is already in use.
+const (
+	OnConflictFail   = "fail"   // refuse with ErrConflict (default)
+	OnConflictRename = "rename" // import under the first free "<id>-N"
+	OnConflictMerge  = "merge"  // merge readings into the existing vehicle
+)
+
+// Options tune Import.
+type Options struct {
+	// ID imports under a different vehicle id than the archive's own.
+	ID string
+	// OnConflict is one of the OnConflict* policies; empty means fail.
+	OnConflict string
+	// Overwrite and Force apply to a merge exactly as they do to a CSV
+	// import: replace readings on shared dates, and allow the combined
+	// readings to decrease.
+	Overwrite bool
+	Force     bool
+}
+
+// Validate reports whether the options are usable, so callers can reject a
+// bad request before reading the store.
+func (o Options) Validate() error {
+	if o.ID != "" && !storage.ValidID(o.ID) {
+		return fmt.Errorf("invalid vehicle id %q", o.ID)
+	}
+	switch o.OnConflict {
+	case "", OnConflictFail, OnConflictRename, OnConflictMerge:
+		return nil
+	default:
+		return fmt.Errorf("unknown conflict policy %q (want %s, %s or %s)", o.OnConflict, OnConflictFail, OnConflictRename, OnConflictMerge)
+	}
+}
+
+// Result describes a completed import.
+type Result struct {
+	ID      string          `json:"id"`
+	Created bool            `json:"created"`
+	Merged  bool            `json:"merged"`
+	Report  readings.Report `json:"report"`
+}
+
+// Import lands doc in st under the collision policy. A new vehicle is written
+// whole, as exported — including any decrease its source had been forced to
+// accept. A merge keeps the existing vehicle's name, registration and plan
+// (adopting the archive's plan only when it has none) and merges readings with
+// readings.Merge and the monotonic rule, so it behaves like importing the
+// archive's readings as a CSV. Either way there is a single write, and a
+// merge checks the readings under the same lock as it saves them.
+func Import(ctx context.Context, st storage.Store, doc *Document, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	incoming, err := doc.VehicleData()
+	if err != nil {
+		return nil, err
+	}
+	id := doc.ID
+	if opts.ID != "" {
+		id = opts.ID
+	}
+
+	existing, err := st.GetVehicle(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if existing == nil {
+		if err := st.SaveVehicle(ctx, id, incoming); err != nil {
+			return nil, fmt.Errorf("save vehicle: %w", err)
+		}
+		return &Result{ID: id, Created: true, Report: readings.Report{Added: len(incoming.Readings)}}, nil
+	}
+
+	switch opts.OnConflict {
+	case OnConflictRename:
+		free, err := freeID(ctx, st, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := st.SaveVehicle(ctx, free, incoming); err != nil {
+			return nil, fmt.Errorf("save vehicle: %w", err)
+		}
+		return &Result{ID: free, Created: true, Report: readings.Report{Added: len(incoming.Readings)}}, nil
+
+	case OnConflictMerge:
+		var report readings.Report
+		err := st.UpdateVehicle(ctx, id, func(data *model.VehicleData) error {
+			var merged *model.VehicleData
+			merged, report = storage.MergeVehicleData(data, incoming, opts.Overwrite)
+			if !opts.Force {
+				if err := readings.CheckMonotonic(merged.Readings, merged.OdometerChanges); err != nil {
+					return fmt.Errorf("%w: %v", ErrNotMonotonic, err)
+				}
+			}
+			*data = *merged
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Result{ID: id, Merged: true, Report: report}, nil
+
+	default:
+		return nil, fmt.Errorf("import %q: %w", id, ErrConflict)
+	}
+}
+
+// freeID returns the first "<id>-N" (N from 2) not already in st.
+func freeID(ctx context.Context, st storage.Store, id string) (string, error) {
+	for n := 2; n < 1000; n++ {
+		candidate := fmt.Sprintf("%s-%d", id, n)
+		_, err := st.GetVehicle(ctx, candidate)
+		if errors.Is(err, storage.ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free id for %q", id)
+}
@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func sampleVehicle() *model.VehicleData {
+	return &model.VehicleData{
+		Vehicle:      "Golf",
+		Registration: "AB12 CDE",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+			ExcessRate:      8,
+		},
+		Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5400},
+	}
+}
+
+func roundTrip(t *testing.T, doc *Document) *Document {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return out
+}
+
+func TestRoundTripPreservesVehicle(t *testing.T) {
+	src := sampleVehicle()
+	doc := roundTrip(t, New("golf", src, time.Now()))
+
+	st := storage.NewMemory()
+	res, err := Import(context.Background(), st, doc, Options{})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if res.ID != "golf" || !res.Created || res.Report.Added != 2 {
+		t.Fatalf("result = %+v", res)
+	}
+	got, _ := st.GetVehicle(context.Background(), "golf")
+	if !reflect.DeepEqual(got, src) {
+		t.Fatalf("imported vehicle = %+v, want %+v", got, src)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name, input, wantMsg string
+	}{
+		{"not json", "date,miles\n", "parse archive"},
+		{"wrong format", `{"format":"other","version":1,"id":"golf"}`, "not a vehicle archive"},
+		{"future version", `{"format":"mileminder.vehicle","version":99,"id":"golf"}`, "unsupported archive version"},
+		{"traversal id", `{"format":"mileminder.vehicle","version":1,"id":"../golf"}`, "invalid vehicle id"},
+		{"bad reading", `{"format":"mileminder.vehicle","version":1,"id":"golf","readings":[{"date":"01/02/2025","miles":1}]}`, "invalid reading date"},
+		{"duplicate reading", `{"format":"mileminder.vehicle","version":1,"id":"golf","readings":[{"date":"2025-01-01","miles":1},{"date":"2025-01-01","miles":2}]}`, "duplicate reading"},
+		{"inverted plan", `{"format":"mileminder.vehicle","version":1,"id":"golf","plan":{"start":"2026-01-01","end":"2025-01-01","annual_allowance":1}}`, "must be after start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Fatalf("want error containing %q, got %v", tt.wantMsg, err)
+			}
+		})
+	}
+}
+
+// Unknown metadata sections from a newer writer are tolerated, not rejected.
+func TestDecodeToleratesUnknownMetadata(t *testing.T) {
+	input := `{"format":"mileminder.vehicle","version":1,"id":"golf","readings":[],"metadata":{"service_history":[{"date":"2025-01-01"}]}}`
+	doc, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, ok := doc.Metadata["service_history"]; !ok {
+		t.Fatal("metadata section dropped")
+	}
+}
+
+func TestImportConflictPolicies(t *testing.T) {
+	ctx := context.Background()
+	incoming := sampleVehicle()
+	incoming.Readings = map[string]int{"2025-02-01": 5450, "2025-03-01": 5900}
+	doc := New("golf", incoming, time.Now())
+
+	newStore := func() storage.Store {
+		st := storage.NewMemory()
+		existing := &model.VehicleData{Vehicle: "My Golf", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5400}}
+		if err := st.SaveVehicle(ctx, "golf", existing); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		if _, err := Import(ctx, newStore(), doc, Options{}); !errors.Is(err, ErrConflict) {
+			t.Fatalf("want ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		st := newStore()
+		st.SaveVehicle(ctx, "golf-2", &model.VehicleData{Vehicle: "Another"})
+		res, err := Import(ctx, st, doc, Options{OnConflict: OnConflictRename})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ID != "golf-3" || !res.Created {
+			t.Fatalf("result = %+v", res)
+		}
+		if kept, _ := st.GetVehicle(ctx, "golf"); kept.Vehicle != "My Golf" {
+			t.Fatalf("rename touched the existing vehicle: %+v", kept)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		st := newStore()
+		res, err := Import(ctx, st, doc, Options{OnConflict: OnConflictMerge})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Merged || res.Report.Added != 1 || res.Report.Skipped != 1 {
+			t.Fatalf("result = %+v", res)
+		}
+		got, _ := st.GetVehicle(ctx, "golf")
+		want := map[string]int{"2025-01-01": 5000, "2025-02-01": 5400, "2025-03-01": 5900}
+		if got.Vehicle != "My Golf" || got.Plan == nil || !reflect.DeepEqual(got.Readings, want) {
+			t.Fatalf("merged vehicle = %+v", got)
+		}
+	})
+
+	t.Run("merge not monotonic", func(t *testing.T) {
+		low := New("golf", &model.VehicleData{Readings: map[string]int{"2025-03-01": 100}}, time.Now())
+		if _, err := Import(ctx, newStore(), low, Options{OnConflict: OnConflictMerge}); !errors.Is(err, ErrNotMonotonic) {
+			t.Fatalf("want ErrNotMonotonic, got %v", err)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		if _, err := Import(ctx, newStore(), doc, Options{OnConflict: "replace"}); err == nil {
+			t.Fatal("want error for unknown policy")
+		}
+	})
+}
@@ -9,15 +9,21 @@ package atomicfile
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// tempInfix marks Write's temp files: ".<name>.tmp-<random>".
+const tempInfix = ".tmp-"
+
 // Write atomically writes path with the given permissions. write is responsible
 // for producing the file's contents; it receives an open, truncated temp file.
 // The parent directory must already exist.
 func Write(path string, perm os.FileMode, write func(*os.File) error) error {
-	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+tempInfix+"*")
 	if err != nil {
 		return fmt.Errorf("create temp file: %w", err)
 	}
@@ -43,3 +49,43 @@ func Write(path string, perm os.FileMode, write func(*os.File) error) error {
 	}
 	return nil
 }
+
+// IsTemp reports whether name is shaped like one of Write's temp files.
+func IsTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempInfix)
+}
+
+// Orphans returns the temp files under dir, recursively, last modified before
+// cutoff. Write removes its temp file on every path but a crash, and a write
+// takes moments, so one that old was left behind by a process that died
+// mid-write; a newer one may belong to a write still in progress. A missing
+// dir has none.
+func Orphans(dir string, cutoff time.Time) ([]string, error) {
+	var orphans []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || !IsTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // its write finished as we looked
+			}
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find temp files: %w", err)
+	}
+	return orphans, nil
+}
@@ -0,0 +1,142 @@
+// Package attachments stores evidence files — dashboard photos, today — against
+// an odometer reading. A lessor disputing the mileage is answered with the photo
+// of the cluster taken on the day, so the attachment is keyed by the same
+// (vehicle id, reading date) pair as the reading itself.
+//
+// Files are content-addressed: the bytes live once under their SHA-256, and a
+// small index maps (vehicle, date) to the hashes attached there. Uploading the
+// same photo twice is therefore a no-op, and deleting an attachment only removes
+// the bytes once nothing else references them.
+//
+// Like storage, the package is mode-blind: single-user mode holds one Store
+// rooted in the data directory, hosted mode obtains a per-user Store from a
+// Tenants. Attachments live outside the vehicle document, so model.VehicleData
+// and internal/calc are untouched.
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MaxSize caps a single attachment. A phone photo of a dashboard is a few MB; 10
+// MB is generous while still bounding hosted-mode uploads.
+const MaxSize = 10 << 20
+
+// allowedTypes is the set of content types accepted as evidence. Types are
+// sniffed from the bytes (never trusted from the client), so only formats
+// net/http's sniffer recognises are listed.
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+var (
+	// ErrNotFound is returned when an attachment does not exist. Callers use
+	// errors.Is(err, ErrNotFound).
+	ErrNotFound = errors.New("not found")
+
+	// ErrTooLarge is returned by Sniff for content over MaxSize.
+	ErrTooLarge = fmt.Errorf("attachment exceeds %d MB", MaxSize>>20)
+
+	// ErrUnsupportedType is returned by Sniff for content that is not an
+	// accepted image format.
+	ErrUnsupportedType = errors.New("attachment must be a JPEG, PNG or WebP image")
+)
+
+// Attachment is the metadata for one file attached to a reading. Hash is the
+// hex SHA-256 of the content and doubles as the attachment's id within the
+// reading.
+type Attachment struct {
+	VehicleID   string    `yaml:"vehicle_id" json:"vehicle_id"`
+	Date        string    `yaml:"date" json:"date"`
+	Hash        string    `yaml:"hash" json:"hash"`
+	ContentType string    `yaml:"content_type" json:"content_type"`
+	Size        int64     `yaml:"size" json:"size"`
+	Filename    string    `yaml:"filename,omitempty" json:"filename,omitempty"`
+	CreatedAt   time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// Store persists attachments for one user (or the single-user install).
+type Store interface {
+	// Put attaches content to the reading identified by a.VehicleID and a.Date.
+	// The store fills Hash, Size and (when zero) CreatedAt, and returns the
+	// stored metadata. Attaching identical content to the same reading again
+	// returns the existing attachment unchanged. Validation (Sniff) is the
+	// caller's job; the store only persists.
+	Put(ctx context.Context, a Attachment, content []byte) (*Attachment, error)
+
+	// List returns the attachments on one reading, oldest first. An empty date
+	// lists every attachment on the vehicle. No attachments is not an error.
+	List(ctx context.Context, vehicleID, date string) ([]Attachment, error)
+
+	// Get returns one attachment's metadata and content, or ErrNotFound.
+	Get(ctx context.Context, vehicleID, date, hash string) (*Attachment, []byte, error)
+
+	// Delete detaches one attachment, or returns ErrNotFound. The content is
+	// removed once no other reading references it.
+	Delete(ctx context.Context, vehicleID, date, hash string) error
+}
+
+// Tenants hands out per-user attachment Stores, mirroring storage.Tenants.
+type Tenants interface {
+	ForUser(userID string) Store
+}
+
+// MoveVehicle re-files every attachment on vehicle fromID under toID, keeping
+// each one's reading date, so evidence follows a vehicle that is renamed or
+// merged into another. Content is addressed by hash, so moving a photo the
+// target already holds on the same date only drops the duplicate reference.
+func MoveVehicle(ctx context.Context, st Store, fromID, toID string) error {
+	list, err := st.List(ctx, fromID, "")
+	if err != nil {
+		return err
+	}
+	for _, a := range list {
+		_, content, err := st.Get(ctx, fromID, a.Date, a.Hash)
+		if err != nil {
+			return err
+		}
+		moved := a
+		moved.VehicleID = toID
+		if _, err := st.Put(ctx, moved, content); err != nil {
+			return err
+		}
+		if err := st.Delete(ctx, fromID, a.Date, a.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sniff validates content as an attachment and returns its detected content
+// type. It is the one rule shared by the CLI and the HTTP layer, so the size and
+// type limits cannot drift between surfaces.
+func Sniff(content []byte) (string, error) {
+	if len(content) > MaxSize {
+		return "", ErrTooLarge
+	}
+	ct := http.DetectContentType(content)
+	if !allowedTypes[ct] {
+		return "", ErrUnsupportedType
+	}
+	return ct, nil
+}
+
+// validHash reports whether h is a lowercase hex SHA-256. File-backed stores
+// join the hash into a path, so anything else is rejected before it gets there.
+func validHash(h string) bool {
+	if len(h) != 64 {
+		return false
+	}
+	for _, r := range h {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,367 @@
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// dirName is the subdirectory of a data directory that holds attachments. A
+// directory (not a *.yml file) keeps it out of yamlstore's vehicle namespace.
+const dirName = "attachments"
+
+// FileStore persists attachments under <dataDir>/attachments: content in
+// objects/<sha256> and the (vehicle, date) → hash index in index.yml. Every
+// method holds an advisory lock on the attachments directory (see
+// internal/filelock) as well as mu, so two FileStores on one directory — one
+// per hosted request, or the CLI beside a running server — cannot lose each
+// other's index entries or collect an object the other has just referenced.
+type FileStore struct {
+	dir string
+	key *crypt.Key // nil unless the data directory is encrypted
+	mu  sync.RWMutex
+}
+
+// NewFileStore returns a FileStore for the data directory dataDir (the same
+// directory the vehicle YAML lives in). Directories are created lazily on first
+// write.
+func NewFileStore(dataDir string) *FileStore {
+	return &FileStore{dir: filepath.Join(dataDir, dirName)}
+}
+
+// NewEncryptedFileStore returns a FileStore that seals the index and every
+// content object with key, the data directory's (see
+// yamlstore.NewEncrypted). Objects keep their names, the SHA-256 of the plain
+// content, so identical photos are still stored once. A nil key makes a
+// plain FileStore, as NewFileStore does.
+func NewEncryptedFileStore(dataDir string, key *crypt.Key) *FileStore {
+	return &FileStore{dir: filepath.Join(dataDir, dirName), key: key}
+}
+
+// Convert re-seals the attachments in dataDir — the index and every content
+// object — from one key to another, as yamlstore.Convert does the vehicles,
+// under the attachments directory's exclusive lock. It returns how many files
+// it rewrote.
+func Convert(dataDir string, from, to *crypt.Key) (int, error) {
+	s := NewFileStore(dataDir)
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		return 0, nil
+	}
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	paths := []string{s.indexPath()}
+	objects, err := os.ReadDir(filepath.Join(s.dir, "objects"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("read attachment dir: %w", err)
+	}
+	for _, e := range objects {
+		if e.Type().IsRegular() && validHash(e.Name()) {
+			paths = append(paths, s.objectPath(e.Name()))
+		}
+	}
+	converted := 0
+	for _, path := range paths {
+		done, err := crypt.ConvertFile(path, from, to)
+		if err != nil {
+			return converted, err
+		}
+		if done {
+			converted++
+		}
+	}
+	return converted, nil
+}
+
+type indexDoc struct {
+	Attachments []Attachment `yaml:"attachments"`
+}
+
+// lockRead takes mu and a shared lock on the directory for a read.
+func (s *FileStore) lockRead() (func(), error) {
+	s.mu.RLock()
+	l, err := filelock.ReadDir(s.dir)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.RUnlock()
+	}, nil
+}
+
+// lockWrite takes mu and the exclusive lock on the directory for a
+// read-modify-write.
+func (s *FileStore) lockWrite() (func(), error) {
+	s.mu.Lock()
+	l, err := filelock.WriteDir(s.dir)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *FileStore) indexPath() string {
+	return filepath.Join(s.dir, "index.yml")
+}
+
+func (s *FileStore) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash)
+}
+
+func (s *FileStore) load() ([]Attachment, error) {
+	raw, err := crypt.ReadFile(s.key, s.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read attachment index: %w", err)
+	}
+	var doc indexDoc
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse attachment index: %w", err)
+	}
+	return doc.Attachments, nil
+}
+
+func (s *FileStore) save(list []Attachment) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("create attachment dir: %w", err)
+	}
+	sortAttachments(list)
+	raw, err := yaml.Marshal(indexDoc{Attachments: list})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.indexPath(), 0644, raw)
+}
+
+// Put writes the content object (if not already present) and then the index
+// entry, so a crash between the two leaves an unreferenced object rather than a
+// dangling index entry.
+func (s *FileStore) Put(ctx context.Context, a Attachment, content []byte) (*Attachment, error) {
+	if a.VehicleID == "" || a.Date == "" {
+		return nil, fmt.Errorf("attachment requires vehicle_id and date")
+	}
+	sum := sha256.Sum256(content)
+	a.Hash = hex.EncodeToString(sum[:])
+	a.Size = int64(len(content))
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range list {
+		if existing.VehicleID == a.VehicleID && existing.Date == a.Date && existing.Hash == a.Hash {
+			cp := existing
+			return &cp, nil
+		}
+	}
+
+	objPath := s.objectPath(a.Hash)
+	if _, err := os.Stat(objPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+			return nil, fmt.Errorf("create attachment dir: %w", err)
+		}
+		if err := crypt.WriteFile(s.key, objPath, 0644, content); err != nil {
+			return nil, fmt.Errorf("write attachment: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("stat attachment: %w", err)
+	}
+
+	if err := s.save(append(list, a)); err != nil {
+		return nil, fmt.Errorf("write attachment index: %w", err)
+	}
+	return &a, nil
+}
+
+func (s *FileStore) List(ctx context.Context, vehicleID, date string) ([]Attachment, error) {
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return filterAttachments(list, vehicleID, date), nil
+}
+
+func (s *FileStore) Get(ctx context.Context, vehicleID, date, hash string) (*Attachment, []byte, error) {
+	if !validHash(hash) {
+		return nil, nil, fmt.Errorf("get attachment %q: %w", hash, ErrNotFound)
+	}
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range list {
+		if a.VehicleID == vehicleID && a.Date == date && a.Hash == hash {
+			content, err := crypt.ReadFile(s.key, s.objectPath(hash))
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil, nil, fmt.Errorf("get attachment %q: content missing: %w", hash, ErrNotFound)
+				}
+				return nil, nil, fmt.Errorf("read attachment %q: %w", hash, err)
+			}
+			cp := a
+			return &cp, content, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("get attachment %q on %s %s: %w", hash, vehicleID, date, ErrNotFound)
+}
+
+// Delete drops the index entry and garbage-collects the object when it was the
+// last reference.
+func (s *FileStore) Delete(ctx context.Context, vehicleID, date, hash string) error {
+	if !validHash(hash) {
+		return fmt.Errorf("delete attachment %q: %w", hash, ErrNotFound)
+	}
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	found := false
+	stillReferenced := false
+	out := list[:0]
+	for _, a := range list {
+		if a.VehicleID == vehicleID && a.Date == date && a.Hash == hash {
+			found = true
+			continue
+		}
+		if a.Hash == hash {
+			stillReferenced = true
+		}
+		out = append(out, a)
+	}
+	if !found {
+		return fmt.Errorf("delete attachment %q on %s %s: %w", hash, vehicleID, date, ErrNotFound)
+	}
+	if err := s.save(out); err != nil {
+		return fmt.Errorf("write attachment index: %w", err)
+	}
+	if !stillReferenced {
+		if err := os.Remove(s.objectPath(hash)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove attachment %q: %w", hash, err)
+		}
+	}
+	return nil
+}
+
+// FileTenants is a Tenants over per-user data directories, <root>/users/<id>,
+// matching yamlstore.Tenants so a user's attachments sit beside their vehicles.
+type FileTenants struct {
+	root string
+	key  *crypt.Key
+}
+
+// NewFileTenants returns a FileTenants rooted at the hosted data root.
+func NewFileTenants(root string) *FileTenants {
+	return &FileTenants{root: root}
+}
+
+// NewEncryptedFileTenants returns a FileTenants whose users' attachments are
+// sealed with key, the hosted data root's. A nil key makes a plain
+// FileTenants.
+func NewEncryptedFileTenants(root string, key *crypt.Key) *FileTenants {
+	return &FileTenants{root: root, key: key}
+}
+
+// ForUser returns the user's attachment store. A malformed user id yields a
+// Store whose every method fails, as yamlstore.Tenants does, so a
+// traversal-shaped id can never resolve to a real directory.
+func (t *FileTenants) ForUser(userID string) Store {
+	if !storage.ValidUserID(userID) {
+		return errStore{err: storage.InvalidUserError(userID)}
+	}
+	return NewEncryptedFileStore(filepath.Join(t.root, "users", userID), t.key)
+}
+
+// errStore is the Store for a malformed user id: every method fails, as
+// storage.ErrStore's do.
+type errStore struct {
+	err error
+}
+
+func (e errStore) Put(context.Context, Attachment, []byte) (*Attachment, error) {
+	return nil, e.err
+}
+func (e errStore) List(context.Context, string, string) ([]Attachment, error) { return nil, e.err }
+func (e errStore) Get(context.Context, string, string, string) (*Attachment, []byte, error) {
+	return nil, nil, e.err
+}
+func (e errStore) Delete(context.Context, string, string, string) error { return e.err }
+
+// filterAttachments returns the entries for vehicleID (and date, when set) in a
+// fresh, sorted slice.
+func filterAttachments(list []Attachment, vehicleID, date string) []Attachment {
+	out := []Attachment{}
+	for _, a := range list {
+		if a.VehicleID == vehicleID && (date == "" || a.Date == date) {
+			out = append(out, a)
+		}
+	}
+	sortAttachments(out)
+	return out
+}
+
+func sortAttachments(list []Attachment) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].VehicleID != list[j].VehicleID {
+			return list[i].VehicleID < list[j].VehicleID
+		}
+		if list[i].Date != list[j].Date {
+			return list[i].Date < list[j].Date
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+}
+
+var (
+	_ Store   = (*FileStore)(nil)
+	_ Tenants = (*FileTenants)(nil)
+	_ Store   = errStore{}
+)
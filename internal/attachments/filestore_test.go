@@ -0,0 +1,244 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+// pngBytes is the smallest content http.DetectContentType reports as image/png.
+var pngBytes = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 16)...)
+
+func stores(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"file":      NewFileStore(t.TempDir()),
+		"encrypted": NewEncryptedFileStore(t.TempDir(), newKey(t)),
+		"memory":    NewMemory(),
+	}
+}
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPutListGetDelete(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			a, err := st.Put(ctx, Attachment{VehicleID: "golf", Date: "2025-06-01", ContentType: "image/png", Filename: "dash.png"}, pngBytes)
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if !validHash(a.Hash) || a.Size != int64(len(pngBytes)) || a.CreatedAt.IsZero() {
+				t.Fatalf("Put did not fill metadata: %+v", a)
+			}
+
+			list, err := st.List(ctx, "golf", "2025-06-01")
+			if err != nil || len(list) != 1 || list[0].Hash != a.Hash {
+				t.Fatalf("List: got %+v err %v", list, err)
+			}
+			if other, _ := st.List(ctx, "golf", "2025-06-02"); len(other) != 0 {
+				t.Fatalf("List leaked across dates: %+v", other)
+			}
+
+			meta, content, err := st.Get(ctx, "golf", "2025-06-01", a.Hash)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if meta.Filename != "dash.png" || !bytes.Equal(content, pngBytes) {
+				t.Fatalf("Get: meta %+v, %d bytes", meta, len(content))
+			}
+
+			if err := st.Delete(ctx, "golf", "2025-06-01", a.Hash); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, _, err := st.Get(ctx, "golf", "2025-06-01", a.Hash); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get after delete: want ErrNotFound, got %v", err)
+			}
+			if err := st.Delete(ctx, "golf", "2025-06-01", a.Hash); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Delete missing: want ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// Identical content on the same reading is stored once; on another reading it
+// shares the object, which survives until its last reference is deleted.
+func TestContentAddressing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := NewFileStore(dir)
+
+	first, err := st.Put(ctx, Attachment{VehicleID: "golf", Date: "2025-06-01"}, pngBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := st.Put(ctx, Attachment{VehicleID: "golf", Date: "2025-06-01"}, pngBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.CreatedAt != first.CreatedAt {
+		t.Fatal("re-uploading identical content created a second attachment")
+	}
+	if _, err := st.Put(ctx, Attachment{VehicleID: "golf", Date: "2025-07-01"}, pngBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := os.ReadDir(filepath.Join(dir, "attachments", "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("want one shared object, got %d", len(objects))
+	}
+
+	if err := st.Delete(ctx, "golf", "2025-06-01", first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attachments", "objects", first.Hash)); err != nil {
+		t.Fatalf("object removed while still referenced: %v", err)
+	}
+	if err := st.Delete(ctx, "golf", "2025-07-01", first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attachments", "objects", first.Hash)); !os.IsNotExist(err) {
+		t.Fatalf("unreferenced object not removed: %v", err)
+	}
+}
+
+func TestMoveVehicle(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			a, err := st.Put(ctx, Attachment{VehicleID: "tesla", Date: "2025-06-01", ContentType: "image/png"}, pngBytes)
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			// The target already holds the same photo on the same date.
+			if _, err := st.Put(ctx, Attachment{VehicleID: "model3", Date: "2025-06-01", ContentType: "image/png"}, pngBytes); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if _, err := st.Put(ctx, Attachment{VehicleID: "tesla", Date: "2025-07-01", ContentType: "image/png"}, pngBytes); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			if err := MoveVehicle(ctx, st, "tesla", "model3"); err != nil {
+				t.Fatalf("MoveVehicle: %v", err)
+			}
+			if left, _ := st.List(ctx, "tesla", ""); len(left) != 0 {
+				t.Fatalf("attachments left on old id: %+v", left)
+			}
+			moved, err := st.List(ctx, "model3", "")
+			if err != nil || len(moved) != 2 {
+				t.Fatalf("moved attachments: got %+v err %v", moved, err)
+			}
+			if _, content, err := st.Get(ctx, "model3", "2025-07-01", a.Hash); err != nil || !bytes.Equal(content, pngBytes) {
+				t.Fatalf("moved content: err %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreRejectsMalformedHash(t *testing.T) {
+	st := NewFileStore(t.TempDir())
+	for _, h := range []string{"", "../index.yml", "ABC", "zz"} {
+		if _, _, err := st.Get(context.Background(), "golf", "2025-06-01", h); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(%q): want ErrNotFound, got %v", h, err)
+		}
+	}
+}
+
+func TestFileTenantsIsolation(t *testing.T) {
+	ctx := context.Background()
+	tn := NewFileTenants(t.TempDir())
+	if _, err := tn.ForUser("alice").Put(ctx, Attachment{VehicleID: "golf", Date: "2025-06-01"}, pngBytes); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := tn.ForUser("bob").List(ctx, "golf", ""); len(list) != 0 {
+		t.Fatalf("bob sees alice's attachments: %+v", list)
+	}
+	if _, err := tn.ForUser("../x").List(ctx, "golf", ""); err == nil {
+		t.Fatal("malformed user id should fail")
+	}
+}
+
+// Each hosted request gets its own FileStore from ForUser, as the CLI and a
+// running server each have their own: concurrent uploads through them must
+// all reach the index.
+func TestPutAcrossStoresLosesNothing(t *testing.T) {
+	ctx := context.Background()
+	tn := NewFileTenants(t.TempDir())
+	errs := make(chan error)
+	for i := range 20 {
+		go func() {
+			_, err := tn.ForUser("alice").Put(ctx, Attachment{VehicleID: "golf", Date: fmt.Sprintf("2025-06-%02d", i+1)}, pngBytes)
+			errs <- err
+		}()
+	}
+	for range 20 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, _ := tn.ForUser("alice").List(ctx, "golf", ""); len(list) != 20 {
+		t.Fatalf("kept %d of 20 attachments", len(list))
+	}
+}
+
+func TestSniff(t *testing.T) {
+	if ct, err := Sniff(pngBytes); err != nil || ct != "image/png" {
+		t.Fatalf("Sniff(png) = %q, %v", ct, err)
+	}
+	if _, err := Sniff([]byte("%PDF-1.7 not a photo")); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("Sniff(pdf): want ErrUnsupportedType, got %v", err)
+	}
+	if _, err := Sniff(make([]byte, MaxSize+1)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Sniff(oversize): want ErrTooLarge, got %v", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, err := NewFileStore(dir).Put(ctx, Attachment{VehicleID: "golf", Date: "2025-06-01", Filename: "dash.png"}, pngBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := newKey(t)
+	if n, err := Convert(dir, nil, key); err != nil || n != 2 {
+		t.Fatalf("encrypt: %d files, %v; want the index and the object", n, err)
+	}
+	for _, path := range []string{filepath.Join(dir, "attachments", "index.yml"), filepath.Join(dir, "attachments", "objects", a.Hash)} {
+		if raw, err := os.ReadFile(path); err != nil || !crypt.IsSealed(raw) {
+			t.Fatalf("%s not sealed: %v", filepath.Base(path), err)
+		}
+	}
+	if n, err := Convert(dir, key, key); err != nil || n != 0 {
+		t.Fatalf("rerun: %d files, %v; want nothing left to do", n, err)
+	}
+	if _, err := NewFileStore(dir).List(ctx, "golf", ""); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+	if _, content, err := NewEncryptedFileStore(dir, key).Get(ctx, "golf", "2025-06-01", a.Hash); err != nil || !bytes.Equal(content, pngBytes) {
+		t.Fatalf("encrypted store: %v", err)
+	}
+
+	if n, err := Convert(dir, key, nil); err != nil || n != 2 {
+		t.Fatalf("decrypt: %d files, %v", n, err)
+	}
+	if _, content, err := NewFileStore(dir).Get(ctx, "golf", "2025-06-01", a.Hash); err != nil || !bytes.Equal(content, pngBytes) {
+		t.Fatalf("after decrypt: %v", err)
+	}
+}
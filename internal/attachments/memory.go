@@ -0,0 +1,119 @@
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store for api and cmd tests.
+type Memory struct {
+	mu      sync.Mutex
+	index   []Attachment
+	objects map[string][]byte
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{objects: map[string][]byte{}}
+}
+
+func (m *Memory) Put(ctx context.Context, a Attachment, content []byte) (*Attachment, error) {
+	if a.VehicleID == "" || a.Date == "" {
+		return nil, fmt.Errorf("attachment requires vehicle_id and date")
+	}
+	sum := sha256.Sum256(content)
+	a.Hash = hex.EncodeToString(sum[:])
+	a.Size = int64(len(content))
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.index {
+		if existing.VehicleID == a.VehicleID && existing.Date == a.Date && existing.Hash == a.Hash {
+			cp := existing
+			return &cp, nil
+		}
+	}
+	if _, ok := m.objects[a.Hash]; !ok {
+		m.objects[a.Hash] = append([]byte(nil), content...)
+	}
+	m.index = append(m.index, a)
+	return &a, nil
+}
+
+func (m *Memory) List(ctx context.Context, vehicleID, date string) ([]Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return filterAttachments(m.index, vehicleID, date), nil
+}
+
+func (m *Memory) Get(ctx context.Context, vehicleID, date, hash string) (*Attachment, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.index {
+		if a.VehicleID == vehicleID && a.Date == date && a.Hash == hash {
+			cp := a
+			return &cp, append([]byte(nil), m.objects[hash]...), nil
+		}
+	}
+	return nil, nil, fmt.Errorf("get attachment %q on %s %s: %w", hash, vehicleID, date, ErrNotFound)
+}
+
+func (m *Memory) Delete(ctx context.Context, vehicleID, date, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := false
+	stillReferenced := false
+	out := m.index[:0]
+	for _, a := range m.index {
+		if a.VehicleID == vehicleID && a.Date == date && a.Hash == hash {
+			found = true
+			continue
+		}
+		if a.Hash == hash {
+			stillReferenced = true
+		}
+		out = append(out, a)
+	}
+	m.index = out
+	if !found {
+		return fmt.Errorf("delete attachment %q on %s %s: %w", hash, vehicleID, date, ErrNotFound)
+	}
+	if !stillReferenced {
+		delete(m.objects, hash)
+	}
+	return nil
+}
+
+// MemoryTenants is an in-memory Tenants; each user gets a lazily-created Memory.
+type MemoryTenants struct {
+	mu    sync.Mutex
+	users map[string]*Memory
+}
+
+// NewMemoryTenants returns an empty in-memory Tenants.
+func NewMemoryTenants() *MemoryTenants {
+	return &MemoryTenants{users: map[string]*Memory{}}
+}
+
+func (t *MemoryTenants) ForUser(userID string) Store {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.users[userID]
+	if !ok {
+		st = NewMemory()
+		t.users[userID] = st
+	}
+	return st
+}
+
+var (
+	_ Store   = (*Memory)(nil)
+	_ Tenants = (*MemoryTenants)(nil)
+)
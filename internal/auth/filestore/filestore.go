@@ -1,7 +1,10 @@
 // Package filestore is the interim, file-backed implementation of the auth
 // stores used in hosted mode before Phase 3's Postgres. Users live in
 // <root>/users.yml and sessions in <root>/sessions.yml, each a mutex-guarded
-// whole-file document written atomically. The data is tiny (accounts + active
+// whole-file document written atomically. An advisory lock beside each file
+// (<root>/.users.yml.lock and so on) serialises access across processes too,
+// so an admin CLI command and a running server cannot lose each other's
+// updates. The data is tiny (accounts + active
 // sessions), so load-all / save-all per operation is more than adequate at the
 // "me + a few testers" scale this phase targets; Phase 3 replaces it wholesale
 // behind the same auth.UserStore / auth.SessionStore interfaces.
@@ -16,14 +19,17 @@ import (
 	"sync"
 	"time"
 
-	"github.com/jackiabishop/mileminder/internal/atomicfile"
 	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+	"github.com/jackiabishop/mileminder/internal/schema"
 	"gopkg.in/yaml.v3"
 )
 
 // UserStore is a file-backed auth.UserStore.
 type UserStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -33,19 +39,84 @@ func NewUserStore(root string) *UserStore {
 	return &UserStore{path: filepath.Join(root, "users.yml")}
 }
 
+// NewEncryptedUserStore is NewUserStore sealed with key, the data root's
+// encryption key, or plain for a nil key.
+func NewEncryptedUserStore(root string, key *crypt.Key) *UserStore {
+	return &UserStore{path: filepath.Join(root, "users.yml"), key: key}
+}
+
+// Convert re-seals the file and its schema backups from one key to another,
+// reporting whether any needed it (see crypt.ConvertFile).
+func (s *UserStore) Convert(from, to *crypt.Key) (bool, error) {
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return convertWithBackups(s.path, from, to)
+}
+
+// lock takes mu and the cross-process lock for the file at path, returning a
+// func that releases both. Methods hold it around their whole load/save.
+func lock(mu *sync.Mutex, path string) (func(), error) {
+	mu.Lock()
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	l, err := filelock.Exclusive(filepath.Join(dir, "."+filepath.Base(path)+".lock"))
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		mu.Unlock()
+	}, nil
+}
+
+// opener decodes a file sealed with key, for schema.BackupBeforeWriteOpen.
+func opener(key *crypt.Key) func([]byte) ([]byte, error) {
+	return func(raw []byte) ([]byte, error) { return crypt.Open(key, raw) }
+}
+
+// convertWithBackups re-seals the file at path and the schema backups
+// BackupBeforeWrite made of it, reporting whether any needed it.
+func convertWithBackups(path string, from, to *crypt.Key) (bool, error) {
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(path), schema.BackupDir, filepath.Base(path)+".v*"))
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, p := range append([]string{path}, backups...) {
+		done, err := crypt.ConvertFile(p, from, to)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || done
+	}
+	return changed, nil
+}
+
 type usersDoc struct {
-	Users []*auth.User `yaml:"users"`
+	SchemaVersion int          `yaml:"schema_version"`
+	Users         []*auth.User `yaml:"users"`
 }
 
 // load reads the users file. A missing file is an empty set. Callers hold mu.
 func (s *UserStore) load() ([]*auth.User, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("read users file: %w", err)
 	}
+	raw, _, err = schema.Upgrade(schema.Users, raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse users file: %w", err)
+	}
 	var doc usersDoc
 	if err := yaml.Unmarshal(raw, &doc); err != nil {
 		return nil, fmt.Errorf("parse users file: %w", err)
@@ -58,21 +129,24 @@ func (s *UserStore) save(users []*auth.User) error {
 	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 		return fmt.Errorf("create data dir: %w", err)
 	}
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(usersDoc{Users: users}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	if err := schema.BackupBeforeWriteOpen(schema.Users, s.path, opener(s.key)); err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(usersDoc{SchemaVersion: schema.Current(schema.Users), Users: users})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func (s *UserStore) CreateUser(ctx context.Context, email, passwordHash string) (*auth.User, error) {
 	email = auth.NormalizeEmail(email)
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	users, err := s.load()
 	if err != nil {
@@ -98,8 +172,11 @@ func (s *UserStore) CreateUser(ctx context.Context, email, passwordHash string)
 func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*auth.User, error) {
 	email = auth.NormalizeEmail(email)
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	users, err := s.load()
 	if err != nil {
@@ -115,8 +192,11 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*auth.Use
 }
 
 func (s *UserStore) GetUserByID(ctx context.Context, id string) (*auth.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	users, err := s.load()
 	if err != nil {
@@ -132,8 +212,11 @@ func (s *UserStore) GetUserByID(ctx context.Context, id string) (*auth.User, err
 }
 
 func (s *UserStore) ListUsers(ctx context.Context) ([]*auth.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	users, err := s.load()
 	if err != nil {
@@ -149,8 +232,11 @@ func (s *UserStore) ListUsers(ctx context.Context) ([]*auth.User, error) {
 }
 
 func (s *UserStore) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	users, err := s.load()
 	if err != nil {
@@ -168,6 +254,7 @@ func (s *UserStore) UpdatePassword(ctx context.Context, userID, passwordHash str
 // SessionStore is a file-backed auth.SessionStore.
 type SessionStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -176,18 +263,40 @@ func NewSessionStore(root string) *SessionStore {
 	return &SessionStore{path: filepath.Join(root, "sessions.yml")}
 }
 
+// NewEncryptedSessionStore is NewSessionStore sealed with key, the data
+// root's encryption key, or plain for a nil key.
+func NewEncryptedSessionStore(root string, key *crypt.Key) *SessionStore {
+	return &SessionStore{path: filepath.Join(root, "sessions.yml"), key: key}
+}
+
+// Convert re-seals the file and its schema backups from one key to another,
+// reporting whether any needed it (see crypt.ConvertFile).
+func (s *SessionStore) Convert(from, to *crypt.Key) (bool, error) {
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return convertWithBackups(s.path, from, to)
+}
+
 type sessionsDoc struct {
-	Sessions []*auth.Session `yaml:"sessions"`
+	SchemaVersion int             `yaml:"schema_version"`
+	Sessions      []*auth.Session `yaml:"sessions"`
 }
 
 func (s *SessionStore) load() ([]*auth.Session, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("read sessions file: %w", err)
 	}
+	raw, _, err = schema.Upgrade(schema.Sessions, raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse sessions file: %w", err)
+	}
 	var doc sessionsDoc
 	if err := yaml.Unmarshal(raw, &doc); err != nil {
 		return nil, fmt.Errorf("parse sessions file: %w", err)
@@ -199,14 +308,14 @@ func (s *SessionStore) save(sessions []*auth.Session) error {
 	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 		return fmt.Errorf("create data dir: %w", err)
 	}
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(sessionsDoc{Sessions: sessions}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	if err := schema.BackupBeforeWriteOpen(schema.Sessions, s.path, opener(s.key)); err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(sessionsDoc{SchemaVersion: schema.Current(schema.Sessions), Sessions: sessions})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 // prune drops expired sessions so the file cannot grow without bound. It runs on
@@ -222,8 +331,11 @@ func prune(sessions []*auth.Session, now time.Time) []*auth.Session {
 }
 
 func (s *SessionStore) CreateSession(ctx context.Context, tokenHash, userID string, expires time.Time) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	sessions, err := s.load()
 	if err != nil {
@@ -235,8 +347,11 @@ func (s *SessionStore) CreateSession(ctx context.Context, tokenHash, userID stri
 }
 
 func (s *SessionStore) GetSession(ctx context.Context, tokenHash string) (*auth.Session, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	sessions, err := s.load()
 	if err != nil {
@@ -255,8 +370,11 @@ func (s *SessionStore) GetSession(ctx context.Context, tokenHash string) (*auth.
 }
 
 func (s *SessionStore) DeleteSession(ctx context.Context, tokenHash string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	sessions, err := s.load()
 	if err != nil {
@@ -272,8 +390,11 @@ func (s *SessionStore) DeleteSession(ctx context.Context, tokenHash string) erro
 }
 
 func (s *SessionStore) DeleteUserSessions(ctx context.Context, userID, exceptTokenHash string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	sessions, err := s.load()
 	if err != nil {
@@ -290,8 +411,11 @@ func (s *SessionStore) DeleteUserSessions(ctx context.Context, userID, exceptTok
 }
 
 func (s *SessionStore) TouchSession(ctx context.Context, tokenHash string, expires time.Time) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	sessions, err := s.load()
 	if err != nil {
@@ -314,6 +438,7 @@ func (s *SessionStore) TouchSession(ctx context.Context, tokenHash string, expir
 // PasswordResetStore is a file-backed auth.PasswordResetStore.
 type PasswordResetStore struct {
 	path string
+	key  *crypt.Key // nil unless the data root is encrypted
 	mu   sync.Mutex
 }
 
@@ -322,18 +447,40 @@ func NewPasswordResetStore(root string) *PasswordResetStore {
 	return &PasswordResetStore{path: filepath.Join(root, "resets.yml")}
 }
 
+// NewEncryptedPasswordResetStore is NewPasswordResetStore sealed with key,
+// the data root's encryption key, or plain for a nil key.
+func NewEncryptedPasswordResetStore(root string, key *crypt.Key) *PasswordResetStore {
+	return &PasswordResetStore{path: filepath.Join(root, "resets.yml"), key: key}
+}
+
+// Convert re-seals the file and its schema backups from one key to another,
+// reporting whether any needed it (see crypt.ConvertFile).
+func (s *PasswordResetStore) Convert(from, to *crypt.Key) (bool, error) {
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return convertWithBackups(s.path, from, to)
+}
+
 type resetsDoc struct {
-	Resets []*auth.PasswordReset `yaml:"resets"`
+	SchemaVersion int                   `yaml:"schema_version"`
+	Resets        []*auth.PasswordReset `yaml:"resets"`
 }
 
 func (s *PasswordResetStore) load() ([]*auth.PasswordReset, error) {
-	raw, err := os.ReadFile(s.path)
+	raw, err := crypt.ReadFile(s.key, s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("read resets file: %w", err)
 	}
+	raw, _, err = schema.Upgrade(schema.PasswordResets, raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse resets file: %w", err)
+	}
 	var doc resetsDoc
 	if err := yaml.Unmarshal(raw, &doc); err != nil {
 		return nil, fmt.Errorf("parse resets file: %w", err)
@@ -345,14 +492,14 @@ func (s *PasswordResetStore) save(resets []*auth.PasswordReset) error {
 	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 		return fmt.Errorf("create data dir: %w", err)
 	}
-	return atomicfile.Write(s.path, 0600, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(resetsDoc{Resets: resets}); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	if err := schema.BackupBeforeWriteOpen(schema.PasswordResets, s.path, opener(s.key)); err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(resetsDoc{SchemaVersion: schema.Current(schema.PasswordResets), Resets: resets})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
 }
 
 func pruneResets(resets []*auth.PasswordReset, now time.Time) []*auth.PasswordReset {
@@ -366,8 +513,11 @@ func pruneResets(resets []*auth.PasswordReset, now time.Time) []*auth.PasswordRe
 }
 
 func (s *PasswordResetStore) CreateReset(ctx context.Context, tokenHash, userID string, expires time.Time) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	resets, err := s.load()
 	if err != nil {
@@ -385,8 +535,11 @@ func (s *PasswordResetStore) CreateReset(ctx context.Context, tokenHash, userID
 }
 
 func (s *PasswordResetStore) ConsumeReset(ctx context.Context, tokenHash string) (*auth.PasswordReset, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	resets, err := s.load()
 	if err != nil {
@@ -418,8 +571,11 @@ func (s *PasswordResetStore) ConsumeReset(ctx context.Context, tokenHash string)
 }
 
 func (s *PasswordResetStore) DeleteResetsForUser(ctx context.Context, userID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := lock(&s.mu, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	resets, err := s.load()
 	if err != nil {
@@ -2,12 +2,17 @@ package filestore_test
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/auth"
 	"github.com/jackiabishop/mileminder/internal/auth/authtest"
 	"github.com/jackiabishop/mileminder/internal/auth/filestore"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/schema"
 )
 
 func TestFileUserStoreConformance(t *testing.T) {
@@ -28,6 +33,53 @@ func TestFilePasswordResetStoreConformance(t *testing.T) {
 	})
 }
 
+func TestEncryptedUserStoreConformance(t *testing.T) {
+	authtest.RunUserStore(t, func(t *testing.T) auth.UserStore {
+		return filestore.NewEncryptedUserStore(t.TempDir(), newKey(t))
+	})
+}
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Converting the users file covers the schema backups taken of it too.
+func TestUserStoreConvert(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := filestore.NewUserStore(dir).CreateUser(ctx, "alice@example.com", "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, schema.BackupDir, "users.yml.v0")
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backup, []byte("users: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := newKey(t)
+	if changed, err := filestore.NewUserStore(dir).Convert(nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	for _, path := range []string{filepath.Join(dir, "users.yml"), backup} {
+		if raw, err := os.ReadFile(path); err != nil || !crypt.IsSealed(raw) {
+			t.Fatalf("%s not sealed: %v", path, err)
+		}
+	}
+	if _, err := filestore.NewUserStore(dir).GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+	if got, err := filestore.NewEncryptedUserStore(dir, key).GetUserByEmail(ctx, "alice@example.com"); err != nil || got.PasswordHash != "hash1" {
+		t.Fatalf("encrypted store: %+v, %v", got, err)
+	}
+}
+
 // A user written by one store handle must be visible to a fresh handle over the
 // same directory — i.e. the data actually persists to disk.
 func TestFileUserStorePersistsAcrossReopen(t *testing.T) {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
 )
 
 // Status represents computed status for a vehicle. JSON tags mirror the
@@ -19,7 +20,7 @@ type Status struct {
 	Vehicle             string    `json:"vehicle"`
 	Registration        string    `json:"registration,omitempty"`
 	HasPlan             bool      `json:"has_plan"`
-	LatestReading       int       `json:"latest_reading"`
+	LatestReading       int       `json:"latest_reading"` // on the current odometer, like StartMilesCurrent
 	LatestDate          string    `json:"latest_date"`
 	TargetToday         float64   `json:"target_today"`
 	Delta               float64   `json:"delta"`
@@ -37,7 +38,8 @@ type Status struct {
 	PlanStart           time.Time `json:"plan_start"`
 	PlanEnd             time.Time `json:"plan_end"`
 	AnnualAllowance     int       `json:"annual_allowance"`
-	StartMiles          int       `json:"start_miles"`
+	StartMiles          int       `json:"start_miles"`         // plan start as entered
+	StartMilesCurrent   int       `json:"start_miles_current"` // plan start, shifted past any later odometer change
 	IsDefault           bool      `json:"is_default"`
 
 	// Renewal countdown + final-mileage estimate (#3). DaysToEnd is the total
@@ -159,10 +161,12 @@ type DatedReading struct {
 	Miles float64
 }
 
-// SortedReadings returns the vehicle's readings parsed and sorted by date.
+// SortedReadings returns the vehicle's readings parsed and sorted by date, on
+// the current odometer's scale: a reading from before an odometer change is
+// shifted so the series is continuous across it.
 func SortedReadings(data *model.VehicleData) []DatedReading {
 	out := make([]DatedReading, 0, len(data.Readings))
-	for ds, m := range data.Readings {
+	for ds, m := range readings.Continuous(data.Readings, data.OdometerChanges) {
 		if t, err := time.Parse("2006-01-02", ds); err == nil {
 			out = append(out, DatedReading{Date: t, Miles: float64(m)})
 		}
@@ -211,6 +215,16 @@ func AllowanceMiles(annualAllowance int, planStart, at time.Time) float64 {
 	return float64(annualAllowance) * daysElapsed / 365.0
 }
 
+// StartMiles is the plan's start mileage on the current odometer's scale — the
+// baseline SortedReadings values are measured against — or 0 for a vehicle
+// without a plan.
+func StartMiles(data *model.VehicleData) int {
+	if data.Plan == nil {
+		return 0
+	}
+	return data.Plan.StartMiles - readings.ShiftAt(data.OdometerChanges, data.Plan.Start.Format("2006-01-02"))
+}
+
 // ComputeStatus calculates all status metrics for a vehicle as of now.
 func ComputeStatus(id string, data *model.VehicleData) Status {
 	return computeStatus(id, data, time.Now())
@@ -227,9 +241,14 @@ func ComputeStatusAt(id string, data *model.VehicleData, now time.Time) Status {
 func computeStatus(id string, data *model.VehicleData, now time.Time) Status {
 	today := now
 
+	// Every figure below is on the current odometer's scale, so distance is
+	// measured across any odometer change rather than read as a drop.
+	odometer := readings.Continuous(data.Readings, data.OdometerChanges)
+	startMiles := StartMiles(data)
+
 	// Find latest reading
 	var dates []string
-	for d := range data.Readings {
+	for d := range odometer {
 		dates = append(dates, d)
 	}
 	sort.Strings(dates)
@@ -238,7 +257,7 @@ func computeStatus(id string, data *model.VehicleData, now time.Time) Status {
 	latestMiles := 0
 	if len(dates) > 0 {
 		latestDate = dates[len(dates)-1]
-		latestMiles = data.Readings[latestDate]
+		latestMiles = odometer[latestDate]
 	}
 
 	readings := SortedReadings(data)
@@ -302,19 +321,19 @@ func computeStatus(id string, data *model.VehicleData, now time.Time) Status {
 
 	plan := data.Plan
 	if len(dates) == 0 {
-		latestMiles = plan.StartMiles
+		latestMiles = startMiles
 	}
 	// Compute target vs actual
 	daysElapsed := today.Sub(plan.Start).Hours() / 24.0
 	if daysElapsed < 0 {
 		daysElapsed = 0
 	}
-	targetToday := float64(plan.StartMiles) + float64(plan.AnnualAllowance)*daysElapsed/365.0
-	milesUsed := float64(latestMiles - plan.StartMiles)
-	delta := milesUsed - (targetToday - float64(plan.StartMiles))
+	targetToday := float64(startMiles) + float64(plan.AnnualAllowance)*daysElapsed/365.0
+	milesUsed := float64(latestMiles - startMiles)
+	delta := milesUsed - (targetToday - float64(startMiles))
 
 	var pctUsed float64
-	targetMileage := targetToday - float64(plan.StartMiles)
+	targetMileage := targetToday - float64(startMiles)
 	if targetMileage > 0 {
 		pctUsed = milesUsed / targetMileage * 100.0
 	}
@@ -402,7 +421,7 @@ func computeStatus(id string, data *model.VehicleData, now time.Time) Status {
 	// the total term allowance, and the penalty at the plan's excess rate. Rate
 	// and cost are both in currency minor units; conversion to major units is a
 	// client/display concern.
-	projectedMilesDriven := estimatedFinalMileage - float64(plan.StartMiles)
+	projectedMilesDriven := estimatedFinalMileage - float64(startMiles)
 	projectedExcessMiles := projectedMilesDriven - totalTermAllowanceMiles
 	if projectedExcessMiles < 0 {
 		projectedExcessMiles = 0
@@ -448,6 +467,7 @@ func computeStatus(id string, data *model.VehicleData, now time.Time) Status {
 		PlanEnd:             plan.End,
 		AnnualAllowance:     plan.AnnualAllowance,
 		StartMiles:          plan.StartMiles,
+		StartMilesCurrent:   startMiles,
 
 		DaysToEnd:                 daysToEnd,
 		EstimatedFinalMileage:     estimatedFinalMileage,
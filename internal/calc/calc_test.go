@@ -18,7 +18,7 @@ func date(s string) time.Time {
 	return t
 }
 
-func readings(pairs ...DatedReading) []DatedReading { return pairs }
+func series(pairs ...DatedReading) []DatedReading { return pairs }
 
 func r(d string, m float64) DatedReading { return DatedReading{Date: date(d), Miles: m} }
 
@@ -27,7 +27,7 @@ const eps = 1e-6
 func almostEqual(a, b float64) bool { return math.Abs(a-b) <= eps }
 
 func TestOdometerAt(t *testing.T) {
-	rs := readings(
+	rs := series(
 		r("2025-01-01", 1000),
 		r("2025-01-11", 1100), // +100 miles over 10 days
 		r("2025-02-10", 1400),
@@ -61,7 +61,7 @@ func TestOdometerAt_Empty(t *testing.T) {
 }
 
 func TestOdometerAt_SingleReading(t *testing.T) {
-	rs := readings(r("2025-01-01", 1000))
+	rs := series(r("2025-01-01", 1000))
 	for _, at := range []time.Time{date("2024-01-01"), date("2025-01-01"), date("2026-01-01")} {
 		got, ok := OdometerAt(rs, at)
 		if !ok || got != 1000 {
@@ -72,7 +72,7 @@ func TestOdometerAt_SingleReading(t *testing.T) {
 
 func TestOdometerAt_SameDateZeroSpan(t *testing.T) {
 	// Two readings on the same date: interpolation must not divide by zero.
-	rs := readings(r("2025-01-01", 1000), r("2025-01-01", 1200), r("2025-02-01", 1500))
+	rs := series(r("2025-01-01", 1000), r("2025-01-01", 1200), r("2025-02-01", 1500))
 	if got, ok := OdometerAt(rs, date("2025-01-15")); !ok || math.IsNaN(got) || math.IsInf(got, 0) {
 		t.Errorf("same-date span: got (%v, %v), want finite value", got, ok)
 	}
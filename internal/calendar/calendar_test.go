@@ -0,0 +1,79 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func planVehicle() *model.VehicleData {
+	return &model.VehicleData{
+		Vehicle: "Golf, GTI",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+		},
+		Readings: map[string]int{"2025-06-01": 9000},
+	}
+}
+
+func TestFeedEvents(t *testing.T) {
+	now := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+	reminder := alerts.ReminderSettings{Enabled: true, Frequency: alerts.FrequencyWeekly}
+	feed := string(Feed([]Vehicle{{ID: "golf", Data: planVehicle(), Reminder: &reminder}}, now))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:allowance-year-golf-20260101@mileminder\r\n",
+		"SUMMARY:Golf\\, GTI: allowance year 2 starts\r\n",
+		"UID:allowance-year-golf-20270101@mileminder\r\n",
+		"UID:plan-end-golf-20280101@mileminder\r\n",
+		"DTSTART;VALUE=DATE:20280101\r\n",
+		"UID:reading-reminder-golf@mileminder\r\n",
+		"DTSTART;VALUE=DATE:20250608\r\n", // a week after the last reading
+		"RRULE:FREQ=DAILY;INTERVAL=7\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed missing %q", want)
+		}
+	}
+	if strings.Count(feed, "BEGIN:VEVENT") != 4 {
+		t.Errorf("want 4 events (2 anniversaries, plan end, reminder), got:\n%s", feed)
+	}
+	for _, line := range strings.Split(feed, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+}
+
+func TestFeedReminderOverdueAndDisabled(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	on := alerts.ReminderSettings{Enabled: true, Frequency: alerts.FrequencyDaily}
+	feed := string(Feed([]Vehicle{{ID: "golf", Data: planVehicle(), Reminder: &on}}, now))
+	if !strings.Contains(feed, "DTSTART;VALUE=DATE:20250901\r\nDTEND;VALUE=DATE:20250902\r\nRRULE:FREQ=DAILY;INTERVAL=1") {
+		t.Errorf("overdue reminder should be due today:\n%s", feed)
+	}
+
+	off := alerts.ReminderSettings{Enabled: false, Frequency: alerts.FrequencyDaily}
+	plain := &model.VehicleData{Vehicle: "Van", Readings: map[string]int{"2025-01-01": 100}}
+	feed = string(Feed([]Vehicle{{ID: "golf", Data: planVehicle(), Reminder: &off}, {ID: "van", Data: plain}}, now))
+	if strings.Contains(feed, "reading-reminder") || strings.Contains(feed, "-van-") {
+		t.Errorf("disabled reminder or plan-less vehicle produced events:\n%s", feed)
+	}
+}
+
+func TestWriteFoldedKeepsRunes(t *testing.T) {
+	var b strings.Builder
+	writeFolded(&b, "SUMMARY:"+strings.Repeat("é", 60))
+	unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+	if unfolded != "SUMMARY:"+strings.Repeat("é", 60)+"\r\n" {
+		t.Fatalf("folding corrupted the line: %q", b.String())
+	}
+}
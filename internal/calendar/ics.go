@@ -0,0 +1,184 @@
+// Package calendar renders a vehicle's key dates as an iCalendar (RFC 5545)
+// feed — plan anniversaries (the allowance-year resets), plan end and the next
+// reading-reminder due date — and stores the secret tokens that let calendar
+// apps subscribe to it without a session. The feed is derived from calc.Status
+// and the reminder settings on every fetch; nothing about it is persisted.
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/alerts"
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+// Vehicle is one vehicle in a feed. Reminder is nil when reading reminders are
+// not configured (always, in single-user mode).
+type Vehicle struct {
+	ID       string
+	Data     *model.VehicleData
+	Reminder *alerts.ReminderSettings
+}
+
+type event struct {
+	uid     string
+	date    time.Time
+	summary string
+	desc    string
+	rrule   string
+}
+
+// Feed renders the calendar for vehicles as of now. Events are all-day and keep
+// stable UIDs across fetches, so a subscribed calendar updates them in place
+// instead of duplicating them.
+func Feed(vehicles []Vehicle, now time.Time) []byte {
+	var events []event
+	for _, v := range vehicles {
+		events = append(events, vehicleEvents(v, now)...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].date.Equal(events[j].date) {
+			return events[i].date.Before(events[j].date)
+		}
+		return events[i].uid < events[j].uid
+	})
+
+	var b strings.Builder
+	line := func(s string) { writeFolded(&b, s) }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//MileMinder//Mileage calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:MileMinder")
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.uid)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + e.date.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + e.date.AddDate(0, 0, 1).Format("20060102"))
+		if e.rrule != "" {
+			line("RRULE:" + e.rrule)
+		}
+		line("SUMMARY:" + escapeText(e.summary))
+		if e.desc != "" {
+			line("DESCRIPTION:" + escapeText(e.desc))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+func vehicleEvents(v Vehicle, now time.Time) []event {
+	st := calc.ComputeStatusAt(v.ID, v.Data, now)
+	name := st.Vehicle
+	if name == "" {
+		name = v.ID
+	}
+	var events []event
+
+	if st.HasPlan {
+		// Each anniversary of the plan start begins a new allowance year; the
+		// last one before the end is the final year.
+		years := 0
+		for at := st.PlanStart.AddDate(1, 0, 0); at.Before(st.PlanEnd); at = st.PlanStart.AddDate(years+1, 0, 0) {
+			years++
+			events = append(events, event{
+				uid:     uid(v.ID, "allowance-year", at),
+				date:    at,
+				summary: fmt.Sprintf("%s: allowance year %d starts", name, years+1),
+				desc:    fmt.Sprintf("Plan anniversary. A fresh %d-mile allowance year begins.", st.AnnualAllowance),
+			})
+		}
+
+		desc := fmt.Sprintf("Plan ends. Projected final odometer %.0f mi.", st.EstimatedFinalMileage)
+		if st.ProjectedExcessMiles > 0 {
+			desc += fmt.Sprintf(" Projected %.0f mi over the term allowance.", st.ProjectedExcessMiles)
+		}
+		events = append(events, event{
+			uid:     uid(v.ID, "plan-end", st.PlanEnd),
+			date:    st.PlanEnd,
+			summary: fmt.Sprintf("%s: plan ends", name),
+			desc:    desc,
+		})
+	}
+
+	if due, ok := reminderDue(v, st, now); ok {
+		interval := v.Reminder.IntervalDays()
+		events = append(events, event{
+			// Keyed by vehicle only: the due date moves with every reading,
+			// and the calendar should move the one event rather than add more.
+			uid:     fmt.Sprintf("reading-reminder-%s@mileminder", v.ID),
+			date:    due,
+			summary: fmt.Sprintf("%s: log an odometer reading", name),
+			desc:    fmt.Sprintf("No reading for %d days. Reminders repeat every %d day(s) until one is logged.", int(due.Sub(baseline(v, st)).Hours()/24), interval),
+			rrule:   fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", interval),
+		})
+	}
+	return events
+}
+
+// reminderDue is the next date a reading reminder falls due, by the
+// scheduler's rule: the configured interval after the last reading (or the plan
+// start for a plan with no readings). An overdue reminder is shown today.
+func reminderDue(v Vehicle, st calc.Status, now time.Time) (time.Time, bool) {
+	if v.Reminder == nil || !v.Reminder.Enabled || v.Reminder.IntervalDays() <= 0 {
+		return time.Time{}, false
+	}
+	from := baseline(v, st)
+	if from.IsZero() {
+		return time.Time{}, false
+	}
+	due := from.AddDate(0, 0, v.Reminder.IntervalDays())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if due.Before(today) {
+		due = today
+	}
+	return due, true
+}
+
+// baseline is the date reminders count from: the latest reading, else the plan
+// start, else zero (nothing to anchor on).
+func baseline(v Vehicle, st calc.Status) time.Time {
+	if t, err := time.Parse("2006-01-02", st.LatestDate); err == nil {
+		return t
+	}
+	if v.Data.HasPlan() {
+		return v.Data.Plan.Start
+	}
+	return time.Time{}
+}
+
+func uid(vehicleID, kind string, date time.Time) string {
+	return fmt.Sprintf("%s-%s-%s@mileminder", kind, vehicleID, date.Format("20060102"))
+}
+
+// escapeText escapes a TEXT value (RFC 5545 §3.3.11).
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeFolded writes one content line, folded at 75 octets (RFC 5545 §3.1)
+// without splitting a UTF-8 sequence, and terminated with CRLF.
+func writeFolded(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,26 @@
+package calendar
+
+import (
+	"path/filepath"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+// NewFileTokenStore returns the feed token store in dir, <dir>/calendar_tokens.
+// Feed tokens have no VehicleID: an owner's one token covers all their
+// vehicles.
+func NewFileTokenStore(dir string) *tokenstore.FileStore {
+	return tokenstore.NewFile(filepath.Join(dir, "calendar_tokens"), "calendar token")
+}
+
+// NewEncryptedFileTokenStore is NewFileTokenStore sealed with key, the
+// directory's encryption key, or plain for a nil key.
+func NewEncryptedFileTokenStore(dir string, key *crypt.Key) *tokenstore.FileStore {
+	return tokenstore.NewEncryptedFile(filepath.Join(dir, "calendar_tokens"), "calendar token", key)
+}
+
+// NewMemoryTokenStore returns an empty in-memory feed token store for tests.
+func NewMemoryTokenStore() *tokenstore.MemoryStore {
+	return tokenstore.NewMemory("calendar token")
+}
@@ -0,0 +1,199 @@
+// Package connected captures odometer readings automatically from
+// connected-car services. A Provider is one such service; a Link ties a
+// MileMinder vehicle to a vehicle on a provider account; the Poller fetches
+// each linked vehicle's odometer on an interval and records it through
+// storage.Store.UpdateVehicle like any other reading, attributed in the journal
+// to "auto:<provider>" so automatic readings are told apart from typed ones.
+//
+// Links are keyed by owner — the hosted user id, or storage.LocalOwner in
+// single-user mode — like calendar feed tokens, and live in one file in the data root. No
+// real provider ships yet; FileProvider is a fake backed by a file, so the
+// whole pipeline can be exercised offline.
+package connected
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+var (
+	// ErrNotFound is returned for a vehicle with no link.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorised is returned by Provider.Authorise for a credential the
+	// service refuses.
+	ErrUnauthorised = errors.New("provider refused the credential")
+
+	// ErrBelowMax is returned by Poll when the provider's odometer is below
+	// the vehicle's readings. Automatic capture never forces past the rule.
+	ErrBelowMax = errors.New("provider odometer is below the vehicle's readings")
+
+	// ErrImplausible wraps readings.CheckPlausible's error for a provider
+	// odometer too far from the vehicle's readings to be real.
+	ErrImplausible = errors.New("implausible provider odometer")
+)
+
+// Provider is a connected-car service.
+type Provider interface {
+	// Authorise exchanges a user's credential — an API key, or the code from
+	// an OAuth redirect — for the token later calls are made with, or returns
+	// an error wrapping ErrUnauthorised.
+	Authorise(ctx context.Context, credential string) (token string, err error)
+
+	// Vehicles lists the vehicles on the account.
+	Vehicles(ctx context.Context, token string) ([]RemoteVehicle, error)
+
+	// Odometer returns a vehicle's current odometer.
+	Odometer(ctx context.Context, token, remoteID string) (*Odometer, error)
+}
+
+// RemoteVehicle is a vehicle as a provider lists it.
+type RemoteVehicle struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Odometer is a provider's odometer value, converted to miles, and when the
+// car reported it.
+type Odometer struct {
+	Miles int
+	At    time.Time
+}
+
+// Registry holds the providers a server offers, by name.
+type Registry map[string]Provider
+
+// Names lists the registered providers, sorted.
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Link ties a vehicle to a provider vehicle. The token is the provider's
+// credential and is never served back over the API.
+type Link struct {
+	Owner     string    `yaml:"owner" json:"-"`
+	VehicleID string    `yaml:"vehicle_id" json:"vehicle_id"`
+	Provider  string    `yaml:"provider" json:"provider"`
+	RemoteID  string    `yaml:"remote_id" json:"remote_id"`
+	Token     string    `yaml:"token" json:"-"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+
+	// The outcome of the last poll: when it ran, the reading it recorded (or
+	// confirmed) and why it failed, if it did.
+	LastPolledAt *time.Time `yaml:"last_polled_at,omitempty" json:"last_polled_at,omitempty"`
+	LastDate     string     `yaml:"last_date,omitempty" json:"last_date,omitempty"`
+	LastMiles    int        `yaml:"last_miles,omitempty" json:"last_miles,omitempty"`
+	LastError    string     `yaml:"last_error,omitempty" json:"last_error,omitempty"`
+}
+
+// LinkStore persists links, one per owner and vehicle.
+type LinkStore interface {
+	// Put creates or replaces the link for l.Owner and l.VehicleID.
+	Put(ctx context.Context, l Link) error
+	// Get returns a vehicle's link, or ErrNotFound.
+	Get(ctx context.Context, owner, vehicleID string) (*Link, error)
+	// List returns an owner's links, or every link when owner is "".
+	List(ctx context.Context, owner string) ([]Link, error)
+	// Delete removes a vehicle's link, or returns ErrNotFound.
+	Delete(ctx context.Context, owner, vehicleID string) error
+	// RecordPoll copies the outcome of a poll of l (the Last* fields) onto
+	// the stored link, leaving every other field alone. A poll is slow, so
+	// the link may have been deleted or relinked meanwhile: if the stored
+	// link is gone or no longer has l's provider, remote vehicle and token,
+	// nothing is written and ErrNotFound is returned.
+	RecordPoll(ctx context.Context, l Link) error
+}
+
+// Actor is the journal actor automatic readings from provider are recorded
+// under.
+func Actor(provider string) string {
+	return "auto:" + provider
+}
+
+// Poll fetches l's odometer and records it as the reading for the day the car
+// reported it (in now's location). A value the vehicle already has is left
+// alone, one below the vehicle's readings is refused with ErrBelowMax, and one
+// readings.CheckPlausible rejects is refused with ErrImplausible. The outcome
+// is noted on l; persisting l is the caller's job.
+func Poll(ctx context.Context, st storage.Store, p Provider, l *Link, now time.Time) error {
+	err := poll(ctx, st, p, l, now)
+	polled := now.UTC()
+	l.LastPolledAt, l.LastError = &polled, ""
+	if err != nil {
+		l.LastError = err.Error()
+	}
+	return err
+}
+
+func poll(ctx context.Context, st storage.Store, p Provider, l *Link, now time.Time) error {
+	o, err := p.Odometer(ctx, l.Token, l.RemoteID)
+	if err != nil {
+		return fmt.Errorf("fetch odometer: %w", err)
+	}
+	at := o.At
+	if at.IsZero() {
+		at = now
+	}
+	date := at.In(now.Location()).Format("2006-01-02")
+
+	err = st.UpdateVehicle(journal.WithActor(ctx, Actor(l.Provider)), l.VehicleID, func(data *model.VehicleData) error {
+		if miles, ok := data.Readings[date]; ok && miles == o.Miles {
+			return errUnchanged
+		}
+		if max, below := readings.BelowMax(data.Readings, data.OdometerChanges, date, o.Miles); below {
+			return fmt.Errorf("%w: %d is less than existing max %d", ErrBelowMax, o.Miles, max)
+		}
+		if err := readings.CheckPlausible(data.Readings, data.OdometerChanges, date, o.Miles, now.Format("2006-01-02")); err != nil {
+			return fmt.Errorf("%w: %w", ErrImplausible, err)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[date] = o.Miles
+		return nil
+	})
+	if err != nil && !errors.Is(err, errUnchanged) {
+		return err
+	}
+	l.LastDate, l.LastMiles = date, o.Miles
+	return nil
+}
+
+// errUnchanged aborts poll's update when the vehicle already has the reading.
+var errUnchanged = errors.New("reading unchanged")
+
+// MoveVehicle re-keys owner's link on fromID to toID when a vehicle is renamed
+// or merged. If toID already has a link it wins and fromID's is dropped: a
+// vehicle reads one odometer.
+func MoveVehicle(ctx context.Context, links LinkStore, owner, fromID, toID string) error {
+	l, err := links.Get(ctx, owner, fromID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := links.Get(ctx, owner, toID); errors.Is(err, ErrNotFound) {
+		moved := *l
+		moved.VehicleID = toID
+		if err := links.Put(ctx, moved); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return links.Delete(ctx, owner, fromID)
+}
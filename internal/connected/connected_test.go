@@ -0,0 +1,200 @@
+package connected
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func writeAccount(t *testing.T, path, odometer string) {
+	t.Helper()
+	doc := "credential: letmein\nvehicles:\n  - id: VIN1\n    name: Golf\n    odometer: " + odometer +
+		"\n    unit: km\n    at: 2025-06-02T08:00:00Z\n"
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fake.yml")
+	writeAccount(t, path, "16093.44")
+	p := NewFileProvider(path)
+
+	if _, err := p.Authorise(ctx, "wrong"); !errors.Is(err, ErrUnauthorised) {
+		t.Fatalf("want ErrUnauthorised, got %v", err)
+	}
+	token, err := p.Authorise(ctx, "letmein")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicles, err := p.Vehicles(ctx, token)
+	if err != nil || len(vehicles) != 1 || vehicles[0].ID != "VIN1" {
+		t.Fatalf("Vehicles: %+v, %v", vehicles, err)
+	}
+	o, err := p.Odometer(ctx, token, "VIN1")
+	if err != nil || o.Miles != 10000 {
+		t.Fatalf("Odometer: %+v, %v", o, err)
+	}
+	if _, err := p.Odometer(ctx, token, "VIN2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown vehicle: %v", err)
+	}
+}
+
+func TestPollerRecordsAutomaticReadings(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fake.yml")
+	writeAccount(t, path, "16093.44")
+
+	st := journal.Wrap(storage.NewMemory(), journal.NewMemoryLog(), "web")
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-06-01": 9990}})
+	links := NewMemoryLinkStore()
+	links.Put(ctx, Link{Owner: storage.LocalOwner, VehicleID: "golf", Provider: "fake", RemoteID: "VIN1", Token: "letmein"})
+	links.Put(ctx, Link{Owner: storage.LocalOwner, VehicleID: "polo", Provider: "gone", RemoteID: "VIN9"})
+
+	p := &Poller{
+		Links:     links,
+		Providers: Registry{"fake": NewFileProvider(path)},
+		StoreFor:  func(string) storage.Store { return st },
+		Now:       func() time.Time { return time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC) },
+		Logger:    log.New(io.Discard, "", 0),
+	}
+	if n := p.RunOnce(ctx); n != 1 {
+		t.Fatalf("polled %d links cleanly, want 1", n)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-06-02"] != 10000 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+	if history[0].Actor != "auto:fake" {
+		t.Fatalf("reading not tagged automatic: %+v", history[0])
+	}
+	l, _ := links.Get(ctx, storage.LocalOwner, "golf")
+	if l.LastPolledAt == nil || l.LastMiles != 10000 || l.LastError != "" {
+		t.Fatalf("link: %+v", l)
+	}
+
+	// The same value again writes nothing; a lower one is refused.
+	p.RunOnce(ctx)
+	if history, _ := st.History(ctx, "golf", 0); len(history) != 2 {
+		t.Fatalf("unchanged odometer rewritten: %d entries", len(history))
+	}
+	writeAccount(t, path, "1000")
+	p.RunOnce(ctx)
+	l, _ = links.Get(ctx, storage.LocalOwner, "golf")
+	if !strings.Contains(l.LastError, "below") {
+		t.Fatalf("want below-max error noted, got %+v", l)
+	}
+	if data, _ := st.GetVehicle(ctx, "golf"); data.Readings["2025-06-02"] != 10000 {
+		t.Fatalf("lower odometer written: %v", data.Readings)
+	}
+
+	// A mis-scaled value far beyond a day's driving is refused too.
+	writeAccount(t, path, "1609344")
+	p.RunOnce(ctx)
+	l, _ = links.Get(ctx, storage.LocalOwner, "golf")
+	if !strings.Contains(l.LastError, "implausible") {
+		t.Fatalf("want implausible error noted, got %+v", l)
+	}
+	if data, _ := st.GetVehicle(ctx, "golf"); data.Readings["2025-06-02"] != 10000 {
+		t.Fatalf("implausible odometer written: %v", data.Readings)
+	}
+}
+
+func TestLinkStores(t *testing.T) {
+	ctx := context.Background()
+	for name, links := range map[string]LinkStore{
+		"file":   NewFileLinkStore(t.TempDir()),
+		"memory": NewMemoryLinkStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			links.Put(ctx, Link{Owner: "u1", VehicleID: "golf", Provider: "fake", RemoteID: "A"})
+			links.Put(ctx, Link{Owner: "u1", VehicleID: "golf", Provider: "fake", RemoteID: "B"})
+			links.Put(ctx, Link{Owner: "u2", VehicleID: "golf", Provider: "fake", RemoteID: "C"})
+			if l, err := links.Get(ctx, "u1", "golf"); err != nil || l.RemoteID != "B" {
+				t.Fatalf("Get: %+v, %v", l, err)
+			}
+			if all, _ := links.List(ctx, ""); len(all) != 2 {
+				t.Fatalf("List all: %+v", all)
+			}
+
+			if err := MoveVehicle(ctx, links, "u1", "golf", "gti"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := links.Get(ctx, "u1", "golf"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("old link kept: %v", err)
+			}
+			if l, _ := links.Get(ctx, "u1", "gti"); l == nil || l.RemoteID != "B" {
+				t.Fatalf("link not moved: %+v", l)
+			}
+
+			if err := links.Delete(ctx, "u2", "golf"); err != nil {
+				t.Fatal(err)
+			}
+			if err := links.Delete(ctx, "u2", "golf"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("second delete: %v", err)
+			}
+		})
+	}
+}
+
+// midPoll is a Provider whose Odometer calls during before answering, standing
+// in for a request to the API landing while a slow poll is in flight.
+type midPoll struct {
+	Provider
+	during func()
+}
+
+func (m midPoll) Odometer(ctx context.Context, token, remoteID string) (*Odometer, error) {
+	m.during()
+	return m.Provider.Odometer(ctx, token, remoteID)
+}
+
+func TestPollerKeepsChangesMadeDuringAPoll(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fake.yml")
+	writeAccount(t, path, "16093.44")
+	st := storage.NewMemory()
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{}})
+	links := NewFileLinkStore(t.TempDir())
+	link := Link{Owner: storage.LocalOwner, VehicleID: "golf", Provider: "fake", RemoteID: "VIN1", Token: "letmein"}
+
+	var during func()
+	p := &Poller{
+		Links:     links,
+		Providers: Registry{"fake": midPoll{NewFileProvider(path), func() { during() }}},
+		StoreFor:  func(string) storage.Store { return st },
+		Now:       func() time.Time { return time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC) },
+		Logger:    log.New(io.Discard, "", 0),
+	}
+
+	links.Put(ctx, link)
+	during = func() { links.Delete(ctx, storage.LocalOwner, "golf") }
+	p.RunOnce(ctx)
+	if _, err := links.Get(ctx, storage.LocalOwner, "golf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("a link deleted during the poll came back: %v", err)
+	}
+
+	links.Put(ctx, link)
+	during = func() {
+		relinked := link
+		relinked.Token = "fresh"
+		links.Put(ctx, relinked)
+	}
+	p.RunOnce(ctx)
+	l, err := links.Get(ctx, storage.LocalOwner, "golf")
+	if err != nil || l.Token != "fresh" || l.LastPolledAt != nil {
+		t.Fatalf("relinked during the poll: %+v, %v", l, err)
+	}
+}
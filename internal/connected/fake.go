@@ -0,0 +1,103 @@
+package connected
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileProvider is a fake Provider backed by a YAML file, for trying the
+// connected-car pipeline and testing it without a real service:
+//
+//	credential: letmein        # the one credential Authorise accepts
+//	vehicles:
+//	  - id: WVWZZZ1KZ          # the provider's vehicle id
+//	    name: Golf
+//	    odometer: 12345
+//	    unit: km               # mi (default) or km
+//	    at: 2025-06-01T08:00:00Z   # optional; default now
+//
+// The file is read on every call, so editing it simulates driving. The token
+// it hands out is the credential itself.
+type FileProvider struct {
+	path string
+}
+
+// NewFileProvider returns a FileProvider reading path.
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+type fakeAccount struct {
+	Credential string `yaml:"credential"`
+	Vehicles   []struct {
+		ID       string    `yaml:"id"`
+		Name     string    `yaml:"name"`
+		Odometer float64   `yaml:"odometer"`
+		Unit     string    `yaml:"unit"`
+		At       time.Time `yaml:"at"`
+	} `yaml:"vehicles"`
+}
+
+func (p *FileProvider) load(token string) (*fakeAccount, error) {
+	raw, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("read fake provider: %w", err)
+	}
+	var acct fakeAccount
+	if err := yaml.Unmarshal(raw, &acct); err != nil {
+		return nil, fmt.Errorf("parse fake provider: %w", err)
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(acct.Credential)) != 1 {
+		return nil, ErrUnauthorised
+	}
+	return &acct, nil
+}
+
+func (p *FileProvider) Authorise(ctx context.Context, credential string) (string, error) {
+	if _, err := p.load(credential); err != nil {
+		return "", err
+	}
+	return credential, nil
+}
+
+func (p *FileProvider) Vehicles(ctx context.Context, token string) ([]RemoteVehicle, error) {
+	acct, err := p.load(token)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RemoteVehicle, 0, len(acct.Vehicles))
+	for _, v := range acct.Vehicles {
+		out = append(out, RemoteVehicle{ID: v.ID, Name: v.Name})
+	}
+	return out, nil
+}
+
+func (p *FileProvider) Odometer(ctx context.Context, token, remoteID string) (*Odometer, error) {
+	acct, err := p.load(token)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range acct.Vehicles {
+		if v.ID != remoteID {
+			continue
+		}
+		miles := v.Odometer
+		switch v.Unit {
+		case "", "mi":
+		case "km":
+			miles /= 1.609344
+		default:
+			return nil, fmt.Errorf("vehicle %s: unknown unit %q", remoteID, v.Unit)
+		}
+		return &Odometer{Miles: int(math.Round(miles)), At: v.At}, nil
+	}
+	return nil, fmt.Errorf("vehicle %s: %w", remoteID, ErrNotFound)
+}
+
+var _ Provider = (*FileProvider)(nil)
@@ -0,0 +1,241 @@
+package connected
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+// FileLinkStore persists links in <dir>/connected_links. The name has no .yml
+// extension, like the calendar token file, so it can live in a single-user
+// data directory without being read as a vehicle; it holds provider tokens,
+// so it is written owner-only.
+type FileLinkStore struct {
+	path string
+	key  *crypt.Key // nil unless the data directory is encrypted
+	mu   sync.Mutex
+}
+
+// NewFileLinkStore returns a FileLinkStore in dir, created lazily.
+func NewFileLinkStore(dir string) *FileLinkStore {
+	return &FileLinkStore{path: filepath.Join(dir, "connected_links")}
+}
+
+// NewEncryptedFileLinkStore returns a FileLinkStore whose file is sealed
+// with key, the directory's encryption key. A nil key makes a plain one, as
+// NewFileLinkStore does.
+func NewEncryptedFileLinkStore(dir string, key *crypt.Key) *FileLinkStore {
+	return &FileLinkStore{path: filepath.Join(dir, "connected_links"), key: key}
+}
+
+// Convert re-seals the links file from one key to another, reporting whether
+// it needed it (see crypt.ConvertFile).
+func (s *FileLinkStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
+type linksDoc struct {
+	Links []Link `yaml:"links"`
+}
+
+func (s *FileLinkStore) load() ([]Link, error) {
+	raw, err := crypt.ReadFile(s.key, s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read connected links: %w", err)
+	}
+	var doc linksDoc
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse connected links: %w", err)
+	}
+	return doc.Links, nil
+}
+
+func (s *FileLinkStore) save(links []Link) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	sortLinks(links)
+	raw, err := yaml.Marshal(linksDoc{Links: links})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
+}
+
+func (s *FileLinkStore) Put(ctx context.Context, l Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(without(links, l.Owner, l.VehicleID), l))
+}
+
+func (s *FileLinkStore) Get(ctx context.Context, owner, vehicleID string) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return findLink(links, owner, vehicleID)
+}
+
+func (s *FileLinkStore) List(ctx context.Context, owner string) ([]Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return filterLinks(links, owner), nil
+}
+
+func (s *FileLinkStore) Delete(ctx context.Context, owner, vehicleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links, err := s.load()
+	if err != nil {
+		return err
+	}
+	out := without(links, owner, vehicleID)
+	if len(out) == len(links) {
+		return fmt.Errorf("connected link for %s: %w", vehicleID, ErrNotFound)
+	}
+	return s.save(out)
+}
+
+func (s *FileLinkStore) RecordPoll(ctx context.Context, l Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := recordPoll(links, l); err != nil {
+		return err
+	}
+	return s.save(links)
+}
+
+// MemoryLinkStore is an in-memory LinkStore for tests.
+type MemoryLinkStore struct {
+	mu    sync.Mutex
+	links []Link
+}
+
+// NewMemoryLinkStore returns an empty MemoryLinkStore.
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{}
+}
+
+func (m *MemoryLinkStore) Put(ctx context.Context, l Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.links = append(without(m.links, l.Owner, l.VehicleID), l)
+	sortLinks(m.links)
+	return nil
+}
+
+func (m *MemoryLinkStore) Get(ctx context.Context, owner, vehicleID string) (*Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return findLink(m.links, owner, vehicleID)
+}
+
+func (m *MemoryLinkStore) List(ctx context.Context, owner string) ([]Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return filterLinks(m.links, owner), nil
+}
+
+func (m *MemoryLinkStore) Delete(ctx context.Context, owner, vehicleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := without(m.links, owner, vehicleID)
+	if len(out) == len(m.links) {
+		return fmt.Errorf("connected link for %s: %w", vehicleID, ErrNotFound)
+	}
+	m.links = out
+	return nil
+}
+
+func (m *MemoryLinkStore) RecordPoll(ctx context.Context, l Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return recordPoll(m.links, l)
+}
+
+// recordPoll copies l's poll outcome onto the same link in links, in place.
+func recordPoll(links []Link, l Link) error {
+	for i := range links {
+		stored := &links[i]
+		if stored.Owner != l.Owner || stored.VehicleID != l.VehicleID {
+			continue
+		}
+		if stored.Provider != l.Provider || stored.RemoteID != l.RemoteID || stored.Token != l.Token {
+			break
+		}
+		stored.LastPolledAt, stored.LastDate, stored.LastMiles, stored.LastError = l.LastPolledAt, l.LastDate, l.LastMiles, l.LastError
+		return nil
+	}
+	return fmt.Errorf("connected link for %s: %w", l.VehicleID, ErrNotFound)
+}
+
+// without returns links minus owner's link on vehicleID, in a fresh slice.
+func without(links []Link, owner, vehicleID string) []Link {
+	out := make([]Link, 0, len(links))
+	for _, l := range links {
+		if l.Owner != owner || l.VehicleID != vehicleID {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func findLink(links []Link, owner, vehicleID string) (*Link, error) {
+	for _, l := range links {
+		if l.Owner == owner && l.VehicleID == vehicleID {
+			cp := l
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("connected link for %s: %w", vehicleID, ErrNotFound)
+}
+
+func filterLinks(links []Link, owner string) []Link {
+	out := []Link{}
+	for _, l := range links {
+		if owner == "" || l.Owner == owner {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func sortLinks(links []Link) {
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Owner != links[j].Owner {
+			return links[i].Owner < links[j].Owner
+		}
+		return links[i].VehicleID < links[j].VehicleID
+	})
+}
+
+var (
+	_ LinkStore = (*FileLinkStore)(nil)
+	_ LinkStore = (*MemoryLinkStore)(nil)
+)
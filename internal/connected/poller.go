@@ -0,0 +1,85 @@
+package connected
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Poller periodically polls every link. StoreFor resolves a link's owner to
+// the Store its vehicle lives in: the one process-wide store in single-user
+// mode, the user's scoped store in hosted mode.
+type Poller struct {
+	Links     LinkStore
+	Providers Registry
+	StoreFor  func(owner string) storage.Store
+	Interval  time.Duration
+	Now       func() time.Time
+	Logger    *log.Logger
+}
+
+// Run executes RunOnce immediately, then on Interval until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	p.RunOnce(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce polls every link once and returns how many polled cleanly. A link
+// that fails is logged, its error noted on the link, and skipped so one bad
+// account does not stall the rest. A link deleted or relinked while it was
+// being polled keeps its new state; the outcome is dropped.
+func (p *Poller) RunOnce(ctx context.Context) int {
+	links, err := p.Links.List(ctx, "")
+	if err != nil {
+		p.logf("connected: list links: %v", err)
+		return 0
+	}
+	ok := 0
+	for _, l := range links {
+		provider, found := p.Providers[l.Provider]
+		if !found {
+			p.logf("connected: %s/%s: provider %q is not configured", l.Owner, l.VehicleID, l.Provider)
+			continue
+		}
+		if err := Poll(ctx, p.StoreFor(l.Owner), provider, &l, p.now()); err != nil {
+			p.logf("connected: %s/%s: %v", l.Owner, l.VehicleID, err)
+		} else {
+			ok++
+		}
+		if err := p.Links.RecordPoll(ctx, l); err != nil && !errors.Is(err, ErrNotFound) {
+			p.logf("connected: %s/%s: save link: %v", l.Owner, l.VehicleID, err)
+		}
+	}
+	return ok
+}
+
+func (p *Poller) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *Poller) logf(format string, args ...any) {
+	logger := p.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
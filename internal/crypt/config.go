@@ -0,0 +1,225 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+)
+
+// ConfigFile is the file in an encrypted directory that records how its key
+// is obtained. Its presence is what marks the directory as encrypted.
+const ConfigFile = ".encryption"
+
+// Key sources.
+const (
+	SourcePassphrase = "passphrase"
+	SourceKeyFile    = "keyfile"
+)
+
+// Conversions a Config can be part-way through.
+const (
+	PendingEncrypt = "encrypt"
+	PendingDecrypt = "decrypt"
+	PendingRotate  = "rotate"
+)
+
+// scrypt cost for new passphrase keys: the parameters recommended for
+// interactive logins, about 100ms on current hardware.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Config is an encrypted directory's ConfigFile.
+type Config struct {
+	// Source is SourcePassphrase or SourceKeyFile.
+	Source string `yaml:"source"`
+	// Scrypt is how a passphrase key is derived.
+	Scrypt *Scrypt `yaml:"scrypt,omitempty"`
+	// KeyID is the id of the directory's key, to tell a wrong passphrase or
+	// key file from corrupt data.
+	KeyID string `yaml:"key_id"`
+	// Pending names a conversion that started and has not finished: the
+	// directory holds a mix of files until it is rerun.
+	Pending string `yaml:"pending,omitempty"`
+	// Next is the key a rotation is moving to.
+	Next *Config `yaml:"next,omitempty"`
+}
+
+// Scrypt holds the parameters a passphrase key was derived with.
+type Scrypt struct {
+	Salt string `yaml:"salt"` // base64
+	N    int    `yaml:"n"`
+	R    int    `yaml:"r"`
+	P    int    `yaml:"p"`
+}
+
+// NewPassphraseConfig derives a key from passphrase with a fresh salt and
+// returns it with the Config that derives it again.
+func NewPassphraseConfig(passphrase []byte) (*Config, *Key, error) {
+	if len(passphrase) == 0 {
+		return nil, nil, errors.New("empty passphrase")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, fmt.Errorf("generate salt: %w", err)
+	}
+	params := &Scrypt{Salt: base64.StdEncoding.EncodeToString(salt), N: scryptN, R: scryptR, P: scryptP}
+	key, err := params.derive(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Config{Source: SourcePassphrase, Scrypt: params, KeyID: key.ID()}, key, nil
+}
+
+// NewKeyFileConfig returns the Config for a directory sealed with key, read
+// from a key file.
+func NewKeyFileConfig(key *Key) *Config {
+	return &Config{Source: SourceKeyFile, KeyID: key.ID()}
+}
+
+func (s *Scrypt) derive(passphrase []byte) (*Key, error) {
+	salt, err := base64.StdEncoding.DecodeString(s.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("scrypt salt: %w", err)
+	}
+	raw, err := scrypt.Key(passphrase, salt, s.N, s.R, s.P, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	return keyFrom(raw)
+}
+
+// PassphraseKey derives c's key from passphrase, returning ErrWrongKey if it
+// is not the passphrase the directory was encrypted with.
+func (c *Config) PassphraseKey(passphrase []byte) (*Key, error) {
+	if c.Source != SourcePassphrase || c.Scrypt == nil {
+		return nil, fmt.Errorf("key source is %q, not a passphrase", c.Source)
+	}
+	key, err := c.Scrypt.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if key.ID() != c.KeyID {
+		return nil, fmt.Errorf("wrong passphrase: %w", ErrWrongKey)
+	}
+	return key, nil
+}
+
+// FileKey reads c's key from the key file at path, returning ErrWrongKey if
+// it is not the key the directory was encrypted with.
+func (c *Config) FileKey(path string) (*Key, error) {
+	if c.Source != SourceKeyFile {
+		return nil, fmt.Errorf("key source is %q, not a key file", c.Source)
+	}
+	key, err := ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key.ID() != c.KeyID {
+		return nil, fmt.Errorf("key file %s: %w", path, ErrWrongKey)
+	}
+	return key, nil
+}
+
+// ReadConfig reads dir's ConfigFile, returning nil if dir is not encrypted.
+func ReadConfig(dir string) (*Config, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read encryption config: %w", err)
+	}
+	var c Config
+	if err := yaml.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("parse encryption config: %w", err)
+	}
+	if c.Source != SourcePassphrase && c.Source != SourceKeyFile || c.KeyID == "" {
+		return nil, fmt.Errorf("parse encryption config: unknown key source %q", c.Source)
+	}
+	return &c, nil
+}
+
+// WriteConfig atomically writes dir's ConfigFile.
+func WriteConfig(dir string, c *Config) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	raw, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("encode encryption config: %w", err)
+	}
+	if err := atomicfile.Write(filepath.Join(dir, ConfigFile), 0600, func(f *os.File) error {
+		_, err := f.Write(raw)
+		return err
+	}); err != nil {
+		return fmt.Errorf("write encryption config: %w", err)
+	}
+	return nil
+}
+
+// RemoveConfig removes dir's ConfigFile, once nothing in it is sealed.
+func RemoveConfig(dir string) error {
+	if err := os.Remove(filepath.Join(dir, ConfigFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove encryption config: %w", err)
+	}
+	return nil
+}
+
+// GenerateKeyFile writes a new random key to path, readable only by its
+// owner, refusing to replace an existing file: losing a key loses the data
+// sealed with it.
+func GenerateKeyFile(path string) (*Key, error) {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	key, err := keyFrom(raw)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create key file: %w", err)
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n"); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write key file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("write key file: %w", err)
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a key GenerateKeyFile wrote: 32 bytes, base64-encoded.
+func ReadKeyFile(path string) (*Key, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	k, err := keyFrom(key)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return k, nil
+}
@@ -0,0 +1,134 @@
+// Package crypt seals MileMinder's data files at rest with AES-256-GCM.
+//
+// A sealed file is the magic "MMSEAL1:", the 8-byte id of the key that sealed
+// it, a random 12-byte nonce and the ciphertext. Carrying the key id means a
+// wrong key is reported as one rather than as corruption, and lets a key
+// rotation that was interrupted resume: files already under the new key are
+// recognised and skipped.
+//
+// Keys come from a passphrase through scrypt (the CLI) or from a random key
+// file (hosted mode, where no one is there to type a passphrase). An encrypted
+// directory's Config records which, and for a passphrase the scrypt salt and
+// cost, so the same passphrase derives the same key on every run.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// magic starts every sealed file.
+const magic = "MMSEAL1:"
+
+const (
+	keySize   = 32 // AES-256
+	idSize    = 8
+	nonceSize = 12
+	header    = len(magic) + idSize + nonceSize
+)
+
+var (
+	// ErrWrongKey is returned when data was sealed with a different key.
+	ErrWrongKey = errors.New("sealed with a different key")
+	// ErrNotSealed is returned when opening data that is not sealed.
+	ErrNotSealed = errors.New("not encrypted")
+	// ErrSealed is returned by readers with no key that meet sealed data.
+	ErrSealed = errors.New("encrypted, and no key was given")
+	// ErrCorrupt is returned when sealed data fails authentication: it was
+	// truncated or altered.
+	ErrCorrupt = errors.New("encrypted data is corrupt")
+)
+
+// Key is an AES-256-GCM key.
+type Key struct {
+	aead cipher.AEAD
+	id   [idSize]byte
+}
+
+// NewKey returns a random key.
+func NewKey() (*Key, error) {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return keyFrom(raw)
+}
+
+// keyFrom wraps 32 raw key bytes. The id is a hash of them, so it identifies
+// the key without revealing it.
+func keyFrom(raw []byte) (*Key, error) {
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(raw), keySize)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{aead: aead}
+	sum := sha256.Sum256(append([]byte("mileminder key id\x00"), raw...))
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// ID is the key's id in hex, as recorded in a Config.
+func (k *Key) ID() string {
+	return hex.EncodeToString(k.id[:])
+}
+
+// Seal encrypts plain. The header is authenticated with it, so a file cannot
+// be passed off as sealed by another key.
+func (k *Key) Seal(plain []byte) ([]byte, error) {
+	out := make([]byte, header, header+len(plain)+k.aead.Overhead())
+	copy(out, magic)
+	copy(out[len(magic):], k.id[:])
+	nonce := out[len(magic)+idSize : header]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return k.aead.Seal(out, nonce, plain, out[:len(magic)+idSize]), nil
+}
+
+// Open decrypts data Seal produced, returning ErrNotSealed for anything else,
+// ErrWrongKey if another key sealed it and ErrCorrupt if it was altered.
+func (k *Key) Open(sealed []byte) ([]byte, error) {
+	id, ok := SealedBy(sealed)
+	if !ok {
+		return nil, ErrNotSealed
+	}
+	if id != k.ID() {
+		return nil, ErrWrongKey
+	}
+	if len(sealed) < header {
+		return nil, ErrCorrupt
+	}
+	plain, err := k.aead.Open(nil, sealed[len(magic)+idSize:header], sealed[header:], sealed[:len(magic)+idSize])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
+
+// IsSealed reports whether raw is sealed data.
+func IsSealed(raw []byte) bool {
+	_, ok := SealedBy(raw)
+	return ok
+}
+
+// SealedBy returns the id of the key that sealed raw, or false if raw is not
+// sealed.
+func SealedBy(raw []byte) (string, bool) {
+	if len(raw) < len(magic)+idSize || !bytes.HasPrefix(raw, []byte(magic)) {
+		return "", false
+	}
+	return hex.EncodeToString(raw[len(magic) : len(magic)+idSize]), true
+}
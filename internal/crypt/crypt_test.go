@@ -0,0 +1,93 @@
+package crypt
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := key.Seal([]byte("vehicle: Golf\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := SealedBy(sealed); !ok || id != key.ID() {
+		t.Fatalf("SealedBy = %q, %v", id, ok)
+	}
+	plain, err := key.Open(sealed)
+	if err != nil || string(plain) != "vehicle: Golf\n" {
+		t.Fatalf("Open = %q, %v", plain, err)
+	}
+
+	other, _ := NewKey()
+	if _, err := other.Open(sealed); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("other key: err = %v, want ErrWrongKey", err)
+	}
+	if _, err := key.Open([]byte("vehicle: Golf\n")); !errors.Is(err, ErrNotSealed) {
+		t.Errorf("plain data: err = %v, want ErrNotSealed", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := key.Open(sealed); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("altered data: err = %v, want ErrCorrupt", err)
+	}
+	if _, err := key.Open(sealed[:header-1]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated data: err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestPassphraseConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg, key, err := NewPassphraseConfig([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteConfig(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := read.PassphraseKey([]byte("correct horse"))
+	if err != nil || again.ID() != key.ID() {
+		t.Fatalf("PassphraseKey = %v, %v", again, err)
+	}
+	if _, err := read.PassphraseKey([]byte("battery staple")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong passphrase: err = %v, want ErrWrongKey", err)
+	}
+
+	if err := RemoveConfig(dir); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := ReadConfig(dir); cfg != nil || err != nil {
+		t.Errorf("after RemoveConfig: %+v, %v", cfg, err)
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mileminder.key")
+	key, err := GenerateKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateKeyFile(path); err == nil {
+		t.Fatal("GenerateKeyFile replaced an existing key file")
+	}
+	cfg := NewKeyFileConfig(key)
+	read, err := cfg.FileKey(path)
+	if err != nil || read.ID() != key.ID() {
+		t.Fatalf("FileKey = %v, %v", read, err)
+	}
+
+	otherPath := filepath.Join(t.TempDir(), "other.key")
+	if _, err := GenerateKeyFile(otherPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.FileKey(otherPath); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("other key file: err = %v, want ErrWrongKey", err)
+	}
+}
@@ -0,0 +1,185 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+)
+
+// Seal is k.Seal, or plain unchanged for a nil key: the stores hold a nil
+// key for a directory that is not encrypted.
+func Seal(k *Key, plain []byte) ([]byte, error) {
+	if k == nil {
+		return plain, nil
+	}
+	return k.Seal(plain)
+}
+
+// Open is k.Open, or for a nil key raw unchanged. A nil key refuses sealed
+// data with ErrSealed rather than handing ciphertext to a parser.
+func Open(k *Key, raw []byte) ([]byte, error) {
+	if k == nil {
+		if IsSealed(raw) {
+			return nil, ErrSealed
+		}
+		return raw, nil
+	}
+	return k.Open(raw)
+}
+
+// ReadFile reads the file at path and opens it with k. Errors reading the
+// file are returned as os.ReadFile returns them, so os.IsNotExist still
+// recognises a missing one.
+func ReadFile(k *Key, path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Open(k, raw)
+}
+
+// WriteFile atomically replaces the file at path with data, sealed with k.
+func WriteFile(k *Key, path string, perm os.FileMode, data []byte) error {
+	out, err := Seal(k, data)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(path, perm, func(f *os.File) error {
+		_, err := f.Write(out)
+		return err
+	})
+}
+
+// ConvertFile re-seals the file at path from one key to another: a nil from
+// encrypts a plain file, a nil to decrypts one, and both set rotates the key.
+// It reports whether the file needed it; one already in the target form, or
+// missing, is left alone, so a conversion that stops part-way completes when
+// rerun. The file is replaced atomically, keeping its permissions.
+func ConvertFile(path string, from, to *Key) (bool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	id, sealed := SealedBy(raw)
+	if to == nil && !sealed || to != nil && sealed && id == to.ID() {
+		return false, nil
+	}
+	plain := raw
+	if sealed {
+		if plain, err = Open(from, raw); err != nil {
+			return false, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", path, err)
+	}
+	if err := WriteFile(to, path, info.Mode().Perm(), plain); err != nil {
+		return false, fmt.Errorf("rewrite %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// SealLine seals one line of a line-based log with k and base64-encodes it,
+// so the log stays append-only and line-based. A nil key returns line as it
+// is. line is the JSON object, without its newline.
+func SealLine(k *Key, line []byte) ([]byte, error) {
+	if k == nil {
+		return line, nil
+	}
+	sealed, err := k.Seal(line)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// PlainLine reports whether line is unsealed: a plain line starts with the
+// "{" of its JSON object, which base64 never produces.
+func PlainLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("{"))
+}
+
+// OpenLine decodes a line SealLine wrote, with the errors Open returns.
+func OpenLine(k *Key, line []byte) ([]byte, error) {
+	plain := PlainLine(line)
+	switch {
+	case k == nil && plain:
+		return line, nil
+	case k == nil:
+		return nil, ErrSealed
+	case plain:
+		return nil, ErrNotSealed
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return k.Open(sealed)
+}
+
+// ConvertLines rewrites the line-based log at path from one key to another,
+// as ConvertFile does a whole file, reporting whether it needed to. The file
+// is replaced atomically. A line neither key can read — a torn final line,
+// say — is kept as it is, but one sealed with a key not given is an error.
+func ConvertLines(path string, from, to *Key) (bool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	var out bytes.Buffer
+	changed := false
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(nil, len(raw)+1)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if _, err := OpenLine(to, line); err == nil {
+			out.Write(line)
+			out.WriteByte('\n')
+			continue
+		}
+		plain := line
+		if !PlainLine(line) {
+			plain, err = OpenLine(from, line)
+			if errors.Is(err, ErrSealed) || errors.Is(err, ErrWrongKey) {
+				return false, fmt.Errorf("%s: %w", path, err)
+			}
+			if err != nil {
+				out.Write(line)
+				out.WriteByte('\n')
+				continue
+			}
+		}
+		if line, err = SealLine(to, plain); err != nil {
+			return false, err
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", path, err)
+	}
+	if err := atomicfile.Write(path, info.Mode().Perm(), func(f *os.File) error {
+		_, err := f.Write(out.Bytes())
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("rewrite %s: %w", path, err)
+	}
+	return true, nil
+}
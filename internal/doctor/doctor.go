@@ -0,0 +1,279 @@
+// Package doctor finds problems in a data directory that the stores tolerate
+// or hide — a vehicle file that no longer parses simply drops out of
+// ListVehicles — and repairs those it safely can.
+//
+// A repair never destroys data: a reading is moved to the trash, an
+// unreadable file into quarantine, and only temp files nothing will ever read
+// are deleted. Repairs that second-guess the user's data (which of two
+// conflicting readings is wrong, which vehicle becomes the default) are
+// offered, but not Safe: the caller asks before applying them.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/schema"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+// Kind classifies a Problem.
+type Kind string
+
+const (
+	Unreadable      Kind = "unreadable"       // a store file that does not read or parse
+	TempFile        Kind = "temp-file"        // an orphaned atomicfile temp file
+	DanglingCurrent Kind = "dangling-current" // the default vehicle does not exist
+	InvalidDate     Kind = "invalid-date"     // a reading not dated YYYY-MM-DD
+	NonMonotonic    Kind = "non-monotonic"    // the odometer goes backwards
+	PlanDates       Kind = "plan-dates"       // a plan that ends before it starts
+)
+
+// TempAge is how old a temp file must be before it counts as orphaned: far
+// longer than any write takes, so one still being written is never removed.
+const TempAge = 10 * time.Minute
+
+// Problem is one thing wrong with a store.
+type Problem struct {
+	Kind      Kind
+	VehicleID string // the vehicle concerned, if any
+	File      string // the file concerned, if any
+	Detail    string
+	// Fix says what Repair does, or is "" when the problem needs a hand.
+	Fix string
+	// Safe marks a fix that only moves aside or deletes what nothing can
+	// read, and can be applied without asking.
+	Safe   bool
+	repair func(ctx context.Context) error
+}
+
+// String describes the problem on one line.
+func (p Problem) String() string {
+	switch {
+	case p.File != "":
+		return fmt.Sprintf("%s: %s", p.File, p.Detail)
+	case p.VehicleID != "":
+		return fmt.Sprintf("%s: %s", p.VehicleID, p.Detail)
+	}
+	return p.Detail
+}
+
+// Repair applies the fix.
+func (p Problem) Repair(ctx context.Context) error {
+	if p.repair == nil {
+		return fmt.Errorf("%s: no automatic repair", p)
+	}
+	return p.repair(ctx)
+}
+
+// TempFiles finds the temp files atomicfile.Write left under root, at any
+// depth, older than TempAge at now, each named relative to root. Removing one
+// is Safe.
+func TempFiles(root string, now time.Time) ([]Problem, error) {
+	paths, err := atomicfile.Orphans(root, now.Add(-TempAge))
+	if err != nil {
+		return nil, err
+	}
+	problems := make([]Problem, 0, len(paths))
+	for _, path := range paths {
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			name = path
+		}
+		problems = append(problems, Problem{
+			Kind:   TempFile,
+			File:   name,
+			Detail: "temp file left by an interrupted write",
+			Fix:    "remove it",
+			Safe:   true,
+			repair: func(context.Context) error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("remove %s: %w", path, err)
+				}
+				return nil
+			},
+		})
+	}
+	return problems, nil
+}
+
+// Examine checks the store st. files, when not nil, is the YAML store under
+// st, whose files are checked too; repairs go through st, so a journal in
+// front records them.
+func Examine(ctx context.Context, st storage.Store, files *yamlstore.Store) ([]Problem, error) {
+	var problems []Problem
+	unreadable := map[string]bool{}
+	if files != nil {
+		bad, err := files.Unreadable(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range bad {
+			problems = append(problems, unreadableProblem(files, f))
+			if f.VehicleID != "" {
+				unreadable[f.VehicleID] = true
+			}
+		}
+	}
+
+	records, err := st.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	for _, r := range records {
+		problems = append(problems, examineVehicle(st, r.ID, r.Data)...)
+	}
+
+	current, err := st.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current != "" && !unreadable[current] {
+		if _, err := st.GetVehicle(ctx, current); errors.Is(err, storage.ErrNotFound) {
+			p, err := danglingCurrent(ctx, st, current, records)
+			if err != nil {
+				return nil, err
+			}
+			problems = append(problems, p)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+func unreadableProblem(files *yamlstore.Store, f yamlstore.BadFile) Problem {
+	p := Problem{Kind: Unreadable, VehicleID: f.VehicleID, File: f.Name, Detail: f.Err.Error()}
+	switch {
+	case errors.Is(f.Err, schema.ErrTooNew):
+		// A newer build wrote it: it is fine, this build is old.
+		p.Detail += "; upgrade mileminder to read it"
+	case errors.Is(f.Err, crypt.ErrSealed), errors.Is(f.Err, crypt.ErrWrongKey), errors.Is(f.Err, crypt.ErrNotSealed):
+		// The file is likely fine; it and the directory's encryption
+		// disagree.
+		p.Detail += "; check the directory's encryption and passphrase"
+	default:
+		p.Fix = fmt.Sprintf("move it into %s/ for repair by hand", yamlstore.QuarantineDir)
+		p.Safe = true
+		p.repair = func(ctx context.Context) error {
+			_, err := files.Quarantine(ctx, f.Name)
+			return err
+		}
+	}
+	return p
+}
+
+// examineVehicle checks one vehicle's readings and plan.
+func examineVehicle(st storage.Store, id string, data *model.VehicleData) []Problem {
+	var problems []Problem
+	valid := make(map[string]int, len(data.Readings))
+	dates := make([]string, 0, len(data.Readings))
+	for date := range data.Readings {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			problems = append(problems, Problem{
+				Kind:      InvalidDate,
+				VehicleID: id,
+				Detail:    fmt.Sprintf("reading %q (%d miles) is not dated YYYY-MM-DD", date, data.Readings[date]),
+				Fix:       "move the reading to the trash",
+				Safe:      true,
+				repair:    trashReading(st, id, date),
+			})
+			continue
+		}
+		valid[date] = data.Readings[date]
+	}
+
+	if err := readings.CheckMonotonic(valid, data.OdometerChanges); err != nil {
+		p := Problem{Kind: NonMonotonic, VehicleID: id, Detail: err.Error()}
+		if date, ok := culprit(valid, data.OdometerChanges); ok {
+			p.Fix = fmt.Sprintf("move the %s reading (%d miles) to the trash", date, valid[date])
+			p.repair = trashReading(st, id, date)
+		} else {
+			p.Detail += "; fix the readings, or record an odometer change, by hand"
+		}
+		problems = append(problems, p)
+	}
+
+	if plan := data.Plan; plan != nil && plan.End.Before(plan.Start) {
+		problems = append(problems, Problem{
+			Kind:      PlanDates,
+			VehicleID: id,
+			Detail:    fmt.Sprintf("plan ends (%s) before it starts (%s)", plan.End.Format("2006-01-02"), plan.Start.Format("2006-01-02")),
+		})
+	}
+	return problems
+}
+
+// culprit finds the one reading whose removal makes the readings monotonic,
+// if there is exactly one.
+func culprit(all map[string]int, changes []model.OdometerChange) (string, bool) {
+	dates := make([]string, 0, len(all))
+	for date := range all {
+		dates = append(dates, date)
+	}
+	var found []string
+	for _, date := range dates {
+		miles := all[date]
+		delete(all, date)
+		if readings.CheckMonotonic(all, changes) == nil {
+			found = append(found, date)
+		}
+		all[date] = miles
+	}
+	if len(found) != 1 {
+		return "", false
+	}
+	return found[0], true
+}
+
+func trashReading(st storage.Store, id, date string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return st.DeleteReading(ctx, id, date)
+	}
+}
+
+// danglingCurrent describes a default vehicle that does not exist. If it was
+// deleted, the fix restores it from the trash; otherwise another vehicle
+// becomes the default. With neither, the pointer is left for the next
+// 'mileminder switch' to replace.
+func danglingCurrent(ctx context.Context, st storage.Store, current string, records []storage.Record) (Problem, error) {
+	p := Problem{Kind: DanglingCurrent, VehicleID: current, File: "current", Detail: fmt.Sprintf("the default vehicle %q does not exist", current)}
+	trash, err := st.ListTrash(ctx)
+	if err != nil {
+		return p, err
+	}
+	for _, item := range trash { // most recently deleted first
+		if item.Kind == storage.TrashVehicle && item.VehicleID == current {
+			p.Fix = "restore it from the trash"
+			p.repair = func(ctx context.Context) error {
+				_, err := st.RestoreTrash(ctx, item.ID)
+				return err
+			}
+			return p, nil
+		}
+	}
+	if len(records) == 0 {
+		return p, nil
+	}
+	other := records[0].ID
+	p.Fix = fmt.Sprintf("make %s the default instead", other)
+	p.repair = func(ctx context.Context) error {
+		return st.SetCurrent(ctx, other)
+	}
+	return p, nil
+}
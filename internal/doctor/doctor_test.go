@@ -0,0 +1,211 @@
+package doctor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/doctor"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+func vehicle(readings map[string]int) *model.VehicleData {
+	return &model.VehicleData{
+		Vehicle: "Golf",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+		},
+		Readings: readings,
+	}
+}
+
+// kinds indexes problems by kind, failing on a kind found twice.
+func kinds(t *testing.T, problems []doctor.Problem) map[doctor.Kind]doctor.Problem {
+	t.Helper()
+	byKind := map[doctor.Kind]doctor.Problem{}
+	for _, p := range problems {
+		if _, dup := byKind[p.Kind]; dup {
+			t.Fatalf("two %s problems in %v", p.Kind, problems)
+		}
+		byKind[p.Kind] = p
+	}
+	return byKind
+}
+
+func TestExamineHealthyStore(t *testing.T) {
+	ctx := context.Background()
+	st := yamlstore.New(t.TempDir())
+	if err := st.SaveVehicle(ctx, "golf", vehicle(map[string]int{"2025-01-01": 5000, "2025-03-01": 5600})); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := doctor.Examine(ctx, st, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("problems in a healthy store: %v", problems)
+	}
+}
+
+func TestExamineAndRepair(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := yamlstore.New(dir)
+
+	golf := vehicle(map[string]int{"2025-01-01": 5000, "2025-02-01": 9100, "2025-03-01": 5600, "2025-04-01": 5900, "01/05/2025": 6200})
+	golf.Plan.End = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := st.SaveVehicle(ctx, "golf", golf); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveVehicle(ctx, "polo", vehicle(map[string]int{"2025-01-01": 5000})); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrent(ctx, "polo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteVehicle(ctx, "polo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.yml"), []byte("readings: [not: a map"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := doctor.Examine(ctx, st, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := kinds(t, problems)
+	if len(byKind) != 5 {
+		t.Fatalf("want 5 problems, got %v", problems)
+	}
+	if p := byKind[doctor.Unreadable]; p.File != "broken.yml" || !p.Safe {
+		t.Fatalf("unreadable = %+v", p)
+	}
+	if p := byKind[doctor.InvalidDate]; p.VehicleID != "golf" || !p.Safe {
+		t.Fatalf("invalid date = %+v", p)
+	}
+	if p := byKind[doctor.NonMonotonic]; p.Fix != "move the 2025-02-01 reading (9100 miles) to the trash" || p.Safe {
+		t.Fatalf("non-monotonic = %+v", p)
+	}
+	if p := byKind[doctor.PlanDates]; p.Fix != "" {
+		t.Fatalf("plan dates should need a hand: %+v", p)
+	}
+	if p := byKind[doctor.DanglingCurrent]; p.Fix != "restore it from the trash" || p.Safe {
+		t.Fatalf("dangling current = %+v", p)
+	}
+
+	for _, p := range problems {
+		if p.Fix == "" {
+			if err := p.Repair(ctx); err == nil {
+				t.Fatalf("%s repaired with no fix", p.Kind)
+			}
+			continue
+		}
+		if err := p.Repair(ctx); err != nil {
+			t.Fatalf("repair %s: %v", p.Kind, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, yamlstore.QuarantineDir, "broken.yml")); err != nil {
+		t.Fatalf("broken.yml not quarantined: %v", err)
+	}
+	data, err := st.GetVehicle(ctx, "golf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Readings) != 3 {
+		t.Fatalf("golf readings after repair = %v", data.Readings)
+	}
+	if _, err := st.GetVehicle(ctx, "polo"); err != nil {
+		t.Fatalf("polo not restored: %v", err)
+	}
+	items, err := st.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("want the two removed readings in the trash, got %+v", items)
+	}
+
+	problems, err = doctor.Examine(ctx, st, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != doctor.PlanDates {
+		t.Fatalf("after repair want only the plan dates left, got %v", problems)
+	}
+}
+
+// With no vehicle to restore, a dangling default is pointed at another.
+func TestDanglingCurrentSwitches(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := yamlstore.New(dir)
+	if err := st.SaveVehicle(ctx, "golf", vehicle(map[string]int{"2025-01-01": 5000})); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "current"), []byte("gone"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := doctor.Examine(ctx, st, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Fix != "make golf the default instead" {
+		t.Fatalf("problems = %v", problems)
+	}
+	if err := problems[0].Repair(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := st.GetCurrent(ctx); current != "golf" {
+		t.Fatalf("current = %q", current)
+	}
+}
+
+func TestTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := filepath.Join(dir, "users", "u1", ".golf.yml.tmp-123")
+	fresh := filepath.Join(dir, ".settings.tmp-456")
+	for _, path := range []string{old, fresh} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(old, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := doctor.TempFiles(dir, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].File != filepath.Join("users", "u1", ".golf.yml.tmp-123") {
+		t.Fatalf("problems = %v", problems)
+	}
+	if err := problems[0].Repair(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("orphan not removed: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("a write in progress was disturbed: %v", err)
+	}
+
+	if problems, err := doctor.TempFiles(filepath.Join(dir, "missing"), now); err != nil || len(problems) != 0 {
+		t.Fatalf("missing dir: %v, %v", problems, err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package events is the in-process bus behind the live-update stream
+// (GET /api/v1/events). Writers — the journal observer, the store watcher and
+// the alerts scheduler — publish to a user's stream; each open stream
+// subscribes to it. Single-user mode has one stream, user "".
+//
+// The bus keeps each user's most recent events so a client that reconnects
+// with the id of the last event it saw is sent what it missed. When that is
+// no longer possible — the id is older than anything kept, or from before the
+// server restarted — the client is sent a resync event instead and must
+// refetch. Publishing never blocks: a subscriber too slow to keep up is
+// dropped, and resumes from its last id when it reconnects.
+package events
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+)
+
+// Event types.
+const (
+	// VehicleChanged: a vehicle was created, edited, renamed, merged,
+	// restored, deleted (Removed) or made the default.
+	VehicleChanged = "vehicle-changed"
+	// ReadingAdded: a reading was recorded or corrected (Date, Miles).
+	ReadingAdded = "reading-added"
+	// ReadingDeleted: a reading was removed (Date).
+	ReadingDeleted = "reading-deleted"
+	// StatusRecomputed: Status is the vehicle's status as it now stands.
+	StatusRecomputed = "status-recomputed"
+	// Resync: events were missed that cannot be replayed; refetch everything.
+	Resync = "resync"
+)
+
+// DefaultBacklog is how many events a Bus keeps per user when Backlog is
+// unset.
+const DefaultBacklog = 256
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Event is one change. ID and Type travel as the SSE id and event fields; the
+// rest is the JSON data.
+type Event struct {
+	ID   uint64 `json:"-"`
+	Type string `json:"-"`
+
+	VehicleID string `json:"vehicle_id,omitempty"`
+	// From is the old id of a vehicle renamed or merged into VehicleID.
+	From    string       `json:"from,omitempty"`
+	Removed bool         `json:"removed,omitempty"`
+	Date    string       `json:"date,omitempty"`
+	Miles   int          `json:"miles,omitempty"`
+	Status  *calc.Status `json:"status,omitempty"`
+}
+
+// Bus fans published events out to subscribers, per user.
+type Bus struct {
+	// Backlog is how many events are kept per user for resuming.
+	Backlog int
+
+	mu      sync.Mutex
+	firstID uint64 // ids this Bus assigns are above it
+	lastID  uint64
+	streams map[string]*stream
+	closed  bool
+}
+
+type stream struct {
+	recent []Event // oldest first
+	// floor is the newest id dropped from recent: resuming from before it
+	// would miss events.
+	floor uint64
+	subs  map[*Subscription]struct{}
+}
+
+// NewBus returns an open Bus. Its ids start from the clock, so they are above
+// any a previous run of the server handed out and a client resuming across a
+// restart is told to resync rather than silently missing events.
+func NewBus() *Bus {
+	start := uint64(time.Now().UnixMicro())
+	return &Bus{firstID: start, lastID: start, streams: map[string]*stream{}}
+}
+
+// Subscription is one subscriber's view of a user's stream.
+type Subscription struct {
+	// C delivers events in id order. It is closed when the bus closes or the
+	// subscriber falls too far behind.
+	C <-chan Event
+
+	c    chan Event
+	bus  *Bus
+	user string
+}
+
+// Subscribe subscribes to user's stream. lastEventID is the SSE Last-Event-ID
+// the client sent, "" for a fresh stream; the events it missed are returned
+// to send before reading C — or a single Resync when they are gone.
+func (b *Bus) Subscribe(user, lastEventID string) (*Subscription, []Event) {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, bus: b, user: user}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub, nil
+	}
+	st := b.streams[user]
+	if st == nil {
+		st = &stream{floor: b.lastID, subs: map[*Subscription]struct{}{}}
+		b.streams[user] = st
+	}
+	st.subs[sub] = struct{}{}
+	if lastEventID == "" {
+		return sub, nil
+	}
+	last, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || last < b.firstID || last > b.lastID || last < st.floor {
+		return sub, []Event{{ID: b.lastID, Type: Resync}}
+	}
+	var missed []Event
+	for _, e := range st.recent {
+		if e.ID > last {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st := b.streams[s.user]; st != nil {
+		if _, ok := st.subs[s]; ok {
+			delete(st.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Publish assigns each event the next id and sends it to user's subscribers.
+// Only users who have subscribed since the Bus opened have a stream; events
+// for anyone else are dropped, as there is no one to resume them. It is safe
+// on a nil Bus.
+func (b *Bus) Publish(user string, events ...Event) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.streams[user]
+	if b.closed || st == nil {
+		return
+	}
+	backlog := b.Backlog
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	for _, e := range events {
+		b.lastID++
+		e.ID = b.lastID
+		st.recent = append(st.recent, e)
+		if over := len(st.recent) - backlog; over > 0 {
+			st.floor = st.recent[over-1].ID
+			st.recent = append(st.recent[:0], st.recent[over:]...)
+		}
+		for sub := range st.subs {
+			select {
+			case sub.c <- e:
+			default:
+				delete(st.subs, sub)
+				close(sub.c)
+			}
+		}
+	}
+}
+
+// Close ends every subscription, so open streams finish and a server can
+// shut down. Later subscriptions are closed at once and publishing does
+// nothing.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, st := range b.streams {
+		for sub := range st.subs {
+			close(sub.c)
+		}
+		clear(st.subs)
+	}
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func types(evs []Event) []string {
+	var out []string
+	for _, e := range evs {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func next(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	default:
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestPublishIsPerUser(t *testing.T) {
+	b := NewBus()
+	alice, _ := b.Subscribe("alice", "")
+	bob, _ := b.Subscribe("bob", "")
+	b.Publish("alice", Event{Type: VehicleChanged, VehicleID: "golf"})
+	b.Publish("carol", Event{Type: VehicleChanged, VehicleID: "polo"}) // no stream: dropped
+
+	if e := next(t, alice); e.VehicleID != "golf" || e.ID == 0 {
+		t.Fatalf("alice got %+v", e)
+	}
+	if len(bob.C) != 0 {
+		t.Fatal("bob got alice's event")
+	}
+	bob.Close()
+	bob.Close()
+	if _, ok := <-bob.C; ok {
+		t.Fatal("closed subscription still open")
+	}
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	b := NewBus()
+	b.Backlog = 3
+	first, _ := b.Subscribe("", "")
+	for i := range 3 {
+		b.Publish("", Event{Type: ReadingAdded, Miles: i})
+	}
+	seen := next(t, first).ID
+	first.Close()
+
+	_, missed := b.Subscribe("", strconv.FormatUint(seen, 10))
+	if len(missed) != 2 || missed[0].Miles != 1 || missed[1].Miles != 2 {
+		t.Fatalf("missed = %+v", missed)
+	}
+
+	// Two more events push the first two out of the backlog: resuming from
+	// before them cannot be done.
+	b.Publish("", Event{Type: ReadingAdded, Miles: 3}, Event{Type: ReadingAdded, Miles: 4})
+	for _, last := range []string{strconv.FormatUint(seen, 10), "1", "junk", strconv.FormatUint(b.lastID+1, 10)} {
+		if _, missed := b.Subscribe("", last); len(missed) != 1 || missed[0].Type != Resync || missed[0].ID != b.lastID {
+			t.Errorf("Last-Event-ID %s: missed = %+v", last, missed)
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBus()
+	slow, _ := b.Subscribe("", "")
+	for range subscriberBuffer + 1 {
+		b.Publish("", Event{Type: VehicleChanged})
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("got %d events before the drop, want %d", n, subscriberBuffer)
+	}
+	slow.Close() // already dropped: a no-op
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	b := NewBus()
+	sub, _ := b.Subscribe("", "")
+	b.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("subscription open after Close")
+	}
+	late, _ := b.Subscribe("", "")
+	if _, ok := <-late.C; ok {
+		t.Fatal("subscription to a closed bus is open")
+	}
+	b.Publish("", Event{Type: VehicleChanged})
+	sub.Close()
+}
+
+func TestFromEntry(t *testing.T) {
+	golf := &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5400}}
+	tests := []struct {
+		entry journal.Entry
+		want  []string
+	}{
+		{journal.Entry{Op: journal.OpPutReading, VehicleID: "golf", Date: "2025-02-01", After: golf}, []string{ReadingAdded, StatusRecomputed}},
+		{journal.Entry{Op: journal.OpDeleteReading, VehicleID: "golf", Date: "2025-03-01", After: golf}, []string{ReadingDeleted, StatusRecomputed}},
+		{journal.Entry{Op: journal.OpRestore, VehicleID: "golf", Date: "2025-02-01", After: golf}, []string{ReadingAdded, StatusRecomputed}},
+		{journal.Entry{Op: journal.OpDeleteVehicle, VehicleID: "golf", Before: golf}, []string{VehicleChanged}},
+		{journal.Entry{Op: journal.OpRename, VehicleID: "gti", From: "golf", After: golf, FromBefore: golf}, []string{VehicleChanged, VehicleChanged, StatusRecomputed}},
+		{journal.Entry{Op: journal.OpSetCurrent, VehicleID: "golf", From: "polo"}, []string{VehicleChanged, VehicleChanged}},
+		{journal.Entry{Op: journal.OpSaveSettings}, nil},
+	}
+	for _, tt := range tests {
+		evs := fromEntry(tt.entry)
+		if got := types(evs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: events %v, want %v", tt.entry.Op, got, tt.want)
+		}
+	}
+
+	evs := fromEntry(journal.Entry{Op: journal.OpPutReading, VehicleID: "golf", Date: "2025-02-01", After: golf})
+	if evs[0].Miles != 5400 || evs[1].Status == nil || evs[1].Status.LatestReading != 5400 {
+		t.Fatalf("reading events: %+v, status %+v", evs[0], evs[1].Status)
+	}
+	evs = fromEntry(journal.Entry{Op: journal.OpRename, VehicleID: "gti", From: "golf", After: golf})
+	if !evs[0].Removed || evs[0].VehicleID != "golf" || evs[1].From != "golf" || evs[1].Removed {
+		t.Fatalf("rename events: %+v", evs)
+	}
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// PublishEntry publishes the events a journalled change to user's data stands
+// for. It is shaped to observe journals (see journal.Observe and
+// journal.Tenants.Observer). Settings changes have no event.
+func (b *Bus) PublishEntry(user string, e journal.Entry) {
+	b.Publish(user, fromEntry(e)...)
+}
+
+// fromEntry is the events a journal entry stands for: what happened to each
+// vehicle it touched, then the changed vehicle's new status.
+func fromEntry(e journal.Entry) []Event {
+	switch e.Op {
+	case journal.OpSaveSettings:
+		return nil
+	case journal.OpSetCurrent:
+		evs := []Event{{Type: VehicleChanged, VehicleID: e.VehicleID}}
+		if e.From != "" && e.From != e.VehicleID {
+			evs = append(evs, Event{Type: VehicleChanged, VehicleID: e.From})
+		}
+		return evs
+	}
+
+	var evs []Event
+	if e.From != "" {
+		evs = append(evs, Event{Type: VehicleChanged, VehicleID: e.From, Removed: e.FromAfter == nil})
+	}
+	switch {
+	case e.Op == journal.OpPutReading, e.Op == journal.OpRestore && e.Date != "":
+		evs = append(evs, Event{Type: ReadingAdded, VehicleID: e.VehicleID, Date: e.Date, Miles: milesOn(e.After, e.Date)})
+	case e.Op == journal.OpDeleteReading:
+		evs = append(evs, Event{Type: ReadingDeleted, VehicleID: e.VehicleID, Date: e.Date})
+	default:
+		evs = append(evs, Event{Type: VehicleChanged, VehicleID: e.VehicleID, From: e.From, Removed: e.After == nil})
+	}
+	if e.After != nil {
+		evs = append(evs, statusEvent(e.VehicleID, e.After))
+	}
+	return evs
+}
+
+// PublishVehicle publishes vehicle-changed for id as st now holds it — removed
+// if it no longer exists — followed by its status. It is for changes made
+// outside the journal, such as a CLI edit the store watcher noticed.
+func (b *Bus) PublishVehicle(ctx context.Context, user string, st storage.Store, id string) error {
+	data, err := st.GetVehicle(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		b.Publish(user, Event{Type: VehicleChanged, VehicleID: id, Removed: true})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.Publish(user, Event{Type: VehicleChanged, VehicleID: id}, statusEvent(id, data))
+	return nil
+}
+
+// StatusEvent is a status-recomputed event for a status computed elsewhere,
+// as the alerts scheduler does on every sweep.
+func StatusEvent(status calc.Status) Event {
+	return Event{Type: StatusRecomputed, VehicleID: status.ID, Status: &status}
+}
+
+func statusEvent(id string, data *model.VehicleData) Event {
+	return StatusEvent(calc.ComputeStatus(id, data))
+}
+
+func milesOn(data *model.VehicleData, date string) int {
+	if data == nil {
+		return 0
+	}
+	return data.Readings[date]
+}
@@ -0,0 +1,93 @@
+// Package filelock takes advisory cross-process locks, so the CLI and a
+// running server can both read-modify-write the same data files without
+// losing an update. A lock lives on its own file beside the data: the data
+// files themselves are replaced by rename on every write (see atomicfile), so
+// a lock held on one would be on an inode nobody else opens.
+//
+// Locks are flock(2) on Unix. Elsewhere they are no-ops, which leaves the
+// in-process mutexes as the only guard — the historical behaviour.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Lock is a held lock. Unlock releases it.
+type Lock struct {
+	f *os.File
+}
+
+// Exclusive blocks until it holds the exclusive lock on path, creating the
+// lock file (not its directory) if need be.
+func Exclusive(path string) (*Lock, error) {
+	return acquire(path, true)
+}
+
+// Shared blocks until it holds a shared lock on path: any number of shared
+// holders, but none while an exclusive lock is held. The lock file is opened
+// read-only, so a reader needs no write access to the data directory. A
+// missing directory is reported as an fs.ErrNotExist error, which a reader can
+// take to mean there is nothing yet to read. A lock file that is missing and
+// cannot be created, in a directory this process may not write, yields a nil
+// Lock: there is nothing to take it on.
+func Shared(path string) (*Lock, error) {
+	return acquire(path, false)
+}
+
+// DirFile is the lock file a store directory is locked on. The leading dot
+// keeps it out of the *.yml listings and backups.
+const DirFile = ".lock"
+
+// ReadDir takes a shared lock on dir's DirFile for a read. A directory that
+// does not exist yet has nothing to read, so it yields a nil Lock.
+func ReadDir(dir string) (*Lock, error) {
+	l, err := Shared(filepath.Join(dir, DirFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return l, nil
+}
+
+// WriteDir takes the exclusive lock on dir's DirFile for a read-modify-write,
+// creating dir so the first write is covered too.
+func WriteDir(dir string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", dir, err)
+	}
+	return Exclusive(filepath.Join(dir, DirFile))
+}
+
+func acquire(path string, exclusive bool) (*Lock, error) {
+	var f *os.File
+	var err error
+	if exclusive {
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	} else if f, err = os.Open(path); errors.Is(err, fs.ErrNotExist) {
+		f, err = os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+		if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open lock %s: %w", path, err)
+	}
+	if err := lock(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock. It is safe on a nil Lock.
+func (l *Lock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	unlock(l.f)
+	return l.f.Close()
+}
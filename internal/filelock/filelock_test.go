@@ -0,0 +1,79 @@
+//go:build unix
+
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExclusiveWaitsForHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".lock")
+	held, err := Exclusive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := Shared(path)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("shared lock taken while an exclusive lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := held.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case l := <-acquired:
+		l.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("shared lock not taken after the exclusive lock was released")
+	}
+}
+
+func TestSharedLocksCoexist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".lock")
+	a, err := Shared(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unlock()
+
+	done := make(chan error)
+	go func() {
+		b, err := Shared(path)
+		if err == nil {
+			err = b.Unlock()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second shared lock blocked")
+	}
+}
+
+func TestSharedOpensLockReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".lock")
+	if err := os.WriteFile(path, nil, 0400); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Shared(path)
+	if err != nil {
+		t.Fatalf("shared lock on a read-only lock file: %v", err)
+	}
+	l.Unlock()
+}
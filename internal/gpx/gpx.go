@@ -0,0 +1,355 @@
+// Package gpx turns GPS tracks into trips and odometer readings. A GPX file
+// from a phone or sat-nav says where the vehicle went, not what the odometer
+// read, so the import measures each day's tracks (haversine over consecutive
+// track points) and proposes readings by adding that distance to the last
+// known odometer. Parse reads the file; Import proposes and, unless it is a
+// dry run, applies the proposal. Both the CLI and the HTTP layer go through
+// Import so the rules cannot drift between surfaces (#29).
+package gpx
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// earthRadiusMiles is the mean Earth radius used by the haversine formula.
+const earthRadiusMiles = 3958.8
+
+// ErrNotMonotonic wraps readings.CheckMonotonic's error when the proposed
+// readings do not fit the existing ones. Surfaces add their own override hint.
+var ErrNotMonotonic = errors.New("proposed readings do not fit the existing ones")
+
+// Day is the tracked driving on one calendar day.
+type Day struct {
+	Date     string   `json:"date"`     // YYYY-MM-DD in the import's time zone
+	Distance float64  `json:"distance"` // miles
+	Points   int      `json:"points"`
+	Tracks   []string `json:"tracks,omitempty"` // track names, in file order
+}
+
+// Miles is the day's distance rounded to whole miles, the unit readings and
+// trips are kept in.
+func (d Day) Miles() int {
+	return int(math.Round(d.Distance))
+}
+
+type point struct {
+	lat, lon float64
+	date     string
+}
+
+// Parse reads a GPX document and groups its tracks into days in loc. A track
+// segment's distance is the sum of the great-circle distances between its
+// consecutive points; each leg counts towards the day its first point falls
+// on, so a drive over midnight is not split mid-leg. Routes and waypoints are
+// ignored: they are plans, not journeys.
+//
+// Like readings.ParseCSV it keeps going after a bad track point and returns
+// every problem, line-numbered, so the caller can reject the whole file at
+// once. Line 0 means the file as a whole.
+func Parse(r io.Reader, loc *time.Location) ([]Day, []readings.RowError) {
+	dec := xml.NewDecoder(r)
+	var errs []readings.RowError
+	byDate := map[string]*Day{}
+	var order []string
+	day := func(date string) *Day {
+		d, ok := byDate[date]
+		if !ok {
+			d = &Day{Date: date}
+			byDate[date] = d
+			order = append(order, date)
+		}
+		return d
+	}
+
+	var (
+		inTrack   bool
+		trackName string
+		prev      *point
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, _ := dec.InputPos()
+			errs = append(errs, readings.RowError{Line: line, Msg: err.Error()})
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "trk":
+				inTrack, trackName, prev = true, "", nil
+			case "trkseg":
+				prev = nil // segments are separate recordings; never join them
+			case "name":
+				if inTrack {
+					var name string
+					if err := dec.DecodeElement(&name, &t); err == nil {
+						trackName = strings.TrimSpace(name)
+					}
+				}
+			case "trkpt":
+				line, _ := dec.InputPos()
+				p, err := decodePoint(dec, t, loc)
+				if err != nil {
+					errs = append(errs, readings.RowError{Line: line, Msg: err.Error()})
+					prev = nil
+					continue
+				}
+				d := day(p.date)
+				d.Points++
+				if trackName != "" && !slices.Contains(d.Tracks, trackName) {
+					d.Tracks = append(d.Tracks, trackName)
+				}
+				if prev != nil {
+					day(prev.date).Distance += haversine(*prev, p)
+				}
+				prev = &p
+			}
+		case xml.EndElement:
+			if t.Name.Local == "trk" {
+				inTrack, prev = false, nil
+			}
+		}
+	}
+	if len(errs) == 0 && len(order) == 0 {
+		errs = append(errs, readings.RowError{Line: 0, Msg: "no track points found"})
+	}
+
+	slices.Sort(order) // YYYY-MM-DD sorts chronologically
+	days := make([]Day, 0, len(order))
+	for _, date := range order {
+		days = append(days, *byDate[date])
+	}
+	return days, errs
+}
+
+// decodePoint reads one <trkpt>. A point needs a position and a time: without
+// the time it cannot be put on a day.
+func decodePoint(dec *xml.Decoder, start xml.StartElement, loc *time.Location) (point, error) {
+	var raw struct {
+		Lat  string `xml:"lat,attr"`
+		Lon  string `xml:"lon,attr"`
+		Time string `xml:"time"`
+	}
+	if err := dec.DecodeElement(&raw, &start); err != nil {
+		return point{}, err
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(raw.Lat), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return point{}, fmt.Errorf("track point latitude %q: expected a number between -90 and 90", raw.Lat)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(raw.Lon), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return point{}, fmt.Errorf("track point longitude %q: expected a number between -180 and 180", raw.Lon)
+	}
+	if strings.TrimSpace(raw.Time) == "" {
+		return point{}, fmt.Errorf("track point has no time")
+	}
+	at, err := time.Parse(time.RFC3339, strings.TrimSpace(raw.Time))
+	if err != nil {
+		return point{}, fmt.Errorf("track point time %q: expected RFC 3339, e.g. 2025-03-01T08:15:00Z", raw.Time)
+	}
+	return point{lat: lat, lon: lon, date: at.In(loc).Format("2006-01-02")}, nil
+}
+
+// haversine is the great-circle distance between two points in miles.
+func haversine(a, b point) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(b.lat-a.lat), rad(b.lon-a.lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.lat))*math.Cos(rad(b.lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(h))
+}
+
+// Options control an Import.
+type Options struct {
+	Purpose string // for the logged trips; personal when empty
+	Driver  string
+	NoTrips bool // propose readings only
+	Force   bool // accept readings that break the monotonic rule
+	DryRun  bool // propose without writing anything
+}
+
+// ProposedDay is one tracked day and what the import does with it.
+type ProposedDay struct {
+	Day
+	// Reading is the proposed odometer for the end of the day: the last known
+	// reading before it plus the day's miles (and any tracked days between).
+	// It is nil when the vehicle has no reading or plan start to add to.
+	Reading *int `json:"reading,omitempty"`
+	// Existing is set when the day already has a reading; it is kept, and
+	// later days build on it.
+	Existing bool `json:"existing,omitempty"`
+}
+
+// Proposal is what an Import would do (or did).
+type Proposal struct {
+	Days     []ProposedDay   `json:"days"`
+	Readings readings.Report `json:"readings"`
+	Trips    []trips.Trip    `json:"trips"`
+	// Conflict is set on a dry run whose readings would be refused by the
+	// monotonic rule without force.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// errNoSave aborts Import's vehicle update when there is nothing to write.
+var errNoSave = errors.New("nothing to save")
+
+// Import proposes readings and trips for days on vehicleID and, unless
+// opts.DryRun, saves them: the readings in one UpdateVehicle, proposed and
+// checked under the store's write lock, then a trip per day with driving. A
+// day that already has a trip from the same tracks is not logged again, so
+// re-importing a file is a no-op. tripLog may be nil when opts.NoTrips is set.
+func Import(ctx context.Context, st storage.Store, tripLog trips.Store, vehicleID string, days []Day, opts Options) (*Proposal, error) {
+	var logged []trips.Trip
+	if !opts.NoTrips {
+		var err error
+		if logged, err = tripLog.List(ctx, vehicleID); err != nil {
+			return nil, err
+		}
+	}
+
+	var p *Proposal
+	err := st.UpdateVehicle(ctx, vehicleID, func(data *model.VehicleData) error {
+		var err error
+		if p, err = propose(vehicleID, data, logged, days, opts); err != nil {
+			return err
+		}
+		var rows []readings.Reading
+		for _, d := range p.Days {
+			if d.Reading != nil { // existing days count as skipped
+				rows = append(rows, readings.Reading{Date: d.Date, Miles: *d.Reading})
+			}
+		}
+		merged, report := readings.Merge(data.Readings, rows, false)
+		p.Readings = report
+		if err := readings.CheckMonotonic(merged, data.OdometerChanges); err != nil && !opts.Force {
+			if opts.DryRun {
+				p.Conflict = err.Error()
+				return errNoSave
+			}
+			return fmt.Errorf("%w: %w", ErrNotMonotonic, err)
+		}
+		if opts.DryRun || report.Added == 0 {
+			return errNoSave
+		}
+		data.Readings = merged
+		return nil
+	})
+	if err != nil && !errors.Is(err, errNoSave) {
+		return nil, err
+	}
+	if opts.DryRun {
+		return p, nil
+	}
+	for i, t := range p.Trips {
+		saved, err := tripLog.Save(ctx, t)
+		if err != nil {
+			return nil, fmt.Errorf("save trip for %s: %w", t.StartDate, err)
+		}
+		p.Trips[i] = *saved
+	}
+	return p, nil
+}
+
+// propose works out each day's reading and trip. Readings build on the latest
+// reading before the day — existing or proposed — on the continuous odometer,
+// so a recorded odometer change in between is allowed for. Driving that was
+// not tracked is invisible here; a later real reading below a proposal is
+// what the monotonic check then catches.
+func propose(vehicleID string, data *model.VehicleData, logged []trips.Trip, days []Day, opts Options) (*Proposal, error) {
+	known := readings.Continuous(data.Readings, data.OdometerChanges)
+	p := &Proposal{Days: []ProposedDay{}, Trips: []trips.Trip{}}
+	for _, d := range days {
+		pd := ProposedDay{Day: d}
+		if raw, ok := data.Readings[d.Date]; ok {
+			pd.Existing = true
+			pd.Reading = &raw
+		} else if base, ok := lastBefore(known, data, d.Date); ok {
+			cont := base + d.Miles()
+			known[d.Date] = cont
+			raw := cont + readings.ShiftAt(data.OdometerChanges, d.Date)
+			pd.Reading = &raw
+		}
+		p.Days = append(p.Days, pd)
+
+		if opts.NoTrips || d.Miles() == 0 {
+			continue
+		}
+		t := trips.Trip{
+			VehicleID: vehicleID,
+			StartDate: d.Date,
+			Distance:  d.Miles(),
+			Purpose:   opts.Purpose,
+			Driver:    opts.Driver,
+			Notes:     notes(d),
+		}
+		if pd.Reading != nil && !pd.Existing {
+			end := *pd.Reading
+			t.EndOdometer = &end
+		}
+		if alreadyLogged(logged, t) {
+			continue
+		}
+		if err := trips.Normalize(&t); err != nil {
+			return nil, err
+		}
+		p.Trips = append(p.Trips, t)
+	}
+	return p, nil
+}
+
+// lastBefore returns the continuous odometer at the latest reading dated
+// before date, falling back to the plan's start mileage when the plan started
+// by then.
+func lastBefore(known map[string]int, data *model.VehicleData, date string) (int, bool) {
+	best := ""
+	for d := range known {
+		if d < date && d > best {
+			best = d
+		}
+	}
+	if best != "" {
+		return known[best], true
+	}
+	if data.Plan != nil && data.Plan.Start.Format("2006-01-02") <= date {
+		return calc.StartMiles(data), true
+	}
+	return 0, false
+}
+
+// notes labels an imported trip with its source, which is also how a
+// re-import recognises it.
+func notes(d Day) string {
+	if len(d.Tracks) == 0 {
+		return "GPX import"
+	}
+	return "GPX: " + strings.Join(d.Tracks, ", ")
+}
+
+func alreadyLogged(logged []trips.Trip, t trips.Trip) bool {
+	for _, l := range logged {
+		if l.StartDate == t.StartDate && l.Distance == t.Distance && l.Notes == t.Notes {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package gpx
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// A tenth of a degree of latitude is about 6.91 miles, so each day below is
+// two such legs: 13.82 miles, 14 rounded.
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata><name>Export</name></metadata>
+  <trk>
+    <name>Commute</name>
+    <trkseg>
+      <trkpt lat="51.0" lon="0"><time>2025-06-02T07:00:00Z</time></trkpt>
+      <trkpt lat="51.1" lon="0"><time>2025-06-02T07:10:00Z</time></trkpt>
+      <trkpt lat="51.2" lon="0"><time>2025-06-02T07:20:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+  <trk>
+    <name>Errands</name>
+    <trkseg>
+      <trkpt lat="51.0" lon="0"><time>2025-06-03T09:00:00Z</time></trkpt>
+      <trkpt lat="51.1" lon="0"><time>2025-06-03T09:10:00Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="52.0" lon="0"><time>2025-06-03T15:00:00Z</time></trkpt>
+      <trkpt lat="52.1" lon="0"><time>2025-06-03T15:10:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParseGroupsTracksByDay(t *testing.T) {
+	days, errs := Parse(strings.NewReader(sample), time.UTC)
+	if len(errs) > 0 {
+		t.Fatalf("errs: %v", errs)
+	}
+	if len(days) != 2 {
+		t.Fatalf("days: %+v", days)
+	}
+	if days[0].Date != "2025-06-02" || days[0].Points != 3 || days[0].Tracks[0] != "Commute" {
+		t.Fatalf("day 1: %+v", days[0])
+	}
+	// The two segments on day 2 are not joined: 62 miles apart.
+	for _, d := range days {
+		if math.Abs(d.Distance-13.82) > 0.01 || d.Miles() != 14 {
+			t.Fatalf("%s distance %.3f, want 13.82", d.Date, d.Distance)
+		}
+	}
+}
+
+func TestParseUsesLocationForTheDay(t *testing.T) {
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	// 15:00Z on the 3rd is already the 4th ten hours east.
+	days, _ := Parse(strings.NewReader(sample), loc)
+	if len(days) != 3 || days[2].Date != "2025-06-04" {
+		t.Fatalf("days: %+v", days)
+	}
+}
+
+func TestParseReportsEveryBadPoint(t *testing.T) {
+	doc := `<gpx><trk><trkseg>
+<trkpt lat="91" lon="0"><time>2025-06-02T07:00:00Z</time></trkpt>
+<trkpt lat="51" lon="0"></trkpt>
+<trkpt lat="51" lon="0"><time>yesterday</time></trkpt>
+</trkseg></trk></gpx>`
+	_, errs := Parse(strings.NewReader(doc), time.UTC)
+	if len(errs) != 3 {
+		t.Fatalf("want 3 errors, got %v", errs)
+	}
+	if errs[0].Line != 2 || !strings.Contains(errs[0].Msg, "latitude") || errs[1].Line != 3 || errs[2].Line != 4 {
+		t.Fatalf("errs: %v", errs)
+	}
+
+	if _, errs := Parse(strings.NewReader(`<gpx><trk>`), time.UTC); len(errs) != 1 {
+		t.Fatalf("truncated file: %v", errs)
+	}
+	if _, errs := Parse(strings.NewReader(`<gpx></gpx>`), time.UTC); len(errs) != 1 || errs[0].Line != 0 {
+		t.Fatalf("empty file: %v", errs)
+	}
+}
+
+func seed(t *testing.T, readings map[string]int) storage.Store {
+	t.Helper()
+	st := storage.NewMemory()
+	if err := st.SaveVehicle(context.Background(), "golf", &model.VehicleData{Vehicle: "Golf", Readings: readings}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestImportProposesAndSaves(t *testing.T) {
+	ctx := context.Background()
+	st := seed(t, map[string]int{"2025-06-01": 5000})
+	tripLog := trips.NewMemory()
+	days, _ := Parse(strings.NewReader(sample), time.UTC)
+
+	preview, err := Import(ctx, st, tripLog, "golf", days, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *preview.Days[0].Reading != 5014 || *preview.Days[1].Reading != 5028 || preview.Readings.Added != 2 || len(preview.Trips) != 2 {
+		t.Fatalf("preview: %+v", preview)
+	}
+	if data, _ := st.GetVehicle(ctx, "golf"); len(data.Readings) != 1 {
+		t.Fatalf("dry run wrote readings: %v", data.Readings)
+	}
+	if list, _ := tripLog.List(ctx, "golf"); len(list) != 0 {
+		t.Fatalf("dry run wrote trips: %+v", list)
+	}
+
+	if _, err := Import(ctx, st, tripLog, "golf", days, Options{Purpose: trips.Business, Driver: "Sam"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-06-02"] != 5014 || data.Readings["2025-06-03"] != 5028 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+	list, _ := tripLog.List(ctx, "golf")
+	if len(list) != 2 || list[0].Purpose != trips.Business || list[0].Driver != "Sam" ||
+		*list[0].StartOdometer != 5000 || *list[1].EndOdometer != 5028 || list[1].Notes != "GPX: Errands" {
+		t.Fatalf("trips: %+v", list)
+	}
+
+	again, err := Import(ctx, st, tripLog, "golf", days, Options{Purpose: trips.Business, Driver: "Sam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Readings.Added != 0 || again.Readings.Skipped != 2 || len(again.Trips) != 0 {
+		t.Fatalf("re-import: %+v", again)
+	}
+}
+
+func TestImportAcrossOdometerChange(t *testing.T) {
+	ctx := context.Background()
+	st := seed(t, map[string]int{"2025-06-01": 99990})
+	data, _ := st.GetVehicle(ctx, "golf")
+	data.OdometerChanges = []model.OdometerChange{{Date: "2025-06-02", OldFinal: 99995, NewStart: 0}}
+	st.SaveVehicle(ctx, "golf", data)
+	days, _ := Parse(strings.NewReader(sample), time.UTC)
+
+	p, err := Import(ctx, st, nil, "golf", days, Options{NoTrips: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 99990 + 14 on the old scale is 9 past the 99995 rollover point.
+	if *p.Days[0].Reading != 9 || *p.Days[1].Reading != 23 {
+		t.Fatalf("days: %+v", p.Days)
+	}
+}
+
+func TestImportRefusesReadingsThatDoNotFit(t *testing.T) {
+	ctx := context.Background()
+	st := seed(t, map[string]int{"2025-06-01": 5000, "2025-06-10": 5010})
+	days, _ := Parse(strings.NewReader(sample), time.UTC)
+
+	if _, err := Import(ctx, st, nil, "golf", days, Options{NoTrips: true}); !errors.Is(err, ErrNotMonotonic) {
+		t.Fatalf("want ErrNotMonotonic, got %v", err)
+	}
+	p, err := Import(ctx, st, nil, "golf", days, Options{NoTrips: true, DryRun: true})
+	if err != nil || p.Conflict == "" {
+		t.Fatalf("dry run: %+v, %v", p, err)
+	}
+	if _, err := Import(ctx, st, nil, "golf", days, Options{NoTrips: true, Force: true}); err != nil {
+		t.Fatalf("forced: %v", err)
+	}
+}
+
+func TestImportWithoutBase(t *testing.T) {
+	st := seed(t, map[string]int{})
+	days, _ := Parse(strings.NewReader(sample), time.UTC)
+	p, err := Import(context.Background(), st, trips.NewMemory(), "golf", days, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Days[0].Reading != nil || p.Readings.Added != 0 || len(p.Trips) != 2 || p.Trips[0].EndOdometer != nil {
+		t.Fatalf("proposal: %+v", p)
+	}
+}
@@ -0,0 +1,204 @@
+// Package ingest records odometer readings pushed by home automation. Each
+// vehicle can have an ingestion token; a push carrying it records at most one
+// reading per day for that vehicle through storage.Store.UpdateVehicle, checked
+// against the plausibility and monotonic rules and attributed in the journal to
+// Actor so pushed readings are told apart from typed ones.
+//
+// Two payloads are accepted. The native one is
+//
+//	{"odometer": 12345.6, "unit": "km", "date": "2025-06-01"}
+//
+// where unit (mi by default), date and timestamp (RFC 3339, used when date is
+// absent) are optional and odometer may be a number or a numeric string. The
+// other is what Home Assistant's RESTful notify integration posts — the sensor
+// state in message, e.g. "12345.6 km" — with unit, date or timestamp taken
+// from the top level or from data when the notification sets them.
+//
+// Tokens live in a tokenstore.Store, keyed by owner — the hosted user id, or
+// storage.LocalOwner in single-user mode — and vehicle id, like connected-car
+// links.
+package ingest
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+// Actor is the journal actor for pushed readings.
+const Actor = "ingest"
+
+var (
+	// ErrInvalidPayload is returned by ParsePush for a body it cannot read an
+	// odometer from.
+	ErrInvalidPayload = errors.New("invalid payload")
+
+	// ErrImplausible wraps readings.CheckPlausible's error.
+	ErrImplausible = errors.New("implausible reading")
+
+	// ErrNotMonotonic wraps readings.CheckMonotonic's error. Pushes are never
+	// forced past the rule.
+	ErrNotMonotonic = errors.New("reading does not fit the existing ones")
+)
+
+// Push is one odometer value, already converted to miles and dated.
+type Push struct {
+	Date  string `json:"date"`
+	Miles int    `json:"miles"`
+}
+
+// payload is the union of both accepted shapes.
+type payload struct {
+	Odometer  json.Number `json:"odometer"`
+	Message   string      `json:"message"`
+	Unit      string      `json:"unit"`
+	Date      string      `json:"date"`
+	Timestamp string      `json:"timestamp"`
+	Data      *struct {
+		Unit      string `json:"unit"`
+		Date      string `json:"date"`
+		Timestamp string `json:"timestamp"`
+	} `json:"data"`
+}
+
+// messageRe reads a Home Assistant state such as "12345", "12,345.6 km" or
+// "12345 mi".
+var messageRe = regexp.MustCompile(`^\s*([0-9][0-9,]*(?:\.[0-9]+)?)\s*([A-Za-z]*)\s*$`)
+
+// ParsePush reads body in either accepted shape. A push without a date or
+// timestamp is dated now; a timestamp is dated in now's location.
+func ParsePush(body []byte, now time.Time) (*Push, error) {
+	var p payload
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if p.Data != nil {
+		p.Unit = cmp.Or(p.Unit, p.Data.Unit)
+		p.Date = cmp.Or(p.Date, p.Data.Date)
+		p.Timestamp = cmp.Or(p.Timestamp, p.Data.Timestamp)
+	}
+
+	raw := p.Odometer.String()
+	if raw == "" {
+		m := messageRe.FindStringSubmatch(p.Message)
+		if m == nil {
+			if p.Message == "" {
+				return nil, fmt.Errorf("%w: odometer or message is required", ErrInvalidPayload)
+			}
+			return nil, fmt.Errorf("%w: message %q is not an odometer value", ErrInvalidPayload, p.Message)
+		}
+		raw = strings.ReplaceAll(m[1], ",", "")
+		p.Unit = cmp.Or(p.Unit, m[2])
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: odometer %q is not a non-negative number", ErrInvalidPayload, raw)
+	}
+	switch strings.ToLower(p.Unit) {
+	case "", "mi", "miles":
+	case "km", "kilometers", "kilometres":
+		value /= 1.609344
+	default:
+		return nil, fmt.Errorf("%w: unit %q: expected mi or km", ErrInvalidPayload, p.Unit)
+	}
+
+	date := p.Date
+	switch {
+	case date != "":
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%w: date %q: expected YYYY-MM-DD", ErrInvalidPayload, date)
+		}
+	case p.Timestamp != "":
+		at, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: timestamp %q: expected RFC 3339", ErrInvalidPayload, p.Timestamp)
+		}
+		date = at.In(now.Location()).Format("2006-01-02")
+	default:
+		date = now.Format("2006-01-02")
+	}
+	return &Push{Date: date, Miles: int(math.Round(value))}, nil
+}
+
+// Result is the outcome of Record.
+type Result struct {
+	Status string `json:"status"` // "recorded" or "unchanged"
+	Push
+}
+
+// Record upserts push as vehicleID's reading for its day. A value equal to
+// the day's reading writes nothing; otherwise the value must be plausible (as
+// of now's date) and keep the readings monotonic. The checks and the write
+// run under the store's lock, so a concurrent import or add cannot slip a
+// reading in between them.
+func Record(ctx context.Context, st storage.Store, vehicleID string, push Push, now time.Time) (*Result, error) {
+	today := now.Format("2006-01-02")
+	err := st.UpdateVehicle(journal.WithActor(ctx, Actor), vehicleID, func(data *model.VehicleData) error {
+		if miles, ok := data.Readings[push.Date]; ok && miles == push.Miles {
+			return errUnchanged
+		}
+		if err := readings.CheckPlausible(data.Readings, data.OdometerChanges, push.Date, push.Miles, today); err != nil {
+			return fmt.Errorf("%w: %w", ErrImplausible, err)
+		}
+		merged := maps.Clone(data.Readings)
+		if merged == nil {
+			merged = map[string]int{}
+		}
+		merged[push.Date] = push.Miles
+		if err := readings.CheckMonotonic(merged, data.OdometerChanges); err != nil {
+			return fmt.Errorf("%w: %w", ErrNotMonotonic, err)
+		}
+		data.Readings = merged
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return &Result{Status: "unchanged", Push: push}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Status: "recorded", Push: push}, nil
+}
+
+// errUnchanged aborts Record's update when the day already has the reading.
+var errUnchanged = errors.New("reading unchanged")
+
+// MoveVehicle re-keys owner's token on fromID to toID when a vehicle is
+// renamed or merged. If toID already has a token it wins and fromID's is
+// revoked: each vehicle has one.
+func MoveVehicle(ctx context.Context, tokens tokenstore.Store, owner, fromID, toID string) error {
+	tok, err := tokens.Get(ctx, owner, fromID)
+	if errors.Is(err, tokenstore.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tokens.Get(ctx, owner, toID); errors.Is(err, tokenstore.ErrNotFound) {
+		moved := *tok
+		moved.VehicleID = toID
+		if err := tokens.Put(ctx, moved); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return tokens.Delete(ctx, owner, fromID)
+}
@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+func TestParsePush(t *testing.T) {
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		body string
+		want Push
+	}{
+		{`{"odometer": 12345}`, Push{"2025-06-02", 12345}},
+		{`{"odometer": "16093.44", "unit": "km", "date": "2025-06-01"}`, Push{"2025-06-01", 10000}},
+		{`{"odometer": 500, "timestamp": "2025-05-31T23:30:00-02:00"}`, Push{"2025-06-01", 500}},
+		// Home Assistant's RESTful notify: the state in message.
+		{`{"message": "12,345.6 mi", "title": "Golf"}`, Push{"2025-06-02", 12346}},
+		{`{"message": "16093.44", "data": {"unit": "km", "date": "2025-05-30"}}`, Push{"2025-05-30", 10000}},
+	} {
+		got, err := ParsePush([]byte(tc.body), now)
+		if err != nil || *got != tc.want {
+			t.Errorf("%s: got %+v, %v; want %+v", tc.body, got, err, tc.want)
+		}
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"message": "unavailable"}`,
+		`{"odometer": -1}`,
+		`{"odometer": 100, "unit": "furlongs"}`,
+		`{"odometer": 100, "date": "June"}`,
+		`not json`,
+	} {
+		if _, err := ParsePush([]byte(body), now); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: want ErrInvalidPayload, got %v", body, err)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	st := journal.Wrap(storage.NewMemory(), journal.NewMemoryLog(), "web")
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-06-01": 10000}})
+
+	res, err := Record(ctx, st, "golf", Push{"2025-06-02", 10040}, now)
+	if err != nil || res.Status != "recorded" {
+		t.Fatalf("Record: %+v, %v", res, err)
+	}
+	// A later push the same day replaces the day's reading.
+	if _, err := Record(ctx, st, "golf", Push{"2025-06-02", 10060}, now); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := Record(ctx, st, "golf", Push{"2025-06-02", 10060}, now); res.Status != "unchanged" {
+		t.Fatalf("repeat push: %+v", res)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if len(data.Readings) != 2 || data.Readings["2025-06-02"] != 10060 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+	if history[0].Actor != Actor {
+		t.Fatalf("push not attributed: %+v", history[0])
+	}
+
+	if _, err := Record(ctx, st, "golf", Push{"2025-06-02", 9000}, now); !errors.Is(err, ErrNotMonotonic) {
+		t.Fatalf("lower push: %v", err)
+	}
+	if _, err := Record(ctx, st, "golf", Push{"2025-06-02", 100000}, now); !errors.Is(err, ErrImplausible) {
+		t.Fatalf("jump: %v", err)
+	}
+	if _, err := Record(ctx, st, "golf", Push{"2025-06-03", 10100}, now); !errors.Is(err, ErrImplausible) {
+		t.Fatalf("future date: %v", err)
+	}
+	if _, err := Record(ctx, st, "polo", Push{"2025-06-02", 1}, now); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("missing vehicle: %v", err)
+	}
+}
+
+func TestMoveVehicle(t *testing.T) {
+	ctx := context.Background()
+	for name, tokens := range map[string]tokenstore.Store{
+		"file":   NewFileTokenStore(t.TempDir()),
+		"memory": NewMemoryTokenStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tokens.Put(ctx, tokenstore.Token{Owner: "u1", VehicleID: "golf", TokenHash: "b"})
+			if err := MoveVehicle(ctx, tokens, "u1", "golf", "gti"); err != nil {
+				t.Fatal(err)
+			}
+			if tok, _ := tokens.Resolve(ctx, "b"); tok == nil || tok.VehicleID != "gti" {
+				t.Fatalf("token not moved: %+v", tok)
+			}
+			if _, err := tokens.Get(ctx, "u1", "golf"); !errors.Is(err, tokenstore.ErrNotFound) {
+				t.Fatalf("old vehicle keeps its token: %v", err)
+			}
+
+			// The target's own token wins.
+			tokens.Put(ctx, tokenstore.Token{Owner: "u1", VehicleID: "polo", TokenHash: "c"})
+			if err := MoveVehicle(ctx, tokens, "u1", "polo", "gti"); err != nil {
+				t.Fatal(err)
+			}
+			if tok, _ := tokens.Get(ctx, "u1", "gti"); tok == nil || tok.TokenHash != "b" {
+				t.Fatalf("target's token replaced: %+v", tok)
+			}
+			if _, err := tokens.Resolve(ctx, "c"); !errors.Is(err, tokenstore.ErrNotFound) {
+				t.Fatalf("merged vehicle's token still resolves: %v", err)
+			}
+		})
+	}
+}
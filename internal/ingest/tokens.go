@@ -0,0 +1,26 @@
+package ingest
+
+import (
+	"path/filepath"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/tokenstore"
+)
+
+// NewFileTokenStore returns the ingestion token store in dir,
+// <dir>/ingest_tokens.
+func NewFileTokenStore(dir string) *tokenstore.FileStore {
+	return tokenstore.NewFile(filepath.Join(dir, "ingest_tokens"), "ingest token")
+}
+
+// NewEncryptedFileTokenStore is NewFileTokenStore sealed with key, the
+// directory's encryption key, or plain for a nil key.
+func NewEncryptedFileTokenStore(dir string, key *crypt.Key) *tokenstore.FileStore {
+	return tokenstore.NewEncryptedFile(filepath.Join(dir, "ingest_tokens"), "ingest token", key)
+}
+
+// NewMemoryTokenStore returns an empty in-memory ingestion token store for
+// tests.
+func NewMemoryTokenStore() *tokenstore.MemoryStore {
+	return tokenstore.NewMemory("ingest token")
+}
@@ -0,0 +1,21 @@
+package journal
+
+import (
+	"path/filepath"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+// NewEncryptedFileLog returns a FileLog in dir whose lines are each sealed
+// with key (see crypt.SealLine), so the log stays append-only and line-based.
+// A nil key makes a plain FileLog, as NewFileLog does.
+func NewEncryptedFileLog(dir string, key *crypt.Key) *FileLog {
+	return &FileLog{path: filepath.Join(dir, "journal.jsonl"), key: key}
+}
+
+// ConvertFileLog rewrites the journal in dir from one key to another, as
+// yamlstore.Convert does a store directory, reporting whether it needed to.
+// See crypt.ConvertLines.
+func ConvertFileLog(dir string, from, to *crypt.Key) (bool, error) {
+	return crypt.ConvertLines(filepath.Join(dir, "journal.jsonl"), from, to)
+}
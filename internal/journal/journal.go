@@ -0,0 +1,376 @@
+// Package journal records an append-only history of every mutation made
+// through a storage.Store — who made it, when, and the vehicle documents
+// before and after — and undoes a recorded change by replaying its inverse.
+//
+// It is a decorator rather than a feature of each backend: Wrap takes any
+// Store and returns one that journals, so the YAML store, the in-memory store
+// and anything added later get the same history without code of their own.
+// The journal lives beside the data it describes (a journal.jsonl file in the
+// data directory, per user in hosted mode).
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+// Journalled operations. Each is the Store method that made the change, except
+// OpRevert, which is an undo that put vehicle documents back.
+const (
+	OpSaveVehicle   = "save_vehicle"
+	OpDeleteVehicle = "delete_vehicle"
+	OpPutReading    = "put_reading"
+	OpDeleteReading = "delete_reading"
+	OpRename        = "rename"
+	OpMerge         = "merge"
+	OpRestore       = "restore"
+	OpSetCurrent    = "set_current"
+	OpSaveSettings  = "save_settings"
+	OpRevert        = "revert"
+)
+
+// ErrConflict is returned by Undo when the data an entry changed has changed
+// again since, so replaying the inverse would clobber the later edit.
+var ErrConflict = errors.New("changed since")
+
+// ErrNotUndoable is returned by Undo for an entry with no inverse: setting the
+// first default vehicle, which cannot be unset.
+var ErrNotUndoable = errors.New("cannot be undone")
+
+// Entry is one journalled mutation. Before and After are the whole document
+// of vehicle VehicleID either side of the change, nil where it did not exist,
+// so every vehicle change — a plan edit, a reading, a delete — is recorded the
+// same way and undone by putting Before back.
+//
+// Renames and merges touch a second vehicle, From, whose documents are
+// FromBefore and FromAfter. For OpSetCurrent, VehicleID is the new default and
+// From the previous one; OpSaveSettings records the settings documents
+// instead of vehicles.
+type Entry struct {
+	// ID identifies the entry within its journal. It is random hex, like a
+	// trash item id, so it is safe in a URL.
+	ID        string    `json:"id"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	Op        string    `json:"op"`
+	VehicleID string    `json:"vehicle_id,omitempty"`
+	Date      string    `json:"date,omitempty"`
+	From      string    `json:"from,omitempty"`
+
+	Before     *model.VehicleData `json:"before,omitempty"`
+	After      *model.VehicleData `json:"after,omitempty"`
+	FromBefore *model.VehicleData `json:"from_before,omitempty"`
+	FromAfter  *model.VehicleData `json:"from_after,omitempty"`
+
+	SettingsBefore *model.Settings `json:"settings_before,omitempty"`
+	SettingsAfter  *model.Settings `json:"settings_after,omitempty"`
+
+	// Undoes is the id of the entry this one reverted, when it is an undo.
+	Undoes string `json:"undoes,omitempty"`
+}
+
+// Touches reports whether the entry changed vehicle id.
+func (e Entry) Touches(id string) bool {
+	return e.VehicleID == id || (e.From == id && e.Op != OpSetCurrent)
+}
+
+func newEntryID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Log is the append-only entry log behind a journalled Store.
+type Log interface {
+	// Append adds an entry to the end of the log.
+	Append(ctx context.Context, e Entry) error
+	// Entries returns every entry, oldest first.
+	Entries(ctx context.Context) ([]Entry, error)
+	// Recent calls fn with each entry, newest first, until fn returns false.
+	// fn must not use the log.
+	Recent(ctx context.Context, fn func(Entry) bool) error
+}
+
+// DefaultMaxSize is the size a FileLog is trimmed back from when MaxSize is
+// unset.
+const DefaultMaxSize = 16 << 20
+
+// FileLog keeps entries as JSON lines in <dir>/journal.jsonl. Lines are only
+// ever appended, so a crash can at worst leave a torn final line; Entries
+// skips a line it cannot parse rather than losing the whole history to it.
+// The .jsonl extension keeps the file out of yamlstore's *.yml vehicle scan.
+//
+// Every entry holds whole vehicle documents, so the file is not left to grow
+// without bound: once an Append takes it past MaxSize, the oldest entries are
+// dropped until it is half that, and can no longer be undone. Appends, and so
+// the trimming, are serialised across processes by a lock file beside it.
+type FileLog struct {
+	// MaxSize is the size in bytes past which old entries are dropped;
+	// DefaultMaxSize if zero.
+	MaxSize int64
+
+	path string
+	key  *crypt.Key // nil for plain JSON lines; see NewEncryptedFileLog
+	mu   sync.Mutex
+}
+
+// NewFileLog returns a FileLog in dir, created on the first Append.
+func NewFileLog(dir string) *FileLog {
+	return &FileLog{path: filepath.Join(dir, "journal.jsonl")}
+}
+
+// lockPath is the FileLog's cross-process lock. The leading dot and missing
+// .yml extension keep it out of yamlstore's vehicle scan.
+func (l *FileLog) lockPath() string {
+	return filepath.Join(filepath.Dir(l.path), ".journal.lock")
+}
+
+func (l *FileLog) Append(ctx context.Context, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode journal entry: %w", err)
+	}
+	if line, err = crypt.SealLine(l.key, line); err != nil {
+		return fmt.Errorf("encode journal entry: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	lock, err := filelock.Exclusive(l.lockPath())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	max := l.MaxSize
+	if max <= 0 {
+		max = DefaultMaxSize
+	}
+	if info.Size() > max {
+		return l.trim(max / 2)
+	}
+	return nil
+}
+
+// trim rewrites the file with only the newest lines that fit in size bytes,
+// keeping at least the last one. The caller holds the locks.
+func (l *FileLog) trim(size int64) error {
+	raw, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	keep := bytes.TrimSuffix(raw, []byte("\n"))
+	if start := int64(len(keep)) - size; start > 0 {
+		i := bytes.IndexByte(keep[start:], '\n')
+		if i < 0 {
+			i = bytes.LastIndexByte(keep[:start], '\n')
+		} else {
+			i += int(start)
+		}
+		keep = keep[i+1:]
+	}
+	if err := atomicfile.Write(l.path, 0600, func(f *os.File) error {
+		_, err := f.Write(append(keep, '\n'))
+		return err
+	}); err != nil {
+		return fmt.Errorf("trim journal: %w", err)
+	}
+	return nil
+}
+
+func (l *FileLog) Entries(ctx context.Context) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	raw, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	var entries []Entry
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(nil, len(raw)+1)
+	for sc.Scan() {
+		if e, ok := l.parse(sc.Bytes()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// tailChunk is how much of the file Recent reads at a time.
+const tailChunk = 64 << 10
+
+// Recent reads the file backwards from its end, a chunk at a time, so finding
+// the latest entries does not read the whole history.
+func (l *FileLog) Recent(ctx context.Context, fn func(Entry) bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read journal: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	buf := make([]byte, tailChunk)
+	var rest []byte // the start of a line whose end has been read
+	for end := info.Size(); end > 0; {
+		n := min(end, tailChunk)
+		end -= n
+		if _, err := f.ReadAt(buf[:n], end); err != nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+		rest = append(append([]byte(nil), buf[:n]...), rest...)
+		for i := bytes.LastIndexByte(rest, '\n'); i >= 0; i = bytes.LastIndexByte(rest, '\n') {
+			if e, ok := l.parse(rest[i+1:]); ok && !fn(e) {
+				return nil
+			}
+			rest = rest[:i]
+		}
+	}
+	if e, ok := l.parse(rest); ok {
+		fn(e)
+	}
+	return nil
+}
+
+// parse decodes one line, reporting false for a blank, torn or unreadable one.
+func (l *FileLog) parse(raw []byte) (Entry, bool) {
+	if len(raw) == 0 {
+		return Entry{}, false
+	}
+	line, err := crypt.OpenLine(l.key, raw)
+	if err != nil {
+		return Entry{}, false
+	}
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// MemoryLog is an in-memory Log for tests.
+type MemoryLog struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewMemoryLog returns an empty MemoryLog.
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{}
+}
+
+func (l *MemoryLog) Append(ctx context.Context, e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+func (l *MemoryLog) Entries(ctx context.Context) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry(nil), l.entries...), nil
+}
+
+func (l *MemoryLog) Recent(ctx context.Context, fn func(Entry) bool) error {
+	entries, _ := l.Entries(ctx)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !fn(entries[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Observe returns log with fn called for every entry once it is appended, so
+// work outside the request — republishing a vehicle's status, say — can follow
+// changes as they happen rather than polling. fn runs on the writer's
+// goroutine, under the journal's lock, so it must not block or write.
+func Observe(log Log, fn func(Entry)) Log {
+	return &observedLog{Log: log, fn: fn}
+}
+
+type observedLog struct {
+	Log
+	fn func(Entry)
+}
+
+func (l *observedLog) Append(ctx context.Context, e Entry) error {
+	if err := l.Log.Append(ctx, e); err != nil {
+		return err
+	}
+	l.fn(e)
+	return nil
+}
+
+var (
+	_ Log = (*FileLog)(nil)
+	_ Log = (*MemoryLog)(nil)
+	_ Log = (*observedLog)(nil)
+)
+
+// sameVehicle reports whether two vehicle documents are equal, nil meaning
+// absent. Plan dates compare as instants, since a document read back from
+// disk may carry a different location than the one written.
+func sameVehicle(a, b *model.VehicleData) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Vehicle != b.Vehicle || a.Registration != b.Registration || !maps.Equal(a.Readings, b.Readings) ||
+		!slices.Equal(a.OdometerChanges, b.OdometerChanges) {
+		return false
+	}
+	if a.Plan == nil || b.Plan == nil {
+		return a.Plan == b.Plan
+	}
+	pa, pb := *a.Plan, *b.Plan
+	return pa.Start.Equal(pb.Start) && pa.End.Equal(pb.End) &&
+		pa.AnnualAllowance == pb.AnnualAllowance && pa.StartMiles == pb.StartMiles && pa.ExcessRate == pb.ExcessRate
+}
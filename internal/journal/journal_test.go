@@ -0,0 +1,381 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+)
+
+func TestJournalledStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return Wrap(storage.NewMemory(), NewMemoryLog(), "test")
+	})
+}
+
+func newJournalled(t *testing.T) *Store {
+	t.Helper()
+	st := Wrap(storage.NewMemory(), NewMemoryLog(), "cli")
+	if err := st.SaveVehicle(context.Background(), "golf", &model.VehicleData{
+		Vehicle:  "Golf",
+		Readings: map[string]int{"2025-01-01": 5000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestHistoryRecordsBeforeAndAfter(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.PutReading(ctx, "golf", "2025-02-01", 5600); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := st.History(ctx, "golf", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("golf history = %d entries, want 2", len(history))
+	}
+	latest := history[0]
+	if latest.Op != OpPutReading || latest.Date != "2025-02-01" || latest.Actor != "cli" {
+		t.Errorf("latest = %+v", latest)
+	}
+	if _, ok := latest.Before.Readings["2025-02-01"]; ok {
+		t.Error("before should not have the new reading")
+	}
+	if latest.After.Readings["2025-02-01"] != 5600 {
+		t.Errorf("after = %v", latest.After.Readings)
+	}
+	if history[1].Op != OpSaveVehicle || history[1].Before != nil {
+		t.Errorf("create entry = %+v", history[1])
+	}
+
+	all, _ := st.History(ctx, "", 0)
+	if len(all) != 3 {
+		t.Errorf("full history = %d entries, want 3", len(all))
+	}
+}
+
+func TestWithActorOverridesStoreActor(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.PutReading(WithActor(ctx, "auto:fake"), "golf", "2025-02-01", 5600); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+	if history[0].Actor != "auto:fake" || history[1].Actor != "cli" {
+		t.Fatalf("actors = %q, %q", history[0].Actor, history[1].Actor)
+	}
+}
+
+func TestObserveSeesAppendedEntries(t *testing.T) {
+	ctx := context.Background()
+	var seen []string
+	st := Wrap(storage.NewMemory(), Observe(NewMemoryLog(), func(e Entry) { seen = append(seen, e.Op) }), "cli")
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"})
+	st.PutReading(ctx, "golf", "2025-01-01", 5000)
+	st.PutReading(ctx, "polo", "2025-01-01", 5000) // fails: nothing journalled
+	if len(seen) != 2 || seen[1] != OpPutReading {
+		t.Fatalf("observed %v", seen)
+	}
+	if all, _ := st.History(ctx, "", 0); len(all) != 2 {
+		t.Fatalf("entries not appended through: %d", len(all))
+	}
+}
+
+func TestUndoReadingAndRedo(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.PutReading(ctx, "golf", "2025-01-01", 9000); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+
+	undo, err := st.Undo(ctx, history[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undo.Op != OpRevert || undo.Undoes != history[0].ID || undo.ID == "" {
+		t.Errorf("undo entry = %+v", undo)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-01-01"] != 5000 {
+		t.Errorf("after undo = %v, want 5000", data.Readings)
+	}
+
+	if _, err := st.Undo(ctx, undo.ID); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-01-01"] != 9000 {
+		t.Errorf("after redo = %v, want 9000", data.Readings)
+	}
+}
+
+func TestUndoRefusesWhenChangedSince(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.PutReading(ctx, "golf", "2025-02-01", 5600); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := st.History(ctx, "golf", 0)
+	if err := st.PutReading(ctx, "golf", "2025-03-01", 6100); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := st.Undo(ctx, history[0].ID)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("err = %v, want ErrConflict", err)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if len(data.Readings) != 3 {
+		t.Errorf("conflicting undo changed data: %v", data.Readings)
+	}
+
+	if _, err := st.Undo(ctx, "nope"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unknown entry err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUndoDeleteRenameAndMerge(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.RenameVehicle(ctx, "golf", "golf-r"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := st.History(ctx, "golf-r", 0)
+	if _, err := st.Undo(ctx, h[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetVehicle(ctx, "golf"); err != nil {
+		t.Fatalf("rename not undone: %v", err)
+	}
+	if cur, _ := st.GetCurrent(ctx); cur != "golf" {
+		t.Errorf("current = %q, want golf", cur)
+	}
+
+	if err := st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo", Readings: map[string]int{"2025-03-01": 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.MergeVehicle(ctx, "polo", "golf", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, _ = st.History(ctx, "golf", 0)
+	if _, err := st.Undo(ctx, h[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	golf, _ := st.GetVehicle(ctx, "golf")
+	polo, err := st.GetVehicle(ctx, "polo")
+	if err != nil || len(golf.Readings) != 1 || polo.Readings["2025-03-01"] != 100 {
+		t.Errorf("merge not undone: golf=%v polo=%v err=%v", golf.Readings, polo, err)
+	}
+
+	if err := st.DeleteVehicle(ctx, "polo"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ = st.History(ctx, "polo", 0)
+	if _, err := st.Undo(ctx, h[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetVehicle(ctx, "polo"); err != nil {
+		t.Errorf("delete not undone: %v", err)
+	}
+}
+
+func TestUndoDeleteEmptiesTrash(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := st.History(ctx, "golf", 2)
+	for _, e := range h {
+		if _, err := st.Undo(ctx, e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items, _ := st.ListTrash(ctx); len(items) != 0 {
+		t.Fatalf("trash after undo = %+v", items)
+	}
+	golf, err := st.GetVehicle(ctx, "golf")
+	if err != nil || golf.Readings["2025-01-01"] != 5000 {
+		t.Fatalf("golf = %+v, %v", golf, err)
+	}
+
+	// Undoing a vehicle's creation trashes it, and undoing that undo takes
+	// it back out.
+	if err := st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+	h, _ = st.History(ctx, "polo", 1)
+	undo, err := st.Undo(ctx, h[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := st.ListTrash(ctx); len(items) != 1 {
+		t.Fatalf("trash after undoing the creation = %+v", items)
+	}
+	if _, err := st.Undo(ctx, undo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := st.ListTrash(ctx); len(items) != 0 {
+		t.Errorf("trash after redoing it = %+v", items)
+	}
+}
+
+func TestUndoFirstDefaultIsNotUndoable(t *testing.T) {
+	ctx := context.Background()
+	st := newJournalled(t)
+	if err := st.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := st.History(ctx, "golf", 0)
+	if _, err := st.Undo(ctx, h[0].ID); !errors.Is(err, ErrNotUndoable) {
+		t.Errorf("err = %v, want ErrNotUndoable", err)
+	}
+}
+
+func TestFileLogSkipsTornLine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	log := NewFileLog(dir)
+	st := Wrap(storage.NewMemory(), log, "web")
+	if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "journal.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"torn","op":`)
+	f.Close()
+
+	entries, err := log.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "web" || entries[0].After.Vehicle != "Golf" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestFileLogTrimsOldEntries(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	log := NewFileLog(dir)
+	log.MaxSize = 4 * tailChunk
+	st := Wrap(storage.NewMemory(), log, "cli")
+	golf := &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{}}
+	for i := range 200 {
+		golf.Readings[fmt.Sprintf("2025-01-%03d", i)] = i
+	}
+	for i := range 100 {
+		golf.Registration = fmt.Sprint(i)
+		if err := st.SaveVehicle(ctx, "golf", golf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > log.MaxSize {
+		t.Errorf("journal is %d bytes, over its %d limit", info.Size(), log.MaxSize)
+	}
+	entries, err := log.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) == 100 || entries[len(entries)-1].After.Registration != "99" {
+		t.Fatalf("kept %d entries", len(entries))
+	}
+
+	// Read from the end, across chunk boundaries, History sees the same
+	// entries newest first.
+	h, err := st.History(ctx, "golf", 0)
+	if err != nil || len(h) != len(entries) {
+		t.Fatalf("history has %d entries, want %d: %v", len(h), len(entries), err)
+	}
+	for i, e := range h {
+		if e.ID != entries[len(entries)-1-i].ID {
+			t.Fatalf("history[%d] = %s, want %s", i, e.ID, entries[len(entries)-1-i].ID)
+		}
+	}
+	if h, _ := st.History(ctx, "golf", 3); len(h) != 3 || h[0].After.Registration != "99" {
+		t.Errorf("limited history = %d entries", len(h))
+	}
+}
+
+func TestEncryptedFileLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := Wrap(storage.NewMemory(), NewFileLog(dir), "cli")
+	if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := ConvertFileLog(dir, nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	log := NewEncryptedFileLog(dir, key)
+	st = Wrap(storage.NewMemory(), log, "web")
+	if err := st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "journal.jsonl"))
+	if bytes.Contains(raw, []byte("Golf")) || bytes.Contains(raw, []byte("Polo")) {
+		t.Fatalf("journal holds plain text:\n%s", raw)
+	}
+	entries, err := log.Entries(ctx)
+	if err != nil || len(entries) != 2 || entries[1].After.Vehicle != "Polo" {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	if entries, _ := NewFileLog(dir).Entries(ctx); len(entries) != 0 {
+		t.Errorf("a plain log read %d sealed entries", len(entries))
+	}
+
+	if changed, err := ConvertFileLog(dir, nil, key); err != nil || changed {
+		t.Fatalf("rerun: %v, %v", changed, err)
+	}
+	// A plain line among sealed ones, as an interrupted encrypt leaves, is
+	// sealed when the conversion resumes with the key.
+	if err := NewFileLog(dir).Append(ctx, Entry{ID: "plain", Op: OpSaveSettings}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := ConvertFileLog(dir, key, key); err != nil || !changed {
+		t.Fatalf("resume: %v, %v", changed, err)
+	}
+	if entries, _ := log.Entries(ctx); len(entries) != 3 {
+		t.Fatalf("after resume: %d entries", len(entries))
+	}
+	if changed, err := ConvertFileLog(dir, key, nil); err != nil || !changed {
+		t.Fatalf("decrypt: %v, %v", changed, err)
+	}
+	if entries, _ := NewFileLog(dir).Entries(ctx); len(entries) != 3 {
+		t.Errorf("after decrypt: %d entries", len(entries))
+	}
+}
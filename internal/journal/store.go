@@ -0,0 +1,466 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Store is a storage.Store that journals every mutation it passes through to
+// the wrapped Store. Reads pass straight through. Each write takes the
+// journal's lock, reads the affected documents, makes the change, reads them
+// again and appends the entry, so before and after are consistent with each
+// other for writers sharing the lock — a second process writing the same data
+// directory (the CLI beside a running server) is not serialised, as with the
+// YAML store itself.
+//
+// Purging the trash is not journalled: it destroys only copies already
+// recorded as deleted, and there is nothing to invert.
+type Store struct {
+	storage.Store
+	log   Log
+	actor string
+	mu    *sync.Mutex
+	now   func() time.Time
+}
+
+// Wrap returns inner journalled to log, attributing every change to actor
+// (e.g. "cli", "web", "user:<id>").
+func Wrap(inner storage.Store, log Log, actor string) *Store {
+	return &Store{Store: inner, log: log, actor: actor, mu: &sync.Mutex{}, now: time.Now}
+}
+
+type actorKey struct{}
+
+// WithActor returns ctx with the changes made under it attributed to actor
+// instead of the Store's own, so background work on a user's behalf — an
+// automatic odometer capture, say — is told apart from their edits.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// vehicle reads one vehicle for the journal, nil when it does not exist.
+func (s *Store) vehicle(ctx context.Context, id string) (*model.VehicleData, error) {
+	data, err := s.Store.GetVehicle(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// record stamps e and appends it. The change has already been made, so a
+// failure here is reported to the caller as a journal error rather than
+// rolled back.
+func (s *Store) record(ctx context.Context, e *Entry) error {
+	e.ID, e.At, e.Actor = newEntryID(), s.now().UTC(), s.actor
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		e.Actor = actor
+	}
+	if err := s.log.Append(ctx, *e); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return nil
+}
+
+// change journals a mutation of a single vehicle: op runs between the
+// before and after reads of id.
+func (s *Store) change(ctx context.Context, e Entry, op func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.vehicle(ctx, e.VehicleID)
+	if err != nil {
+		return err
+	}
+	if err := op(); err != nil {
+		return err
+	}
+	after, err := s.vehicle(ctx, e.VehicleID)
+	if err != nil {
+		return err
+	}
+	e.Before, e.After = before, after
+	return s.record(ctx, &e)
+}
+
+func (s *Store) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
+	return s.change(ctx, Entry{Op: OpSaveVehicle, VehicleID: id}, func() error {
+		return s.Store.SaveVehicle(ctx, id, data)
+	})
+}
+
+// UpdateVehicle is journalled as a save of the whole vehicle, or as a
+// PutReading when all it did was add or change one reading.
+func (s *Store) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.vehicle(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.UpdateVehicle(ctx, id, fn); err != nil {
+		return err
+	}
+	after, err := s.vehicle(ctx, id)
+	if err != nil {
+		return err
+	}
+	e := Entry{Op: OpSaveVehicle, VehicleID: id, Before: before, After: after}
+	if date, ok := onlyReading(before, after); ok {
+		e.Op, e.Date = OpPutReading, date
+	}
+	return s.record(ctx, &e)
+}
+
+// onlyReading reports the date of the one reading after adds or changes, if
+// that is its only difference from before.
+func onlyReading(before, after *model.VehicleData) (string, bool) {
+	if before == nil || after == nil {
+		return "", false
+	}
+	var date string
+	for d, miles := range after.Readings {
+		if old, ok := before.Readings[d]; !ok || old != miles {
+			if date != "" {
+				return "", false
+			}
+			date = d
+		}
+	}
+	if date == "" {
+		return "", false
+	}
+	cp := *before
+	cp.Readings = maps.Clone(before.Readings)
+	if cp.Readings == nil {
+		cp.Readings = map[string]int{}
+	}
+	cp.Readings[date] = after.Readings[date]
+	return date, sameVehicle(&cp, after)
+}
+
+func (s *Store) DeleteVehicle(ctx context.Context, id string) error {
+	return s.change(ctx, Entry{Op: OpDeleteVehicle, VehicleID: id}, func() error {
+		return s.Store.DeleteVehicle(ctx, id)
+	})
+}
+
+func (s *Store) PutReading(ctx context.Context, id, date string, miles int) error {
+	return s.change(ctx, Entry{Op: OpPutReading, VehicleID: id, Date: date}, func() error {
+		return s.Store.PutReading(ctx, id, date, miles)
+	})
+}
+
+func (s *Store) DeleteReading(ctx context.Context, id, date string) error {
+	return s.change(ctx, Entry{Op: OpDeleteReading, VehicleID: id, Date: date}, func() error {
+		return s.Store.DeleteReading(ctx, id, date)
+	})
+}
+
+func (s *Store) RenameVehicle(ctx context.Context, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.vehicle(ctx, from)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.RenameVehicle(ctx, from, to); err != nil {
+		return err
+	}
+	return s.record(ctx, &Entry{Op: OpRename, VehicleID: to, From: from, After: data, FromBefore: data})
+}
+
+func (s *Store) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, err := s.vehicle(ctx, from)
+	if err != nil {
+		return readings.Report{}, err
+	}
+	before, err := s.vehicle(ctx, into)
+	if err != nil {
+		return readings.Report{}, err
+	}
+	report, err := s.Store.MergeVehicle(ctx, from, into, overwrite, check)
+	if err != nil {
+		return report, err
+	}
+	after, err := s.vehicle(ctx, into)
+	if err != nil {
+		return report, err
+	}
+	return report, s.record(ctx, &Entry{Op: OpMerge, VehicleID: into, From: from, Before: before, After: after, FromBefore: src})
+}
+
+func (s *Store) RestoreTrash(ctx context.Context, itemID string) (*storage.TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.Store.RestoreTrash(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	// The vehicle id is only known once the item is out of the trash, so the
+	// before document is derived: nothing for a vehicle, the vehicle without
+	// the reading for a reading.
+	after, err := s.vehicle(ctx, item.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+	var before *model.VehicleData
+	if item.Kind == storage.TrashReading && after != nil {
+		cp := *after
+		cp.Readings = make(map[string]int, len(after.Readings))
+		for d, m := range after.Readings {
+			if d != item.Date {
+				cp.Readings[d] = m
+			}
+		}
+		before = &cp
+	}
+	e := Entry{Op: OpRestore, VehicleID: item.VehicleID, Date: item.Date, Before: before, After: after}
+	return item, s.record(ctx, &e)
+}
+
+func (s *Store) SetCurrent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, err := s.Store.GetCurrent(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.SetCurrent(ctx, id); err != nil {
+		return err
+	}
+	return s.record(ctx, &Entry{Op: OpSetCurrent, VehicleID: id, From: prev})
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings *model.Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.Store.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.SaveSettings(ctx, settings); err != nil {
+		return err
+	}
+	after, err := s.Store.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	return s.record(ctx, &Entry{Op: OpSaveSettings, SettingsBefore: before, SettingsAfter: after})
+}
+
+// History returns up to limit entries that changed vehicle id, newest first,
+// or entries of every vehicle when id is "". A limit of 0 returns them all.
+// The log is read from its end, so a limited History stops as soon as it has
+// enough.
+func (s *Store) History(ctx context.Context, id string, limit int) ([]Entry, error) {
+	var out []Entry
+	err := s.log.Recent(ctx, func(e Entry) bool {
+		if id == "" || e.Touches(id) {
+			out = append(out, e)
+		}
+		return limit <= 0 || len(out) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Undo replays the inverse of entry entryID and journals that as a new entry,
+// which it returns; undoing the undo redoes the change. The inverse of a
+// rename is the rename back and of a default change the previous default;
+// every other change is undone by putting the vehicle documents it recorded
+// as Before back (deleting a vehicle the change created, which moves it to
+// the trash). A vehicle or reading put back that way is taken out of the
+// trash it was deleted to.
+//
+// Undo refuses with ErrConflict if what the entry changed has changed again
+// since — the live documents must still match the entry's After — so undoing
+// an old entry never silently discards later edits. It returns an error
+// wrapping storage.ErrNotFound for an unknown entry.
+func (s *Store) Undo(ctx context.Context, entryID string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var e *Entry
+	err := s.log.Recent(ctx, func(cand Entry) bool {
+		if cand.ID == entryID {
+			e = &cand
+		}
+		return e == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, fmt.Errorf("journal entry %q: %w", entryID, storage.ErrNotFound)
+	}
+
+	var inv Entry
+	switch e.Op {
+	case OpSetCurrent:
+		inv, err = s.undoSetCurrent(ctx, *e)
+	case OpSaveSettings:
+		inv, err = s.undoSettings(ctx, *e)
+	case OpRename:
+		inv, err = s.undoRename(ctx, *e)
+	default:
+		inv, err = s.revert(ctx, *e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv.Undoes = e.ID
+	if err := s.record(ctx, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// conflict is the ErrConflict for entry e.
+func conflict(e Entry, what string) error {
+	return fmt.Errorf("undo %s: %s %w", e.ID, what, ErrConflict)
+}
+
+func (s *Store) undoSetCurrent(ctx context.Context, e Entry) (Entry, error) {
+	if e.From == "" {
+		return Entry{}, fmt.Errorf("undo %s: there was no previous default vehicle, so the default %w", e.ID, ErrNotUndoable)
+	}
+	current, err := s.Store.GetCurrent(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	if current != e.VehicleID {
+		return Entry{}, conflict(e, "the default vehicle has")
+	}
+	if err := s.Store.SetCurrent(ctx, e.From); err != nil {
+		return Entry{}, err
+	}
+	return Entry{Op: OpSetCurrent, VehicleID: e.From, From: e.VehicleID}, nil
+}
+
+func (s *Store) undoSettings(ctx context.Context, e Entry) (Entry, error) {
+	current, err := s.Store.GetSettings(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	if e.SettingsAfter == nil || e.SettingsBefore == nil || *current != *e.SettingsAfter {
+		return Entry{}, conflict(e, "settings have")
+	}
+	if err := s.Store.SaveSettings(ctx, e.SettingsBefore); err != nil {
+		return Entry{}, err
+	}
+	return Entry{Op: OpSaveSettings, SettingsBefore: current, SettingsAfter: e.SettingsBefore}, nil
+}
+
+func (s *Store) undoRename(ctx context.Context, e Entry) (Entry, error) {
+	if err := s.check(ctx, e, e.VehicleID, e.After); err != nil {
+		return Entry{}, err
+	}
+	if err := s.check(ctx, e, e.From, nil); err != nil {
+		return Entry{}, err
+	}
+	if err := s.Store.RenameVehicle(ctx, e.VehicleID, e.From); err != nil {
+		return Entry{}, err
+	}
+	return Entry{Op: OpRename, VehicleID: e.From, From: e.VehicleID, After: e.After, FromBefore: e.After}, nil
+}
+
+// revert puts back the Before documents of e, after checking that the live
+// documents still match its After ones.
+func (s *Store) revert(ctx context.Context, e Entry) (Entry, error) {
+	if err := s.check(ctx, e, e.VehicleID, e.After); err != nil {
+		return Entry{}, err
+	}
+	if e.From != "" {
+		if err := s.check(ctx, e, e.From, e.FromAfter); err != nil {
+			return Entry{}, err
+		}
+	}
+	if err := s.put(ctx, e.VehicleID, e.Before); err != nil {
+		return Entry{}, err
+	}
+	if e.From != "" {
+		if err := s.put(ctx, e.From, e.FromBefore); err != nil {
+			return Entry{}, err
+		}
+	}
+	if err := s.untrash(ctx, e); err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Op: OpRevert, VehicleID: e.VehicleID, Date: e.Date, From: e.From,
+		Before: e.After, After: e.Before, FromBefore: e.FromAfter, FromAfter: e.FromBefore,
+	}, nil
+}
+
+// untrash purges the trash item left by the deletion e recorded, once revert
+// has put the deleted vehicle or reading back: restoring it from the trash as
+// well would only fail, or overwrite a later edit. The item is the most recent
+// one holding exactly what was put back; none is left if the trash has been
+// purged since.
+func (s *Store) untrash(ctx context.Context, e Entry) error {
+	if e.Before == nil {
+		return nil
+	}
+	var match func(storage.TrashItem) bool
+	switch {
+	case e.After == nil:
+		match = func(it storage.TrashItem) bool {
+			return it.Kind == storage.TrashVehicle && sameVehicle(it.Vehicle, e.Before)
+		}
+	case e.Op == OpDeleteReading:
+		miles, ok := e.Before.Readings[e.Date]
+		if !ok {
+			return nil
+		}
+		match = func(it storage.TrashItem) bool {
+			return it.Kind == storage.TrashReading && it.Date == e.Date && it.Miles == miles
+		}
+	default:
+		return nil
+	}
+	items, err := s.Store.ListTrash(ctx)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if it.VehicleID == e.VehicleID && match(it) {
+			if err := s.Store.PurgeTrash(ctx, it.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// check returns ErrConflict unless vehicle id currently matches want.
+func (s *Store) check(ctx context.Context, e Entry, id string, want *model.VehicleData) error {
+	live, err := s.vehicle(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !sameVehicle(live, want) {
+		return conflict(e, fmt.Sprintf("vehicle %q has", id))
+	}
+	return nil
+}
+
+// put sets vehicle id to data, deleting it when data is nil.
+func (s *Store) put(ctx context.Context, id string, data *model.VehicleData) error {
+	if data == nil {
+		return s.Store.DeleteVehicle(ctx, id)
+	}
+	return s.Store.SaveVehicle(ctx, id, data)
+}
+
+var _ storage.Store = (*Store)(nil)
@@ -0,0 +1,59 @@
+package journal
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Tenants journals every user's Store, each to a FileLog in that user's
+// directory under <root>/users/<userID> (beside the yamlstore.Tenants data)
+// and attributed to "user:<userID>".
+type Tenants struct {
+	// Observer, when set, is called with every change journalled for any
+	// user, as journal.Observe's fn is for one log.
+	Observer func(userID string, e Entry)
+	// Key, when set, encrypts every user's log, as NewEncryptedFileLog.
+	Key *crypt.Key
+
+	inner storage.Tenants
+	root  string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // userID → journal lock shared by that user's Stores
+}
+
+// NewTenants returns inner with journalling, logs rooted at the hosted data
+// root.
+func NewTenants(inner storage.Tenants, root string) *Tenants {
+	return &Tenants{inner: inner, root: root, locks: map[string]*sync.Mutex{}}
+}
+
+// ForUser returns userID's journalled Store. ForUser is called per request,
+// so the Stores it returns share one lock per user. A malformed id gets the
+// inner Store unwrapped — yamlstore fails its every method — so no log path
+// is ever built from it.
+func (t *Tenants) ForUser(userID string) storage.Store {
+	st := t.inner.ForUser(userID)
+	if !storage.ValidUserID(userID) {
+		return st
+	}
+	t.mu.Lock()
+	lock, ok := t.locks[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		t.locks[userID] = lock
+	}
+	t.mu.Unlock()
+	var log Log = NewEncryptedFileLog(filepath.Join(t.root, "users", userID), t.Key)
+	if observer := t.Observer; observer != nil {
+		log = Observe(log, func(e Entry) { observer(userID, e) })
+	}
+	j := Wrap(st, log, "user:"+userID)
+	j.mu = lock
+	return j
+}
+
+var _ storage.Tenants = (*Tenants)(nil)
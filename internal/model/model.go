@@ -20,6 +20,20 @@ type VehicleData struct {
 	Registration string         `yaml:"registration,omitempty" json:"registration,omitempty"`
 	Plan         *Plan          `yaml:"plan,omitempty" json:"plan,omitempty"`
 	Readings     map[string]int `yaml:"readings" json:"readings"` // date string → miles
+	// OdometerChanges records where the readings legitimately drop: the
+	// instrument cluster was replaced or the odometer rolled over. Distance is
+	// measured across each one (see readings.Continuous) rather than read as
+	// a negative.
+	OdometerChanges []OdometerChange `yaml:"odometer_changes,omitempty" json:"odometer_changes,omitempty"`
+}
+
+// OdometerChange is a discontinuity in a vehicle's odometer on Date. OldFinal
+// is the last reading of the old odometer and NewStart the first of the new
+// one; readings dated on or after Date are taken to be on the new odometer.
+type OdometerChange struct {
+	Date     string `yaml:"date" json:"date"` // YYYY-MM-DD, like a readings key
+	OldFinal int    `yaml:"old_final" json:"old_final"`
+	NewStart int    `yaml:"new_start" json:"new_start"`
 }
 
 func (v *VehicleData) HasPlan() bool {
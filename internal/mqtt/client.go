@@ -0,0 +1,316 @@
+// Package mqtt publishes vehicle status to an MQTT broker for home dashboards.
+// Client is a deliberately small MQTT 3.1.1 client — connect, QoS 0 publish
+// with the retain flag, keepalive pings and disconnect — which is all a
+// publisher needs, so the binary takes no MQTT dependency. Publisher keeps
+// each vehicle's calc.Status on retained per-vehicle topics.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Options configures a connection.
+type Options struct {
+	ClientID  string
+	Username  string // "" connects anonymously
+	Password  string
+	KeepAlive time.Duration // 0 uses 60s
+}
+
+// Packet types (the high nibble of the fixed header).
+const (
+	typeConnect    = 1
+	typeConnack    = 2
+	typePublish    = 3
+	typePingreq    = 12
+	typePingresp   = 13
+	typeDisconnect = 14
+)
+
+// connackErrors are the CONNACK return codes a broker refuses a connection
+// with.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorised",
+}
+
+// ErrClosed is returned by Publish on a client that has been closed or has
+// lost its connection. Dial again to reconnect.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Client is one connection to a broker. It is safe for concurrent use.
+type Client struct {
+	conn net.Conn
+	mu   sync.Mutex // serialises writes
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+// Dial connects to broker and completes the MQTT handshake. broker is
+// "host:port", or a URL with scheme mqtt:// or tcp:// (plain, default port
+// 1883) or mqtts:// or ssl:// (TLS, default port 8883).
+func Dial(ctx context.Context, broker string, opts Options) (*Client, error) {
+	addr, useTLS, err := parseBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		d := tls.Dialer{Config: &tls.Config{ServerName: host}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: dial %s: %w", addr, err)
+	}
+
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 60 * time.Second
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+	if _, err := conn.Write(connectPacket(opts, keepAlive)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connect: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connect: %w", err)
+	}
+	if typ != typeConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connect: unexpected packet type %d", typ)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		msg, ok := connackErrors[code]
+		if !ok {
+			msg = fmt.Sprintf("return code %d", code)
+		}
+		return nil, fmt.Errorf("mqtt: broker refused connection: %s", msg)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{conn: conn, done: make(chan struct{})}
+	go c.read(r, keepAlive)
+	go c.ping(keepAlive)
+	return c, nil
+}
+
+// parseBroker resolves broker to a dialable address and whether to use TLS.
+func parseBroker(broker string) (addr string, useTLS bool, err error) {
+	host := broker
+	port := "1883"
+	if u, perr := url.Parse(broker); perr == nil && u.Host != "" {
+		switch u.Scheme {
+		case "mqtt", "tcp":
+		case "mqtts", "ssl", "tls":
+			useTLS, port = true, "8883"
+		default:
+			return "", false, fmt.Errorf("mqtt: broker %q: unknown scheme %q", broker, u.Scheme)
+		}
+		host = u.Host
+	}
+	if host == "" {
+		return "", false, fmt.Errorf("mqtt: broker address is required")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, port)
+	}
+	return host, useTLS, nil
+}
+
+// read drains packets from the broker — only PINGRESP is expected at QoS 0 —
+// and closes the client when the connection drops or goes quiet for more than
+// one and a half keepalive periods, as the spec has the broker do.
+func (c *Client) read(r *bufio.Reader, keepAlive time.Duration) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		if _, _, err := readPacket(r); err != nil {
+			c.close(err)
+			return
+		}
+	}
+}
+
+// ping sends PINGREQ every keepalive period until the client closes.
+func (c *Client) ping(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write([]byte{typePingreq << 4, 0}); err != nil {
+				c.close(err)
+				return
+			}
+		}
+	}
+}
+
+// Publish sends payload to topic at QoS 0. A retained message is kept by the
+// broker and delivered to every later subscriber; an empty retained payload
+// clears the topic.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	if topic == "" {
+		return fmt.Errorf("mqtt: empty topic")
+	}
+	header := byte(typePublish << 4)
+	if retain {
+		header |= 1
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(packet(header, body))
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *Client) Close() error {
+	err := c.write([]byte{typeDisconnect << 4, 0})
+	c.close(ErrClosed)
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Done is closed when the client closes or its connection is lost; Err then
+// reports why.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is the reason the client closed, or nil while it is open.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(b); err != nil {
+		c.close(err)
+		return fmt.Errorf("mqtt: write: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) close(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// connectPacket encodes CONNECT for protocol level 4 (3.1.1) with a clean
+// session.
+func connectPacket(opts Options, keepAlive time.Duration) []byte {
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(min(keepAlive/time.Second, 0xffff)))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return packet(typeConnect<<4, body)
+}
+
+// packet prefixes body with the fixed header: the type/flags byte and the
+// variable-length remaining length.
+func packet(header byte, body []byte) []byte {
+	out := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+// appendString appends s as an MQTT UTF-8 string: a two-byte length, then
+// the bytes.
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readPacket reads one packet, returning its type and body.
+func readPacket(r *bufio.Reader) (typ byte, body []byte, err error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, fmt.Errorf("mqtt: malformed remaining length")
+		}
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
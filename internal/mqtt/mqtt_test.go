@@ -0,0 +1,185 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/journal"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/mqtt/mqtttest"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func TestParseBroker(t *testing.T) {
+	for broker, want := range map[string]struct {
+		addr string
+		tls  bool
+	}{
+		"localhost":             {"localhost:1883", false},
+		"10.0.0.2:1884":         {"10.0.0.2:1884", false},
+		"mqtt://broker.lan":     {"broker.lan:1883", false},
+		"mqtts://broker.lan":    {"broker.lan:8883", true},
+		"ssl://broker.lan:9000": {"broker.lan:9000", true},
+		"tcp://[::1]:1883":      {"[::1]:1883", false},
+	} {
+		addr, useTLS, err := parseBroker(broker)
+		if err != nil || addr != want.addr || useTLS != want.tls {
+			t.Errorf("%s: got %s tls=%v %v", broker, addr, useTLS, err)
+		}
+	}
+	if _, _, err := parseBroker("http://broker.lan"); err == nil {
+		t.Error("http scheme accepted")
+	}
+}
+
+func TestClientPublishesRetained(t *testing.T) {
+	ctx := context.Background()
+	b := mqtttest.NewBroker(t)
+	b.Username, b.Password = "dash", "s3cret"
+
+	if _, err := Dial(ctx, b.Addr(), Options{ClientID: "t", Username: "dash", Password: "wrong"}); err == nil ||
+		!strings.Contains(err.Error(), "bad user name or password") {
+		t.Fatalf("wrong password: %v", err)
+	}
+	c, err := Dial(ctx, b.Addr(), Options{ClientID: "t", Username: "dash", Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("a/b", []byte(strings.Repeat("x", 300)), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("a/c", []byte("once"), false); err != nil {
+		t.Fatal(err)
+	}
+	if !b.WaitFor("a/b", strings.Repeat("x", 300), time.Second) {
+		t.Fatal("retained message not received")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := c.Publish("a/b", nil, true); err != ErrClosed {
+		t.Fatalf("publish after close: %v", err)
+	}
+	if _, ok := b.Retained("a/c"); ok {
+		t.Error("non-retained message retained")
+	}
+}
+
+func newStore(t *testing.T) storage.Store {
+	t.Helper()
+	st := storage.NewMemory()
+	st.SaveVehicle(context.Background(), "golf", &model.VehicleData{
+		Vehicle:      "Golf",
+		Registration: "AB12 CDE",
+		Readings:     map[string]int{"2025-01-01": 5000, "2025-07-02": 10000},
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+		},
+	})
+	st.SetCurrent(context.Background(), "golf")
+	return st
+}
+
+func TestPublisherRunOnce(t *testing.T) {
+	ctx := context.Background()
+	b := mqtttest.NewBroker(t)
+	st := newStore(t)
+	st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo", Readings: map[string]int{"2025-01-01": 100}})
+	now := time.Date(2025, 7, 2, 12, 0, 0, 0, time.UTC)
+	p := &Publisher{Broker: b.Addr(), Prefix: "home/cars/", Store: st, Now: func() time.Time { return now }}
+
+	if n, err := p.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("RunOnce: %d, %v", n, err)
+	}
+	// Vehicles publish in id order, fields in name order: once polo's vehicle
+	// name is in, everything before it is.
+	if !b.WaitFor("home/cars/polo/vehicle", "Polo", time.Second) {
+		t.Fatal("statuses not published")
+	}
+	doc, _ := b.Retained("home/cars/golf/status")
+	var s calc.Status
+	if err := json.Unmarshal([]byte(doc), &s); err != nil || s.LatestReading != 10000 || !s.IsDefault {
+		t.Fatalf("status: %s", doc)
+	}
+	want := calc.ComputeStatusAt("golf", mustGet(t, st, "golf"), now)
+	for topic, payload := range map[string]string{
+		"home/cars/golf/percent_used": jsonText(want.PercentUsed),
+		"home/cars/golf/delta":        jsonText(want.Delta),
+		"home/cars/golf/latest_date":  "2025-07-02",
+		"home/cars/golf/registration": "AB12 CDE",
+		"home/cars/golf/is_default":   "true",
+		"home/cars/polo/has_plan":     "false",
+	} {
+		if got, _ := b.Retained(topic); got != payload {
+			t.Errorf("%s = %q, want %q", topic, got, payload)
+		}
+	}
+
+	// A deleted vehicle's topics, and a field that drops out, are cleared.
+	st.DeleteVehicle(ctx, "polo")
+	data := mustGet(t, st, "golf")
+	data.Registration = ""
+	st.SaveVehicle(ctx, "golf", data)
+	if _, err := p.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"home/cars/polo/status", "home/cars/polo/has_plan", "home/cars/golf/registration"} {
+		if !b.WaitFor(topic, "", time.Second) {
+			t.Errorf("%s not cleared", topic)
+		}
+	}
+
+	// A dropped connection is redialled on the next publish.
+	b.DropClients()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := p.RunOnce(ctx); err != nil {
+		t.Fatalf("after drop: %v", err)
+	}
+	if b.Connects() != 2 {
+		t.Fatalf("connects = %d, want 2", b.Connects())
+	}
+}
+
+func TestPublisherRepublishesOnChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := mqtttest.NewBroker(t)
+	p := &Publisher{Broker: b.Addr(), Interval: time.Hour, Logger: log.New(io.Discard, "", 0)}
+	st := journal.Wrap(newStore(t), journal.Observe(journal.NewMemoryLog(), func(journal.Entry) { p.Changed() }), "web")
+	p.Store = st
+	go p.Run(ctx)
+
+	if !b.WaitFor("mileminder/golf/latest_reading", "10000", 2*time.Second) {
+		t.Fatal("no initial publish")
+	}
+	if err := st.PutReading(ctx, "golf", "2025-07-03", 10050); err != nil {
+		t.Fatal(err)
+	}
+	if !b.WaitFor("mileminder/golf/latest_reading", "10050", 2*time.Second) {
+		t.Fatal("reading change not republished")
+	}
+}
+
+func mustGet(t *testing.T, st storage.Store, id string) *model.VehicleData {
+	t.Helper()
+	data, err := st.GetVehicle(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func jsonText(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
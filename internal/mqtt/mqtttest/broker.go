@@ -0,0 +1,231 @@
+// Package mqtttest provides an in-process MQTT broker stand-in for tests. It
+// speaks just enough of MQTT 3.1.1 to accept a publisher — CONNECT, QoS 0
+// PUBLISH, PINGREQ, DISCONNECT — and records what it is sent, keeping
+// retained messages the way a real broker would.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Message is one PUBLISH the broker received.
+type Message struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+// Broker is a listening stand-in broker. Set Username and Password before a
+// client connects to require them.
+type Broker struct {
+	Username string
+	Password string
+
+	ln       net.Listener
+	mu       sync.Mutex
+	conns    []net.Conn
+	messages []Message
+	retained map[string]string
+	connects int
+	notify   chan struct{}
+}
+
+// NewBroker starts a broker on a loopback port, closed when t ends.
+func NewBroker(t *testing.T) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broker{ln: ln, retained: map[string]string{}, notify: make(chan struct{}, 1)}
+	go b.accept()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Addr is the broker's host:port.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close stops the broker and drops every client.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.DropClients()
+}
+
+// DropClients closes every client connection, as a broker restart would.
+func (b *Broker) DropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+}
+
+// Connects is how many connections the broker has accepted.
+func (b *Broker) Connects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connects
+}
+
+// Messages returns every message received, oldest first.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// Retained returns the retained message on topic, if any.
+func (b *Broker) Retained(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return payload, ok
+}
+
+// WaitFor waits up to timeout for the retained message on topic to equal
+// payload — or, for an empty payload, for the topic to be cleared — and
+// reports whether it did. QoS 0 publishes are not acknowledged, so tests wait
+// on the broker rather than on the publisher.
+func (b *Broker) WaitFor(topic, payload string, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		if got, ok := b.Retained(topic); got == payload && ok == (payload != "") {
+			return true
+		}
+		select {
+		case <-b.notify:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		go b.serve(conn)
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	header, body, err := read(r)
+	if err != nil || header>>4 != 1 {
+		return
+	}
+	code := b.checkConnect(body)
+	if code == 0 {
+		b.mu.Lock()
+		b.connects++
+		b.mu.Unlock()
+	}
+	conn.Write([]byte{0x20, 2, 0, code})
+	if code != 0 {
+		return
+	}
+
+	for {
+		header, body, err := read(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 3: // PUBLISH, QoS 0: topic then payload
+			topic, rest := str(body)
+			b.record(Message{Topic: topic, Payload: string(rest), Retain: header&1 == 1})
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// checkConnect returns the CONNACK code for a CONNECT body.
+func (b *Broker) checkConnect(body []byte) byte {
+	name, rest := str(body)
+	if name != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		return 1
+	}
+	flags := rest[1]
+	_, rest = str(rest[4:]) // client id
+	var user, pass string
+	if flags&0x80 != 0 {
+		user, rest = str(rest)
+	}
+	if flags&0x40 != 0 {
+		pass, _ = str(rest)
+	}
+	if b.Username != "" && (user != b.Username || pass != b.Password) {
+		return 4
+	}
+	return 0
+}
+
+func (b *Broker) record(m Message) {
+	b.mu.Lock()
+	b.messages = append(b.messages, m)
+	if m.Retain {
+		if m.Payload == "" {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m.Payload
+		}
+	}
+	b.mu.Unlock()
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+func read(r *bufio.Reader) (header byte, body []byte, err error) {
+	header, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// str splits a length-prefixed string off the front of b.
+func str(b []byte) (string, []byte) {
+	if len(b) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil
+	}
+	return string(b[2 : 2+n]), b[2+n:]
+}
@@ -0,0 +1,221 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// DefaultPrefix is the topic prefix when Publisher.Prefix is empty.
+const DefaultPrefix = "mileminder"
+
+// Publisher keeps every vehicle's calc.Status on retained topics:
+//
+//	<prefix>/<vehicle id>/status        the whole Status as JSON
+//	<prefix>/<vehicle id>/<field>       each Status field on its own, e.g.
+//	                                    percent_used, delta, drivable_daily_rate
+//
+// so a dashboard can subscribe to the one figure it shows. It publishes on
+// Interval — which also picks up changes made by another process, such as the
+// CLI beside the server — and straight away after Changed. When a vehicle
+// disappears (deleted, or renamed away) its topics are cleared, as is a field
+// that drops out of its status (an omitted registration). A lost broker
+// connection is redialled on the next publish.
+type Publisher struct {
+	Broker   string
+	Options  Options
+	Prefix   string
+	Store    storage.Store
+	Interval time.Duration
+	Now      func() time.Time
+	Logger   *log.Logger
+
+	once    sync.Once
+	changes chan struct{}
+
+	mu     sync.Mutex
+	client *Client
+	topics map[string][]string // vehicle id → topics it was last published on
+}
+
+// Changed asks Run to republish now. It never blocks, and changes arriving
+// while a publish is pending are coalesced into it, so it is safe to call from
+// a write path (see journal.Observe).
+func (p *Publisher) Changed() {
+	p.init()
+	select {
+	case p.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publisher) init() {
+	p.once.Do(func() { p.changes = make(chan struct{}, 1) })
+}
+
+// Run publishes immediately, then on Interval and after every Changed, until
+// ctx is cancelled; it then disconnects.
+func (p *Publisher) Run(ctx context.Context) {
+	p.init()
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	p.publishLogged(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.disconnect()
+			return
+		case <-ticker.C:
+			p.publishLogged(ctx)
+		case <-p.changes:
+			p.publishLogged(ctx)
+		}
+	}
+}
+
+func (p *Publisher) publishLogged(ctx context.Context) {
+	if _, err := p.RunOnce(ctx); err != nil {
+		p.logf("mqtt: %v", err)
+	}
+}
+
+// RunOnce publishes every vehicle's status once, connecting first if need
+// be, and returns how many vehicles it published.
+func (p *Publisher) RunOnce(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	records, err := p.Store.ListVehicles(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list vehicles: %w", err)
+	}
+	current, err := p.Store.GetCurrent(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("current vehicle: %w", err)
+	}
+	client, err := p.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := p.now()
+	published := map[string][]string{}
+	for _, rec := range records {
+		s := calc.ComputeStatusAt(rec.ID, rec.Data, now)
+		s.IsDefault = rec.ID == current
+		msgs, err := statusMessages(p.prefix(), s)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range msgs {
+			if err := client.Publish(m.topic, m.payload, true); err != nil {
+				return 0, err
+			}
+			published[rec.ID] = append(published[rec.ID], m.topic)
+		}
+	}
+	for id, topics := range p.topics {
+		for _, topic := range topics {
+			if slices.Contains(published[id], topic) {
+				continue
+			}
+			if err := client.Publish(topic, nil, true); err != nil {
+				return 0, err
+			}
+		}
+	}
+	p.topics = published
+	return len(records), nil
+}
+
+// connect returns the live client, dialling when there is none or the last
+// one dropped. The caller holds p.mu.
+func (p *Publisher) connect(ctx context.Context) (*Client, error) {
+	if p.client != nil && p.client.Err() == nil {
+		return p.client, nil
+	}
+	opts := p.Options
+	if opts.ClientID == "" {
+		opts.ClientID = p.prefix()
+	}
+	client, err := Dial(ctx, p.Broker, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.client = client
+	return client, nil
+}
+
+func (p *Publisher) disconnect() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+}
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// statusMessages renders s as the status document plus one message per
+// field, in field-name order. Strings are sent bare; numbers and booleans as
+// their JSON text, which is also how a dashboard parses them.
+func statusMessages(prefix string, s calc.Status) ([]message, error) {
+	doc, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("encode status: %w", err)
+	}
+	base := prefix + "/" + s.ID + "/"
+	msgs := []message{{topic: base + "status", payload: doc}}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, fmt.Errorf("encode status: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		payload := []byte(fields[name])
+		var str string
+		if json.Unmarshal(payload, &str) == nil {
+			payload = []byte(str)
+		}
+		msgs = append(msgs, message{topic: base + name, payload: payload})
+	}
+	return msgs, nil
+}
+
+func (p *Publisher) prefix() string {
+	if p.Prefix == "" {
+		return DefaultPrefix
+	}
+	return strings.TrimSuffix(p.Prefix, "/")
+}
+
+func (p *Publisher) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *Publisher) logf(format string, args ...any) {
+	logger := p.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
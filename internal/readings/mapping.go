@@ -0,0 +1,340 @@
+package readings
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date formats a Mapping can read. Day/month order is ambiguous in the wild
+// (03/04/2025), so it is always stated by the mapping, never guessed.
+const (
+	DateISO = "iso" // 2025-04-03
+	DateDMY = "dmy" // 03/04/2025, 3.4.2025, 03-04-2025
+	DateMDY = "mdy" // 04/03/2025
+)
+
+// Distance units a Mapping can read. Kilometres are converted to whole miles,
+// the unit readings are stored in.
+const (
+	UnitMiles      = "mi"
+	UnitKilometres = "km"
+)
+
+// kmPerMile is the international mile.
+const kmPerMile = 1.609344
+
+// Mapping describes how to read an arbitrary CSV export — typically another
+// mileage or fuel-log app's — into readings. Only the date and distance columns
+// are used, since readings carry nothing but a date and an odometer value; any
+// other column (notes, fuel volume, price) is tolerated, and ParseUnused names
+// it so the caller can say it was not imported.
+type Mapping struct {
+	DateColumn     string `json:"date_column"`
+	DistanceColumn string `json:"distance_column"`
+	DateFormat     string `json:"date_format"` // DateISO (default), DateDMY or DateMDY
+	Unit           string `json:"unit"`        // UnitMiles (default) or UnitKilometres
+	// DecimalComma reads distances as "12.345,6": the comma is the decimal
+	// point and dots group thousands. Without it a comma may only group
+	// thousands ("12,345.6"), and "12,5" is refused as ambiguous.
+	DecimalComma bool `json:"decimal_comma"`
+	Comma        rune `json:"-"` // field separator; ',' when zero
+}
+
+// presets are built-in mappings for common app exports, keyed by the name
+// accepted by `import --preset` and the import endpoint's ?preset=. Column
+// names match each app's CSV export header.
+var presets = map[string]Mapping{
+	"acar":   {DateColumn: "Date", DistanceColumn: "Odometer Reading", DateFormat: DateMDY, Unit: UnitMiles},
+	"drivvo": {DateColumn: "Date", DistanceColumn: "Odometer", DateFormat: DateDMY, Unit: UnitKilometres},
+	"fuelio": {DateColumn: "Data", DistanceColumn: "Odo (km)", DateFormat: DateISO, Unit: UnitKilometres},
+	"fuelly": {DateColumn: "fuelup_date", DistanceColumn: "odometer", DateFormat: DateISO, Unit: UnitMiles},
+}
+
+// Preset returns the built-in mapping called name (case-insensitive).
+func Preset(name string) (Mapping, bool) {
+	m, ok := presets[strings.ToLower(strings.TrimSpace(name))]
+	return m, ok
+}
+
+// PresetNames lists the built-in mapping names, sorted, for help text and
+// error messages.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveMapping builds the mapping for one import from a preset name and any
+// explicitly given fields, which override the preset's. It returns nil, meaning
+// "use ParseCSV", when neither is given — the exact export format stays the
+// default on every surface. Both the CLI flags and the API query parameters go
+// through here so the precedence rules cannot drift.
+func ResolveMapping(preset string, override Mapping) (*Mapping, error) {
+	var m Mapping
+	if strings.TrimSpace(preset) != "" {
+		p, ok := Preset(preset)
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q (available: %s)", preset, strings.Join(PresetNames(), ", "))
+		}
+		m = p
+	} else if override == (Mapping{}) {
+		return nil, nil
+	}
+	if override.DateColumn != "" {
+		m.DateColumn = override.DateColumn
+	}
+	if override.DistanceColumn != "" {
+		m.DistanceColumn = override.DistanceColumn
+	}
+	if override.DateFormat != "" {
+		m.DateFormat = override.DateFormat
+	}
+	if override.Unit != "" {
+		m.Unit = override.Unit
+	}
+	if override.DecimalComma {
+		m.DecimalComma = true
+	}
+	if override.Comma != 0 {
+		m.Comma = override.Comma
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate reports whether the mapping is complete and uses known formats.
+func (m Mapping) Validate() error {
+	if strings.TrimSpace(m.DateColumn) == "" || strings.TrimSpace(m.DistanceColumn) == "" {
+		return fmt.Errorf("mapping needs both a date column and a distance column")
+	}
+	switch m.DateFormat {
+	case "", DateISO, DateDMY, DateMDY:
+	default:
+		return fmt.Errorf("unknown date format %q (want %s, %s or %s)", m.DateFormat, DateISO, DateDMY, DateMDY)
+	}
+	switch m.Unit {
+	case "", UnitMiles, UnitKilometres:
+	default:
+		return fmt.Errorf("unknown distance unit %q (want %s or %s)", m.Unit, UnitMiles, UnitKilometres)
+	}
+	return nil
+}
+
+// Parse reads a CSV through the mapping and returns readings plus every
+// row-level problem, with the same keep-going contract as ParseCSV so callers
+// can reject the whole file at once.
+//
+// Differences from ParseCSV follow from reading other apps' files: the header
+// is the first row naming both mapped columns (preamble rows before it, such as
+// Fuelio's "## Vehicle" section, are skipped); a later row starting with "##"
+// ends the data section; and several rows on one day — two fill-ups — collapse
+// to the highest odometer that day rather than being a duplicate-date error.
+func (m Mapping) Parse(r io.Reader) ([]Reading, []RowError) {
+	rows, _, errs := m.ParseUnused(r)
+	return rows, errs
+}
+
+// ParseUnused is Parse also returning the header's other, unmapped columns,
+// in file order: data the import leaves behind, such as notes.
+func (m Mapping) ParseUnused(r io.Reader) ([]Reading, []string, []RowError) {
+	if err := m.Validate(); err != nil {
+		return nil, nil, []RowError{{Line: 0, Msg: err.Error()}}
+	}
+
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+	rd.LazyQuotes = true
+	if m.Comma != 0 {
+		rd.Comma = m.Comma
+	}
+
+	var errs []RowError
+	var unused []string
+	byDate := map[string]int{}
+	dateCol, distCol := -1, -1
+
+	for {
+		record, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				errs = append(errs, RowError{Line: pe.Line, Msg: pe.Err.Error()})
+				continue
+			}
+			errs = append(errs, RowError{Line: 0, Msg: fmt.Sprintf("read error: %v", err)})
+			break
+		}
+		line, _ := rd.FieldPos(0)
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		if dateCol < 0 {
+			dateCol, distCol = columnIndex(record, m.DateColumn), columnIndex(record, m.DistanceColumn)
+			if dateCol < 0 || distCol < 0 {
+				dateCol, distCol = -1, -1 // preamble row; keep looking for the header
+				continue
+			}
+			for i, h := range record {
+				if h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")); i != dateCol && i != distCol && h != "" {
+					unused = append(unused, h)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(record[0]), "##") {
+			break // next section of a multi-section export
+		}
+
+		if dateCol >= len(record) || distCol >= len(record) {
+			errs = append(errs, RowError{Line: line, Msg: fmt.Sprintf("expected at least %d fields, got %d", max(dateCol, distCol)+1, len(record))})
+			continue
+		}
+		rawDate := strings.TrimSpace(record[dateCol])
+		date, err := m.parseDate(rawDate)
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Msg: err.Error()})
+			continue
+		}
+		rawDist := strings.TrimSpace(record[distCol])
+		miles, err := m.parseDistance(rawDist)
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Msg: err.Error()})
+			continue
+		}
+		if prev, seen := byDate[date]; !seen || miles > prev {
+			byDate[date] = miles
+		}
+	}
+
+	if dateCol < 0 {
+		errs = append(errs, RowError{Line: 0, Msg: fmt.Sprintf("no header row with columns %q and %q", m.DateColumn, m.DistanceColumn)})
+	}
+
+	dates := make([]string, 0, len(byDate))
+	for d := range byDate {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+	rows := make([]Reading, 0, len(dates))
+	for _, d := range dates {
+		rows = append(rows, Reading{Date: d, Miles: byDate[d]})
+	}
+	return rows, unused, errs
+}
+
+// columnIndex finds name in a header row, ignoring case and surrounding space
+// (and a UTF-8 BOM on the first cell, which spreadsheet exports often carry).
+func columnIndex(header []string, name string) int {
+	want := strings.TrimSpace(name)
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")), want) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseDate reads raw in the mapping's date format, ignoring any time-of-day
+// suffix ("2025-04-03 08:15", "2025-04-03T08:15:00"), and returns YYYY-MM-DD.
+func (m Mapping) parseDate(raw string) (string, error) {
+	day := raw
+	if i := strings.IndexAny(day, " T"); i > 0 {
+		day = day[:i]
+	}
+
+	var layouts []string
+	switch m.DateFormat {
+	case DateDMY:
+		layouts = separatorVariants("2/1/2006")
+	case DateMDY:
+		layouts = separatorVariants("1/2/2006")
+	default:
+		layouts = []string{"2006-01-02", "2006/01/02", "2006.01.02"}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, day); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q (want %s)", raw, dateFormatHint(m.DateFormat))
+}
+
+// separatorVariants expands a slash layout to the "-" and "." separators that
+// European exports use. Go's single-digit layout elements also accept
+// zero-padded input, so "2/1/2006" reads both 3/4/2025 and 03/04/2025.
+func separatorVariants(layout string) []string {
+	return []string{
+		layout,
+		strings.ReplaceAll(layout, "/", "-"),
+		strings.ReplaceAll(layout, "/", "."),
+	}
+}
+
+func dateFormatHint(format string) string {
+	switch format {
+	case DateDMY:
+		return "DD/MM/YYYY"
+	case DateMDY:
+		return "MM/DD/YYYY"
+	default:
+		return "YYYY-MM-DD"
+	}
+}
+
+// Thousands-grouped numbers, with "," or (for DecimalComma) "." grouping.
+var (
+	groupedPoint = regexp.MustCompile(`^\d{1,3}(,\d{3})+(\.\d*)?$`)
+	groupedComma = regexp.MustCompile(`^\d{1,3}(\.\d{3})+(,\d*)?$`)
+)
+
+// parseDistance reads an odometer value in the mapping's unit and returns whole
+// miles. Spaces and thousands separators are dropped; a fractional value (km
+// exports are often "12345.6") is rounded. Which of "," and "." is the
+// decimal point is the mapping's DecimalComma, never guessed: a comma that
+// does not group thousands is an error without it, so "12,5" is not read as
+// 125.
+func (m Mapping) parseDistance(raw string) (int, error) {
+	cleaned := strings.NewReplacer(" ", "", "\u00a0", "").Replace(raw)
+	switch {
+	case m.DecimalComma:
+		if groupedComma.MatchString(cleaned) {
+			cleaned = strings.ReplaceAll(cleaned, ".", "")
+		} else if strings.Contains(cleaned, ".") {
+			return 0, fmt.Errorf("invalid distance %q (want a decimal comma, as in 12.345,6)", raw)
+		}
+		cleaned = strings.Replace(cleaned, ",", ".", 1)
+	case strings.Contains(cleaned, ","):
+		if !groupedPoint.MatchString(cleaned) {
+			return 0, fmt.Errorf("ambiguous distance %q: a comma only groups thousands unless the decimal comma option is set", raw)
+		}
+		cleaned = strings.ReplaceAll(cleaned, ",", "")
+	}
+	v, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid distance %q (want a number)", raw)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("distance must not be negative, got %s", raw)
+	}
+	if m.Unit == UnitKilometres {
+		v /= kmPerMile
+	}
+	return int(math.Round(v)), nil
+}
@@ -0,0 +1,152 @@
+package readings
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMappingParseFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		input   string
+		want    []Reading
+	}{
+		{
+			name:    "dmy with notes column",
+			mapping: Mapping{DateColumn: "When", DistanceColumn: "Odo", DateFormat: DateDMY},
+			input:   "When,Odo,Notes\n03/04/2025,5000,\"Tesco, full tank\"\n1.5.2025,5400,\n",
+			want:    []Reading{{"2025-04-03", 5000}, {"2025-05-01", 5400}},
+		},
+		{
+			name:    "mdy",
+			mapping: Mapping{DateColumn: "date", DistanceColumn: "miles", DateFormat: DateMDY},
+			input:   "date,miles\n04/03/2025,5000\n",
+			want:    []Reading{{"2025-04-03", 5000}},
+		},
+		{
+			name:    "iso with time and thousands separator",
+			mapping: Mapping{DateColumn: "date", DistanceColumn: "odometer"},
+			input:   "date,odometer\n2025-04-03 08:15,\"5,000\"\n",
+			want:    []Reading{{"2025-04-03", 5000}},
+		},
+		{
+			name:    "km converted and rounded",
+			mapping: Mapping{DateColumn: "date", DistanceColumn: "km", Unit: UnitKilometres},
+			input:   "date,km\n2025-04-03,16093.4\n",
+			want:    []Reading{{"2025-04-03", 10000}},
+		},
+		{
+			name:    "decimal comma with dot thousands",
+			mapping: Mapping{DateColumn: "date", DistanceColumn: "km", Unit: UnitKilometres, DecimalComma: true, Comma: ';'},
+			input:   "date;km\n2025-04-03;16.093,4\n2025-04-04;16100,2\n",
+			want:    []Reading{{"2025-04-03", 10000}, {"2025-04-04", 10004}},
+		},
+		{
+			name:    "semicolon separated",
+			mapping: Mapping{DateColumn: "date", DistanceColumn: "odo", Comma: ';'},
+			input:   "date;odo\n2025-04-03;5000\n",
+			want:    []Reading{{"2025-04-03", 5000}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, errs := tt.mapping.Parse(strings.NewReader(tt.input))
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Fatalf("rows = %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+// Multi-section exports: preamble before the header is skipped, a later "##"
+// section ends the data, and same-day fill-ups keep the highest odometer.
+func TestMappingParseSectionsAndSameDay(t *testing.T) {
+	m, _ := Preset("fuelio")
+	input := "## Vehicle\nName,Make\nGolf,VW\n## Log\nData,Odo (km),Fuel (litres)\n" +
+		"2025-04-03,8046.72,40\n2025-04-03,8050,5\n2025-05-01,8851.39,38\n## CostCategories\nId,Name\n"
+	rows, errs := m.Parse(strings.NewReader(input))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := []Reading{{"2025-04-03", 5002}, {"2025-05-01", 5500}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+}
+
+// Columns the mapping does not read are named, so the import can say they
+// were left behind.
+func TestMappingParseUnused(t *testing.T) {
+	m := Mapping{DateColumn: "When", DistanceColumn: "Odo", DateFormat: DateDMY}
+	input := "## Export\n\ufeffWhen,Odo,Notes,,Fuel\n03/04/2025,5000,\"Tesco, full tank\",,40\n"
+	rows, unused, errs := m.ParseUnused(strings.NewReader(input))
+	if len(errs) != 0 || len(rows) != 1 {
+		t.Fatalf("rows %v, errs %v", rows, errs)
+	}
+	if want := []string{"Notes", "Fuel"}; !reflect.DeepEqual(unused, want) {
+		t.Fatalf("unused = %v, want %v", unused, want)
+	}
+	if _, err := (Mapping{DateColumn: "d", DistanceColumn: "o", DecimalComma: true}).parseDistance("12.5"); err == nil {
+		t.Fatal("a decimal point accepted with the decimal comma option")
+	}
+}
+
+func TestMappingParseErrors(t *testing.T) {
+	m := Mapping{DateColumn: "Date", DistanceColumn: "Odometer", DateFormat: DateDMY}
+	tests := []struct {
+		name     string
+		input    string
+		wantLine int
+		wantMsg  string
+	}{
+		{"no header", "when,how far\n03/04/2025,5000\n", 0, "no header row"},
+		{"wrong date order", "Date,Odometer\n2025-04-03,5000\n", 2, "want DD/MM/YYYY"},
+		{"bad distance", "Date,Odometer\n03/04/2025,lots\n", 2, "invalid distance"},
+		{"negative distance", "Date,Odometer\n03/04/2025,-1\n", 2, "must not be negative"},
+		{"decimal comma without the option", "Date,Odometer\n03/04/2025,\"12,5\"\n", 2, "ambiguous distance"},
+		{"short row", "Notes,Date,Odometer\nfoo\n", 2, "expected at least 3 fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := m.Parse(strings.NewReader(tt.input))
+			found := false
+			for _, e := range errs {
+				if e.Line == tt.wantLine && strings.Contains(e.Msg, tt.wantMsg) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("no error on line %d containing %q; got %v", tt.wantLine, tt.wantMsg, errs)
+			}
+		})
+	}
+}
+
+func TestResolveMapping(t *testing.T) {
+	if m, err := ResolveMapping("", Mapping{}); m != nil || err != nil {
+		t.Fatalf("no preset or columns: want nil (export format), got %+v, %v", m, err)
+	}
+
+	m, err := ResolveMapping("Drivvo", Mapping{Unit: UnitMiles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DistanceColumn != "Odometer" || m.DateFormat != DateDMY || m.Unit != UnitMiles {
+		t.Fatalf("override not applied over preset: %+v", m)
+	}
+
+	if _, err := ResolveMapping("nope", Mapping{}); err == nil || !strings.Contains(err.Error(), "fuelly") {
+		t.Fatalf("unknown preset should list the available ones, got %v", err)
+	}
+	if _, err := ResolveMapping("", Mapping{DateColumn: "Date"}); err == nil {
+		t.Fatal("mapping without a distance column should fail")
+	}
+	if _, err := ResolveMapping("acar", Mapping{DateFormat: "ymd"}); err == nil {
+		t.Fatal("unknown date format should fail")
+	}
+}
@@ -0,0 +1,367 @@
+package readings
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+// Kinds of value an OBD-II log can carry a distance in.
+const (
+	// OBDOdometer is the odometer itself (PID 0xA6), which few cars report.
+	OBDOdometer = "odometer"
+	// OBDDistance is the distance travelled since trouble codes were cleared
+	// (PID 0x31), which almost every car reports. It is not an odometer: it
+	// resets when codes are cleared, so only its increase is used.
+	OBDDistance = "distance_since_clear"
+)
+
+// OBDLog is what ParseOBD found in a logger's CSV, reduced to one entry per
+// logged day in date order. For OBDOdometer each entry is the highest odometer
+// seen that day; for OBDDistance it is the running total covered from the
+// log's first sample to the last one that day, not that day's distance alone.
+// Both are in whole miles.
+type OBDLog struct {
+	Kind string
+	Days []Reading
+}
+
+// obdSample is one logged value, in miles.
+type obdSample struct {
+	at    time.Time
+	date  string
+	miles float64
+}
+
+// unitSuffix matches a trailing unit in a header or PID name: "Odometer (km)".
+var unitSuffix = regexp.MustCompile(`\s*\(([^)]*)\)\s*$`)
+
+// ParseOBD reads the CSV logs OBD-II (ELM327) logger apps write, in either of
+// the two common layouts:
+//
+//   - wide, one column per PID and one row per sample, as Torque Pro and OBD
+//     Fusion write: a time column plus an "Odometer" or "Distance travelled
+//     since codes cleared" column, the unit in brackets in the header;
+//   - long, one row per PID value, as Car Scanner writes: time, PID, value and
+//     optionally units columns.
+//
+// The separator (comma, semicolon or tab) is detected from the header, and a
+// semicolon-separated file may use decimal commas. Units default to km, the
+// unit the PIDs are defined in. Empty cells are normal in a log — not every
+// PID is sampled every row — and are skipped; anything unreadable is a
+// RowError, with the same keep-going contract as ParseCSV. When a log has both
+// PIDs the odometer is used.
+func ParseOBD(r io.Reader) (*OBDLog, []RowError) {
+	br := bufio.NewReader(r)
+	rd := csv.NewReader(br)
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+	rd.LazyQuotes = true
+	first, _ := br.Peek(4096) // the header; a short file returns what there is
+	rd.Comma = sniffComma(string(first))
+
+	header, err := rd.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, []RowError{{Line: 0, Msg: "empty file: expected a header row"}}
+		}
+		return nil, []RowError{{Line: 0, Msg: fmt.Sprintf("read error: %v", err)}}
+	}
+	cols, err := obdColumns(header)
+	if err != nil {
+		return nil, []RowError{{Line: 1, Msg: err.Error()}}
+	}
+	decimalComma := rd.Comma == ';'
+
+	var errs []RowError
+	samples := map[string][]obdSample{}
+	for {
+		record, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				errs = append(errs, RowError{Line: pe.Line, Msg: pe.Err.Error()})
+				continue
+			}
+			errs = append(errs, RowError{Line: 0, Msg: fmt.Sprintf("read error: %v", err)})
+			break
+		}
+		line, _ := rd.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		for _, v := range cols.values(record) {
+			raw := strings.TrimSpace(v.raw)
+			if raw == "" || raw == "-" {
+				continue
+			}
+			if decimalComma {
+				raw = strings.ReplaceAll(raw, ",", ".")
+			}
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+				errs = append(errs, RowError{Line: line, Msg: fmt.Sprintf("invalid %s value %q", v.kind, v.raw)})
+				continue
+			}
+			if cols.time >= len(record) {
+				errs = append(errs, RowError{Line: line, Msg: fmt.Sprintf("expected at least %d fields, got %d", cols.time+1, len(record))})
+				break
+			}
+			at, err := parseOBDTime(record[cols.time])
+			if err != nil {
+				errs = append(errs, RowError{Line: line, Msg: err.Error()})
+				break
+			}
+			switch v.unit {
+			case "", UnitKilometres:
+				f /= kmPerMile
+			case UnitMiles:
+			default:
+				errs = append(errs, RowError{Line: line, Msg: fmt.Sprintf("unknown distance unit %q (want km or mi)", v.unit)})
+				continue
+			}
+			samples[v.kind] = append(samples[v.kind], obdSample{at: at, date: at.Format("2006-01-02"), miles: f})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	switch {
+	case len(samples[OBDOdometer]) > 0:
+		return &OBDLog{Kind: OBDOdometer, Days: dailyOdometer(samples[OBDOdometer])}, nil
+	case len(samples[OBDDistance]) > 0:
+		return &OBDLog{Kind: OBDDistance, Days: dailyDistance(samples[OBDDistance])}, nil
+	}
+	return nil, []RowError{{Line: 0, Msg: "no odometer or distance-since-codes-cleared values found"}}
+}
+
+// Readings turns the log into readings for a vehicle with existing readings.
+// Odometer logs are readings already. A distance log is counted from the
+// latest existing reading before its first day: the first sample is taken to
+// be where that reading left the odometer, so driving between the two that
+// the logger did not see is missed — the monotonic check catches a proposal
+// that then undercuts a later real reading.
+func (l *OBDLog) Readings(existing map[string]int, changes []model.OdometerChange) ([]Reading, error) {
+	if l.Kind == OBDOdometer || len(l.Days) == 0 {
+		return slices.Clone(l.Days), nil
+	}
+	first := l.Days[0].Date
+	known := Continuous(existing, changes)
+	best := ""
+	for d := range known {
+		if d < first && d > best {
+			best = d
+		}
+	}
+	if best == "" {
+		return nil, fmt.Errorf("a distance-since-codes-cleared log needs an existing reading before %s to count from", first)
+	}
+	out := make([]Reading, len(l.Days))
+	for i, d := range l.Days {
+		out[i] = Reading{Date: d.Date, Miles: known[best] + d.Miles + ShiftAt(changes, d.Date)}
+	}
+	return out, nil
+}
+
+// obdValue is one candidate value cell of a record.
+type obdValue struct {
+	kind, unit, raw string
+}
+
+// obdColumn is a wide-layout value column.
+type obdColumn struct {
+	index int
+	obdValue
+}
+
+// obdLayout says where a log keeps its values.
+type obdLayout struct {
+	time int
+	// Wide layout: the value columns, with each header's kind and unit.
+	wide []obdColumn
+	// Long layout: the PID, value and (when present) units columns.
+	pid, value, units int
+}
+
+func (c obdLayout) values(record []string) []obdValue {
+	cell := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+	if c.wide != nil {
+		out := make([]obdValue, len(c.wide))
+		for i, col := range c.wide {
+			out[i] = col.obdValue
+			out[i].raw = cell(col.index)
+		}
+		return out
+	}
+	kind, unit := obdKind(cell(c.pid))
+	if kind == "" {
+		return nil
+	}
+	if u := normalizeUnit(cell(c.units)); u != "" {
+		unit = u
+	}
+	return []obdValue{{kind: kind, unit: unit, raw: cell(c.value)}}
+}
+
+// obdColumns finds the layout from the header row.
+func obdColumns(header []string) (obdLayout, error) {
+	c := obdLayout{time: -1, pid: -1, value: -1, units: -1}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(unitSuffix.ReplaceAllString(strings.TrimPrefix(h, "\ufeff"), "")))
+		switch name {
+		case "timestamp", "device time", "time", "datetime", "date time", "date":
+			if c.time < 0 {
+				c.time = i
+			}
+		case "pid", "pid name", "name":
+			c.pid = i
+		case "value":
+			c.value = i
+		case "units", "unit":
+			c.units = i
+		default:
+			if kind, unit := obdKind(h); kind != "" {
+				c.wide = append(c.wide, obdColumn{i, obdValue{kind: kind, unit: unit}})
+			}
+		}
+	}
+	if c.time < 0 {
+		return c, fmt.Errorf("no time column found (want one of Timestamp, Device Time, Time or Date)")
+	}
+	if c.wide == nil && (c.pid < 0 || c.value < 0) {
+		return c, fmt.Errorf("no odometer or distance-since-codes-cleared column, nor PID and Value columns, found")
+	}
+	if c.pid >= 0 && c.value >= 0 {
+		c.wide = nil // long layout; a wide-looking column is incidental
+	}
+	return c, nil
+}
+
+// obdKind recognises a PID by its usual names, returning the kind and any
+// unit given in brackets.
+func obdKind(name string) (kind, unit string) {
+	if m := unitSuffix.FindStringSubmatch(name); m != nil {
+		unit = normalizeUnit(m[1])
+		name = name[:len(name)-len(m[0])]
+	}
+	n := strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case strings.Contains(n, "odometer"):
+		return OBDOdometer, unit
+	case strings.Contains(n, "since codes cleared"), strings.Contains(n, "since dtc"),
+		strings.Contains(n, "since dtcs cleared"), n == "distance_since_dtc_clear":
+		return OBDDistance, unit
+	}
+	return "", ""
+}
+
+func normalizeUnit(u string) string {
+	switch strings.ToLower(strings.TrimSpace(u)) {
+	case "km", "kilometers", "kilometres":
+		return UnitKilometres
+	case "mi", "mile", "miles":
+		return UnitMiles
+	case "":
+		return ""
+	default:
+		return strings.TrimSpace(u)
+	}
+}
+
+// sniffComma picks the separator that splits the header line most.
+func sniffComma(text string) rune {
+	line, _, _ := strings.Cut(text, "\n")
+	best, n := ',', strings.Count(line, ",")
+	for _, c := range []rune{';', '\t'} {
+		if k := strings.Count(line, string(c)); k > n {
+			best, n = c, k
+		}
+	}
+	return best
+}
+
+// obdTimeLayouts are the timestamp formats logger apps write. A time without
+// a zone is taken as written: its date is the day the logger's clock showed.
+var obdTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"02-Jan-2006 15:04:05.999999999", // Torque Pro's Device Time
+	"2006-01-02",
+}
+
+// parseOBDTime reads a log timestamp; Unix epoch seconds or milliseconds are
+// read in UTC.
+func parseOBDTime(raw string) (time.Time, error) {
+	s := strings.TrimSpace(raw)
+	for _, layout := range obdTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n > 0 {
+		if n > 1e11 {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		return time.Unix(int64(n), 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want e.g. 2025-06-01 08:15:00 or Unix epoch)", raw)
+}
+
+// dailyOdometer keeps the highest odometer per day.
+func dailyOdometer(samples []obdSample) []Reading {
+	byDate := map[string]float64{}
+	for _, s := range samples {
+		if prev, ok := byDate[s.date]; !ok || s.miles > prev {
+			byDate[s.date] = s.miles
+		}
+	}
+	out := make([]Reading, 0, len(byDate))
+	for _, date := range slices.Sorted(maps.Keys(byDate)) {
+		out = append(out, Reading{Date: date, Miles: int(math.Round(byDate[date]))})
+	}
+	return out
+}
+
+// dailyDistance accumulates distance-since-cleared samples in time order. A
+// drop means the codes were cleared, so the counter restarted from zero and
+// its new value is all distance since.
+func dailyDistance(samples []obdSample) []Reading {
+	slices.SortStableFunc(samples, func(a, b obdSample) int { return a.at.Compare(b.at) })
+	byDate := map[string]float64{}
+	total, prev := 0.0, samples[0].miles
+	for _, s := range samples {
+		if s.miles >= prev {
+			total += s.miles - prev
+		} else {
+			total += s.miles
+		}
+		prev = s.miles
+		byDate[s.date] = total
+	}
+	out := make([]Reading, 0, len(byDate))
+	for _, date := range slices.Sorted(maps.Keys(byDate)) {
+		out = append(out, Reading{Date: date, Miles: int(math.Round(byDate[date]))})
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package readings
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func TestParseOBDLayouts(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		kind  string
+		want  []Reading
+	}{
+		{
+			name: "torque wide with odometer in km",
+			input: "GPS Time, Device Time, Speed (OBD)(km/h), Odometer(km)\n" +
+				"Sun Jun 01 08:00:00 GMT 2025,01-Jun-2025 08:00:00.120,40,16093.4\n" +
+				"Sun Jun 01 08:30:00 GMT 2025,01-Jun-2025 08:30:00.120,50,\n" +
+				"Sun Jun 01 09:00:00 GMT 2025,01-Jun-2025 09:00:00.120,0,16125.6\n" +
+				"Mon Jun 02 09:00:00 GMT 2025,02-Jun-2025 09:00:00.120,0,-\n",
+			kind: OBDOdometer,
+			want: []Reading{{"2025-06-01", 10020}},
+		},
+		{
+			name:  "wide with both PIDs prefers the odometer, in miles",
+			input: "Timestamp,Distance travelled since codes cleared (mi),Odometer (mi)\n2025-06-01T08:00:00Z,100,5000\n2025-06-02 18:00:00,120,5020\n",
+			kind:  OBDOdometer,
+			want:  []Reading{{"2025-06-01", 5000}, {"2025-06-02", 5020}},
+		},
+		{
+			name: "car scanner long layout with semicolons and decimal commas",
+			input: "\"time\";\"PID\";\"VALUE\";\"UNITS\"\n" +
+				"\"1748764800\";\"Engine RPM\";\"900\";\"rpm\"\n" +
+				"\"1748764800\";\"Distance traveled since codes cleared\";\"1609,344\";\"km\"\n" +
+				"\"1748851200\";\"Distance traveled since codes cleared\";\"1625,437\";\"km\"\n",
+			kind: OBDDistance,
+			want: []Reading{{"2025-06-01", 0}, {"2025-06-02", 10}},
+		},
+		{
+			name:  "distance counter reset by clearing codes",
+			input: "Date,Distance since DTC cleared (mi)\n2025-06-01 08:00,500\n2025-06-01 18:00,530\n2025-06-02 08:00,4\n2025-06-02 18:00,24\n",
+			kind:  OBDDistance,
+			want:  []Reading{{"2025-06-01", 30}, {"2025-06-02", 54}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			log, errs := ParseOBD(strings.NewReader(tc.input))
+			if len(errs) > 0 {
+				t.Fatalf("errs: %v", errs)
+			}
+			if log.Kind != tc.kind || !reflect.DeepEqual(log.Days, tc.want) {
+				t.Fatalf("got %s %v, want %s %v", log.Kind, log.Days, tc.kind, tc.want)
+			}
+		})
+	}
+}
+
+// A distance log's days are running totals from its first sample, so each
+// day's entry includes the days before it.
+func TestParseOBDDistanceAcrossDays(t *testing.T) {
+	input := "Date,Distance since DTC cleared (mi)\n" +
+		"2025-06-01 08:00,100\n2025-06-01 18:00,130\n" +
+		"2025-06-02 08:00,130\n2025-06-02 18:00,150\n" +
+		"2025-06-04 09:00,190\n2025-06-04 12:00,200\n"
+	log, errs := ParseOBD(strings.NewReader(input))
+	if len(errs) > 0 {
+		t.Fatalf("errs: %v", errs)
+	}
+	want := []Reading{{"2025-06-01", 30}, {"2025-06-02", 50}, {"2025-06-04", 100}}
+	if !reflect.DeepEqual(log.Days, want) {
+		t.Fatalf("got %v, want %v", log.Days, want)
+	}
+	got, err := log.Readings(map[string]int{"2025-05-31": 5000}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Reading{{"2025-06-01", 5030}, {"2025-06-02", 5050}, {"2025-06-04", 5100}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("readings: got %v, want %v", got, want)
+	}
+}
+
+func TestParseOBDErrors(t *testing.T) {
+	_, errs := ParseOBD(strings.NewReader("Timestamp,Odometer (km)\n2025-06-01,abc\nyesterday,100\n2025-06-02,100\n"))
+	if len(errs) != 2 || errs[0].Line != 2 || errs[1].Line != 3 {
+		t.Fatalf("errs: %v", errs)
+	}
+	for _, input := range []string{
+		"",
+		"Speed,Odometer\n",                 // no time column
+		"Timestamp,Speed\n2025-06-01,40\n", // no distance column
+		"Timestamp,Odometer\n",             // no values
+		"time,pid,value\n2025-06-01,Engine RPM,900\n",
+	} {
+		if _, errs := ParseOBD(strings.NewReader(input)); len(errs) != 1 {
+			t.Errorf("%q: want one error, got %v", input, errs)
+		}
+	}
+}
+
+func TestOBDLogReadings(t *testing.T) {
+	log := &OBDLog{Kind: OBDDistance, Days: []Reading{{"2025-06-02", 14}, {"2025-06-03", 28}}}
+	existing := map[string]int{"2025-05-01": 4000, "2025-06-01": 5000, "2025-07-01": 6000}
+
+	got, err := log.Readings(existing, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Reading{{"2025-06-02", 5014}, {"2025-06-03", 5028}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Across a rollover on 2025-06-03 the proposal moves onto the new odometer.
+	changes := []model.OdometerChange{{Date: "2025-06-03", OldFinal: 5020, NewStart: 0}}
+	got, _ = log.Readings(existing, changes)
+	if got[1].Miles != 8 {
+		t.Fatalf("across a change: %v", got)
+	}
+
+	if _, err := log.Readings(map[string]int{"2025-07-01": 6000}, nil); err == nil {
+		t.Fatal("want an error without an earlier reading")
+	}
+	odo := &OBDLog{Kind: OBDOdometer, Days: []Reading{{"2025-06-02", 5100}}}
+	if got, _ := odo.Readings(nil, nil); !reflect.DeepEqual(got, odo.Days) {
+		t.Fatalf("odometer log: %v", got)
+	}
+}
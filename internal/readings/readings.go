@@ -13,10 +13,14 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
 )
 
 // Reading is one parsed CSV row.
@@ -152,34 +156,160 @@ func Merge(existing map[string]int, rows []Reading, overwrite bool) (map[string]
 }
 
 // CheckMonotonic verifies the odometer never decreases in date order — the
-// bulk equivalent of the single-add below-max rule. It reports the first
-// offending pair; note it runs over whatever map it is given, so a
-// pre-existing (previously forced) decrease also trips it.
-func CheckMonotonic(readings map[string]int) error {
-	dates := make([]string, 0, len(readings))
-	for d := range readings {
-		dates = append(dates, d)
+// bulk equivalent of the single-add below-max rule. A drop across a recorded
+// odometer change is expected: each change's OldFinal must not be below the
+// readings before it, and NewStart not above the readings on or after it. It
+// reports the first offending pair; note it runs over whatever map it is
+// given, so a pre-existing (previously forced) decrease also trips it.
+func CheckMonotonic(readings map[string]int, changes []model.OdometerChange) error {
+	type point struct {
+		date  string
+		order int // within a date: old odometer, new odometer, readings
+		miles int // as recorded, for the message
+		cont  int // on the current odometer
+	}
+	points := make([]point, 0, len(readings)+2*len(changes))
+	for d, m := range readings {
+		points = append(points, point{d, 2, m, m - ShiftAt(changes, d)})
 	}
-	sort.Strings(dates) // YYYY-MM-DD sorts chronologically
+	for _, c := range changes {
+		// Both ends of a change sit at the same continuous distance: the old
+		// odometer's final reading is where the new one starts.
+		cont := c.NewStart - ShiftAt(changes, c.Date)
+		points = append(points, point{c.Date, 0, c.OldFinal, cont}, point{c.Date, 1, c.NewStart, cont})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].date != points[j].date {
+			return points[i].date < points[j].date // YYYY-MM-DD sorts chronologically
+		}
+		return points[i].order < points[j].order
+	})
 
-	for i := 1; i < len(dates); i++ {
-		prev, cur := dates[i-1], dates[i]
-		if readings[cur] < readings[prev] {
-			return fmt.Errorf("odometer decreases from %d on %s to %d on %s", readings[prev], prev, readings[cur], cur)
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		if cur.cont < prev.cont {
+			return fmt.Errorf("odometer decreases from %d on %s to %d on %s", prev.miles, prev.date, cur.miles, cur.date)
 		}
 	}
 	return nil
 }
 
-// BelowMax reports the highest existing reading and whether miles is below it
-// — the single-add validation rule shared by cmd/add.go and the API's
-// HandleAddReading (#29). The force gate and the user-facing message stay
-// with each caller deliberately: the surfaces word the override differently.
-func BelowMax(readings map[string]int, miles int) (max int, below bool) {
-	for _, m := range readings {
-		if m > max {
-			max = m
+// BelowMax reports the highest existing reading and whether miles, read on
+// date, is below it — the single-add validation rule shared by cmd/add.go and
+// the API's HandleAddReading (#29). Readings are compared across odometer
+// changes, and max is given on date's odometer. The force gate and the
+// user-facing message stay with each caller deliberately: the surfaces word
+// the override differently.
+func BelowMax(readings map[string]int, changes []model.OdometerChange, date string, miles int) (max int, below bool) {
+	if len(readings) == 0 {
+		return 0, false
+	}
+	first := true
+	for d, m := range readings {
+		if c := m - ShiftAt(changes, d); first || c > max {
+			max, first = c, false
 		}
 	}
+	max += ShiftAt(changes, date)
 	return max, miles < max
 }
+
+// MaxMilesPerDay bounds how far a vehicle can plausibly be driven in a day —
+// 24 hours at over 80 mph. Automated sources are checked against it, since a
+// mis-scaled sensor or a km/mi mix-up otherwise lands as a real reading.
+const MaxMilesPerDay = 2000
+
+// CheckPlausible reports whether miles, read on date, is believable next to
+// the existing readings: not in the future (after today), and not further from
+// the nearest reading either side than MaxMilesPerDay allows for the days in
+// between. It does not check order; that is CheckMonotonic's job.
+func CheckPlausible(readings map[string]int, changes []model.OdometerChange, date string, miles int, today string) error {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("date %q: expected YYYY-MM-DD", date)
+	}
+	if date > today {
+		return fmt.Errorf("date %s is in the future", date)
+	}
+	cont := miles - ShiftAt(changes, date)
+	prev, next := "", ""
+	for d := range readings {
+		if d < date && d > prev {
+			prev = d
+		}
+		if d > date && (next == "" || d < next) {
+			next = d
+		}
+	}
+	for _, other := range []string{prev, next} {
+		if other == "" {
+			continue
+		}
+		t, _ := time.Parse("2006-01-02", other)
+		days := int(math.Abs(day.Sub(t).Hours()/24)) + 1
+		gap := cont - (readings[other] - ShiftAt(changes, other))
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap > days*MaxMilesPerDay {
+			return fmt.Errorf("%d mi is %d mi from the %d mi reading on %s; more than %d mi a day is implausible",
+				miles, gap, readings[other], other, MaxMilesPerDay)
+		}
+	}
+	return nil
+}
+
+// ShiftAt is how far a reading taken on date sits above the current (latest)
+// odometer's scale: the distance "lost" at every odometer change after date.
+// Subtracting it puts readings from either side of a change on one scale.
+func ShiftAt(changes []model.OdometerChange, date string) int {
+	shift := 0
+	for _, c := range changes {
+		if c.Date > date {
+			shift += c.OldFinal - c.NewStart
+		}
+	}
+	return shift
+}
+
+// Continuous returns readings expressed on the current odometer, so that
+// differences between any two dates are the distance driven even across a
+// replacement or rollover. Without changes it is a copy of readings.
+func Continuous(readings map[string]int, changes []model.OdometerChange) map[string]int {
+	out := make(map[string]int, len(readings))
+	for d, m := range readings {
+		out[d] = m - ShiftAt(changes, d)
+	}
+	return out
+}
+
+// ValidateChanges checks odometer change events: a real date, non-negative
+// readings and at most one change per date.
+func ValidateChanges(changes []model.OdometerChange) error {
+	seen := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		if _, err := time.Parse("2006-01-02", c.Date); err != nil {
+			return fmt.Errorf("odometer change date %q: expected YYYY-MM-DD", c.Date)
+		}
+		if c.OldFinal < 0 || c.NewStart < 0 {
+			return fmt.Errorf("odometer change on %s: readings cannot be negative", c.Date)
+		}
+		if seen[c.Date] {
+			return fmt.Errorf("more than one odometer change on %s", c.Date)
+		}
+		seen[c.Date] = true
+	}
+	return nil
+}
+
+// AddChange returns a copy of changes with c added in date order, validated
+// as a whole. It is the one rule the CLI and the API use to record a change;
+// whether the result fits the readings is CheckMonotonic's job.
+func AddChange(changes []model.OdometerChange, c model.OdometerChange) ([]model.OdometerChange, error) {
+	out := append(slices.Clone(changes), c)
+	if err := ValidateChanges(out); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(out, func(a, b model.OdometerChange) int { return strings.Compare(a.Date, b.Date) })
+	return out, nil
+}
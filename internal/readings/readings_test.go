@@ -6,6 +6,8 @@ import (
 	"sort"
 	"strings"
 	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/model"
 )
 
 func TestParseCSVValid(t *testing.T) {
@@ -118,10 +120,10 @@ func TestMerge(t *testing.T) {
 }
 
 func TestCheckMonotonic(t *testing.T) {
-	if err := CheckMonotonic(map[string]int{"2025-01-01": 5000, "2025-02-01": 5500, "2025-03-01": 5500}); err != nil {
+	if err := CheckMonotonic(map[string]int{"2025-01-01": 5000, "2025-02-01": 5500, "2025-03-01": 5500}, nil); err != nil {
 		t.Fatalf("non-decreasing readings flagged: %v", err)
 	}
-	err := CheckMonotonic(map[string]int{"2025-01-01": 5000, "2025-02-01": 4000})
+	err := CheckMonotonic(map[string]int{"2025-01-01": 5000, "2025-02-01": 4000}, nil)
 	if err == nil {
 		t.Fatal("decrease not flagged")
 	}
@@ -137,24 +139,94 @@ func TestCheckMonotonic(t *testing.T) {
 func TestCheckMonotonicTripsOnPreexistingViolation(t *testing.T) {
 	existing := map[string]int{"2025-01-01": 5000, "2025-02-01": 4000} // forced dip
 	merged, _ := Merge(existing, []Reading{{"2025-03-01", 6000}}, false)
-	if err := CheckMonotonic(merged); err == nil {
+	if err := CheckMonotonic(merged, nil); err == nil {
 		t.Fatal("pre-existing decrease should still fail the merged check")
 	}
 }
 
 func TestBelowMax(t *testing.T) {
 	readings := map[string]int{"2025-01-01": 5000, "2025-02-01": 5500}
-	if max, below := BelowMax(readings, 5400); max != 5500 || !below {
+	if max, below := BelowMax(readings, nil, "2025-03-01", 5400); max != 5500 || !below {
 		t.Fatalf("got max=%d below=%v, want 5500/true", max, below)
 	}
-	if _, below := BelowMax(readings, 5500); below {
+	if _, below := BelowMax(readings, nil, "2025-03-01", 5500); below {
 		t.Fatal("equal to max should not be below")
 	}
-	if max, below := BelowMax(nil, 0); max != 0 || below {
+	if max, below := BelowMax(nil, nil, "2025-03-01", 0); max != 0 || below {
 		t.Fatalf("empty readings: got max=%d below=%v", max, below)
 	}
 }
 
+func TestCheckPlausible(t *testing.T) {
+	readings := map[string]int{"2025-01-01": 5000, "2025-01-11": 5400}
+	for _, tc := range []struct {
+		date  string
+		miles int
+		ok    bool
+	}{
+		{"2025-01-12", 5600, true},
+		{"2025-01-12", 10000, false}, // 4600 mi overnight
+		{"2025-01-05", 5200, true},
+		{"2025-01-02", 50000, false},
+		{"2025-01-11", 5450, true},  // replacing the day's own reading
+		{"2025-02-02", 5500, false}, // after today
+	} {
+		err := CheckPlausible(readings, nil, tc.date, tc.miles, "2025-02-01")
+		if (err == nil) != tc.ok {
+			t.Errorf("%s %d: got %v, want ok=%v", tc.date, tc.miles, err, tc.ok)
+		}
+	}
+}
+
+// A replaced odometer restarts low: readings across a recorded change are
+// continuous, and the change itself must fit the readings either side of it.
+func TestOdometerChange(t *testing.T) {
+	rs := map[string]int{"2025-01-01": 90000, "2025-02-01": 91000, "2025-03-01": 500, "2025-04-01": 1500}
+	changes := []model.OdometerChange{{Date: "2025-02-15", OldFinal: 91200, NewStart: 0}}
+
+	if err := CheckMonotonic(rs, nil); err == nil {
+		t.Fatal("drop without a recorded change should fail")
+	}
+	if err := CheckMonotonic(rs, changes); err != nil {
+		t.Fatalf("drop across a change flagged: %v", err)
+	}
+	cont := Continuous(rs, changes)
+	if got := cont["2025-04-01"] - cont["2025-01-01"]; got != 1200+1500 {
+		t.Fatalf("distance across change = %d, want 2700", got)
+	}
+	if err := CheckMonotonic(rs, []model.OdometerChange{{Date: "2025-02-15", OldFinal: 90500, NewStart: 0}}); err == nil {
+		t.Fatal("old final below an earlier reading should fail")
+	}
+	if err := CheckMonotonic(rs, []model.OdometerChange{{Date: "2025-02-15", OldFinal: 91200, NewStart: 800}}); err == nil {
+		t.Fatal("new start above a later reading should fail")
+	}
+
+	if max, below := BelowMax(rs, changes, "2025-05-01", 1400); max != 1500 || !below {
+		t.Fatalf("got max=%d below=%v, want 1500/true", max, below)
+	}
+	if _, below := BelowMax(rs, changes, "2025-05-01", 1600); below {
+		t.Fatal("reading above the new odometer's max flagged")
+	}
+	if max, _ := BelowMax(rs, changes, "2025-02-10", 0); max != 91200+1500 {
+		t.Fatalf("max on the old odometer = %d, want 92700", max)
+	}
+}
+
+func TestValidateChanges(t *testing.T) {
+	for _, bad := range [][]model.OdometerChange{
+		{{Date: "2025-13-01"}},
+		{{Date: "2025-01-01", OldFinal: -1}},
+		{{Date: "2025-01-01"}, {Date: "2025-01-01", OldFinal: 5}},
+	} {
+		if err := ValidateChanges(bad); err == nil {
+			t.Fatalf("ValidateChanges(%v) passed", bad)
+		}
+	}
+	if err := ValidateChanges([]model.OdometerChange{{Date: "2025-01-01", OldFinal: 99999, NewStart: 0}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // Round-trip: a readings map written in the exact export format (header,
 // sorted dates, %s,%d rows — see HandleExportCSV) parses and merges into an
 // empty vehicle as an identical map.
@@ -188,7 +260,7 @@ func TestRoundTripWithExportFormat(t *testing.T) {
 	if rep.Added != len(original) || rep.Skipped != 0 || rep.Overwritten != 0 {
 		t.Fatalf("round-trip report = %+v", rep)
 	}
-	if err := CheckMonotonic(merged); err != nil {
+	if err := CheckMonotonic(merged, nil); err != nil {
 		t.Fatalf("round-trip data failed monotonic check: %v", err)
 	}
 
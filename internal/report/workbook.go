@@ -0,0 +1,127 @@
+// Package report assembles the spreadsheet export: readings, a monthly
+// summary and the computed status for one vehicle or a whole fleet. All
+// figures come from internal/calc, so the workbook agrees with the dashboard.
+package report
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/xlsx"
+)
+
+// Vehicle is one vehicle to include in a workbook.
+type Vehicle struct {
+	ID   string
+	Data *model.VehicleData
+}
+
+// Workbook builds the export workbook for vehicles as of now. Each sheet lists
+// every vehicle, keyed by id in the first column, so a single-vehicle export
+// and a fleet export have the same layout and filter the same way.
+func Workbook(vehicles []Vehicle, now time.Time) *xlsx.Workbook {
+	sorted := append([]Vehicle(nil), vehicles...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	wb := xlsx.New()
+	readingsSheet(wb.AddSheet("Readings"), sorted)
+	monthlySheet(wb.AddSheet("Monthly"), sorted)
+	statusSheet(wb.AddSheet("Status"), sorted, now)
+	return wb
+}
+
+func readingsSheet(s *xlsx.Sheet, vehicles []Vehicle) {
+	s.Header("Vehicle ID", "Vehicle", "Date", "Odometer (mi)", "Miles since previous")
+	for _, v := range vehicles {
+		var prev float64
+		for i, r := range calc.SortedReadings(v.Data) {
+			var since any
+			if i > 0 {
+				since = r.Miles - prev
+			}
+			s.Row(v.ID, v.Data.Vehicle, r.Date, r.Miles, since)
+			prev = r.Miles
+		}
+	}
+}
+
+// monthlySheet summarises each calendar month from the first reading to the
+// last. Opening and closing odometers are calc.OdometerAt at the month
+// boundaries — interpolated between readings, as the graph does — so miles are
+// attributed to the month they were driven in even when readings are sparse.
+// The allowance column is the plan's straight-line allowance over the part of
+// the month inside the plan.
+func monthlySheet(s *xlsx.Sheet, vehicles []Vehicle) {
+	s.Header("Vehicle ID", "Vehicle", "Month", "Opening odometer", "Closing odometer", "Miles driven", "Allowance", "Over (+) / under (-)")
+	for _, v := range vehicles {
+		rs := calc.SortedReadings(v.Data)
+		if len(rs) == 0 {
+			continue
+		}
+		first, last := rs[0].Date, rs[len(rs)-1].Date
+		for month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(last); month = month.AddDate(0, 1, 0) {
+			next := month.AddDate(0, 1, 0)
+			opening, _ := calc.OdometerAt(rs, month)
+			closing, _ := calc.OdometerAt(rs, next)
+			driven := round1(closing - opening)
+
+			var allowance, over any
+			if p := v.Data.Plan; p != nil {
+				from, to := later(month, p.Start), earlier(next, p.End)
+				if to.After(from) {
+					a := round1(calc.AllowanceMiles(p.AnnualAllowance, p.Start, to) - calc.AllowanceMiles(p.AnnualAllowance, p.Start, from))
+					allowance, over = a, round1(driven-a)
+				}
+			}
+			s.Row(v.ID, v.Data.Vehicle, month.Format("2006-01"), round1(opening), round1(closing), driven, allowance, over)
+		}
+	}
+}
+
+func statusSheet(s *xlsx.Sheet, vehicles []Vehicle, now time.Time) {
+	s.Header("Vehicle ID", "Vehicle", "Registration", "Latest date", "Latest odometer",
+		"Plan start", "Plan end", "Annual allowance", "Target today", "Over (+) / under (-)",
+		"Allowance used %", "Daily rate", "Projected final odometer", "Projected excess miles",
+		"Projected overage cost (minor units)", "Pace trend")
+	for _, v := range vehicles {
+		st := calc.ComputeStatusAt(v.ID, v.Data, now)
+		var latest any
+		if t, err := time.Parse("2006-01-02", st.LatestDate); err == nil {
+			latest = t
+		}
+		if !st.HasPlan {
+			s.Row(st.ID, st.Vehicle, st.Registration, latest, st.LatestReading,
+				nil, nil, nil, nil, nil, nil, round1(st.DailyRate), nil, nil, nil, st.PaceTrend)
+			continue
+		}
+		var cost any
+		if st.ExcessRate > 0 {
+			cost = math.Round(st.ProjectedOverageCostMinor)
+		}
+		s.Row(st.ID, st.Vehicle, st.Registration, latest, st.LatestReading,
+			st.PlanStart, st.PlanEnd, st.AnnualAllowance, round1(st.TargetToday), round1(st.Delta),
+			round1(st.PercentUsed), round1(st.DailyRate), round1(st.EstimatedFinalMileage), round1(st.ProjectedExcessMiles),
+			cost, st.PaceTrend)
+	}
+}
+
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,63 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+func sheetXML(t *testing.T, wbBytes []byte, n string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(wbBytes), int64(len(wbBytes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/worksheets/sheet" + n + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	raw, _ := io.ReadAll(f)
+	return string(raw)
+}
+
+func TestWorkbookMonthlySummary(t *testing.T) {
+	data := &model.VehicleData{
+		Vehicle: "Golf",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 3650,
+			StartMiles:      5000,
+		},
+		Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5310, "2025-03-01": 5590},
+	}
+	var buf bytes.Buffer
+	now := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	if err := Workbook([]Vehicle{{ID: "golf", Data: data}}, now).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	monthly := sheetXML(t, buf.Bytes(), "2")
+	// January: 5000 → 5310 against 31 days × 10 mi/day of allowance.
+	for _, want := range []string{">2025-01<", "<v>310</v>", "<v>0</v>"} {
+		if !strings.Contains(monthly, want) {
+			t.Fatalf("monthly sheet missing %s:\n%s", want, monthly)
+		}
+	}
+	// February: 280 driven against 280 allowed; March is clamped at the last
+	// reading, so only its first day counts.
+	if !strings.Contains(monthly, "<v>280</v>") || !strings.Contains(monthly, ">2025-03<") {
+		t.Fatalf("monthly sheet missing February/March rows:\n%s", monthly)
+	}
+
+	status := sheetXML(t, buf.Bytes(), "3")
+	if !strings.Contains(status, ">golf<") || !strings.Contains(status, "<v>5590</v>") {
+		t.Fatalf("status sheet missing vehicle:\n%s", status)
+	}
+}
@@ -0,0 +1,29 @@
+package schema
+
+import "gopkg.in/yaml.v3"
+
+// The migration list. Add a step by registering the next From for a kind and
+// describing the change in Summary; Current moves on by itself, and stores
+// start writing the new version.
+//
+// Version 1 of every kind is the layout as it stood when versioning was
+// introduced, so the first step only adds the version field.
+func init() {
+	for _, kind := range []Kind{Vehicle, Settings, Users, Sessions, PasswordResets} {
+		Register(Migration{
+			Kind:    kind,
+			From:    0,
+			Summary: "add schema_version",
+			Apply:   func(*yaml.Node) error { return nil },
+		})
+	}
+
+	// Nothing to convert, but a build that predates odometer changes would
+	// drop them on its next write; the bump makes it refuse instead.
+	Register(Migration{
+		Kind:    Vehicle,
+		From:    1,
+		Summary: "add optional odometer_changes",
+		Apply:   func(*yaml.Node) error { return nil },
+	})
+}
@@ -0,0 +1,261 @@
+// Package schema versions the YAML documents MileMinder keeps on disk and
+// upgrades old ones. Each document kind carries a top-level schema_version;
+// a registry of migrations, one per version step, brings an older document up
+// to the version this build writes.
+//
+// Upgrading happens on read and in memory only: a store calls Upgrade on the
+// raw bytes before decoding, so an old file keeps working without being
+// touched. The file is rewritten — at the current version — the next time the
+// store writes it anyway, and BackupBeforeWrite keeps a copy of the old
+// version first, so a downgrade can always get its data back. A document with
+// no schema_version predates versioning and is version 0.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+)
+
+// Kind names a family of documents sharing one schema.
+type Kind string
+
+// Versioned document kinds.
+const (
+	Vehicle        Kind = "vehicle"         // <id>.yml in a vehicle directory
+	Settings       Kind = "settings"        // settings, beside the vehicles
+	Users          Kind = "users"           // hosted users.yml
+	Sessions       Kind = "sessions"        // hosted sessions.yml
+	PasswordResets Kind = "password_resets" // hosted resets.yml
+)
+
+// Field is the document key holding the version.
+const Field = "schema_version"
+
+// BackupDir is the directory, beside a migrated file, that BackupBeforeWrite
+// copies the old version into. Stores skip subdirectories, so backups never
+// show up as documents.
+const BackupDir = "schema-backup"
+
+// ErrTooNew is returned for a document written by a newer build, which this
+// one cannot read safely.
+var ErrTooNew = errors.New("schema version newer than this build supports")
+
+// Migration upgrades one kind of document from version From to From+1. Apply
+// edits the document's top-level mapping node in place (see Lookup, Set and
+// Remove). Migrations work on the YAML node tree rather than decoded values so
+// that everything they do not touch — key order, comments, scalars exactly as
+// written (an unquoted date key stays a date-shaped string) — survives.
+type Migration struct {
+	Kind    Kind
+	From    int
+	Summary string
+	Apply   func(doc *yaml.Node) error
+}
+
+var registry = map[Kind][]Migration{}
+
+// Register adds a migration. Migrations for a kind must be registered in
+// version order, starting at 0; anything else is a programming error and
+// panics at init.
+func Register(m Migration) {
+	if m.From != len(registry[m.Kind]) {
+		panic(fmt.Sprintf("schema: %s migration from v%d registered out of order (next is v%d)", m.Kind, m.From, len(registry[m.Kind])))
+	}
+	registry[m.Kind] = append(registry[m.Kind], m)
+}
+
+// Current is the version this build writes for kind.
+func Current(kind Kind) int {
+	return len(registry[kind])
+}
+
+// Pending returns the migrations that would upgrade a kind document from
+// version from, in order.
+func Pending(kind Kind, from int) []Migration {
+	if from >= Current(kind) {
+		return nil
+	}
+	return registry[kind][from:]
+}
+
+// Version reads a document's schema version without decoding the rest.
+func Version(raw []byte) (int, error) {
+	var head struct {
+		Version int `yaml:"schema_version"`
+	}
+	if err := yaml.Unmarshal(raw, &head); err != nil {
+		return 0, err
+	}
+	return head.Version, nil
+}
+
+// Upgrade brings raw up to the current version of kind, returning the
+// upgraded document and the version it started at. A current document is
+// returned unchanged. The result is for decoding, not for writing back: stores
+// persist the typed value they decode, at the current version.
+func Upgrade(kind Kind, raw []byte) ([]byte, int, error) {
+	from, err := Version(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	current := Current(kind)
+	if from > current {
+		return nil, from, fmt.Errorf("%s document is v%d, this build reads up to v%d: %w", kind, from, current, ErrTooNew)
+	}
+	if from == current {
+		return raw, from, nil
+	}
+
+	var file yaml.Node
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, from, err
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if file.Kind == yaml.DocumentNode && len(file.Content) == 1 {
+		doc = file.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return nil, from, fmt.Errorf("%s document is not a mapping", kind)
+	}
+	for _, m := range Pending(kind, from) {
+		if err := m.Apply(doc); err != nil {
+			return nil, from, fmt.Errorf("migrate %s v%d to v%d: %w", kind, m.From, m.From+1, err)
+		}
+	}
+	Remove(doc, Field)
+	doc.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: Field},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(current)},
+	}, doc.Content...)
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, from, err
+	}
+	return out, from, nil
+}
+
+// Lookup returns the value node for key in mapping node doc, or nil.
+func Lookup(doc *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == key {
+			return doc.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Set replaces the value of key in mapping node doc, appending the key if it
+// is absent.
+func Set(doc *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == key {
+			doc.Content[i+1] = value
+			return
+		}
+	}
+	doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// Remove deletes key from mapping node doc, if present.
+func Remove(doc *yaml.Node, key string) {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == key {
+			doc.Content = append(doc.Content[:i], doc.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// BackupBeforeWrite is called by a store before it overwrites path with a
+// current-version kind document. If the file on disk is an older version, it
+// is copied to <dir>/schema-backup/<name>.v<N> first; an existing backup of
+// that version is kept, not replaced, so the copy is always the original.
+// A missing or current file needs no backup, and a newer one is refused with
+// ErrTooNew.
+func BackupBeforeWrite(kind Kind, path string) error {
+	return BackupBeforeWriteOpen(kind, path, nil)
+}
+
+// BackupBeforeWriteOpen is BackupBeforeWrite for a file that must be decoded
+// before its version can be read, such as an encrypted one: open, when
+// non-nil, decodes the raw bytes. The backup is a copy of the file as stored.
+func BackupBeforeWriteOpen(kind Kind, path string, open func([]byte) ([]byte, error)) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s for backup: %w", path, err)
+	}
+	doc := raw
+	if open != nil {
+		if doc, err = open(raw); err != nil {
+			return fmt.Errorf("read %s for backup: %w", path, err)
+		}
+	}
+	from, err := Version(doc)
+	if err != nil {
+		// An unparseable file has no version to preserve; the store reports
+		// it on read.
+		return nil
+	}
+	if current := Current(kind); from > current {
+		// Overwriting a newer document would silently drop whatever this
+		// build does not know about.
+		return fmt.Errorf("%s is a v%d %s document, this build writes v%d: %w", path, from, kind, current, ErrTooNew)
+	} else if from == current {
+		return nil
+	}
+	dir := filepath.Join(filepath.Dir(path), BackupDir)
+	backup := filepath.Join(dir, filepath.Base(path)+".v"+strconv.Itoa(from))
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if err := atomicfile.Write(backup, info.Mode().Perm(), func(f *os.File) error {
+		_, err := f.Write(raw)
+		return err
+	}); err != nil {
+		return fmt.Errorf("back up %s: %w", path, err)
+	}
+	return nil
+}
+
+// Rewrite upgrades the kind document at path in place, backing up the old
+// version first, and reports the version it started at. A current document is
+// left untouched. It is the migrate command's eager path; stores otherwise
+// rewrite lazily on their next write.
+func Rewrite(kind Kind, path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	out, from, err := Upgrade(kind, raw)
+	if err != nil || from == Current(kind) {
+		return from, err
+	}
+	if err := BackupBeforeWrite(kind, path); err != nil {
+		return from, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return from, err
+	}
+	return from, atomicfile.Write(path, info.Mode().Perm(), func(f *os.File) error {
+		_, err := f.Write(out)
+		return err
+	})
+}
@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testKind has a real second step, renaming a key, so the tests exercise a
+// migration that changes something.
+const testKind Kind = "test"
+
+func init() {
+	Register(Migration{Kind: testKind, From: 0, Summary: "add schema_version", Apply: func(*yaml.Node) error { return nil }})
+	Register(Migration{Kind: testKind, From: 1, Summary: "rename miles to odometer", Apply: func(doc *yaml.Node) error {
+		if v := Lookup(doc, "miles"); v != nil {
+			Remove(doc, "miles")
+			Set(doc, "odometer", v)
+		}
+		return nil
+	}})
+}
+
+func TestUpgradeAppliesPendingSteps(t *testing.T) {
+	raw := []byte("# hand-edited\nname: Golf\nmiles: 5000\nreadings:\n    2025-01-01: 5000\n")
+	out, from, err := Upgrade(testKind, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 0 {
+		t.Errorf("from = %d, want 0", from)
+	}
+	var doc struct {
+		Version  int            `yaml:"schema_version"`
+		Odometer int            `yaml:"odometer"`
+		Readings map[string]int `yaml:"readings"`
+	}
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 || doc.Odometer != 5000 {
+		t.Errorf("upgraded = %+v\n%s", doc, out)
+	}
+	// The unquoted date key is kept as written, not re-encoded as a timestamp.
+	if doc.Readings["2025-01-01"] != 5000 {
+		t.Errorf("readings = %v\n%s", doc.Readings, out)
+	}
+	if !strings.Contains(string(out), "# hand-edited") {
+		t.Errorf("comment lost:\n%s", out)
+	}
+
+	current := []byte("schema_version: 2\nodometer: 1\n")
+	if out, from, _ := Upgrade(testKind, current); from != 2 || string(out) != string(current) {
+		t.Errorf("current document changed: from=%d\n%s", from, out)
+	}
+	if _, _, err := Upgrade(testKind, []byte("schema_version: 3\n")); !errors.Is(err, ErrTooNew) {
+		t.Errorf("newer document: err = %v, want ErrTooNew", err)
+	}
+}
+
+func TestBackupBeforeWriteKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "golf.yml")
+	if err := os.WriteFile(path, []byte("miles: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BackupBeforeWrite(testKind, path); err != nil {
+		t.Fatal(err)
+	}
+	// A second write of a still-old file must not replace the first backup.
+	if err := os.WriteFile(path, []byte("miles: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BackupBeforeWrite(testKind, path); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := os.ReadFile(filepath.Join(dir, BackupDir, "golf.yml.v0"))
+	if err != nil || string(backup) != "miles: 1\n" {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+
+	if err := os.WriteFile(path, []byte("schema_version: 9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BackupBeforeWrite(testKind, path); !errors.Is(err, ErrTooNew) {
+		t.Errorf("newer file: err = %v, want ErrTooNew", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "golf.yml")
+	if err := os.WriteFile(path, []byte("miles: 7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	from, err := Rewrite(testKind, path)
+	if err != nil || from != 0 {
+		t.Fatalf("Rewrite = %d, %v", from, err)
+	}
+	raw, _ := os.ReadFile(path)
+	if v, _ := Version(raw); v != 2 || !strings.Contains(string(raw), "odometer: 7") {
+		t.Errorf("rewritten:\n%s", raw)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("perm = %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(dir, BackupDir, "golf.yml.v0")); err != nil {
+		t.Errorf("no backup: %v", err)
+	}
+}
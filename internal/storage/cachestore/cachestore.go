@@ -0,0 +1,400 @@
+// Package cachestore is a storage.Store decorator that keeps vehicle
+// documents, the current pointer and the settings in memory, so a dashboard
+// that lists every vehicle on each load reads the backend once rather than
+// every time. Writes go straight through to the backend and then re-read what
+// they touched, so the cache never holds anything the backend does not.
+//
+// It also keeps the calc.Status of each vehicle in a bounded LRU, keyed by the
+// vehicle's document version and the date: the fleet view recomputes only the
+// vehicles that changed since it last looked, and everything once a day.
+//
+// The cache sees changes made through it. Changes made by another process —
+// the CLI beside a server, or doctor, migrate or restore run over its data —
+// are noticed if the inner store is Versioned, which every backend is: the
+// cache checks the version before each read and drops what it holds when the
+// version has moved. Invalidate does the same on demand (see
+// yamlstore.Watcher).
+package cachestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// DefaultStatuses is the status LRU's size when Wrap is given 0: room for a
+// large fleet's statuses for two days running.
+const DefaultStatuses = 2048
+
+// Versioned is a store that can tell cheaply whether anything in it changed,
+// by any process, since it last answered: the version is an opaque string
+// that differs whenever the data might. Writes made through the same store
+// may or may not move it.
+type Versioned interface {
+	DataVersion(ctx context.Context) (string, error)
+}
+
+// Store is a caching storage.Store over an inner one. Trash operations are
+// not cached; they pass straight through.
+type Store struct {
+	inner storage.Store
+
+	mu       sync.Mutex
+	vehicles map[string]*entry
+	listed   bool // vehicles holds every vehicle, not just those read one by one
+	current  *string
+	settings *model.Settings
+	version  uint64 // last version handed out
+	statuses *lru[statusKey, calc.Status]
+	seen     string // the inner store's DataVersion when last checked
+}
+
+// entry is a cached document. Its version changes whenever the document does,
+// so a status computed from one version is never served for another.
+type entry struct {
+	data    *model.VehicleData
+	version uint64
+	stale   bool
+}
+
+type statusKey struct {
+	id      string
+	version uint64
+	date    string
+}
+
+// Wrap returns inner with a cache in front, holding up to statuses computed
+// statuses (DefaultStatuses when 0).
+func Wrap(inner storage.Store, statuses int) *Store {
+	if statuses <= 0 {
+		statuses = DefaultStatuses
+	}
+	return &Store{inner: inner, vehicles: map[string]*entry{}, statuses: newLRU[statusKey, calc.Status](statuses)}
+}
+
+// Invalidate marks everything cached as possibly out of date, to be re-read
+// when next asked for. A document that turns out unchanged keeps its version,
+// and with it its cached statuses.
+func (s *Store) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidate()
+}
+
+func (s *Store) invalidate() {
+	for _, e := range s.vehicles {
+		e.stale = true
+	}
+	s.listed = false
+	s.current = nil
+	s.settings = nil
+}
+
+// check invalidates the cache if the inner store is Versioned and its
+// version has moved since the last check, or cannot be read. Callers hold
+// s.mu.
+func (s *Store) check(ctx context.Context) {
+	v, ok := s.inner.(Versioned)
+	if !ok {
+		return
+	}
+	version, err := v.DataVersion(ctx)
+	if err != nil || version != s.seen {
+		s.invalidate()
+		s.seen = version
+	}
+}
+
+// put caches data as id's document, keeping the entry's version if the
+// document has not changed. Callers hold s.mu.
+func (s *Store) put(id string, data *model.VehicleData) *entry {
+	if e, ok := s.vehicles[id]; ok && reflect.DeepEqual(e.data, data) {
+		e.stale = false
+		return e
+	}
+	s.version++
+	e := &entry{data: data, version: s.version}
+	s.vehicles[id] = e
+	return e
+}
+
+// list makes sure every vehicle is cached and returns their ids in order.
+// Callers hold s.mu.
+func (s *Store) list(ctx context.Context) ([]string, error) {
+	if !s.listed {
+		records, err := s.inner.ListVehicles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(records))
+		for _, r := range records {
+			s.put(r.ID, r.Data)
+			seen[r.ID] = true
+		}
+		for id := range s.vehicles {
+			if !seen[id] {
+				delete(s.vehicles, id)
+			}
+		}
+		s.listed = true
+	}
+	ids := make([]string, 0, len(s.vehicles))
+	for id := range s.vehicles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// get returns id's cached entry, reading it if it is not cached or is stale.
+// Callers hold s.mu.
+func (s *Store) get(ctx context.Context, id string) (*entry, error) {
+	if e, ok := s.vehicles[id]; ok && !e.stale {
+		return e, nil
+	}
+	if s.listed {
+		return nil, fmt.Errorf("load vehicle %q: %w", id, storage.ErrNotFound)
+	}
+	data, err := s.inner.GetVehicle(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		delete(s.vehicles, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.put(id, data), nil
+}
+
+// wrote updates the cache after a write that touched ids: on success, by
+// re-reading them (the backend may have normalised what it stored). A write
+// refused with ErrNotFound or ErrExists changed nothing; any other failure may
+// have been partial, and invalidates everything. Callers hold s.mu.
+func (s *Store) wrote(ctx context.Context, err error, ids ...string) {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrExists) {
+		return
+	}
+	if err != nil {
+		s.invalidate()
+		return
+	}
+	for _, id := range ids {
+		data, err := s.inner.GetVehicle(ctx, id)
+		switch {
+		case err == nil:
+			s.put(id, data)
+		case errors.Is(err, storage.ErrNotFound):
+			delete(s.vehicles, id)
+		default:
+			s.invalidate()
+			return
+		}
+	}
+}
+
+// Statuses returns the status of every vehicle as of now, in id order,
+// computing only those not already cached for this version and date.
+func (s *Store) Statuses(ctx context.Context, now time.Time) ([]calc.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	ids, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	date := now.Format("2006-01-02")
+	statuses := make([]calc.Status, 0, len(ids))
+	for _, id := range ids {
+		e := s.vehicles[id]
+		key := statusKey{id: id, version: e.version, date: date}
+		status, ok := s.statuses.get(key)
+		if !ok {
+			status = calc.ComputeStatusAt(id, e.data, now)
+			s.statuses.put(key, status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *Store) ListVehicles(ctx context.Context) ([]storage.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	ids, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]storage.Record, 0, len(ids))
+	for _, id := range ids {
+		records = append(records, storage.Record{ID: id, Data: storage.CloneVehicle(s.vehicles[id].data)})
+	}
+	return records, nil
+}
+
+func (s *Store) ListVehicleSummaries(ctx context.Context) ([]storage.VehicleSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	ids, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]storage.VehicleSummary, 0, len(ids))
+	for _, id := range ids {
+		summaries = append(summaries, storage.Summarize(id, s.vehicles[id].data))
+	}
+	return summaries, nil
+}
+
+func (s *Store) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	e, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return storage.CloneVehicle(e.data), nil
+}
+
+func (s *Store) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.SaveVehicle(ctx, id, data)
+	s.wrote(ctx, err, id)
+	return err
+}
+
+func (s *Store) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.UpdateVehicle(ctx, id, fn)
+	s.wrote(ctx, err, id)
+	return err
+}
+
+func (s *Store) DeleteVehicle(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.DeleteVehicle(ctx, id)
+	s.wrote(ctx, err, id)
+	s.current = nil
+	return err
+}
+
+func (s *Store) PutReading(ctx context.Context, id, date string, miles int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.PutReading(ctx, id, date, miles)
+	s.wrote(ctx, err, id)
+	return err
+}
+
+func (s *Store) DeleteReading(ctx context.Context, id, date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.DeleteReading(ctx, id, date)
+	s.wrote(ctx, err, id)
+	return err
+}
+
+func (s *Store) GetCurrent(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	if s.current == nil {
+		current, err := s.inner.GetCurrent(ctx)
+		if err != nil {
+			return "", err
+		}
+		s.current = &current
+	}
+	return *s.current, nil
+}
+
+func (s *Store) SetCurrent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = nil
+	if err := s.inner.SetCurrent(ctx, id); err != nil {
+		return err
+	}
+	s.current = &id
+	return nil
+}
+
+func (s *Store) GetSettings(ctx context.Context) (*model.Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.check(ctx)
+	if s.settings == nil {
+		settings, err := s.inner.GetSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.settings = settings
+	}
+	settings := *s.settings
+	return &settings, nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings *model.Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = nil
+	return s.inner.SaveSettings(ctx, settings)
+}
+
+func (s *Store) RenameVehicle(ctx context.Context, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.inner.RenameVehicle(ctx, from, to)
+	s.wrote(ctx, err, from, to)
+	s.current = nil
+	return err
+}
+
+func (s *Store) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, err := s.inner.MergeVehicle(ctx, from, into, overwrite, check)
+	s.wrote(ctx, err, from, into)
+	s.current = nil
+	return report, err
+}
+
+func (s *Store) ListTrash(ctx context.Context) ([]storage.TrashItem, error) {
+	return s.inner.ListTrash(ctx)
+}
+
+func (s *Store) RestoreTrash(ctx context.Context, itemID string) (*storage.TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.inner.RestoreTrash(ctx, itemID)
+	if err != nil {
+		s.wrote(ctx, err)
+		return nil, err
+	}
+	s.wrote(ctx, nil, item.VehicleID)
+	return item, nil
+}
+
+func (s *Store) PurgeTrash(ctx context.Context, itemID string) error {
+	return s.inner.PurgeTrash(ctx, itemID)
+}
+
+func (s *Store) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	return s.inner.PurgeTrashBefore(ctx, cutoff)
+}
+
+// Compile-time assertion that Store satisfies storage.Store.
+var _ storage.Store = (*Store)(nil)
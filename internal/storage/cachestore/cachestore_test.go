@@ -0,0 +1,223 @@
+package cachestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/cachestore"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+func TestCacheConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return cachestore.Wrap(storage.NewMemory(), 0)
+	})
+}
+
+func TestCacheOverYAMLConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return cachestore.Wrap(yamlstore.New(t.TempDir()), 0)
+	})
+}
+
+func TestCacheTenantsIsolation(t *testing.T) {
+	storagetest.RunTenantIsolation(t, func(t *testing.T) storage.Tenants {
+		return cachestore.WrapTenants(yamlstore.NewTenants(t.TempDir()), 0)
+	})
+}
+
+// counting counts the reads that reach the wrapped Store.
+type counting struct {
+	storage.Store
+	lists, gets int
+}
+
+func (c *counting) ListVehicles(ctx context.Context) ([]storage.Record, error) {
+	c.lists++
+	return c.Store.ListVehicles(ctx)
+}
+
+func (c *counting) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
+	c.gets++
+	return c.Store.GetVehicle(ctx, id)
+}
+
+func seeded(t *testing.T) (*counting, *cachestore.Store) {
+	t.Helper()
+	inner := &counting{Store: storage.NewMemory()}
+	for _, id := range []string{"golf", "polo"} {
+		if err := inner.SaveVehicle(context.Background(), id, sample()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return inner, cachestore.Wrap(inner, 0)
+}
+
+// Repeated listings read the backend once; a write re-reads only the vehicle
+// it touched and the next listing sees it.
+func TestCacheReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	inner, st := seeded(t)
+	for range 3 {
+		if _, err := st.ListVehicles(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.ListVehicleSummaries(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.GetVehicle(ctx, "golf"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.lists != 1 || inner.gets != 0 {
+		t.Fatalf("backend read %d listings and %d vehicles, want 1 and 0", inner.lists, inner.gets)
+	}
+
+	if err := st.PutReading(ctx, "golf", "2025-05-01", 6400); err != nil {
+		t.Fatal(err)
+	}
+	records, err := st.ListVehicles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].ID != "golf" || records[0].Data.Readings["2025-05-01"] != 6400 {
+		t.Fatalf("listing after write = %+v", records[0])
+	}
+	if inner.lists != 1 || inner.gets != 1 {
+		t.Fatalf("after a write the backend read %d listings and %d vehicles, want 1 and 1", inner.lists, inner.gets)
+	}
+}
+
+// A change made behind the cache is seen only after Invalidate.
+func TestCacheInvalidate(t *testing.T) {
+	ctx := context.Background()
+	inner, st := seeded(t)
+	if _, err := st.ListVehicles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := inner.DeleteVehicle(ctx, "polo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inner.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetVehicle(ctx, "polo"); err != nil {
+		t.Fatalf("before Invalidate the cached polo should still be served: %v", err)
+	}
+
+	st.Invalidate()
+	if _, err := st.GetVehicle(ctx, "polo"); err == nil {
+		t.Fatal("after Invalidate polo should be gone")
+	}
+	records, err := st.ListVehicles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "golf" {
+		t.Fatalf("listing after Invalidate = %+v", records)
+	}
+	if current, err := st.GetCurrent(ctx); err != nil || current != "golf" {
+		t.Fatalf("GetCurrent after Invalidate = %q, %v", current, err)
+	}
+}
+
+// Over a Versioned store, a write by another process is seen without
+// Invalidate.
+func TestCacheNoticesOtherWriters(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := cachestore.Wrap(yamlstore.New(dir), 0)
+	if err := st.SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ListVehicles(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	other := yamlstore.New(dir)
+	if err := other.PutReading(ctx, "golf", "2025-06-01", 9000); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveVehicle(ctx, "polo", sample()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := st.GetVehicle(ctx, "golf")
+	if err != nil || data.Readings["2025-06-01"] != 9000 {
+		t.Fatalf("golf after another writer = %+v, %v", data, err)
+	}
+	if records, _ := st.ListVehicles(ctx); len(records) != 2 {
+		t.Fatalf("listing after another writer = %+v", records)
+	}
+}
+
+// A status is computed once per document version and date: a write, or the
+// next day, recomputes it; Invalidate with nothing changed does not.
+func TestCacheStatuses(t *testing.T) {
+	ctx := context.Background()
+	_, st := seeded(t)
+	day := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	first, err := st.Statuses(ctx, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].ID != "golf" || first[1].ID != "polo" {
+		t.Fatalf("statuses = %+v", first)
+	}
+	later, err := st.Statuses(ctx, day.Add(6*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if later[0] != first[0] {
+		t.Fatal("a status was recomputed later the same day with nothing changed")
+	}
+
+	st.Invalidate()
+	again, err := st.Statuses(ctx, day.Add(7*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0] != first[0] {
+		t.Fatal("Invalidate with nothing changed discarded a cached status")
+	}
+
+	if err := st.PutReading(ctx, "golf", "2025-05-31", 6400); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := st.Statuses(ctx, day.Add(8*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0] == first[0] {
+		t.Fatal("golf's status was not recomputed after a new reading")
+	}
+	if changed[1] != first[1] {
+		t.Fatal("polo's status was recomputed though it did not change")
+	}
+
+	tomorrow, err := st.Statuses(ctx, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tomorrow[1] == first[1] {
+		t.Fatal("polo's status was not recomputed for a new day")
+	}
+}
+
+func sample() *model.VehicleData {
+	return &model.VehicleData{
+		Vehicle: "Golf",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+			ExcessRate:      8,
+		},
+		Readings: map[string]int{"2025-01-01": 5000, "2025-03-01": 5600},
+	}
+}
@@ -0,0 +1,23 @@
+package cachestore
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRU[string, int](2)
+	c.put("a", 1)
+	c.put("b", 2)
+	if _, ok := c.get("a"); !ok { // a is now the most recently used
+		t.Fatal("a missing")
+	}
+	c.put("c", 3)
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b should have been evicted")
+	}
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Fatalf("a = %d, %v", v, ok)
+	}
+	c.put("a", 10)
+	if v, _ := c.get("a"); v != 10 || c.len() != 2 {
+		t.Fatalf("after update a = %d, len %d", v, c.len())
+	}
+}
@@ -0,0 +1,47 @@
+package cachestore
+
+import (
+	"sync"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// DefaultUsers is how many users' caches a Tenants keeps: the most recently
+// active ones. An evicted user's cache is rebuilt on their next request.
+const DefaultUsers = 256
+
+// Tenants puts a cache in front of every user's Store. ForUser is called per
+// request, so each user's cache is kept and handed out again, up to
+// DefaultUsers of them. A hosted root can be written by more than the server
+// (doctor, migrate, the CLI on a shared SQLite file); each cache notices
+// through its store's DataVersion, as Store does.
+type Tenants struct {
+	inner    storage.Tenants
+	statuses int
+
+	mu     sync.Mutex
+	stores *lru[string, *Store]
+}
+
+// WrapTenants returns inner with a cache per user, each holding up to
+// statuses computed statuses as in Wrap.
+func WrapTenants(inner storage.Tenants, statuses int) *Tenants {
+	return &Tenants{inner: inner, statuses: statuses, stores: newLRU[string, *Store](DefaultUsers)}
+}
+
+// ForUser returns userID's cached Store. The inner Tenants validates the id:
+// a Store that fails every method caches nothing, so it is wrapped as any
+// other.
+func (t *Tenants) ForUser(userID string) storage.Store {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stores.get(userID)
+	if !ok {
+		s = Wrap(t.inner.ForUser(userID), t.statuses)
+		t.stores.put(userID, s)
+	}
+	return s
+}
+
+// Compile-time assertion that Tenants satisfies storage.Tenants.
+var _ storage.Tenants = (*Tenants)(nil)
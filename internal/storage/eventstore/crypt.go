@@ -0,0 +1,63 @@
+package eventstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+)
+
+// NewEncrypted returns a Store over the log in dir whose events are each
+// sealed with key (see crypt.SealLine), as is the snapshot, so the log stays
+// append-only and line-based. A nil key makes a plain Store, as New does.
+func NewEncrypted(dir string, key *crypt.Key) *Store {
+	return &Store{dir: dir, key: key}
+}
+
+// NewEncryptedTenants returns a Tenants whose users' logs are sealed with
+// key, the hosted data root's. A nil key makes a plain Tenants.
+func NewEncryptedTenants(root string, key *crypt.Key) *Tenants {
+	t := NewTenants(root)
+	t.key = key
+	return t
+}
+
+// decodeEvent opens one line of the log with key and decodes its event.
+func decodeEvent(key *crypt.Key, line []byte) (Event, error) {
+	var e Event
+	raw, err := crypt.OpenLine(key, bytes.TrimSuffix(line, []byte("\n")))
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(raw, &e)
+	return e, err
+}
+
+// Convert re-seals the event log in dir from one key to another, as
+// yamlstore.Convert does a store directory, reporting whether it needed to.
+// The log is replaced atomically under the store's exclusive lock. Rewriting
+// it moves every event's byte position, so the snapshot, which records one,
+// is removed — on a rerun too, so none is left under the old key — and the
+// next Store to load rebuilds it from the log.
+func Convert(dir string, from, to *crypt.Key) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, LogFile)); os.IsNotExist(err) {
+		return false, nil
+	}
+	l, err := filelock.Exclusive(filepath.Join(dir, lockFile))
+	if err != nil {
+		return false, err
+	}
+	defer l.Unlock()
+	changed, err := crypt.ConvertLines(filepath.Join(dir, LogFile), from, to)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(filepath.Join(dir, SnapshotFile)); err != nil && !os.IsNotExist(err) {
+		return changed, fmt.Errorf("remove snapshot: %w", err)
+	}
+	return changed, nil
+}
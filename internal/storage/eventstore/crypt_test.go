@@ -0,0 +1,86 @@
+package eventstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+)
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEventEncryptedConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		s := eventstore.NewEncrypted(t.TempDir(), newKey(t))
+		s.SnapshotEvery = 1
+		return s
+	})
+}
+
+func TestEventConvert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	plain := eventstore.New(dir)
+	plain.SnapshotEvery = 2
+	populate(t, plain)
+
+	key := newKey(t)
+	if changed, err := eventstore.Convert(dir, nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, eventstore.LogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("Golf")) || bytes.Contains(raw, []byte("{")) {
+		t.Fatalf("log left in the clear:\n%s", raw)
+	}
+	if _, err := os.Stat(filepath.Join(dir, eventstore.SnapshotFile)); !os.IsNotExist(err) {
+		t.Fatalf("snapshot kept across the rewrite: %v", err)
+	}
+	if changed, err := eventstore.Convert(dir, key, key); err != nil || changed {
+		t.Fatalf("rerun: %v, %v; want nothing left to do", changed, err)
+	}
+	if _, err := eventstore.New(dir).ListVehicles(ctx); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+
+	enc := eventstore.NewEncrypted(dir, key)
+	want, err := enc.ListVehicles(ctx)
+	if err != nil || len(want) == 0 {
+		t.Fatalf("encrypted: %v, %v", want, err)
+	}
+	if err := enc.Snapshot(ctx); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := os.ReadFile(filepath.Join(dir, eventstore.SnapshotFile))
+	if err != nil || !crypt.IsSealed(snap) {
+		t.Fatalf("snapshot not sealed: %v", err)
+	}
+	events, err := enc.Changes(ctx, 0, 0)
+	if err != nil || len(events) != 10 {
+		t.Fatalf("changes: %d events, %v", len(events), err)
+	}
+
+	if changed, err := eventstore.Convert(dir, key, nil); err != nil || !changed {
+		t.Fatalf("decrypt: %v, %v", changed, err)
+	}
+	got, err := eventstore.New(dir).ListVehicles(ctx)
+	if err != nil || len(got) != len(want) {
+		t.Fatalf("after decrypt: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,427 @@
+// Package eventstore is an event-sourced storage backend. Every change made
+// through a Store — a saved vehicle, a reading put or deleted, a rename, a
+// trash purge — is appended to that store's log as an Event, and the
+// vehicles, readings, current pointer, settings and trash are a projection of
+// the log kept in memory. Nothing in the log is ever rewritten, so it is a
+// complete audit trail, and Changes lets a downstream consumer (a sync job, a
+// warehouse export) follow it from any offset.
+//
+// A Store builds its projection the first time it is used: from the latest
+// snapshot, written every SnapshotEvery events, plus the events logged after
+// it. Start-up therefore replays at most one interval's events however old
+// the store is. The snapshot is only a cache of the log; deleting it costs a
+// full replay and nothing else.
+//
+// # Layout and concurrency
+//
+// A store directory has the same place as a yamlstore one (~/.mileminder, or
+// <root>/users/<userID> in hosted mode) and holds events.jsonl, one JSON
+// event per line, and events.snapshot. Every method holds an advisory lock on
+// .events.lock (see internal/filelock) — shared to read, exclusive to write —
+// and first applies anything another process appended since it last looked,
+// so the CLI and a running server see each other's changes as they happen.
+//
+// Observable behaviour matches yamlstore, sqlstore and storage.Memory; the
+// storagetest suites hold all four to it.
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Files in a store directory.
+const (
+	LogFile      = "events.jsonl"
+	SnapshotFile = "events.snapshot"
+	lockFile     = ".events.lock"
+)
+
+// DefaultSnapshotEvery is how many events a Store logs between snapshots
+// when SnapshotEvery is unset.
+const DefaultSnapshotEvery = 500
+
+// Store is a storage.Store over one directory's event log.
+type Store struct {
+	// SnapshotEvery is how many events are logged between snapshots.
+	SnapshotEvery int
+
+	dir string
+	key *crypt.Key // nil unless the directory is encrypted
+	err error      // set for a malformed user id; every method returns it
+
+	mu         sync.Mutex
+	state      *state // nil until first used
+	offset     int64  // of the last event applied
+	pos        int64  // bytes of the log applied
+	snapOffset int64  // offset of the last snapshot
+}
+
+// New returns a Store over the log in dir. Nothing is read until the Store is
+// first used, and the directory is created on the first write.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) snapshotEvery() int {
+	if s.SnapshotEvery > 0 {
+		return s.SnapshotEvery
+	}
+	return DefaultSnapshotEvery
+}
+
+// read runs fn on the caught-up projection under the shared file lock. A
+// store whose directory does not exist yet reads as empty.
+func (s *Store) read(fn func(*state) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := filelock.Shared(filepath.Join(s.dir, lockFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		if s.state == nil {
+			s.load()
+		}
+		return fn(s.state)
+	}
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	if err := s.catchUp(); err != nil {
+		return err
+	}
+	return fn(s.state)
+}
+
+// write runs fn on the caught-up projection under the exclusive file lock;
+// fn validates the change against the state and commits its event.
+func (s *Store) write(fn func(*state) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("create store dir: %w", err)
+	}
+	l, err := filelock.Exclusive(filepath.Join(s.dir, lockFile))
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	if err := s.catchUp(); err != nil {
+		return err
+	}
+	return fn(s.state)
+}
+
+// Offset returns the offset of the latest event, 0 for an empty log.
+func (s *Store) Offset(ctx context.Context) (int64, error) {
+	var offset int64
+	err := s.read(func(*state) error {
+		offset = s.offset
+		return nil
+	})
+	return offset, err
+}
+
+// DataVersion is the Offset, for cachestore: every change, from any process,
+// appends an event.
+func (s *Store) DataVersion(ctx context.Context) (string, error) {
+	offset, err := s.Offset(ctx)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(offset, 10), nil
+}
+
+// Changes returns up to limit events logged after offset after, oldest first
+// (every one when limit is 0). A consumer passes 0 to start from the
+// beginning, then the Offset of the last event it handled.
+func (s *Store) Changes(ctx context.Context, after int64, limit int) ([]Event, error) {
+	var events []Event
+	err := s.read(func(*state) error {
+		var err error
+		events, err = readChanges(filepath.Join(s.dir, LogFile), s.key, after, limit)
+		return err
+	})
+	return events, err
+}
+
+// Snapshot writes a snapshot now, rather than waiting for the next
+// SnapshotEvery events.
+func (s *Store) Snapshot(ctx context.Context) error {
+	return s.write(func(*state) error {
+		return s.writeSnapshot()
+	})
+}
+
+func (s *Store) ListVehicles(ctx context.Context) ([]storage.Record, error) {
+	var records []storage.Record
+	err := s.read(func(st *state) error {
+		for _, id := range st.sortedIDs() {
+			records = append(records, storage.Record{ID: id, Data: storage.CloneVehicle(st.Vehicles[id])})
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (s *Store) ListVehicleSummaries(ctx context.Context) ([]storage.VehicleSummary, error) {
+	var summaries []storage.VehicleSummary
+	err := s.read(func(st *state) error {
+		for _, id := range st.sortedIDs() {
+			summaries = append(summaries, storage.Summarize(id, st.Vehicles[id]))
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+func (s *Store) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
+	var data *model.VehicleData
+	err := s.read(func(st *state) error {
+		v, ok := st.Vehicles[id]
+		if !ok {
+			return fmt.Errorf("load vehicle %q: %w", id, storage.ErrNotFound)
+		}
+		data = storage.CloneVehicle(v)
+		return nil
+	})
+	return data, err
+}
+
+func (s *Store) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
+	return s.write(func(st *state) error {
+		return s.commit(Event{Op: OpSaveVehicle, VehicleID: id, Vehicle: data})
+	})
+}
+
+func (s *Store) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	return s.write(func(st *state) error {
+		v, ok := st.Vehicles[id]
+		if !ok {
+			return fmt.Errorf("update vehicle %q: %w", id, storage.ErrNotFound)
+		}
+		data := storage.CloneVehicle(v)
+		if err := fn(data); err != nil {
+			return err
+		}
+		return s.commit(Event{Op: OpSaveVehicle, VehicleID: id, Vehicle: data})
+	})
+}
+
+func (s *Store) DeleteVehicle(ctx context.Context, id string) error {
+	return s.write(func(st *state) error {
+		data, ok := st.Vehicles[id]
+		if !ok {
+			return fmt.Errorf("delete vehicle %q: %w", id, storage.ErrNotFound)
+		}
+		item := storage.NewVehicleTrashItem(id, data, time.Now())
+		return s.commit(Event{Op: OpDeleteVehicle, VehicleID: id, Trash: &item})
+	})
+}
+
+func (s *Store) PutReading(ctx context.Context, id, date string, miles int) error {
+	return s.write(func(st *state) error {
+		if _, ok := st.Vehicles[id]; !ok {
+			return fmt.Errorf("put reading on %q: %w", id, storage.ErrNotFound)
+		}
+		return s.commit(Event{Op: OpPutReading, VehicleID: id, Date: date, Miles: miles})
+	})
+}
+
+func (s *Store) DeleteReading(ctx context.Context, id, date string) error {
+	return s.write(func(st *state) error {
+		data, ok := st.Vehicles[id]
+		if !ok {
+			return fmt.Errorf("delete reading on %q: %w", id, storage.ErrNotFound)
+		}
+		miles, ok := data.Readings[date]
+		if !ok {
+			return fmt.Errorf("delete reading %q on %q: %w", date, id, storage.ErrNotFound)
+		}
+		item := storage.NewReadingTrashItem(id, date, miles, time.Now())
+		return s.commit(Event{Op: OpDeleteReading, VehicleID: id, Date: date, Trash: &item})
+	})
+}
+
+func (s *Store) GetCurrent(ctx context.Context) (string, error) {
+	var current string
+	err := s.read(func(st *state) error {
+		current = st.Current
+		return nil
+	})
+	return current, err
+}
+
+func (s *Store) SetCurrent(ctx context.Context, id string) error {
+	return s.write(func(st *state) error {
+		if _, ok := st.Vehicles[id]; !ok {
+			return fmt.Errorf("set current %q: %w", id, storage.ErrNotFound)
+		}
+		return s.commit(Event{Op: OpSetCurrent, VehicleID: id})
+	})
+}
+
+func (s *Store) GetSettings(ctx context.Context) (*model.Settings, error) {
+	settings := model.DefaultSettings()
+	err := s.read(func(st *state) error {
+		if st.Settings != nil {
+			if st.Settings.Currency != "" {
+				settings.Currency = st.Settings.Currency
+			}
+			if st.Settings.DistanceUnit != "" {
+				settings.DistanceUnit = st.Settings.DistanceUnit
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings *model.Settings) error {
+	return s.write(func(st *state) error {
+		return s.commit(Event{Op: OpSaveSettings, Settings: settings})
+	})
+}
+
+func (s *Store) RenameVehicle(ctx context.Context, from, to string) error {
+	return s.write(func(st *state) error {
+		if _, ok := st.Vehicles[from]; !ok {
+			return fmt.Errorf("rename vehicle %q: %w", from, storage.ErrNotFound)
+		}
+		if !storage.ValidID(to) {
+			return fmt.Errorf("rename vehicle %q: invalid id %q", from, to)
+		}
+		if _, taken := st.Vehicles[to]; taken {
+			return fmt.Errorf("rename vehicle %q to %q: %w", from, to, storage.ErrExists)
+		}
+		return s.commit(Event{Op: OpRenameVehicle, VehicleID: from, To: to})
+	})
+}
+
+func (s *Store) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	var report readings.Report
+	err := s.write(func(st *state) error {
+		if from == into {
+			return fmt.Errorf("merge vehicle %q into itself", from)
+		}
+		src, ok := st.Vehicles[from]
+		if !ok {
+			return fmt.Errorf("merge vehicle %q: %w", from, storage.ErrNotFound)
+		}
+		dst, ok := st.Vehicles[into]
+		if !ok {
+			return fmt.Errorf("merge into vehicle %q: %w", into, storage.ErrNotFound)
+		}
+		var merged *model.VehicleData
+		merged, report = storage.MergeVehicleData(dst, src, overwrite)
+		if check != nil {
+			if err := check(merged); err != nil {
+				return err
+			}
+		}
+		return s.commit(Event{Op: OpMergeVehicle, VehicleID: from, To: into, Vehicle: merged})
+	})
+	if err != nil {
+		return readings.Report{}, err
+	}
+	return report, nil
+}
+
+func (s *Store) ListTrash(ctx context.Context) ([]storage.TrashItem, error) {
+	var items []storage.TrashItem
+	err := s.read(func(st *state) error {
+		items = make([]storage.TrashItem, 0, len(st.Trash))
+		for _, item := range st.Trash {
+			items = append(items, storage.CloneTrashItem(item))
+		}
+		storage.SortTrash(items)
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) RestoreTrash(ctx context.Context, itemID string) (*storage.TrashItem, error) {
+	var restored storage.TrashItem
+	err := s.write(func(st *state) error {
+		i := st.trashIndex(itemID)
+		if i < 0 {
+			return fmt.Errorf("restore %q: %w", itemID, storage.ErrNotFound)
+		}
+		item := st.Trash[i]
+		switch item.Kind {
+		case storage.TrashVehicle:
+			if _, taken := st.Vehicles[item.VehicleID]; taken {
+				return fmt.Errorf("restore vehicle %q: %w", item.VehicleID, storage.ErrExists)
+			}
+		case storage.TrashReading:
+			data, ok := st.Vehicles[item.VehicleID]
+			if !ok {
+				return fmt.Errorf("restore reading on %q: %w", item.VehicleID, storage.ErrNotFound)
+			}
+			if _, taken := data.Readings[item.Date]; taken {
+				return fmt.Errorf("restore reading %q on %q: %w", item.Date, item.VehicleID, storage.ErrExists)
+			}
+		default:
+			return fmt.Errorf("restore %q: unknown kind %q", itemID, item.Kind)
+		}
+		restored = storage.CloneTrashItem(item)
+		return s.commit(Event{Op: OpRestoreTrash, TrashID: itemID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+func (s *Store) PurgeTrash(ctx context.Context, itemID string) error {
+	return s.write(func(st *state) error {
+		if st.trashIndex(itemID) < 0 {
+			return fmt.Errorf("purge %q: %w", itemID, storage.ErrNotFound)
+		}
+		return s.commit(Event{Op: OpPurgeTrash, TrashID: itemID})
+	})
+}
+
+func (s *Store) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	purged := 0
+	err := s.write(func(st *state) error {
+		for _, item := range st.Trash {
+			if item.DeletedAt.Before(cutoff) {
+				purged++
+			}
+		}
+		if purged == 0 {
+			// Nothing to log: the sweep runs hourly and mostly finds nothing.
+			return nil
+		}
+		return s.commit(Event{Op: OpPurgeTrashBefore, Cutoff: &cutoff})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// Compile-time assertion that Store satisfies storage.Store.
+var _ storage.Store = (*Store)(nil)
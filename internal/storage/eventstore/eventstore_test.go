@@ -0,0 +1,278 @@
+package eventstore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/eventstore"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+)
+
+func TestEventConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return eventstore.New(t.TempDir())
+	})
+}
+
+// With a snapshot after every event, every read after a restart goes through
+// a snapshot rather than a replay; the contract must hold all the same.
+func TestEventConformanceSnapshotEveryEvent(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		s := eventstore.New(t.TempDir())
+		s.SnapshotEvery = 1
+		return s
+	})
+}
+
+func TestEventTenantsConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return eventstore.NewTenants(t.TempDir()).ForUser("user-1")
+	})
+}
+
+func TestEventTenantsIsolation(t *testing.T) {
+	storagetest.RunTenantIsolation(t, func(t *testing.T) storage.Tenants {
+		return eventstore.NewTenants(t.TempDir())
+	})
+}
+
+func TestEventTenantsRejectsMalformedUserID(t *testing.T) {
+	tn := eventstore.NewTenants(t.TempDir())
+	ctx := context.Background()
+	bad := []string{"", "..", "../escape", "a/b", "foo.bar", strings.Repeat("x", 200)}
+	for _, id := range bad {
+		st := tn.ForUser(id)
+		if err := st.SaveVehicle(ctx, "golf", sample()); err == nil {
+			t.Fatalf("malformed id %q: SaveVehicle should fail", id)
+		}
+		if _, err := st.GetVehicle(ctx, "golf"); err == nil {
+			t.Fatalf("malformed id %q: GetVehicle should fail", id)
+		}
+	}
+}
+
+// populate makes a history touching every kind of event.
+func populate(t *testing.T, s storage.Store) {
+	t.Helper()
+	ctx := context.Background()
+	steps := []func() error{
+		func() error { return s.SaveVehicle(ctx, "golf", sample()) },
+		func() error { return s.SaveVehicle(ctx, "polo", sample()) },
+		func() error { return s.SetCurrent(ctx, "golf") },
+		func() error { return s.PutReading(ctx, "golf", "2025-05-01", 6400) },
+		func() error { return s.DeleteReading(ctx, "golf", "2025-03-01") },
+		func() error { return s.SaveSettings(ctx, &model.Settings{Currency: "EUR"}) },
+		func() error { return s.RenameVehicle(ctx, "golf", "gti") },
+		func() error { _, err := s.MergeVehicle(ctx, "polo", "gti", false, nil); return err },
+		func() error { return s.SaveVehicle(ctx, "up", sample()) },
+		func() error { return s.DeleteVehicle(ctx, "up") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+}
+
+type view struct {
+	Vehicles []storage.Record
+	Current  string
+	Settings *model.Settings
+	Trash    []storage.TrashItem
+}
+
+func snapshotOf(t *testing.T, s storage.Store) view {
+	t.Helper()
+	ctx := context.Background()
+	var v view
+	var err error
+	if v.Vehicles, err = s.ListVehicles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v.Current, err = s.GetCurrent(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v.Settings, err = s.GetSettings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v.Trash, err = s.ListTrash(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// A fresh Store over the same directory rebuilds the same state, whether it
+// replays the whole log, resumes from a snapshot, or the snapshot is lost.
+func TestEventReplay(t *testing.T) {
+	for _, every := range []int{1, 3, 1000} {
+		dir := t.TempDir()
+		s := eventstore.New(dir)
+		s.SnapshotEvery = every
+		populate(t, s)
+		want := snapshotOf(t, s)
+
+		if got := snapshotOf(t, eventstore.New(dir)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("every %d: replayed state\n got %+v\nwant %+v", every, got, want)
+		}
+		_, err := os.Stat(filepath.Join(dir, eventstore.SnapshotFile))
+		if every == 1000 && err == nil {
+			t.Fatalf("every %d: snapshot written too early", every)
+		}
+		if every < 1000 && err != nil {
+			t.Fatalf("every %d: no snapshot: %v", every, err)
+		}
+		os.Remove(filepath.Join(dir, eventstore.SnapshotFile))
+		if got := snapshotOf(t, eventstore.New(dir)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("every %d: state without snapshot\n got %+v\nwant %+v", every, got, want)
+		}
+	}
+}
+
+// Two Stores over one directory, as the CLI and a server would be, see each
+// other's writes, and a write through either continues the same log.
+func TestEventSharedDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, b := eventstore.New(dir), eventstore.New(dir)
+	if err := a.SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetVehicle(ctx, "golf"); err != nil {
+		t.Fatalf("b does not see a's vehicle: %v", err)
+	}
+	if err := b.PutReading(ctx, "golf", "2025-05-01", 6400); err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.GetVehicle(ctx, "golf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Readings["2025-05-01"] != 6400 {
+		t.Fatalf("a does not see b's reading: %v", got.Readings)
+	}
+	offset, err := a.Offset(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 2 {
+		t.Fatalf("offset = %d, want 2", offset)
+	}
+}
+
+// A line cut short by a crash is not an event: it is ignored on replay and
+// overwritten by the next write.
+func TestEventTornLine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := eventstore.New(dir).SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, eventstore.LogFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"offset":2,"op":"put_rea`)
+	f.Close()
+
+	s := eventstore.New(dir)
+	if _, err := s.GetVehicle(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutReading(ctx, "golf", "2025-05-01", 6400); err != nil {
+		t.Fatal(err)
+	}
+	events, err := eventstore.New(dir).Changes(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Op != eventstore.OpPutReading || events[1].Miles != 6400 {
+		t.Fatalf("events after torn line = %+v", events)
+	}
+}
+
+func TestEventChanges(t *testing.T) {
+	ctx := context.Background()
+	s := eventstore.New(t.TempDir())
+	populate(t, s)
+
+	all, err := s.Changes(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 10 {
+		t.Fatalf("got %d events, want 10", len(all))
+	}
+	for i, e := range all {
+		if e.Offset != int64(i+1) || e.Time.IsZero() {
+			t.Fatalf("event %d = offset %d at %v", i, e.Offset, e.Time)
+		}
+	}
+	if all[6].Op != eventstore.OpRenameVehicle || all[6].VehicleID != "golf" || all[6].To != "gti" {
+		t.Fatalf("event 7 = %+v, want the rename", all[6])
+	}
+	if all[9].Op != eventstore.OpDeleteVehicle || all[9].Trash == nil || all[9].Trash.VehicleID != "up" {
+		t.Fatalf("event 10 = %+v, want the delete with its trash item", all[9])
+	}
+
+	page, err := s.Changes(ctx, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Offset != 4 || page[1].Offset != 5 {
+		t.Fatalf("Changes(3, 2) = %+v", page)
+	}
+	rest, err := s.Changes(ctx, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Changes past the end = %+v", rest)
+	}
+}
+
+// A failed write logs nothing, and a purge that finds nothing to purge is not
+// an event.
+func TestEventRejectedWritesNotLogged(t *testing.T) {
+	ctx := context.Background()
+	s := eventstore.New(t.TempDir())
+	if err := s.PutReading(ctx, "golf", "2025-05-01", 6400); err == nil {
+		t.Fatal("PutReading on a missing vehicle should fail")
+	}
+	if err := s.SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenameVehicle(ctx, "golf", "golf"); err == nil {
+		t.Fatal("rename onto itself should fail")
+	}
+	if n, err := s.PurgeTrashBefore(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("PurgeTrashBefore = %d, %v", n, err)
+	}
+	offset, err := s.Offset(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 1 {
+		t.Fatalf("offset = %d, want 1", offset)
+	}
+}
+
+func sample() *model.VehicleData {
+	return &model.VehicleData{
+		Vehicle: "Golf",
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+			ExcessRate:      8,
+		},
+		Readings: map[string]int{"2025-01-01": 5000, "2025-03-01": 5600},
+	}
+}
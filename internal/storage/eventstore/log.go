@@ -0,0 +1,365 @@
+package eventstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Event operations, one per storage.Store write.
+const (
+	OpSaveVehicle      = "save_vehicle"
+	OpDeleteVehicle    = "delete_vehicle"
+	OpPutReading       = "put_reading"
+	OpDeleteReading    = "delete_reading"
+	OpSetCurrent       = "set_current"
+	OpSaveSettings     = "save_settings"
+	OpRenameVehicle    = "rename_vehicle"
+	OpMergeVehicle     = "merge_vehicle"
+	OpRestoreTrash     = "restore_trash"
+	OpPurgeTrash       = "purge_trash"
+	OpPurgeTrashBefore = "purge_trash_before"
+)
+
+// Event is one change, as logged. An event carries everything needed to
+// apply it — the trash item a delete created, the document a merge produced —
+// so replaying the log always rebuilds the same state, whatever the clock or
+// the merge rule say on the day.
+type Event struct {
+	// Offset is the event's position in its store's log: 1 for the first,
+	// then consecutive.
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+
+	VehicleID string `json:"vehicle_id,omitempty"`
+	// To is a renamed vehicle's new id, or the vehicle one was merged into.
+	To    string `json:"to,omitempty"`
+	Date  string `json:"date,omitempty"`
+	Miles int    `json:"miles,omitempty"`
+	// Vehicle is the document a save wrote or a merge produced.
+	Vehicle  *model.VehicleData `json:"vehicle,omitempty"`
+	Settings *model.Settings    `json:"settings,omitempty"`
+	// Trash is the item a delete moved to the trash; TrashID the item a
+	// restore or purge took out of it.
+	Trash   *storage.TrashItem `json:"trash,omitempty"`
+	TrashID string             `json:"trash_id,omitempty"`
+	// Cutoff is a purge_trash_before's cutoff.
+	Cutoff *time.Time `json:"cutoff,omitempty"`
+}
+
+// state is the projection: what the log adds up to.
+type state struct {
+	Vehicles map[string]*model.VehicleData `json:"vehicles"`
+	Current  string                        `json:"current,omitempty"`
+	Settings *model.Settings               `json:"settings,omitempty"` // nil until saved
+	Trash    []storage.TrashItem           `json:"trash,omitempty"`
+}
+
+func newState() *state {
+	return &state{Vehicles: map[string]*model.VehicleData{}}
+}
+
+// apply folds one event into the state. The Store validates a change before
+// logging it, so an event that does not apply means the log was altered.
+func (st *state) apply(e Event) error {
+	switch e.Op {
+	case OpSaveVehicle:
+		if e.Vehicle == nil {
+			return errors.New("no vehicle")
+		}
+		st.Vehicles[e.VehicleID] = storage.CloneVehicle(e.Vehicle)
+	case OpDeleteVehicle:
+		if _, ok := st.Vehicles[e.VehicleID]; !ok || e.Trash == nil {
+			return fmt.Errorf("no vehicle %q", e.VehicleID)
+		}
+		delete(st.Vehicles, e.VehicleID)
+		st.Trash = append(st.Trash, storage.CloneTrashItem(*e.Trash))
+	case OpPutReading:
+		data, ok := st.Vehicles[e.VehicleID]
+		if !ok {
+			return fmt.Errorf("no vehicle %q", e.VehicleID)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[e.Date] = e.Miles
+	case OpDeleteReading:
+		data, ok := st.Vehicles[e.VehicleID]
+		if !ok || e.Trash == nil {
+			return fmt.Errorf("no vehicle %q", e.VehicleID)
+		}
+		delete(data.Readings, e.Date)
+		st.Trash = append(st.Trash, storage.CloneTrashItem(*e.Trash))
+	case OpSetCurrent:
+		st.Current = e.VehicleID
+	case OpSaveSettings:
+		if e.Settings == nil {
+			return errors.New("no settings")
+		}
+		settings := *e.Settings
+		st.Settings = &settings
+	case OpRenameVehicle:
+		data, ok := st.Vehicles[e.VehicleID]
+		if !ok {
+			return fmt.Errorf("no vehicle %q", e.VehicleID)
+		}
+		st.Vehicles[e.To] = data
+		delete(st.Vehicles, e.VehicleID)
+		st.repoint(e.VehicleID, e.To)
+	case OpMergeVehicle:
+		if e.Vehicle == nil {
+			return errors.New("no vehicle")
+		}
+		st.Vehicles[e.To] = storage.CloneVehicle(e.Vehicle)
+		delete(st.Vehicles, e.VehicleID)
+		st.repoint(e.VehicleID, e.To)
+	case OpRestoreTrash:
+		i := st.trashIndex(e.TrashID)
+		if i < 0 {
+			return fmt.Errorf("no trash item %q", e.TrashID)
+		}
+		item := st.Trash[i]
+		if item.Kind == storage.TrashVehicle {
+			st.Vehicles[item.VehicleID] = storage.CloneVehicle(item.Vehicle)
+		} else {
+			data, ok := st.Vehicles[item.VehicleID]
+			if !ok {
+				return fmt.Errorf("no vehicle %q", item.VehicleID)
+			}
+			if data.Readings == nil {
+				data.Readings = map[string]int{}
+			}
+			data.Readings[item.Date] = item.Miles
+		}
+		st.Trash = slices.Delete(st.Trash, i, i+1)
+	case OpPurgeTrash:
+		i := st.trashIndex(e.TrashID)
+		if i < 0 {
+			return fmt.Errorf("no trash item %q", e.TrashID)
+		}
+		st.Trash = slices.Delete(st.Trash, i, i+1)
+	case OpPurgeTrashBefore:
+		if e.Cutoff == nil {
+			return errors.New("no cutoff")
+		}
+		st.Trash = slices.DeleteFunc(st.Trash, func(item storage.TrashItem) bool {
+			return item.DeletedAt.Before(*e.Cutoff)
+		})
+	default:
+		return fmt.Errorf("unknown op %q", e.Op)
+	}
+	return nil
+}
+
+// repoint moves the current pointer from one id to another if it names from.
+func (st *state) repoint(from, to string) {
+	if st.Current == from {
+		st.Current = to
+	}
+}
+
+// trashIndex returns the position of itemID in the trash, or -1.
+func (st *state) trashIndex(itemID string) int {
+	return slices.IndexFunc(st.Trash, func(item storage.TrashItem) bool { return item.ID == itemID })
+}
+
+// sortedIDs returns the vehicle ids in order, as ListVehicles lists them.
+func (st *state) sortedIDs() []string {
+	ids := make([]string, 0, len(st.Vehicles))
+	for id := range st.Vehicles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// snapshot is the state as of an offset, and where in the log that offset
+// ends, so loading it skips straight to the events after it.
+type snapshot struct {
+	Offset int64  `json:"offset"`
+	Pos    int64  `json:"pos"`
+	State  *state `json:"state"`
+}
+
+// load resets the projection to the latest snapshot, or to empty if there is
+// none usable. A snapshot is only a shortcut: one that cannot be read, or
+// that claims more of the log than there is, is ignored and the whole log is
+// replayed instead.
+func (s *Store) load() {
+	s.state, s.offset, s.pos, s.snapOffset = newState(), 0, 0, 0
+	raw, err := crypt.ReadFile(s.key, filepath.Join(s.dir, SnapshotFile))
+	if err != nil {
+		return
+	}
+	var snap snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil || snap.State == nil || snap.State.Vehicles == nil {
+		return
+	}
+	if info, err := os.Stat(filepath.Join(s.dir, LogFile)); err != nil || info.Size() < snap.Pos {
+		return
+	}
+	s.state, s.offset, s.pos, s.snapOffset = snap.State, snap.Offset, snap.Pos, snap.Offset
+}
+
+// catchUp applies whatever has been logged since this Store last looked —
+// everything, the first time, after the snapshot — including events other
+// processes appended. A final line without its newline is a write still in
+// progress, or one cut short by a crash, and is left for later. Callers hold
+// s.mu and the file lock.
+func (s *Store) catchUp() error {
+	if s.state == nil {
+		s.load()
+	}
+	path := filepath.Join(s.dir, LogFile)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && s.pos == 0 {
+			return nil
+		}
+		return fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat event log: %w", err)
+	}
+	if info.Size() < s.pos {
+		// Replaced or truncated behind our back: start again.
+		s.load()
+	}
+	if info.Size() == s.pos {
+		return nil
+	}
+	if _, err := f.Seek(s.pos, io.SeekStart); err != nil {
+		return fmt.Errorf("read event log: %w", err)
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read event log: %w", err)
+		}
+		e, err := decodeEvent(s.key, line)
+		if err != nil {
+			return fmt.Errorf("event log %s: event %d: %w", path, s.offset+1, err)
+		}
+		if e.Offset != s.offset+1 {
+			return fmt.Errorf("event log %s: event %d has offset %d", path, s.offset+1, e.Offset)
+		}
+		if err := s.state.apply(e); err != nil {
+			return fmt.Errorf("event log %s: event %d (%s): %w", path, e.Offset, e.Op, err)
+		}
+		s.offset = e.Offset
+		s.pos += int64(len(line))
+	}
+}
+
+// commit logs e and applies it. The line is synced before the projection
+// changes, so nothing is ever visible that a restart would lose. Any torn
+// line left by a crashed writer is cut off first. Callers hold s.mu and the
+// exclusive file lock, and have caught up.
+func (s *Store) commit(e Event) error {
+	e.Offset = s.offset + 1
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if line, err = crypt.SealLine(s.key, line); err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	line = append(line, '\n')
+	f, err := os.OpenFile(filepath.Join(s.dir, LogFile), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+	if err := f.Truncate(s.pos); err != nil {
+		f.Close()
+		return fmt.Errorf("write event log: %w", err)
+	}
+	if _, err := f.WriteAt(line, s.pos); err != nil {
+		f.Close()
+		return fmt.Errorf("write event log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync event log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write event log: %w", err)
+	}
+	if err := s.state.apply(e); err != nil {
+		return fmt.Errorf("apply %s: %w", e.Op, err)
+	}
+	s.offset = e.Offset
+	s.pos += int64(len(line))
+	if s.offset-s.snapOffset >= int64(s.snapshotEvery()) {
+		// A snapshot that fails to write costs only start-up time; the
+		// change itself is safely logged.
+		_ = s.writeSnapshot()
+	}
+	return nil
+}
+
+// writeSnapshot saves the projection as of the current offset. Callers hold
+// s.mu and the exclusive file lock.
+func (s *Store) writeSnapshot() error {
+	raw, err := json.Marshal(snapshot{Offset: s.offset, Pos: s.pos, State: s.state})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := crypt.WriteFile(s.key, filepath.Join(s.dir, SnapshotFile), 0600, raw); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	s.snapOffset = s.offset
+	return nil
+}
+
+// readChanges reads up to limit events after offset from the log at path,
+// opening them with key, and skipping the lines before it undecoded: line N
+// holds offset N.
+func readChanges(path string, key *crypt.Key, after int64, limit int) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var events []Event
+	for n := int64(1); limit <= 0 || len(events) < limit; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read event log: %w", err)
+		}
+		if n <= after {
+			continue
+		}
+		e, err := decodeEvent(key, line)
+		if err != nil {
+			return nil, fmt.Errorf("event log %s: event %d: %w", path, n, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,54 @@
+package eventstore
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Tenants is a storage.Tenants with one event log per user, under
+// <root>/users/<userID> like yamlstore's. A user's Store is kept once built,
+// so its projection is replayed once per process rather than per request.
+type Tenants struct {
+	// SnapshotEvery is passed to every user's Store.
+	SnapshotEvery int
+
+	root string
+	key  *crypt.Key
+
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+// NewTenants returns a Tenants rooted at root. User directories are created
+// on first write.
+func NewTenants(root string) *Tenants {
+	return &Tenants{root: root, stores: map[string]*Store{}}
+}
+
+// ForUser returns the Store scoped to userID. An id that is not
+// storage.ValidUserID yields a Store whose every method fails.
+func (t *Tenants) ForUser(userID string) storage.Store {
+	return t.User(userID)
+}
+
+// User is ForUser returning the *Store itself, for its Changes feed.
+func (t *Tenants) User(userID string) *Store {
+	if !storage.ValidUserID(userID) {
+		return &Store{err: storage.InvalidUserError(userID)}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stores[userID]
+	if !ok {
+		s = NewEncrypted(filepath.Join(t.root, "users", userID), t.key)
+		s.SnapshotEvery = t.SnapshotEvery
+		t.stores[userID] = s
+	}
+	return s
+}
+
+// Compile-time assertion that Tenants satisfies storage.Tenants.
+var _ storage.Tenants = (*Tenants)(nil)
@@ -3,10 +3,13 @@ package storage
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
 )
 
 // Memory is an in-memory storage.Store for fast, filesystem-free tests of the
@@ -17,6 +20,7 @@ type Memory struct {
 	vehicles map[string]*model.VehicleData
 	current  string
 	settings *model.Settings // nil until saved; Get falls back to defaults
+	trash    []TrashItem
 }
 
 // NewMemory returns an empty in-memory Store.
@@ -24,9 +28,10 @@ func NewMemory() *Memory {
 	return &Memory{vehicles: map[string]*model.VehicleData{}}
 }
 
-// clone deep-copies a vehicle so callers cannot mutate stored state through a
-// returned pointer (the filesystem store hands back fresh parses each time).
-func clone(data *model.VehicleData) *model.VehicleData {
+// CloneVehicle deep-copies a vehicle so callers cannot mutate stored state
+// through a returned pointer (the filesystem store hands back fresh parses each
+// time). In-memory Stores, this one and eventstore's projection, share it.
+func CloneVehicle(data *model.VehicleData) *model.VehicleData {
 	cp := *data
 	if data.Plan != nil {
 		p := *data.Plan
@@ -36,6 +41,7 @@ func clone(data *model.VehicleData) *model.VehicleData {
 	for k, v := range data.Readings {
 		cp.Readings[k] = v
 	}
+	cp.OdometerChanges = slices.Clone(data.OdometerChanges)
 	return &cp
 }
 
@@ -51,11 +57,28 @@ func (m *Memory) ListVehicles(ctx context.Context) ([]Record, error) {
 
 	records := make([]Record, 0, len(ids))
 	for _, id := range ids {
-		records = append(records, Record{ID: id, Data: clone(m.vehicles[id])})
+		records = append(records, Record{ID: id, Data: CloneVehicle(m.vehicles[id])})
 	}
 	return records, nil
 }
 
+func (m *Memory) ListVehicleSummaries(ctx context.Context) ([]VehicleSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.vehicles))
+	for id := range m.vehicles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	summaries := make([]VehicleSummary, 0, len(ids))
+	for _, id := range ids {
+		summaries = append(summaries, Summarize(id, m.vehicles[id]))
+	}
+	return summaries, nil
+}
+
 func (m *Memory) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -64,14 +87,30 @@ func (m *Memory) GetVehicle(ctx context.Context, id string) (*model.VehicleData,
 	if !ok {
 		return nil, fmt.Errorf("load vehicle %q: %w", id, ErrNotFound)
 	}
-	return clone(data), nil
+	return CloneVehicle(data), nil
 }
 
 func (m *Memory) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.vehicles[id] = clone(data)
+	m.vehicles[id] = CloneVehicle(data)
+	return nil
+}
+
+func (m *Memory) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.vehicles[id]
+	if !ok {
+		return fmt.Errorf("update vehicle %q: %w", id, ErrNotFound)
+	}
+	cp := CloneVehicle(data)
+	if err := fn(cp); err != nil {
+		return err
+	}
+	m.vehicles[id] = CloneVehicle(cp)
 	return nil
 }
 
@@ -79,9 +118,11 @@ func (m *Memory) DeleteVehicle(ctx context.Context, id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.vehicles[id]; !ok {
+	data, ok := m.vehicles[id]
+	if !ok {
 		return fmt.Errorf("delete vehicle %q: %w", id, ErrNotFound)
 	}
+	m.trash = append(m.trash, NewVehicleTrashItem(id, data, time.Now()))
 	delete(m.vehicles, id)
 	return nil
 }
@@ -109,9 +150,11 @@ func (m *Memory) DeleteReading(ctx context.Context, id, date string) error {
 	if !ok {
 		return fmt.Errorf("delete reading on %q: %w", id, ErrNotFound)
 	}
-	if _, ok := data.Readings[date]; !ok {
+	miles, ok := data.Readings[date]
+	if !ok {
 		return fmt.Errorf("delete reading %q on %q: %w", date, id, ErrNotFound)
 	}
+	m.trash = append(m.trash, NewReadingTrashItem(id, date, miles, time.Now()))
 	delete(data.Readings, date)
 	return nil
 }
@@ -158,5 +201,142 @@ func (m *Memory) SaveSettings(ctx context.Context, s *model.Settings) error {
 	return nil
 }
 
+func (m *Memory) RenameVehicle(ctx context.Context, from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.vehicles[from]
+	if !ok {
+		return fmt.Errorf("rename vehicle %q: %w", from, ErrNotFound)
+	}
+	if !ValidID(to) {
+		return fmt.Errorf("rename vehicle %q: invalid id %q", from, to)
+	}
+	if _, taken := m.vehicles[to]; taken {
+		return fmt.Errorf("rename vehicle %q to %q: %w", from, to, ErrExists)
+	}
+	m.vehicles[to] = data
+	delete(m.vehicles, from)
+	if m.current == from {
+		m.current = to
+	}
+	return nil
+}
+
+func (m *Memory) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if from == into {
+		return readings.Report{}, fmt.Errorf("merge vehicle %q into itself", from)
+	}
+	src, ok := m.vehicles[from]
+	if !ok {
+		return readings.Report{}, fmt.Errorf("merge vehicle %q: %w", from, ErrNotFound)
+	}
+	dst, ok := m.vehicles[into]
+	if !ok {
+		return readings.Report{}, fmt.Errorf("merge into vehicle %q: %w", into, ErrNotFound)
+	}
+	merged, report := MergeVehicleData(dst, src, overwrite)
+	if check != nil {
+		if err := check(merged); err != nil {
+			return readings.Report{}, err
+		}
+	}
+	m.vehicles[into] = merged
+	delete(m.vehicles, from)
+	if m.current == from {
+		m.current = into
+	}
+	return report, nil
+}
+
+func (m *Memory) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make([]TrashItem, 0, len(m.trash))
+	for _, item := range m.trash {
+		items = append(items, CloneTrashItem(item))
+	}
+	SortTrash(items)
+	return items, nil
+}
+
+func (m *Memory) RestoreTrash(ctx context.Context, itemID string) (*TrashItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.trashIndex(itemID)
+	if i < 0 {
+		return nil, fmt.Errorf("restore %q: %w", itemID, ErrNotFound)
+	}
+	item := m.trash[i]
+	switch item.Kind {
+	case TrashVehicle:
+		if _, taken := m.vehicles[item.VehicleID]; taken {
+			return nil, fmt.Errorf("restore vehicle %q: %w", item.VehicleID, ErrExists)
+		}
+		m.vehicles[item.VehicleID] = CloneVehicle(item.Vehicle)
+	case TrashReading:
+		data, ok := m.vehicles[item.VehicleID]
+		if !ok {
+			return nil, fmt.Errorf("restore reading on %q: %w", item.VehicleID, ErrNotFound)
+		}
+		if _, taken := data.Readings[item.Date]; taken {
+			return nil, fmt.Errorf("restore reading %q on %q: %w", item.Date, item.VehicleID, ErrExists)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[item.Date] = item.Miles
+	default:
+		return nil, fmt.Errorf("restore %q: unknown kind %q", itemID, item.Kind)
+	}
+	m.trash = append(m.trash[:i], m.trash[i+1:]...)
+	restored := CloneTrashItem(item)
+	return &restored, nil
+}
+
+func (m *Memory) PurgeTrash(ctx context.Context, itemID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.trashIndex(itemID)
+	if i < 0 {
+		return fmt.Errorf("purge %q: %w", itemID, ErrNotFound)
+	}
+	m.trash = append(m.trash[:i], m.trash[i+1:]...)
+	return nil
+}
+
+func (m *Memory) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.trash[:0]
+	for _, item := range m.trash {
+		if item.DeletedAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	purged := len(m.trash) - len(kept)
+	m.trash = kept
+	return purged, nil
+}
+
+// trashIndex returns the position of itemID in the trash, or -1. Callers hold
+// the lock.
+func (m *Memory) trashIndex(itemID string) int {
+	for i, item := range m.trash {
+		if item.ID == itemID {
+			return i
+		}
+	}
+	return -1
+}
+
 // Compile-time assertion that Memory satisfies Store.
 var _ Store = (*Memory)(nil)
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+)
+
+// ValidID reports whether id is safe to use as a vehicle id: non-empty,
+// bounded, and free of path separators and leading dots, since the YAML store
+// uses the id as a file name. Callers taking an id from outside (an archive, a
+// rename request) check it before it reaches a Store.
+func ValidID(id string) bool {
+	if id == "" || len(id) > 128 || strings.HasPrefix(id, ".") {
+		return false
+	}
+	return !strings.ContainsAny(id, `/\`+"\x00")
+}
+
+// ValidUserID reports whether id is safe to use as a hosted user id: non-empty,
+// bounded, and made only of [A-Za-z0-9_-]. That excludes path separators, "."
+// and "..", so every per-user store can join it under the users directory
+// without escaping it. User ids are server-generated hex, but each Tenants
+// checks anyway as defence against directory traversal.
+func ValidUserID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9':
+		case r == '_' || r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// MergeVehicleData is the one rule for combining two documents for the same
+// car, shared by every Store's MergeVehicle and by archive import. into keeps
+// its name, registration and plan, adopting from's registration and plan only
+// where it has none; from's readings are merged in through readings.Merge, so a
+// date both share keeps into's value unless overwrite is set. Odometer changes
+// are combined the same way, keyed by date, with into's always winning. Neither
+// argument is modified.
+func MergeVehicleData(into, from *model.VehicleData, overwrite bool) (*model.VehicleData, readings.Report) {
+	rows := make([]readings.Reading, 0, len(from.Readings))
+	for date, miles := range from.Readings {
+		rows = append(rows, readings.Reading{Date: date, Miles: miles})
+	}
+	out := CloneVehicle(into)
+	var report readings.Report
+	out.Readings, report = readings.Merge(into.Readings, rows, overwrite)
+	if out.Plan == nil && from.Plan != nil {
+		p := *from.Plan
+		out.Plan = &p
+	}
+	if out.Registration == "" {
+		out.Registration = from.Registration
+	}
+	for _, c := range from.OdometerChanges {
+		if !slices.ContainsFunc(out.OdometerChanges, func(o model.OdometerChange) bool { return o.Date == c.Date }) {
+			out.OdometerChanges = append(out.OdometerChanges, c)
+		}
+	}
+	slices.SortFunc(out.OdometerChanges, func(a, b model.OdometerChange) int { return strings.Compare(a.Date, b.Date) })
+	return out, report
+}
+
+// MergeSnapshot is vehicles from and into as read before a MergeVehicle, so a
+// caller whose follow-up work (moving photos, trips) fails can put them back.
+type MergeSnapshot struct {
+	from, into string
+	overwrite  bool
+	src, dst   *model.VehicleData
+	current    string
+}
+
+// SnapshotMerge reads the two vehicles of a merge of from into into, and the
+// current pointer.
+func SnapshotMerge(ctx context.Context, st Store, from, into string, overwrite bool) (*MergeSnapshot, error) {
+	src, err := st.GetVehicle(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("merge vehicle %q: %w", from, err)
+	}
+	dst, err := st.GetVehicle(ctx, into)
+	if err != nil {
+		return nil, fmt.Errorf("merge into vehicle %q: %w", into, err)
+	}
+	current, err := st.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &MergeSnapshot{from: from, into: into, overwrite: overwrite, src: src, dst: dst, current: current}, nil
+}
+
+// Check returns the check for MergeVehicle: it refuses a merge whose readings
+// changed since the snapshot, which Undo could not put back, then runs
+// validate (if not nil) on the merged document.
+func (m *MergeSnapshot) Check(validate func(*model.VehicleData) error) func(*model.VehicleData) error {
+	want, _ := MergeVehicleData(m.dst, m.src, m.overwrite)
+	return func(merged *model.VehicleData) error {
+		if !maps.Equal(merged.Readings, want.Readings) {
+			return fmt.Errorf("vehicles %q and %q changed during the merge; try again", m.from, m.into)
+		}
+		if validate != nil {
+			return validate(merged)
+		}
+		return nil
+	}
+}
+
+// Undo reverses the merge: from is saved again as it was, into goes back to
+// its old document, and the current pointer to from if it named it.
+func (m *MergeSnapshot) Undo(ctx context.Context, st Store) error {
+	if err := st.SaveVehicle(ctx, m.from, m.src); err != nil {
+		return err
+	}
+	if err := st.UpdateVehicle(ctx, m.into, func(data *model.VehicleData) error {
+		*data = *CloneVehicle(m.dst)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if m.current == m.from {
+		return st.SetCurrent(ctx, m.from)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+// OpenEncrypted opens the database at path as Open does, with its data
+// sealed with key: every vehicle document column, reading and trashed
+// reading's miles and the settings are stored as sealed BLOBs. The columns
+// that key and order rows stay plain — owners, vehicle ids, reading dates,
+// trash item ids and kinds, deletion times — as a YAML store's file names do.
+// A nil key opens a plain database, as Open does.
+func OpenEncrypted(path string, key *crypt.Key) (*DB, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	db.key = key
+	return db, nil
+}
+
+// sealText is a text column's value as stored: v itself, or sealed.
+func (s *Store) sealText(v string) (any, error) {
+	if s.key == nil {
+		return v, nil
+	}
+	return s.key.Seal([]byte(v))
+}
+
+// sealNull is sealText for a nullable column; NULL stays NULL.
+func (s *Store) sealNull(v sql.NullString) (any, error) {
+	if !v.Valid {
+		return nil, nil
+	}
+	return s.sealText(v.String)
+}
+
+// sealInt is an integer column's value as stored: n itself, or its decimal
+// text sealed.
+func (s *Store) sealInt(n int) (any, error) {
+	if s.key == nil {
+		return n, nil
+	}
+	return s.key.Seal([]byte(strconv.Itoa(n)))
+}
+
+// openText decodes a text column scanned into an any. As crypt.Open does, a
+// plain store refuses sealed values and an encrypted one plain values.
+func (s *Store) openText(v any) (string, error) {
+	var raw []byte
+	switch v := v.(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unexpected %T", v)
+	}
+	plain, err := crypt.Open(s.key, raw)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// openNull is openText for a nullable column.
+func (s *Store) openNull(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	text, err := s.openText(v)
+	return sql.NullString{String: text, Valid: err == nil}, err
+}
+
+// openInt decodes an integer column scanned into an any.
+func (s *Store) openInt(v any) (int, error) {
+	if n, ok := v.(int64); ok {
+		if s.key != nil {
+			return 0, crypt.ErrNotSealed
+		}
+		return int(n), nil
+	}
+	text, err := s.openText(v)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(text)
+}
+
+// column is a sealed column, and whether it holds an integer when plain.
+type column struct {
+	name    string
+	integer bool
+}
+
+// sealedColumns are the columns OpenEncrypted seals, by table.
+var sealedColumns = []struct {
+	table   string
+	columns []column
+}{
+	{"vehicles", []column{{"vehicle", false}, {"registration", false}, {"plan", false}, {"odometer_changes", false}}},
+	{"readings", []column{{"miles", true}}},
+	{"settings", []column{{"currency", false}, {"distance_unit", false}}},
+	{"trash", []column{{"miles", true}, {"vehicle", false}}},
+}
+
+// Convert re-seals the database at path from one key to another, as
+// yamlstore.Convert does a store directory: a nil from encrypts a plain
+// database, a nil to decrypts one, and both set rotates the key. Every
+// owner's rows are converted in one transaction, so the file is never left
+// half-converted, and values already in the target form are skipped. It
+// reports whether anything needed converting, and if so vacuums the file so
+// no free page still holds the old form. A missing file is left alone.
+func Convert(path string, from, to *crypt.Key) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	db, err := Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("convert %s: %w", path, err)
+	}
+	defer tx.Rollback()
+
+	converted := 0
+	for _, t := range sealedColumns {
+		n, err := convertTable(ctx, tx, t.table, t.columns, from, to)
+		if err != nil {
+			return false, fmt.Errorf("convert %s: %s: %w", path, t.table, err)
+		}
+		converted += n
+	}
+	if converted == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("convert %s: %w", path, err)
+	}
+	if _, err := db.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return true, fmt.Errorf("vacuum %s: %w", path, err)
+	}
+	if _, err := db.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return true, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// convertTable re-seals columns in every row of table, returning how many
+// values it rewrote.
+func convertTable(ctx context.Context, tx *sql.Tx, table string, columns []column, from, to *crypt.Key) (int, error) {
+	// The table and column names are our own constants.
+	var names, set []string
+	for _, c := range columns {
+		names = append(names, c.name)
+		set = append(set, c.name+" = ?")
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT rowid, `+strings.Join(names, ", ")+` FROM `+table)
+	if err != nil {
+		return 0, err
+	}
+	type update struct {
+		rowid  int64
+		values []any
+	}
+	var updates []update
+	converted := 0
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := []any{new(int64)}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		changed := false
+		for i, v := range values {
+			out, done, err := resealValue(v, from, to, columns[i].integer)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if done {
+				values[i] = out
+				changed = true
+				converted++
+			}
+		}
+		if changed {
+			updates = append(updates, update{rowid: *dest[0].(*int64), values: values})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, u := range updates {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET `+strings.Join(set, ", ")+` WHERE rowid = ?`, append(u.values, u.rowid)...); err != nil {
+			return 0, err
+		}
+	}
+	return converted, nil
+}
+
+// resealValue converts one stored value from one key to another, reporting
+// whether it needed it. Plain values are read as plain whatever from is, so
+// an encrypt that is rerun with its own key still finds them.
+func resealValue(v any, from, to *crypt.Key, integer bool) (any, bool, error) {
+	raw, _ := v.([]byte)
+	id, sealed := crypt.SealedBy(raw)
+	if v == nil || to == nil && !sealed || to != nil && sealed && id == to.ID() {
+		return v, false, nil
+	}
+	var plain []byte
+	switch v := v.(type) {
+	case int64:
+		plain = []byte(strconv.FormatInt(v, 10))
+	case string:
+		plain = []byte(v)
+	case []byte:
+		if !sealed {
+			plain = v
+			break
+		}
+		var err error
+		if plain, err = crypt.Open(from, v); err != nil {
+			return nil, false, err
+		}
+	default:
+		return nil, false, fmt.Errorf("unexpected %T", v)
+	}
+	if to != nil {
+		out, err := to.Seal(plain)
+		return out, true, err
+	}
+	if integer {
+		n, err := strconv.Atoi(string(plain))
+		return n, true, err
+	}
+	return string(plain), true, nil
+}
@@ -0,0 +1,144 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+)
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func openEncrypted(t *testing.T, path string, key *crypt.Key) *sqlstore.DB {
+	t.Helper()
+	db, err := sqlstore.OpenEncrypted(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLEncryptedConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return openEncrypted(t, filepath.Join(t.TempDir(), sqlstore.FileName), newKey(t)).Local()
+	})
+}
+
+// plaintext returns the queries over the file's data columns that find a
+// value that is not sealed.
+func plaintext(t *testing.T, path string) []string {
+	t.Helper()
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	var plain []string
+	for _, q := range []string{
+		`SELECT vehicle FROM vehicles`, `SELECT registration FROM vehicles`,
+		`SELECT miles FROM readings`, `SELECT currency FROM settings`,
+		`SELECT miles FROM trash`, `SELECT vehicle FROM trash WHERE vehicle IS NOT NULL`,
+	} {
+		rows, err := raw.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var v any
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			if b, ok := v.([]byte); !ok || !crypt.IsSealed(b) {
+				plain = append(plain, q)
+			}
+		}
+		rows.Close()
+	}
+	return plain
+}
+
+func TestSQLConvert(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), sqlstore.FileName)
+	db := open(t, path)
+	st := db.Local()
+	data := &model.VehicleData{Vehicle: "Golf", Registration: "AB12 CDE", Readings: map[string]int{"2025-01-01": 5000, "2025-02-01": 5400}}
+	if err := st.SaveVehicle(ctx, "golf", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ForUser("user-1").SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo", Readings: map[string]int{"2025-01-01": 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveSettings(ctx, &model.Settings{Currency: "EUR", DistanceUnit: "km"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	key := newKey(t)
+	if changed, err := sqlstore.Convert(path, nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	if plain := plaintext(t, path); len(plain) > 0 {
+		t.Fatalf("left in the clear: %v", plain)
+	}
+	if changed, err := sqlstore.Convert(path, key, key); err != nil || changed {
+		t.Fatalf("rerun: %v, %v; want nothing left to do", changed, err)
+	}
+	if _, err := open(t, path).Local().GetVehicle(ctx, "golf"); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+
+	next := newKey(t)
+	if _, err := sqlstore.Convert(path, nil, next); !errors.Is(err, crypt.ErrSealed) {
+		t.Fatalf("rotate without the old key: err = %v, want ErrSealed", err)
+	}
+	if changed, err := sqlstore.Convert(path, key, next); err != nil || !changed {
+		t.Fatalf("rotate: %v, %v", changed, err)
+	}
+	enc := openEncrypted(t, path, next)
+	got, err := enc.Local().GetVehicle(ctx, "golf")
+	if err != nil || got.Registration != "AB12 CDE" || got.Readings["2025-02-01"] != 5400 {
+		t.Fatalf("after rotate: %+v, %v", got, err)
+	}
+	if items, err := enc.Local().ListTrash(ctx); err != nil || len(items) != 1 || items[0].Miles != 5000 {
+		t.Fatalf("trash = %+v, %v", items, err)
+	}
+	if sum, err := enc.ForUser("user-1").ListVehicleSummaries(ctx); err != nil || len(sum) != 1 || sum[0].LastMiles != 10 {
+		t.Fatalf("summaries = %+v, %v", sum, err)
+	}
+
+	if changed, err := sqlstore.Convert(path, next, nil); err != nil || !changed {
+		t.Fatalf("decrypt: %v, %v", changed, err)
+	}
+	plain := open(t, path).Local()
+	if got, err := plain.GetVehicle(ctx, "golf"); err != nil || got.Vehicle != "Golf" {
+		t.Fatalf("after decrypt: %+v, %v", got, err)
+	}
+	if items, err := plain.ListTrash(ctx); err != nil || len(items) != 1 || items[0].Miles != 5000 {
+		t.Fatalf("trash after decrypt = %+v, %v", items, err)
+	}
+	if settings, err := plain.GetSettings(ctx); err != nil || settings.Currency != "EUR" {
+		t.Fatalf("settings after decrypt: %+v, %v", settings, err)
+	}
+	if changed, err := sqlstore.Convert(filepath.Join(t.TempDir(), sqlstore.FileName), nil, key); err != nil || changed {
+		t.Errorf("missing file: %v, %v", changed, err)
+	}
+}
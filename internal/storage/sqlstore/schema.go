@@ -0,0 +1,91 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are the schema changes in order. The database's PRAGMA
+// user_version is the number already applied, so migrate runs only the tail a
+// given file has not seen. Append only: an applied migration is never edited.
+//
+// Every table is keyed by owner first. Readings are rows of their own, tied to
+// their vehicle so a rename carries them and a delete removes them; a plan and
+// odometer changes are small, always read whole, and stay JSON.
+var migrations = []string{
+	`CREATE TABLE vehicles (
+		owner            TEXT NOT NULL,
+		id               TEXT NOT NULL,
+		vehicle          TEXT NOT NULL,
+		registration     TEXT NOT NULL DEFAULT '',
+		plan             TEXT,
+		odometer_changes TEXT,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE TABLE readings (
+		owner      TEXT NOT NULL,
+		vehicle_id TEXT NOT NULL,
+		date       TEXT NOT NULL,
+		miles      INTEGER NOT NULL,
+		PRIMARY KEY (owner, vehicle_id, date),
+		FOREIGN KEY (owner, vehicle_id) REFERENCES vehicles (owner, id)
+			ON UPDATE CASCADE ON DELETE CASCADE
+	);
+	CREATE TABLE current (
+		owner      TEXT PRIMARY KEY,
+		vehicle_id TEXT NOT NULL
+	);
+	CREATE TABLE settings (
+		owner         TEXT PRIMARY KEY,
+		currency      TEXT NOT NULL DEFAULT '',
+		distance_unit TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE trash (
+		owner      TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		vehicle_id TEXT NOT NULL,
+		date       TEXT NOT NULL DEFAULT '',
+		miles      INTEGER NOT NULL DEFAULT 0,
+		vehicle    TEXT,
+		deleted_at INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX trash_deleted_at ON trash (owner, deleted_at);`,
+}
+
+// migrate applies the migrations db has not seen, all in one transaction so a
+// failure leaves the file at its old version. A database from a newer binary
+// is refused rather than written with a schema it does not understand.
+func migrate(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("migrate: read schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("migrate: database schema version %d is newer than this binary supports (%d)", version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migrate: schema version %d: %w", i+1, err)
+		}
+	}
+	// PRAGMA takes no bind parameters; the value is our own integer.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(migrations))); err != nil {
+		return fmt.Errorf("migrate: record schema version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,656 @@
+// Package sqlstore is the SQLite storage backend: a storage.Store for the
+// single-user CLI and server, and a storage.Tenants for hosted mode, both over
+// one database file. Every row carries an owner column — the hosted user id, or
+// "" for the single-user store — and every query is scoped by it, so tenants
+// share tables but never see each other's rows.
+//
+// Observable behaviour matches yamlstore and storage.Memory (the storagetest
+// suites hold all three to it); the difference is that each method is one
+// SQLite transaction, so a crash never leaves a half-written vehicle and the
+// CLI and a running server can write the same file safely.
+//
+// The driver is modernc.org/sqlite, a pure-Go SQLite, so the static
+// CGO_ENABLED=0 binary the container ships has the backend too.
+package sqlstore
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite" // registers "sqlite"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// FileName is the database file's name under a data directory.
+const FileName = "mileminder.db"
+
+// DB is an open database file. It is safe for concurrent use.
+type DB struct {
+	db  *sql.DB
+	key *crypt.Key // nil unless opened with OpenEncrypted
+}
+
+// Open opens the database at path, creating it (0600) and its directory if
+// need be, and migrates it to the current schema.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	// Create the file ourselves so SQLite inherits owner-only permissions.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	f.Close()
+
+	// Foreign keys carry readings along with their vehicle; the busy timeout
+	// and immediate transactions let the CLI and a server share the file.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Local returns the single-user Store. Its owner is "", which ForUser never
+// accepts, so a single-user database could later be served hosted without its
+// rows surfacing under any account.
+func (d *DB) Local() *Store {
+	return &Store{db: d.db, key: d.key}
+}
+
+// ForUser returns the Store scoped to userID. An id that is not
+// storage.ValidUserID yields a Store whose every method fails.
+func (d *DB) ForUser(userID string) storage.Store {
+	if !storage.ValidUserID(userID) {
+		return &Store{err: storage.InvalidUserError(userID)}
+	}
+	return &Store{db: d.db, key: d.key, owner: userID}
+}
+
+// Store is one owner's view of the database.
+type Store struct {
+	db    *sql.DB
+	key   *crypt.Key
+	owner string
+	err   error // set for a malformed user id; every method returns it
+}
+
+// tx runs fn in a transaction, committing if it returns nil.
+func (s *Store) tx(ctx context.Context, fn func(*sql.Tx) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// vehicleRow is the vehicles columns scanned for one vehicle, as stored.
+type vehicleRow struct {
+	vehicle, registration, plan, changes any
+}
+
+// vehicleData decodes the row into a VehicleData with an empty readings map.
+func (s *Store) vehicleData(r vehicleRow) (*model.VehicleData, error) {
+	data := &model.VehicleData{Readings: map[string]int{}}
+	var err error
+	if data.Vehicle, err = s.openText(r.vehicle); err != nil {
+		return nil, fmt.Errorf("decode vehicle: %w", err)
+	}
+	if data.Registration, err = s.openText(r.registration); err != nil {
+		return nil, fmt.Errorf("decode registration: %w", err)
+	}
+	plan, err := s.openNull(r.plan)
+	if err != nil {
+		return nil, fmt.Errorf("decode plan: %w", err)
+	}
+	if plan.Valid {
+		if err := json.Unmarshal([]byte(plan.String), &data.Plan); err != nil {
+			return nil, fmt.Errorf("decode plan: %w", err)
+		}
+	}
+	changes, err := s.openNull(r.changes)
+	if err != nil {
+		return nil, fmt.Errorf("decode odometer changes: %w", err)
+	}
+	if changes.Valid {
+		if err := json.Unmarshal([]byte(changes.String), &data.OdometerChanges); err != nil {
+			return nil, fmt.Errorf("decode odometer changes: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// loadVehicle reads one vehicle with its readings, returning a bare
+// storage.ErrNotFound for the caller to wrap when it does not exist.
+func (s *Store) loadVehicle(ctx context.Context, tx *sql.Tx, id string) (*model.VehicleData, error) {
+	var row vehicleRow
+	err := tx.QueryRowContext(ctx,
+		`SELECT vehicle, registration, plan, odometer_changes FROM vehicles WHERE owner = ? AND id = ?`,
+		s.owner, id).Scan(&row.vehicle, &row.registration, &row.plan, &row.changes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.vehicleData(row)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT date, miles FROM readings WHERE owner = ? AND vehicle_id = ?`, s.owner, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var date string
+		var stored any
+		if err := rows.Scan(&date, &stored); err != nil {
+			return nil, err
+		}
+		miles, err := s.openInt(stored)
+		if err != nil {
+			return nil, fmt.Errorf("decode reading %q: %w", date, err)
+		}
+		data.Readings[date] = miles
+	}
+	return data, rows.Err()
+}
+
+// vehicleExists reports whether id is one of the owner's vehicles.
+func (s *Store) vehicleExists(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+	var one int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM vehicles WHERE owner = ? AND id = ?`, s.owner, id).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// writeVehicle upserts a vehicle and replaces its readings.
+func (s *Store) writeVehicle(ctx context.Context, tx *sql.Tx, id string, data *model.VehicleData) error {
+	var plan, changes sql.NullString
+	if data.Plan != nil {
+		raw, err := json.Marshal(data.Plan)
+		if err != nil {
+			return fmt.Errorf("encode plan: %w", err)
+		}
+		plan = sql.NullString{String: string(raw), Valid: true}
+	}
+	if len(data.OdometerChanges) > 0 {
+		raw, err := json.Marshal(data.OdometerChanges)
+		if err != nil {
+			return fmt.Errorf("encode odometer changes: %w", err)
+		}
+		changes = sql.NullString{String: string(raw), Valid: true}
+	}
+	row, err := s.sealRow(data, plan, changes)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO vehicles (owner, id, vehicle, registration, plan, odometer_changes)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, id) DO UPDATE SET
+			vehicle = excluded.vehicle, registration = excluded.registration,
+			plan = excluded.plan, odometer_changes = excluded.odometer_changes`,
+		s.owner, id, row.vehicle, row.registration, row.plan, row.changes); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM readings WHERE owner = ? AND vehicle_id = ?`, s.owner, id); err != nil {
+		return err
+	}
+	for date, miles := range data.Readings {
+		stored, err := s.sealInt(miles)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO readings (owner, vehicle_id, date, miles) VALUES (?, ?, ?, ?)`,
+			s.owner, id, date, stored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sealRow is writeVehicle's vehicles columns as stored.
+func (s *Store) sealRow(data *model.VehicleData, plan, changes sql.NullString) (vehicleRow, error) {
+	var row vehicleRow
+	var err error
+	if row.vehicle, err = s.sealText(data.Vehicle); err != nil {
+		return row, err
+	}
+	if row.registration, err = s.sealText(data.Registration); err != nil {
+		return row, err
+	}
+	if row.plan, err = s.sealNull(plan); err != nil {
+		return row, err
+	}
+	row.changes, err = s.sealNull(changes)
+	return row, err
+}
+
+// repointCurrent moves the current pointer from one id to another if it was
+// on from.
+func (s *Store) repointCurrent(ctx context.Context, tx *sql.Tx, from, to string) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE current SET vehicle_id = ? WHERE owner = ? AND vehicle_id = ?`, to, s.owner, from)
+	return err
+}
+
+func (s *Store) ListVehicles(ctx context.Context) ([]storage.Record, error) {
+	var records []storage.Record
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id, vehicle, registration, plan, odometer_changes FROM vehicles WHERE owner = ? ORDER BY id`, s.owner)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		byID := map[string]*model.VehicleData{}
+		for rows.Next() {
+			var id string
+			var row vehicleRow
+			if err := rows.Scan(&id, &row.vehicle, &row.registration, &row.plan, &row.changes); err != nil {
+				return err
+			}
+			data, err := s.vehicleData(row)
+			if err != nil {
+				continue // unreadable entries are skipped, as the contract allows
+			}
+			byID[id] = data
+			records = append(records, storage.Record{ID: id, Data: data})
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, `SELECT vehicle_id, date, miles FROM readings WHERE owner = ?`, s.owner)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, date string
+			var stored any
+			if err := rows.Scan(&id, &date, &stored); err != nil {
+				return err
+			}
+			data, ok := byID[id]
+			if !ok {
+				continue
+			}
+			if data.Readings[date], err = s.openInt(stored); err != nil {
+				delete(byID, id) // skipped as unreadable, as above
+				records = slices.DeleteFunc(records, func(r storage.Record) bool { return r.ID == id })
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list vehicles: %w", err)
+	}
+	return records, nil
+}
+
+// ListVehicleSummaries counts each vehicle's readings and finds the latest in
+// the query, so no reading rows leave the database.
+func (s *Store) ListVehicleSummaries(ctx context.Context) ([]storage.VehicleSummary, error) {
+	var summaries []storage.VehicleSummary
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT v.id, v.vehicle, v.registration, v.plan IS NOT NULL,
+				(SELECT COUNT(*) FROM readings r WHERE r.owner = v.owner AND r.vehicle_id = v.id),
+				COALESCE(l.date, ''), l.miles
+			FROM vehicles v
+			LEFT JOIN readings l ON l.owner = v.owner AND l.vehicle_id = v.id AND l.date = (
+				SELECT MAX(date) FROM readings m WHERE m.owner = v.owner AND m.vehicle_id = v.id)
+			WHERE v.owner = ? ORDER BY v.id`, s.owner)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sum storage.VehicleSummary
+			var vehicle, registration, lastMiles any
+			if err := rows.Scan(&sum.ID, &vehicle, &registration, &sum.HasPlan, &sum.Readings, &sum.LastReading, &lastMiles); err != nil {
+				return err
+			}
+			var err error
+			if sum.Vehicle, err = s.openText(vehicle); err != nil {
+				continue // unreadable, as ListVehicles skips it
+			}
+			if sum.Registration, err = s.openText(registration); err != nil {
+				continue
+			}
+			if lastMiles != nil {
+				if sum.LastMiles, err = s.openInt(lastMiles); err != nil {
+					continue
+				}
+			}
+			summaries = append(summaries, sum)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list vehicles: %w", err)
+	}
+	return summaries, nil
+}
+
+func (s *Store) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
+	var data *model.VehicleData
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		var err error
+		data, err = s.loadVehicle(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load vehicle %q: %w", id, err)
+	}
+	return data, nil
+}
+
+func (s *Store) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		return s.writeVehicle(ctx, tx, id, data)
+	})
+	if err != nil {
+		return fmt.Errorf("save vehicle %q: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	var fnErr error
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		data, err := s.loadVehicle(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if fnErr = fn(data); fnErr != nil {
+			return fnErr
+		}
+		return s.writeVehicle(ctx, tx, id, data)
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("update vehicle %q: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteVehicle(ctx context.Context, id string) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		data, err := s.loadVehicle(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.insertTrash(ctx, tx, storage.NewVehicleTrashItem(id, data, time.Now())); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM vehicles WHERE owner = ? AND id = ?`, s.owner, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete vehicle %q: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Store) PutReading(ctx context.Context, id, date string, miles int) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		if ok, err := s.vehicleExists(ctx, tx, id); err != nil || !ok {
+			return cmp.Or(err, storage.ErrNotFound)
+		}
+		stored, err := s.sealInt(miles)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO readings (owner, vehicle_id, date, miles) VALUES (?, ?, ?, ?)
+			ON CONFLICT (owner, vehicle_id, date) DO UPDATE SET miles = excluded.miles`,
+			s.owner, id, date, stored)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("put reading on %q: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteReading(ctx context.Context, id, date string) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		if ok, err := s.vehicleExists(ctx, tx, id); err != nil || !ok {
+			return cmp.Or(err, storage.ErrNotFound)
+		}
+		var stored any
+		err := tx.QueryRowContext(ctx,
+			`SELECT miles FROM readings WHERE owner = ? AND vehicle_id = ? AND date = ?`,
+			s.owner, id, date).Scan(&stored)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("reading %q: %w", date, storage.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		miles, err := s.openInt(stored)
+		if err != nil {
+			return fmt.Errorf("decode reading %q: %w", date, err)
+		}
+		if err := s.insertTrash(ctx, tx, storage.NewReadingTrashItem(id, date, miles, time.Now())); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM readings WHERE owner = ? AND vehicle_id = ? AND date = ?`, s.owner, id, date)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete reading on %q: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Store) GetCurrent(ctx context.Context) (string, error) {
+	var current string
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT vehicle_id FROM current WHERE owner = ?`, s.owner).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("read current pointer: %w", err)
+	}
+	return current, nil
+}
+
+func (s *Store) SetCurrent(ctx context.Context, id string) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		if ok, err := s.vehicleExists(ctx, tx, id); err != nil || !ok {
+			return cmp.Or(err, storage.ErrNotFound)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO current (owner, vehicle_id) VALUES (?, ?)
+			ON CONFLICT (owner) DO UPDATE SET vehicle_id = excluded.vehicle_id`, s.owner, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("set current %q: %w", id, err)
+	}
+	return nil
+}
+
+// GetSettings returns the saved settings with any empty field backfilled from
+// model.DefaultSettings, or the defaults when none are saved.
+func (s *Store) GetSettings(ctx context.Context) (*model.Settings, error) {
+	settings := model.DefaultSettings()
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		var storedCurrency, storedUnit any
+		err := tx.QueryRowContext(ctx,
+			`SELECT currency, distance_unit FROM settings WHERE owner = ?`, s.owner).Scan(&storedCurrency, &storedUnit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		currency, err := s.openText(storedCurrency)
+		if err != nil {
+			return err
+		}
+		unit, err := s.openText(storedUnit)
+		if err != nil {
+			return err
+		}
+		if currency != "" {
+			settings.Currency = currency
+		}
+		if unit != "" {
+			settings.DistanceUnit = unit
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings *model.Settings) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		currency, err := s.sealText(settings.Currency)
+		if err != nil {
+			return err
+		}
+		unit, err := s.sealText(settings.DistanceUnit)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO settings (owner, currency, distance_unit) VALUES (?, ?, ?)
+			ON CONFLICT (owner) DO UPDATE SET
+				currency = excluded.currency, distance_unit = excluded.distance_unit`,
+			s.owner, currency, unit)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("save settings: %w", err)
+	}
+	return nil
+}
+
+// RenameVehicle changes a vehicle's id in place; its readings follow by
+// cascade, and the current pointer follows explicitly.
+func (s *Store) RenameVehicle(ctx context.Context, from, to string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		if ok, err := s.vehicleExists(ctx, tx, from); err != nil || !ok {
+			return fmt.Errorf("rename vehicle %q: %w", from, cmp.Or(err, storage.ErrNotFound))
+		}
+		if !storage.ValidID(to) {
+			return fmt.Errorf("rename vehicle %q: invalid id %q", from, to)
+		}
+		if taken, err := s.vehicleExists(ctx, tx, to); err != nil || taken {
+			return fmt.Errorf("rename vehicle %q to %q: %w", from, to, cmp.Or(err, storage.ErrExists))
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE vehicles SET id = ? WHERE owner = ? AND id = ?`, to, s.owner, from); err != nil {
+			return fmt.Errorf("rename vehicle %q: %w", from, err)
+		}
+		return s.repointCurrent(ctx, tx, from, to)
+	})
+}
+
+func (s *Store) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	if from == into {
+		return readings.Report{}, fmt.Errorf("merge vehicle %q into itself", from)
+	}
+	var report readings.Report
+	var checkErr error
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		src, err := s.loadVehicle(ctx, tx, from)
+		if err != nil {
+			return fmt.Errorf("merge vehicle %q: %w", from, err)
+		}
+		dst, err := s.loadVehicle(ctx, tx, into)
+		if err != nil {
+			return fmt.Errorf("merge into vehicle %q: %w", into, err)
+		}
+		var merged *model.VehicleData
+		merged, report = storage.MergeVehicleData(dst, src, overwrite)
+		if check != nil {
+			if checkErr = check(merged); checkErr != nil {
+				return checkErr
+			}
+		}
+		if err := s.writeVehicle(ctx, tx, into, merged); err != nil {
+			return fmt.Errorf("merge into vehicle %q: %w", into, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM vehicles WHERE owner = ? AND id = ?`, s.owner, from); err != nil {
+			return fmt.Errorf("merge vehicle %q: %w", from, err)
+		}
+		return s.repointCurrent(ctx, tx, from, into)
+	})
+	if checkErr != nil {
+		return readings.Report{}, checkErr
+	}
+	if err != nil {
+		return readings.Report{}, err
+	}
+	return report, nil
+}
+
+// DataVersion is SQLite's data_version for cachestore: it moves whenever
+// another connection — the CLI, doctor, migrate — commits to the file.
+func (s *Store) DataVersion(ctx context.Context) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	var version int64
+	if err := s.db.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&version); err != nil {
+		return "", fmt.Errorf("read data version: %w", err)
+	}
+	return strconv.FormatInt(version, 10), nil
+}
+
+// Compile-time assertions.
+var (
+	_ storage.Store   = (*Store)(nil)
+	_ storage.Tenants = (*DB)(nil)
+)
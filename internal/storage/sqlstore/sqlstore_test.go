@@ -0,0 +1,144 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/sqlstore"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+)
+
+func open(t *testing.T, path string) *sqlstore.DB {
+	t.Helper()
+	db, err := sqlstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newDB(t *testing.T) *sqlstore.DB {
+	return open(t, filepath.Join(t.TempDir(), sqlstore.FileName))
+}
+
+func TestSQLConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return newDB(t).Local()
+	})
+}
+
+func TestSQLTenantsConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return newDB(t).ForUser("user-1")
+	})
+}
+
+func TestSQLTenantsIsolation(t *testing.T) {
+	storagetest.RunTenantIsolation(t, func(t *testing.T) storage.Tenants {
+		return newDB(t)
+	})
+}
+
+func TestSQLTenantsRejectsMalformedUserID(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	for _, id := range []string{"", "..", "a/b", "x' OR '1'='1", strings.Repeat("x", 200)} {
+		st := db.ForUser(id)
+		if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"}); err == nil {
+			t.Fatalf("malformed id %q: SaveVehicle should fail", id)
+		}
+		if _, err := st.ListVehicles(ctx); err == nil {
+			t.Fatalf("malformed id %q: ListVehicles should fail", id)
+		}
+	}
+}
+
+// Data survives a reopen, the local store never sees a user's rows, and a
+// rename carries readings and odometer changes with the vehicle.
+func TestSQLReopenAndRename(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data", sqlstore.FileName)
+	db, err := sqlstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := db.Local()
+	data := &model.VehicleData{
+		Vehicle:         "Golf",
+		Registration:    "AB12 CDE",
+		Readings:        map[string]int{"2025-01-01": 5000, "2025-02-01": 10},
+		OdometerChanges: []model.OdometerChange{{Date: "2025-02-01", OldFinal: 5400, NewStart: 0}},
+	}
+	if err := local.SaveVehicle(ctx, "golf", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ForUser("user-1").SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	local = open(t, path).Local()
+	if err := local.RenameVehicle(ctx, "golf", "gti"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := local.ListVehicles(ctx)
+	if err != nil || len(records) != 1 || records[0].ID != "gti" {
+		t.Fatalf("list after reopen: %v %v", records, err)
+	}
+	got := records[0].Data
+	if len(got.Readings) != 2 || got.Registration != "AB12 CDE" || len(got.OdometerChanges) != 1 {
+		t.Fatalf("renamed vehicle: %+v", got)
+	}
+}
+
+func TestSQLMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sqlstore.FileName)
+	open(t, path).Close()
+
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	var version int
+	if err := raw.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version < 1 {
+		t.Fatalf("schema version %d, %v", version, err)
+	}
+
+	// Reopening an up-to-date file is a no-op; a file from a newer binary is
+	// refused rather than written.
+	open(t, path).Close()
+	if _, err := raw.Exec(`PRAGMA user_version = 999`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlstore.Open(path); err == nil || !strings.Contains(err.Error(), "newer than this binary") {
+		t.Fatalf("newer schema: %v", err)
+	}
+}
+
+// The trash keeps its order and cutoff arithmetic across the integer
+// timestamp column.
+func TestSQLPurgeTrashBefore(t *testing.T) {
+	ctx := context.Background()
+	st := newDB(t).Local()
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 1, "2025-01-02": 2}})
+	st.DeleteReading(ctx, "golf", "2025-01-01")
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+	st.DeleteReading(ctx, "golf", "2025-01-02")
+
+	if n, err := st.PurgeTrashBefore(ctx, cutoff); err != nil || n != 1 {
+		t.Fatalf("purged %d, %v", n, err)
+	}
+	items, _ := st.ListTrash(ctx)
+	if len(items) != 1 || items[0].Date != "2025-01-02" {
+		t.Fatalf("trash: %+v", items)
+	}
+}
@@ -0,0 +1,179 @@
+package sqlstore
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// insertTrash records a soft-deleted item. deleted_at is Unix nanoseconds so
+// it orders and compares as a number.
+func (s *Store) insertTrash(ctx context.Context, tx *sql.Tx, item storage.TrashItem) error {
+	var vehicle sql.NullString
+	if item.Vehicle != nil {
+		raw, err := json.Marshal(item.Vehicle)
+		if err != nil {
+			return fmt.Errorf("encode trash item: %w", err)
+		}
+		vehicle = sql.NullString{String: string(raw), Valid: true}
+	}
+	storedVehicle, err := s.sealNull(vehicle)
+	if err != nil {
+		return err
+	}
+	miles, err := s.sealInt(item.Miles)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO trash (owner, id, kind, vehicle_id, date, miles, vehicle, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.owner, item.ID, item.Kind, item.VehicleID, item.Date, miles, storedVehicle, item.DeletedAt.UnixNano())
+	return err
+}
+
+const trashColumns = `id, kind, vehicle_id, date, miles, vehicle, deleted_at`
+
+// scanTrash decodes one trash row selected as trashColumns.
+func (s *Store) scanTrash(row interface{ Scan(...any) error }) (storage.TrashItem, error) {
+	var item storage.TrashItem
+	var miles, storedVehicle any
+	var deletedAt int64
+	if err := row.Scan(&item.ID, &item.Kind, &item.VehicleID, &item.Date, &miles, &storedVehicle, &deletedAt); err != nil {
+		return item, err
+	}
+	var err error
+	if item.Miles, err = s.openInt(miles); err != nil {
+		return item, fmt.Errorf("decode trash item %q: %w", item.ID, err)
+	}
+	vehicle, err := s.openNull(storedVehicle)
+	if err != nil {
+		return item, fmt.Errorf("decode trash item %q: %w", item.ID, err)
+	}
+	if vehicle.Valid {
+		if err := json.Unmarshal([]byte(vehicle.String), &item.Vehicle); err != nil {
+			return item, fmt.Errorf("decode trash item %q: %w", item.ID, err)
+		}
+	}
+	item.DeletedAt = time.Unix(0, deletedAt).UTC()
+	return item, nil
+}
+
+func (s *Store) ListTrash(ctx context.Context) ([]storage.TrashItem, error) {
+	var items []storage.TrashItem
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT `+trashColumns+` FROM trash WHERE owner = ? ORDER BY deleted_at DESC, id`, s.owner)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			item, err := s.scanTrash(rows)
+			if err != nil {
+				continue // an unreadable item is skipped, as ListVehicles does
+			}
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list trash: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) RestoreTrash(ctx context.Context, itemID string) (*storage.TrashItem, error) {
+	var item storage.TrashItem
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		var err error
+		item, err = s.scanTrash(tx.QueryRowContext(ctx,
+			`SELECT `+trashColumns+` FROM trash WHERE owner = ? AND id = ?`, s.owner, itemID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("restore %q: %w", itemID, storage.ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("restore %q: %w", itemID, err)
+		}
+		switch item.Kind {
+		case storage.TrashVehicle:
+			if taken, err := s.vehicleExists(ctx, tx, item.VehicleID); err != nil || taken {
+				return fmt.Errorf("restore vehicle %q: %w", item.VehicleID, cmp.Or(err, storage.ErrExists))
+			}
+			if err := s.writeVehicle(ctx, tx, item.VehicleID, item.Vehicle); err != nil {
+				return fmt.Errorf("restore vehicle %q: %w", item.VehicleID, err)
+			}
+		case storage.TrashReading:
+			if ok, err := s.vehicleExists(ctx, tx, item.VehicleID); err != nil || !ok {
+				return fmt.Errorf("restore reading on %q: %w", item.VehicleID, cmp.Or(err, storage.ErrNotFound))
+			}
+			var one int
+			err := tx.QueryRowContext(ctx,
+				`SELECT 1 FROM readings WHERE owner = ? AND vehicle_id = ? AND date = ?`,
+				s.owner, item.VehicleID, item.Date).Scan(&one)
+			if err == nil {
+				return fmt.Errorf("restore reading %q on %q: %w", item.Date, item.VehicleID, storage.ErrExists)
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("restore reading on %q: %w", item.VehicleID, err)
+			}
+			miles, err := s.sealInt(item.Miles)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO readings (owner, vehicle_id, date, miles) VALUES (?, ?, ?, ?)`,
+				s.owner, item.VehicleID, item.Date, miles); err != nil {
+				return fmt.Errorf("restore reading on %q: %w", item.VehicleID, err)
+			}
+		default:
+			return fmt.Errorf("restore %q: unknown kind %q", itemID, item.Kind)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM trash WHERE owner = ? AND id = ?`, s.owner, itemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Store) PurgeTrash(ctx context.Context, itemID string) error {
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM trash WHERE owner = ? AND id = ?`, s.owner, itemID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return cmp.Or(err, storage.ErrNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("purge %q: %w", itemID, err)
+	}
+	return nil
+}
+
+func (s *Store) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged int64
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM trash WHERE owner = ? AND deleted_at < ?`, s.owner, cutoff.UnixNano())
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purge trash: %w", err)
+	}
+	return int(purged), nil
+}
@@ -41,8 +41,10 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
 )
 
 // ErrNotFound is returned when a vehicle, or a reading within a vehicle, does not
@@ -52,6 +54,10 @@ import (
 // sentinels buys nothing — the wrap message carries the detail.
 var ErrNotFound = errors.New("not found")
 
+// ErrExists is returned by RenameVehicle when the target id is already taken.
+// Renaming never overwrites; combining two vehicles is MergeVehicle's job.
+var ErrExists = errors.New("already exists")
+
 // Record pairs a vehicle id (today: the YAML filename stem) with its data.
 type Record struct {
 	ID   string
@@ -64,14 +70,16 @@ type Store interface {
 	// ListVehicles returns every vehicle. Entries that cannot be read or parsed
 	// are skipped rather than failing the whole call.
 	//
-	// It returns full vehicle documents because today's only listing consumers
-	// (the API vehicle-list and fleet handlers, the CLI cars/fleet commands)
-	// immediately load every vehicle anyway. This over-fetches for a plain id/name
-	// listing under a future SQL backend; if that cost ever matters, a lightweight
-	// summary variant (e.g. ListVehicleSummaries) can be added alongside this
-	// method without touching existing callers.
+	// It returns full vehicle documents, for callers that go on to compute
+	// every vehicle's status; a plain listing uses ListVehicleSummaries.
 	ListVehicles(ctx context.Context) ([]Record, error)
 
+	// ListVehicleSummaries returns a VehicleSummary of every vehicle, ordered
+	// and skipping unreadable entries as ListVehicles does. A backend that
+	// keeps readings apart from the document (SQL) answers it without loading
+	// them.
+	ListVehicleSummaries(ctx context.Context) ([]VehicleSummary, error)
+
 	// GetVehicle returns one vehicle by id, or ErrNotFound if it does not exist.
 	GetVehicle(ctx context.Context, id string) (*model.VehicleData, error)
 
@@ -81,7 +89,17 @@ type Store interface {
 	// guard with a prior GetVehicle/ErrNotFound check.
 	SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error
 
-	// DeleteVehicle removes a vehicle, or returns ErrNotFound if it does not exist.
+	// UpdateVehicle reads vehicle id, hands a copy to fn to change and saves
+	// the result, all under the Store's write lock, so a caller's
+	// read-check-write (a monotonic check before adding a reading, say)
+	// cannot lose a change another writer makes in between. It returns
+	// ErrNotFound if the vehicle does not exist, and fn's error as it is,
+	// saving nothing, if fn fails. fn must not use the Store.
+	UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error
+
+	// DeleteVehicle removes a vehicle, or returns ErrNotFound if it does not
+	// exist. The document moves to the trash (see TrashItem) rather than being
+	// destroyed, so the deletion can be undone with RestoreTrash.
 	DeleteVehicle(ctx context.Context, id string) error
 
 	// PutReading upserts a single odometer reading on a vehicle, returning
@@ -92,7 +110,8 @@ type Store interface {
 	PutReading(ctx context.Context, id, date string, miles int) error
 
 	// DeleteReading removes one reading by date, returning ErrNotFound if either
-	// the vehicle or that reading does not exist.
+	// the vehicle or that reading does not exist. Like DeleteVehicle it moves
+	// the reading to the trash.
 	DeleteReading(ctx context.Context, id, date string) error
 
 	// GetCurrent returns the default vehicle id, or "" with a nil error when no
@@ -114,4 +133,38 @@ type Store interface {
 	// SaveSettings replaces the user-level preferences document. Validation
 	// (e.g. supported currencies) is the caller's job; the Store only persists.
 	SaveSettings(ctx context.Context, s *model.Settings) error
+
+	// RenameVehicle moves a vehicle to a new id, carrying its whole document
+	// and, if it was the default, the current pointer. It returns ErrNotFound
+	// if from does not exist and ErrExists if to does; to must satisfy ValidID.
+	// The move is one operation under the Store's lock, not a caller-side
+	// Save+Delete, so no reader sees the vehicle under both ids or neither.
+	RenameVehicle(ctx context.Context, from, to string) error
+
+	// MergeVehicle folds vehicle from into vehicle into (see MergeVehicleData
+	// for the rule), deletes from, and repoints the current pointer at into if
+	// it referenced from. It returns the readings.Merge report, ErrNotFound if
+	// either vehicle is missing, and an error if from and into are the same.
+	// check, if not nil, validates the merged document (e.g. a monotonic
+	// odometer) under the same lock as the write: its error is returned as-is
+	// and nothing is saved. check must not use the Store.
+	MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error)
+
+	// ListTrash returns every soft-deleted item, most recently deleted first.
+	ListTrash(ctx context.Context) ([]TrashItem, error)
+
+	// RestoreTrash puts a trashed item back and removes it from the trash,
+	// returning the restored item. It returns ErrNotFound if the item does not
+	// exist or, for a reading, if its vehicle no longer does; and ErrExists if
+	// the vehicle id, or the reading's date, has been reused since — restoring
+	// never overwrites live data.
+	RestoreTrash(ctx context.Context, itemID string) (*TrashItem, error)
+
+	// PurgeTrash permanently deletes one trashed item, or returns ErrNotFound.
+	PurgeTrash(ctx context.Context, itemID string) error
+
+	// PurgeTrashBefore permanently deletes every item deleted before cutoff and
+	// reports how many went. It is the retention sweep: callers pass now minus
+	// the retention window.
+	PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error)
 }
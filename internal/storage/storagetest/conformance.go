@@ -167,6 +167,33 @@ func RunConformance(t *testing.T, newStore func(t *testing.T) storage.Store) {
 		}
 	})
 
+	t.Run("ListVehicleSummaries", func(t *testing.T) {
+		st := newStore(t)
+		if got, err := st.ListVehicleSummaries(ctx); err != nil || len(got) != 0 {
+			t.Fatalf("empty list: got %v err %v", got, err)
+		}
+		golf := sampleVehicle("Golf")
+		golf.Registration = "AB12 CDE"
+		golf.Readings["2025-03-01"] = 5600
+		if err := st.SaveVehicle(ctx, "golf", golf); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "bare", &model.VehicleData{Vehicle: "Bare", Readings: map[string]int{}}); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		got, err := st.ListVehicleSummaries(ctx)
+		if err != nil {
+			t.Fatalf("ListVehicleSummaries: %v", err)
+		}
+		want := []storage.VehicleSummary{
+			{ID: "bare", Vehicle: "Bare"},
+			{ID: "golf", Vehicle: "Golf", Registration: "AB12 CDE", HasPlan: true, Readings: 2, LastReading: "2025-03-01", LastMiles: 5600},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("summaries:\n got %+v\nwant %+v", got, want)
+		}
+	})
+
 	t.Run("PutReading", func(t *testing.T) {
 		st := newStore(t)
 		if err := st.PutReading(ctx, "golf", "2025-06-01", 6000); !errors.Is(err, storage.ErrNotFound) {
@@ -195,6 +222,43 @@ func RunConformance(t *testing.T, newStore func(t *testing.T) storage.Store) {
 		}
 	})
 
+	t.Run("UpdateVehicle", func(t *testing.T) {
+		st := newStore(t)
+		noop := func(*model.VehicleData) error { return nil }
+		if err := st.UpdateVehicle(ctx, "golf", noop); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("UpdateVehicle missing vehicle: want ErrNotFound, got %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "golf", sampleVehicle("Golf")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		refused := errors.New("refused")
+		err := st.UpdateVehicle(ctx, "golf", func(data *model.VehicleData) error {
+			data.Readings["2025-06-01"] = 6000
+			return refused
+		})
+		if !errors.Is(err, refused) {
+			t.Fatalf("UpdateVehicle failing fn: want its error, got %v", err)
+		}
+		if got, _ := st.GetVehicle(ctx, "golf"); len(got.Readings) != 1 {
+			t.Fatalf("failed update was saved: %+v", got.Readings)
+		}
+		err = st.UpdateVehicle(ctx, "golf", func(data *model.VehicleData) error {
+			data.Registration = "AB12 CDE"
+			data.Readings["2025-06-01"] = 6000
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateVehicle: %v", err)
+		}
+		got, err := st.GetVehicle(ctx, "golf")
+		if err != nil {
+			t.Fatalf("GetVehicle: %v", err)
+		}
+		if got.Registration != "AB12 CDE" || got.Readings["2025-06-01"] != 6000 || got.Readings["2025-01-01"] != 5000 {
+			t.Fatalf("update not stored: %+v", got)
+		}
+	})
+
 	t.Run("DeleteReading", func(t *testing.T) {
 		st := newStore(t)
 		if err := st.DeleteReading(ctx, "golf", "2025-01-01"); !errors.Is(err, storage.ErrNotFound) {
@@ -278,4 +342,320 @@ func RunConformance(t *testing.T, newStore func(t *testing.T) storage.Store) {
 			t.Fatalf("current: want \"golf\", got %q err %v", cur, err)
 		}
 	})
+
+	t.Run("RenameVehicle", func(t *testing.T) {
+		st := newStore(t)
+		if err := st.RenameVehicle(ctx, "ghost", "spirit"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("rename missing: want ErrNotFound, got %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "tesla", sampleVehicle("Tesla")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "golf", sampleVehicle("Golf")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SetCurrent(ctx, "tesla"); err != nil {
+			t.Fatalf("SetCurrent: %v", err)
+		}
+		if err := st.RenameVehicle(ctx, "tesla", "golf"); !errors.Is(err, storage.ErrExists) {
+			t.Fatalf("rename onto existing: want ErrExists, got %v", err)
+		}
+		if err := st.RenameVehicle(ctx, "tesla", "../escape"); err == nil {
+			t.Fatal("rename to invalid id: want error")
+		}
+
+		if err := st.RenameVehicle(ctx, "tesla", "model3"); err != nil {
+			t.Fatalf("RenameVehicle: %v", err)
+		}
+		if _, err := st.GetVehicle(ctx, "tesla"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("old id after rename: want ErrNotFound, got %v", err)
+		}
+		got, err := st.GetVehicle(ctx, "model3")
+		if err != nil {
+			t.Fatalf("GetVehicle new id: %v", err)
+		}
+		if got.Vehicle != "Tesla" || got.Readings["2025-01-01"] != 5000 {
+			t.Fatalf("renamed vehicle lost data: %+v", got)
+		}
+		if cur, _ := st.GetCurrent(ctx); cur != "model3" {
+			t.Fatalf("current after rename: want \"model3\", got %q", cur)
+		}
+
+		// Renaming a non-default vehicle leaves the pointer alone.
+		if err := st.RenameVehicle(ctx, "golf", "polo"); err != nil {
+			t.Fatalf("RenameVehicle: %v", err)
+		}
+		if cur, _ := st.GetCurrent(ctx); cur != "model3" {
+			t.Fatalf("current moved by unrelated rename: got %q", cur)
+		}
+	})
+
+	t.Run("MergeVehicle", func(t *testing.T) {
+		st := newStore(t)
+		phone := &model.VehicleData{
+			Vehicle:      "Tesla",
+			Registration: "AB12 CDE",
+			Readings:     map[string]int{"2025-01-01": 5000, "2025-02-01": 5800, "2025-03-01": 6500},
+		}
+		cli := sampleVehicle("Model 3")
+		cli.Readings["2025-02-01"] = 5900
+		cli.Readings["2025-04-01"] = 7200
+		if err := st.SaveVehicle(ctx, "tesla", phone); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "model3", cli); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SetCurrent(ctx, "tesla"); err != nil {
+			t.Fatalf("SetCurrent: %v", err)
+		}
+
+		if _, err := st.MergeVehicle(ctx, "ghost", "model3", false, nil); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("merge missing source: want ErrNotFound, got %v", err)
+		}
+		if _, err := st.MergeVehicle(ctx, "tesla", "ghost", false, nil); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("merge into missing: want ErrNotFound, got %v", err)
+		}
+		if _, err := st.MergeVehicle(ctx, "tesla", "tesla", false, nil); err == nil {
+			t.Fatal("merge into itself: want error")
+		}
+		refused := errors.New("refused")
+		var checked *model.VehicleData
+		if _, err := st.MergeVehicle(ctx, "tesla", "model3", false, func(merged *model.VehicleData) error {
+			checked = merged
+			return refused
+		}); err != refused {
+			t.Fatalf("merge refused by check: want the check's error as-is, got %v", err)
+		}
+		if checked == nil || len(checked.Readings) != 4 {
+			t.Fatalf("check saw %+v, want the merged document", checked)
+		}
+		if _, err := st.GetVehicle(ctx, "tesla"); err != nil {
+			t.Fatalf("failed merges must leave the source intact: %v", err)
+		}
+		if got, _ := st.GetVehicle(ctx, "model3"); len(got.Readings) != 3 {
+			t.Fatalf("a refused merge wrote the target: %v", got.Readings)
+		}
+
+		report, err := st.MergeVehicle(ctx, "tesla", "model3", false, nil)
+		if err != nil {
+			t.Fatalf("MergeVehicle: %v", err)
+		}
+		if report.Added != 1 || report.Skipped != 2 || report.Overwritten != 0 {
+			t.Fatalf("report: got %+v, want 1 added, 2 skipped", report)
+		}
+		if _, err := st.GetVehicle(ctx, "tesla"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("source after merge: want ErrNotFound, got %v", err)
+		}
+		got, err := st.GetVehicle(ctx, "model3")
+		if err != nil {
+			t.Fatalf("GetVehicle: %v", err)
+		}
+		want := map[string]int{"2025-01-01": 5000, "2025-02-01": 5900, "2025-03-01": 6500, "2025-04-01": 7200}
+		if !reflect.DeepEqual(got.Readings, want) {
+			t.Fatalf("merged readings: got %v want %v", got.Readings, want)
+		}
+		if got.Vehicle != "Model 3" || got.Plan == nil || got.Registration != "AB12 CDE" {
+			t.Fatalf("merged document: want target's name and plan plus source's registration, got %+v", got)
+		}
+		if cur, _ := st.GetCurrent(ctx); cur != "model3" {
+			t.Fatalf("current after merge: want \"model3\", got %q", cur)
+		}
+	})
+
+	t.Run("MergeVehicleOverwrite", func(t *testing.T) {
+		st := newStore(t)
+		src := sampleVehicle("A")
+		src.Readings["2025-02-01"] = 6000
+		dst := sampleVehicle("B")
+		dst.Readings["2025-02-01"] = 5900
+		if err := st.SaveVehicle(ctx, "a", src); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "b", dst); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		report, err := st.MergeVehicle(ctx, "a", "b", true, nil)
+		if err != nil {
+			t.Fatalf("MergeVehicle: %v", err)
+		}
+		if report.Overwritten != 1 {
+			t.Fatalf("report: got %+v, want 1 overwritten", report)
+		}
+		got, _ := st.GetVehicle(ctx, "b")
+		if got.Readings["2025-02-01"] != 6000 {
+			t.Fatalf("overwrite: want source's 6000, got %d", got.Readings["2025-02-01"])
+		}
+	})
+
+	t.Run("DeleteMovesToTrash", func(t *testing.T) {
+		st := newStore(t)
+		if items, err := st.ListTrash(ctx); err != nil || len(items) != 0 {
+			t.Fatalf("empty trash: got %v err %v", items, err)
+		}
+		v := sampleVehicle("Golf")
+		v.Readings["2025-02-01"] = 5500
+		if err := st.SaveVehicle(ctx, "golf", v); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.DeleteReading(ctx, "golf", "2025-02-01"); err != nil {
+			t.Fatalf("DeleteReading: %v", err)
+		}
+		if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+			t.Fatalf("DeleteVehicle: %v", err)
+		}
+
+		items, err := st.ListTrash(ctx)
+		if err != nil || len(items) != 2 {
+			t.Fatalf("ListTrash: got %+v err %v", items, err)
+		}
+		byKind := map[string]storage.TrashItem{}
+		for _, item := range items {
+			if item.ID == "" || item.DeletedAt.IsZero() {
+				t.Fatalf("trash item missing id or time: %+v", item)
+			}
+			byKind[item.Kind] = item
+		}
+		if r := byKind[storage.TrashReading]; r.VehicleID != "golf" || r.Date != "2025-02-01" || r.Miles != 5500 {
+			t.Fatalf("reading item: %+v", r)
+		}
+		veh := byKind[storage.TrashVehicle]
+		if veh.VehicleID != "golf" || veh.Vehicle == nil || veh.Vehicle.Vehicle != "Golf" || veh.Vehicle.Plan == nil {
+			t.Fatalf("vehicle item: %+v", veh)
+		}
+		if _, ok := veh.Vehicle.Readings["2025-02-01"]; ok {
+			t.Fatal("vehicle item should hold the document as deleted, without the earlier-deleted reading")
+		}
+	})
+
+	t.Run("RestoreTrash", func(t *testing.T) {
+		st := newStore(t)
+		if _, err := st.RestoreTrash(ctx, "0123abcd"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("restore missing item: want ErrNotFound, got %v", err)
+		}
+		if _, err := st.RestoreTrash(ctx, "../golf"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("restore malformed item id: want ErrNotFound, got %v", err)
+		}
+		if err := st.SaveVehicle(ctx, "golf", sampleVehicle("Golf")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+			t.Fatalf("DeleteVehicle: %v", err)
+		}
+		items, _ := st.ListTrash(ctx)
+		if len(items) != 1 {
+			t.Fatalf("trash: %+v", items)
+		}
+
+		// The id was reused in the meantime: restoring must not clobber it.
+		if err := st.SaveVehicle(ctx, "golf", sampleVehicle("New Golf")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if _, err := st.RestoreTrash(ctx, items[0].ID); !errors.Is(err, storage.ErrExists) {
+			t.Fatalf("restore onto reused id: want ErrExists, got %v", err)
+		}
+		if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+			t.Fatalf("DeleteVehicle: %v", err)
+		}
+
+		restored, err := st.RestoreTrash(ctx, items[0].ID)
+		if err != nil {
+			t.Fatalf("RestoreTrash: %v", err)
+		}
+		if restored.Kind != storage.TrashVehicle || restored.VehicleID != "golf" {
+			t.Fatalf("restored item: %+v", restored)
+		}
+		got, err := st.GetVehicle(ctx, "golf")
+		if err != nil || got.Vehicle != "Golf" || got.Readings["2025-01-01"] != 5000 {
+			t.Fatalf("restored vehicle: %+v err %v", got, err)
+		}
+		left, _ := st.ListTrash(ctx)
+		if len(left) != 1 || left[0].Vehicle.Vehicle != "New Golf" {
+			t.Fatalf("trash after restore: want only the second deletion, got %+v", left)
+		}
+	})
+
+	t.Run("RestoreTrashReading", func(t *testing.T) {
+		st := newStore(t)
+		if err := st.SaveVehicle(ctx, "golf", sampleVehicle("Golf")); err != nil {
+			t.Fatalf("SaveVehicle: %v", err)
+		}
+		if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+			t.Fatalf("DeleteReading: %v", err)
+		}
+		items, _ := st.ListTrash(ctx)
+		if len(items) != 1 {
+			t.Fatalf("trash: %+v", items)
+		}
+
+		if err := st.PutReading(ctx, "golf", "2025-01-01", 5001); err != nil {
+			t.Fatalf("PutReading: %v", err)
+		}
+		if _, err := st.RestoreTrash(ctx, items[0].ID); !errors.Is(err, storage.ErrExists) {
+			t.Fatalf("restore onto re-entered date: want ErrExists, got %v", err)
+		}
+		if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+			t.Fatalf("DeleteReading: %v", err)
+		}
+		if _, err := st.RestoreTrash(ctx, items[0].ID); err != nil {
+			t.Fatalf("RestoreTrash: %v", err)
+		}
+		got, _ := st.GetVehicle(ctx, "golf")
+		if got.Readings["2025-01-01"] != 5000 {
+			t.Fatalf("restored reading: got %v", got.Readings)
+		}
+
+		// A reading whose vehicle is gone has nowhere to go back to.
+		if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+			t.Fatalf("DeleteReading: %v", err)
+		}
+		if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+			t.Fatalf("DeleteVehicle: %v", err)
+		}
+		items, _ = st.ListTrash(ctx)
+		for _, item := range items {
+			if item.Kind != storage.TrashReading {
+				continue
+			}
+			if _, err := st.RestoreTrash(ctx, item.ID); !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("restore reading of deleted vehicle: want ErrNotFound, got %v", err)
+			}
+		}
+	})
+
+	t.Run("PurgeTrash", func(t *testing.T) {
+		st := newStore(t)
+		for _, id := range []string{"a", "b", "c"} {
+			if err := st.SaveVehicle(ctx, id, sampleVehicle(id)); err != nil {
+				t.Fatalf("SaveVehicle: %v", err)
+			}
+			if err := st.DeleteVehicle(ctx, id); err != nil {
+				t.Fatalf("DeleteVehicle: %v", err)
+			}
+		}
+		items, _ := st.ListTrash(ctx)
+		if len(items) != 3 {
+			t.Fatalf("trash: %+v", items)
+		}
+		if err := st.PurgeTrash(ctx, items[0].ID); err != nil {
+			t.Fatalf("PurgeTrash: %v", err)
+		}
+		if err := st.PurgeTrash(ctx, items[0].ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("purge twice: want ErrNotFound, got %v", err)
+		}
+		if _, err := st.RestoreTrash(ctx, items[0].ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("restore purged: want ErrNotFound, got %v", err)
+		}
+
+		// Nothing was deleted an hour ago, so that cutoff keeps everything.
+		if n, err := st.PurgeTrashBefore(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+			t.Fatalf("PurgeTrashBefore past cutoff: got %d err %v", n, err)
+		}
+		if n, err := st.PurgeTrashBefore(ctx, time.Now().Add(time.Minute)); err != nil || n != 2 {
+			t.Fatalf("PurgeTrashBefore: want 2 purged, got %d err %v", n, err)
+		}
+		if left, _ := st.ListTrash(ctx); len(left) != 0 {
+			t.Fatalf("trash after purge: %+v", left)
+		}
+	})
 }
@@ -0,0 +1,35 @@
+package storage
+
+import "github.com/jackiabishop/mileminder/internal/model"
+
+// VehicleSummary is what a vehicle list shows: a vehicle's names and the
+// shape of its readings, without the readings themselves.
+type VehicleSummary struct {
+	ID           string `json:"id"`
+	Vehicle      string `json:"vehicle"`
+	Registration string `json:"registration,omitempty"`
+	HasPlan      bool   `json:"has_plan"`
+	// Readings is how many readings the vehicle has; LastReading and
+	// LastMiles are the latest by date, "" and 0 when there are none.
+	Readings    int    `json:"readings"`
+	LastReading string `json:"last_reading,omitempty"`
+	LastMiles   int    `json:"last_miles,omitempty"`
+}
+
+// Summarize builds id's VehicleSummary from its full document, for Stores
+// that hold documents whole.
+func Summarize(id string, data *model.VehicleData) VehicleSummary {
+	s := VehicleSummary{
+		ID:           id,
+		Vehicle:      data.Vehicle,
+		Registration: data.Registration,
+		HasPlan:      data.Plan != nil,
+		Readings:     len(data.Readings),
+	}
+	for date, miles := range data.Readings {
+		if date > s.LastReading {
+			s.LastReading, s.LastMiles = date, miles
+		}
+	}
+	return s
+}
@@ -1,6 +1,14 @@
 package storage
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+)
 
 // Tenants hands out per-user scoped Stores. It is Phase 2's ownership seam: in
 // hosted mode the authenticated middleware resolves a user id from the session
@@ -20,6 +28,12 @@ type Tenants interface {
 	ForUser(userID string) Store
 }
 
+// LocalOwner is the owner key for records kept per owner outside a Store —
+// calendar and ingestion tokens, connected-car links — in a single-user
+// install, which has no user ids. Hosted user ids are hex, so it never
+// collides with one.
+const LocalOwner = "local"
+
 // MemoryTenants is an in-memory Tenants for multi-tenant tests. Each userID gets
 // its own lazily-created Memory store, so writes under one user cannot be
 // observed through another user's Store. It mirrors what yamlstore.Tenants does
@@ -47,5 +61,48 @@ func (t *MemoryTenants) ForUser(userID string) Store {
 	return st
 }
 
-// Compile-time assertion that MemoryTenants satisfies Tenants.
-var _ Tenants = (*MemoryTenants)(nil)
+// InvalidUserError is the error a Tenants fails with for a user id that is not
+// ValidUserID.
+func InvalidUserError(id string) error {
+	return fmt.Errorf("invalid user id %q", id)
+}
+
+// ErrStore is a Store that fails every operation with Err. A Tenants returns
+// one for a malformed user id, so a traversal-shaped id can never resolve to
+// a real directory.
+type ErrStore struct {
+	Err error
+}
+
+func (e ErrStore) ListVehicles(context.Context) ([]Record, error) { return nil, e.Err }
+func (e ErrStore) ListVehicleSummaries(context.Context) ([]VehicleSummary, error) {
+	return nil, e.Err
+}
+func (e ErrStore) GetVehicle(context.Context, string) (*model.VehicleData, error) {
+	return nil, e.Err
+}
+func (e ErrStore) SaveVehicle(context.Context, string, *model.VehicleData) error { return e.Err }
+func (e ErrStore) UpdateVehicle(context.Context, string, func(*model.VehicleData) error) error {
+	return e.Err
+}
+func (e ErrStore) DeleteVehicle(context.Context, string) error           { return e.Err }
+func (e ErrStore) PutReading(context.Context, string, string, int) error { return e.Err }
+func (e ErrStore) DeleteReading(context.Context, string, string) error   { return e.Err }
+func (e ErrStore) GetCurrent(context.Context) (string, error)            { return "", e.Err }
+func (e ErrStore) SetCurrent(context.Context, string) error              { return e.Err }
+func (e ErrStore) GetSettings(context.Context) (*model.Settings, error)  { return nil, e.Err }
+func (e ErrStore) SaveSettings(context.Context, *model.Settings) error   { return e.Err }
+func (e ErrStore) RenameVehicle(context.Context, string, string) error   { return e.Err }
+func (e ErrStore) MergeVehicle(context.Context, string, string, bool, func(*model.VehicleData) error) (readings.Report, error) {
+	return readings.Report{}, e.Err
+}
+func (e ErrStore) ListTrash(context.Context) ([]TrashItem, error)           { return nil, e.Err }
+func (e ErrStore) RestoreTrash(context.Context, string) (*TrashItem, error) { return nil, e.Err }
+func (e ErrStore) PurgeTrash(context.Context, string) error                 { return e.Err }
+func (e ErrStore) PurgeTrashBefore(context.Context, time.Time) (int, error) { return 0, e.Err }
+
+// Compile-time assertions.
+var (
+	_ Tenants = (*MemoryTenants)(nil)
+	_ Store   = ErrStore{}
+)
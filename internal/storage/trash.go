@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+)
+
+// Trash item kinds.
+const (
+	TrashVehicle = "vehicle"
+	TrashReading = "reading"
+)
+
+// TrashItem is one soft-deleted vehicle or reading. DeleteVehicle and
+// DeleteReading move what they remove into the trash, where it stays — listed
+// and restorable — until it is purged explicitly or by the retention sweep.
+//
+// A vehicle item carries the whole document as it was when deleted; a reading
+// item carries the one date and value. Items are independent: deleting a
+// reading and then its vehicle leaves two items, and restoring the vehicle
+// does not bring the reading back with it.
+type TrashItem struct {
+	// ID identifies the item within its Store's trash. It is random hex, so
+	// it is safe to use in a file name or URL.
+	ID        string             `yaml:"id" json:"id"`
+	Kind      string             `yaml:"kind" json:"kind"`
+	VehicleID string             `yaml:"vehicle_id" json:"vehicle_id"`
+	Date      string             `yaml:"date,omitempty" json:"date,omitempty"`
+	Miles     int                `yaml:"miles,omitempty" json:"miles,omitempty"`
+	Vehicle   *model.VehicleData `yaml:"vehicle,omitempty" json:"vehicle,omitempty"`
+	DeletedAt time.Time          `yaml:"deleted_at" json:"deleted_at"`
+}
+
+// newTrashID returns a fresh random item id.
+func newTrashID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// NewVehicleTrashItem builds the trash item for a vehicle deleted now.
+func NewVehicleTrashItem(id string, data *model.VehicleData, now time.Time) TrashItem {
+	return TrashItem{ID: newTrashID(), Kind: TrashVehicle, VehicleID: id, Vehicle: CloneVehicle(data), DeletedAt: now.UTC()}
+}
+
+// NewReadingTrashItem builds the trash item for a reading deleted now.
+func NewReadingTrashItem(id, date string, miles int, now time.Time) TrashItem {
+	return TrashItem{ID: newTrashID(), Kind: TrashReading, VehicleID: id, Date: date, Miles: miles, DeletedAt: now.UTC()}
+}
+
+// SortTrash orders items most recently deleted first, as ListTrash returns
+// them, breaking ties by id so the order is stable.
+func SortTrash(items []TrashItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.After(items[j].DeletedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+}
+
+// CloneTrashItem deep-copies an item's vehicle document, as CloneVehicle does
+// for vehicles.
+func CloneTrashItem(item TrashItem) TrashItem {
+	if item.Vehicle != nil {
+		item.Vehicle = CloneVehicle(item.Vehicle)
+	}
+	return item
+}
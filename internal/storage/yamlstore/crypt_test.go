@@ -0,0 +1,128 @@
+package yamlstore_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptedStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Store {
+		return yamlstore.NewEncrypted(t.TempDir(), newKey(t))
+	})
+}
+
+func TestEncryptedStoreSealsFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	key := newKey(t)
+	st := yamlstore.NewEncrypted(dir, key)
+	if err := st.SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteReading(ctx, "golf", "2025-01-01"); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(t, dir, key, true)
+
+	if _, err := yamlstore.New(dir).GetVehicle(ctx, "golf"); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+	if _, err := yamlstore.NewEncrypted(dir, newKey(t)).GetVehicle(ctx, "golf"); !errors.Is(err, crypt.ErrWrongKey) {
+		t.Errorf("other key: err = %v, want ErrWrongKey", err)
+	}
+	// A write through the wrong key must not clobber the file.
+	if err := yamlstore.NewEncrypted(dir, newKey(t)).SaveVehicle(ctx, "golf", sample()); err == nil {
+		t.Error("other key overwrote a vehicle")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	plain := yamlstore.New(dir)
+	if err := plain.SaveVehicle(ctx, "golf", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.SaveVehicle(ctx, "polo", sample()); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.SetCurrent(ctx, "golf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.DeleteVehicle(ctx, "polo"); err != nil {
+		t.Fatal(err)
+	}
+
+	key := newKey(t)
+	n, err := yamlstore.Convert(dir, nil, key)
+	if err != nil || n != 3 {
+		t.Fatalf("encrypt: %d files, %v; want golf.yml, current and the trash item", n, err)
+	}
+	assertSealed(t, dir, key, true)
+	if n, err := yamlstore.Convert(dir, nil, key); err != nil || n != 0 {
+		t.Fatalf("rerun: %d files, %v; want nothing left to do", n, err)
+	}
+
+	next := newKey(t)
+	if _, err := yamlstore.Convert(dir, nil, next); !errors.Is(err, crypt.ErrSealed) {
+		t.Fatalf("rotate without the old key: err = %v, want ErrSealed", err)
+	}
+	if n, err := yamlstore.Convert(dir, key, next); err != nil || n != 3 {
+		t.Fatalf("rotate: %d files, %v", n, err)
+	}
+	st := yamlstore.NewEncrypted(dir, next)
+	if cur, err := st.GetCurrent(ctx); err != nil || cur != "golf" {
+		t.Fatalf("current = %q, %v", cur, err)
+	}
+	if items, err := st.ListTrash(ctx); err != nil || len(items) != 1 {
+		t.Fatalf("trash = %+v, %v", items, err)
+	}
+
+	if _, err := yamlstore.Convert(dir, next, nil); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(t, dir, nil, false)
+	if data, err := yamlstore.New(dir).GetVehicle(ctx, "golf"); err != nil || data.Vehicle != sample().Vehicle {
+		t.Fatalf("after decrypt: %+v, %v", data, err)
+	}
+}
+
+// assertSealed checks every store file in dir is sealed with key, or with
+// sealed false that none is.
+func assertSealed(t *testing.T, dir string, key *crypt.Key, sealed bool) {
+	t.Helper()
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	trash, _ := filepath.Glob(filepath.Join(dir, "trash", "*.yml"))
+	paths = append(paths, trash...)
+	paths = append(paths, filepath.Join(dir, "current"))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, ok := crypt.SealedBy(raw)
+		if ok != sealed || sealed && id != key.ID() {
+			t.Errorf("%s: sealed = %v by %s", filepath.Base(path), ok, id)
+		}
+	}
+}
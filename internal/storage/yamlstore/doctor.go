@@ -0,0 +1,99 @@
+package yamlstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QuarantineDir is the subdirectory Quarantine moves unreadable files into.
+// ListVehicles skips directories, so nothing in it is seen as a vehicle.
+const QuarantineDir = "quarantine"
+
+// BadFile is a store file that cannot be read or parsed.
+type BadFile struct {
+	// Name is the file's path relative to the store directory: "<id>.yml",
+	// "settings" or "trash/<item-id>.yml".
+	Name string
+	// VehicleID is the vehicle the file holds, or "" for any other file.
+	VehicleID string
+	Err       error
+}
+
+// Unreadable returns the files ListVehicles, GetSettings and ListTrash cannot
+// read or parse. ListVehicles and ListTrash skip such files rather than fail,
+// so a corrupt vehicle otherwise simply drops out of the fleet.
+func (s *Store) Unreadable(ctx context.Context) ([]BadFile, error) {
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read store dir: %w", err)
+	}
+	var bad []BadFile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yml" {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), ".yml")
+		if _, err := s.readVehicle(id); err != nil {
+			bad = append(bad, BadFile{Name: e.Name(), VehicleID: id, Err: err})
+		}
+	}
+	if _, err := s.readSettings(); err != nil {
+		bad = append(bad, BadFile{Name: settingsFile, Err: err})
+	}
+
+	trash, err := os.ReadDir(filepath.Join(s.dir, trashDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read trash dir: %w", err)
+	}
+	for _, e := range trash {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yml" {
+			continue
+		}
+		if _, err := s.readTrashItem(strings.TrimSuffix(e.Name(), ".yml")); err != nil {
+			bad = append(bad, BadFile{Name: trashDir + "/" + e.Name(), Err: err})
+		}
+	}
+	return bad, nil
+}
+
+// Quarantine moves the store file name, as Unreadable reports it, into
+// QuarantineDir, out of the store's way but kept for hand repair. A file of
+// the same name already quarantined is not overwritten: the newcomer is
+// suffixed with the time.
+func (s *Store) Quarantine(ctx context.Context, name string) (string, error) {
+	if !filepath.IsLocal(name) || strings.HasPrefix(filepath.ToSlash(name), QuarantineDir+"/") {
+		return "", fmt.Errorf("quarantine %q: not a store file", name)
+	}
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	from := filepath.Join(s.dir, name)
+	to := filepath.Join(s.dir, QuarantineDir, name)
+	if _, err := os.Stat(to); err == nil {
+		to += "." + time.Now().UTC().Format("20060102-150405")
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return "", fmt.Errorf("create quarantine dir: %w", err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return "", fmt.Errorf("quarantine %q: %w", name, err)
+	}
+	ownWrites.note(from)
+	return to, nil
+}
@@ -0,0 +1,39 @@
+package yamlstore
+
+import (
+	"github.com/jackiabishop/mileminder/internal/filelock"
+)
+
+// lockRead takes the in-process read lock and a shared lock on the store
+// directory, returning a func that releases both. A store whose directory
+// does not exist yet has nothing to read, so it is not locked. The lock file,
+// filelock.DirFile, is dot-prefixed and so stays out of ListVehicles.
+func (s *Store) lockRead() (func(), error) {
+	s.mu.RLock()
+	l, err := filelock.ReadDir(s.dir)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.RUnlock()
+	}, nil
+}
+
+// lockWrite takes the in-process write lock and the exclusive lock on the
+// store directory, creating the directory so the first write is covered too.
+// Writes by a CLI process and the server are thereby serialised: a
+// read-modify-write in one cannot lose an update made by the other.
+func (s *Store) lockWrite() (func(), error) {
+	s.mu.Lock()
+	l, err := filelock.WriteDir(s.dir)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.Unlock()
+	}, nil
+}
@@ -1,11 +1,9 @@
 package yamlstore
 
 import (
-	"context"
-	"fmt"
 	"path/filepath"
 
-	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/crypt"
 	"github.com/jackiabishop/mileminder/internal/storage"
 )
 
@@ -17,6 +15,7 @@ import (
 // isolated per user for free.
 type Tenants struct {
 	root string
+	key  *crypt.Key
 }
 
 // NewTenants returns a Tenants rooted at root. User directories are created
@@ -25,66 +24,23 @@ func NewTenants(root string) *Tenants {
 	return &Tenants{root: root}
 }
 
+// NewEncryptedTenants returns a Tenants whose user Stores are all encrypted
+// with key, as NewEncrypted.
+func NewEncryptedTenants(root string, key *crypt.Key) *Tenants {
+	return &Tenants{root: root, key: key}
+}
+
 // ForUser returns a Store scoped to userID's directory. User ids are
 // server-generated (crypto-random hex) and therefore path-safe, but ForUser
 // validates the shape anyway as defence against directory traversal: a malformed
 // id yields a Store whose every method fails rather than one that could escape
 // the root.
 func (t *Tenants) ForUser(userID string) storage.Store {
-	if !validUserID(userID) {
-		return errStore{id: userID}
+	if !storage.ValidUserID(userID) {
+		return storage.ErrStore{Err: storage.InvalidUserError(userID)}
 	}
-	return New(filepath.Join(t.root, "users", userID))
-}
-
-// validUserID accepts only non-empty ids of bounded length containing solely
-// [A-Za-z0-9_-]. This excludes path separators, "." and "..", so a validated id
-// cannot escape the users directory when joined.
-func validUserID(id string) bool {
-	if id == "" || len(id) > 128 {
-		return false
-	}
-	for _, r := range id {
-		switch {
-		case r >= 'a' && r <= 'z':
-		case r >= 'A' && r <= 'Z':
-		case r >= '0' && r <= '9':
-		case r == '_' || r == '-':
-		default:
-			return false
-		}
-	}
-	return true
-}
-
-// errStore is a storage.Store that fails every operation with the same error. It
-// is returned for a malformed user id so a traversal-shaped id can never resolve
-// to a real directory.
-type errStore struct {
-	id string
-}
-
-func (e errStore) err() error {
-	return fmt.Errorf("invalid user id %q", e.id)
+	return NewEncrypted(filepath.Join(t.root, "users", userID), t.key)
 }
 
-func (e errStore) ListVehicles(context.Context) ([]storage.Record, error) {
-	return nil, e.err()
-}
-func (e errStore) GetVehicle(context.Context, string) (*model.VehicleData, error) {
-	return nil, e.err()
-}
-func (e errStore) SaveVehicle(context.Context, string, *model.VehicleData) error { return e.err() }
-func (e errStore) DeleteVehicle(context.Context, string) error                   { return e.err() }
-func (e errStore) PutReading(context.Context, string, string, int) error         { return e.err() }
-func (e errStore) DeleteReading(context.Context, string, string) error           { return e.err() }
-func (e errStore) GetCurrent(context.Context) (string, error)                    { return "", e.err() }
-func (e errStore) SetCurrent(context.Context, string) error                      { return e.err() }
-func (e errStore) GetSettings(context.Context) (*model.Settings, error)          { return nil, e.err() }
-func (e errStore) SaveSettings(context.Context, *model.Settings) error           { return e.err() }
-
-// Compile-time assertions.
-var (
-	_ storage.Tenants = (*Tenants)(nil)
-	_ storage.Store   = errStore{}
-)
+// Compile-time assertion.
+var _ storage.Tenants = (*Tenants)(nil)
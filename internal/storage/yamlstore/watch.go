@@ -0,0 +1,235 @@
+package yamlstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher polls when Interval is unset.
+const DefaultWatchInterval = 2 * time.Second
+
+// Change is one store file that changed outside this process.
+type Change struct {
+	// VehicleID is the vehicle whose file changed, or "" when the change is
+	// to the current pointer or the settings.
+	VehicleID string
+	// File is the file's name in the store directory: "<id>.yml", "current"
+	// or "settings".
+	File    string
+	Removed bool
+}
+
+// Watcher notices when another process — typically the CLI beside a running
+// server — changes a store directory, so the server can drop anything it
+// derived from the old contents and tell its clients. It polls: a file whose
+// modification time and size are unchanged is skipped, and one whose content
+// hash is unchanged (a touch, or a rewrite of identical bytes) is not
+// reported. Nor is a change this process made through a Store while the
+// Watcher is open, which its callers already know about.
+type Watcher struct {
+	Interval time.Duration
+	Logger   *log.Logger
+
+	dir       string
+	closeOnce sync.Once
+	mu        sync.Mutex
+	files     map[string]fileState // nil until the first poll
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+}
+
+// NewWatcher returns an open Watcher for the store directory dir. From now
+// until Close, this process's Stores record their writes for it to skip.
+func NewWatcher(dir string) *Watcher {
+	ownWrites.watch()
+	return &Watcher{dir: dir}
+}
+
+// Close stops recording this process's writes for the Watcher.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(ownWrites.unwatch)
+}
+
+// Run polls every Interval until ctx is cancelled, calling fn with each
+// non-empty batch of changes, then closes the Watcher. The first poll only
+// records the starting state.
+func (w *Watcher) Run(ctx context.Context, fn func([]Change)) {
+	defer w.Close()
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changes, err := w.Poll()
+		if err != nil {
+			w.logf("yamlstore: watch %s: %v", w.dir, err)
+		} else if len(changes) > 0 {
+			fn(changes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll compares the directory with the last poll and returns what changed,
+// in file-name order. The first call records the starting state and returns
+// nothing.
+func (w *Watcher) Poll() ([]Change, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read store dir: %w", err)
+	}
+	first := w.files == nil
+	seen := make(map[string]fileState, len(entries))
+	var changes []Change
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !watched(name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir; the next poll sees it gone
+		}
+		prev, known := w.files[name]
+		if known && prev.modTime.Equal(info.ModTime()) && prev.size == info.Size() {
+			seen[name] = prev
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(w.dir, name))
+		if err != nil {
+			continue
+		}
+		state := fileState{modTime: info.ModTime(), size: info.Size(), sum: sha256.Sum256(raw)}
+		seen[name] = state
+		if first || (known && prev.sum == state.sum) || ownWrites.wrote(filepath.Join(w.dir, name), &state.sum) {
+			continue
+		}
+		changes = append(changes, newChange(name, false))
+	}
+	for name := range w.files {
+		if _, ok := seen[name]; !ok && !ownWrites.wrote(filepath.Join(w.dir, name), nil) {
+			changes = append(changes, newChange(name, true))
+		}
+	}
+	w.files = seen
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.File, b.File) })
+	return changes, nil
+}
+
+// DataVersion identifies the directory's contents for cachestore. Every write
+// creates, renames or removes a file in the directory, which moves its
+// modification time, so any process's write changes the version. It is ""
+// while the directory does not exist.
+func (s *Store) DataVersion(ctx context.Context) (string, error) {
+	info, err := os.Stat(s.dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("stat store dir: %w", err)
+	}
+	return strconv.FormatInt(info.ModTime().UnixNano(), 10), nil
+}
+
+// watched reports whether name is a file a Watcher tracks.
+func watched(name string) bool {
+	return name == currentFile || name == settingsFile ||
+		(filepath.Ext(name) == ".yml" && !strings.HasPrefix(name, "."))
+}
+
+func newChange(name string, removed bool) Change {
+	c := Change{File: name, Removed: removed}
+	if id, ok := strings.CutSuffix(name, ".yml"); ok {
+		c.VehicleID = id
+	}
+	return c
+}
+
+func (w *Watcher) logf(format string, args ...any) {
+	logger := w.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
+
+// ownWrites remembers, while any Watcher is open, what this process last left
+// at each path it wrote or removed through a Store, so a Watcher can tell
+// those changes from another process's.
+var ownWrites = &writeLog{}
+
+type writeLog struct {
+	mu       sync.Mutex
+	watchers int
+	sums     map[string]*[sha256.Size]byte // path → content hash, nil once removed
+}
+
+func (l *writeLog) watch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watchers++; l.sums == nil {
+		l.sums = map[string]*[sha256.Size]byte{}
+	}
+}
+
+func (l *writeLog) unwatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watchers--; l.watchers == 0 {
+		l.sums = nil
+	}
+}
+
+// note records what is now at path. Stores call it under their write lock
+// after changing a file, so no other process can have changed it since.
+func (l *writeLog) note(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watchers == 0 {
+		return
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		l.sums[path] = nil
+		return
+	}
+	sum := sha256.Sum256(raw)
+	l.sums[path] = &sum
+}
+
+// wrote reports whether this process left path with content sum, or removed
+// it when sum is nil.
+func (l *writeLog) wrote(path string, sum *[sha256.Size]byte) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	own, ok := l.sums[path]
+	if !ok {
+		return false
+	}
+	if sum == nil || own == nil {
+		return sum == nil && own == nil
+	}
+	return *own == *sum
+}
@@ -0,0 +1,68 @@
+package yamlstore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+// TestWatcherReportsOnlyOtherWrites asserts a Watcher reports what another
+// process wrote or removed, but not this process's own Store writes or a
+// touch that leaves the content as it was.
+func TestWatcherReportsOnlyOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := yamlstore.New(dir)
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000}})
+
+	w := yamlstore.NewWatcher(dir)
+	defer w.Close()
+	poll := func() []yamlstore.Change {
+		t.Helper()
+		changes, err := w.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changes
+	}
+	if got := poll(); got != nil {
+		t.Fatalf("first poll reported %+v", got)
+	}
+
+	// Our own writes, through any Store over the directory, are skipped.
+	st.PutReading(ctx, "golf", "2025-02-01", 5400)
+	yamlstore.New(dir).SetCurrent(ctx, "golf")
+	if got := poll(); got != nil {
+		t.Fatalf("own writes reported: %+v", got)
+	}
+
+	// Another process: "golf" rewritten, "polo" created, "current" touched.
+	other := t.TempDir()
+	yamlstore.New(other).SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo"})
+	raw, _ := os.ReadFile(filepath.Join(other, "polo.yml"))
+	os.WriteFile(filepath.Join(dir, "polo.yml"), raw, 0644)
+	os.WriteFile(filepath.Join(dir, "golf.yml"), []byte("vehicle: Golf GTI\nreadings: {}\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "current"), later, later)
+
+	want := []yamlstore.Change{
+		{VehicleID: "golf", File: "golf.yml"},
+		{VehicleID: "polo", File: "polo.yml"},
+	}
+	if got := poll(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %+v, want %+v", got, want)
+	}
+
+	os.Remove(filepath.Join(dir, "polo.yml"))
+	st.DeleteVehicle(ctx, "golf")
+	want = []yamlstore.Change{{VehicleID: "polo", File: "polo.yml", Removed: true}}
+	if got := poll(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %+v, want %+v", got, want)
+	}
+}
@@ -1,8 +1,9 @@
 // Package yamlstore implements storage.Store over the historical on-disk layout:
 // one YAML file per vehicle (<id>.yml) plus a plain-text "current" file holding
 // the default vehicle id, all under a single directory (~/.mileminder by
-// default). It is the local, single-user backend; Phase 3 adds a sibling SQL
-// implementation of the same interface.
+// default). It is the default backend. internal/storage/sqlstore (one SQLite
+// file) and internal/storage/eventstore (an append-only event log) implement
+// the same interface, and serve --store or MILEMINDER_STORE picks between them.
 //
 // # Concurrency
 //
@@ -13,10 +14,25 @@
 // observes a torn/partial file and a crash mid-encode cannot truncate an existing
 // vehicle.
 //
-// Accepted risk: this does not guard against a separate CLI *process* writing
-// while the server process writes (no cross-process flock). The exposure is a
-// single user racing themselves across two processes; Phase 3's database is the
-// real fix. flock is platform-fiddly and deliberately out of scope here.
+// Across processes — a CLI command while the server is up — every method also
+// holds an advisory lock on <dir>/.lock (see internal/filelock): shared for
+// reads, exclusive for writes. A Watcher lets the server notice what the other
+// process changed.
+//
+// # Schema versions
+//
+// Vehicle and settings files carry a schema_version (see internal/schema).
+// Reads upgrade older files in memory; a file is only rewritten at the current
+// version when the Store next writes it, after a copy of the old one is saved
+// under schema-backup/.
+//
+// # Encryption
+//
+// A Store made with NewEncrypted seals each file with AES-GCM (see
+// internal/crypt), and Convert encrypts, decrypts or re-keys a directory in
+// place. Trips, attachments and the other files beside the Store are sealed
+// with the same key by their own packages, through crypt.ReadFile and
+// crypt.WriteFile.
 package yamlstore
 
 import (
@@ -26,9 +42,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/jackiabishop/mileminder/internal/atomicfile"
+	"github.com/jackiabishop/mileminder/internal/crypt"
 	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/schema"
 	"github.com/jackiabishop/mileminder/internal/storage"
 	"gopkg.in/yaml.v3"
 )
@@ -42,9 +61,15 @@ const currentFile = "current"
 // settings out of the vehicle namespace with no reserved-id special case.
 const settingsFile = "settings"
 
+// trashDir is the subdirectory holding soft-deleted items, one <item-id>.yml
+// each. ListVehicles skips directories, so the trash stays out of the vehicle
+// namespace.
+const trashDir = "trash"
+
 // Store is a storage.Store backed by per-vehicle YAML files in a directory.
 type Store struct {
 	dir string
+	key *crypt.Key // nil for a plain store; see NewEncrypted
 	mu  sync.RWMutex
 }
 
@@ -71,13 +96,17 @@ func (s *Store) vehiclePath(id string) string {
 // readVehicle loads and parses one vehicle file. It maps a missing file to
 // storage.ErrNotFound. Callers hold the appropriate lock.
 func (s *Store) readVehicle(id string) (*model.VehicleData, error) {
-	raw, err := os.ReadFile(s.vehiclePath(id))
+	raw, err := s.readFile(s.vehiclePath(id))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("load vehicle %q: %w", id, storage.ErrNotFound)
 		}
 		return nil, fmt.Errorf("read vehicle %q: %w", id, err)
 	}
+	raw, _, err = schema.Upgrade(schema.Vehicle, raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse vehicle %q: %w", id, err)
+	}
 	var data model.VehicleData
 	if err := yaml.Unmarshal(raw, &data); err != nil {
 		return nil, fmt.Errorf("parse vehicle %q: %w", id, err)
@@ -85,28 +114,41 @@ func (s *Store) readVehicle(id string) (*model.VehicleData, error) {
 	return &data, nil
 }
 
-// writeVehicle atomically encodes data to the vehicle file, creating the store
-// directory if needed. Callers hold the write lock.
+// vehicleDoc is a vehicle file: the document stamped with its schema version.
+type vehicleDoc struct {
+	SchemaVersion     int `yaml:"schema_version"`
+	model.VehicleData `yaml:",inline"`
+}
+
+// writeVehicle atomically encodes data to the vehicle file at the current
+// schema version, creating the store directory if needed and backing up a file
+// of an older version first. Callers hold the write lock.
 func (s *Store) writeVehicle(id string, data *model.VehicleData) error {
 	if err := os.MkdirAll(s.dir, 0755); err != nil {
 		return fmt.Errorf("create store dir: %w", err)
 	}
-	// 0644 matches the perms the previous os.Create/os.WriteFile paths produced.
-	return atomicfile.Write(s.vehiclePath(id), 0644, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(data); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	})
+	if err := s.backupBeforeWrite(schema.Vehicle, s.vehiclePath(id)); err != nil {
+		return err
+	}
+	doc, err := encodeYAML(vehicleDoc{SchemaVersion: schema.Current(schema.Vehicle), VehicleData: *data})
+	if err != nil {
+		return fmt.Errorf("encode vehicle %q: %w", id, err)
+	}
+	if err := s.writeFile(s.vehiclePath(id), doc); err != nil {
+		return err
+	}
+	ownWrites.note(s.vehiclePath(id))
+	return nil
 }
 
 // ListVehicles returns all vehicles, skipping non-.yml entries and any file that
 // cannot be read or parsed.
 func (s *Store) ListVehicles(ctx context.Context) ([]storage.Record, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	entries, err := os.ReadDir(s.dir)
 	if err != nil {
@@ -132,39 +174,91 @@ func (s *Store) ListVehicles(ctx context.Context) ([]storage.Record, error) {
 	return records, nil
 }
 
+// ListVehicleSummaries summarises every vehicle. Each file still has to be
+// parsed whole; a caching decorator in front (internal/storage/cachestore)
+// is what makes repeated listings cheap.
+func (s *Store) ListVehicleSummaries(ctx context.Context) ([]storage.VehicleSummary, error) {
+	records, err := s.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]storage.VehicleSummary, 0, len(records))
+	for _, r := range records {
+		summaries = append(summaries, storage.Summarize(r.ID, r.Data))
+	}
+	return summaries, nil
+}
+
 // GetVehicle returns one vehicle, or storage.ErrNotFound.
 func (s *Store) GetVehicle(ctx context.Context, id string) (*model.VehicleData, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	return s.readVehicle(id)
 }
 
 // SaveVehicle upserts a whole vehicle document.
 func (s *Store) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.writeVehicle(id, data)
+}
+
+// UpdateVehicle reads, changes and rewrites one vehicle under the write lock.
+func (s *Store) UpdateVehicle(ctx context.Context, id string, fn func(*model.VehicleData) error) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := s.readVehicle(id)
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		return err
+	}
 	return s.writeVehicle(id, data)
 }
 
 // DeleteVehicle removes a vehicle, or returns storage.ErrNotFound.
 func (s *Store) DeleteVehicle(ctx context.Context, id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
+	data, err := s.readVehicle(id)
+	if err != nil {
+		return fmt.Errorf("delete vehicle: %w", err)
+	}
+	// Trash first: a crash between the two steps leaves the vehicle both live
+	// and in the trash, never in neither.
+	if err := s.writeTrashItem(storage.NewVehicleTrashItem(id, data, time.Now())); err != nil {
+		return err
+	}
 	if err := os.Remove(s.vehiclePath(id)); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("delete vehicle %q: %w", id, storage.ErrNotFound)
-		}
 		return fmt.Errorf("delete vehicle %q: %w", id, err)
 	}
+	ownWrites.note(s.vehiclePath(id))
 	return nil
 }
 
 // PutReading upserts one reading under the write lock, mapping a missing vehicle
 // to storage.ErrNotFound.
 func (s *Store) PutReading(ctx context.Context, id, date string, miles int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	data, err := s.readVehicle(id)
 	if err != nil {
@@ -180,26 +274,36 @@ func (s *Store) PutReading(ctx context.Context, id, date string, miles int) erro
 // DeleteReading removes one reading, mapping a missing vehicle or missing reading
 // to storage.ErrNotFound.
 func (s *Store) DeleteReading(ctx context.Context, id, date string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	data, err := s.readVehicle(id)
 	if err != nil {
 		return err
 	}
-	if _, ok := data.Readings[date]; !ok {
+	miles, ok := data.Readings[date]
+	if !ok {
 		return fmt.Errorf("delete reading %q on %q: %w", date, id, storage.ErrNotFound)
 	}
+	if err := s.writeTrashItem(storage.NewReadingTrashItem(id, date, miles, time.Now())); err != nil {
+		return err
+	}
 	delete(data.Readings, date)
 	return s.writeVehicle(id, data)
 }
 
 // GetCurrent returns the default vehicle id, or "" when unset.
 func (s *Store) GetCurrent(ctx context.Context) (string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock, err := s.lockRead()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
 
-	raw, err := os.ReadFile(filepath.Join(s.dir, currentFile))
+	raw, err := s.readFile(filepath.Join(s.dir, currentFile))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", nil
@@ -212,8 +316,11 @@ func (s *Store) GetCurrent(ctx context.Context) (string, error) {
 // SetCurrent sets the default vehicle id, returning storage.ErrNotFound if that
 // vehicle does not exist.
 func (s *Store) SetCurrent(ctx context.Context, id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	if _, err := os.Stat(s.vehiclePath(id)); err != nil {
 		if os.IsNotExist(err) {
@@ -225,29 +332,39 @@ func (s *Store) SetCurrent(ctx context.Context, id string) error {
 		return fmt.Errorf("create store dir: %w", err)
 	}
 	path := filepath.Join(s.dir, currentFile)
-	if err := atomicfile.Write(path, 0644, func(f *os.File) error {
-		_, err := f.WriteString(id)
-		return err
-	}); err != nil {
+	if err := s.writeFile(path, []byte(id)); err != nil {
 		return fmt.Errorf("write current pointer: %w", err)
 	}
+	ownWrites.note(path)
 	return nil
 }
 
 // GetSettings returns the saved preferences, defaults when the file is absent,
 // and backfills any empty field from the defaults.
 func (s *Store) GetSettings(ctx context.Context) (*model.Settings, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.readSettings()
+}
 
+// readSettings loads and parses the preferences document. Callers hold the
+// appropriate lock.
+func (s *Store) readSettings() (*model.Settings, error) {
 	defaults := model.DefaultSettings()
-	raw, err := os.ReadFile(filepath.Join(s.dir, settingsFile))
+	raw, err := s.readFile(filepath.Join(s.dir, settingsFile))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &defaults, nil
 		}
 		return nil, fmt.Errorf("read settings: %w", err)
 	}
+	raw, _, err = schema.Upgrade(schema.Settings, raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse settings: %w", err)
+	}
 	var settings model.Settings
 	if err := yaml.Unmarshal(raw, &settings); err != nil {
 		return nil, fmt.Errorf("parse settings: %w", err)
@@ -263,25 +380,303 @@ func (s *Store) GetSettings(ctx context.Context) (*model.Settings, error) {
 
 // SaveSettings atomically replaces the preferences document.
 func (s *Store) SaveSettings(ctx context.Context, settings *model.Settings) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	if err := os.MkdirAll(s.dir, 0755); err != nil {
 		return fmt.Errorf("create store dir: %w", err)
 	}
 	path := filepath.Join(s.dir, settingsFile)
-	if err := atomicfile.Write(path, 0644, func(f *os.File) error {
-		enc := yaml.NewEncoder(f)
-		if err := enc.Encode(settings); err != nil {
-			enc.Close()
-			return err
-		}
-		return enc.Close()
-	}); err != nil {
+	if err := s.backupBeforeWrite(schema.Settings, path); err != nil {
+		return err
+	}
+	doc, err := encodeYAML(struct {
+		SchemaVersion  int `yaml:"schema_version"`
+		model.Settings `yaml:",inline"`
+	}{schema.Current(schema.Settings), *settings})
+	if err != nil {
+		return fmt.Errorf("encode settings: %w", err)
+	}
+	if err := s.writeFile(path, doc); err != nil {
 		return fmt.Errorf("write settings: %w", err)
 	}
+	ownWrites.note(path)
+	return nil
+}
+
+// RenameVehicle renames <from>.yml to <to>.yml and repoints the current file
+// if it named from. The vehicle file is moved with os.Rename, so it is never
+// visible under both ids or neither.
+func (s *Store) RenameVehicle(ctx context.Context, from, to string) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.readVehicle(from); err != nil {
+		return fmt.Errorf("rename vehicle: %w", err)
+	}
+	if !storage.ValidID(to) {
+		return fmt.Errorf("rename vehicle %q: invalid id %q", from, to)
+	}
+	if _, err := os.Stat(s.vehiclePath(to)); err == nil {
+		return fmt.Errorf("rename vehicle %q to %q: %w", from, to, storage.ErrExists)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("stat vehicle %q: %w", to, err)
+	}
+	if err := os.Rename(s.vehiclePath(from), s.vehiclePath(to)); err != nil {
+		return fmt.Errorf("rename vehicle %q to %q: %w", from, to, err)
+	}
+	ownWrites.note(s.vehiclePath(from))
+	ownWrites.note(s.vehiclePath(to))
+	return s.repointCurrent(from, to)
+}
+
+// MergeVehicle writes the merged document over <into>.yml before removing
+// <from>.yml, so a crash part-way leaves both vehicles (with from's readings
+// duplicated into into) rather than losing any.
+func (s *Store) MergeVehicle(ctx context.Context, from, into string, overwrite bool, check func(*model.VehicleData) error) (readings.Report, error) {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return readings.Report{}, err
+	}
+	defer unlock()
+
+	if from == into {
+		return readings.Report{}, fmt.Errorf("merge vehicle %q into itself", from)
+	}
+	src, err := s.readVehicle(from)
+	if err != nil {
+		return readings.Report{}, fmt.Errorf("merge vehicle: %w", err)
+	}
+	dst, err := s.readVehicle(into)
+	if err != nil {
+		return readings.Report{}, fmt.Errorf("merge vehicle: %w", err)
+	}
+	merged, report := storage.MergeVehicleData(dst, src, overwrite)
+	if check != nil {
+		if err := check(merged); err != nil {
+			return readings.Report{}, err
+		}
+	}
+	if err := s.writeVehicle(into, merged); err != nil {
+		return readings.Report{}, err
+	}
+	if err := os.Remove(s.vehiclePath(from)); err != nil {
+		return readings.Report{}, fmt.Errorf("delete merged vehicle %q: %w", from, err)
+	}
+	ownWrites.note(s.vehiclePath(from))
+	return report, s.repointCurrent(from, into)
+}
+
+// repointCurrent rewrites the current file to to if it currently names from.
+// Callers hold the write lock.
+func (s *Store) repointCurrent(from, to string) error {
+	path := filepath.Join(s.dir, currentFile)
+	raw, err := s.readFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read current pointer: %w", err)
+	}
+	if strings.TrimSpace(string(raw)) != from {
+		return nil
+	}
+	if err := s.writeFile(path, []byte(to)); err != nil {
+		return fmt.Errorf("write current pointer: %w", err)
+	}
+	ownWrites.note(path)
+	return nil
+}
+
+// trashPath returns the file for a trash item. Item ids are generated hex, so
+// anything else (e.g. a crafted id from a URL) is refused before it reaches a
+// path.
+func (s *Store) trashPath(itemID string) (string, bool) {
+	if itemID == "" || strings.Trim(itemID, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return filepath.Join(s.dir, trashDir, itemID+".yml"), true
+}
+
+// readTrashItem loads one trash item, mapping a missing or malformed id to
+// storage.ErrNotFound. Callers hold the appropriate lock.
+func (s *Store) readTrashItem(itemID string) (*storage.TrashItem, error) {
+	path, ok := s.trashPath(itemID)
+	if !ok {
+		return nil, fmt.Errorf("trash item %q: %w", itemID, storage.ErrNotFound)
+	}
+	raw, err := s.readFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("trash item %q: %w", itemID, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("read trash item %q: %w", itemID, err)
+	}
+	var item storage.TrashItem
+	if err := yaml.Unmarshal(raw, &item); err != nil {
+		return nil, fmt.Errorf("parse trash item %q: %w", itemID, err)
+	}
+	return &item, nil
+}
+
+// writeTrashItem atomically writes one trash item. Callers hold the write lock.
+func (s *Store) writeTrashItem(item storage.TrashItem) error {
+	path, _ := s.trashPath(item.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create trash dir: %w", err)
+	}
+	doc, err := encodeYAML(item)
+	if err != nil {
+		return fmt.Errorf("encode trash item: %w", err)
+	}
+	if err := s.writeFile(path, doc); err != nil {
+		return fmt.Errorf("write trash item: %w", err)
+	}
+	return nil
+}
+
+// listTrash reads every trash item, skipping unreadable files as ListVehicles
+// does. Callers hold the appropriate lock.
+func (s *Store) listTrash() ([]storage.TrashItem, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, trashDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read trash dir: %w", err)
+	}
+	var items []storage.TrashItem
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yml" {
+			continue
+		}
+		item, err := s.readTrashItem(strings.TrimSuffix(e.Name(), ".yml"))
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// ListTrash returns the trash, most recently deleted first.
+func (s *Store) ListTrash(ctx context.Context) ([]storage.TrashItem, error) {
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	items, err := s.listTrash()
+	if err != nil {
+		return nil, err
+	}
+	storage.SortTrash(items)
+	return items, nil
+}
+
+// RestoreTrash writes the item back into the live store, then deletes its
+// trash file.
+func (s *Store) RestoreTrash(ctx context.Context, itemID string) (*storage.TrashItem, error) {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	item, err := s.readTrashItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	switch item.Kind {
+	case storage.TrashVehicle:
+		if _, err := os.Stat(s.vehiclePath(item.VehicleID)); err == nil {
+			return nil, fmt.Errorf("restore vehicle %q: %w", item.VehicleID, storage.ErrExists)
+		}
+		if item.Vehicle == nil {
+			return nil, fmt.Errorf("restore vehicle %q: trash item has no document", item.VehicleID)
+		}
+		if err := s.writeVehicle(item.VehicleID, item.Vehicle); err != nil {
+			return nil, err
+		}
+	case storage.TrashReading:
+		data, err := s.readVehicle(item.VehicleID)
+		if err != nil {
+			return nil, fmt.Errorf("restore reading: %w", err)
+		}
+		if _, taken := data.Readings[item.Date]; taken {
+			return nil, fmt.Errorf("restore reading %q on %q: %w", item.Date, item.VehicleID, storage.ErrExists)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[item.Date] = item.Miles
+		if err := s.writeVehicle(item.VehicleID, data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("restore %q: unknown kind %q", itemID, item.Kind)
+	}
+	path, _ := s.trashPath(itemID)
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("remove restored trash item %q: %w", itemID, err)
+	}
+	return item, nil
+}
+
+// PurgeTrash deletes one trash file.
+func (s *Store) PurgeTrash(ctx context.Context, itemID string) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path, ok := s.trashPath(itemID)
+	if !ok {
+		return fmt.Errorf("purge %q: %w", itemID, storage.ErrNotFound)
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("purge %q: %w", itemID, storage.ErrNotFound)
+		}
+		return fmt.Errorf("purge %q: %w", itemID, err)
+	}
 	return nil
 }
 
+// PurgeTrashBefore deletes every trash file whose item was deleted before
+// cutoff.
+func (s *Store) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	items, err := s.listTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		if !item.DeletedAt.Before(cutoff) {
+			continue
+		}
+		path, _ := s.trashPath(item.ID)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return purged, fmt.Errorf("purge %q: %w", item.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
 // Compile-time assertion that Store satisfies storage.Store.
 var _ storage.Store = (*Store)(nil)
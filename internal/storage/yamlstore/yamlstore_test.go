@@ -3,12 +3,15 @@ package yamlstore_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/schema"
 	"github.com/jackiabishop/mileminder/internal/storage"
 	"github.com/jackiabishop/mileminder/internal/storage/storagetest"
 	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
@@ -52,9 +55,10 @@ func TestListSkipsNonYAMLAndCorruptFiles(t *testing.T) {
 }
 
 // TestSavedBytesMatchLegacyEncoder is the hard on-disk-compatibility guard: the
-// bytes SaveVehicle writes must be byte-identical to what the previous
-// yaml.NewEncoder(file).Encode(&data) path produced, so existing ~/.mileminder
-// files remain readable and round-trip unchanged.
+// bytes SaveVehicle writes must be what the previous
+// yaml.NewEncoder(file).Encode(&data) path produced, preceded only by the
+// schema_version line, so older builds (which ignore unknown keys) still read
+// new files and the layout stays hand-editable.
 func TestSavedBytesMatchLegacyEncoder(t *testing.T) {
 	dir := t.TempDir()
 	st := yamlstore.New(dir)
@@ -70,6 +74,7 @@ func TestSavedBytesMatchLegacyEncoder(t *testing.T) {
 
 	// Reproduce the exact legacy encoding.
 	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "schema_version: %d\n", schema.Current(schema.Vehicle))
 	enc := yaml.NewEncoder(&buf)
 	if err := enc.Encode(data); err != nil {
 		t.Fatal(err)
@@ -139,3 +144,82 @@ func sample() *model.VehicleData {
 		Readings: map[string]int{"2025-01-01": 5000, "2025-03-01": 5600},
 	}
 }
+
+// A file from before schema versioning reads as-is and is only rewritten, at
+// the current version and after a backup, when the store next writes it.
+func TestLegacyFileMigratesOnWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "golf.yml")
+	legacy := "vehicle: Golf\nreadings:\n    \"2025-01-01\": 5000\n"
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := yamlstore.New(dir)
+
+	data, err := st.GetVehicle(ctx, "golf")
+	if err != nil || data.Readings["2025-01-01"] != 5000 {
+		t.Fatalf("GetVehicle = %+v, %v", data, err)
+	}
+	if raw, _ := os.ReadFile(path); string(raw) != legacy {
+		t.Fatal("read rewrote the file")
+	}
+
+	if err := st.PutReading(ctx, "golf", "2025-02-01", 5400); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	if v, _ := schema.Version(raw); v != schema.Current(schema.Vehicle) {
+		t.Fatalf("written file not at current version:\n%s", raw)
+	}
+	backup, err := os.ReadFile(filepath.Join(dir, schema.BackupDir, "golf.yml.v0"))
+	if err != nil || string(backup) != legacy {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+	if list, _ := st.ListVehicles(ctx); len(list) != 1 {
+		t.Fatalf("backup dir leaked into ListVehicles: %+v", list)
+	}
+
+	if err := os.WriteFile(path, []byte("schema_version: 99\nvehicle: Golf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetVehicle(ctx, "golf"); !errors.Is(err, schema.ErrTooNew) {
+		t.Fatalf("newer file: err = %v, want ErrTooNew", err)
+	}
+}
+
+// Two Stores on one directory stand in for the CLI and a running server: each
+// UpdateVehicle reads the vehicle under the exclusive lock, so none of their
+// interleaved updates is lost.
+func TestUpdateVehicleAcrossStoresLosesNothing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := yamlstore.New(dir).SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf"}); err != nil {
+		t.Fatal(err)
+	}
+	stores := []*yamlstore.Store{yamlstore.New(dir), yamlstore.New(dir)}
+	errs := make(chan error)
+	for i := range 20 {
+		go func() {
+			errs <- stores[i%2].UpdateVehicle(ctx, "golf", func(data *model.VehicleData) error {
+				if data.Readings == nil {
+					data.Readings = map[string]int{}
+				}
+				data.Readings[fmt.Sprintf("2025-01-%02d", i+1)] = 1000 + i
+				return nil
+			})
+		}()
+	}
+	for range 20 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	golf, err := stores[0].GetVehicle(ctx, "golf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(golf.Readings) != 20 {
+		t.Errorf("kept %d of 20 readings: %v", len(golf.Readings), golf.Readings)
+	}
+}
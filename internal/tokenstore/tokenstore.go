@@ -0,0 +1,251 @@
+// Package tokenstore keeps the bearer tokens open routes take as their
+// credential — the calendar feed's and home-automation pushes' — where no
+// session can. As with sessions, only the SHA-256 of a token is stored: the raw
+// token is shown once, when it is issued, and a leaked token file does not
+// yield a working URL.
+//
+// A token belongs to an owner (a hosted user id, or storage.LocalOwner) and,
+// for per-vehicle credentials, a vehicle; a feed token covering all of an
+// owner's vehicles has an empty VehicleID. Each owner and vehicle has at most
+// one token, so issuing one revokes the last.
+package tokenstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+// ErrNotFound reports an unknown token, or an owner or vehicle without one.
+var ErrNotFound = errors.New("not found")
+
+// Token is one issued credential.
+type Token struct {
+	Owner     string    `yaml:"owner" json:"-"`
+	VehicleID string    `yaml:"vehicle_id,omitempty" json:"vehicle_id,omitempty"`
+	TokenHash string    `yaml:"token_hash" json:"-"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// Store persists tokens, one per owner and vehicle.
+type Store interface {
+	// Put creates or replaces the token for t's owner and vehicle, revoking
+	// the old one.
+	Put(ctx context.Context, t Token) error
+	// Get returns the owner's token for vehicleID, or ErrNotFound.
+	Get(ctx context.Context, owner, vehicleID string) (*Token, error)
+	// Resolve looks a token hash up, or returns ErrNotFound.
+	Resolve(ctx context.Context, tokenHash string) (*Token, error)
+	// Delete revokes the owner's token for vehicleID, or returns ErrNotFound.
+	Delete(ctx context.Context, owner, vehicleID string) error
+}
+
+// FileStore persists tokens in one file. Name it without a .yml extension,
+// like yamlstore's settings file, so it can live in a single-user data
+// directory without being read as a vehicle.
+type FileStore struct {
+	path string
+	what string     // "calendar token", for errors
+	key  *crypt.Key // nil unless the data directory is encrypted
+	mu   sync.Mutex
+}
+
+// NewFile returns a FileStore at path, created lazily. what names the
+// tokens in errors.
+func NewFile(path, what string) *FileStore {
+	return &FileStore{path: path, what: what}
+}
+
+// NewEncryptedFile returns a FileStore whose file is sealed with key, the
+// data directory's (see yamlstore.NewEncrypted). A nil key makes a plain
+// FileStore, as NewFile does.
+func NewEncryptedFile(path, what string, key *crypt.Key) *FileStore {
+	return &FileStore{path: path, what: what, key: key}
+}
+
+// Convert re-seals the file from one key to another, reporting whether it
+// needed it (see crypt.ConvertFile).
+func (s *FileStore) Convert(from, to *crypt.Key) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return crypt.ConvertFile(s.path, from, to)
+}
+
+type tokensDoc struct {
+	Tokens []Token `yaml:"tokens"`
+}
+
+func (s *FileStore) load() ([]Token, error) {
+	raw, err := crypt.ReadFile(s.key, s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %ss: %w", s.what, err)
+	}
+	var doc tokensDoc
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse %ss: %w", s.what, err)
+	}
+	return doc.Tokens, nil
+}
+
+func (s *FileStore) save(tokens []Token) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	sortTokens(tokens)
+	raw, err := yaml.Marshal(tokensDoc{Tokens: tokens})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path, 0600, raw)
+}
+
+func (s *FileStore) Put(ctx context.Context, t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(without(tokens, t.Owner, t.VehicleID), t))
+}
+
+func (s *FileStore) Get(ctx context.Context, owner, vehicleID string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return find(tokens, s.what, owner, vehicleID)
+}
+
+func (s *FileStore) Resolve(ctx context.Context, tokenHash string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return resolve(tokens, s.what, tokenHash)
+}
+
+func (s *FileStore) Delete(ctx context.Context, owner, vehicleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	out := without(tokens, owner, vehicleID)
+	if len(out) == len(tokens) {
+		return notFound(s.what, owner, vehicleID)
+	}
+	return s.save(out)
+}
+
+// MemoryStore is an in-memory Store for tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	what   string
+	tokens []Token
+}
+
+// NewMemory returns an empty MemoryStore. what names the tokens in errors.
+func NewMemory(what string) *MemoryStore {
+	return &MemoryStore{what: what}
+}
+
+func (m *MemoryStore) Put(ctx context.Context, t Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens = append(without(m.tokens, t.Owner, t.VehicleID), t)
+	sortTokens(m.tokens)
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, owner, vehicleID string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return find(m.tokens, m.what, owner, vehicleID)
+}
+
+func (m *MemoryStore) Resolve(ctx context.Context, tokenHash string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return resolve(m.tokens, m.what, tokenHash)
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, owner, vehicleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := without(m.tokens, owner, vehicleID)
+	if len(out) == len(m.tokens) {
+		return notFound(m.what, owner, vehicleID)
+	}
+	m.tokens = out
+	return nil
+}
+
+// without returns tokens minus owner's token on vehicleID, in a fresh slice.
+func without(tokens []Token, owner, vehicleID string) []Token {
+	out := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Owner != owner || t.VehicleID != vehicleID {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func find(tokens []Token, what, owner, vehicleID string) (*Token, error) {
+	for _, t := range tokens {
+		if t.Owner == owner && t.VehicleID == vehicleID {
+			cp := t
+			return &cp, nil
+		}
+	}
+	return nil, notFound(what, owner, vehicleID)
+}
+
+func resolve(tokens []Token, what, tokenHash string) (*Token, error) {
+	for _, t := range tokens {
+		if tokenHash != "" && t.TokenHash == tokenHash {
+			cp := t
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", what, ErrNotFound)
+}
+
+func notFound(what, owner, vehicleID string) error {
+	if vehicleID == "" {
+		return fmt.Errorf("%s for %q: %w", what, owner, ErrNotFound)
+	}
+	return fmt.Errorf("%s for %s: %w", what, vehicleID, ErrNotFound)
+}
+
+func sortTokens(tokens []Token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Owner != tokens[j].Owner {
+			return tokens[i].Owner < tokens[j].Owner
+		}
+		return tokens[i].VehicleID < tokens[j].VehicleID
+	})
+}
+
+var (
+	_ Store = (*FileStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
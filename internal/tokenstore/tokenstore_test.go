@@ -0,0 +1,109 @@
+package tokenstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+)
+
+func stores(t *testing.T) map[string]Store {
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{
+		"file":      NewFile(filepath.Join(t.TempDir(), "tokens"), "test token"),
+		"encrypted": NewEncryptedFile(filepath.Join(t.TempDir(), "tokens"), "test token", key),
+		"memory":    NewMemory("test token"),
+	}
+}
+
+func TestOwnerTokens(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := st.Get(ctx, "alice", ""); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get before issue: want ErrNotFound, got %v", err)
+			}
+			st.Put(ctx, Token{Owner: "alice", TokenHash: "h1"})
+			st.Put(ctx, Token{Owner: "bob", TokenHash: "h2"})
+			if tok, err := st.Resolve(ctx, "h1"); err != nil || tok.Owner != "alice" {
+				t.Fatalf("Resolve(h1) = %+v, %v", tok, err)
+			}
+
+			// Rotation revokes the old hash.
+			st.Put(ctx, Token{Owner: "alice", TokenHash: "h3"})
+			if _, err := st.Resolve(ctx, "h1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("rotated token still resolves: %v", err)
+			}
+
+			if err := st.Delete(ctx, "alice", ""); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := st.Resolve(ctx, "h3"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("revoked token still resolves: %v", err)
+			}
+			if err := st.Delete(ctx, "alice", ""); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("second delete: want ErrNotFound, got %v", err)
+			}
+			if tok, _ := st.Resolve(ctx, "h2"); tok == nil || tok.Owner != "bob" {
+				t.Fatal("bob's token lost")
+			}
+		})
+	}
+}
+
+func TestVehicleTokens(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			st.Put(ctx, Token{Owner: "u1", VehicleID: "golf", TokenHash: "a"})
+			st.Put(ctx, Token{Owner: "u1", VehicleID: "golf", TokenHash: "b"})
+			st.Put(ctx, Token{Owner: "u1", VehicleID: "polo", TokenHash: "c"})
+			st.Put(ctx, Token{Owner: "u2", VehicleID: "golf", TokenHash: "d"})
+			if _, err := st.Resolve(ctx, "a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("replaced token still resolves: %v", err)
+			}
+			if tok, err := st.Resolve(ctx, "b"); err != nil || tok.Owner != "u1" || tok.VehicleID != "golf" {
+				t.Fatalf("Resolve: %+v, %v", tok, err)
+			}
+			if _, err := st.Resolve(ctx, ""); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("empty hash resolves: %v", err)
+			}
+
+			if err := st.Delete(ctx, "u2", "golf"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := st.Resolve(ctx, "d"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("revoked token resolves: %v", err)
+			}
+			if tok, err := st.Get(ctx, "u1", "polo"); err != nil || tok.TokenHash != "c" {
+				t.Fatalf("another vehicle's token lost: %+v, %v", tok, err)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := NewFile(path, "test token").Put(ctx, Token{Owner: "alice", TokenHash: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := NewFile(path, "test token").Convert(nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	if _, err := NewFile(path, "test token").Resolve(ctx, "h1"); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+	if tok, err := NewEncryptedFile(path, "test token", key).Resolve(ctx, "h1"); err != nil || tok.Owner != "alice" {
+		t.Fatalf("encrypted store: %+v, %v", tok, err)
+	}
+}
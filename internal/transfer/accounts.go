@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackiabishop/mileminder/internal/auth"
+)
+
+// Account is one hosted account: its id in the source and in the
+// destination.
+type Account struct {
+	From string
+	To   string
+}
+
+// Accounts matches every account in from with the account of the same email
+// in to, creating any that is missing — with the same password hash, under
+// the id to assigns — unless check is set, when a missing one is an error.
+// Matching by email makes a rerun pick up the accounts an interrupted one
+// created. from and to may be the same store, for a backend switch within
+// one data root: each account then matches itself. It returns the matches,
+// in from's order, and how many accounts were created.
+func Accounts(ctx context.Context, from, to auth.UserStore, check bool) ([]Account, int, error) {
+	users, err := from.ListUsers(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	accounts := make([]Account, 0, len(users))
+	created := 0
+	for _, u := range users {
+		existing, err := to.GetUserByEmail(ctx, u.Email)
+		switch {
+		case err == nil:
+			accounts = append(accounts, Account{From: u.ID, To: existing.ID})
+			continue
+		case !errors.Is(err, auth.ErrNotFound):
+			return nil, created, err
+		case check:
+			return nil, created, fmt.Errorf("account %s has not been copied", u.Email)
+		}
+		copied, err := to.CreateUser(ctx, u.Email, u.PasswordHash)
+		if err != nil {
+			return nil, created, fmt.Errorf("copy account %s: %w", u.Email, err)
+		}
+		accounts = append(accounts, Account{From: u.ID, To: copied.ID})
+		created++
+	}
+	return accounts, created, nil
+}
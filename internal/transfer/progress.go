@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/atomicfile"
+)
+
+// ProgressFile is the progress file's name in the destination directory.
+const ProgressFile = "migrate_progress"
+
+// Progress records which vehicles and tenants a copy has finished, in a file
+// rewritten after each one, so a copy that fails part-way can resume. It is
+// tied to one source and destination: resuming with a different pair is an
+// error rather than a silent mix. A nil *Progress records nothing.
+type Progress struct {
+	path string
+	doc  progressDoc
+	done map[string]bool
+}
+
+type progressDoc struct {
+	From string   `yaml:"from"`
+	To   string   `yaml:"to"`
+	Done []string `yaml:"done"`
+}
+
+// OpenProgress loads the progress file at path, or starts an empty one, for
+// a copy from one backend to another (as the user named them).
+func OpenProgress(path, from, to string) (*Progress, error) {
+	p := &Progress{path: path, doc: progressDoc{From: from, To: to}, done: map[string]bool{}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read migration progress: %w", err)
+	}
+	var doc progressDoc
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse migration progress %s: %w", path, err)
+	}
+	if doc.From != from || doc.To != to {
+		return nil, fmt.Errorf("%s belongs to an unfinished migration from %s to %s; finish it or remove the file", path, doc.From, doc.To)
+	}
+	p.doc = doc
+	for _, key := range doc.Done {
+		p.done[key] = true
+	}
+	return p, nil
+}
+
+// Resuming reports whether an earlier run left progress behind.
+func (p *Progress) Resuming() bool {
+	return p != nil && len(p.doc.Done) > 0
+}
+
+// Done reports whether key has been marked.
+func (p *Progress) Done(key string) bool {
+	return p != nil && p.done[key]
+}
+
+// Started reports whether any vehicle of tenant has been copied.
+func (p *Progress) Started(tenant string) bool {
+	if p == nil {
+		return false
+	}
+	prefix := vehicleKey(tenant, "")
+	for _, key := range p.doc.Done {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mark records key as done and saves the file.
+func (p *Progress) Mark(key string) error {
+	if p == nil || p.done[key] {
+		return nil
+	}
+	p.done[key] = true
+	p.doc.Done = append(p.doc.Done, key)
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	return atomicfile.Write(p.path, 0600, func(f *os.File) error {
+		enc := yaml.NewEncoder(f)
+		if err := enc.Encode(p.doc); err != nil {
+			enc.Close()
+			return err
+		}
+		return enc.Close()
+	})
+}
+
+// Remove deletes the progress file once a copy has finished and verified.
+func (p *Progress) Remove() error {
+	if p == nil {
+		return nil
+	}
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove migration progress: %w", err)
+	}
+	return nil
+}
+
+// vehicleKey and tenantKey name progress entries: "vehicle:<tenant>/<id>"
+// once a vehicle is copied, "tenant:<tenant>" once all of a tenant is.
+func vehicleKey(tenant, id string) string { return "vehicle:" + tenant + "/" + id }
+func tenantKey(tenant string) string      { return "tenant:" + tenant }
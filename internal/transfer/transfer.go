@@ -0,0 +1,304 @@
+// Package transfer copies vehicle data from one storage backend to another —
+// YAML files to SQLite and back — through the storage.Store interface alone,
+// so any pair of implementations can be migrated between. Copy writes each
+// vehicle, the settings and the current pointer; Verify then compares the two
+// sides document by document and by computed status. A Progress file makes an
+// interrupted copy resumable: rerunning it skips what already landed.
+//
+// A copy that would silently leave data behind is refused up front: a source
+// whose ListVehicles skips files it cannot read, or one with items in its
+// trash, which the Store interface has no way to recreate.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/calc"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+// ErrDestinationNotEmpty is returned when a tenant's destination already
+// holds vehicles that no earlier run of this copy put there. Copying would
+// merge two data sets, so it is refused.
+var ErrDestinationNotEmpty = errors.New("destination already has vehicles")
+
+var (
+	// ErrUnreadable is returned when the source has vehicle or settings files
+	// it cannot read. ListVehicles skips them, so they would neither be copied
+	// nor missed by Verify.
+	ErrUnreadable = errors.New("source has unreadable files")
+
+	// ErrTrashNotEmpty is returned when the source's trash holds items: they
+	// cannot be recreated in the destination, and would be lost on switching
+	// over.
+	ErrTrashNotEmpty = errors.New("source trash is not empty")
+)
+
+// Pair is one store to copy: the single-user store (Tenant "") or one hosted
+// user's.
+type Pair struct {
+	Tenant string
+	From   storage.Store
+	To     storage.Store
+}
+
+// label names the pair in messages.
+func (p Pair) label() string {
+	if p.Tenant == "" {
+		return "store"
+	}
+	return "user " + p.Tenant
+}
+
+// Counts totals what a copy or verification covered.
+type Counts struct {
+	Tenants  int
+	Vehicles int
+	Readings int
+	Settings int
+	Current  int
+	// Skipped is how many vehicles an earlier, interrupted run had already
+	// copied.
+	Skipped int
+}
+
+// unreadableLister is a store that can name the files its ListVehicles
+// skips: yamlstore.
+type unreadableLister interface {
+	Unreadable(ctx context.Context) ([]yamlstore.BadFile, error)
+}
+
+// checkReadable returns an error wrapping ErrUnreadable, naming each file, if
+// st is a store that skips unreadable files and has some.
+func checkReadable(ctx context.Context, st storage.Store) error {
+	lister, ok := st.(unreadableLister)
+	if !ok {
+		return nil
+	}
+	bad, err := lister.Unreadable(ctx)
+	if err != nil {
+		return err
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(bad))
+	for _, f := range bad {
+		names = append(names, fmt.Sprintf("%s (%v)", f.Name, f.Err))
+	}
+	return fmt.Errorf("%w: %s; repair them with 'mileminder doctor' first", ErrUnreadable, strings.Join(names, ", "))
+}
+
+// checkSource refuses a pair whose source would not copy whole.
+func checkSource(ctx context.Context, p Pair) error {
+	if err := checkReadable(ctx, p.From); err != nil {
+		return err
+	}
+	trash, err := p.From.ListTrash(ctx)
+	if err != nil {
+		return err
+	}
+	if len(trash) > 0 {
+		return fmt.Errorf("%w (%d item(s)); restore or purge them first", ErrTrashNotEmpty, len(trash))
+	}
+	return nil
+}
+
+// Copy copies every pair, marking progress as it goes. A pair already marked
+// done is skipped whole, and within a pair each vehicle already marked is
+// skipped, so rerunning a failed Copy with the same Progress resumes it.
+// progress may be nil to copy without resuming. Nothing is copied if any
+// source has unreadable files or trash (ErrUnreadable, ErrTrashNotEmpty).
+func Copy(ctx context.Context, pairs []Pair, progress *Progress) (Counts, error) {
+	var counts Counts
+	for _, p := range pairs {
+		if progress.Done(tenantKey(p.Tenant)) {
+			continue
+		}
+		if err := checkSource(ctx, p); err != nil {
+			return counts, fmt.Errorf("copy %s: %w", p.label(), err)
+		}
+	}
+	for _, p := range pairs {
+		if progress.Done(tenantKey(p.Tenant)) {
+			counts.Tenants++
+			continue
+		}
+		if err := copyPair(ctx, p, progress, &counts); err != nil {
+			return counts, fmt.Errorf("copy %s: %w", p.label(), err)
+		}
+		if err := progress.Mark(tenantKey(p.Tenant)); err != nil {
+			return counts, err
+		}
+		counts.Tenants++
+	}
+	return counts, nil
+}
+
+func copyPair(ctx context.Context, p Pair, progress *Progress, counts *Counts) error {
+	records, err := p.From.ListVehicles(ctx)
+	if err != nil {
+		return err
+	}
+	if !progress.Started(p.Tenant) {
+		existing, err := p.To.ListVehicles(ctx)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%w (%d)", ErrDestinationNotEmpty, len(existing))
+		}
+	}
+	for _, rec := range records {
+		key := vehicleKey(p.Tenant, rec.ID)
+		if progress.Done(key) {
+			counts.Skipped++
+			continue
+		}
+		if err := p.To.SaveVehicle(ctx, rec.ID, rec.Data); err != nil {
+			return err
+		}
+		if err := progress.Mark(key); err != nil {
+			return err
+		}
+		counts.Vehicles++
+		counts.Readings += len(rec.Data.Readings)
+	}
+
+	settings, err := p.From.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.To.SaveSettings(ctx, settings); err != nil {
+		return err
+	}
+	counts.Settings++
+
+	current, err := liveCurrent(ctx, p.From, records)
+	if err != nil {
+		return err
+	}
+	if current != "" {
+		if err := p.To.SetCurrent(ctx, current); err != nil {
+			return err
+		}
+		counts.Current++
+	}
+	return nil
+}
+
+// liveCurrent is the store's current pointer, or "" when it names a vehicle
+// that no longer exists — a deleted default is left dangling by the YAML
+// store, and there is nothing to point the destination at.
+func liveCurrent(ctx context.Context, st storage.Store, records []storage.Record) (string, error) {
+	current, err := st.GetCurrent(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !slices.ContainsFunc(records, func(r storage.Record) bool { return r.ID == current }) {
+		return "", nil
+	}
+	return current, nil
+}
+
+// Verify checks every pair's destination against its source: the same
+// vehicle ids, the same readings, the same calc.Status for each vehicle at
+// now, the same settings and the same current pointer. It returns what it
+// compared and, if anything differs, an error listing every difference. A
+// source with unreadable files fails verification, since the comparison
+// could not see them.
+func Verify(ctx context.Context, pairs []Pair, now time.Time) (Counts, error) {
+	var counts Counts
+	var diffs []error
+	for _, p := range pairs {
+		d, err := verifyPair(ctx, p, now, &counts)
+		if err != nil {
+			return counts, fmt.Errorf("verify %s: %w", p.label(), err)
+		}
+		for _, e := range d {
+			diffs = append(diffs, fmt.Errorf("%s: %s", p.label(), e))
+		}
+		counts.Tenants++
+	}
+	return counts, errors.Join(diffs...)
+}
+
+func verifyPair(ctx context.Context, p Pair, now time.Time, counts *Counts) ([]string, error) {
+	if err := checkReadable(ctx, p.From); err != nil {
+		return nil, err
+	}
+	src, err := p.From.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := p.To.ListVehicles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []string
+	if len(src) != len(dst) {
+		diffs = append(diffs, fmt.Sprintf("%d vehicles in source, %d in destination", len(src), len(dst)))
+	}
+	copied := make(map[string]storage.Record, len(dst))
+	for _, rec := range dst {
+		copied[rec.ID] = rec
+	}
+	for _, rec := range src {
+		got, ok := copied[rec.ID]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("vehicle %q missing", rec.ID))
+			continue
+		}
+		counts.Vehicles++
+		counts.Readings += len(rec.Data.Readings)
+		if len(got.Data.Readings) != len(rec.Data.Readings) {
+			diffs = append(diffs, fmt.Sprintf("vehicle %q: %d readings in source, %d in destination",
+				rec.ID, len(rec.Data.Readings), len(got.Data.Readings)))
+			continue
+		}
+		if !reflect.DeepEqual(got.Data.Readings, rec.Data.Readings) {
+			diffs = append(diffs, fmt.Sprintf("vehicle %q: readings differ", rec.ID))
+			continue
+		}
+		want := calc.ComputeStatusAt(rec.ID, rec.Data, now)
+		if have := calc.ComputeStatusAt(got.ID, got.Data, now); !reflect.DeepEqual(have, want) {
+			diffs = append(diffs, fmt.Sprintf("vehicle %q: status differs", rec.ID))
+		}
+	}
+
+	srcSettings, err := p.From.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstSettings, err := p.To.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts.Settings++
+	if *srcSettings != *dstSettings {
+		diffs = append(diffs, fmt.Sprintf("settings %+v, destination %+v", *srcSettings, *dstSettings))
+	}
+
+	want, err := liveCurrent(ctx, p.From, src)
+	if err != nil {
+		return nil, err
+	}
+	have, err := p.To.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if want != "" {
+		counts.Current++
+	}
+	if have != want {
+		diffs = append(diffs, fmt.Sprintf("current vehicle %q, destination %q", want, have))
+	}
+	return diffs, nil
+}
@@ -0,0 +1,181 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/auth"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/storage/yamlstore"
+)
+
+var now = time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+func source(t *testing.T) storage.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := storage.NewMemory()
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{
+		Vehicle:  "Golf",
+		Readings: map[string]int{"2025-01-01": 5000, "2025-06-01": 9000},
+		Plan: &model.Plan{
+			Start:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:             time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+			AnnualAllowance: 10000,
+			StartMiles:      5000,
+		},
+	})
+	st.SaveVehicle(ctx, "polo", &model.VehicleData{Vehicle: "Polo", Readings: map[string]int{"2025-01-01": 100}})
+	st.SaveVehicle(ctx, "zoe", &model.VehicleData{Vehicle: "Zoe", Readings: map[string]int{}})
+	st.SetCurrent(ctx, "polo")
+	st.SaveSettings(ctx, &model.Settings{Currency: "EUR", DistanceUnit: "km"})
+	return st
+}
+
+// failingStore fails SaveVehicle for one id until healed.
+type failingStore struct {
+	storage.Store
+	failID string
+}
+
+func (f *failingStore) SaveVehicle(ctx context.Context, id string, data *model.VehicleData) error {
+	if id == f.failID {
+		return errors.New("disk full")
+	}
+	return f.Store.SaveVehicle(ctx, id, data)
+}
+
+func TestCopyResumesAndVerifies(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), ProgressFile)
+	src := source(t)
+	dst := &failingStore{Store: storage.NewMemory(), failID: "polo"}
+	pairs := []Pair{{From: src, To: dst}}
+
+	progress, err := OpenProgress(path, "yaml:/a", "sqlite:/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(ctx, pairs, progress); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("copy: %v", err)
+	}
+	if _, err := Verify(ctx, pairs, now); err == nil || !strings.Contains(err.Error(), `vehicle "polo" missing`) {
+		t.Fatalf("verify after failure: %v", err)
+	}
+
+	// A different pair cannot pick up this progress.
+	if _, err := OpenProgress(path, "yaml:/b", "sqlite:/a"); err == nil {
+		t.Fatal("progress reused for another migration")
+	}
+	progress, err = OpenProgress(path, "yaml:/a", "sqlite:/a")
+	if err != nil || !progress.Resuming() {
+		t.Fatalf("reopen: %v", err)
+	}
+	dst.failID = ""
+	counts, err := Copy(ctx, pairs, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Skipped != 1 || counts.Vehicles != 2 || counts.Current != 1 {
+		t.Fatalf("resumed counts: %+v", counts)
+	}
+	counts, err = Verify(ctx, pairs, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Vehicles != 3 || counts.Readings != 3 || counts.Settings != 1 || counts.Current != 1 {
+		t.Fatalf("verify counts: %+v", counts)
+	}
+	if err := progress.Remove(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyRefusesNonEmptyDestination(t *testing.T) {
+	ctx := context.Background()
+	dst := storage.NewMemory()
+	dst.SaveVehicle(ctx, "other", &model.VehicleData{Vehicle: "Other"})
+	if _, err := Copy(ctx, []Pair{{Tenant: "u1", From: source(t), To: dst}}, nil); !errors.Is(err, ErrDestinationNotEmpty) {
+		t.Fatalf("want ErrDestinationNotEmpty, got %v", err)
+	}
+}
+
+func TestVerifyReportsDifferences(t *testing.T) {
+	ctx := context.Background()
+	src := source(t)
+	dst := storage.NewMemory()
+	pairs := []Pair{{Tenant: "u1", From: src, To: dst}}
+	if _, err := Copy(ctx, pairs, nil); err != nil {
+		t.Fatal(err)
+	}
+	dst.PutReading(ctx, "golf", "2025-06-01", 9500)
+	dst.SaveSettings(ctx, &model.Settings{Currency: "GBP"})
+	_, err := Verify(ctx, pairs, now)
+	for _, want := range []string{`user u1: vehicle "golf": readings differ`, "user u1: settings"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want %q in %v", want, err)
+		}
+	}
+}
+
+// A source that would not copy whole is refused before anything is written.
+func TestCopyRefusesIncompleteSource(t *testing.T) {
+	ctx := context.Background()
+	trashed := source(t)
+	trashed.DeleteReading(ctx, "golf", "2025-06-01")
+	dst := storage.NewMemory()
+	pairs := []Pair{{From: source(t), To: storage.NewMemory()}, {Tenant: "u1", From: trashed, To: dst}}
+	if _, err := Copy(ctx, pairs, nil); !errors.Is(err, ErrTrashNotEmpty) {
+		t.Fatalf("want ErrTrashNotEmpty, got %v", err)
+	}
+	if records, _ := pairs[0].To.ListVehicles(ctx); len(records) != 0 {
+		t.Fatal("an earlier pair was copied before the refusal")
+	}
+
+	dir := t.TempDir()
+	yaml := yamlstore.New(dir)
+	yaml.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000}})
+	if err := os.WriteFile(filepath.Join(dir, "polo.yml"), []byte("readings: [not: a map"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pairs = []Pair{{From: yaml, To: storage.NewMemory()}}
+	if _, err := Copy(ctx, pairs, nil); !errors.Is(err, ErrUnreadable) || !strings.Contains(err.Error(), "polo.yml") {
+		t.Fatalf("want ErrUnreadable naming polo.yml, got %v", err)
+	}
+	if _, err := Verify(ctx, pairs, now); !errors.Is(err, ErrUnreadable) {
+		t.Fatalf("verify: want ErrUnreadable, got %v", err)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+	from, to := auth.NewMemoryUserStore(), auth.NewMemoryUserStore()
+	alice, _ := from.CreateUser(ctx, "alice@example.com", "alice-hash")
+	from.CreateUser(ctx, "bob@example.com", "bob-hash")
+	to.CreateUser(ctx, "bob@example.com", "bob-hash")
+
+	if _, _, err := Accounts(ctx, from, to, true); err == nil {
+		t.Fatal("check passed with alice not copied")
+	}
+	accounts, created, err := Accounts(ctx, from, to, false)
+	if err != nil || created != 1 || len(accounts) != 2 {
+		t.Fatalf("accounts = %+v, %d created, %v", accounts, created, err)
+	}
+	copied, err := to.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil || copied.PasswordHash != "alice-hash" || !slices.Contains(accounts, Account{From: alice.ID, To: copied.ID}) {
+		t.Fatalf("alice = %+v, %v; accounts %+v", copied, err, accounts)
+	}
+	if _, created, err := Accounts(ctx, from, to, false); err != nil || created != 0 {
+		t.Fatalf("rerun created %d, %v", created, err)
+	}
+	if same, _, _ := Accounts(ctx, from, from, true); !slices.Contains(same, Account{From: alice.ID, To: alice.ID}) {
+		t.Fatalf("same store: %+v", same)
+	}
+}
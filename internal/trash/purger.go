@@ -0,0 +1,100 @@
+// Package trash runs the retention sweep that empties old soft-deleted items
+// out of every store's trash (see storage.TrashItem). The trash itself lives in
+// the Store; this package only decides when items are old enough to go.
+package trash
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+// DefaultRetention is how long a deleted vehicle or reading stays restorable
+// when no retention is configured.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Scope is one store the Purger sweeps, with the trips kept beside it.
+type Scope struct {
+	Store storage.Store
+	// Trips, if set, loses the trips of every vehicle the sweep purges (see
+	// trips.DropOrphans).
+	Trips trips.Store
+}
+
+// Purger periodically purges trash items older than Retention from every scope
+// Scopes returns: the one process-wide store in single-user mode, each user's
+// scoped store in hosted mode.
+type Purger struct {
+	Scopes    func(ctx context.Context) ([]Scope, error)
+	Retention time.Duration
+	Interval  time.Duration
+	Now       func() time.Time
+	Logger    *log.Logger
+}
+
+// Run executes RunOnce immediately, then on Interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	p.RunOnce(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce performs one sweep and returns how many items were purged. A store
+// that fails is logged and skipped so one bad tenant does not stall the rest.
+func (p *Purger) RunOnce(ctx context.Context) int {
+	scopes, err := p.Scopes(ctx)
+	if err != nil {
+		p.logf("trash: list stores: %v", err)
+		return 0
+	}
+	retention := p.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	cutoff := p.now().Add(-retention)
+
+	total := 0
+	for _, sc := range scopes {
+		n, err := sc.Store.PurgeTrashBefore(ctx, cutoff)
+		if err != nil {
+			p.logf("trash: purge: %v", err)
+		}
+		total += n
+		if n > 0 && sc.Trips != nil {
+			if _, err := trips.DropOrphans(ctx, sc.Trips, sc.Store); err != nil {
+				p.logf("trash: drop trips: %v", err)
+			}
+		}
+	}
+	return total
+}
+
+func (p *Purger) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *Purger) logf(format string, args ...any) {
+	logger := p.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
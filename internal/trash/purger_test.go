@@ -0,0 +1,56 @@
+package trash
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+	"github.com/jackiabishop/mileminder/internal/trips"
+)
+
+func TestPurgerRemovesOnlyExpiredItems(t *testing.T) {
+	ctx := context.Background()
+	tenants := storage.NewMemoryTenants()
+	var scopes []Scope
+	for _, user := range []string{"u1", "u2"} {
+		st := tenants.ForUser(user)
+		if err := st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-01-01": 5000}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.DeleteVehicle(ctx, "golf"); err != nil {
+			t.Fatal(err)
+		}
+		tripLog := trips.NewMemory()
+		if _, err := tripLog.Save(ctx, trips.Trip{VehicleID: "golf", StartDate: "2025-01-01", Distance: 12}); err != nil {
+			t.Fatal(err)
+		}
+		scopes = append(scopes, Scope{Store: st, Trips: tripLog})
+	}
+
+	p := &Purger{
+		Scopes:    func(context.Context) ([]Scope, error) { return scopes, nil },
+		Retention: 24 * time.Hour,
+		Now:       time.Now,
+		Logger:    log.New(io.Discard, "", 0),
+	}
+	if n := p.RunOnce(ctx); n != 0 {
+		t.Fatalf("fresh deletions purged: %d", n)
+	}
+
+	p.Now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if n := p.RunOnce(ctx); n != 2 {
+		t.Fatalf("expired deletions: want 2 purged, got %d", n)
+	}
+	for _, sc := range scopes {
+		if items, _ := sc.Store.ListTrash(ctx); len(items) != 0 {
+			t.Fatalf("trash not emptied: %+v", items)
+		}
+		if left, _ := sc.Trips.List(ctx, ""); len(left) != 0 {
+			t.Fatalf("purged vehicle's trips kept: %+v", left)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package trips
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/filelock"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// dirName is the subdirectory of a data directory that holds trips. A
+// directory (not a *.yml file) keeps it out of yamlstore's vehicle namespace.
+const dirName = "trips"
+
+// FileStore persists every trip in a data directory in one file,
+// <dataDir>/trips/trips.yml. Every method holds an advisory lock on the trips
+// directory (see internal/filelock) as well as mu, so two FileStores on one
+// directory — one per hosted request, or the trip command beside a running
+// server — cannot lose each other's changes.
+type FileStore struct {
+	dir string
+	key *crypt.Key // nil unless the data directory is encrypted
+	mu  sync.RWMutex
+}
+
+// NewFileStore returns a FileStore for the data directory dataDir (the same
+// directory the vehicle YAML lives in). The directory is created lazily on
+// first write.
+func NewFileStore(dataDir string) *FileStore {
+	return &FileStore{dir: filepath.Join(dataDir, dirName)}
+}
+
+// NewEncryptedFileStore returns a FileStore whose trips.yml is sealed with
+// key, the data directory's (see yamlstore.NewEncrypted). A nil key makes a
+// plain FileStore, as NewFileStore does.
+func NewEncryptedFileStore(dataDir string, key *crypt.Key) *FileStore {
+	return &FileStore{dir: filepath.Join(dataDir, dirName), key: key}
+}
+
+// Convert re-seals the trips in dataDir from one key to another, as
+// yamlstore.Convert does the vehicles, under the trips directory's exclusive
+// lock. It reports whether the file needed it.
+func Convert(dataDir string, from, to *crypt.Key) (bool, error) {
+	s := NewFileStore(dataDir)
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		return false, nil
+	}
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return crypt.ConvertFile(s.path(), from, to)
+}
+
+type tripsDoc struct {
+	Trips []Trip `yaml:"trips"`
+}
+
+// lockRead takes mu and a shared lock on the directory for a read.
+func (s *FileStore) lockRead() (func(), error) {
+	s.mu.RLock()
+	l, err := filelock.ReadDir(s.dir)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.RUnlock()
+	}, nil
+}
+
+// lockWrite takes mu and the exclusive lock on the directory for a
+// read-modify-write.
+func (s *FileStore) lockWrite() (func(), error) {
+	s.mu.Lock()
+	l, err := filelock.WriteDir(s.dir)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		l.Unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *FileStore) path() string {
+	return filepath.Join(s.dir, "trips.yml")
+}
+
+func (s *FileStore) load() ([]Trip, error) {
+	raw, err := crypt.ReadFile(s.key, s.path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read trips: %w", err)
+	}
+	var doc tripsDoc
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse trips: %w", err)
+	}
+	return doc.Trips, nil
+}
+
+func (s *FileStore) save(list []Trip) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("create trips dir: %w", err)
+	}
+	raw, err := yaml.Marshal(tripsDoc{Trips: list})
+	if err != nil {
+		return err
+	}
+	return crypt.WriteFile(s.key, s.path(), 0644, raw)
+}
+
+func (s *FileStore) Save(ctx context.Context, t Trip) (*Trip, error) {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	list, saved, err := save(list, t, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(list); err != nil {
+		return nil, fmt.Errorf("write trips: %w", err)
+	}
+	return saved, nil
+}
+
+func (s *FileStore) List(ctx context.Context, vehicleID string) ([]Trip, error) {
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return filterTrips(list, vehicleID), nil
+}
+
+func (s *FileStore) Get(ctx context.Context, vehicleID, id string) (*Trip, error) {
+	unlock, err := s.lockRead()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return findTrip(list, vehicleID, id)
+}
+
+func (s *FileStore) Delete(ctx context.Context, vehicleID, id string) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	list, err = remove(list, vehicleID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.save(list); err != nil {
+		return fmt.Errorf("write trips: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) MoveVehicle(ctx context.Context, fromID, toID string) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(list, func(t Trip) bool { return t.VehicleID == fromID }) {
+		return nil
+	}
+	move(list, fromID, toID)
+	if err := s.save(list); err != nil {
+		return fmt.Errorf("write trips: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) ReplaceVehicle(ctx context.Context, vehicleID string, with []Trip) error {
+	unlock, err := s.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := s.save(replaceVehicle(list, vehicleID, with)); err != nil {
+		return fmt.Errorf("write trips: %w", err)
+	}
+	return nil
+}
+
+// FileTenants is a Tenants over per-user data directories, <root>/users/<id>,
+// matching yamlstore.Tenants so a user's trips sit beside their vehicles.
+type FileTenants struct {
+	root string
+	key  *crypt.Key
+}
+
+// NewFileTenants returns a FileTenants rooted at the hosted data root.
+func NewFileTenants(root string) *FileTenants {
+	return &FileTenants{root: root}
+}
+
+// NewEncryptedFileTenants returns a FileTenants whose users' trips are
+// sealed with key, the hosted data root's. A nil key makes a plain
+// FileTenants.
+func NewEncryptedFileTenants(root string, key *crypt.Key) *FileTenants {
+	return &FileTenants{root: root, key: key}
+}
+
+// ForUser returns the user's trip store. A malformed user id yields a Store
+// whose every method fails, so a traversal-shaped id can never resolve to a
+// real directory.
+func (t *FileTenants) ForUser(userID string) Store {
+	if !storage.ValidUserID(userID) {
+		return errStore{err: storage.InvalidUserError(userID)}
+	}
+	return NewEncryptedFileStore(filepath.Join(t.root, "users", userID), t.key)
+}
+
+// errStore is the Store for a malformed user id: every method fails, as
+// storage.ErrStore's do.
+type errStore struct {
+	err error
+}
+
+func (e errStore) Save(context.Context, Trip) (*Trip, error)            { return nil, e.err }
+func (e errStore) List(context.Context, string) ([]Trip, error)         { return nil, e.err }
+func (e errStore) Get(context.Context, string, string) (*Trip, error)   { return nil, e.err }
+func (e errStore) Delete(context.Context, string, string) error         { return e.err }
+func (e errStore) MoveVehicle(context.Context, string, string) error    { return e.err }
+func (e errStore) ReplaceVehicle(context.Context, string, []Trip) error { return e.err }
+
+var (
+	_ Store   = (*FileStore)(nil)
+	_ Tenants = (*FileTenants)(nil)
+	_ Store   = errStore{}
+)
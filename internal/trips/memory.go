@@ -0,0 +1,93 @@
+package trips
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store for api and cmd tests.
+type Memory struct {
+	mu   sync.Mutex
+	list []Trip
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Save(ctx context.Context, t Trip) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, saved, err := save(m.list, t, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	m.list = list
+	return saved, nil
+}
+
+func (m *Memory) List(ctx context.Context, vehicleID string) ([]Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return filterTrips(m.list, vehicleID), nil
+}
+
+func (m *Memory) Get(ctx context.Context, vehicleID, id string) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return findTrip(m.list, vehicleID, id)
+}
+
+func (m *Memory) Delete(ctx context.Context, vehicleID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, err := remove(m.list, vehicleID, id)
+	if err != nil {
+		return err
+	}
+	m.list = list
+	return nil
+}
+
+func (m *Memory) MoveVehicle(ctx context.Context, fromID, toID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	move(m.list, fromID, toID)
+	return nil
+}
+
+func (m *Memory) ReplaceVehicle(ctx context.Context, vehicleID string, list []Trip) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.list = replaceVehicle(m.list, vehicleID, list)
+	return nil
+}
+
+// MemoryTenants is an in-memory Tenants; each user gets a lazily-created Memory.
+type MemoryTenants struct {
+	mu    sync.Mutex
+	users map[string]*Memory
+}
+
+// NewMemoryTenants returns an empty in-memory Tenants.
+func NewMemoryTenants() *MemoryTenants {
+	return &MemoryTenants{users: map[string]*Memory{}}
+}
+
+func (t *MemoryTenants) ForUser(userID string) Store {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.users[userID]
+	if !ok {
+		st = NewMemory()
+		t.users[userID] = st
+	}
+	return st
+}
+
+var (
+	_ Store   = (*Memory)(nil)
+	_ Tenants = (*MemoryTenants)(nil)
+)
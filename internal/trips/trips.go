@@ -0,0 +1,343 @@
+// Package trips stores journeys — a date range, the distance covered, what it
+// was for and who drove — against a vehicle. Readings say where the odometer
+// stood; trips say why it moved, which is what a mileage claim or a
+// business/personal split needs.
+//
+// Like attachments, trips live outside the vehicle document and the package is
+// mode-blind: single-user mode holds one Store rooted in the data directory,
+// hosted mode obtains a per-user Store from a Tenants. A trip's end odometer
+// can also be recorded as an ordinary reading (RecordReading), which is how a
+// trip feeds the allowance maths; calc never sees trips directly.
+package trips
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/readings"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+// Trip purposes. The split between them is what Summarize reports.
+const (
+	Business = "business"
+	Personal = "personal"
+)
+
+var (
+	// ErrNotFound is returned when a trip does not exist. Callers use
+	// errors.Is(err, ErrNotFound).
+	ErrNotFound = errors.New("not found")
+
+	// ErrBelowMax is returned by RecordReading for an end odometer below the
+	// vehicle's highest reading.
+	ErrBelowMax = errors.New("trip end odometer is below the vehicle's readings")
+)
+
+// Trip is one journey. Either both odometer readings or Distance is given;
+// with both readings Distance is derived from them. EndDate is the day the
+// trip finished and defaults to StartDate.
+type Trip struct {
+	ID            string    `yaml:"id" json:"id"`
+	VehicleID     string    `yaml:"vehicle_id" json:"vehicle_id"`
+	StartDate     string    `yaml:"start_date" json:"start_date"`
+	EndDate       string    `yaml:"end_date" json:"end_date"`
+	StartOdometer *int      `yaml:"start_odometer,omitempty" json:"start_odometer,omitempty"`
+	EndOdometer   *int      `yaml:"end_odometer,omitempty" json:"end_odometer,omitempty"`
+	Distance      int       `yaml:"distance" json:"distance"`
+	Purpose       string    `yaml:"purpose" json:"purpose"`
+	Driver        string    `yaml:"driver,omitempty" json:"driver,omitempty"`
+	Notes         string    `yaml:"notes,omitempty" json:"notes,omitempty"`
+	CreatedAt     time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// Store persists trips for one user (or the single-user install).
+type Store interface {
+	// Save creates t when its ID is empty — the store assigns the ID and
+	// CreatedAt — and otherwise replaces the trip with that ID on the same
+	// vehicle, or returns ErrNotFound. It returns the stored trip. Validation
+	// (Normalize) is the caller's job; the store only persists.
+	Save(ctx context.Context, t Trip) (*Trip, error)
+
+	// List returns a vehicle's trips by start date. An empty vehicleID lists
+	// every trip. No trips is not an error.
+	List(ctx context.Context, vehicleID string) ([]Trip, error)
+
+	// Get returns one trip, or ErrNotFound.
+	Get(ctx context.Context, vehicleID, id string) (*Trip, error)
+
+	// Delete removes one trip, or returns ErrNotFound.
+	Delete(ctx context.Context, vehicleID, id string) error
+
+	// MoveVehicle re-files every trip on vehicle fromID under toID, keeping
+	// their ids, in one write, so trips follow a vehicle that is renamed or
+	// merged into another.
+	MoveVehicle(ctx context.Context, fromID, toID string) error
+
+	// ReplaceVehicle swaps every trip on vehicleID for list in one write,
+	// keeping list's ids as they are: a restore puts back a vehicle's
+	// archived trips, and an empty list deletes them.
+	ReplaceVehicle(ctx context.Context, vehicleID string, list []Trip) error
+}
+
+// Tenants hands out per-user trip Stores, mirroring storage.Tenants.
+type Tenants interface {
+	ForUser(userID string) Store
+}
+
+// Normalize validates t and fills what can be derived: EndDate from
+// StartDate, Distance from the odometer readings (or a missing reading from
+// the other and the distance) and Purpose (personal unless given). The trip
+// command and the trips API both call it before saving.
+func Normalize(t *Trip) error {
+	start, err := time.Parse("2006-01-02", t.StartDate)
+	if err != nil {
+		return fmt.Errorf("start date %q: expected YYYY-MM-DD", t.StartDate)
+	}
+	if t.EndDate == "" {
+		t.EndDate = t.StartDate
+	}
+	end, err := time.Parse("2006-01-02", t.EndDate)
+	if err != nil {
+		return fmt.Errorf("end date %q: expected YYYY-MM-DD", t.EndDate)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("trip ends (%s) before it starts (%s)", t.EndDate, t.StartDate)
+	}
+
+	switch {
+	case t.StartOdometer != nil && *t.StartOdometer < 0:
+		return fmt.Errorf("start odometer must not be negative")
+	case t.StartOdometer != nil && t.EndOdometer != nil:
+		if *t.EndOdometer < *t.StartOdometer {
+			return fmt.Errorf("end odometer %d must not be below start odometer %d", *t.EndOdometer, *t.StartOdometer)
+		}
+		d := *t.EndOdometer - *t.StartOdometer
+		if t.Distance != 0 && t.Distance != d {
+			return fmt.Errorf("distance %d does not match the odometer readings (%d)", t.Distance, d)
+		}
+		t.Distance = d
+	case t.Distance < 0:
+		return fmt.Errorf("distance must not be negative")
+	case t.Distance == 0:
+		return fmt.Errorf("give the start and end odometer readings or the distance")
+	case t.EndOdometer != nil && *t.EndOdometer < t.Distance:
+		return fmt.Errorf("end odometer %d is less than the distance %d", *t.EndOdometer, t.Distance)
+	}
+	// One reading and the distance give the other.
+	if t.StartOdometer != nil && t.EndOdometer == nil {
+		end := *t.StartOdometer + t.Distance
+		t.EndOdometer = &end
+	}
+	if t.EndOdometer != nil && t.StartOdometer == nil {
+		start := *t.EndOdometer - t.Distance
+		t.StartOdometer = &start
+	}
+
+	if t.Purpose == "" {
+		t.Purpose = Personal
+	}
+	if t.Purpose != Business && t.Purpose != Personal {
+		return fmt.Errorf("purpose must be %q or %q", Business, Personal)
+	}
+	return nil
+}
+
+// RecordReading upserts t's end odometer as a reading on its end date, applying
+// the same below-max rule as adding a reading by hand unless force is set. A
+// trip without an end odometer records nothing.
+func RecordReading(ctx context.Context, st storage.Store, t Trip, force bool) error {
+	if t.EndOdometer == nil {
+		return nil
+	}
+	return st.UpdateVehicle(ctx, t.VehicleID, func(data *model.VehicleData) error {
+		if max, below := readings.BelowMax(data.Readings, data.OdometerChanges, t.EndDate, *t.EndOdometer); below && !force {
+			return fmt.Errorf("%w: %d is less than existing max %d", ErrBelowMax, *t.EndOdometer, max)
+		}
+		if data.Readings == nil {
+			data.Readings = map[string]int{}
+		}
+		data.Readings[t.EndDate] = *t.EndOdometer
+		return nil
+	})
+}
+
+// Summary totals a set of trips.
+type Summary struct {
+	From      string         `json:"from,omitempty"`
+	To        string         `json:"to,omitempty"`
+	Trips     int            `json:"trips"`
+	Distance  int            `json:"distance"`
+	ByPurpose map[string]int `json:"by_purpose"` // purpose → distance
+	ByDriver  map[string]int `json:"by_driver"`  // driver → distance; "" for unrecorded
+	// BusinessShare is the business fraction of Distance, 0–1.
+	BusinessShare float64 `json:"business_share"`
+}
+
+// Summarize totals the trips that start within [from, to] (YYYY-MM-DD, either
+// may be empty for an open end).
+func Summarize(list []Trip, from, to string) Summary {
+	s := Summary{From: from, To: to, ByPurpose: map[string]int{}, ByDriver: map[string]int{}}
+	for _, t := range list {
+		if (from != "" && t.StartDate < from) || (to != "" && t.StartDate > to) {
+			continue
+		}
+		s.Trips++
+		s.Distance += t.Distance
+		s.ByPurpose[t.Purpose] += t.Distance
+		s.ByDriver[t.Driver] += t.Distance
+	}
+	if s.Distance > 0 {
+		s.BusinessShare = float64(s.ByPurpose[Business]) / float64(s.Distance)
+	}
+	return s
+}
+
+// DropOrphans deletes the trips of every vehicle that is neither in vehicles
+// nor in its trash: one deleted for good, whose trips would otherwise turn up
+// on the next vehicle given its id. A vehicle in the trash keeps its trips,
+// so restoring it brings them back. It returns how many trips it deleted.
+func DropOrphans(ctx context.Context, st Store, vehicles storage.Store) (int, error) {
+	list, err := st.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	kept := map[string]bool{}
+	summaries, err := vehicles.ListVehicleSummaries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range summaries {
+		kept[v.ID] = true
+	}
+	items, err := vehicles.ListTrash(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		if it.Kind == storage.TrashVehicle {
+			kept[it.VehicleID] = true
+		}
+	}
+	orphans := map[string]int{}
+	for _, t := range list {
+		if !kept[t.VehicleID] {
+			orphans[t.VehicleID]++
+		}
+	}
+	dropped := 0
+	for id, n := range orphans {
+		if err := st.ReplaceVehicle(ctx, id, nil); err != nil {
+			return dropped, err
+		}
+		dropped += n
+	}
+	return dropped, nil
+}
+
+func newID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// save applies Store.Save's rule to list, returning the updated list and the
+// stored trip.
+func save(list []Trip, t Trip, now time.Time) ([]Trip, *Trip, error) {
+	if t.VehicleID == "" {
+		return nil, nil, fmt.Errorf("trip requires vehicle_id")
+	}
+	if t.ID == "" {
+		t.ID = newID()
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now.UTC()
+		}
+		list = append(list, t)
+		sortTrips(list)
+		return list, &t, nil
+	}
+	for i, existing := range list {
+		if existing.ID == t.ID && existing.VehicleID == t.VehicleID {
+			t.CreatedAt = existing.CreatedAt
+			list[i] = t
+			sortTrips(list)
+			return list, &t, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("save trip %q on %s: %w", t.ID, t.VehicleID, ErrNotFound)
+}
+
+// move re-files list's trips on fromID under toID in place.
+func move(list []Trip, fromID, toID string) {
+	for i := range list {
+		if list[i].VehicleID == fromID {
+			list[i].VehicleID = toID
+		}
+	}
+	sortTrips(list)
+}
+
+// replaceVehicle swaps vehicleID's trips in list for with.
+func replaceVehicle(list []Trip, vehicleID string, with []Trip) []Trip {
+	list = slices.DeleteFunc(list, func(t Trip) bool { return t.VehicleID == vehicleID })
+	for _, t := range with {
+		t.VehicleID = vehicleID
+		list = append(list, t)
+	}
+	sortTrips(list)
+	return list
+}
+
+// remove deletes one trip from list.
+func remove(list []Trip, vehicleID, id string) ([]Trip, error) {
+	for i, t := range list {
+		if t.ID == id && t.VehicleID == vehicleID {
+			return append(list[:i], list[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("delete trip %q on %s: %w", id, vehicleID, ErrNotFound)
+}
+
+// filterTrips returns the trips on vehicleID ("" for all) in a fresh slice.
+func filterTrips(list []Trip, vehicleID string) []Trip {
+	out := []Trip{}
+	for _, t := range list {
+		if vehicleID == "" || t.VehicleID == vehicleID {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// findTrip returns a copy of one trip.
+func findTrip(list []Trip, vehicleID, id string) (*Trip, error) {
+	for _, t := range list {
+		if t.ID == id && t.VehicleID == vehicleID {
+			cp := t
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("get trip %q on %s: %w", id, vehicleID, ErrNotFound)
+}
+
+func sortTrips(list []Trip) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].VehicleID != list[j].VehicleID {
+			return list[i].VehicleID < list[j].VehicleID
+		}
+		if list[i].StartDate != list[j].StartDate {
+			return list[i].StartDate < list[j].StartDate
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+}
@@ -0,0 +1,247 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackiabishop/mileminder/internal/crypt"
+	"github.com/jackiabishop/mileminder/internal/model"
+	"github.com/jackiabishop/mileminder/internal/storage"
+)
+
+func stores(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"file":      NewFileStore(t.TempDir()),
+		"encrypted": NewEncryptedFileStore(t.TempDir(), newKey(t)),
+		"memory":    NewMemory(),
+	}
+}
+
+func newKey(t *testing.T) *crypt.Key {
+	t.Helper()
+	key, err := crypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func miles(n int) *int { return &n }
+
+func TestSaveListGetDelete(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			later, err := st.Save(ctx, Trip{VehicleID: "golf", StartDate: "2025-06-02", Distance: 40, Purpose: Business})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			first, _ := st.Save(ctx, Trip{VehicleID: "golf", StartDate: "2025-06-01", Distance: 10})
+			st.Save(ctx, Trip{VehicleID: "polo", StartDate: "2025-06-01", Distance: 5})
+			if later.ID == "" || later.CreatedAt.IsZero() {
+				t.Fatalf("Save did not fill id: %+v", later)
+			}
+
+			list, err := st.List(ctx, "golf")
+			if err != nil || len(list) != 2 || list[0].ID != first.ID {
+				t.Fatalf("List: %+v, %v", list, err)
+			}
+			if all, _ := st.List(ctx, ""); len(all) != 3 {
+				t.Fatalf("List all: %+v", all)
+			}
+
+			later.Notes = "client visit"
+			if _, err := st.Save(ctx, *later); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if got, err := st.Get(ctx, "golf", later.ID); err != nil || got.Notes != "client visit" {
+				t.Fatalf("Get: %+v, %v", got, err)
+			}
+			if _, err := st.Get(ctx, "polo", later.ID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get on another vehicle: %v", err)
+			}
+			if _, err := st.Save(ctx, Trip{ID: "nope", VehicleID: "golf"}); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("update missing: %v", err)
+			}
+
+			if err := st.MoveVehicle(ctx, "golf", "gti"); err != nil {
+				t.Fatal(err)
+			}
+			if moved, _ := st.List(ctx, "gti"); len(moved) != 2 || moved[1].ID != later.ID || moved[1].Notes != "client visit" {
+				t.Fatalf("moved: %+v", moved)
+			}
+			if left, _ := st.List(ctx, "golf"); len(left) != 0 {
+				t.Fatalf("left behind: %+v", left)
+			}
+			moved, _ := st.List(ctx, "gti")
+			if err := st.Delete(ctx, "gti", moved[0].ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Delete(ctx, "gti", moved[0].ID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Delete missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestDropOrphans(t *testing.T) {
+	ctx := context.Background()
+	for name, ts := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			st := storage.NewMemory()
+			for _, id := range []string{"golf", "polo"} {
+				st.SaveVehicle(ctx, id, &model.VehicleData{Vehicle: id})
+				ts.Save(ctx, Trip{VehicleID: id, StartDate: "2025-06-01", Distance: 10})
+				ts.Save(ctx, Trip{VehicleID: id, StartDate: "2025-06-02", Distance: 20})
+			}
+			st.DeleteVehicle(ctx, "polo")
+
+			// In the trash, polo keeps its trips for a restore.
+			if n, err := DropOrphans(ctx, ts, st); err != nil || n != 0 {
+				t.Fatalf("DropOrphans with polo in the trash: %d, %v", n, err)
+			}
+			items, _ := st.ListTrash(ctx)
+			if err := st.PurgeTrash(ctx, items[0].ID); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := DropOrphans(ctx, ts, st); err != nil || n != 2 {
+				t.Fatalf("DropOrphans after the purge: %d, %v", n, err)
+			}
+			if left, _ := ts.List(ctx, "polo"); len(left) != 0 {
+				t.Fatalf("polo's ts survived: %+v", left)
+			}
+			if kept, _ := ts.List(ctx, "golf"); len(kept) != 2 {
+				t.Fatalf("golf's ts: %+v", kept)
+			}
+		})
+	}
+}
+
+// Each hosted request gets its own FileStore from ForUser, as the trip
+// command and a running server each have their own: concurrent saves through
+// them must all reach trips.yml.
+func TestSaveAcrossStoresLosesNothing(t *testing.T) {
+	ctx := context.Background()
+	tn := NewFileTenants(t.TempDir())
+	errs := make(chan error)
+	for i := range 20 {
+		go func() {
+			_, err := tn.ForUser("alice").Save(ctx, Trip{VehicleID: "golf", StartDate: fmt.Sprintf("2025-06-%02d", i+1), EndDate: fmt.Sprintf("2025-06-%02d", i+1), Distance: 10, Purpose: Personal})
+			errs <- err
+		}()
+	}
+	for range 20 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, _ := tn.ForUser("alice").List(ctx, "golf"); len(list) != 20 {
+		t.Fatalf("kept %d of 20 trips", len(list))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	trip := Trip{VehicleID: "golf", StartDate: "2025-06-01", StartOdometer: miles(1000), EndOdometer: miles(1120)}
+	if err := Normalize(&trip); err != nil {
+		t.Fatal(err)
+	}
+	if trip.Distance != 120 || trip.EndDate != "2025-06-01" || trip.Purpose != Personal {
+		t.Fatalf("normalized: %+v", trip)
+	}
+
+	derived := Trip{StartDate: "2025-06-01", StartOdometer: miles(1000), Distance: 50}
+	if err := Normalize(&derived); err != nil || *derived.EndOdometer != 1050 {
+		t.Fatalf("derived end: %+v, %v", derived, err)
+	}
+
+	for _, bad := range []Trip{
+		{StartDate: "June 1", Distance: 5},
+		{StartDate: "2025-06-02", EndDate: "2025-06-01", Distance: 5},
+		{StartDate: "2025-06-01"},
+		{StartDate: "2025-06-01", StartOdometer: miles(1000), EndOdometer: miles(900)},
+		{StartDate: "2025-06-01", StartOdometer: miles(1000), EndOdometer: miles(1100), Distance: 50},
+		{StartDate: "2025-06-01", Distance: 5, Purpose: "holiday"},
+	} {
+		if err := Normalize(&bad); err == nil {
+			t.Errorf("Normalize(%+v) passed", bad)
+		}
+	}
+
+	negative := Trip{StartDate: "2025-06-01", StartOdometer: miles(-10), EndOdometer: miles(20)}
+	if err := Normalize(&negative); err == nil || !strings.Contains(err.Error(), "start odometer must not be negative") {
+		t.Fatalf("negative start odometer: %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	list := []Trip{
+		{StartDate: "2025-05-31", Distance: 500, Purpose: Business},
+		{StartDate: "2025-06-01", Distance: 30, Purpose: Business, Driver: "sam"},
+		{StartDate: "2025-06-15", Distance: 90, Purpose: Personal},
+		{StartDate: "2025-07-01", Distance: 7, Purpose: Personal},
+	}
+	s := Summarize(list, "2025-06-01", "2025-06-30")
+	if s.Trips != 2 || s.Distance != 120 || s.ByPurpose[Business] != 30 || s.ByDriver["sam"] != 30 || s.ByDriver[""] != 90 {
+		t.Fatalf("summary: %+v", s)
+	}
+	if s.BusinessShare != 0.25 {
+		t.Fatalf("business share = %v", s.BusinessShare)
+	}
+	if all := Summarize(list, "", ""); all.Trips != 4 {
+		t.Fatalf("open range: %+v", all)
+	}
+}
+
+func TestRecordReading(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	st.SaveVehicle(ctx, "golf", &model.VehicleData{Vehicle: "Golf", Readings: map[string]int{"2025-06-01": 5000}})
+
+	if err := RecordReading(ctx, st, Trip{VehicleID: "golf", EndDate: "2025-06-02", EndOdometer: miles(4900)}, false); err == nil {
+		t.Fatal("end odometer below the max reading accepted")
+	}
+	if err := RecordReading(ctx, st, Trip{VehicleID: "golf", EndDate: "2025-06-02", EndOdometer: miles(5100)}, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := st.GetVehicle(ctx, "golf")
+	if data.Readings["2025-06-02"] != 5100 {
+		t.Fatalf("readings: %v", data.Readings)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if changed, err := Convert(dir, nil, newKey(t)); err != nil || changed {
+		t.Fatalf("no trips: %v, %v", changed, err)
+	}
+	if _, err := NewFileStore(dir).Save(ctx, Trip{VehicleID: "golf", StartDate: "2025-06-01", Distance: 40, Driver: "Sam", Purpose: Business}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := newKey(t)
+	if changed, err := Convert(dir, nil, key); err != nil || !changed {
+		t.Fatalf("encrypt: %v, %v", changed, err)
+	}
+	if raw, err := os.ReadFile(filepath.Join(dir, "trips", "trips.yml")); err != nil || !crypt.IsSealed(raw) {
+		t.Fatalf("trips.yml not sealed: %v", err)
+	}
+	if _, err := NewFileStore(dir).List(ctx, "golf"); !errors.Is(err, crypt.ErrSealed) {
+		t.Errorf("plain store: err = %v, want ErrSealed", err)
+	}
+	if list, err := NewEncryptedFileStore(dir, key).List(ctx, "golf"); err != nil || len(list) != 1 || list[0].Driver != "Sam" {
+		t.Fatalf("encrypted store: %+v, %v", list, err)
+	}
+
+	if changed, err := Convert(dir, key, nil); err != nil || !changed {
+		t.Fatalf("decrypt: %v, %v", changed, err)
+	}
+	if list, err := NewFileStore(dir).List(ctx, "golf"); err != nil || len(list) != 1 {
+		t.Fatalf("after decrypt: %+v, %v", list, err)
+	}
+}
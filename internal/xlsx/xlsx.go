@@ -0,0 +1,305 @@
+// Package xlsx writes minimal Office Open XML workbooks using only archive/zip
+// and encoding/xml. It covers what the app's exports need — several sheets of
+// text, number and date cells with a bold header row — and nothing else: no
+// formulas, shared strings, column widths or reading. Strings are written
+// inline, which every spreadsheet app accepts and keeps the writer stateless.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell styles, indexes into cellXfs in styles.xml.
+const (
+	styleDefault = 0
+	styleHeader  = 1 // bold
+	styleDate    = 2 // built-in number format 14, the locale's short date
+)
+
+// excelEpoch is day zero of the 1900 date system as spreadsheets count it
+// (after their deliberate 1900 leap-year bug), so serial = days since epoch.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Workbook is an ordered set of sheets.
+type Workbook struct {
+	sheets []*Sheet
+}
+
+// Sheet is one worksheet of rows.
+type Sheet struct {
+	name string
+	rows [][]cell
+}
+
+type cell struct {
+	kind  byte // 's' string, 'n' number, 'd' date, 'b' bool
+	text  string
+	style int
+}
+
+// New returns an empty workbook.
+func New() *Workbook {
+	return &Workbook{}
+}
+
+// AddSheet appends a sheet. The name is cleaned to what spreadsheet apps
+// accept (at most 31 characters, none of []:*?/\) and made unique.
+func (wb *Workbook) AddSheet(name string) *Sheet {
+	name = sheetName(name)
+	base := name
+	for n := 2; wb.hasSheet(name); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = truncate(base, 31-len(suffix)) + suffix
+	}
+	s := &Sheet{name: name}
+	wb.sheets = append(wb.sheets, s)
+	return s
+}
+
+func (wb *Workbook) hasSheet(name string) bool {
+	for _, s := range wb.sheets {
+		if strings.EqualFold(s.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header appends a bold row of column titles.
+func (s *Sheet) Header(titles ...string) {
+	row := make([]cell, len(titles))
+	for i, t := range titles {
+		row[i] = cell{kind: 's', text: t, style: styleHeader}
+	}
+	s.rows = append(s.rows, row)
+}
+
+// Row appends a row. Supported values are string, int, int64, float64, bool
+// and time.Time (written as a date); nil leaves the cell empty.
+func (s *Sheet) Row(values ...any) {
+	row := make([]cell, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			row[i] = cell{kind: 's', text: v}
+		case int:
+			row[i] = cell{kind: 'n', text: strconv.Itoa(v)}
+		case int64:
+			row[i] = cell{kind: 'n', text: strconv.FormatInt(v, 10)}
+		case float64:
+			row[i] = cell{kind: 'n', text: strconv.FormatFloat(v, 'f', -1, 64)}
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			row[i] = cell{kind: 'b', text: b}
+		case time.Time:
+			y, m, d := v.Date()
+			days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(excelEpoch).Hours() / 24
+			row[i] = cell{kind: 'd', text: strconv.Itoa(int(days)), style: styleDate}
+		default:
+			row[i] = cell{kind: 's', text: fmt.Sprint(v)}
+		}
+	}
+	s.rows = append(s.rows, row)
+}
+
+// Write encodes the workbook as an .xlsx file.
+func (wb *Workbook) Write(w io.Writer) error {
+	if len(wb.sheets) == 0 {
+		wb.AddSheet("Sheet1")
+	}
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		body func(io.Writer) error
+	}{
+		{"[Content_Types].xml", wb.writeContentTypes},
+		{"_rels/.rels", writeString(rootRels)},
+		{"xl/workbook.xml", wb.writeWorkbook},
+		{"xl/_rels/workbook.xml.rels", wb.writeWorkbookRels},
+		{"xl/styles.xml", writeString(styles)},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := f.body(fw); err != nil {
+			return fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+	for i, s := range wb.sheets {
+		name := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := s.write(fw); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func writeString(s string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const rootRels = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const styles = xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`</styleSheet>`
+
+func (wb *Workbook) writeContentTypes(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`</Types>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (wb *Workbook) writeWorkbook(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range wb.sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (wb *Workbook) writeWorkbookRels(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	// The styles part takes the id after the last sheet.
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(wb.sheets)+1)
+	b.WriteString(`</Relationships>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (s *Sheet) write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.rows) > 0 && len(s.rows[0]) > 0 && s.rows[0][0].style == styleHeader {
+		// Keep the header row visible while scrolling.
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	b.WriteString(`<sheetData>`)
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cl := range row {
+			if cl.kind == 0 {
+				continue
+			}
+			ref := columnName(c) + strconv.Itoa(r+1)
+			style := ""
+			if cl.style != styleDefault {
+				style = fmt.Sprintf(` s="%d"`, cl.style)
+			}
+			switch cl.kind {
+			case 's':
+				fmt.Fprintf(&b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escape(cl.text))
+			case 'b':
+				fmt.Fprintf(&b, `<c r="%s"%s t="b"><v>%s</v></c>`, ref, style, cl.text)
+			default:
+				fmt.Fprintf(&b, `<c r="%s"%s><v>%s</v></c>`, ref, style, cl.text)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// columnName converts a zero-based column index to its letters: 0 → A,
+// 25 → Z, 26 → AA.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escape XML-escapes s and drops characters XML 1.0 cannot carry at all.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)))
+	return b.String()
+}
+
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	return truncate(name, 31)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
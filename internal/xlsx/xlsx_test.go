@@ -0,0 +1,95 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteProducesWellFormedParts(t *testing.T) {
+	wb := New()
+	s := wb.AddSheet("Readings")
+	s.Header("Date", "Miles", "Note")
+	s.Row(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 5000, "A&B <fuel> \"quoted\"\x01")
+	s.Row(nil, 12.5, true)
+
+	var buf bytes.Buffer
+	if err := wb.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"[Content_Types].xml": false, "_rels/.rels": false, "xl/workbook.xml": false,
+		"xl/_rels/workbook.xml.rels": false, "xl/styles.xml": false, "xl/worksheets/sheet1.xml": false,
+	}
+	var sheet string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(rc)
+		rc.Close()
+		dec := xml.NewDecoder(bytes.NewReader(raw))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %v", f.Name, err)
+			}
+		}
+		want[f.Name] = true
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			sheet = string(raw)
+		}
+	}
+	for name, seen := range want {
+		if !seen {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	for _, cell := range []string{
+		`<c r="A2" s="2"><v>45658</v></c>`, // 2025-01-01 as a date serial
+		`<c r="B2"><v>5000</v></c>`,
+		`A&amp;B &lt;fuel&gt;`,
+		`<c r="B3"><v>12.5</v></c>`,
+		`<c r="C3" t="b"><v>1</v></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("sheet missing %s:\n%s", cell, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="A3"`) {
+		t.Error("nil value should leave the cell out")
+	}
+}
+
+func TestSheetNames(t *testing.T) {
+	wb := New()
+	a := wb.AddSheet("Fleet: 2025/26")
+	b := wb.AddSheet("fleet- 2025-26")
+	long := wb.AddSheet(strings.Repeat("x", 40))
+	if a.name != "Fleet- 2025-26" || b.name != "fleet- 2025-26 (2)" {
+		t.Fatalf("names = %q, %q", a.name, b.name)
+	}
+	if len(long.name) != 31 {
+		t.Fatalf("long name not truncated: %q", long.name)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
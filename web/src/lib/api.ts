@@ -37,6 +37,7 @@ export interface VehicleStatus {
 	plan_end: string;
 	annual_allowance: number;
 	start_miles: number;
+	start_miles_current: number;
 	is_default: boolean;
 	// Renewal countdown + final-mileage estimate (#3)
 	days_to_end: number;
@@ -384,6 +385,36 @@ export async function getMe(): Promise<User> {
 	return fetchJSON<User>(`${API_BASE}/auth/me`);
 }
 
+// Live updates (GET /api/v1/events): what changed, pushed as it happens —
+// including changes made from the CLI or another device. "resync" means events
+// were missed and everything should be refetched.
+export interface LiveEvent {
+	type: 'vehicle-changed' | 'reading-added' | 'reading-deleted' | 'status-recomputed' | 'resync';
+	vehicle_id?: string;
+	from?: string;
+	removed?: boolean;
+	date?: string;
+	miles?: number;
+	status?: VehicleStatus;
+}
+
+const liveEventTypes: LiveEvent['type'][] = ['vehicle-changed', 'reading-added', 'reading-deleted', 'status-recomputed', 'resync'];
+
+// Subscribe to live updates. The browser reconnects by itself, resuming after
+// the last event it saw. Returns a function that closes the stream.
+export function subscribeEvents(onEvent: (event: LiveEvent) => void): () => void {
+	if (typeof EventSource === 'undefined') {
+		return () => {};
+	}
+	const source = new EventSource(`${API_BASE}/events`);
+	for (const type of liveEventTypes) {
+		source.addEventListener(type, (e) => {
+			onEvent({ ...JSON.parse((e as MessageEvent).data), type });
+		});
+	}
+	return () => source.close();
+}
+
 // Export CSV (returns download URL)
 export function getExportURL(vehicleId: string): string {
 	return `${API_BASE}/vehicles/${encodeURIComponent(vehicleId)}/export`;